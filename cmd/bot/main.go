@@ -9,22 +9,48 @@ import (
 	"syscall"
 	"time"
 
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/broadcast"
+	"tg_pay_gateway_bot/internal/callback"
 	"tg_pay_gateway_bot/internal/config"
 	"tg_pay_gateway_bot/internal/domain"
 	"tg_pay_gateway_bot/internal/feature/group"
+	"tg_pay_gateway_bot/internal/feature/invoice"
+	"tg_pay_gateway_bot/internal/feature/merchant"
+	"tg_pay_gateway_bot/internal/feature/order"
 	"tg_pay_gateway_bot/internal/feature/owner"
+	"tg_pay_gateway_bot/internal/feature/role"
 	"tg_pay_gateway_bot/internal/feature/user"
+	"tg_pay_gateway_bot/internal/health"
+	"tg_pay_gateway_bot/internal/ledger"
 	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/metrics"
+	"tg_pay_gateway_bot/internal/notify"
+	"tg_pay_gateway_bot/internal/payment"
+	"tg_pay_gateway_bot/internal/payment/mock"
 	"tg_pay_gateway_bot/internal/store"
 	"tg_pay_gateway_bot/internal/telegram"
 )
 
 const (
-	mongoConnectTimeout     = 10 * time.Second
-	mongoIndexTimeout       = 5 * time.Second
-	mongoDisconnectTimeout  = 5 * time.Second
-	ownerBootstrapTimeout   = 5 * time.Second
-	telegramShutdownTimeout = 10 * time.Second
+	mongoConnectTimeout      = 10 * time.Second
+	mongoIndexTimeout        = 5 * time.Second
+	mongoDisconnectTimeout   = 5 * time.Second
+	ownerBootstrapTimeout    = 5 * time.Second
+	telegramShutdownTimeout  = 10 * time.Second
+	telegramWebhookTimeout   = 10 * time.Second
+	telegramCommandsTimeout  = 5 * time.Minute
+	callbackShutdownTimeout  = 10 * time.Second
+	notifyShutdownTimeout    = 15 * time.Second
+	broadcastShutdownTimeout = 10 * time.Second
+	expiryShutdownTimeout    = 10 * time.Second
+	metricsShutdownTimeout   = 10 * time.Second
+	healthShutdownTimeout    = 10 * time.Second
+	mockStubShutdownTimeout  = 10 * time.Second
+
+	// mockStubListenAddr binds the in-process mock channel stub to a free
+	// loopback port.
+	mockStubListenAddr = "127.0.0.1:0"
 )
 
 var processStart = time.Now()
@@ -59,8 +85,10 @@ func main() {
 		"mongo_db": cfg.MongoDB,
 	}).Info("configuration loaded")
 
+	appMetrics := metrics.New(processStart)
+
 	connectCtx, cancel := context.WithTimeout(context.Background(), mongoConnectTimeout)
-	mongoManager, err := store.NewManager(connectCtx, cfg)
+	mongoManager, err := store.NewManager(connectCtx, cfg, store.WithOperationObserver(appMetrics))
 	cancel()
 	if err != nil {
 		logger.WithError(err).Error("mongo connection error")
@@ -70,6 +98,39 @@ func main() {
 
 	logger.WithField("event", "mongo_connect").Info("connected to mongo")
 
+	// Probes and metrics start before the rest of startup so liveness is
+	// answered while readiness still reports what is missing.
+	probes := health.NewProbes(mongoManager, processStart, logger)
+
+	metricsCtx, cancelMetrics := context.WithCancel(context.Background())
+	metricsDone := make(chan struct{})
+
+	if cfg.MetricsEnabled() {
+		metricsServer := metrics.NewServer(cfg.MetricsListenAddr, appMetrics, logger)
+		if cfg.HealthListenAddr == cfg.MetricsListenAddr {
+			probes.Register(metricsServer)
+		}
+		go func() {
+			metricsServer.Start(metricsCtx)
+			close(metricsDone)
+		}()
+	} else {
+		close(metricsDone)
+	}
+
+	healthCtx, cancelHealth := context.WithCancel(context.Background())
+	healthDone := make(chan struct{})
+
+	if cfg.HealthEnabled() && cfg.HealthListenAddr != cfg.MetricsListenAddr {
+		healthServer := health.NewServer(cfg.HealthListenAddr, probes, logger)
+		go func() {
+			healthServer.Start(healthCtx)
+			close(healthDone)
+		}()
+	} else {
+		close(healthDone)
+	}
+
 	indexCtx, cancelIndexes := context.WithTimeout(context.Background(), mongoIndexTimeout)
 	if err := mongoManager.EnsureBaseIndexes(indexCtx); err != nil {
 		cancelIndexes()
@@ -78,10 +139,13 @@ func main() {
 		os.Exit(1)
 	}
 	cancelIndexes()
+	probes.MarkIndexesReady()
 
 	logger.WithField("event", "mongo_indexes").Info("ensured base mongo indexes")
 
-	ownerRegistrar := owner.NewRegistrar(mongoManager.Users(), logger)
+	auditService := audit.NewService(audit.NewRepository(mongoManager.Audit()), logger)
+
+	ownerRegistrar := owner.NewRegistrar(mongoManager.Users(), auditService, logger)
 	ownerCtx, cancelOwner := context.WithTimeout(context.Background(), ownerBootstrapTimeout)
 	if err := ownerRegistrar.EnsureOwner(ownerCtx, cfg.BotOwnerID); err != nil {
 		cancelOwner()
@@ -92,8 +156,15 @@ func main() {
 	cancelOwner()
 
 	userRegistrar := user.NewRegistrar(mongoManager.Users(), logger)
-	groupRegistrar := group.NewRegistrar(mongoManager.Groups(), logger)
 	userRepository := domain.NewUserRepository(mongoManager.Users())
+	merchantRepository := domain.NewMerchantRepository(mongoManager.Merchants())
+	groupRegistrar := group.NewRegistrar(mongoManager.Groups(), merchantRepository, logger)
+	orderRepository := domain.NewOrderRepository(mongoManager.Orders(), mongoManager, logger)
+	notificationRepository := domain.NewNotificationRepository(mongoManager.Notifications())
+	dispatcher := notify.NewDispatcher(notificationRepository, orderRepository, merchantRepository, logger)
+	ledgerService := ledger.NewService(ledger.NewRepository(mongoManager.Ledger(), mongoManager.LedgerHeads()), mongoManager, merchantRepository, logger)
+	orderRepository.OnTransition(ledgerService.OrderTransitioned)
+	orderRepository.OnTransition(dispatcher.OrderTransitioned)
 	statsProvider := store.NewStatsProvider(mongoManager.Users(), mongoManager.Groups())
 
 	tgClient, err := telegram.NewClient(cfg, logger,
@@ -102,7 +173,12 @@ func main() {
 		telegram.WithMongoChecker(mongoManager),
 		telegram.WithProcessStart(processStart),
 		telegram.WithUserFetcher(userRepository),
+		telegram.WithUserLister(userRepository),
+		telegram.WithGroupLister(domain.NewGroupRepository(mongoManager.Groups())),
 		telegram.WithStatsProvider(statsProvider),
+		telegram.WithCommandAuditor(auditService),
+		telegram.WithMetrics(appMetrics),
+		telegram.WithConversationStore(domain.NewConversationRepository(mongoManager.Conversations())),
 	)
 	if err != nil {
 		logger.WithError(err).Error("telegram client setup error")
@@ -110,8 +186,100 @@ func main() {
 		os.Exit(1)
 	}
 
+	broadcastService := broadcast.NewService(
+		domain.NewBroadcastRepository(mongoManager.Broadcasts()),
+		store.NewRecipients(mongoManager.Users(), mongoManager.Groups()),
+		userRepository,
+		tgClient,
+		logger,
+	)
+
+	// Mock channels without a base URL are served by an in-process stub.
+	channelConfigs := append([]config.PaymentChannel(nil), cfg.PaymentChannels...)
+	stubMerchants := make(map[string]string)
+	for _, channel := range channelConfigs {
+		if channel.Adapter == mock.AdapterName && channel.BaseURL == "" {
+			stubMerchants[channel.MerchantID] = channel.Secret
+		}
+	}
+	var mockStub *mock.Stub
+	if len(stubMerchants) > 0 {
+		mockStub = mock.NewStub(stubMerchants, logger)
+		stubURL, err := mockStub.Listen(mockStubListenAddr)
+		if err != nil {
+			logger.WithError(err).Error("mock channel stub setup error")
+			fmt.Fprintf(os.Stderr, "mock channel stub setup error: %v\n", err)
+			os.Exit(1)
+		}
+		for i := range channelConfigs {
+			if channelConfigs[i].Adapter == mock.AdapterName && channelConfigs[i].BaseURL == "" {
+				channelConfigs[i].BaseURL = stubURL
+			}
+		}
+	}
+
+	paymentChannels, err := payment.NewRegistry(channelConfigs, map[string]payment.Factory{
+		mock.AdapterName: mock.New,
+	})
+	if err != nil {
+		logger.WithError(err).Error("payment channel setup error")
+		fmt.Fprintf(os.Stderr, "payment channel setup error: %v\n", err)
+		os.Exit(1)
+	}
+	paymentRouter := payment.NewRouter(
+		paymentChannels,
+		payment.NewRepository(mongoManager.PaymentChannels(), mongoManager.PaymentChannelOutcomes(), mongoManager.PaymentChannelVolume()),
+		cfg.PaymentRouting,
+		logger,
+	)
+
+	merchantService := merchant.NewService(merchantRepository, tgClient, logger)
+	invoiceService := invoice.NewService(orderRepository, merchantRepository, tgClient, auditService, logger)
+	commands := append(merchantService.Commands(), dispatcher.Commands()...)
+	commands = append(commands, ledgerService.Commands()...)
+	commands = append(commands, order.NewService(orderRepository, merchantRepository, notificationRepository, logger).Commands()...)
+	commands = append(commands, role.NewService(userRepository, tgClient, auditService, logger).Commands()...)
+	commands = append(commands, auditService.Commands()...)
+	commands = append(commands, broadcastService.Commands()...)
+	commands = append(commands, invoiceService.Commands()...)
+	commands = append(commands, payment.NewService(orderRepository, merchantRepository, paymentChannels, paymentRouter, auditService, cfg.CallbackPublicURL, logger).Commands()...)
+	if err := tgClient.RegisterCommands(commands...); err != nil {
+		logger.WithError(err).Error("telegram command registration error")
+		fmt.Fprintf(os.Stderr, "telegram command registration error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := tgClient.RegisterCallbacks(broadcastService.Callbacks()...); err != nil {
+		logger.WithError(err).Error("telegram callback registration error")
+		fmt.Fprintf(os.Stderr, "telegram callback registration error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := tgClient.RegisterDialogs(merchantService.Dialogs()...); err != nil {
+		logger.WithError(err).Error("telegram dialog registration error")
+		fmt.Fprintf(os.Stderr, "telegram dialog registration error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := tgClient.SetPaymentProcessor(invoiceService); err != nil {
+		logger.WithError(err).Error("telegram payment processor setup error")
+		fmt.Fprintf(os.Stderr, "telegram payment processor setup error: %v\n", err)
+		os.Exit(1)
+	}
+
+	appMetrics.TrackUpdateQueue(func() int { return tgClient.DispatcherStats().QueueDepth })
+	probes.SetTelegram(tgClient)
+
 	logger.WithField("event", "telegram_ready").Info("telegram client initialized")
 
+	if tgClient.UsesWebhook() {
+		webhookCtx, cancelWebhook := context.WithTimeout(context.Background(), telegramWebhookTimeout)
+		if err := tgClient.SetWebhook(webhookCtx); err != nil {
+			cancelWebhook()
+			logger.WithError(err).Error("telegram webhook setup error")
+			fmt.Fprintf(os.Stderr, "telegram webhook setup error: %v\n", err)
+			os.Exit(1)
+		}
+		cancelWebhook()
+	}
+
 	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -123,14 +291,83 @@ func main() {
 		close(tgDone)
 	}()
 
+	// Menus take one call per tracked group and admin, so they are published
+	// in the background instead of holding up startup.
+	go func() {
+		commandsCtx, cancelCommands := context.WithTimeout(telegramCtx, telegramCommandsTimeout)
+		defer cancelCommands()
+		if err := tgClient.PublishCommands(commandsCtx); err != nil {
+			logger.WithField("event", "telegram_commands_publish_failed").WithError(err).Warn("failed to publish telegram command menu")
+		}
+	}()
+
+	callbackCtx, cancelCallbacks := context.WithCancel(context.Background())
+	callbackDone := make(chan struct{})
+
+	if cfg.CallbacksEnabled() {
+		callbackServer := callback.NewServer(cfg, orderRepository, paymentChannels, logger)
+		go func() {
+			callbackServer.Start(callbackCtx)
+			close(callbackDone)
+		}()
+	} else {
+		close(callbackDone)
+	}
+
+	mockStubCtx, cancelMockStub := context.WithCancel(context.Background())
+	mockStubDone := make(chan struct{})
+
+	if mockStub != nil {
+		go func() {
+			mockStub.Start(mockStubCtx)
+			close(mockStubDone)
+		}()
+	} else {
+		close(mockStubDone)
+	}
+
+	notifyCtx, cancelNotify := context.WithCancel(context.Background())
+	notifyDone := make(chan struct{})
+
+	go func() {
+		dispatcher.Start(notifyCtx)
+		close(notifyDone)
+	}()
+
+	broadcastCtx, cancelBroadcast := context.WithCancel(context.Background())
+	broadcastDone := make(chan struct{})
+
+	go func() {
+		broadcastService.Start(broadcastCtx)
+		close(broadcastDone)
+	}()
+
+	expiryCtx, cancelExpiry := context.WithCancel(context.Background())
+	expiryDone := make(chan struct{})
+	orderExpirer := order.NewExpirer(orderRepository, cfg.OrderTTL, logger)
+
+	go func() {
+		orderExpirer.Start(expiryCtx)
+		close(expiryDone)
+	}()
+
 	select {
 	case <-signalCtx.Done():
-		logger.WithField("event", "shutdown_signal").Info("received termination signal, stopping telegram polling")
+		logger.WithField("event", "shutdown_signal").Info("received termination signal, stopping telegram updates")
 	case <-tgDone:
 		logger.WithField("event", "telegram_stopped_early").Warn("telegram client stopped before shutdown signal")
 	}
 
+	// Withdraw readiness before polling stops so orchestrators route away
+	// while in-flight work drains.
+	probes.MarkShuttingDown()
+
 	cancelTelegram()
+	cancelCallbacks()
+	cancelMockStub()
+	cancelNotify()
+	cancelBroadcast()
+	cancelExpiry()
 
 	waitCtx, cancelWait := context.WithTimeout(context.Background(), telegramShutdownTimeout)
 	select {
@@ -140,6 +377,75 @@ func main() {
 	}
 	cancelWait()
 
+	callbackWaitCtx, cancelCallbackWait := context.WithTimeout(context.Background(), callbackShutdownTimeout)
+	select {
+	case <-callbackDone:
+	case <-callbackWaitCtx.Done():
+		logger.WithField("event", "callback_shutdown_timeout").Warn("timed out waiting for payment callback listener to stop")
+	}
+	cancelCallbackWait()
+
+	mockStubWaitCtx, cancelMockStubWait := context.WithTimeout(context.Background(), mockStubShutdownTimeout)
+	select {
+	case <-mockStubDone:
+	case <-mockStubWaitCtx.Done():
+		logger.WithField("event", "mock_stub_shutdown_timeout").Warn("timed out waiting for mock channel stub to stop")
+	}
+	cancelMockStubWait()
+
+	notifyWaitCtx, cancelNotifyWait := context.WithTimeout(context.Background(), notifyShutdownTimeout)
+	select {
+	case <-notifyDone:
+	case <-notifyWaitCtx.Done():
+		logger.WithField("event", "notify_shutdown_timeout").Warn("timed out waiting for merchant notification workers to stop")
+	}
+	cancelNotifyWait()
+
+	broadcastWaitCtx, cancelBroadcastWait := context.WithTimeout(context.Background(), broadcastShutdownTimeout)
+	select {
+	case <-broadcastDone:
+	case <-broadcastWaitCtx.Done():
+		logger.WithField("event", "broadcast_shutdown_timeout").Warn("timed out waiting for broadcast worker to stop")
+	}
+	cancelBroadcastWait()
+
+	expiryWaitCtx, cancelExpiryWait := context.WithTimeout(context.Background(), expiryShutdownTimeout)
+	select {
+	case <-expiryDone:
+	case <-expiryWaitCtx.Done():
+		logger.WithField("event", "order_expiry_shutdown_timeout").Warn("timed out waiting for order expiry sweep to stop")
+	}
+	cancelExpiryWait()
+
+	// The probe and metrics listeners stop last so they keep answering
+	// (not ready) while the workers drain.
+	cancelHealth()
+	cancelMetrics()
+
+	healthWaitCtx, cancelHealthWait := context.WithTimeout(context.Background(), healthShutdownTimeout)
+	select {
+	case <-healthDone:
+	case <-healthWaitCtx.Done():
+		logger.WithField("event", "health_shutdown_timeout").Warn("timed out waiting for health probe listener to stop")
+	}
+	cancelHealthWait()
+
+	metricsWaitCtx, cancelMetricsWait := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	select {
+	case <-metricsDone:
+	case <-metricsWaitCtx.Done():
+		logger.WithField("event", "metrics_shutdown_timeout").Warn("timed out waiting for metrics listener to stop")
+	}
+	cancelMetricsWait()
+
+	if tgClient.UsesWebhook() {
+		webhookCtx, cancelWebhook := context.WithTimeout(context.Background(), telegramWebhookTimeout)
+		if err := tgClient.DeleteWebhook(webhookCtx); err != nil {
+			logger.WithError(err).Error("telegram webhook removal error")
+		}
+		cancelWebhook()
+	}
+
 	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), mongoDisconnectTimeout)
 	if err := mongoManager.Close(shutdownCtx); err != nil {
 		logger.WithError(err).Error("mongo disconnect error")
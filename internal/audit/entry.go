@@ -0,0 +1,91 @@
+// Package audit keeps a persistent trail of privileged actions: owner
+// bootstrap, role changes, and admin command invocations and denials.
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded in the audit trail.
+const (
+	// ActionOwnerBootstrap records the configured BOT_OWNER taking the owner
+	// role at startup.
+	ActionOwnerBootstrap = "owner_bootstrap"
+	// ActionRoleChange records a user's role moving between roles.
+	ActionRoleChange = "role_change"
+	// ActionCommand records a privileged command invocation; the target is the
+	// command line.
+	ActionCommand = "command"
+	// ActionCallback records a privileged inline button press; the target is
+	// the button's callback data.
+	ActionCallback = "callback"
+	// ActionStarRefund records a Telegram Stars payment refunded to its
+	// payer; the target is the order.
+	ActionStarRefund = "star_refund"
+	// ActionChannelRefund records a payment refunded through its upstream
+	// channel; the target is the order.
+	ActionChannelRefund = "channel_refund"
+	// ActionChannelToggle records a payment channel being enabled or
+	// disabled for routing; the target is the channel.
+	ActionChannelToggle = "channel_toggle"
+)
+
+// Outcomes of an audited action.
+const (
+	OutcomeSuccess = "success"
+	OutcomeAllowed = "allowed"
+	OutcomeDenied  = "denied"
+	OutcomeFailed  = "failed"
+)
+
+// SystemActor is the actor id recorded for actions the bot takes on its own,
+// such as the owner bootstrap.
+const SystemActor int64 = 0
+
+// Entry is a single audit record. Before and After hold the affected value,
+// e.g. the role, on either side of the change.
+type Entry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	ActorID   int64              `bson:"actor_id"`
+	ActorRole string             `bson:"actor_role,omitempty"`
+	ChatID    int64              `bson:"chat_id,omitempty"`
+	Action    string             `bson:"action"`
+	Target    string             `bson:"target,omitempty"`
+	Before    string             `bson:"before,omitempty"`
+	After     string             `bson:"after,omitempty"`
+	Outcome   string             `bson:"outcome"`
+	Reason    string             `bson:"reason,omitempty"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// Validate checks that the entry names an action and an outcome.
+func (e Entry) Validate() error {
+	if e.Action == "" {
+		return errors.New("audit action is required")
+	}
+	switch e.Outcome {
+	case OutcomeSuccess, OutcomeAllowed, OutcomeDenied, OutcomeFailed:
+		return nil
+	default:
+		return fmt.Errorf("unknown audit outcome %q", e.Outcome)
+	}
+}
+
+// UserTarget formats a user id as an audit target.
+func UserTarget(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// OrderTarget formats an order id as an audit target.
+func OrderTarget(orderID string) string {
+	return "order:" + orderID
+}
+
+// ChannelTarget formats a payment channel code as an audit target.
+func ChannelTarget(code string) string {
+	return "channel:" + code
+}
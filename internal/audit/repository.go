@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type entryCollection interface {
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+}
+
+// Repository persists audit entries in MongoDB. Expiry is handled by the TTL
+// index on created_at.
+type Repository struct {
+	collection entryCollection
+}
+
+// NewRepository constructs a Repository.
+func NewRepository(collection entryCollection) *Repository {
+	return &Repository{collection: collection}
+}
+
+// Insert stores an entry and returns it with the generated id.
+func (r *Repository) Insert(ctx context.Context, entry Entry) (Entry, error) {
+	if r == nil || r.collection == nil {
+		return Entry{}, errors.New("audit repository is not initialized")
+	}
+	if ctx == nil {
+		return Entry{}, errors.New("context is required")
+	}
+	if err := entry.Validate(); err != nil {
+		return Entry{}, err
+	}
+	if entry.CreatedAt.IsZero() {
+		return Entry{}, errors.New("created_at is required")
+	}
+
+	result, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("insert audit entry: %w", err)
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		entry.ID = id
+	}
+
+	return entry, nil
+}
+
+// List returns up to limit entries, newest first, after skipping skip entries.
+func (r *Repository) List(ctx context.Context, skip, limit int64) ([]Entry, error) {
+	if r == nil || r.collection == nil {
+		return nil, errors.New("audit repository is not initialized")
+	}
+	if ctx == nil {
+		return nil, errors.New("context is required")
+	}
+	if skip < 0 || limit <= 0 {
+		return nil, fmt.Errorf("invalid page skip=%d limit=%d", skip, limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(skip).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find audit entries: %w", err)
+	}
+
+	entries := make([]Entry, 0, limit)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("decode audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Count returns the number of retained entries.
+func (r *Repository) Count(ctx context.Context) (int64, error) {
+	if r == nil || r.collection == nil {
+		return 0, errors.New("audit repository is not initialized")
+	}
+	if ctx == nil {
+		return 0, errors.New("context is required")
+	}
+
+	total, err := r.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, fmt.Errorf("count audit entries: %w", err)
+	}
+
+	return total, nil
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRepositoryInsertValidates(t *testing.T) {
+	coll := &recordingEntryCollection{}
+	repo := NewRepository(coll)
+	ctx := context.Background()
+
+	entry := Entry{ActorID: 1, Action: ActionCommand, Outcome: OutcomeAllowed, CreatedAt: time.Now()}
+	stored, err := repo.Insert(ctx, entry)
+	if err != nil {
+		t.Fatalf("Insert returned error: %v", err)
+	}
+	if stored.ID.IsZero() || len(coll.inserted) != 1 {
+		t.Fatalf("expected entry to be stored with an id, got %+v", stored)
+	}
+
+	for name, bad := range map[string]Entry{
+		"missing action":  {Outcome: OutcomeAllowed, CreatedAt: time.Now()},
+		"unknown outcome": {Action: ActionCommand, Outcome: "maybe", CreatedAt: time.Now()},
+		"missing time":    {Action: ActionCommand, Outcome: OutcomeAllowed},
+	} {
+		if _, err := repo.Insert(ctx, bad); err == nil {
+			t.Fatalf("%s: expected Insert to fail", name)
+		}
+	}
+
+	coll.insertErr = errors.New("write failed")
+	if _, err := repo.Insert(ctx, entry); !errors.Is(err, coll.insertErr) {
+		t.Fatalf("expected wrapped insert error, got %v", err)
+	}
+}
+
+func TestRepositoryListPagesNewestFirst(t *testing.T) {
+	coll := &recordingEntryCollection{results: []interface{}{
+		bson.M{"actor_id": int64(1), "action": ActionRoleChange, "outcome": OutcomeSuccess, "created_at": time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}}
+	repo := NewRepository(coll)
+
+	entries, err := repo.List(context.Background(), 20, 10)
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != ActionRoleChange {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	opts := coll.findOpts
+	if opts.Skip == nil || *opts.Skip != 20 || opts.Limit == nil || *opts.Limit != 10 {
+		t.Fatalf("expected skip 20 limit 10, got skip=%v limit=%v", opts.Skip, opts.Limit)
+	}
+	sort, ok := opts.Sort.(bson.D)
+	if !ok || len(sort) != 2 || sort[0].Key != "created_at" || sort[0].Value != -1 {
+		t.Fatalf("expected newest-first sort, got %v", opts.Sort)
+	}
+
+	if _, err := repo.List(context.Background(), 0, 0); err == nil {
+		t.Fatalf("expected an empty page to be rejected")
+	}
+}
+
+type recordingEntryCollection struct {
+	inserted  []interface{}
+	insertErr error
+	results   []interface{}
+	findOpts  *options.FindOptions
+	count     int64
+}
+
+func (c *recordingEntryCollection) InsertOne(_ context.Context, document interface{}, _ ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	if c.insertErr != nil {
+		return nil, c.insertErr
+	}
+	c.inserted = append(c.inserted, document)
+	return &mongo.InsertOneResult{InsertedID: primitive.NewObjectID()}, nil
+}
+
+func (c *recordingEntryCollection) Find(_ context.Context, _ interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	c.findOpts = options.MergeFindOptions(opts...)
+	return mongo.NewCursorFromDocuments(c.results, nil, nil)
+}
+
+func (c *recordingEntryCollection) CountDocuments(context.Context, interface{}, ...*options.CountOptions) (int64, error) {
+	return c.count, nil
+}
@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const (
+	// DefaultPageSize is the number of entries /audit shows without arguments.
+	DefaultPageSize = 10
+	// MaxPageSize keeps /audit replies within Telegram's message limit.
+	MaxPageSize = 50
+
+	writeTimeout = 3 * time.Second
+	auditUsage   = "Usage: /audit [n] [page]"
+)
+
+type entryStore interface {
+	Insert(ctx context.Context, entry Entry) (Entry, error)
+	List(ctx context.Context, skip, limit int64) ([]Entry, error)
+	Count(ctx context.Context) (int64, error)
+}
+
+// Service records audit entries and serves the /audit command.
+type Service struct {
+	entries entryStore
+	logger  *logrus.Entry
+	now     func() time.Time
+}
+
+// NewService constructs a Service backed by the audit repository.
+func NewService(entries entryStore, logger *logrus.Entry) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Service{
+		entries: entries,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Record stores an entry, stamping created_at. Auditing never fails the action
+// being audited: write errors are logged as audit_write_failed. The write
+// outlives the caller's cancellation so late denials are still recorded.
+func (s *Service) Record(ctx context.Context, entry Entry) {
+	if s == nil || s.entries == nil || ctx == nil {
+		return
+	}
+
+	entry.CreatedAt = s.now().UTC().Truncate(time.Millisecond)
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+
+	if _, err := s.entries.Insert(writeCtx, entry); err != nil {
+		s.logger.WithFields(logging.Fields{
+			"event":    "audit_write_failed",
+			"action":   entry.Action,
+			"actor_id": entry.ActorID,
+			"target":   entry.Target,
+			"outcome":  entry.Outcome,
+		}).WithError(err).Error("failed to write audit entry")
+	}
+}
+
+// AuditCommand implements telegram.CommandAuditor.
+func (s *Service) AuditCommand(ctx context.Context, record telegram.CommandAudit) {
+	entry := Entry{
+		ActorID:   record.UserID,
+		ActorRole: record.Role,
+		ChatID:    record.ChatID,
+		Action:    ActionCommand,
+		Target:    strings.TrimSpace("/" + record.Command + " " + strings.Join(record.Args, " ")),
+		Outcome:   OutcomeAllowed,
+		Reason:    record.Reason,
+	}
+	if record.Callback {
+		entry.Action = ActionCallback
+		entry.Target = telegram.CallbackData(record.Command, record.Args...)
+	}
+	if !record.Allowed {
+		entry.Outcome = OutcomeDenied
+	}
+
+	s.Record(ctx, entry)
+}
+
+// Commands returns the audit commands for registration with the Telegram
+// client.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			// Private only: entries name users, chats, and command arguments.
+			Name:        "audit",
+			Description: "Show the audit trail",
+			MinRole:     domain.RoleOwner,
+			ChatTypes:   []string{telegram.ChatTypePrivate},
+			Handler:     telegram.ReplyHandler(s.logger, s.list),
+		},
+	}
+}
+
+func (s *Service) list(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.entries == nil {
+		return "", errors.New("audit service is not initialized")
+	}
+
+	size, page, ok := parsePage(req.Args)
+	if !ok {
+		return fmt.Sprintf("%s (n: 1-%d, page: 1 or more)", auditUsage, MaxPageSize), nil
+	}
+
+	total, err := s.entries.Count(ctx)
+	if err != nil {
+		return "", err
+	}
+	if total == 0 {
+		return "The audit trail is empty.", nil
+	}
+
+	pages := (total + size - 1) / size
+	if page > pages {
+		return fmt.Sprintf("Page %d is past the end; the audit trail has %d page(s) of %d.", page, pages, size), nil
+	}
+
+	entries, err := s.entries.List(ctx, (page-1)*size, size)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(entries)+2)
+	lines = append(lines, fmt.Sprintf("Audit trail, page %d/%d (%d entries):", page, pages, total))
+	for _, entry := range entries {
+		lines = append(lines, formatEntry(entry))
+	}
+	if page < pages {
+		lines = append(lines, fmt.Sprintf("Older: /audit %d %d", size, page+1))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// parsePage reads the optional page size and 1-based page number.
+func parsePage(args []string) (int64, int64, bool) {
+	size, page := int64(DefaultPageSize), int64(1)
+	if len(args) > 2 {
+		return 0, 0, false
+	}
+
+	if len(args) >= 1 {
+		n, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return 0, 0, false
+		}
+		size = n
+	}
+	if len(args) == 2 {
+		p, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || p < 1 {
+			return 0, 0, false
+		}
+		page = p
+	}
+
+	return size, page, true
+}
+
+func formatEntry(entry Entry) string {
+	actor := "system"
+	if entry.ActorID != SystemActor {
+		actor = strconv.FormatInt(entry.ActorID, 10)
+		if entry.ActorRole != "" {
+			actor += "(" + entry.ActorRole + ")"
+		}
+	}
+
+	line := fmt.Sprintf("%s %s %s", entry.CreatedAt.UTC().Format(time.RFC3339), actor, entry.Action)
+	if entry.Target != "" {
+		line += " " + entry.Target
+	}
+	if entry.Before != "" || entry.After != "" {
+		line += fmt.Sprintf(" [%s -> %s]", valueOrNone(entry.Before), valueOrNone(entry.After))
+	}
+	line += ": " + entry.Outcome
+	if entry.Reason != "" {
+		line += " (" + entry.Reason + ")"
+	}
+	if entry.ChatID != 0 && entry.ChatID != entry.ActorID {
+		line += fmt.Sprintf(" in chat %d", entry.ChatID)
+	}
+
+	return line
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+func TestRecordStampsAndSurvivesCancellation(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	store := &memoryEntries{}
+	service := NewService(store, logrus.NewEntry(hookLogger))
+	service.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service.Record(ctx, Entry{ActorID: 1, Action: ActionRoleChange, Outcome: OutcomeSuccess})
+
+	if len(store.entries) != 1 || !store.entries[0].CreatedAt.Equal(service.now()) {
+		t.Fatalf("expected a stamped entry despite the canceled context, got %+v", store.entries)
+	}
+
+	store.err = errors.New("mongo down")
+	service.Record(context.Background(), Entry{Action: ActionRoleChange, Outcome: OutcomeSuccess})
+	if findEvent(hook.AllEntries(), "audit_write_failed") == nil {
+		t.Fatalf("expected audit_write_failed log entry")
+	}
+}
+
+func TestAuditCommandMapsRouterRecords(t *testing.T) {
+	store := &memoryEntries{}
+	service := NewService(store, logrus.NewEntry(logrus.New()))
+
+	service.AuditCommand(context.Background(), telegram.CommandAudit{
+		Command: "settle", Args: []string{"shop", "100", "USD"}, UserID: 5, ChatID: 5, Role: domain.RoleAdmin, MinRole: domain.RoleAdmin, Allowed: true,
+	})
+	service.AuditCommand(context.Background(), telegram.CommandAudit{
+		Command: "status", UserID: 6, ChatID: -100, Role: domain.RoleUser, MinRole: domain.RoleOwner, Reason: "insufficient_role",
+	})
+	service.AuditCommand(context.Background(), telegram.CommandAudit{
+		Command: "broadcast", Args: []string{"confirm", "bc_1"}, UserID: 5, ChatID: 5, Role: domain.RoleOwner, MinRole: domain.RoleOwner, Allowed: true, Callback: true,
+	})
+
+	if len(store.entries) != 3 {
+		t.Fatalf("expected three entries, got %d", len(store.entries))
+	}
+	if button := store.entries[2]; button.Action != ActionCallback || button.Target != "broadcast:confirm:bc_1" || button.Outcome != OutcomeAllowed {
+		t.Fatalf("unexpected callback entry %+v", button)
+	}
+	allowed, denied := store.entries[0], store.entries[1]
+	if allowed.Action != ActionCommand || allowed.Target != "/settle shop 100 USD" || allowed.Outcome != OutcomeAllowed || allowed.ActorRole != domain.RoleAdmin {
+		t.Fatalf("unexpected allowed entry %+v", allowed)
+	}
+	if denied.Target != "/status" || denied.Outcome != OutcomeDenied || denied.Reason != "insufficient_role" || denied.ChatID != -100 {
+		t.Fatalf("unexpected denied entry %+v", denied)
+	}
+}
+
+func TestListCommandPaginates(t *testing.T) {
+	store := &memoryEntries{}
+	service := NewService(store, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	if reply, _ := service.list(ctx, telegram.CommandRequest{}); reply != "The audit trail is empty." {
+		t.Fatalf("unexpected empty reply %q", reply)
+	}
+
+	base := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		store.entries = append(store.entries, Entry{
+			ActorID:   1,
+			ActorRole: domain.RoleOwner,
+			ChatID:    1,
+			Action:    ActionRoleChange,
+			Target:    UserTarget(int64(100 + i)),
+			Before:    domain.RoleUser,
+			After:     domain.RoleAdmin,
+			Outcome:   OutcomeSuccess,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	reply, err := service.list(ctx, telegram.CommandRequest{})
+	if err != nil {
+		t.Fatalf("list returned error: %v", err)
+	}
+	lines := strings.Split(reply, "\n")
+	if lines[0] != "Audit trail, page 1/2 (12 entries):" || len(lines) != DefaultPageSize+2 {
+		t.Fatalf("unexpected first page %q", reply)
+	}
+	if lines[1] != "2026-01-02T00:11:00Z 1(owner) role_change user:111 [user -> admin]: success" {
+		t.Fatalf("expected newest entry first, got %q", lines[1])
+	}
+	if lines[len(lines)-1] != "Older: /audit 10 2" {
+		t.Fatalf("expected pointer to the next page, got %q", lines[len(lines)-1])
+	}
+
+	reply, _ = service.list(ctx, telegram.CommandRequest{Args: []string{"5", "3"}})
+	if !strings.HasPrefix(reply, "Audit trail, page 3/3") || strings.Contains(reply, "Older:") || strings.Count(reply, "\n") != 2 {
+		t.Fatalf("unexpected last page %q", reply)
+	}
+
+	for _, args := range [][]string{{"0"}, {"51"}, {"x"}, {"5", "0"}, {"1", "2", "3"}} {
+		if reply, _ := service.list(ctx, telegram.CommandRequest{Args: args}); !strings.HasPrefix(reply, auditUsage) {
+			t.Fatalf("expected usage for %v, got %q", args, reply)
+		}
+	}
+	if reply, _ := service.list(ctx, telegram.CommandRequest{Args: []string{"10", "9"}}); !strings.HasPrefix(reply, "Page 9 is past the end") {
+		t.Fatalf("unexpected reply past the end %q", reply)
+	}
+}
+
+func TestFormatEntry(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := map[string]Entry{
+		"2026-01-02T03:04:05Z system owner_bootstrap user:9 [none -> owner]: success": {
+			Action: ActionOwnerBootstrap, Target: "user:9", After: domain.RoleOwner, Outcome: OutcomeSuccess, CreatedAt: at,
+		},
+		"2026-01-02T03:04:05Z 6(user) command /status: denied (insufficient_role) in chat -100": {
+			ActorID: 6, ActorRole: domain.RoleUser, ChatID: -100, Action: ActionCommand, Target: "/status", Outcome: OutcomeDenied, Reason: "insufficient_role", CreatedAt: at,
+		},
+	}
+	for want, entry := range cases {
+		if got := formatEntry(entry); got != want {
+			t.Fatalf("formatEntry = %q, want %q", got, want)
+		}
+	}
+}
+
+// memoryEntries keeps entries in insertion order and lists them newest first.
+type memoryEntries struct {
+	entries []Entry
+	err     error
+}
+
+func (m *memoryEntries) Insert(ctx context.Context, entry Entry) (Entry, error) {
+	if m.err != nil {
+		return Entry{}, m.err
+	}
+	if ctx.Err() != nil {
+		return Entry{}, fmt.Errorf("insert: %w", ctx.Err())
+	}
+	m.entries = append(m.entries, entry)
+	return entry, nil
+}
+
+func (m *memoryEntries) List(_ context.Context, skip, limit int64) ([]Entry, error) {
+	page := make([]Entry, 0, limit)
+	for i := int64(len(m.entries)) - 1 - skip; i >= 0 && int64(len(page)) < limit; i-- {
+		page = append(page, m.entries[i])
+	}
+	return page, nil
+}
+
+func (m *memoryEntries) Count(context.Context) (int64, error) {
+	return int64(len(m.entries)), nil
+}
+
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
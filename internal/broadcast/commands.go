@@ -0,0 +1,292 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+// CallbackNamespace prefixes the data of the preview's inline buttons.
+const CallbackNamespace = "broadcast"
+
+const (
+	broadcastUsage = "Usage: /broadcast <users|groups> <text>, or reply /broadcast <users|groups> to a message to copy it"
+	statusUsage    = "Usage: /broadcast_status [broadcast_id]"
+
+	actionConfirm = "confirm"
+	actionCancel  = "cancel"
+
+	// maxTextLength is Telegram's limit for a text message.
+	maxTextLength = 4096
+)
+
+// Commands returns the broadcast commands for registration with the Telegram
+// client.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			Name:        "broadcast",
+			Description: "Broadcast a message to all users or groups",
+			MinRole:     domain.RoleOwner,
+			ChatTypes:   []string{telegram.ChatTypePrivate},
+			Handler:     telegram.ReplyHandler(s.logger, s.broadcast),
+		},
+		{
+			Name:        "broadcast_status",
+			Description: "Show broadcast progress",
+			MinRole:     domain.RoleOwner,
+			Handler:     telegram.ReplyHandler(s.logger, s.status),
+		},
+	}
+}
+
+// broadcast stores a draft, shows the owner a preview, and asks for
+// confirmation with inline buttons. Nothing is sent to the audience until the
+// confirm button is pressed.
+func (s *Service) broadcast(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.broadcasts == nil || s.recipients == nil || s.sender == nil {
+		return "", errors.New("broadcast service is not initialized")
+	}
+	if len(req.Args) == 0 || !domain.IsBroadcastAudience(strings.ToLower(req.Args[0])) {
+		return broadcastUsage, nil
+	}
+
+	draft := domain.Broadcast{
+		Audience:     strings.ToLower(req.Args[0]),
+		CreatedBy:    req.UserID,
+		ReportChatID: req.ChatID,
+	}
+	if req.Update != nil && req.Update.Message != nil {
+		msg := req.Update.Message
+		draft.Text = textAfterFields(msg.Text, 2)
+		if draft.Text == "" && msg.ReplyToMessage != nil {
+			draft.FromChatID = req.ChatID
+			draft.MessageID = msg.ReplyToMessage.ID
+		}
+	}
+	if draft.Text == "" && !draft.IsCopy() {
+		return broadcastUsage, nil
+	}
+	if utf8.RuneCountInString(draft.Text) > maxTextLength {
+		return fmt.Sprintf("Broadcast text is limited to %d characters.", maxTextLength), nil
+	}
+
+	count, err := s.recipients.Count(ctx, draft.Audience)
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return fmt.Sprintf("There are no %s to broadcast to.", draft.Audience), nil
+	}
+
+	id, err := domain.NewBroadcastID()
+	if err != nil {
+		return "", err
+	}
+	draft.BroadcastID = id
+
+	draft, err = s.broadcasts.Create(ctx, draft)
+	if err != nil {
+		return "", err
+	}
+
+	if draft.IsCopy() {
+		err = s.sender.CopyMessage(ctx, req.ChatID, draft.FromChatID, draft.MessageID)
+	} else {
+		err = s.sender.SendText(ctx, req.ChatID, draft.Text)
+	}
+	if err != nil {
+		return "", fmt.Errorf("send broadcast preview: %w", err)
+	}
+
+	prompt := fmt.Sprintf("Preview above. Send broadcast %s to %d %s?", draft.BroadcastID, count, draft.Audience)
+	if err := s.sender.SendText(ctx, req.ChatID, prompt,
+		telegram.InlineButton{Text: fmt.Sprintf("Send to %d %s", count, draft.Audience), Data: telegram.CallbackData(CallbackNamespace, actionConfirm, draft.BroadcastID)},
+		telegram.InlineButton{Text: "Cancel", Data: telegram.CallbackData(CallbackNamespace, actionCancel, draft.BroadcastID)},
+	); err != nil {
+		return "", fmt.Errorf("send broadcast confirmation: %w", err)
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":        "broadcast_drafted",
+		"broadcast_id": draft.BroadcastID,
+		"audience":     draft.Audience,
+		"copy":         draft.IsCopy(),
+		"recipients":   count,
+		"user_id":      req.UserID,
+	}).Info("broadcast drafted")
+
+	return "", nil
+}
+
+// Callbacks returns the preview button handlers for registration with the
+// Telegram client.
+func (s *Service) Callbacks() []telegram.Callback {
+	return []telegram.Callback{
+		{
+			Namespace: CallbackNamespace,
+			MinRole:   domain.RoleOwner,
+			TTL:       s.settings.DraftTTL,
+			Handler:   s.decide,
+		},
+	}
+}
+
+// decide handles the preview's confirm and cancel buttons. Only the owner
+// who drafted the broadcast may decide it, and only before the draft expires.
+func (s *Service) decide(ctx context.Context, req telegram.CallbackRequest) (string, error) {
+	if s == nil || s.broadcasts == nil || s.recipients == nil || s.sender == nil {
+		return "", errors.New("broadcast service is not initialized")
+	}
+	if len(req.Args) != 2 || (req.Args[0] != actionConfirm && req.Args[0] != actionCancel) {
+		return "Unknown broadcast action.", nil
+	}
+	action, broadcastID := req.Args[0], req.Args[1]
+
+	draft, err := s.broadcasts.GetByID(ctx, broadcastID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "Broadcast not found.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if draft.CreatedBy != req.UserID {
+		return "Only the owner who created this broadcast can confirm it.", nil
+	}
+	if draft.Status != domain.BroadcastStatusDraft {
+		return fmt.Sprintf("Broadcast is already %s.", draft.Status), nil
+	}
+
+	now := s.now()
+	if action == actionConfirm && now.Sub(draft.CreatedAt) > s.settings.DraftTTL {
+		action = actionCancel
+	}
+
+	var decided domain.Broadcast
+	var text, notice string
+	switch action {
+	case actionCancel:
+		decided, err = s.broadcasts.Cancel(ctx, broadcastID, req.UserID, now)
+		text = fmt.Sprintf("Broadcast %s cancelled.", broadcastID)
+		notice = "Broadcast cancelled."
+		if req.Args[0] == actionConfirm {
+			text = fmt.Sprintf("Broadcast %s expired. Run /broadcast again.", broadcastID)
+			notice = "Broadcast expired."
+		}
+	default:
+		var total int64
+		total, err = s.recipients.Count(ctx, draft.Audience)
+		if err != nil {
+			return "", err
+		}
+		decided, err = s.broadcasts.Start(ctx, broadcastID, req.UserID, total, now)
+		text = fmt.Sprintf("Broadcast %s is sending to %d %s. Check progress with /broadcast_status %s", broadcastID, total, draft.Audience, broadcastID)
+		notice = "Broadcast started."
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "Broadcast was already decided.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":        "broadcast_" + decided.Status,
+		"broadcast_id": decided.BroadcastID,
+		"audience":     decided.Audience,
+		"total":        decided.Total,
+		"user_id":      req.UserID,
+	}).Info("broadcast decided")
+
+	if decided.Status == domain.BroadcastStatusRunning {
+		s.signal()
+	}
+
+	if req.MessageID != 0 {
+		if err := s.sender.EditText(ctx, req.ChatID, req.MessageID, text); err != nil {
+			s.logger.WithFields(logging.Fields{
+				"event":        "broadcast_prompt_edit_failed",
+				"broadcast_id": broadcastID,
+			}).WithError(err).Warn("failed to update broadcast confirmation")
+		}
+	}
+
+	return notice, nil
+}
+
+func (s *Service) status(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.broadcasts == nil {
+		return "", errors.New("broadcast service is not initialized")
+	}
+
+	var (
+		broadcast domain.Broadcast
+		err       error
+	)
+	switch len(req.Args) {
+	case 0:
+		broadcast, err = s.broadcasts.Latest(ctx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "No broadcasts yet.", nil
+		}
+	case 1:
+		broadcast, err = s.broadcasts.GetByID(ctx, req.Args[0])
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Sprintf("Broadcast %s not found.", req.Args[0]), nil
+		}
+	default:
+		return statusUsage, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return formatStatus(broadcast), nil
+}
+
+func formatStatus(b domain.Broadcast) string {
+	kind := "text"
+	if b.IsCopy() {
+		kind = "copied message"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Broadcast %s (%s to %s): %s", b.BroadcastID, kind, b.Audience, b.Status),
+		formatCounts(b),
+	}
+	if b.StartedAt != nil {
+		lines = append(lines, "Started: "+b.StartedAt.UTC().Format("2006-01-02 15:04:05 UTC"))
+	}
+	if b.CompletedAt != nil {
+		lines = append(lines, "Finished: "+b.CompletedAt.UTC().Format("2006-01-02 15:04:05 UTC"))
+	}
+	if b.LastError != "" {
+		lines = append(lines, "Last error: "+b.LastError)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// textAfterFields returns text with its first n whitespace-separated fields
+// removed, keeping the line breaks of the remainder.
+func textAfterFields(text string, n int) string {
+	rest := strings.TrimSpace(text)
+	for i := 0; i < n; i++ {
+		idx := strings.IndexFunc(rest, unicode.IsSpace)
+		if idx < 0 {
+			return ""
+		}
+		rest = strings.TrimSpace(rest[idx:])
+	}
+
+	return rest
+}
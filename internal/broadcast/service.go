@@ -0,0 +1,375 @@
+// Package broadcast sends owner messages to every registered user or group,
+// throttled below Telegram's limits and resumable from Mongo-backed progress.
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const (
+	storeTimeout = 5 * time.Second
+	// maxSendAttempts bounds retries of one recipient after flood control
+	// (429) responses.
+	maxSendAttempts = 3
+)
+
+type broadcastStore interface {
+	Create(ctx context.Context, broadcast domain.Broadcast) (domain.Broadcast, error)
+	GetByID(ctx context.Context, broadcastID string) (domain.Broadcast, error)
+	Latest(ctx context.Context) (domain.Broadcast, error)
+	Start(ctx context.Context, broadcastID string, actorID, total int64, now time.Time) (domain.Broadcast, error)
+	Cancel(ctx context.Context, broadcastID string, actorID int64, now time.Time) (domain.Broadcast, error)
+	ClaimRunning(ctx context.Context, now time.Time, lease time.Duration) (domain.Broadcast, error)
+	RecordDelivery(ctx context.Context, broadcastID string, recipientID int64, outcome, errMsg string, now, lockedUntil time.Time) error
+	Complete(ctx context.Context, broadcastID string, now time.Time) (domain.Broadcast, error)
+}
+
+type recipientLister interface {
+	Count(ctx context.Context, audience string) (int64, error)
+	ListAfter(ctx context.Context, audience string, after int64, limit int) ([]int64, error)
+}
+
+type userMarker interface {
+	MarkInactive(ctx context.Context, userID int64, at time.Time) error
+}
+
+type sender interface {
+	SendText(ctx context.Context, chatID int64, text string, buttons ...telegram.InlineButton) error
+	CopyMessage(ctx context.Context, chatID, fromChatID int64, messageID int) error
+	EditText(ctx context.Context, chatID int64, messageID int, text string, buttons ...telegram.InlineButton) error
+}
+
+// Settings tunes delivery throughput and draft handling.
+type Settings struct {
+	// MessagesPerSecond caps sends across all recipients. Telegram allows
+	// about 30 per second globally; each recipient receives a single message,
+	// which keeps well inside the per-chat limits.
+	MessagesPerSecond int
+	// BatchSize is how many recipients are loaded per page.
+	BatchSize int
+	// PollInterval is how often the idle worker looks for running broadcasts.
+	PollInterval time.Duration
+	// Lease is how long a claimed broadcast stays reserved after the last
+	// recorded delivery.
+	Lease time.Duration
+	// DraftTTL is how long a preview can still be confirmed.
+	DraftTTL time.Duration
+}
+
+// DefaultSettings returns the production broadcast settings.
+func DefaultSettings() Settings {
+	return Settings{
+		MessagesPerSecond: 25,
+		BatchSize:         100,
+		PollInterval:      10 * time.Second,
+		Lease:             5 * time.Minute,
+		DraftTTL:          time.Hour,
+	}
+}
+
+// Option configures optional Service dependencies.
+type Option func(*Service)
+
+// WithSettings overrides the broadcast settings. Zero fields keep defaults.
+func WithSettings(settings Settings) Option {
+	return func(s *Service) {
+		defaults := s.settings
+		s.settings = settings
+		if s.settings.MessagesPerSecond <= 0 {
+			s.settings.MessagesPerSecond = defaults.MessagesPerSecond
+		}
+		if s.settings.BatchSize <= 0 {
+			s.settings.BatchSize = defaults.BatchSize
+		}
+		if s.settings.PollInterval <= 0 {
+			s.settings.PollInterval = defaults.PollInterval
+		}
+		if s.settings.Lease <= 0 {
+			s.settings.Lease = defaults.Lease
+		}
+		if s.settings.DraftTTL <= 0 {
+			s.settings.DraftTTL = defaults.DraftTTL
+		}
+	}
+}
+
+// WithClock injects the time source used for leases and draft expiry.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		if now != nil {
+			s.now = now
+		}
+	}
+}
+
+// Service implements the broadcast commands and the delivery worker.
+type Service struct {
+	broadcasts broadcastStore
+	recipients recipientLister
+	users      userMarker
+	sender     sender
+	logger     *logrus.Entry
+	settings   Settings
+	now        func() time.Time
+	wake       chan struct{}
+}
+
+// NewService constructs a Service. users may be nil, in which case blocked
+// users are counted but not marked inactive.
+func NewService(broadcasts broadcastStore, recipients recipientLister, users userMarker, sender sender, logger *logrus.Entry, opts ...Option) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	s := &Service{
+		broadcasts: broadcasts,
+		recipients: recipients,
+		users:      users,
+		sender:     sender,
+		logger:     logger,
+		settings:   DefaultSettings(),
+		now:        func() time.Time { return time.Now().UTC() },
+		wake:       make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+
+	return s
+}
+
+// Start delivers running broadcasts one at a time until the context is
+// canceled. A broadcast interrupted mid-way keeps its cursor and resumes from
+// the next recipient once its lease expires.
+func (s *Service) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":               "broadcast_worker_started",
+		"messages_per_second": s.settings.MessagesPerSecond,
+	}).Info("starting broadcast worker")
+
+	timer := time.NewTimer(s.settings.PollInterval)
+	defer timer.Stop()
+
+	for ctx.Err() == nil {
+		broadcast, err := s.broadcasts.ClaimRunning(ctx, s.now(), s.settings.Lease)
+		if err == nil {
+			s.run(ctx, broadcast)
+			continue
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+			s.logger.WithField("event", "broadcast_claim_failed").WithError(err).Error("failed to claim broadcast")
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(s.settings.PollInterval)
+
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+
+	s.logger.WithField("event", "broadcast_worker_stopped").Info("broadcast worker stopped")
+}
+
+func (s *Service) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run walks the audience after the broadcast's cursor, recording each
+// outcome before moving on.
+func (s *Service) run(ctx context.Context, b domain.Broadcast) {
+	fields := logging.Fields{
+		"broadcast_id": b.BroadcastID,
+		"audience":     b.Audience,
+		"processed":    b.Processed(),
+		"total":        b.Total,
+	}
+	fields["event"] = "broadcast_resumed"
+	if b.Processed() == 0 {
+		fields["event"] = "broadcast_started"
+	}
+	s.logger.WithFields(fields).Info("delivering broadcast")
+
+	throttle := time.NewTicker(time.Second / time.Duration(s.settings.MessagesPerSecond))
+	defer throttle.Stop()
+
+	cursor := b.Cursor
+	for {
+		ids, err := s.recipients.ListAfter(ctx, b.Audience, cursor, s.settings.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				fields["event"] = "broadcast_list_failed"
+				s.logger.WithFields(fields).WithError(err).Error("failed to list broadcast recipients")
+			}
+			return
+		}
+		if len(ids) == 0 {
+			s.complete(ctx, b)
+			return
+		}
+
+		for _, id := range ids {
+			select {
+			case <-ctx.Done():
+				return
+			case <-throttle.C:
+			}
+
+			outcome, sendErr := s.deliver(ctx, b, id)
+			if sendErr != nil && ctx.Err() != nil {
+				// Shutting down mid-send: leave the recipient for the resumed run.
+				return
+			}
+			if !s.record(ctx, b, id, outcome, sendErr) {
+				return
+			}
+			cursor = id
+		}
+	}
+}
+
+// deliver sends the broadcast to one recipient, waiting out flood control,
+// and classifies the result.
+func (s *Service) deliver(ctx context.Context, b domain.Broadcast, chatID int64) (string, error) {
+	var err error
+	for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+		if b.IsCopy() {
+			err = s.sender.CopyMessage(ctx, chatID, b.FromChatID, b.MessageID)
+		} else {
+			err = s.sender.SendText(ctx, chatID, b.Text)
+		}
+		if err == nil {
+			return domain.BroadcastOutcomeSent, nil
+		}
+
+		wait, limited := telegram.RetryAfter(err)
+		if !limited || attempt == maxSendAttempts {
+			break
+		}
+		s.logger.WithFields(logging.Fields{
+			"event":        "broadcast_rate_limited",
+			"broadcast_id": b.BroadcastID,
+			"chat_id":      chatID,
+			"retry_after":  wait.String(),
+		}).Warn("broadcast hit telegram flood control")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return domain.BroadcastOutcomeFailed, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if telegram.IsBlocked(err) {
+		return domain.BroadcastOutcomeBlocked, err
+	}
+
+	return domain.BroadcastOutcomeFailed, err
+}
+
+// record stores a recipient's outcome and reports whether delivery should
+// continue. Users who blocked the bot are marked inactive so later
+// broadcasts skip them.
+func (s *Service) record(ctx context.Context, b domain.Broadcast, chatID int64, outcome string, sendErr error) bool {
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
+	now := s.now()
+	fields := logging.Fields{
+		"broadcast_id": b.BroadcastID,
+		"chat_id":      chatID,
+		"outcome":      outcome,
+	}
+
+	errMsg := ""
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	}
+
+	if outcome == domain.BroadcastOutcomeBlocked && b.Audience == domain.BroadcastAudienceUsers && s.users != nil {
+		if err := s.users.MarkInactive(storeCtx, chatID, now); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			fields["event"] = "broadcast_mark_inactive_failed"
+			s.logger.WithFields(fields).WithError(err).Error("failed to mark blocked user inactive")
+		}
+	}
+	if outcome == domain.BroadcastOutcomeFailed {
+		fields["event"] = "broadcast_delivery_failed"
+		s.logger.WithFields(fields).WithError(sendErr).Warn("broadcast delivery failed")
+	}
+
+	if err := s.broadcasts.RecordDelivery(storeCtx, b.BroadcastID, chatID, outcome, errMsg, now, now.Add(s.settings.Lease)); err != nil {
+		fields["event"] = "broadcast_record_failed"
+		s.logger.WithFields(fields).WithError(err).Error("failed to record broadcast delivery")
+		return false
+	}
+
+	return true
+}
+
+func (s *Service) complete(ctx context.Context, b domain.Broadcast) {
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
+	completed, err := s.broadcasts.Complete(storeCtx, b.BroadcastID, s.now())
+	if err != nil {
+		s.logger.WithFields(logging.Fields{
+			"event":        "broadcast_complete_failed",
+			"broadcast_id": b.BroadcastID,
+		}).WithError(err).Error("failed to complete broadcast")
+		return
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":        "broadcast_completed",
+		"broadcast_id": completed.BroadcastID,
+		"audience":     completed.Audience,
+		"total":        completed.Total,
+		"sent":         completed.Sent,
+		"blocked":      completed.Blocked,
+		"failed":       completed.Failed,
+	}).Info("broadcast completed")
+
+	if completed.ReportChatID == 0 {
+		return
+	}
+	summary := fmt.Sprintf("Broadcast %s to %s completed.\n%s", completed.BroadcastID, completed.Audience, formatCounts(completed))
+	if err := s.sender.SendText(storeCtx, completed.ReportChatID, summary); err != nil {
+		s.logger.WithFields(logging.Fields{
+			"event":        "broadcast_report_failed",
+			"broadcast_id": completed.BroadcastID,
+			"chat_id":      completed.ReportChatID,
+		}).WithError(err).Warn("failed to send broadcast summary")
+	}
+}
+
+func formatCounts(b domain.Broadcast) string {
+	return fmt.Sprintf("Processed %d/%d: sent %d, blocked %d, failed %d.", b.Processed(), b.Total, b.Sent, b.Blocked, b.Failed)
+}
@@ -0,0 +1,504 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const ownerID int64 = 7
+
+func TestBroadcastCommandDraftsPreviewAndConfirms(t *testing.T) {
+	env := newTestEnv()
+	service := env.service()
+	ctx := context.Background()
+
+	commands := service.Commands()
+	if len(commands) != 2 || commands[0].Name != "broadcast" || commands[0].MinRole != domain.RoleOwner || commands[1].Name != "broadcast_status" {
+		t.Fatalf("expected owner broadcast commands, got %+v", commands)
+	}
+
+	reply, err := service.broadcast(ctx, commandRequest("/broadcast users Hello\nsecond line", nil))
+	if err != nil || reply != "" {
+		t.Fatalf("expected silent draft, got %q err=%v", reply, err)
+	}
+	draft := env.store.only(t)
+	if draft.Status != domain.BroadcastStatusDraft || draft.Text != "Hello\nsecond line" || draft.CreatedBy != ownerID || draft.ReportChatID != ownerID {
+		t.Fatalf("unexpected draft %+v", draft)
+	}
+
+	sent := env.sender.texts()
+	if len(sent) != 2 || sent[0].text != draft.Text || sent[0].chatID != ownerID {
+		t.Fatalf("expected preview then confirmation prompt, got %+v", sent)
+	}
+	buttons := sent[1].buttons
+	if len(buttons) != 2 || buttons[0].Data != "broadcast:confirm:"+draft.BroadcastID || buttons[1].Data != "broadcast:cancel:"+draft.BroadcastID {
+		t.Fatalf("unexpected confirmation buttons %+v", buttons)
+	}
+	if !strings.Contains(buttons[0].Text, "3 users") {
+		t.Fatalf("expected confirm button to show the audience size, got %q", buttons[0].Text)
+	}
+
+	notice, err := service.decide(ctx, callbackRequest(99, actionConfirm, draft.BroadcastID))
+	if err != nil || !strings.Contains(notice, "Only the owner") {
+		t.Fatalf("expected other users to be refused, got %q err=%v", notice, err)
+	}
+
+	notice, err = service.decide(ctx, callbackRequest(ownerID, actionConfirm, draft.BroadcastID))
+	if err != nil || notice != "Broadcast started." {
+		t.Fatalf("expected broadcast to start, got %q err=%v", notice, err)
+	}
+	started := env.store.get(draft.BroadcastID)
+	if started.Status != domain.BroadcastStatusRunning || started.Total != 3 || started.ConfirmedBy != ownerID {
+		t.Fatalf("unexpected started broadcast %+v", started)
+	}
+	if edits := env.sender.edits(); len(edits) != 1 || !strings.Contains(edits[0].text, "is sending to 3 users") {
+		t.Fatalf("expected confirmation prompt to be updated, got %+v", edits)
+	}
+
+	if notice, _ := service.decide(ctx, callbackRequest(ownerID, actionConfirm, draft.BroadcastID)); notice != "Broadcast is already running." {
+		t.Fatalf("expected a second confirm to be ignored, got %q", notice)
+	}
+}
+
+func TestBroadcastCommandCopiesRepliedMessage(t *testing.T) {
+	env := newTestEnv()
+	service := env.service()
+
+	reply, err := service.broadcast(context.Background(), commandRequest("/broadcast groups", &models.Message{ID: 55}))
+	if err != nil || reply != "" {
+		t.Fatalf("expected silent draft, got %q err=%v", reply, err)
+	}
+	draft := env.store.only(t)
+	if !draft.IsCopy() || draft.FromChatID != ownerID || draft.MessageID != 55 || draft.Audience != domain.BroadcastAudienceGroups {
+		t.Fatalf("expected copy draft of the replied message, got %+v", draft)
+	}
+	if copies := env.sender.copies(); len(copies) != 1 || copies[0].chatID != ownerID || copies[0].messageID != 55 {
+		t.Fatalf("expected the preview to be copied to the owner, got %+v", copies)
+	}
+
+	for _, text := range []string{"/broadcast", "/broadcast admins hi", "/broadcast users"} {
+		if reply, _ := service.broadcast(context.Background(), commandRequest(text, nil)); reply != broadcastUsage {
+			t.Fatalf("expected usage for %q, got %q", text, reply)
+		}
+	}
+}
+
+func TestBroadcastCallbackExpiresStaleDraft(t *testing.T) {
+	env := newTestEnv()
+	service := env.service()
+	ctx := context.Background()
+
+	if _, err := service.broadcast(ctx, commandRequest("/broadcast users hi", nil)); err != nil {
+		t.Fatalf("broadcast returned error: %v", err)
+	}
+	draft := env.store.only(t)
+
+	env.now = env.now.Add(2 * time.Hour)
+	notice, err := service.decide(ctx, callbackRequest(ownerID, actionConfirm, draft.BroadcastID))
+	if err != nil || notice != "Broadcast expired." {
+		t.Fatalf("expected stale draft to expire, got %q err=%v", notice, err)
+	}
+	if got := env.store.get(draft.BroadcastID); got.Status != domain.BroadcastStatusCancelled {
+		t.Fatalf("expected expired draft to be cancelled, got %+v", got)
+	}
+}
+
+func TestWorkerDeliversThrottledAndMarksBlockedUsers(t *testing.T) {
+	env := newTestEnv()
+	env.sender.fail(2, fmt.Errorf("%w, %s", bot.ErrorForbidden, "Forbidden: bot was blocked by the user"))
+	env.sender.fail(3, &bot.TooManyRequestsError{Message: "Too Many Requests", RetryAfter: 0})
+	service := env.service()
+
+	broadcast := env.store.running(domain.Broadcast{BroadcastID: "bc_1", Audience: domain.BroadcastAudienceUsers, Text: "hi", Total: 3, ReportChatID: ownerID})
+
+	service.run(context.Background(), broadcast)
+
+	got := env.store.get("bc_1")
+	if got.Status != domain.BroadcastStatusCompleted || got.Sent != 2 || got.Blocked != 1 || got.Failed != 0 || got.Cursor != 3 {
+		t.Fatalf("unexpected broadcast after delivery %+v", got)
+	}
+	if env.users.inactive[2] != env.now || len(env.users.inactive) != 1 {
+		t.Fatalf("expected only the blocked user to be marked inactive, got %v", env.users.inactive)
+	}
+
+	sent := env.sender.texts()
+	var recipients []int64
+	for _, msg := range sent[:len(sent)-1] {
+		recipients = append(recipients, msg.chatID)
+	}
+	if fmt.Sprint(recipients) != "[1 2 3 3]" {
+		t.Fatalf("expected one retry after flood control, got sends to %v", recipients)
+	}
+	if report := sent[len(sent)-1]; report.chatID != ownerID || !strings.Contains(report.text, "sent 2, blocked 1, failed 0") {
+		t.Fatalf("expected completion summary to the owner, got %+v", report)
+	}
+}
+
+func TestWorkerResumesFromCursor(t *testing.T) {
+	env := newTestEnv()
+	service := env.service()
+
+	broadcast := env.store.running(domain.Broadcast{BroadcastID: "bc_1", Audience: domain.BroadcastAudienceUsers, Text: "hi", Total: 3, Cursor: 2, Sent: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.Start(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for env.store.get(broadcast.BroadcastID).Status != domain.BroadcastStatusCompleted {
+		if time.Now().After(deadline) {
+			t.Fatalf("broadcast was not resumed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if sent := env.sender.texts(); len(sent) != 1 || sent[0].chatID != 3 {
+		t.Fatalf("expected only the remaining recipient to be sent, got %+v", sent)
+	}
+	if got := env.store.get(broadcast.BroadcastID); got.Sent != 3 {
+		t.Fatalf("expected resumed counters, got %+v", got)
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	env := newTestEnv()
+	service := env.service()
+	ctx := context.Background()
+
+	if reply, _ := service.status(ctx, telegram.CommandRequest{}); reply != "No broadcasts yet." {
+		t.Fatalf("unexpected reply without broadcasts: %q", reply)
+	}
+
+	env.store.running(domain.Broadcast{BroadcastID: "bc_1", Audience: domain.BroadcastAudienceGroups, FromChatID: 7, MessageID: 3, Total: 10, Sent: 4, Failed: 1, LastError: "chat not found"})
+
+	reply, err := service.status(ctx, telegram.CommandRequest{})
+	if err != nil {
+		t.Fatalf("status returned error: %v", err)
+	}
+	for _, want := range []string{"bc_1 (copied message to groups): running", "Processed 5/10: sent 4, blocked 0, failed 1.", "Last error: chat not found"} {
+		if !strings.Contains(reply, want) {
+			t.Fatalf("expected %q in status reply %q", want, reply)
+		}
+	}
+	if reply, _ := service.status(ctx, telegram.CommandRequest{Args: []string{"bc_missing"}}); reply != "Broadcast bc_missing not found." {
+		t.Fatalf("unexpected reply for unknown broadcast: %q", reply)
+	}
+}
+
+func commandRequest(text string, replyTo *models.Message) telegram.CommandRequest {
+	fields := strings.Fields(text)
+	return telegram.CommandRequest{
+		UserID:   ownerID,
+		ChatID:   ownerID,
+		ChatType: telegram.ChatTypePrivate,
+		Command:  strings.TrimPrefix(fields[0], "/"),
+		Args:     fields[1:],
+		Role:     domain.RoleOwner,
+		Update:   &models.Update{Message: &models.Message{Text: text, ReplyToMessage: replyTo}},
+	}
+}
+
+func callbackRequest(userID int64, action, broadcastID string) telegram.CallbackRequest {
+	return telegram.CallbackRequest{
+		UserID:    userID,
+		ChatID:    userID,
+		MessageID: 10,
+		Data:      telegram.CallbackData(CallbackNamespace, action, broadcastID),
+		Args:      []string{action, broadcastID},
+	}
+}
+
+type testEnv struct {
+	store      *fakeBroadcasts
+	recipients fakeRecipients
+	users      *fakeUsers
+	sender     *fakeSender
+	now        time.Time
+}
+
+func newTestEnv() *testEnv {
+	return &testEnv{
+		store:      &fakeBroadcasts{docs: make(map[string]*domain.Broadcast)},
+		recipients: fakeRecipients{domain.BroadcastAudienceUsers: {3, 1, 2}, domain.BroadcastAudienceGroups: {-100}},
+		users:      &fakeUsers{inactive: make(map[int64]time.Time)},
+		sender:     &fakeSender{errs: make(map[int64][]error)},
+		now:        time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+	}
+}
+
+func (e *testEnv) service() *Service {
+	e.store.now = func() time.Time { return e.now }
+	return NewService(e.store, e.recipients, e.users, e.sender, logrus.NewEntry(logrus.New()),
+		WithSettings(Settings{MessagesPerSecond: 1000, PollInterval: 10 * time.Millisecond}),
+		WithClock(func() time.Time { return e.now }),
+	)
+}
+
+type fakeBroadcasts struct {
+	mu   sync.Mutex
+	docs map[string]*domain.Broadcast
+	now  func() time.Time
+}
+
+func (f *fakeBroadcasts) Create(_ context.Context, broadcast domain.Broadcast) (domain.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	broadcast.Status = domain.BroadcastStatusDraft
+	broadcast.Cursor = domain.BroadcastCursorStart
+	broadcast.CreatedAt = f.now()
+	f.docs[broadcast.BroadcastID] = &broadcast
+	return broadcast, nil
+}
+
+func (f *fakeBroadcasts) GetByID(_ context.Context, broadcastID string) (domain.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if b, ok := f.docs[broadcastID]; ok {
+		return *b, nil
+	}
+	return domain.Broadcast{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeBroadcasts) Latest(_ context.Context) (domain.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, b := range f.docs {
+		if b.Status != domain.BroadcastStatusDraft {
+			return *b, nil
+		}
+	}
+	return domain.Broadcast{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeBroadcasts) Start(_ context.Context, broadcastID string, actorID, total int64, _ time.Time) (domain.Broadcast, error) {
+	return f.decide(broadcastID, func(b *domain.Broadcast) {
+		b.Status = domain.BroadcastStatusRunning
+		b.Total = total
+		b.ConfirmedBy = actorID
+	})
+}
+
+func (f *fakeBroadcasts) Cancel(_ context.Context, broadcastID string, actorID int64, _ time.Time) (domain.Broadcast, error) {
+	return f.decide(broadcastID, func(b *domain.Broadcast) {
+		b.Status = domain.BroadcastStatusCancelled
+		b.ConfirmedBy = actorID
+	})
+}
+
+func (f *fakeBroadcasts) decide(broadcastID string, fn func(*domain.Broadcast)) (domain.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, ok := f.docs[broadcastID]
+	if !ok || b.Status != domain.BroadcastStatusDraft {
+		return domain.Broadcast{}, mongo.ErrNoDocuments
+	}
+	fn(b)
+	return *b, nil
+}
+
+func (f *fakeBroadcasts) ClaimRunning(_ context.Context, now time.Time, lease time.Duration) (domain.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, b := range f.docs {
+		if b.Status == domain.BroadcastStatusRunning && !b.LockedUntil.After(now) {
+			b.LockedUntil = now.Add(lease)
+			return *b, nil
+		}
+	}
+	return domain.Broadcast{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeBroadcasts) RecordDelivery(_ context.Context, broadcastID string, recipientID int64, outcome, errMsg string, _, lockedUntil time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b := f.docs[broadcastID]
+	b.Cursor = recipientID
+	b.LockedUntil = lockedUntil
+	if errMsg != "" {
+		b.LastError = errMsg
+	}
+	switch outcome {
+	case domain.BroadcastOutcomeSent:
+		b.Sent++
+	case domain.BroadcastOutcomeBlocked:
+		b.Blocked++
+	case domain.BroadcastOutcomeFailed:
+		b.Failed++
+	}
+	return nil
+}
+
+func (f *fakeBroadcasts) Complete(_ context.Context, broadcastID string, _ time.Time) (domain.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b := f.docs[broadcastID]
+	b.Status = domain.BroadcastStatusCompleted
+	b.LockedUntil = time.Time{}
+	return *b, nil
+}
+
+func (f *fakeBroadcasts) running(b domain.Broadcast) domain.Broadcast {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b.Status = domain.BroadcastStatusRunning
+	if b.Cursor == 0 {
+		b.Cursor = domain.BroadcastCursorStart
+	}
+	f.docs[b.BroadcastID] = &b
+	return b
+}
+
+func (f *fakeBroadcasts) get(id string) domain.Broadcast {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if b, ok := f.docs[id]; ok {
+		return *b
+	}
+	return domain.Broadcast{}
+}
+
+func (f *fakeBroadcasts) only(t *testing.T) domain.Broadcast {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.docs) != 1 {
+		t.Fatalf("expected one broadcast, got %d", len(f.docs))
+	}
+	for _, b := range f.docs {
+		return *b
+	}
+	return domain.Broadcast{}
+}
+
+type fakeRecipients map[string][]int64
+
+func (f fakeRecipients) Count(_ context.Context, audience string) (int64, error) {
+	return int64(len(f[audience])), nil
+}
+
+func (f fakeRecipients) ListAfter(_ context.Context, audience string, after int64, limit int) ([]int64, error) {
+	ids := append([]int64(nil), f[audience]...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var page []int64
+	for _, id := range ids {
+		if id > after && len(page) < limit {
+			page = append(page, id)
+		}
+	}
+	return page, nil
+}
+
+type fakeUsers struct {
+	inactive map[int64]time.Time
+}
+
+func (f *fakeUsers) MarkInactive(_ context.Context, userID int64, at time.Time) error {
+	f.inactive[userID] = at
+	return nil
+}
+
+type sentMessage struct {
+	chatID    int64
+	messageID int
+	text      string
+	buttons   []telegram.InlineButton
+}
+
+type fakeSender struct {
+	mu     sync.Mutex
+	sent   []sentMessage
+	copied []sentMessage
+	edited []sentMessage
+	errs   map[int64][]error
+}
+
+// fail queues err to be returned by the next send to chatID.
+func (f *fakeSender) fail(chatID int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errs[chatID] = append(f.errs[chatID], err)
+}
+
+func (f *fakeSender) nextErr(chatID int64) error {
+	queued := f.errs[chatID]
+	if len(queued) == 0 {
+		return nil
+	}
+	f.errs[chatID] = queued[1:]
+	return queued[0]
+}
+
+func (f *fakeSender) SendText(_ context.Context, chatID int64, text string, buttons ...telegram.InlineButton) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, sentMessage{chatID: chatID, text: text, buttons: buttons})
+	return f.nextErr(chatID)
+}
+
+func (f *fakeSender) CopyMessage(_ context.Context, chatID, _ int64, messageID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.copied = append(f.copied, sentMessage{chatID: chatID, messageID: messageID})
+	return f.nextErr(chatID)
+}
+
+func (f *fakeSender) EditText(_ context.Context, chatID int64, messageID int, text string, _ ...telegram.InlineButton) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.edited = append(f.edited, sentMessage{chatID: chatID, messageID: messageID, text: text})
+	return nil
+}
+
+func (f *fakeSender) texts() []sentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]sentMessage(nil), f.sent...)
+}
+
+func (f *fakeSender) copies() []sentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]sentMessage(nil), f.copied...)
+}
+
+func (f *fakeSender) edits() []sentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]sentMessage(nil), f.edited...)
+}
@@ -0,0 +1,275 @@
+// Package callback serves the HTTP endpoint that receives payment-channel
+// notifications, verifies their signatures, and drives the order state machine.
+package callback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/payment"
+)
+
+const (
+	// PathPrefix is the URL prefix for callbacks; the channel code follows it.
+	PathPrefix = payment.CallbackPath
+
+	// AckBody is returned to the channel once a notification is accepted,
+	// including replays of an already-applied notification.
+	AckBody = "success"
+
+	readHeaderTimeout = 5 * time.Second
+	shutdownTimeout   = 5 * time.Second
+	applyTimeout      = 5 * time.Second
+	maxBodyBytes      = 64 << 10
+)
+
+type orderStore interface {
+	GetByID(ctx context.Context, orderID string) (domain.Order, error)
+	Transition(ctx context.Context, t domain.OrderTransition) (domain.Order, error)
+}
+
+// channelLookup resolves channel codes to adapters that verify and parse
+// their own callbacks.
+type channelLookup interface {
+	Get(code string) (payment.Entry, bool)
+}
+
+// Server accepts signed payment-channel callbacks over HTTP.
+type Server struct {
+	orders     orderStore
+	channels   channelLookup
+	secrets    map[string]string
+	listenAddr string
+	logger     *logrus.Entry
+}
+
+// NewServer constructs a Server using the callback listener address and
+// per-channel secrets from cfg. Channels found in channels verify and parse
+// their own callbacks; the rest fall back to the shared form protocol signed
+// with the channel's secret. channels may be nil.
+func NewServer(cfg config.Config, orders orderStore, channels channelLookup, logger *logrus.Entry) *Server {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Server{
+		orders:     orders,
+		channels:   channels,
+		secrets:    cfg.CallbackSecrets,
+		listenAddr: cfg.CallbackListenAddr,
+		logger:     logger,
+	}
+}
+
+// Handler returns the HTTP handler serving POST /callbacks/{channel}.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+PathPrefix+"{channel}", s.handleCallback)
+
+	return mux
+}
+
+// Start serves callbacks until the context is canceled, then shuts the
+// listener down gracefully.
+func (s *Server) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	server := &http.Server{
+		Addr:              s.listenAddr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "callback_listen",
+		"listen_addr": s.listenAddr,
+		"channels":    len(s.secrets),
+	}).Info("starting payment callback listener")
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithFields(logging.Fields{
+				"event":       "callback_server_error",
+				"listen_addr": s.listenAddr,
+			}).WithError(err).Error("payment callback listener failed")
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.logger.WithField("event", "callback_shutdown_error").WithError(err).Error("failed to stop payment callback listener")
+	}
+	cancel()
+
+	s.logger.WithField("event", "callback_stopped").Info("payment callback listener stopped")
+}
+
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	channel := domain.NormalizeChannelCode(r.PathValue("channel"))
+	fields := logging.Fields{
+		"channel":     channel,
+		"remote_addr": r.RemoteAddr,
+	}
+
+	var (
+		entry   payment.Entry
+		adapted bool
+	)
+	if s.channels != nil {
+		entry, adapted = s.channels.Get(channel)
+	}
+	secret, shared := s.secrets[channel]
+	if !adapted && !shared {
+		fields["event"] = "callback_unknown_channel"
+		s.logger.WithFields(fields).Warn("rejected callback for unknown channel")
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		fields["event"] = "callback_bad_request"
+		s.logger.WithFields(fields).WithError(err).Warn("failed to read callback body")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var notification payment.Notification
+	if adapted {
+		fields["adapter"] = entry.Adapter
+		req := payment.CallbackRequest{Header: r.Header, Body: body}
+		if err := entry.Channel.VerifyCallback(req); err != nil {
+			fields["event"] = "callback_bad_signature"
+			s.logger.WithFields(fields).WithError(err).Warn("rejected callback with invalid signature")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		notification, err = entry.Channel.ParseCallback(req)
+	} else {
+		form, parseErr := url.ParseQuery(string(body))
+		if parseErr != nil {
+			fields["event"] = "callback_bad_request"
+			s.logger.WithFields(fields).WithError(parseErr).Warn("failed to parse callback body")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if !payment.Verify(secret, form) {
+			fields["event"] = "callback_bad_signature"
+			s.logger.WithFields(fields).Warn("rejected callback with invalid signature")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		notification, err = payment.ParseNotification(form)
+	}
+	if err != nil {
+		fields["event"] = "callback_bad_request"
+		s.logger.WithFields(fields).WithError(err).Warn("rejected malformed callback")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	notification.Channel = channel
+	fields["order_id"] = notification.OrderID
+	fields["status"] = notification.Status
+
+	ctx, cancel := context.WithTimeout(r.Context(), applyTimeout)
+	defer cancel()
+
+	applied, status, err := s.apply(ctx, notification)
+	if err != nil {
+		fields["event"] = "callback_rejected"
+		entry := s.logger.WithFields(fields).WithError(err)
+		if status >= http.StatusInternalServerError {
+			entry.Error("failed to apply payment callback")
+		} else {
+			entry.Warn("rejected payment callback")
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	fields["event"] = "callback_applied"
+	if !applied {
+		fields["event"] = "callback_duplicate"
+	}
+	s.logger.WithFields(fields).Info("accepted payment callback")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(AckBody))
+}
+
+// apply drives the order to the notified status. It reports whether any
+// transition was applied; replays of a status the order already reached,
+// even one it has since moved past, return false without error. The returned
+// HTTP status is meaningful only with an error.
+func (s *Server) apply(ctx context.Context, n payment.Notification) (bool, int, error) {
+	order, err := s.orders.GetByID(ctx, n.OrderID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, http.StatusNotFound, fmt.Errorf("order %s not found", n.OrderID)
+		}
+		return false, http.StatusInternalServerError, err
+	}
+
+	if order.Channel != n.Channel {
+		return false, http.StatusBadRequest, fmt.Errorf("order %s belongs to channel %q", n.OrderID, order.Channel)
+	}
+	if order.AmountMinor != n.AmountMinor {
+		return false, http.StatusBadRequest, fmt.Errorf("order %s amount mismatch: expected %d, got %d", n.OrderID, order.AmountMinor, n.AmountMinor)
+	}
+	if n.Currency != "" && n.Currency != order.Currency {
+		return false, http.StatusBadRequest, fmt.Errorf("order %s currency mismatch: expected %s, got %s", n.OrderID, order.Currency, n.Currency)
+	}
+
+	applied := false
+	for !order.HasReached(n.Status) {
+		next := n.Status
+		if order.Status == domain.OrderStatusCreated && n.Status == domain.OrderStatusPaid {
+			next = domain.OrderStatusPending
+		}
+
+		updated, err := s.orders.Transition(ctx, domain.OrderTransition{
+			OrderID:    n.OrderID,
+			From:       order.Status,
+			To:         next,
+			ChannelRef: n.ChannelRef,
+			Reason:     "channel_callback",
+		})
+
+		var conflict *domain.StatusConflictError
+		switch {
+		case err == nil:
+			applied = true
+			order = updated
+		case errors.As(err, &conflict):
+			// Another delivery moved the order first; continue from there.
+			order = updated
+			order.Status = conflict.Actual
+		case errors.Is(err, domain.ErrInvalidOrderTransition):
+			return false, http.StatusConflict, err
+		default:
+			return false, http.StatusInternalServerError, err
+		}
+	}
+
+	return applied, http.StatusOK, nil
+}
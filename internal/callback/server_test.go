@@ -0,0 +1,296 @@
+package callback
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/payment"
+	"tg_pay_gateway_bot/internal/payment/mock"
+)
+
+const testSecret = "mock-secret"
+
+func TestCallbackMarksOrderPaidOnce(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	orders := newFakeOrders(domain.Order{OrderID: "ord_1", Channel: "mock", AmountMinor: 500, Status: domain.OrderStatusCreated})
+	channel := newChannelStub(t, orders, logrus.NewEntry(hookLogger))
+
+	resp, body := channel.notify("mock", "ord_1", "paid", "500", testSecret)
+	if resp.StatusCode != http.StatusOK || body != AckBody {
+		t.Fatalf("expected ack, got %d %q", resp.StatusCode, body)
+	}
+	if order := orders.get("ord_1"); order.Status != domain.OrderStatusPaid || order.ChannelRef != "up-ord_1" {
+		t.Fatalf("expected order to be paid with channel ref, got %+v", order)
+	}
+	if got := orders.transitions(); len(got) != 2 || got[0] != "created->pending" || got[1] != "pending->paid" {
+		t.Fatalf("expected created->pending->paid, got %v", got)
+	}
+
+	resp, body = channel.notify("mock", "ord_1", "paid", "500", testSecret)
+	if resp.StatusCode != http.StatusOK || body != AckBody {
+		t.Fatalf("expected replay to be acknowledged, got %d %q", resp.StatusCode, body)
+	}
+	if got := orders.transitions(); len(got) != 2 {
+		t.Fatalf("expected replay not to transition again, got %v", got)
+	}
+	if findEvent(hook.AllEntries(), "callback_duplicate") == nil {
+		t.Fatalf("expected callback_duplicate log entry")
+	}
+}
+
+func TestCallbackConcurrentDeliveriesApplyOnce(t *testing.T) {
+	orders := newFakeOrders(domain.Order{OrderID: "ord_1", Channel: "mock", AmountMinor: 500, Status: domain.OrderStatusPending})
+	channel := newChannelStub(t, orders, logrus.NewEntry(logrus.New()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, body := channel.notify("mock", "ord_1", "paid", "500", testSecret)
+			if resp.StatusCode != http.StatusOK || body != AckBody {
+				t.Errorf("expected ack, got %d %q", resp.StatusCode, body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := orders.transitions(); len(got) != 1 || got[0] != "pending->paid" {
+		t.Fatalf("expected a single pending->paid transition, got %v", got)
+	}
+}
+
+func TestCallbackAcksStatusesTheOrderMovedPast(t *testing.T) {
+	paidAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	orders := newFakeOrders(domain.Order{OrderID: "ord_1", Channel: "mock", AmountMinor: 500, Currency: "USD", Status: domain.OrderStatusRefunded, PaidAt: &paidAt})
+	channel := newChannelStub(t, orders, logrus.NewEntry(logrus.New()))
+
+	resp, body := channel.notify("mock", "ord_1", "paid", "500", testSecret)
+	if resp.StatusCode != http.StatusOK || body != AckBody {
+		t.Fatalf("expected a late paid replay on a refunded order to be acknowledged, got %d %q", resp.StatusCode, body)
+	}
+
+	if resp, _ := channel.notify("mock", "ord_1", "failed", "500", testSecret); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a status the order never reached to conflict, got %d", resp.StatusCode)
+	}
+	if got := orders.transitions(); len(got) != 0 {
+		t.Fatalf("expected no transitions, got %v", got)
+	}
+}
+
+func TestCallbackRejectsInvalidRequests(t *testing.T) {
+	orders := newFakeOrders(
+		domain.Order{OrderID: "ord_1", Channel: "mock", AmountMinor: 500, Currency: "USD", Status: domain.OrderStatusPending},
+		domain.Order{OrderID: "ord_2", Channel: "other", AmountMinor: 500, Status: domain.OrderStatusPending},
+		domain.Order{OrderID: "ord_3", Channel: "mock", AmountMinor: 500, Status: domain.OrderStatusFailed},
+	)
+	channel := newChannelStub(t, orders, logrus.NewEntry(logrus.New()))
+
+	tests := []struct {
+		name    string
+		channel string
+		orderID string
+		status  string
+		amount  string
+		secret  string
+		want    int
+	}{
+		{name: "unknown channel", channel: "nope", orderID: "ord_1", status: "paid", amount: "500", secret: testSecret, want: http.StatusNotFound},
+		{name: "bad signature", channel: "mock", orderID: "ord_1", status: "paid", amount: "500", secret: "wrong", want: http.StatusUnauthorized},
+		{name: "bad status", channel: "mock", orderID: "ord_1", status: "refunded", amount: "500", secret: testSecret, want: http.StatusBadRequest},
+		{name: "bad amount", channel: "mock", orderID: "ord_1", status: "paid", amount: "abc", secret: testSecret, want: http.StatusBadRequest},
+		{name: "amount mismatch", channel: "mock", orderID: "ord_1", status: "paid", amount: "499", secret: testSecret, want: http.StatusBadRequest},
+		{name: "unknown order", channel: "mock", orderID: "ord_9", status: "paid", amount: "500", secret: testSecret, want: http.StatusNotFound},
+		{name: "channel mismatch", channel: "mock", orderID: "ord_2", status: "paid", amount: "500", secret: testSecret, want: http.StatusBadRequest},
+		{name: "illegal transition", channel: "mock", orderID: "ord_3", status: "paid", amount: "500", secret: testSecret, want: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		resp, _ := channel.notify(tt.channel, tt.orderID, tt.status, tt.amount, tt.secret)
+		if resp.StatusCode != tt.want {
+			t.Fatalf("%s: expected status %d, got %d", tt.name, tt.want, resp.StatusCode)
+		}
+	}
+
+	params := url.Values{"order_id": {"ord_1"}, "status": {"paid"}, "amount": {"500"}, "currency": {"eur"}}
+	if resp, _ := channel.post("mock", params, testSecret); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("currency mismatch: expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	if got := orders.transitions(); len(got) != 0 {
+		t.Fatalf("expected no transitions for rejected callbacks, got %v", got)
+	}
+
+	resp, err := http.Get(channel.server.URL + PathPrefix + "mock")
+	if err != nil {
+		t.Fatalf("GET returned error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", resp.StatusCode)
+	}
+}
+
+func TestCallbackFromAdapterChannel(t *testing.T) {
+	orders := newFakeOrders(domain.Order{OrderID: "ord_1", Channel: "gw", Adapter: mock.AdapterName, AmountMinor: 500, Currency: "USD", Status: domain.OrderStatusPending})
+
+	stub := httptest.NewServer(mock.NewStub(map[string]string{"m-1": "gw-secret"}, logrus.NewEntry(logrus.New())).Handler())
+	t.Cleanup(stub.Close)
+	registry, err := payment.NewRegistry(
+		[]config.PaymentChannel{{Code: "gw", Adapter: mock.AdapterName, MerchantID: "m-1", Secret: "gw-secret", BaseURL: stub.URL}},
+		map[string]payment.Factory{mock.AdapterName: mock.New},
+	)
+	if err != nil {
+		t.Fatalf("NewRegistry returned error: %v", err)
+	}
+
+	server := httptest.NewServer(NewServer(config.Config{}, orders, registry, logrus.NewEntry(logrus.New())).Handler())
+	t.Cleanup(server.Close)
+	channel := &channelStub{t: t, server: server}
+
+	resp, _ := channel.notify("gw", "ord_1", "paid", "500", testSecret)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected callback signed with another secret to be rejected, got %d", resp.StatusCode)
+	}
+
+	entry, _ := registry.Get("gw")
+	created, err := entry.Channel.CreatePayment(context.Background(), payment.PaymentRequest{OrderID: "ord_1", AmountMinor: 500, Currency: "USD", NotifyURL: server.URL + PathPrefix + "gw"})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	pay, err := http.Get(created.PayURL)
+	if err != nil {
+		t.Fatalf("open pay url: %v", err)
+	}
+	pay.Body.Close()
+	if pay.StatusCode != http.StatusOK {
+		t.Fatalf("expected the stub's callback to be acknowledged, got %d", pay.StatusCode)
+	}
+	if order := orders.get("ord_1"); order.Status != domain.OrderStatusPaid || order.ChannelRef != created.ChannelRef {
+		t.Fatalf("expected order to be paid through the adapter callback, got %+v", order)
+	}
+}
+
+// channelStub plays the upstream payment channel, posting signed
+// notifications to the callback server.
+type channelStub struct {
+	t      *testing.T
+	server *httptest.Server
+}
+
+func newChannelStub(t *testing.T, orders *fakeOrders, logger *logrus.Entry) *channelStub {
+	t.Helper()
+
+	srv := NewServer(config.Config{CallbackSecrets: map[string]string{"mock": testSecret, "other": "other-secret"}}, orders, nil, logger)
+	server := httptest.NewServer(srv.Handler())
+	t.Cleanup(server.Close)
+
+	return &channelStub{t: t, server: server}
+}
+
+func (c *channelStub) notify(channel, orderID, status, amount, secret string) (*http.Response, string) {
+	params := url.Values{
+		"order_id":    {orderID},
+		"status":      {status},
+		"amount":      {amount},
+		"channel_ref": {"up-" + orderID},
+	}
+
+	return c.post(channel, params, secret)
+}
+
+func (c *channelStub) post(channel string, params url.Values, secret string) (*http.Response, string) {
+	params.Set(payment.SignatureParam, payment.Sign(secret, params))
+
+	resp, err := http.PostForm(c.server.URL+PathPrefix+channel, params)
+	if err != nil {
+		c.t.Errorf("post callback: %v", err)
+		return &http.Response{}, ""
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+type fakeOrders struct {
+	mu      sync.Mutex
+	orders  map[string]domain.Order
+	applied []string
+}
+
+func newFakeOrders(orders ...domain.Order) *fakeOrders {
+	f := &fakeOrders{orders: make(map[string]domain.Order)}
+	for _, order := range orders {
+		f.orders[order.OrderID] = order
+	}
+	return f
+}
+
+func (f *fakeOrders) GetByID(_ context.Context, orderID string) (domain.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, ok := f.orders[orderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	return order, nil
+}
+
+func (f *fakeOrders) Transition(_ context.Context, t domain.OrderTransition) (domain.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !domain.CanTransitionOrder(t.From, t.To) {
+		return domain.Order{}, &domain.InvalidTransitionError{OrderID: t.OrderID, From: t.From, To: t.To}
+	}
+
+	order := f.orders[t.OrderID]
+	if order.Status != t.From {
+		return order, &domain.StatusConflictError{OrderID: t.OrderID, Expected: t.From, Actual: order.Status}
+	}
+
+	order.Status = t.To
+	if t.ChannelRef != "" {
+		order.ChannelRef = t.ChannelRef
+	}
+	f.orders[t.OrderID] = order
+	f.applied = append(f.applied, t.From+"->"+t.To)
+
+	return order, nil
+}
+
+func (f *fakeOrders) get(orderID string) domain.Order {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.orders[orderID]
+}
+
+func (f *fakeOrders) transitions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.applied...)
+}
+
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+
+	return nil
+}
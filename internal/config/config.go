@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -21,13 +23,84 @@ const (
 	KeyAppEnv        = "APP_ENV"
 	KeyLogLevel      = "LOG_LEVEL"
 
+	KeyUpdateMode        = "TELEGRAM_UPDATE_MODE"
+	KeyWebhookURL        = "TELEGRAM_WEBHOOK_URL"
+	KeyWebhookListenAddr = "TELEGRAM_WEBHOOK_LISTEN_ADDR"
+	KeyWebhookPath       = "TELEGRAM_WEBHOOK_PATH"
+	KeyWebhookSecret     = "TELEGRAM_WEBHOOK_SECRET"
+
+	KeyCallbackListenAddr = "PAYMENT_CALLBACK_LISTEN_ADDR"
+	KeyCallbackSecrets    = "PAYMENT_CALLBACK_SECRETS"
+	KeyCallbackPublicURL  = "PAYMENT_CALLBACK_PUBLIC_URL"
+
+	// KeyPaymentChannels lists the channel adapters; each channel's
+	// credentials are read from PAYMENT_CHANNEL_<CODE>_* keys, with the code
+	// uppercased and "-" replaced by "_".
+	KeyPaymentChannels         = "PAYMENT_CHANNELS"
+	KeyPaymentChannelPrefix    = "PAYMENT_CHANNEL_"
+	SuffixChannelMerchantID    = "_MERCHANT_ID"
+	SuffixChannelSecret        = "_SECRET"
+	SuffixChannelBaseURL       = "_BASE_URL"
+	SuffixChannelCredentialSet = "_CREDENTIAL_SET"
+	SuffixChannelWeight        = "_WEIGHT"
+	SuffixChannelMinAmount     = "_MIN_AMOUNT"
+	SuffixChannelMaxAmount     = "_MAX_AMOUNT"
+	SuffixChannelDailyCap      = "_DAILY_CAP"
+
+	KeyRoutingWindow      = "PAYMENT_ROUTING_WINDOW"
+	KeyRoutingMinSamples  = "PAYMENT_ROUTING_MIN_SAMPLES"
+	KeyRoutingFailureRate = "PAYMENT_ROUTING_FAILURE_RATE"
+	KeyRoutingCooldown    = "PAYMENT_ROUTING_COOLDOWN"
+
+	KeyMetricsListenAddr = "METRICS_LISTEN_ADDR"
+	KeyHealthListenAddr  = "HEALTH_LISTEN_ADDR"
+
+	KeyAuditRetentionDays = "AUDIT_RETENTION_DAYS"
+
+	KeyOrderTTL = "ORDER_TTL"
+
+	KeyPaymentProviderToken = "TELEGRAM_PAYMENT_PROVIDER_TOKEN"
+
+	KeyRateLimitUser     = "RATE_LIMIT_USER"
+	KeyRateLimitChat     = "RATE_LIMIT_CHAT"
+	KeyRateLimitCommands = "RATE_LIMIT_COMMANDS"
+
 	// Allowed environment values.
 	EnvDevelopment = "development"
 	EnvProduction  = "production"
 
+	// Allowed Telegram update delivery modes.
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+
 	// Defaults for optional settings.
-	DefaultAppEnv   = EnvProduction
-	DefaultLogLevel = "info"
+	DefaultAppEnv             = EnvProduction
+	DefaultLogLevel           = "info"
+	DefaultUpdateMode         = UpdateModePolling
+	DefaultWebhookListenAddr  = ":8080"
+	DefaultWebhookPath        = "/telegram/webhook"
+	DefaultAuditRetentionDays = 180
+	DefaultOrderTTL           = 24 * time.Hour
+	DefaultRateLimitUser      = "5/10s"
+	DefaultRateLimitChat      = "20/10s"
+	DefaultRateLimitCommands  = "status=2/1m"
+	DefaultCredentialSet      = "default"
+	DefaultChannelWeight      = 1
+	DefaultRoutingWindow      = 15 * time.Minute
+	DefaultRoutingMinSamples  = 10
+	DefaultRoutingFailureRate = 50
+	DefaultRoutingCooldown    = 5 * time.Minute
+
+	// MaxRoutingWindow bounds PAYMENT_ROUTING_WINDOW to the retention of the
+	// channel outcome counters.
+	MaxRoutingWindow = 24 * time.Hour
+
+	// TelegramChannelCode is the order channel of Telegram invoices and
+	// cannot name an adapter channel.
+	TelegramChannelCode = "telegram"
+
+	// RateLimitOff disables a rate limit.
+	RateLimitOff = "off"
 
 	// Recommended database names by environment.
 	DefaultMongoDBProd = "tg_bot"
@@ -86,6 +159,191 @@ var Contract = []VarSpec{
 		Default:     DefaultLogLevel,
 		Description: "Overrides default log level.",
 	},
+	{
+		Key:         KeyUpdateMode,
+		Example:     UpdateModePolling + " / " + UpdateModeWebhook,
+		Default:     DefaultUpdateMode,
+		Description: "How Telegram updates are delivered to the bot.",
+		Notes:       "Webhook mode requires " + KeyWebhookURL + " and " + KeyWebhookSecret + ".",
+	},
+	{
+		Key:         KeyWebhookURL,
+		Example:     "https://bot.example.com/telegram/webhook",
+		Description: "Public HTTPS URL registered with Telegram via setWebhook.",
+		Notes:       "Required when " + KeyUpdateMode + "=" + UpdateModeWebhook + "; TLS is terminated upstream.",
+	},
+	{
+		Key:         KeyWebhookListenAddr,
+		Example:     DefaultWebhookListenAddr,
+		Default:     DefaultWebhookListenAddr,
+		Description: "Local address the webhook HTTP listener binds to.",
+	},
+	{
+		Key:         KeyWebhookPath,
+		Example:     DefaultWebhookPath,
+		Default:     DefaultWebhookPath,
+		Description: "HTTP path that accepts webhook updates.",
+	},
+	{
+		Key:         KeyWebhookSecret,
+		Example:     "change-me_123",
+		Description: "Secret echoed by Telegram in the X-Telegram-Bot-Api-Secret-Token header.",
+		Notes:       "Required when " + KeyUpdateMode + "=" + UpdateModeWebhook + "; 1-256 characters of A-Z, a-z, 0-9, _ and -.",
+	},
+	{
+		Key:         KeyCallbackListenAddr,
+		Example:     ":8081",
+		Description: "Local address the payment-channel callback HTTP listener binds to.",
+		Notes:       "Leave empty to disable inbound payment callbacks; must differ from " + KeyWebhookListenAddr + " in webhook mode.",
+	},
+	{
+		Key:         KeyCallbackSecrets,
+		Example:     "mock=change-me,alpha=another-secret",
+		Description: "Per-channel HMAC-SHA256 secrets used to verify callback signatures.",
+		Notes:       "Comma-separated channel=secret pairs; required when " + KeyCallbackListenAddr + " is set and " + KeyPaymentChannels + " is empty. Channel codes use 2-32 characters of a-z, 0-9, _ and -.",
+	},
+	{
+		Key:         KeyCallbackPublicURL,
+		Example:     "https://pay.example.com",
+		Description: "Public base URL of the callback listener, sent to channels as the notify URL.",
+		Notes:       "Channels post to <url>/callbacks/<code>; leave empty to rely on status queries only.",
+	},
+	{
+		Key:         KeyPaymentChannels,
+		Example:     "mock=mock,mock-eu=mock",
+		Description: "Payment channels handled by adapters, as code=adapter pairs.",
+		Notes:       "Channel codes use 2-32 characters of a-z, 0-9, _ and -; \"" + TelegramChannelCode + "\" is reserved. Channels verify their own callbacks, so they need no " + KeyCallbackSecrets + " entry.",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelMerchantID,
+		Example:     "m-1001",
+		Description: "Merchant account the bot holds with the channel.",
+		Notes:       "Required for every channel in " + KeyPaymentChannels + "; <CODE> is the channel code uppercased with - replaced by _.",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelSecret,
+		Example:     "change-me",
+		Description: "Secret signing requests to and callbacks from the channel.",
+		Notes:       "Required for every channel in " + KeyPaymentChannels + ".",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelBaseURL,
+		Example:     "https://api.channel.example.com",
+		Description: "HTTP(S) base URL of the channel's API.",
+		Notes:       "The mock adapter starts an in-process stub when empty.",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelCredentialSet,
+		Example:     "2026-10",
+		Default:     DefaultCredentialSet,
+		Description: "Label of the channel's credential set, recorded on each order it handles.",
+		Notes:       "Change it when rotating credentials; refunds require the order's credential set to still be configured.",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelWeight,
+		Example:     "3",
+		Default:     strconv.Itoa(DefaultChannelWeight),
+		Description: "Share of routed orders the channel receives relative to the other channels' weights.",
+		Notes:       "Non-negative integer; 0 keeps the channel for failover only.",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelMinAmount,
+		Example:     "100",
+		Description: "Smallest order amount, in minor units, routed to the channel.",
+		Notes:       "Leave empty for no minimum.",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelMaxAmount,
+		Example:     "500000",
+		Description: "Largest order amount, in minor units, routed to the channel.",
+		Notes:       "Leave empty for no maximum; must not be below the minimum.",
+	},
+	{
+		Key:         KeyPaymentChannelPrefix + "<CODE>" + SuffixChannelDailyCap,
+		Example:     "10000000",
+		Description: "Payment volume, in minor units per currency, the channel may take each UTC day.",
+		Notes:       "Leave empty for no cap; counted across all bot instances in MongoDB.",
+	},
+	{
+		Key:         KeyRoutingWindow,
+		Example:     DefaultRoutingWindow.String(),
+		Default:     DefaultRoutingWindow.String(),
+		Description: "Sliding window over which each channel's payment creation success rate is measured.",
+		Notes:       "Go duration between 1m and 24h.",
+	},
+	{
+		Key:         KeyRoutingMinSamples,
+		Example:     strconv.Itoa(DefaultRoutingMinSamples),
+		Default:     strconv.Itoa(DefaultRoutingMinSamples),
+		Description: "Requests a channel must see within the window before its failure rate can open the circuit breaker.",
+	},
+	{
+		Key:         KeyRoutingFailureRate,
+		Example:     strconv.Itoa(DefaultRoutingFailureRate),
+		Default:     strconv.Itoa(DefaultRoutingFailureRate),
+		Description: "Failure percentage within the window that opens a channel's circuit breaker.",
+		Notes:       "Integer between 1 and 100.",
+	},
+	{
+		Key:         KeyRoutingCooldown,
+		Example:     DefaultRoutingCooldown.String(),
+		Default:     DefaultRoutingCooldown.String(),
+		Description: "How long an open circuit breaker keeps a channel out of routing.",
+		Notes:       "Positive Go duration; re-enabling the channel with /channel_toggle closes the breaker early.",
+	},
+	{
+		Key:         KeyMetricsListenAddr,
+		Example:     ":9090",
+		Description: "Local address the Prometheus /metrics HTTP listener binds to.",
+		Notes:       "Leave empty to disable the metrics endpoint; must differ from the webhook and callback listener addresses.",
+	},
+	{
+		Key:         KeyHealthListenAddr,
+		Example:     ":8082",
+		Description: "Local address the /healthz and /readyz HTTP probe listener binds to.",
+		Notes:       "Leave empty to disable the probes; may equal " + KeyMetricsListenAddr + " to share its listener, but must differ from the webhook and callback listener addresses.",
+	},
+	{
+		Key:         KeyAuditRetentionDays,
+		Example:     strconv.Itoa(DefaultAuditRetentionDays),
+		Default:     strconv.Itoa(DefaultAuditRetentionDays),
+		Description: "Days audit log entries are kept before MongoDB expires them.",
+		Notes:       "Positive integer; applied to the audit TTL index at startup.",
+	},
+	{
+		Key:         KeyOrderTTL,
+		Example:     DefaultOrderTTL.String(),
+		Default:     DefaultOrderTTL.String(),
+		Description: "How long a created or pending order may wait for payment before it is marked expired.",
+		Notes:       "Go duration of at least 1m; a payment that still arrives for an expired order is recorded.",
+	},
+	{
+		Key:         KeyPaymentProviderToken,
+		Example:     "284685063:TEST:abc123",
+		Description: "Payment provider token from BotFather used for Telegram Payments invoices.",
+		Notes:       "Leave empty to disable /invoice; use the provider's TEST token outside production.",
+	},
+	{
+		Key:         KeyRateLimitUser,
+		Example:     DefaultRateLimitUser,
+		Default:     DefaultRateLimitUser,
+		Description: "Token bucket applied to each user per command, as burst/window.",
+		Notes:       "Window uses Go duration syntax (10s, 1m); \"" + RateLimitOff + "\" disables the limit.",
+	},
+	{
+		Key:         KeyRateLimitChat,
+		Example:     DefaultRateLimitChat,
+		Default:     DefaultRateLimitChat,
+		Description: "Token bucket applied to each chat per command, as burst/window.",
+		Notes:       "Same syntax as " + KeyRateLimitUser + "; caps a command across all users of a group.",
+	},
+	{
+		Key:         KeyRateLimitCommands,
+		Example:     "status=2/1m,ping=3/10s",
+		Default:     DefaultRateLimitCommands,
+		Description: "Per-command overrides of " + KeyRateLimitUser + ".",
+		Notes:       "Comma-separated command=burst/window pairs; use command=" + RateLimitOff + " to exempt a command.",
+	},
 }
 
 // Config mirrors resolved configuration values after loading.
@@ -96,6 +354,93 @@ type Config struct {
 	MongoDB       string
 	AppEnv        string
 	LogLevel      string
+
+	UpdateMode        string
+	WebhookURL        string
+	WebhookListenAddr string
+	WebhookPath       string
+	WebhookSecret     string
+
+	CallbackListenAddr string
+	// CallbackSecrets maps payment channel codes to their callback signing
+	// secrets.
+	CallbackSecrets map[string]string
+	// CallbackPublicURL is the externally reachable base URL of the callback
+	// listener, without a trailing slash.
+	CallbackPublicURL string
+
+	// PaymentChannels lists the adapter-backed channels in PAYMENT_CHANNELS
+	// order.
+	PaymentChannels []PaymentChannel
+	PaymentRouting  PaymentRouting
+
+	MetricsListenAddr string
+	HealthListenAddr  string
+
+	AuditRetentionDays int
+
+	// OrderTTL is how long created and pending orders wait for payment
+	// before the expiry sweep marks them expired.
+	OrderTTL time.Duration
+
+	// PaymentProviderToken is passed to sendInvoice for Telegram Payments.
+	PaymentProviderToken string
+
+	RateLimitUser RateLimit
+	RateLimitChat RateLimit
+	// RateLimitCommands overrides RateLimitUser for individual commands,
+	// keyed by command name without the slash.
+	RateLimitCommands map[string]RateLimit
+}
+
+// PaymentChannel is one upstream channel handled by a payment adapter, with
+// the credential set the bot uses for it.
+type PaymentChannel struct {
+	Code          string
+	Adapter       string
+	CredentialSet string
+	MerchantID    string
+	Secret        string
+	BaseURL       string
+
+	// Weight is the channel's share of routed orders; zero keeps it for
+	// failover only.
+	Weight int
+	// MinAmount, MaxAmount and DailyCap are in minor units; zero means no
+	// limit. DailyCap applies per currency and UTC day.
+	MinAmount int64
+	MaxAmount int64
+	DailyCap  int64
+}
+
+// PaymentRouting tunes the circuit breaker that takes failing channels out
+// of routing.
+type PaymentRouting struct {
+	Window             time.Duration
+	MinSamples         int
+	FailureRatePercent int
+	Cooldown           time.Duration
+}
+
+// RateLimit allows Burst requests at once, refilled evenly over Window. The
+// zero value disables limiting.
+type RateLimit struct {
+	Burst  int
+	Window time.Duration
+}
+
+// Enabled reports if the limit restricts anything.
+func (l RateLimit) Enabled() bool {
+	return l.Burst > 0 && l.Window > 0
+}
+
+// String formats the limit in the burst/window syntax used by the config keys.
+func (l RateLimit) String() string {
+	if !l.Enabled() {
+		return RateLimitOff
+	}
+
+	return fmt.Sprintf("%d/%s", l.Burst, l.Window)
 }
 
 // Load resolves configuration from the environment (with optional dotenv in development).
@@ -115,6 +460,30 @@ func Load() (Config, error) {
 		MongoURI:      strings.TrimSpace(os.Getenv(KeyMongoURI)),
 		MongoDB:       strings.TrimSpace(os.Getenv(KeyMongoDB)),
 		LogLevel:      firstNonEmpty(strings.TrimSpace(os.Getenv(KeyLogLevel)), DefaultLogLevel),
+
+		UpdateMode:        firstNonEmpty(normalizeEnv(os.Getenv(KeyUpdateMode)), DefaultUpdateMode),
+		WebhookURL:        strings.TrimSpace(os.Getenv(KeyWebhookURL)),
+		WebhookListenAddr: firstNonEmpty(os.Getenv(KeyWebhookListenAddr), DefaultWebhookListenAddr),
+		WebhookPath:       firstNonEmpty(os.Getenv(KeyWebhookPath), DefaultWebhookPath),
+		WebhookSecret:     strings.TrimSpace(os.Getenv(KeyWebhookSecret)),
+
+		CallbackListenAddr: strings.TrimSpace(os.Getenv(KeyCallbackListenAddr)),
+		CallbackPublicURL:  strings.TrimRight(strings.TrimSpace(os.Getenv(KeyCallbackPublicURL)), "/"),
+
+		MetricsListenAddr: strings.TrimSpace(os.Getenv(KeyMetricsListenAddr)),
+		HealthListenAddr:  strings.TrimSpace(os.Getenv(KeyHealthListenAddr)),
+
+		AuditRetentionDays: DefaultAuditRetentionDays,
+		OrderTTL:           DefaultOrderTTL,
+
+		PaymentProviderToken: strings.TrimSpace(os.Getenv(KeyPaymentProviderToken)),
+
+		PaymentRouting: PaymentRouting{
+			Window:             DefaultRoutingWindow,
+			MinSamples:         DefaultRoutingMinSamples,
+			FailureRatePercent: DefaultRoutingFailureRate,
+			Cooldown:           DefaultRoutingCooldown,
+		},
 	}
 
 	if err := validateAppEnv(cfg.AppEnv); err != nil {
@@ -148,6 +517,118 @@ func Load() (Config, error) {
 		missing = append(missing, KeyMongoDB)
 	}
 
+	if err := validateUpdateMode(cfg.UpdateMode); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.UsesWebhook() {
+		if cfg.WebhookURL == "" {
+			missing = append(missing, KeyWebhookURL)
+		} else if err := validateWebhookURL(cfg.WebhookURL); err != nil {
+			return Config{}, err
+		}
+
+		if cfg.WebhookSecret == "" {
+			missing = append(missing, KeyWebhookSecret)
+		} else if err := validateWebhookSecret(cfg.WebhookSecret); err != nil {
+			return Config{}, err
+		}
+
+		if !strings.HasPrefix(cfg.WebhookPath, "/") {
+			return Config{}, fmt.Errorf("invalid %s: must start with \"/\"", KeyWebhookPath)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(KeyPaymentChannels)); raw != "" {
+		channels, missingKeys, parseErr := parsePaymentChannels(raw)
+		if parseErr != nil {
+			return Config{}, parseErr
+		}
+		missing = append(missing, missingKeys...)
+		cfg.PaymentChannels = channels
+	}
+
+	if cfg.PaymentRouting, err = parsePaymentRouting(cfg.PaymentRouting); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.CallbackPublicURL != "" {
+		if err := validateHTTPURL(KeyCallbackPublicURL, cfg.CallbackPublicURL); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if cfg.CallbacksEnabled() {
+		// Adapter channels verify their own callbacks, so the shared secrets
+		// are only required when no adapter channel is configured.
+		secretsRaw := strings.TrimSpace(os.Getenv(KeyCallbackSecrets))
+		if secretsRaw == "" {
+			if len(cfg.PaymentChannels) == 0 {
+				missing = append(missing, KeyCallbackSecrets)
+			}
+		} else {
+			secrets, parseErr := parseCallbackSecrets(secretsRaw)
+			if parseErr != nil {
+				return Config{}, parseErr
+			}
+			cfg.CallbackSecrets = secrets
+		}
+
+		for _, channel := range cfg.PaymentChannels {
+			if _, exists := cfg.CallbackSecrets[channel.Code]; exists {
+				return Config{}, fmt.Errorf("invalid %s: channel %q is also configured in %s", KeyCallbackSecrets, channel.Code, KeyPaymentChannels)
+			}
+		}
+
+		if cfg.UsesWebhook() && cfg.CallbackListenAddr == cfg.WebhookListenAddr {
+			return Config{}, fmt.Errorf("invalid %s: must differ from %s", KeyCallbackListenAddr, KeyWebhookListenAddr)
+		}
+	}
+
+	if cfg.MetricsEnabled() {
+		if cfg.UsesWebhook() && cfg.MetricsListenAddr == cfg.WebhookListenAddr {
+			return Config{}, fmt.Errorf("invalid %s: must differ from %s", KeyMetricsListenAddr, KeyWebhookListenAddr)
+		}
+		if cfg.MetricsListenAddr == cfg.CallbackListenAddr {
+			return Config{}, fmt.Errorf("invalid %s: must differ from %s", KeyMetricsListenAddr, KeyCallbackListenAddr)
+		}
+	}
+
+	if cfg.HealthEnabled() {
+		if cfg.UsesWebhook() && cfg.HealthListenAddr == cfg.WebhookListenAddr {
+			return Config{}, fmt.Errorf("invalid %s: must differ from %s", KeyHealthListenAddr, KeyWebhookListenAddr)
+		}
+		if cfg.HealthListenAddr == cfg.CallbackListenAddr {
+			return Config{}, fmt.Errorf("invalid %s: must differ from %s", KeyHealthListenAddr, KeyCallbackListenAddr)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(KeyAuditRetentionDays)); raw != "" {
+		days, parseErr := strconv.Atoi(raw)
+		if parseErr != nil || days <= 0 {
+			return Config{}, fmt.Errorf("invalid %s: must be a positive number of days", KeyAuditRetentionDays)
+		}
+		cfg.AuditRetentionDays = days
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(KeyOrderTTL)); raw != "" {
+		ttl, parseErr := time.ParseDuration(raw)
+		if parseErr != nil || ttl < time.Minute {
+			return Config{}, fmt.Errorf("invalid %s: must be a duration of at least 1m such as 24h", KeyOrderTTL)
+		}
+		cfg.OrderTTL = ttl
+	}
+
+	if cfg.RateLimitUser, err = parseRateLimit(KeyRateLimitUser, firstNonEmpty(os.Getenv(KeyRateLimitUser), DefaultRateLimitUser)); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitChat, err = parseRateLimit(KeyRateLimitChat, firstNonEmpty(os.Getenv(KeyRateLimitChat), DefaultRateLimitChat)); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitCommands, err = parseCommandRateLimits(os.Getenv(KeyRateLimitCommands)); err != nil {
+		return Config{}, err
+	}
+
 	if len(missing) > 0 {
 		return Config{}, fmt.Errorf("missing required environment variable(s): %s", strings.Join(missing, ", "))
 	}
@@ -160,6 +641,35 @@ func (c Config) IsDevelopment() bool {
 	return c.AppEnv == EnvDevelopment
 }
 
+// UsesWebhook reports if Telegram updates are delivered via webhook instead of
+// long polling.
+func (c Config) UsesWebhook() bool {
+	return c.UpdateMode == UpdateModeWebhook
+}
+
+// CallbacksEnabled reports if the payment-channel callback listener should be
+// started.
+func (c Config) CallbacksEnabled() bool {
+	return c.CallbackListenAddr != ""
+}
+
+// MetricsEnabled reports if the Prometheus metrics listener should be started.
+func (c Config) MetricsEnabled() bool {
+	return c.MetricsListenAddr != ""
+}
+
+// HealthEnabled reports if the health and readiness probe listener should be
+// started.
+func (c Config) HealthEnabled() bool {
+	return c.HealthListenAddr != ""
+}
+
+// PaymentsEnabled reports if a payment provider token is configured for
+// Telegram Payments invoices.
+func (c Config) PaymentsEnabled() bool {
+	return c.PaymentProviderToken != ""
+}
+
 // FormatRedacted returns a human-readable, secret-safe summary of the resolved configuration.
 // Secrets such as TELEGRAM_TOKEN and MongoDB credentials are redacted.
 func FormatRedacted(cfg Config) string {
@@ -170,6 +680,81 @@ func FormatRedacted(cfg Config) string {
 		"mongo_uri: " + redactMongoURI(cfg.MongoURI),
 		"mongo_db: " + cfg.MongoDB,
 		"log_level: " + cfg.LogLevel,
+		"update_mode: " + cfg.UpdateMode,
+		fmt.Sprintf("audit_retention_days: %d", cfg.AuditRetentionDays),
+		"order_ttl: " + cfg.OrderTTL.String(),
+		"rate_limit_user: " + cfg.RateLimitUser.String(),
+		"rate_limit_chat: " + cfg.RateLimitChat.String(),
+	}
+
+	commands := make([]string, 0, len(cfg.RateLimitCommands))
+	for command := range cfg.RateLimitCommands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		lines = append(lines, "rate_limit_command["+command+"]: "+cfg.RateLimitCommands[command].String())
+	}
+
+	if cfg.UsesWebhook() {
+		lines = append(lines,
+			"webhook_url: "+cfg.WebhookURL,
+			"webhook_listen_addr: "+cfg.WebhookListenAddr,
+			"webhook_path: "+cfg.WebhookPath,
+			"webhook_secret: "+maskSecret(cfg.WebhookSecret),
+		)
+	}
+
+	if cfg.CallbacksEnabled() {
+		channels := make([]string, 0, len(cfg.CallbackSecrets))
+		for channel := range cfg.CallbackSecrets {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+
+		lines = append(lines, "callback_listen_addr: "+cfg.CallbackListenAddr)
+		for _, channel := range channels {
+			lines = append(lines, "callback_secret["+channel+"]: "+maskSecret(cfg.CallbackSecrets[channel]))
+		}
+	}
+
+	if cfg.CallbackPublicURL != "" {
+		lines = append(lines, "callback_public_url: "+cfg.CallbackPublicURL)
+	}
+
+	for _, channel := range cfg.PaymentChannels {
+		prefix := "payment_channel[" + channel.Code + "]."
+		lines = append(lines,
+			prefix+"adapter: "+channel.Adapter,
+			prefix+"credential_set: "+channel.CredentialSet,
+			prefix+"merchant_id: "+channel.MerchantID,
+			prefix+"secret: "+maskSecret(channel.Secret),
+		)
+		if channel.BaseURL != "" {
+			lines = append(lines, prefix+"base_url: "+channel.BaseURL)
+		}
+		lines = append(lines, fmt.Sprintf("%sweight: %d", prefix, channel.Weight))
+		if channel.MinAmount > 0 || channel.MaxAmount > 0 {
+			lines = append(lines, fmt.Sprintf("%samount: %d-%d", prefix, channel.MinAmount, channel.MaxAmount))
+		}
+		if channel.DailyCap > 0 {
+			lines = append(lines, fmt.Sprintf("%sdaily_cap: %d", prefix, channel.DailyCap))
+		}
+	}
+	if len(cfg.PaymentChannels) > 0 {
+		lines = append(lines, fmt.Sprintf("payment_routing: window=%s min_samples=%d failure_rate=%d%% cooldown=%s",
+			cfg.PaymentRouting.Window, cfg.PaymentRouting.MinSamples, cfg.PaymentRouting.FailureRatePercent, cfg.PaymentRouting.Cooldown))
+	}
+
+	if cfg.PaymentsEnabled() {
+		lines = append(lines, "payment_provider_token: "+maskSecret(cfg.PaymentProviderToken))
+	}
+
+	if cfg.MetricsEnabled() {
+		lines = append(lines, "metrics_listen_addr: "+cfg.MetricsListenAddr)
+	}
+	if cfg.HealthEnabled() {
+		lines = append(lines, "health_listen_addr: "+cfg.HealthListenAddr)
 	}
 
 	return strings.Join(lines, "\n")
@@ -218,6 +803,316 @@ func validateAppEnv(appEnv string) error {
 	return fmt.Errorf("invalid %s: must be %q or %q", KeyAppEnv, EnvDevelopment, EnvProduction)
 }
 
+func validateUpdateMode(mode string) error {
+	if mode == UpdateModePolling || mode == UpdateModeWebhook {
+		return nil
+	}
+
+	return fmt.Errorf("invalid %s: must be %q or %q", KeyUpdateMode, UpdateModePolling, UpdateModeWebhook)
+}
+
+func validateWebhookURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", KeyWebhookURL, err)
+	}
+
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("invalid %s: scheme must be https", KeyWebhookURL)
+	}
+
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid %s: missing host", KeyWebhookURL)
+	}
+
+	return nil
+}
+
+func validateWebhookSecret(secret string) error {
+	if len(secret) > 256 {
+		return fmt.Errorf("invalid %s: must be at most 256 characters", KeyWebhookSecret)
+	}
+
+	for _, r := range secret {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return fmt.Errorf("invalid %s: only A-Z, a-z, 0-9, _ and - are allowed", KeyWebhookSecret)
+		}
+	}
+
+	return nil
+}
+
+// parseCallbackSecrets parses comma-separated channel=secret pairs.
+func parseCallbackSecrets(raw string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		channel, secret, ok := strings.Cut(pair, "=")
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		secret = strings.TrimSpace(secret)
+		if !ok || secret == "" {
+			return nil, fmt.Errorf("invalid %s: expected channel=secret pairs", KeyCallbackSecrets)
+		}
+		if !isChannelCode(channel) {
+			return nil, fmt.Errorf("invalid %s: bad channel code %q", KeyCallbackSecrets, channel)
+		}
+		if _, exists := secrets[channel]; exists {
+			return nil, fmt.Errorf("invalid %s: duplicate channel %q", KeyCallbackSecrets, channel)
+		}
+
+		secrets[channel] = secret
+	}
+
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("invalid %s: no channels configured", KeyCallbackSecrets)
+	}
+
+	return secrets, nil
+}
+
+// parsePaymentChannels parses comma-separated code=adapter pairs and loads
+// each channel's credentials. Unset required credentials are returned as
+// missing keys rather than an error so they are reported with the others.
+func parsePaymentChannels(raw string) ([]PaymentChannel, []string, error) {
+	var (
+		channels []PaymentChannel
+		missing  []string
+	)
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		code, adapter, ok := strings.Cut(pair, "=")
+		code = strings.ToLower(strings.TrimSpace(code))
+		adapter = strings.ToLower(strings.TrimSpace(adapter))
+		if !ok || adapter == "" {
+			return nil, nil, fmt.Errorf("invalid %s: expected code=adapter pairs", KeyPaymentChannels)
+		}
+		if !isChannelCode(code) {
+			return nil, nil, fmt.Errorf("invalid %s: bad channel code %q", KeyPaymentChannels, code)
+		}
+		if code == TelegramChannelCode {
+			return nil, nil, fmt.Errorf("invalid %s: channel code %q is reserved for Telegram invoices", KeyPaymentChannels, code)
+		}
+		if seen[code] {
+			return nil, nil, fmt.Errorf("invalid %s: duplicate channel %q", KeyPaymentChannels, code)
+		}
+		seen[code] = true
+
+		prefix := PaymentChannelKeyPrefix(code)
+		channel := PaymentChannel{
+			Code:          code,
+			Adapter:       adapter,
+			CredentialSet: firstNonEmpty(os.Getenv(prefix+SuffixChannelCredentialSet), DefaultCredentialSet),
+			MerchantID:    strings.TrimSpace(os.Getenv(prefix + SuffixChannelMerchantID)),
+			Secret:        strings.TrimSpace(os.Getenv(prefix + SuffixChannelSecret)),
+			BaseURL:       strings.TrimRight(strings.TrimSpace(os.Getenv(prefix+SuffixChannelBaseURL)), "/"),
+		}
+		if channel.MerchantID == "" {
+			missing = append(missing, prefix+SuffixChannelMerchantID)
+		}
+		if channel.Secret == "" {
+			missing = append(missing, prefix+SuffixChannelSecret)
+		}
+		if channel.BaseURL != "" {
+			if err := validateHTTPURL(prefix+SuffixChannelBaseURL, channel.BaseURL); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := parseChannelLimits(prefix, &channel); err != nil {
+			return nil, nil, err
+		}
+
+		channels = append(channels, channel)
+	}
+
+	if len(channels) == 0 {
+		return nil, nil, fmt.Errorf("invalid %s: no channels configured", KeyPaymentChannels)
+	}
+
+	return channels, missing, nil
+}
+
+// parseChannelLimits reads a channel's routing weight and amount limits.
+func parseChannelLimits(prefix string, channel *PaymentChannel) error {
+	channel.Weight = DefaultChannelWeight
+	if raw := strings.TrimSpace(os.Getenv(prefix + SuffixChannelWeight)); raw != "" {
+		weight, err := strconv.Atoi(raw)
+		if err != nil || weight < 0 {
+			return fmt.Errorf("invalid %s: must be a non-negative integer", prefix+SuffixChannelWeight)
+		}
+		channel.Weight = weight
+	}
+
+	for _, limit := range []struct {
+		suffix string
+		value  *int64
+	}{
+		{SuffixChannelMinAmount, &channel.MinAmount},
+		{SuffixChannelMaxAmount, &channel.MaxAmount},
+		{SuffixChannelDailyCap, &channel.DailyCap},
+	} {
+		raw := strings.TrimSpace(os.Getenv(prefix + limit.suffix))
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value <= 0 {
+			return fmt.Errorf("invalid %s: must be a positive amount in minor units", prefix+limit.suffix)
+		}
+		*limit.value = value
+	}
+
+	if channel.MaxAmount > 0 && channel.MaxAmount < channel.MinAmount {
+		return fmt.Errorf("invalid %s: must not be below %s", prefix+SuffixChannelMaxAmount, prefix+SuffixChannelMinAmount)
+	}
+
+	return nil
+}
+
+// parsePaymentRouting overrides the circuit breaker defaults from the
+// environment.
+func parsePaymentRouting(routing PaymentRouting) (PaymentRouting, error) {
+	if raw := strings.TrimSpace(os.Getenv(KeyRoutingWindow)); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window < time.Minute || window > MaxRoutingWindow {
+			return PaymentRouting{}, fmt.Errorf("invalid %s: must be a duration between 1m and %s", KeyRoutingWindow, MaxRoutingWindow)
+		}
+		routing.Window = window
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(KeyRoutingMinSamples)); raw != "" {
+		samples, err := strconv.Atoi(raw)
+		if err != nil || samples <= 0 {
+			return PaymentRouting{}, fmt.Errorf("invalid %s: must be a positive integer", KeyRoutingMinSamples)
+		}
+		routing.MinSamples = samples
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(KeyRoutingFailureRate)); raw != "" {
+		rate, err := strconv.Atoi(strings.TrimSuffix(raw, "%"))
+		if err != nil || rate < 1 || rate > 100 {
+			return PaymentRouting{}, fmt.Errorf("invalid %s: must be a percentage between 1 and 100", KeyRoutingFailureRate)
+		}
+		routing.FailureRatePercent = rate
+	}
+
+	if raw := strings.TrimSpace(os.Getenv(KeyRoutingCooldown)); raw != "" {
+		cooldown, err := time.ParseDuration(raw)
+		if err != nil || cooldown <= 0 {
+			return PaymentRouting{}, fmt.Errorf("invalid %s: must be a positive duration such as 5m", KeyRoutingCooldown)
+		}
+		routing.Cooldown = cooldown
+	}
+
+	return routing, nil
+}
+
+// PaymentChannelKeyPrefix returns the environment key prefix holding a
+// channel's credentials, e.g. PAYMENT_CHANNEL_MOCK_EU for "mock-eu".
+func PaymentChannelKeyPrefix(code string) string {
+	return KeyPaymentChannelPrefix + strings.ReplaceAll(strings.ToUpper(code), "-", "_")
+}
+
+func validateHTTPURL(key, raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid %s: scheme must be http or https", key)
+	}
+
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid %s: missing host", key)
+	}
+
+	return nil
+}
+
+// parseRateLimit parses burst/window, e.g. "5/10s", or "off".
+func parseRateLimit(key, raw string) (RateLimit, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == RateLimitOff {
+		return RateLimit{}, nil
+	}
+
+	burstRaw, windowRaw, ok := strings.Cut(raw, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid %s: expected burst/window such as %q or %q", key, DefaultRateLimitUser, RateLimitOff)
+	}
+
+	burst, err := strconv.Atoi(strings.TrimSpace(burstRaw))
+	if err != nil || burst <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid %s: burst must be a positive integer", key)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowRaw))
+	if err != nil || window <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid %s: window must be a positive duration such as 10s or 1m", key)
+	}
+
+	return RateLimit{Burst: burst, Window: window}, nil
+}
+
+// parseCommandRateLimits parses comma-separated command=burst/window pairs.
+// An unset key falls back to DefaultRateLimitCommands; an explicitly empty
+// value is not distinguishable from unset, so use "ping=off" style entries to
+// exempt commands instead.
+func parseCommandRateLimits(raw string) (map[string]RateLimit, error) {
+	raw = firstNonEmpty(raw, DefaultRateLimitCommands)
+
+	limits := make(map[string]RateLimit)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		command, limitRaw, ok := strings.Cut(pair, "=")
+		command = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(command), "/"))
+		if !ok || command == "" {
+			return nil, fmt.Errorf("invalid %s: expected command=burst/window pairs", KeyRateLimitCommands)
+		}
+		if _, exists := limits[command]; exists {
+			return nil, fmt.Errorf("invalid %s: duplicate command %q", KeyRateLimitCommands, command)
+		}
+
+		limit, err := parseRateLimit(KeyRateLimitCommands, limitRaw)
+		if err != nil {
+			return nil, err
+		}
+		limits[command] = limit
+	}
+
+	return limits, nil
+}
+
+func isChannelCode(code string) bool {
+	if len(code) < 2 || len(code) > 32 {
+		return false
+	}
+
+	for _, r := range code {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
 func validateMongoURI(uri string) error {
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadDefaultsAndRequired(t *testing.T) {
@@ -32,6 +33,121 @@ func TestLoadDefaultsAndRequired(t *testing.T) {
 	if cfg.LogLevel != DefaultLogLevel {
 		t.Fatalf("expected default log level %s, got %s", DefaultLogLevel, cfg.LogLevel)
 	}
+
+	if cfg.AuditRetentionDays != DefaultAuditRetentionDays {
+		t.Fatalf("expected default audit retention %d, got %d", DefaultAuditRetentionDays, cfg.AuditRetentionDays)
+	}
+
+	if cfg.OrderTTL != DefaultOrderTTL {
+		t.Fatalf("expected default order ttl %s, got %s", DefaultOrderTTL, cfg.OrderTTL)
+	}
+}
+
+func TestLoadValidatesAuditRetention(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "12345")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+
+	t.Setenv(KeyAuditRetentionDays, "30")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected config to load, got error: %v", err)
+	}
+	if cfg.AuditRetentionDays != 30 {
+		t.Fatalf("expected audit retention 30, got %d", cfg.AuditRetentionDays)
+	}
+
+	for _, raw := range []string{"0", "-5", "forever"} {
+		t.Setenv(KeyAuditRetentionDays, raw)
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), KeyAuditRetentionDays) {
+			t.Fatalf("expected %s=%q to be rejected, got %v", KeyAuditRetentionDays, raw, err)
+		}
+	}
+}
+
+func TestLoadValidatesOrderTTL(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "12345")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+
+	t.Setenv(KeyOrderTTL, "30m")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected config to load, got error: %v", err)
+	}
+	if cfg.OrderTTL != 30*time.Minute {
+		t.Fatalf("expected order ttl 30m, got %s", cfg.OrderTTL)
+	}
+
+	for _, raw := range []string{"0", "30s", "-1h", "soon"} {
+		t.Setenv(KeyOrderTTL, raw)
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), KeyOrderTTL) {
+			t.Fatalf("expected %s=%q to be rejected, got %v", KeyOrderTTL, raw, err)
+		}
+	}
+}
+
+func TestLoadParsesRateLimits(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "12345")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+
+	unsetEnv(t, KeyRateLimitUser)
+	unsetEnv(t, KeyRateLimitChat)
+	unsetEnv(t, KeyRateLimitCommands)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected config to load, got error: %v", err)
+	}
+	if cfg.RateLimitUser.String() != "5/10s" || cfg.RateLimitChat.String() != "20/10s" {
+		t.Fatalf("unexpected default rate limits user=%s chat=%s", cfg.RateLimitUser, cfg.RateLimitChat)
+	}
+	if got := cfg.RateLimitCommands["status"]; got != (RateLimit{Burst: 2, Window: time.Minute}) {
+		t.Fatalf("expected default /status override, got %+v", cfg.RateLimitCommands)
+	}
+
+	t.Setenv(KeyRateLimitUser, "off")
+	t.Setenv(KeyRateLimitChat, "3/1m")
+	t.Setenv(KeyRateLimitCommands, " /Ping=1/5s , help=off")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected config to load, got error: %v", err)
+	}
+	if cfg.RateLimitUser.Enabled() || cfg.RateLimitChat != (RateLimit{Burst: 3, Window: time.Minute}) {
+		t.Fatalf("unexpected rate limits user=%s chat=%s", cfg.RateLimitUser, cfg.RateLimitChat)
+	}
+	if len(cfg.RateLimitCommands) != 2 || cfg.RateLimitCommands["ping"].String() != "1/5s" || cfg.RateLimitCommands["help"].Enabled() {
+		t.Fatalf("unexpected command overrides %+v", cfg.RateLimitCommands)
+	}
+	if formatted := FormatRedacted(cfg); !strings.Contains(formatted, "rate_limit_command[ping]: 1/5s") {
+		t.Fatalf("expected command overrides in formatted config, got %q", formatted)
+	}
+
+	invalid := map[string][]string{
+		KeyRateLimitUser:     {"5", "0/10s", "x/10s", "5/0s", "5/soon"},
+		KeyRateLimitChat:     {"-1/10s"},
+		KeyRateLimitCommands: {"status", "=1/5s", "ping=1/5s,ping=2/5s", "ping=fast"},
+	}
+	for key, values := range invalid {
+		for _, raw := range values {
+			t.Setenv(KeyRateLimitUser, "5/10s")
+			t.Setenv(KeyRateLimitChat, "20/10s")
+			t.Setenv(KeyRateLimitCommands, "status=2/1m")
+			t.Setenv(key, raw)
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Fatalf("expected %s=%q to be rejected, got %v", key, raw, err)
+			}
+		}
+	}
 }
 
 func TestLoadFailsOnMissingRequired(t *testing.T) {
@@ -153,6 +269,360 @@ func TestLoadValidatesMongoURIFormat(t *testing.T) {
 	}
 }
 
+func TestLoadWebhookModeRequiresURLAndSecret(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+	unsetEnv(t, KeyWebhookURL)
+	unsetEnv(t, KeyWebhookSecret)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+	t.Setenv(KeyUpdateMode, UpdateModeWebhook)
+
+	_, err := Load()
+	if err == nil {
+		t.Fatalf("expected webhook mode without url/secret to error")
+	}
+
+	if !strings.Contains(err.Error(), KeyWebhookURL) || !strings.Contains(err.Error(), KeyWebhookSecret) {
+		t.Fatalf("expected error to mention %s and %s, got %v", KeyWebhookURL, KeyWebhookSecret, err)
+	}
+}
+
+func TestLoadWebhookModeAppliesDefaults(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+	unsetEnv(t, KeyWebhookListenAddr)
+	unsetEnv(t, KeyWebhookPath)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+	t.Setenv(KeyUpdateMode, "Webhook")
+	t.Setenv(KeyWebhookURL, "https://bot.example.com/telegram/webhook")
+	t.Setenv(KeyWebhookSecret, "s3cret_token")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected webhook config to load, got error: %v", err)
+	}
+
+	if !cfg.UsesWebhook() {
+		t.Fatalf("expected webhook mode, got %s", cfg.UpdateMode)
+	}
+	if cfg.WebhookListenAddr != DefaultWebhookListenAddr {
+		t.Fatalf("expected default listen addr %s, got %s", DefaultWebhookListenAddr, cfg.WebhookListenAddr)
+	}
+	if cfg.WebhookPath != DefaultWebhookPath {
+		t.Fatalf("expected default webhook path %s, got %s", DefaultWebhookPath, cfg.WebhookPath)
+	}
+}
+
+func TestLoadValidatesWebhookSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		url    string
+		secret string
+		path   string
+	}{
+		{name: "plain http url", key: KeyWebhookURL, url: "http://bot.example.com/hook", secret: "secret", path: DefaultWebhookPath},
+		{name: "secret charset", key: KeyWebhookSecret, url: "https://bot.example.com/hook", secret: "bad secret!", path: DefaultWebhookPath},
+		{name: "relative path", key: KeyWebhookPath, url: "https://bot.example.com/hook", secret: "secret", path: "hook"},
+		{name: "unknown mode", key: KeyUpdateMode, url: "", secret: "", path: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, KeyAppEnv)
+
+			t.Setenv(KeyTelegramToken, "token")
+			t.Setenv(KeyBotOwner, "123")
+			t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+			t.Setenv(KeyMongoDB, "tg_bot")
+			t.Setenv(KeyUpdateMode, UpdateModeWebhook)
+			if tt.key == KeyUpdateMode {
+				t.Setenv(KeyUpdateMode, "push")
+			}
+			t.Setenv(KeyWebhookURL, tt.url)
+			t.Setenv(KeyWebhookSecret, tt.secret)
+			t.Setenv(KeyWebhookPath, tt.path)
+
+			_, err := Load()
+			if err == nil {
+				t.Fatalf("expected invalid webhook settings to error")
+			}
+			if !strings.Contains(err.Error(), tt.key) {
+				t.Fatalf("expected error to mention %s, got %v", tt.key, err)
+			}
+		})
+	}
+}
+
+func TestLoadCallbackSettings(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+	t.Setenv(KeyCallbackListenAddr, ":8081")
+	t.Setenv(KeyCallbackSecrets, " Mock = s1 ,alpha=s2,")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected callback config to load, got error: %v", err)
+	}
+	if !cfg.CallbacksEnabled() {
+		t.Fatalf("expected callbacks to be enabled")
+	}
+	if len(cfg.CallbackSecrets) != 2 || cfg.CallbackSecrets["mock"] != "s1" || cfg.CallbackSecrets["alpha"] != "s2" {
+		t.Fatalf("unexpected callback secrets: %v", cfg.CallbackSecrets)
+	}
+
+	invalid := []struct {
+		name    string
+		secrets string
+		env     map[string]string
+	}{
+		{name: "missing secrets", secrets: ""},
+		{name: "missing separator", secrets: "mock"},
+		{name: "bad channel", secrets: "Bad Channel=s1"},
+		{name: "duplicate channel", secrets: "mock=s1,MOCK=s2"},
+		{name: "shared listener", secrets: "mock=s1", env: map[string]string{
+			KeyUpdateMode:        UpdateModeWebhook,
+			KeyWebhookURL:        "https://bot.example.com/hook",
+			KeyWebhookSecret:     "secret",
+			KeyWebhookListenAddr: ":8081",
+		}},
+	}
+	for _, tt := range invalid {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(KeyCallbackSecrets, tt.secrets)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load()
+			if err == nil {
+				t.Fatalf("expected invalid callback settings to error")
+			}
+			if !strings.Contains(err.Error(), "PAYMENT_CALLBACK_") {
+				t.Fatalf("expected error to mention callback settings, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPaymentChannels(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+	t.Setenv(KeyCallbackListenAddr, ":8081")
+	unsetEnv(t, KeyCallbackSecrets)
+	t.Setenv(KeyCallbackPublicURL, "https://pay.example.com/")
+	t.Setenv(KeyPaymentChannels, " Mock=mock, mock-eu = MOCK ")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_MERCHANT_ID", "m-1")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_SECRET", "mocksecretvalue")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_MERCHANT_ID", "m-2")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_SECRET", "eusecretvalue")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_BASE_URL", "http://127.0.0.1:9000/")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_CREDENTIAL_SET", "2026-10")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_WEIGHT", "0")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_MIN_AMOUNT", "100")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_MAX_AMOUNT", "50000")
+	t.Setenv("PAYMENT_CHANNEL_MOCK_EU_DAILY_CAP", "1000000")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected payment channels to load without callback secrets, got error: %v", err)
+	}
+	want := []PaymentChannel{
+		{Code: "mock", Adapter: "mock", CredentialSet: DefaultCredentialSet, MerchantID: "m-1", Secret: "mocksecretvalue", Weight: DefaultChannelWeight},
+		{Code: "mock-eu", Adapter: "mock", CredentialSet: "2026-10", MerchantID: "m-2", Secret: "eusecretvalue", BaseURL: "http://127.0.0.1:9000",
+			MinAmount: 100, MaxAmount: 50000, DailyCap: 1000000},
+	}
+	if len(cfg.PaymentChannels) != len(want) || cfg.PaymentChannels[0] != want[0] || cfg.PaymentChannels[1] != want[1] {
+		t.Fatalf("unexpected payment channels %+v", cfg.PaymentChannels)
+	}
+	if cfg.CallbackPublicURL != "https://pay.example.com" {
+		t.Fatalf("expected trimmed callback public url, got %q", cfg.CallbackPublicURL)
+	}
+
+	summary := FormatRedacted(cfg)
+	if strings.Contains(summary, "secretvalue") || !strings.Contains(summary, "payment_channel[mock-eu].credential_set: 2026-10") {
+		t.Fatalf("expected channel summary with masked secrets, got %s", summary)
+	}
+
+	invalid := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "missing separator", env: map[string]string{KeyPaymentChannels: "mock"}, want: KeyPaymentChannels},
+		{name: "bad code", env: map[string]string{KeyPaymentChannels: "Bad Code=mock"}, want: KeyPaymentChannels},
+		{name: "reserved code", env: map[string]string{KeyPaymentChannels: "telegram=mock"}, want: KeyPaymentChannels},
+		{name: "duplicate code", env: map[string]string{KeyPaymentChannels: "mock=mock,MOCK=mock"}, want: KeyPaymentChannels},
+		{name: "missing secret", env: map[string]string{"PAYMENT_CHANNEL_MOCK_SECRET": ""}, want: "PAYMENT_CHANNEL_MOCK_SECRET"},
+		{name: "bad base url", env: map[string]string{"PAYMENT_CHANNEL_MOCK_BASE_URL": "ftp://stub"}, want: "PAYMENT_CHANNEL_MOCK_BASE_URL"},
+		{name: "bad weight", env: map[string]string{"PAYMENT_CHANNEL_MOCK_WEIGHT": "-1"}, want: "PAYMENT_CHANNEL_MOCK_WEIGHT"},
+		{name: "bad daily cap", env: map[string]string{"PAYMENT_CHANNEL_MOCK_DAILY_CAP": "lots"}, want: "PAYMENT_CHANNEL_MOCK_DAILY_CAP"},
+		{name: "max below min", env: map[string]string{"PAYMENT_CHANNEL_MOCK_EU_MAX_AMOUNT": "50"}, want: "PAYMENT_CHANNEL_MOCK_EU_MAX_AMOUNT"},
+		{name: "bad public url", env: map[string]string{KeyCallbackPublicURL: "pay.example.com"}, want: KeyCallbackPublicURL},
+		{name: "shared callback secret", env: map[string]string{KeyCallbackSecrets: "mock=s1"}, want: KeyCallbackSecrets},
+	}
+	for _, tt := range invalid {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error mentioning %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadPaymentRouting(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+	for _, key := range []string{KeyRoutingWindow, KeyRoutingMinSamples, KeyRoutingFailureRate, KeyRoutingCooldown} {
+		unsetEnv(t, key)
+	}
+
+	cfg, err := Load()
+	want := PaymentRouting{Window: DefaultRoutingWindow, MinSamples: DefaultRoutingMinSamples, FailureRatePercent: DefaultRoutingFailureRate, Cooldown: DefaultRoutingCooldown}
+	if err != nil || cfg.PaymentRouting != want {
+		t.Fatalf("expected routing defaults, got %+v err=%v", cfg.PaymentRouting, err)
+	}
+
+	t.Setenv(KeyRoutingWindow, "30m")
+	t.Setenv(KeyRoutingMinSamples, "25")
+	t.Setenv(KeyRoutingFailureRate, "40%")
+	t.Setenv(KeyRoutingCooldown, "2m")
+	cfg, err = Load()
+	want = PaymentRouting{Window: 30 * time.Minute, MinSamples: 25, FailureRatePercent: 40, Cooldown: 2 * time.Minute}
+	if err != nil || cfg.PaymentRouting != want {
+		t.Fatalf("expected routing overrides, got %+v err=%v", cfg.PaymentRouting, err)
+	}
+
+	for key, value := range map[string]string{
+		KeyRoutingWindow:      "48h",
+		KeyRoutingMinSamples:  "0",
+		KeyRoutingFailureRate: "150",
+		KeyRoutingCooldown:    "soon",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Fatalf("expected error mentioning %s, got %v", key, err)
+			}
+		})
+	}
+}
+
+func TestLoadMetricsListenAddr(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+
+	unsetEnv(t, KeyMetricsListenAddr)
+	cfg, err := Load()
+	if err != nil || cfg.MetricsEnabled() {
+		t.Fatalf("expected metrics to be disabled by default, got enabled=%v err=%v", cfg.MetricsEnabled(), err)
+	}
+
+	t.Setenv(KeyMetricsListenAddr, " :9090 ")
+	cfg, err = Load()
+	if err != nil || cfg.MetricsListenAddr != ":9090" {
+		t.Fatalf("expected metrics listener :9090, got %q err=%v", cfg.MetricsListenAddr, err)
+	}
+	if !strings.Contains(FormatRedacted(cfg), "metrics_listen_addr: :9090") {
+		t.Fatalf("expected metrics listener in formatted config")
+	}
+
+	t.Setenv(KeyCallbackListenAddr, ":9090")
+	t.Setenv(KeyCallbackSecrets, "mock=s1")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), KeyMetricsListenAddr) {
+		t.Fatalf("expected a shared callback listener to be rejected, got %v", err)
+	}
+}
+
+func TestLoadHealthListenAddr(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+	unsetEnv(t, KeyCallbackListenAddr)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+
+	unsetEnv(t, KeyHealthListenAddr)
+	cfg, err := Load()
+	if err != nil || cfg.HealthEnabled() {
+		t.Fatalf("expected probes to be disabled by default, got enabled=%v err=%v", cfg.HealthEnabled(), err)
+	}
+
+	// Sharing the metrics listener is allowed.
+	t.Setenv(KeyMetricsListenAddr, ":9090")
+	t.Setenv(KeyHealthListenAddr, " :9090 ")
+	cfg, err = Load()
+	if err != nil || cfg.HealthListenAddr != ":9090" {
+		t.Fatalf("expected probe listener :9090, got %q err=%v", cfg.HealthListenAddr, err)
+	}
+	if !strings.Contains(FormatRedacted(cfg), "health_listen_addr: :9090") {
+		t.Fatalf("expected probe listener in formatted config")
+	}
+
+	t.Setenv(KeyHealthListenAddr, ":8081")
+	t.Setenv(KeyCallbackListenAddr, ":8081")
+	t.Setenv(KeyCallbackSecrets, "mock=s1")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), KeyHealthListenAddr) {
+		t.Fatalf("expected a shared callback listener to be rejected, got %v", err)
+	}
+}
+
+func TestLoadPaymentProviderToken(t *testing.T) {
+	unsetEnv(t, KeyAppEnv)
+
+	t.Setenv(KeyTelegramToken, "token")
+	t.Setenv(KeyBotOwner, "123")
+	t.Setenv(KeyMongoURI, "mongodb://localhost:27017")
+	t.Setenv(KeyMongoDB, "tg_bot")
+
+	unsetEnv(t, KeyPaymentProviderToken)
+	cfg, err := Load()
+	if err != nil || cfg.PaymentsEnabled() {
+		t.Fatalf("expected payments to be disabled by default, got enabled=%v err=%v", cfg.PaymentsEnabled(), err)
+	}
+
+	t.Setenv(KeyPaymentProviderToken, " 284685063:TEST:providersecret ")
+	cfg, err = Load()
+	if err != nil || cfg.PaymentProviderToken != "284685063:TEST:providersecret" {
+		t.Fatalf("expected trimmed provider token, got %q err=%v", cfg.PaymentProviderToken, err)
+	}
+	summary := FormatRedacted(cfg)
+	if strings.Contains(summary, "providersecret") || !strings.Contains(summary, "payment_provider_token: 2846...redacted") {
+		t.Fatalf("expected provider token to be masked, got %s", summary)
+	}
+}
+
 func TestFormatRedactedMasksSecrets(t *testing.T) {
 	cfg := Config{
 		TelegramToken: "abcd1234secret",
@@ -161,6 +631,12 @@ func TestFormatRedactedMasksSecrets(t *testing.T) {
 		MongoDB:       "tg_bot",
 		AppEnv:        EnvDevelopment,
 		LogLevel:      "debug",
+		UpdateMode:    UpdateModeWebhook,
+		WebhookURL:    "https://bot.example.com/telegram/webhook",
+		WebhookSecret: "hooksecretvalue",
+
+		CallbackListenAddr: ":8081",
+		CallbackSecrets:    map[string]string{"mock": "callbacksecretvalue"},
 	}
 
 	summary := FormatRedacted(cfg)
@@ -180,6 +656,18 @@ func TestFormatRedactedMasksSecrets(t *testing.T) {
 	if !strings.Contains(summary, "telegram_token: abcd...redacted") {
 		t.Fatalf("expected telegram token to show masked prefix, got %s", summary)
 	}
+
+	if strings.Contains(summary, "secretvalue") {
+		t.Fatalf("expected webhook secret to be redacted, got %s", summary)
+	}
+
+	if !strings.Contains(summary, "webhook_url: https://bot.example.com/telegram/webhook") {
+		t.Fatalf("expected webhook url in summary, got %s", summary)
+	}
+
+	if !strings.Contains(summary, "callback_secret[mock]: call...redacted") {
+		t.Fatalf("expected callback secret to be masked, got %s", summary)
+	}
 }
 
 func unsetEnv(t *testing.T, key string) {
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Broadcast audiences.
+const (
+	BroadcastAudienceUsers  = "users"
+	BroadcastAudienceGroups = "groups"
+)
+
+// Broadcast statuses. Drafts wait for the owner to confirm the preview;
+// running broadcasts resume from their cursor after a restart.
+const (
+	BroadcastStatusDraft     = "draft"
+	BroadcastStatusRunning   = "running"
+	BroadcastStatusCompleted = "completed"
+	BroadcastStatusCancelled = "cancelled"
+)
+
+// Per-recipient delivery outcomes counted on a broadcast.
+const (
+	BroadcastOutcomeSent    = "sent"
+	BroadcastOutcomeBlocked = "blocked"
+	BroadcastOutcomeFailed  = "failed"
+)
+
+// BroadcastCursorStart sorts before every chat ID, including the negative IDs
+// of groups.
+const BroadcastCursorStart int64 = math.MinInt64
+
+// Broadcast is an owner message sent to every active user or group. Text
+// broadcasts carry Text; copies carry the source FromChatID and MessageID and
+// are delivered with copyMessage. Recipients are walked in chat ID order and
+// Cursor holds the last one processed.
+type Broadcast struct {
+	BroadcastID string `bson:"broadcast_id" json:"broadcast_id"`
+	Audience    string `bson:"audience" json:"audience"`
+	Text        string `bson:"text,omitempty" json:"text,omitempty"`
+	FromChatID  int64  `bson:"from_chat_id,omitempty" json:"from_chat_id,omitempty"`
+	MessageID   int    `bson:"message_id,omitempty" json:"message_id,omitempty"`
+	Status      string `bson:"status" json:"status"`
+	CreatedBy   int64  `bson:"created_by" json:"created_by"`
+	// ReportChatID is the chat the broadcast was requested from; it receives
+	// the completion summary.
+	ReportChatID int64     `bson:"report_chat_id" json:"report_chat_id"`
+	Total        int64     `bson:"total" json:"total"`
+	Cursor       int64     `bson:"cursor" json:"cursor"`
+	Sent         int64     `bson:"sent" json:"sent"`
+	Blocked      int64     `bson:"blocked" json:"blocked"`
+	Failed       int64     `bson:"failed" json:"failed"`
+	LastError    string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	LockedUntil  time.Time `bson:"locked_until" json:"locked_until"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+	// ConfirmedBy is set when a draft is confirmed or cancelled.
+	ConfirmedBy int64      `bson:"confirmed_by,omitempty" json:"confirmed_by,omitempty"`
+	StartedAt   *time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// IsCopy reports whether the broadcast copies an existing message.
+func (b Broadcast) IsCopy() bool {
+	return b.MessageID != 0
+}
+
+// Processed returns how many recipients have been attempted.
+func (b Broadcast) Processed() int64 {
+	return b.Sent + b.Blocked + b.Failed
+}
+
+// IsBroadcastAudience reports whether audience is a known broadcast audience.
+func IsBroadcastAudience(audience string) bool {
+	return audience == BroadcastAudienceUsers || audience == BroadcastAudienceGroups
+}
+
+// NewBroadcastID returns a random broadcast identifier prefixed with "bc_",
+// short enough to fit in inline button data.
+func NewBroadcastID() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate broadcast id: %w", err)
+	}
+
+	return "bc_" + hex.EncodeToString(buf), nil
+}
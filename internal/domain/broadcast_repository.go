@@ -0,0 +1,238 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type broadcastCollection interface {
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+}
+
+// BroadcastRepository persists broadcasts and their delivery progress in
+// MongoDB.
+type BroadcastRepository struct {
+	collection broadcastCollection
+}
+
+// NewBroadcastRepository constructs a BroadcastRepository.
+func NewBroadcastRepository(collection broadcastCollection) *BroadcastRepository {
+	return &BroadcastRepository{collection: collection}
+}
+
+// Create stores a new draft broadcast.
+func (r *BroadcastRepository) Create(ctx context.Context, broadcast Broadcast) (Broadcast, error) {
+	if err := r.check(ctx); err != nil {
+		return Broadcast{}, err
+	}
+	if strings.TrimSpace(broadcast.BroadcastID) == "" {
+		return Broadcast{}, errors.New("broadcast_id is required")
+	}
+	if !IsBroadcastAudience(broadcast.Audience) {
+		return Broadcast{}, fmt.Errorf("unknown broadcast audience %q", broadcast.Audience)
+	}
+	if strings.TrimSpace(broadcast.Text) == "" && !broadcast.IsCopy() {
+		return Broadcast{}, errors.New("broadcast text or message is required")
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	broadcast.Status = BroadcastStatusDraft
+	broadcast.Cursor = BroadcastCursorStart
+	broadcast.CreatedAt = now
+	broadcast.UpdatedAt = now
+
+	if _, err := r.collection.InsertOne(ctx, broadcast); err != nil {
+		return Broadcast{}, fmt.Errorf("insert broadcast: %w", err)
+	}
+
+	return broadcast, nil
+}
+
+// GetByID fetches a broadcast by broadcast_id.
+func (r *BroadcastRepository) GetByID(ctx context.Context, broadcastID string) (Broadcast, error) {
+	if err := r.check(ctx); err != nil {
+		return Broadcast{}, err
+	}
+	if broadcastID == "" {
+		return Broadcast{}, errors.New("broadcast_id is required")
+	}
+
+	return r.findOne(ctx, bson.M{"broadcast_id": broadcastID})
+}
+
+// Latest returns the most recently created broadcast that was not left as a
+// draft, or mongo.ErrNoDocuments when there is none.
+func (r *BroadcastRepository) Latest(ctx context.Context) (Broadcast, error) {
+	if err := r.check(ctx); err != nil {
+		return Broadcast{}, err
+	}
+
+	return r.findOne(ctx,
+		bson.M{"status": bson.M{"$ne": BroadcastStatusDraft}},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+}
+
+// Start moves a draft to running with the recipient total counted at
+// confirmation. It returns mongo.ErrNoDocuments when the broadcast is no longer
+// a draft, so a double-tapped confirm button starts it only once.
+func (r *BroadcastRepository) Start(ctx context.Context, broadcastID string, actorID, total int64, now time.Time) (Broadcast, error) {
+	return r.decide(ctx, broadcastID, bson.M{
+		"status":       BroadcastStatusRunning,
+		"total":        total,
+		"confirmed_by": actorID,
+		"started_at":   now,
+		"updated_at":   now,
+	})
+}
+
+// Cancel discards a draft. Like Start it only applies to drafts.
+func (r *BroadcastRepository) Cancel(ctx context.Context, broadcastID string, actorID int64, now time.Time) (Broadcast, error) {
+	return r.decide(ctx, broadcastID, bson.M{
+		"status":       BroadcastStatusCancelled,
+		"confirmed_by": actorID,
+		"completed_at": now,
+		"updated_at":   now,
+	})
+}
+
+func (r *BroadcastRepository) decide(ctx context.Context, broadcastID string, set bson.M) (Broadcast, error) {
+	if err := r.check(ctx); err != nil {
+		return Broadcast{}, err
+	}
+	if broadcastID == "" {
+		return Broadcast{}, errors.New("broadcast_id is required")
+	}
+
+	return r.findOneAndUpdate(ctx,
+		bson.M{"broadcast_id": broadcastID, "status": BroadcastStatusDraft},
+		bson.M{"$set": set},
+	)
+}
+
+// ClaimRunning leases the oldest running broadcast so only one worker sends
+// it. It returns mongo.ErrNoDocuments when none is available. A worker that
+// stops mid-broadcast leaves the lease to expire, after which the broadcast is
+// claimed again and resumes from its cursor.
+func (r *BroadcastRepository) ClaimRunning(ctx context.Context, now time.Time, lease time.Duration) (Broadcast, error) {
+	if err := r.check(ctx); err != nil {
+		return Broadcast{}, err
+	}
+
+	return r.findOneAndUpdate(ctx,
+		bson.M{
+			"status":       BroadcastStatusRunning,
+			"locked_until": bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"locked_until": now.Add(lease)}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "started_at", Value: 1}}),
+	)
+}
+
+// RecordDelivery advances the cursor past recipientID, counts its outcome,
+// and extends the lease. errMsg is stored as last_error when set.
+func (r *BroadcastRepository) RecordDelivery(ctx context.Context, broadcastID string, recipientID int64, outcome, errMsg string, now, lockedUntil time.Time) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if broadcastID == "" {
+		return errors.New("broadcast_id is required")
+	}
+	if outcome != BroadcastOutcomeSent && outcome != BroadcastOutcomeBlocked && outcome != BroadcastOutcomeFailed {
+		return fmt.Errorf("unknown broadcast outcome %q", outcome)
+	}
+
+	set := bson.M{
+		"cursor":       recipientID,
+		"locked_until": lockedUntil,
+		"updated_at":   now,
+	}
+	if errMsg != "" {
+		set["last_error"] = errMsg
+	}
+
+	if _, err := r.collection.UpdateOne(ctx,
+		bson.M{"broadcast_id": broadcastID, "status": BroadcastStatusRunning},
+		bson.M{"$set": set, "$inc": bson.M{outcome: 1}},
+	); err != nil {
+		return fmt.Errorf("record broadcast delivery: %w", err)
+	}
+
+	return nil
+}
+
+// Complete marks a running broadcast completed and releases its lease.
+func (r *BroadcastRepository) Complete(ctx context.Context, broadcastID string, now time.Time) (Broadcast, error) {
+	if err := r.check(ctx); err != nil {
+		return Broadcast{}, err
+	}
+	if broadcastID == "" {
+		return Broadcast{}, errors.New("broadcast_id is required")
+	}
+
+	return r.findOneAndUpdate(ctx,
+		bson.M{"broadcast_id": broadcastID, "status": BroadcastStatusRunning},
+		bson.M{"$set": bson.M{
+			"status":       BroadcastStatusCompleted,
+			"locked_until": time.Time{},
+			"completed_at": now,
+			"updated_at":   now,
+		}},
+	)
+}
+
+func (r *BroadcastRepository) findOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (Broadcast, error) {
+	result := r.collection.FindOne(ctx, filter, opts...)
+	if result == nil {
+		return Broadcast{}, errors.New("find broadcast returned no result")
+	}
+
+	return decodeBroadcast(result, "find broadcast")
+}
+
+func (r *BroadcastRepository) findOneAndUpdate(ctx context.Context, filter, update bson.M, opts ...*options.FindOneAndUpdateOptions) (Broadcast, error) {
+	opts = append(opts, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	result := r.collection.FindOneAndUpdate(ctx, filter, update, opts...)
+	if result == nil {
+		return Broadcast{}, errors.New("update broadcast returned no result")
+	}
+
+	return decodeBroadcast(result, "update broadcast")
+}
+
+func decodeBroadcast(result *mongo.SingleResult, action string) (Broadcast, error) {
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Broadcast{}, err
+		}
+		return Broadcast{}, fmt.Errorf("%s: %w", action, err)
+	}
+
+	var broadcast Broadcast
+	if err := result.Decode(&broadcast); err != nil {
+		return Broadcast{}, fmt.Errorf("decode broadcast: %w", err)
+	}
+
+	return broadcast, nil
+}
+
+func (r *BroadcastRepository) check(ctx context.Context) error {
+	if r == nil || r.collection == nil {
+		return errors.New("broadcast repository is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
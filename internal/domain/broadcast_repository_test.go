@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestBroadcastRepositoryCreate(t *testing.T) {
+	coll := &recordingBroadcastCollection{}
+	repo := NewBroadcastRepository(coll)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, Broadcast{BroadcastID: "bc_1", Audience: BroadcastAudienceUsers, Text: "hello", CreatedBy: 7})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if created.Status != BroadcastStatusDraft || created.Cursor != BroadcastCursorStart || created.CreatedAt.IsZero() {
+		t.Fatalf("expected draft at cursor start, got %+v", created)
+	}
+	if inserted := coll.inserted.(Broadcast); inserted.BroadcastID != "bc_1" || inserted.Status != BroadcastStatusDraft {
+		t.Fatalf("unexpected inserted broadcast %+v", inserted)
+	}
+
+	invalid := []Broadcast{
+		{Audience: BroadcastAudienceUsers, Text: "hello"},
+		{BroadcastID: "bc_2", Audience: "admins", Text: "hello"},
+		{BroadcastID: "bc_3", Audience: BroadcastAudienceGroups},
+	}
+	for _, broadcast := range invalid {
+		if _, err := repo.Create(ctx, broadcast); err == nil {
+			t.Fatalf("expected %+v to be rejected", broadcast)
+		}
+	}
+	if _, err := repo.Create(ctx, Broadcast{BroadcastID: "bc_4", Audience: BroadcastAudienceGroups, FromChatID: 7, MessageID: 42}); err != nil {
+		t.Fatalf("expected copy broadcast without text to be accepted, got %v", err)
+	}
+}
+
+func TestBroadcastRepositoryStartOnlyAppliesToDrafts(t *testing.T) {
+	coll := &recordingBroadcastCollection{}
+	repo := NewBroadcastRepository(coll)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if _, err := repo.Start(context.Background(), "bc_1", 7, 120, now); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments when the draft is gone, got %v", err)
+	}
+	if coll.filter["status"] != BroadcastStatusDraft || coll.filter["broadcast_id"] != "bc_1" {
+		t.Fatalf("expected start to filter on the draft, got %v", coll.filter)
+	}
+	set := coll.update["$set"].(bson.M)
+	if set["status"] != BroadcastStatusRunning || set["total"] != int64(120) || set["confirmed_by"] != int64(7) {
+		t.Fatalf("unexpected start fields: %v", set)
+	}
+
+	if _, err := repo.ClaimRunning(context.Background(), now, time.Minute); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments when nothing is running, got %v", err)
+	}
+	if coll.filter["status"] != BroadcastStatusRunning {
+		t.Fatalf("expected claim to filter running broadcasts, got %v", coll.filter)
+	}
+	if lease := coll.update["$set"].(bson.M)["locked_until"]; lease != now.Add(time.Minute) {
+		t.Fatalf("expected lease until %v, got %v", now.Add(time.Minute), lease)
+	}
+}
+
+func TestBroadcastRepositoryRecordDelivery(t *testing.T) {
+	coll := &recordingBroadcastCollection{}
+	repo := NewBroadcastRepository(coll)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := repo.RecordDelivery(context.Background(), "bc_1", 42, BroadcastOutcomeBlocked, "forbidden", now, now.Add(time.Minute)); err != nil {
+		t.Fatalf("RecordDelivery returned error: %v", err)
+	}
+	update := coll.update
+	set := update["$set"].(bson.M)
+	if set["cursor"] != int64(42) || set["last_error"] != "forbidden" || set["locked_until"] != now.Add(time.Minute) {
+		t.Fatalf("unexpected delivery fields: %v", set)
+	}
+	if inc := update["$inc"].(bson.M); inc[BroadcastOutcomeBlocked] != 1 {
+		t.Fatalf("expected blocked counter increment, got %v", inc)
+	}
+
+	if err := repo.RecordDelivery(context.Background(), "bc_1", 43, "skipped", "", now, now); err == nil {
+		t.Fatalf("expected unknown outcome to be rejected")
+	}
+}
+
+type recordingBroadcastCollection struct {
+	inserted interface{}
+	filter   bson.M
+	update   bson.M
+}
+
+func (c *recordingBroadcastCollection) InsertOne(_ context.Context, document interface{}, _ ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	c.inserted = document
+	return &mongo.InsertOneResult{}, nil
+}
+
+func (c *recordingBroadcastCollection) FindOne(context.Context, interface{}, ...*options.FindOneOptions) *mongo.SingleResult {
+	return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+}
+
+func (c *recordingBroadcastCollection) FindOneAndUpdate(_ context.Context, filter interface{}, update interface{}, _ ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	c.filter = filter.(bson.M)
+	c.update = update.(bson.M)
+	return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+}
+
+func (c *recordingBroadcastCollection) UpdateOne(_ context.Context, filter interface{}, update interface{}, _ ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	c.filter = filter.(bson.M)
+	c.update = update.(bson.M)
+	return &mongo.UpdateResult{MatchedCount: 1}, nil
+}
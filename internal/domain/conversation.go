@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// Conversation is the in-progress state of a multi-step dialog for one user
+// in one chat. Step indexes the next unanswered step and Values holds the
+// answers collected so far, keyed by step. Mongo removes conversations once
+// ExpiresAt passes.
+type Conversation struct {
+	ChatID    int64             `bson:"chat_id" json:"chat_id"`
+	UserID    int64             `bson:"user_id" json:"user_id"`
+	Dialog    string            `bson:"dialog" json:"dialog"`
+	Step      int               `bson:"step" json:"step"`
+	Values    map[string]string `bson:"values,omitempty" json:"values,omitempty"`
+	ExpiresAt time.Time         `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time         `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time         `bson:"updated_at" json:"updated_at"`
+}
+
+// Expired reports whether the conversation is past its expiry at now. Mongo
+// TTL deletion runs periodically, so readers check expiry themselves.
+func (c Conversation) Expired(now time.Time) bool {
+	return !c.ExpiresAt.After(now)
+}
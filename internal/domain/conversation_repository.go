@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type conversationCollection interface {
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	ReplaceOne(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+}
+
+// ConversationRepository persists dialog state per chat and user in MongoDB.
+type ConversationRepository struct {
+	collection conversationCollection
+}
+
+// NewConversationRepository constructs a ConversationRepository.
+func NewConversationRepository(collection conversationCollection) *ConversationRepository {
+	return &ConversationRepository{collection: collection}
+}
+
+// Get returns the conversation of userID in chatID, or mongo.ErrNoDocuments
+// when there is none.
+func (r *ConversationRepository) Get(ctx context.Context, chatID, userID int64) (Conversation, error) {
+	if err := r.check(ctx); err != nil {
+		return Conversation{}, err
+	}
+
+	result := r.collection.FindOne(ctx, conversationKey(chatID, userID))
+	if result == nil {
+		return Conversation{}, errors.New("find conversation returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Conversation{}, err
+		}
+		return Conversation{}, fmt.Errorf("find conversation: %w", err)
+	}
+
+	var conversation Conversation
+	if err := result.Decode(&conversation); err != nil {
+		return Conversation{}, fmt.Errorf("decode conversation: %w", err)
+	}
+
+	return conversation, nil
+}
+
+// Save stores the conversation, replacing any previous one of the same user
+// in the same chat so a user has at most one active dialog per chat.
+func (r *ConversationRepository) Save(ctx context.Context, conversation Conversation) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if strings.TrimSpace(conversation.Dialog) == "" {
+		return errors.New("dialog is required")
+	}
+	if conversation.ExpiresAt.IsZero() {
+		return errors.New("expires_at is required")
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if conversation.CreatedAt.IsZero() {
+		conversation.CreatedAt = now
+	}
+	conversation.UpdatedAt = now
+
+	if _, err := r.collection.ReplaceOne(ctx,
+		conversationKey(conversation.ChatID, conversation.UserID),
+		conversation,
+		options.Replace().SetUpsert(true),
+	); err != nil {
+		return fmt.Errorf("save conversation: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the conversation of userID in chatID and reports whether one
+// existed.
+func (r *ConversationRepository) Delete(ctx context.Context, chatID, userID int64) (bool, error) {
+	if err := r.check(ctx); err != nil {
+		return false, err
+	}
+
+	result, err := r.collection.DeleteOne(ctx, conversationKey(chatID, userID))
+	if err != nil {
+		return false, fmt.Errorf("delete conversation: %w", err)
+	}
+
+	return result != nil && result.DeletedCount > 0, nil
+}
+
+func conversationKey(chatID, userID int64) bson.M {
+	return bson.M{"chat_id": chatID, "user_id": userID}
+}
+
+func (r *ConversationRepository) check(ctx context.Context) error {
+	if r == nil || r.collection == nil {
+		return errors.New("conversation repository is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestConversationRepositorySaveUpsertsByChatAndUser(t *testing.T) {
+	coll := &recordingConversationCollection{}
+	repo := NewConversationRepository(coll)
+	expires := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	err := repo.Save(context.Background(), Conversation{ChatID: -100, UserID: 7, Dialog: "merchant_create", Step: 1, Values: map[string]string{"merchant_id": "acme"}, ExpiresAt: expires})
+	if err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if coll.filter["chat_id"] != int64(-100) || coll.filter["user_id"] != int64(7) {
+		t.Fatalf("expected save keyed by chat and user, got %v", coll.filter)
+	}
+	if coll.replaceOpts == nil || coll.replaceOpts.Upsert == nil || !*coll.replaceOpts.Upsert {
+		t.Fatalf("expected upsert replace")
+	}
+	saved := coll.replaced.(Conversation)
+	if saved.Step != 1 || saved.Values["merchant_id"] != "acme" || saved.CreatedAt.IsZero() || saved.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected saved conversation %+v", saved)
+	}
+
+	if err := repo.Save(context.Background(), Conversation{ChatID: 1, UserID: 7, ExpiresAt: expires}); err == nil {
+		t.Fatalf("expected conversation without dialog to be rejected")
+	}
+	if err := repo.Save(context.Background(), Conversation{ChatID: 1, UserID: 7, Dialog: "x"}); err == nil {
+		t.Fatalf("expected conversation without expiry to be rejected")
+	}
+}
+
+func TestConversationRepositoryGetAndDelete(t *testing.T) {
+	coll := &recordingConversationCollection{found: bson.M{"chat_id": int64(5), "user_id": int64(7), "dialog": "merchant_create", "step": 2, "values": bson.M{"fee_bps": "150"}}}
+	repo := NewConversationRepository(coll)
+
+	conversation, err := repo.Get(context.Background(), 5, 7)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if conversation.Dialog != "merchant_create" || conversation.Step != 2 || conversation.Values["fee_bps"] != "150" {
+		t.Fatalf("unexpected conversation %+v", conversation)
+	}
+
+	coll.found = nil
+	if _, err := repo.Get(context.Background(), 5, 7); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments, got %v", err)
+	}
+
+	coll.deleted = 1
+	if existed, err := repo.Delete(context.Background(), 5, 7); err != nil || !existed {
+		t.Fatalf("expected delete to report the conversation, got %v err=%v", existed, err)
+	}
+	coll.deleted = 0
+	if existed, err := repo.Delete(context.Background(), 5, 7); err != nil || existed {
+		t.Fatalf("expected delete to report nothing removed, got %v err=%v", existed, err)
+	}
+}
+
+type recordingConversationCollection struct {
+	found       bson.M
+	filter      bson.M
+	replaced    interface{}
+	replaceOpts *options.ReplaceOptions
+	deleted     int64
+}
+
+func (c *recordingConversationCollection) FindOne(_ context.Context, filter interface{}, _ ...*options.FindOneOptions) *mongo.SingleResult {
+	c.filter = filter.(bson.M)
+	if c.found == nil {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(c.found, nil, nil)
+}
+
+func (c *recordingConversationCollection) ReplaceOne(_ context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	c.filter = filter.(bson.M)
+	c.replaced = replacement
+	c.replaceOpts = options.MergeReplaceOptions(opts...)
+	return &mongo.UpdateResult{UpsertedCount: 1}, nil
+}
+
+func (c *recordingConversationCollection) DeleteOne(_ context.Context, filter interface{}, _ ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	c.filter = filter.(bson.M)
+	return &mongo.DeleteResult{DeletedCount: c.deleted}, nil
+}
@@ -2,10 +2,62 @@ package domain
 
 import "time"
 
+// Bot member statuses reported by Telegram in my_chat_member updates.
+const (
+	GroupBotStatusMember        = "member"
+	GroupBotStatusAdministrator = "administrator"
+	GroupBotStatusRestricted    = "restricted"
+	GroupBotStatusLeft          = "left"
+	GroupBotStatusKicked        = "kicked"
+)
+
 // Group represents a Telegram chat where the bot participates.
 type Group struct {
 	ChatID     int64     `bson:"chat_id" json:"chat_id"`
 	Title      string    `bson:"title" json:"title"`
 	JoinedAt   time.Time `bson:"joined_at" json:"joined_at"`
 	LastSeenAt time.Time `bson:"last_seen_at" json:"last_seen_at"`
+	// BotStatus is the bot's own member status; empty for groups recorded
+	// before membership was tracked, which are treated as active.
+	BotStatus       string     `bson:"bot_status,omitempty" json:"bot_status,omitempty"`
+	BotRights       *BotRights `bson:"bot_rights,omitempty" json:"bot_rights,omitempty"`
+	StatusChangedBy int64      `bson:"status_changed_by,omitempty" json:"status_changed_by,omitempty"`
+	StatusChangedAt *time.Time `bson:"status_changed_at,omitempty" json:"status_changed_at,omitempty"`
+	AddedBy         int64      `bson:"added_by,omitempty" json:"added_by,omitempty"`
+	AddedAt         *time.Time `bson:"added_at,omitempty" json:"added_at,omitempty"`
+	RemovedBy       int64      `bson:"removed_by,omitempty" json:"removed_by,omitempty"`
+	RemovedAt       *time.Time `bson:"removed_at,omitempty" json:"removed_at,omitempty"`
+	// MigratedFromChatID is the basic group's chat ID when this record was
+	// merged in from a group-to-supergroup upgrade.
+	MigratedFromChatID int64 `bson:"migrated_from_chat_id,omitempty" json:"migrated_from_chat_id,omitempty"`
+}
+
+// BotRights lists the administrator rights granted to the bot in a group.
+type BotRights struct {
+	CanManageChat      bool `bson:"can_manage_chat" json:"can_manage_chat"`
+	CanDeleteMessages  bool `bson:"can_delete_messages" json:"can_delete_messages"`
+	CanRestrictMembers bool `bson:"can_restrict_members" json:"can_restrict_members"`
+	CanPromoteMembers  bool `bson:"can_promote_members" json:"can_promote_members"`
+	CanChangeInfo      bool `bson:"can_change_info" json:"can_change_info"`
+	CanInviteUsers     bool `bson:"can_invite_users" json:"can_invite_users"`
+	CanPinMessages     bool `bson:"can_pin_messages" json:"can_pin_messages"`
+}
+
+// BotMembership is a change of the bot's member status in a group, taken from
+// a my_chat_member update.
+type BotMembership struct {
+	ChatID    int64
+	Title     string
+	OldStatus string
+	Status    string
+	// Rights is set only when Status is GroupBotStatusAdministrator.
+	Rights    *BotRights
+	ChangedBy int64
+	ChangedAt time.Time
+}
+
+// IsActiveBotStatus reports whether the status keeps the bot in the group.
+// Unknown (empty) statuses count as active.
+func IsActiveBotStatus(status string) bool {
+	return status != GroupBotStatusLeft && status != GroupBotStatusKicked
 }
@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const (
+	// MerchantStatusActive marks a merchant that may accept payments.
+	MerchantStatusActive = "active"
+	// MerchantStatusSuspended marks a merchant whose payments are paused.
+	MerchantStatusSuspended = "suspended"
+)
+
+// MaxFeeRateBps caps merchant fee rates at 100%.
+const MaxFeeRateBps = 10000
+
+var (
+	merchantIDPattern = regexp.MustCompile(`^[a-z0-9_-]{3,32}$`)
+	currencyPattern   = regexp.MustCompile(`^[A-Z]{3,5}$`)
+)
+
+// ErrGroupBoundToOtherMerchant is returned when binding a group chat that is
+// already linked to a different merchant.
+var ErrGroupBoundToOtherMerchant = errors.New("group is bound to another merchant")
+
+// Merchant represents a merchant account whose operations happen in one or
+// more bound Telegram groups.
+type Merchant struct {
+	MerchantID         string    `bson:"merchant_id" json:"merchant_id"`
+	Name               string    `bson:"name" json:"name"`
+	Status             string    `bson:"status" json:"status"`
+	FeeRateBps         int64     `bson:"fee_rate_bps" json:"fee_rate_bps"`
+	SettlementCurrency string    `bson:"settlement_currency" json:"settlement_currency"`
+	GroupChatIDs       []int64   `bson:"group_chat_ids" json:"group_chat_ids"`
+	NotifyURL          string    `bson:"notify_url,omitempty" json:"notify_url,omitempty"`
+	NotifySecret       string    `bson:"notify_secret,omitempty" json:"-"`
+	CreatedAt          time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Validate checks the merchant fields required before persisting.
+func (m Merchant) Validate() error {
+	if err := ValidateMerchantID(m.MerchantID); err != nil {
+		return err
+	}
+	if m.Name == "" {
+		return errors.New("merchant name is required")
+	}
+	if m.Status != MerchantStatusActive && m.Status != MerchantStatusSuspended {
+		return fmt.Errorf("invalid merchant status %q", m.Status)
+	}
+	if err := ValidateFeeRateBps(m.FeeRateBps); err != nil {
+		return err
+	}
+
+	return ValidateSettlementCurrency(m.SettlementCurrency)
+}
+
+// ValidateMerchantID checks a normalized merchant ID.
+func ValidateMerchantID(merchantID string) error {
+	if !merchantIDPattern.MatchString(merchantID) {
+		return fmt.Errorf("invalid merchant_id %q: use 3-32 characters of a-z, 0-9, _ and -", merchantID)
+	}
+
+	return nil
+}
+
+// ValidateFeeRateBps checks that a fee rate is between 0 and MaxFeeRateBps.
+func ValidateFeeRateBps(feeRateBps int64) error {
+	if feeRateBps < 0 || feeRateBps > MaxFeeRateBps {
+		return fmt.Errorf("invalid fee rate %d bps: must be between 0 and %d", feeRateBps, MaxFeeRateBps)
+	}
+
+	return nil
+}
+
+// ValidateSettlementCurrency checks an uppercase settlement currency code.
+func ValidateSettlementCurrency(currency string) error {
+	if !currencyPattern.MatchString(currency) {
+		return fmt.Errorf("invalid settlement currency %q: use 3-5 uppercase letters", currency)
+	}
+
+	return nil
+}
+
+// HasGroup reports whether the chat ID is bound to the merchant.
+func (m Merchant) HasGroup(chatID int64) bool {
+	for _, id := range m.GroupChatIDs {
+		if id == chatID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateNotifyURL checks that a merchant notify URL is an absolute http(s)
+// URL.
+func ValidateNotifyURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid notify url: %w", err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return errors.New("invalid notify url: scheme must be http or https")
+	}
+	if parsed.Host == "" {
+		return errors.New("invalid notify url: missing host")
+	}
+
+	return nil
+}
+
+// NewNotifySecret returns a random hex secret used to sign merchant
+// notifications.
+func NewNotifySecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate notify secret: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
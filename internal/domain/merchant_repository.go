@@ -0,0 +1,245 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type merchantCollection interface {
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+}
+
+// MerchantRepository persists and retrieves merchants in MongoDB.
+type MerchantRepository struct {
+	collection merchantCollection
+}
+
+// NewMerchantRepository constructs a MerchantRepository.
+func NewMerchantRepository(collection merchantCollection) *MerchantRepository {
+	return &MerchantRepository{collection: collection}
+}
+
+// Create validates and inserts a merchant, normalizing the ID and currency and
+// defaulting the status to active.
+func (r *MerchantRepository) Create(ctx context.Context, merchant Merchant) (Merchant, error) {
+	if r == nil || r.collection == nil {
+		return Merchant{}, errors.New("merchant repository is not initialized")
+	}
+	if ctx == nil {
+		return Merchant{}, errors.New("context is required")
+	}
+
+	merchant.MerchantID = NormalizeMerchantID(merchant.MerchantID)
+	merchant.Name = strings.TrimSpace(merchant.Name)
+	merchant.SettlementCurrency = strings.ToUpper(strings.TrimSpace(merchant.SettlementCurrency))
+	if merchant.Status == "" {
+		merchant.Status = MerchantStatusActive
+	}
+	if merchant.GroupChatIDs == nil {
+		merchant.GroupChatIDs = []int64{}
+	}
+
+	if err := merchant.Validate(); err != nil {
+		return Merchant{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if merchant.CreatedAt.IsZero() {
+		merchant.CreatedAt = now
+	}
+	merchant.UpdatedAt = now
+
+	if _, err := r.collection.InsertOne(ctx, merchant); err != nil {
+		return Merchant{}, fmt.Errorf("insert merchant: %w", err)
+	}
+
+	return merchant, nil
+}
+
+// GetByID fetches a merchant by merchant_id.
+func (r *MerchantRepository) GetByID(ctx context.Context, merchantID string) (Merchant, error) {
+	merchantID = NormalizeMerchantID(merchantID)
+	if merchantID == "" {
+		return Merchant{}, errors.New("merchant_id is required")
+	}
+
+	return r.findOne(ctx, bson.M{"merchant_id": merchantID})
+}
+
+// GetByGroupChatID fetches the merchant bound to the given group chat.
+func (r *MerchantRepository) GetByGroupChatID(ctx context.Context, chatID int64) (Merchant, error) {
+	if chatID == 0 {
+		return Merchant{}, errors.New("chat_id is required")
+	}
+
+	return r.findOne(ctx, bson.M{"group_chat_ids": chatID})
+}
+
+// BindGroup links a group chat to the merchant and returns the updated record.
+// Binding a group already linked to another merchant returns
+// ErrGroupBoundToOtherMerchant; re-binding the same merchant is a no-op.
+func (r *MerchantRepository) BindGroup(ctx context.Context, merchantID string, chatID int64) (Merchant, error) {
+	merchantID = NormalizeMerchantID(merchantID)
+	if merchantID == "" {
+		return Merchant{}, errors.New("merchant_id is required")
+	}
+	if chatID == 0 {
+		return Merchant{}, errors.New("chat_id is required")
+	}
+
+	current, err := r.GetByGroupChatID(ctx, chatID)
+	switch {
+	case err == nil && current.MerchantID != merchantID:
+		return Merchant{}, ErrGroupBoundToOtherMerchant
+	case err != nil && !errors.Is(err, mongo.ErrNoDocuments):
+		return Merchant{}, err
+	}
+
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"merchant_id": merchantID},
+		bson.M{
+			"$addToSet": bson.M{"group_chat_ids": chatID},
+			"$set":      bson.M{"updated_at": time.Now().UTC().Truncate(time.Millisecond)},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return Merchant{}, errors.New("bind merchant group returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return Merchant{}, ErrGroupBoundToOtherMerchant
+		}
+		return Merchant{}, fmt.Errorf("bind merchant group: %w", err)
+	}
+
+	var merchant Merchant
+	if err := result.Decode(&merchant); err != nil {
+		return Merchant{}, fmt.Errorf("decode merchant: %w", err)
+	}
+
+	return merchant, nil
+}
+
+// MoveGroup rebinds a group chat to a new chat ID, as when Telegram upgrades a
+// group to a supergroup, and returns the updated merchant. A chat that is not
+// bound to any merchant yields mongo.ErrNoDocuments.
+func (r *MerchantRepository) MoveGroup(ctx context.Context, fromChatID, toChatID int64) (Merchant, error) {
+	if r == nil || r.collection == nil {
+		return Merchant{}, errors.New("merchant repository is not initialized")
+	}
+	if ctx == nil {
+		return Merchant{}, errors.New("context is required")
+	}
+	if fromChatID == 0 || toChatID == 0 {
+		return Merchant{}, errors.New("chat_id is required")
+	}
+
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"group_chat_ids": fromChatID},
+		bson.M{"$set": bson.M{
+			"group_chat_ids.$": toChatID,
+			"updated_at":       time.Now().UTC().Truncate(time.Millisecond),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return Merchant{}, errors.New("move merchant group returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return Merchant{}, ErrGroupBoundToOtherMerchant
+		}
+		return Merchant{}, fmt.Errorf("move merchant group: %w", err)
+	}
+
+	var merchant Merchant
+	if err := result.Decode(&merchant); err != nil {
+		return Merchant{}, fmt.Errorf("decode merchant: %w", err)
+	}
+
+	return merchant, nil
+}
+
+// SetNotifyURL stores the merchant's notification endpoint and signing secret
+// and returns the updated record.
+func (r *MerchantRepository) SetNotifyURL(ctx context.Context, merchantID, notifyURL, secret string) (Merchant, error) {
+	if r == nil || r.collection == nil {
+		return Merchant{}, errors.New("merchant repository is not initialized")
+	}
+	if ctx == nil {
+		return Merchant{}, errors.New("context is required")
+	}
+	merchantID = NormalizeMerchantID(merchantID)
+	if merchantID == "" {
+		return Merchant{}, errors.New("merchant_id is required")
+	}
+	notifyURL = strings.TrimSpace(notifyURL)
+	if err := ValidateNotifyURL(notifyURL); err != nil {
+		return Merchant{}, err
+	}
+	if secret == "" {
+		return Merchant{}, errors.New("notify secret is required")
+	}
+
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"merchant_id": merchantID},
+		bson.M{"$set": bson.M{
+			"notify_url":    notifyURL,
+			"notify_secret": secret,
+			"updated_at":    time.Now().UTC().Truncate(time.Millisecond),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return Merchant{}, errors.New("set merchant notify url returned no result")
+	}
+	if err := result.Err(); err != nil {
+		return Merchant{}, fmt.Errorf("set merchant notify url: %w", err)
+	}
+
+	var merchant Merchant
+	if err := result.Decode(&merchant); err != nil {
+		return Merchant{}, fmt.Errorf("decode merchant: %w", err)
+	}
+
+	return merchant, nil
+}
+
+func (r *MerchantRepository) findOne(ctx context.Context, filter bson.M) (Merchant, error) {
+	if r == nil || r.collection == nil {
+		return Merchant{}, errors.New("merchant repository is not initialized")
+	}
+	if ctx == nil {
+		return Merchant{}, errors.New("context is required")
+	}
+
+	result := r.collection.FindOne(ctx, filter)
+	if result == nil {
+		return Merchant{}, errors.New("find merchant returned no result")
+	}
+	if err := result.Err(); err != nil {
+		return Merchant{}, fmt.Errorf("find merchant: %w", err)
+	}
+
+	var merchant Merchant
+	if err := result.Decode(&merchant); err != nil {
+		return Merchant{}, fmt.Errorf("decode merchant: %w", err)
+	}
+
+	return merchant, nil
+}
+
+// NormalizeMerchantID trims and lowercases a merchant identifier.
+func NormalizeMerchantID(merchantID string) string {
+	return strings.ToLower(strings.TrimSpace(merchantID))
+}
@@ -0,0 +1,252 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMerchantRepositoryCreateNormalizesAndValidates(t *testing.T) {
+	coll := newFakeMerchantCollection(t)
+	repo := NewMerchantRepository(coll)
+
+	created, err := repo.Create(context.Background(), Merchant{
+		MerchantID:         " Shop_01 ",
+		Name:               " Demo Shop ",
+		FeeRateBps:         250,
+		SettlementCurrency: "usdt",
+	})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if created.MerchantID != "shop_01" || created.Name != "Demo Shop" || created.SettlementCurrency != "USDT" {
+		t.Fatalf("expected normalized merchant, got %+v", created)
+	}
+	if created.Status != MerchantStatusActive {
+		t.Fatalf("expected default status %s, got %s", MerchantStatusActive, created.Status)
+	}
+	if created.CreatedAt.IsZero() || !created.CreatedAt.Equal(created.UpdatedAt) {
+		t.Fatalf("expected matching timestamps on insert, got created_at=%v updated_at=%v", created.CreatedAt, created.UpdatedAt)
+	}
+
+	doc := coll.docs["shop_01"]
+	if doc == nil {
+		t.Fatalf("expected merchant document to be stored")
+	}
+	if _, ok := doc["group_chat_ids"].(bson.A); !ok {
+		t.Fatalf("expected group_chat_ids to be stored as an empty array, got %T", doc["group_chat_ids"])
+	}
+
+	invalid := []Merchant{
+		{MerchantID: "x", Name: "Short", SettlementCurrency: "USD"},
+		{MerchantID: "shop_02", SettlementCurrency: "USD"},
+		{MerchantID: "shop_03", Name: "Fee", FeeRateBps: MaxFeeRateBps + 1, SettlementCurrency: "USD"},
+		{MerchantID: "shop_04", Name: "Currency", SettlementCurrency: "US"},
+		{MerchantID: "shop_05", Name: "Status", Status: "closed", SettlementCurrency: "USD"},
+	}
+	for _, merchant := range invalid {
+		if _, err := repo.Create(context.Background(), merchant); err == nil {
+			t.Fatalf("expected validation error for %+v", merchant)
+		}
+	}
+}
+
+func TestMerchantRepositoryBindGroup(t *testing.T) {
+	coll := newFakeMerchantCollection(t)
+	repo := NewMerchantRepository(coll)
+	ctx := context.Background()
+
+	for _, id := range []string{"alpha", "beta"} {
+		if _, err := repo.Create(ctx, Merchant{MerchantID: id, Name: id, SettlementCurrency: "USD"}); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+	}
+
+	bound, err := repo.BindGroup(ctx, "ALPHA", -1001)
+	if err != nil {
+		t.Fatalf("BindGroup returned error: %v", err)
+	}
+	if !bound.HasGroup(-1001) {
+		t.Fatalf("expected merchant to include bound group, got %v", bound.GroupChatIDs)
+	}
+
+	again, err := repo.BindGroup(ctx, "alpha", -1001)
+	if err != nil {
+		t.Fatalf("expected re-binding the same merchant to succeed, got %v", err)
+	}
+	if len(again.GroupChatIDs) != 1 {
+		t.Fatalf("expected group to be bound once, got %v", again.GroupChatIDs)
+	}
+
+	if _, err := repo.BindGroup(ctx, "beta", -1001); !errors.Is(err, ErrGroupBoundToOtherMerchant) {
+		t.Fatalf("expected ErrGroupBoundToOtherMerchant, got %v", err)
+	}
+
+	found, err := repo.GetByGroupChatID(ctx, -1001)
+	if err != nil {
+		t.Fatalf("GetByGroupChatID returned error: %v", err)
+	}
+	if found.MerchantID != "alpha" {
+		t.Fatalf("expected alpha to own the group, got %s", found.MerchantID)
+	}
+
+	if _, err := repo.GetByID(ctx, "missing"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for missing merchant, got %v", err)
+	}
+	if _, err := repo.BindGroup(ctx, "missing", -2002); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments when binding unknown merchant, got %v", err)
+	}
+}
+
+func TestMerchantRepositoryMoveGroup(t *testing.T) {
+	coll := newFakeMerchantCollection(t)
+	repo := NewMerchantRepository(coll)
+	ctx := context.Background()
+
+	if _, err := repo.Create(ctx, Merchant{MerchantID: "shop", Name: "Shop", SettlementCurrency: "USD"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	for _, chatID := range []int64{-1, -2} {
+		if _, err := repo.BindGroup(ctx, "shop", chatID); err != nil {
+			t.Fatalf("BindGroup returned error: %v", err)
+		}
+	}
+
+	moved, err := repo.MoveGroup(ctx, -2, -1002)
+	if err != nil {
+		t.Fatalf("MoveGroup returned error: %v", err)
+	}
+	if moved.HasGroup(-2) || !moved.HasGroup(-1002) || !moved.HasGroup(-1) {
+		t.Fatalf("expected -2 to be replaced by -1002, got %v", moved.GroupChatIDs)
+	}
+
+	if _, err := repo.MoveGroup(ctx, -2, -1002); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for an unbound chat, got %v", err)
+	}
+	if _, err := NewMerchantRepository(nil).MoveGroup(ctx, -2, -1002); err == nil {
+		t.Fatalf("expected uninitialized repository to fail")
+	}
+}
+
+func TestMerchantRepositorySetNotifyURL(t *testing.T) {
+	coll := newFakeMerchantCollection(t)
+	repo := NewMerchantRepository(coll)
+	ctx := context.Background()
+
+	if _, err := repo.Create(ctx, Merchant{MerchantID: "alpha", Name: "Alpha", SettlementCurrency: "USD"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	updated, err := repo.SetNotifyURL(ctx, "alpha", " https://shop.example.com/notify ", "secret")
+	if err != nil {
+		t.Fatalf("SetNotifyURL returned error: %v", err)
+	}
+	if updated.NotifyURL != "https://shop.example.com/notify" || updated.NotifySecret != "secret" {
+		t.Fatalf("expected notify settings to be stored, got %+v", updated)
+	}
+
+	for _, raw := range []string{"ftp://shop.example.com", "/relative", "https://"} {
+		if _, err := repo.SetNotifyURL(ctx, "alpha", raw, "secret"); err == nil {
+			t.Fatalf("expected invalid notify url %q to be rejected", raw)
+		}
+	}
+	if _, err := repo.SetNotifyURL(ctx, "missing", "https://shop.example.com", "secret"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for unknown merchant, got %v", err)
+	}
+}
+
+type fakeMerchantCollection struct {
+	t    *testing.T
+	docs map[string]bson.M
+}
+
+func newFakeMerchantCollection(t *testing.T) *fakeMerchantCollection {
+	t.Helper()
+	return &fakeMerchantCollection{t: t, docs: make(map[string]bson.M)}
+}
+
+func (f *fakeMerchantCollection) InsertOne(_ context.Context, document interface{}, _ ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	doc := marshalDoc(f.t, document)
+	id, _ := doc["merchant_id"].(string)
+	if _, exists := f.docs[id]; exists {
+		return nil, fmt.Errorf("duplicate merchant_id %s", id)
+	}
+
+	f.docs[id] = doc
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+func (f *fakeMerchantCollection) FindOne(_ context.Context, filter interface{}, _ ...*options.FindOneOptions) *mongo.SingleResult {
+	doc := f.match(filter.(bson.M))
+	if doc == nil {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (f *fakeMerchantCollection) FindOneAndUpdate(_ context.Context, filter interface{}, update interface{}, _ ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	doc := f.match(filter.(bson.M))
+	if doc == nil {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+
+	updateDoc := update.(bson.M)
+	if addToSet, ok := updateDoc["$addToSet"].(bson.M); ok {
+		for field, value := range addToSet {
+			arr, _ := doc[field].(bson.A)
+			found := false
+			for _, existing := range arr {
+				if existing == value {
+					found = true
+				}
+			}
+			if !found {
+				arr = append(arr, value)
+			}
+			doc[field] = arr
+		}
+	}
+	if set, ok := updateDoc["$set"].(bson.M); ok {
+		for field, value := range set {
+			if field == "group_chat_ids.$" {
+				// Positional update: replace the element matched by the filter.
+				arr, _ := doc["group_chat_ids"].(bson.A)
+				for i, existing := range arr {
+					if existing == filter.(bson.M)["group_chat_ids"] {
+						arr[i] = value
+					}
+				}
+				continue
+			}
+			doc[field] = value
+		}
+	}
+
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (f *fakeMerchantCollection) match(filter bson.M) bson.M {
+	if id, ok := filter["merchant_id"]; ok {
+		return f.docs[id.(string)]
+	}
+
+	if chatID, ok := filter["group_chat_ids"]; ok {
+		for _, doc := range f.docs {
+			arr, _ := doc["group_chat_ids"].(bson.A)
+			for _, existing := range arr {
+				if existing == chatID {
+					return doc
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// FormatAmount renders an amount of currency: whole units for Telegram Stars,
+// which have no minor unit, and FormatMinor otherwise.
+func FormatAmount(amount int64, currency string) string {
+	if currency == CurrencyStars {
+		return strconv.FormatInt(amount, 10)
+	}
+
+	return FormatMinor(amount)
+}
+
+// FormatMinor renders an amount in minor units with two decimal places.
+func FormatMinor(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "testing"
+
+func TestFormatMinor(t *testing.T) {
+	cases := map[int64]string{0: "0.00", 5: "0.05", 1234: "12.34", -250: "-2.50"}
+	for amount, want := range cases {
+		if got := FormatMinor(amount); got != want {
+			t.Fatalf("FormatMinor(%d) = %q, want %q", amount, got, want)
+		}
+	}
+	if got := FormatAmount(1250, "XTR"); got != "1250" {
+		t.Fatalf("FormatAmount(1250, XTR) = %q, want whole stars", got)
+	}
+	if got := FormatAmount(1250, "USD"); got != "12.50" {
+		t.Fatalf("FormatAmount(1250, USD) = %q, want 12.50", got)
+	}
+}
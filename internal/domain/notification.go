@@ -0,0 +1,77 @@
+package domain
+
+import "time"
+
+// Merchant notification events.
+const (
+	NotificationEventOrderPaid     = "order.paid"
+	NotificationEventOrderRefunded = "order.refunded"
+)
+
+// Merchant notification delivery statuses.
+const (
+	NotificationStatusPending   = "pending"
+	NotificationStatusDelivered = "delivered"
+	NotificationStatusFailed    = "failed"
+)
+
+// MaxNotificationAttemptsKept bounds the attempt history stored per
+// notification.
+const MaxNotificationAttemptsKept = 20
+
+// NotificationAttempt records a single delivery attempt.
+type NotificationAttempt struct {
+	Attempt    int       `bson:"attempt" json:"attempt"`
+	At         time.Time `bson:"at" json:"at"`
+	HTTPStatus int       `bson:"http_status,omitempty" json:"http_status,omitempty"`
+	LatencyMs  int64     `bson:"latency_ms" json:"latency_ms"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Notification is an outbox entry for a signed merchant webhook about an
+// order event. There is at most one notification per order and event.
+type Notification struct {
+	NotificationID string                `bson:"notification_id" json:"notification_id"`
+	OrderID        string                `bson:"order_id" json:"order_id"`
+	MerchantID     string                `bson:"merchant_id" json:"merchant_id"`
+	Event          string                `bson:"event" json:"event"`
+	Status         string                `bson:"status" json:"status"`
+	AttemptCount   int                   `bson:"attempt_count" json:"attempt_count"`
+	NextAttemptAt  time.Time             `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil    time.Time             `bson:"locked_until" json:"locked_until"`
+	Attempts       []NotificationAttempt `bson:"attempts" json:"attempts"`
+	CreatedAt      time.Time             `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time             `bson:"updated_at" json:"updated_at"`
+	DeliveredAt    *time.Time            `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+// NotificationID returns the outbox key for an order event.
+func NotificationID(orderID, event string) string {
+	return orderID + ":" + event
+}
+
+// NotificationEventForStatus returns the merchant notification event emitted
+// when an order enters status, or "" when the status is not notified.
+func NotificationEventForStatus(status string) string {
+	switch status {
+	case OrderStatusPaid:
+		return NotificationEventOrderPaid
+	case OrderStatusRefunded:
+		return NotificationEventOrderRefunded
+	default:
+		return ""
+	}
+}
+
+// NotificationStatusForEvent returns the order status a merchant notification
+// event reports, or "" for unknown events.
+func NotificationStatusForEvent(event string) string {
+	switch event {
+	case NotificationEventOrderPaid:
+		return OrderStatusPaid
+	case NotificationEventOrderRefunded:
+		return OrderStatusRefunded
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,227 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotificationLeaseLost reports that a notification's lease expired and
+// another worker claimed it, or it was requeued, before the attempt was
+// recorded.
+var ErrNotificationLeaseLost = errors.New("notification lease lost")
+
+type notificationCollection interface {
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+}
+
+// NotificationRepository persists the merchant notification outbox in
+// MongoDB.
+type NotificationRepository struct {
+	collection notificationCollection
+}
+
+// NewNotificationRepository constructs a NotificationRepository.
+func NewNotificationRepository(collection notificationCollection) *NotificationRepository {
+	return &NotificationRepository{collection: collection}
+}
+
+// Enqueue inserts a pending notification for the order event unless one
+// already exists, reporting whether it was created.
+func (r *NotificationRepository) Enqueue(ctx context.Context, order Order, event string) (bool, error) {
+	if err := r.check(ctx); err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(order.OrderID) == "" {
+		return false, errors.New("order_id is required")
+	}
+	if event != NotificationEventOrderPaid && event != NotificationEventOrderRefunded {
+		return false, fmt.Errorf("unknown notification event %q", event)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"notification_id": NotificationID(order.OrderID, event)},
+		bson.M{"$setOnInsert": bson.M{
+			"notification_id": NotificationID(order.OrderID, event),
+			"order_id":        order.OrderID,
+			"merchant_id":     order.MerchantID,
+			"event":           event,
+			"status":          NotificationStatusPending,
+			"attempt_count":   0,
+			"next_attempt_at": now,
+			"locked_until":    time.Time{},
+			"attempts":        bson.A{},
+			"created_at":      now,
+			"updated_at":      now,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, fmt.Errorf("enqueue notification: %w", err)
+	}
+
+	return result != nil && result.UpsertedCount > 0, nil
+}
+
+// ClaimDue leases the oldest pending notification whose next attempt is due so
+// that only one worker delivers it. It returns mongo.ErrNoDocuments when
+// nothing is due. Leases expire on their own, so notifications claimed by a
+// process that stops are picked up again after a restart.
+func (r *NotificationRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (Notification, error) {
+	if err := r.check(ctx); err != nil {
+		return Notification{}, err
+	}
+
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"status":          NotificationStatusPending,
+			"next_attempt_at": bson.M{"$lte": now},
+			"locked_until":    bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"locked_until": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return Notification{}, errors.New("claim notification returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Notification{}, err
+		}
+		return Notification{}, fmt.Errorf("claim notification: %w", err)
+	}
+
+	var notification Notification
+	if err := result.Decode(&notification); err != nil {
+		return Notification{}, fmt.Errorf("decode notification: %w", err)
+	}
+
+	return notification, nil
+}
+
+// RecordAttempt appends a delivery attempt, sets the resulting status and next
+// attempt time, and releases the lease. lockedUntil is the lease returned by
+// ClaimDue; when the notification is no longer pending under that lease the
+// attempt is dropped and ErrNotificationLeaseLost is returned.
+func (r *NotificationRepository) RecordAttempt(ctx context.Context, notificationID string, lockedUntil time.Time, attempt NotificationAttempt, status string, nextAttemptAt time.Time) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if notificationID == "" {
+		return errors.New("notification_id is required")
+	}
+
+	set := bson.M{
+		"status":          status,
+		"attempt_count":   attempt.Attempt,
+		"next_attempt_at": nextAttemptAt,
+		"locked_until":    time.Time{},
+		"updated_at":      attempt.At,
+	}
+	if status == NotificationStatusDelivered {
+		set["delivered_at"] = attempt.At
+	}
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"notification_id": notificationID,
+			"status":          NotificationStatusPending,
+			"locked_until":    lockedUntil,
+		},
+		bson.M{
+			"$set": set,
+			"$push": bson.M{"attempts": bson.M{
+				"$each":  bson.A{attempt},
+				"$slice": -MaxNotificationAttemptsKept,
+			}},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("record notification attempt: %w", err)
+	}
+	if result == nil || result.MatchedCount == 0 {
+		return ErrNotificationLeaseLost
+	}
+
+	return nil
+}
+
+// Requeue resets the order's undelivered notifications to pending with a fresh
+// attempt budget, returning how many were matched. Delivered notifications are
+// never sent again.
+func (r *NotificationRepository) Requeue(ctx context.Context, orderID string) (int64, error) {
+	if err := r.check(ctx); err != nil {
+		return 0, err
+	}
+	if orderID == "" {
+		return 0, errors.New("order_id is required")
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result, err := r.collection.UpdateMany(ctx,
+		bson.M{"order_id": orderID, "status": bson.M{"$ne": NotificationStatusDelivered}},
+		bson.M{"$set": bson.M{
+			"status":          NotificationStatusPending,
+			"attempt_count":   0,
+			"next_attempt_at": now,
+			"locked_until":    time.Time{},
+			"updated_at":      now,
+		}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("requeue notifications: %w", err)
+	}
+	if result == nil {
+		return 0, nil
+	}
+
+	return result.MatchedCount, nil
+}
+
+// ListByOrder returns the order's notifications ordered by creation time.
+func (r *NotificationRepository) ListByOrder(ctx context.Context, orderID string) ([]Notification, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+	if orderID == "" {
+		return nil, errors.New("order_id is required")
+	}
+
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"order_id": orderID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find notifications: %w", err)
+	}
+
+	notifications := make([]Notification, 0)
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, fmt.Errorf("decode notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (r *NotificationRepository) check(ctx context.Context) error {
+	if r == nil || r.collection == nil {
+		return errors.New("notification repository is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestNotificationRepositoryEnqueue(t *testing.T) {
+	coll := &recordingNotificationCollection{upserted: 1}
+	repo := NewNotificationRepository(coll)
+
+	created, err := repo.Enqueue(context.Background(), Order{OrderID: "ord_1", MerchantID: "shop"}, NotificationEventOrderPaid)
+	if err != nil || !created {
+		t.Fatalf("expected notification to be created, got created=%v err=%v", created, err)
+	}
+
+	call := coll.lastUpdate(t)
+	if call.filter.(bson.M)["notification_id"] != "ord_1:order.paid" {
+		t.Fatalf("expected filter on notification_id, got %v", call.filter)
+	}
+	insert := call.update.(bson.M)["$setOnInsert"].(bson.M)
+	if insert["status"] != NotificationStatusPending || insert["merchant_id"] != "shop" || insert["event"] != NotificationEventOrderPaid {
+		t.Fatalf("unexpected inserted fields: %v", insert)
+	}
+	if call.opts == nil || call.opts.Upsert == nil || !*call.opts.Upsert {
+		t.Fatalf("expected enqueue to upsert")
+	}
+
+	coll.upserted = 0
+	if created, err := repo.Enqueue(context.Background(), Order{OrderID: "ord_1", MerchantID: "shop"}, NotificationEventOrderPaid); err != nil || created {
+		t.Fatalf("expected existing notification not to be recreated, got created=%v err=%v", created, err)
+	}
+
+	if _, err := repo.Enqueue(context.Background(), Order{OrderID: "ord_1"}, "order.created"); err == nil {
+		t.Fatalf("expected unknown event to be rejected")
+	}
+}
+
+func TestNotificationRepositoryClaimAndRecord(t *testing.T) {
+	coll := &recordingNotificationCollection{}
+	repo := NewNotificationRepository(coll)
+	ctx := context.Background()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if _, err := repo.ClaimDue(ctx, now, time.Minute); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments when nothing is due, got %v", err)
+	}
+	filter := coll.claimFilter
+	if filter["status"] != NotificationStatusPending {
+		t.Fatalf("expected claim to filter pending notifications, got %v", filter)
+	}
+	if lease := coll.claimUpdate["$set"].(bson.M)["locked_until"]; lease != now.Add(time.Minute) {
+		t.Fatalf("expected lease until %v, got %v", now.Add(time.Minute), lease)
+	}
+
+	lease := now.Add(time.Minute)
+	attempt := NotificationAttempt{Attempt: 2, At: now, HTTPStatus: 200, LatencyMs: 12}
+	if err := repo.RecordAttempt(ctx, "ord_1:order.paid", lease, attempt, NotificationStatusDelivered, now); !errors.Is(err, ErrNotificationLeaseLost) {
+		t.Fatalf("expected ErrNotificationLeaseLost when the lease no longer matches, got %v", err)
+	}
+
+	coll.matched = 1
+	if err := repo.RecordAttempt(ctx, "ord_1:order.paid", lease, attempt, NotificationStatusDelivered, now); err != nil {
+		t.Fatalf("RecordAttempt returned error: %v", err)
+	}
+	recordFilter := coll.lastUpdate(t).filter.(bson.M)
+	if recordFilter["status"] != NotificationStatusPending || recordFilter["locked_until"] != lease {
+		t.Fatalf("expected record to filter on the pending lease, got %v", recordFilter)
+	}
+	update := coll.lastUpdate(t).update.(bson.M)
+	set := update["$set"].(bson.M)
+	if set["status"] != NotificationStatusDelivered || set["attempt_count"] != 2 || set["delivered_at"] != now {
+		t.Fatalf("unexpected attempt fields: %v", set)
+	}
+	push := update["$push"].(bson.M)["attempts"].(bson.M)
+	if push["$slice"] != -MaxNotificationAttemptsKept {
+		t.Fatalf("expected attempt history to be bounded, got %v", push)
+	}
+
+	coll.matched = 2
+	count, err := repo.Requeue(ctx, "ord_1")
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2 requeued notifications, got %d err=%v", count, err)
+	}
+	if filter := coll.lastUpdate(t).filter.(bson.M); filter["status"].(bson.M)["$ne"] != NotificationStatusDelivered {
+		t.Fatalf("expected requeue to skip delivered notifications, got %v", filter)
+	}
+	requeue := coll.lastUpdate(t).update.(bson.M)["$set"].(bson.M)
+	if requeue["status"] != NotificationStatusPending || requeue["attempt_count"] != 0 {
+		t.Fatalf("expected requeue to reset status and attempts, got %v", requeue)
+	}
+}
+
+type updateCall struct {
+	filter interface{}
+	update interface{}
+	opts   *options.UpdateOptions
+}
+
+type recordingNotificationCollection struct {
+	updates     []updateCall
+	upserted    int64
+	matched     int64
+	claimFilter bson.M
+	claimUpdate bson.M
+}
+
+func (c *recordingNotificationCollection) UpdateOne(_ context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	call := updateCall{filter: filter, update: update}
+	if len(opts) > 0 {
+		call.opts = opts[0]
+	}
+	c.updates = append(c.updates, call)
+	return &mongo.UpdateResult{MatchedCount: c.matched, UpsertedCount: c.upserted}, nil
+}
+
+func (c *recordingNotificationCollection) UpdateMany(_ context.Context, filter interface{}, update interface{}, _ ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	c.updates = append(c.updates, updateCall{filter: filter, update: update})
+	return &mongo.UpdateResult{MatchedCount: c.matched}, nil
+}
+
+func (c *recordingNotificationCollection) FindOneAndUpdate(_ context.Context, filter interface{}, update interface{}, _ ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	c.claimFilter = filter.(bson.M)
+	c.claimUpdate = update.(bson.M)
+	return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+}
+
+func (c *recordingNotificationCollection) Find(context.Context, interface{}, ...*options.FindOptions) (*mongo.Cursor, error) {
+	return mongo.NewCursorFromDocuments(nil, nil, nil)
+}
+
+func (c *recordingNotificationCollection) lastUpdate(t *testing.T) updateCall {
+	t.Helper()
+	if len(c.updates) == 0 {
+		t.Fatalf("expected an update call")
+	}
+	return c.updates[len(c.updates)-1]
+}
@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Order statuses. An order starts as created, becomes pending once the payer
+// is sent to the channel, and settles as paid, failed or expired. Paid orders
+// may later be refunded. An expired order still becomes paid when a charge
+// arrives late, since the payer's money has already been taken.
+const (
+	OrderStatusCreated  = "created"
+	OrderStatusPending  = "pending"
+	OrderStatusPaid     = "paid"
+	OrderStatusFailed   = "failed"
+	OrderStatusExpired  = "expired"
+	OrderStatusRefunded = "refunded"
+)
+
+// CurrencyStars is the currency code of Telegram Stars, which are counted in
+// whole stars rather than minor units.
+const CurrencyStars = "XTR"
+
+var orderTransitions = map[string][]string{
+	OrderStatusCreated: {OrderStatusPending, OrderStatusFailed, OrderStatusExpired},
+	OrderStatusPending: {OrderStatusPaid, OrderStatusFailed, OrderStatusExpired},
+	OrderStatusPaid:    {OrderStatusRefunded},
+	OrderStatusExpired: {OrderStatusPaid},
+}
+
+var (
+	orderIDPattern     = regexp.MustCompile(`^[A-Za-z0-9_-]{6,64}$`)
+	channelCodePattern = regexp.MustCompile(`^[a-z0-9_-]{2,32}$`)
+)
+
+// ErrInvalidOrderTransition is matched by InvalidTransitionError values.
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+// ErrOrderStatusConflict is matched by StatusConflictError values.
+var ErrOrderStatusConflict = errors.New("order status changed concurrently")
+
+// ErrRefundInProgress is returned by OrderRepository.ClaimRefund when another
+// refund of the order has already been claimed.
+var ErrRefundInProgress = errors.New("order refund already in progress")
+
+// InvalidTransitionError is returned when a status change is not allowed by the
+// order state machine.
+type InvalidTransitionError struct {
+	OrderID string
+	From    string
+	To      string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("order %s: cannot transition from %q to %q", e.OrderID, e.From, e.To)
+}
+
+// Is reports whether the target is ErrInvalidOrderTransition.
+func (e *InvalidTransitionError) Is(target error) bool {
+	return target == ErrInvalidOrderTransition
+}
+
+// StatusConflictError is returned when an order was not in the expected status
+// at update time, typically because a concurrent update already moved it.
+type StatusConflictError struct {
+	OrderID  string
+	Expected string
+	Actual   string
+}
+
+func (e *StatusConflictError) Error() string {
+	return fmt.Sprintf("order %s: expected status %q, found %q", e.OrderID, e.Expected, e.Actual)
+}
+
+// Is reports whether the target is ErrOrderStatusConflict.
+func (e *StatusConflictError) Is(target error) bool {
+	return target == ErrOrderStatusConflict
+}
+
+// Order represents a payment order placed for a merchant. Amounts are stored
+// in minor units of Currency (e.g. cents).
+type Order struct {
+	OrderID     string `bson:"order_id" json:"order_id"`
+	MerchantID  string `bson:"merchant_id" json:"merchant_id"`
+	AmountMinor int64  `bson:"amount_minor" json:"amount_minor"`
+	Currency    string `bson:"currency" json:"currency"`
+	Payer       string `bson:"payer,omitempty" json:"payer,omitempty"`
+	Channel     string `bson:"channel" json:"channel"`
+	ChannelRef  string `bson:"channel_ref,omitempty" json:"channel_ref,omitempty"`
+	// Adapter and CredentialSet identify the payment adapter and the
+	// channel credentials that handled the order; both are empty for
+	// Telegram invoices.
+	Adapter       string `bson:"adapter,omitempty" json:"adapter,omitempty"`
+	CredentialSet string `bson:"credential_set,omitempty" json:"credential_set,omitempty"`
+	// TelegramChargeID and ProviderChargeID identify a payment made through
+	// a Telegram invoice; the provider ID is empty for Stars payments.
+	TelegramChargeID string `bson:"telegram_payment_charge_id,omitempty" json:"telegram_payment_charge_id,omitempty"`
+	ProviderChargeID string `bson:"provider_payment_charge_id,omitempty" json:"provider_payment_charge_id,omitempty"`
+	// PayerUserID is the Telegram user who paid an invoice; Stars refunds
+	// are sent back to them.
+	PayerUserID int64      `bson:"payer_user_id,omitempty" json:"payer_user_id,omitempty"`
+	Status      string     `bson:"status" json:"status"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+	PendingAt   *time.Time `bson:"pending_at,omitempty" json:"pending_at,omitempty"`
+	PaidAt      *time.Time `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	FailedAt    *time.Time `bson:"failed_at,omitempty" json:"failed_at,omitempty"`
+	ExpiredAt   *time.Time `bson:"expired_at,omitempty" json:"expired_at,omitempty"`
+	RefundedAt  *time.Time `bson:"refunded_at,omitempty" json:"refunded_at,omitempty"`
+	// RefundStartedAt is set while a channel refund of the paid order is in
+	// flight, so concurrent refund requests cannot reach the channel twice.
+	RefundStartedAt *time.Time `bson:"refund_started_at,omitempty" json:"refund_started_at,omitempty"`
+}
+
+// Validate checks the order fields required before persisting.
+func (o Order) Validate() error {
+	if !orderIDPattern.MatchString(o.OrderID) {
+		return fmt.Errorf("invalid order_id %q: use 6-64 characters of A-Z, a-z, 0-9, _ and -", o.OrderID)
+	}
+	if !merchantIDPattern.MatchString(o.MerchantID) {
+		return fmt.Errorf("invalid merchant_id %q", o.MerchantID)
+	}
+	if o.AmountMinor <= 0 {
+		return fmt.Errorf("invalid amount %d: must be positive", o.AmountMinor)
+	}
+	if !currencyPattern.MatchString(o.Currency) {
+		return fmt.Errorf("invalid currency %q: use 3-5 uppercase letters", o.Currency)
+	}
+	if !channelCodePattern.MatchString(o.Channel) {
+		return fmt.Errorf("invalid channel %q: use 2-32 characters of a-z, 0-9, _ and -", o.Channel)
+	}
+	if !IsOrderStatus(o.Status) {
+		return fmt.Errorf("invalid order status %q", o.Status)
+	}
+
+	return nil
+}
+
+// HasReached reports whether the order holds status or passed through it
+// earlier, going by the timestamp recorded when entering each status.
+func (o Order) HasReached(status string) bool {
+	if o.Status == status {
+		return true
+	}
+
+	switch status {
+	case OrderStatusPending:
+		return o.PendingAt != nil
+	case OrderStatusPaid:
+		return o.PaidAt != nil
+	case OrderStatusFailed:
+		return o.FailedAt != nil
+	case OrderStatusExpired:
+		return o.ExpiredAt != nil
+	case OrderStatusRefunded:
+		return o.RefundedAt != nil
+	default:
+		return false
+	}
+}
+
+// IsOrderStatus reports whether status is a known order status.
+func IsOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusCreated, OrderStatusPending, OrderStatusPaid,
+		OrderStatusFailed, OrderStatusExpired, OrderStatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanTransitionOrder reports whether the state machine allows moving an order
+// from one status to another.
+func CanTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsFinalOrderStatus reports whether no further transitions are possible.
+func IsFinalOrderStatus(status string) bool {
+	return IsOrderStatus(status) && len(orderTransitions[status]) == 0
+}
+
+// NewOrderID returns a random order identifier prefixed with "ord_".
+func NewOrderID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate order id: %w", err)
+	}
+
+	return "ord_" + hex.EncodeToString(buf), nil
+}
+
+// NormalizeChannelCode trims and lowercases a payment channel code.
+func NormalizeChannelCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// orderStatusTimeField returns the timestamp field set when entering status.
+func orderStatusTimeField(status string) string {
+	switch status {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusFailed, OrderStatusExpired, OrderStatusRefunded:
+		return status + "_at"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,467 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+type orderCollection interface {
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+}
+
+// OrderTransition describes a status change applied by
+// OrderRepository.Transition.
+type OrderTransition struct {
+	OrderID string
+	// From is the status the order must currently hold for the update to apply.
+	From string
+	To   string
+	// ChannelRef optionally records the upstream channel's reference.
+	ChannelRef string
+	// TelegramChargeID and ProviderChargeID optionally record the charge IDs
+	// of a Telegram invoice payment.
+	TelegramChargeID string
+	ProviderChargeID string
+	// PayerUserID optionally records the Telegram user who paid.
+	PayerUserID int64
+	// Reason is logged with the transition event.
+	Reason string
+}
+
+// OrderTransitionListener is called inside the transaction that applies a
+// transition, with ctx carrying its session. from is the status the order held
+// before the change. Returning an error rolls the transition back.
+type OrderTransitionListener func(ctx context.Context, order Order, from string) error
+
+// transactor runs fn atomically. store.Manager satisfies it with a MongoDB
+// multi-document transaction.
+type transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// OrderRepository persists orders and applies state machine transitions in
+// MongoDB.
+type OrderRepository struct {
+	collection orderCollection
+	tx         transactor
+	logger     *logrus.Entry
+	listeners  []OrderTransitionListener
+}
+
+// NewOrderRepository constructs an OrderRepository. tx commits a transition
+// together with the writes of its listeners. Transition events are logged
+// through logger.
+func NewOrderRepository(collection orderCollection, tx transactor, logger *logrus.Entry) *OrderRepository {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &OrderRepository{
+		collection: collection,
+		tx:         tx,
+		logger:     logger,
+	}
+}
+
+// OnTransition registers a listener invoked with every successful transition,
+// in the same transaction. Listeners must be registered before the repository
+// is shared between goroutines.
+func (r *OrderRepository) OnTransition(listener OrderTransitionListener) {
+	if r == nil || listener == nil {
+		return
+	}
+
+	r.listeners = append(r.listeners, listener)
+}
+
+// Create validates and inserts a new order in the created status, generating
+// an order ID when omitted.
+func (r *OrderRepository) Create(ctx context.Context, order Order) (Order, error) {
+	if r == nil || r.collection == nil {
+		return Order{}, errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return Order{}, errors.New("context is required")
+	}
+
+	order.OrderID = strings.TrimSpace(order.OrderID)
+	if order.OrderID == "" {
+		id, err := NewOrderID()
+		if err != nil {
+			return Order{}, err
+		}
+		order.OrderID = id
+	}
+	order.MerchantID = NormalizeMerchantID(order.MerchantID)
+	order.Currency = strings.ToUpper(strings.TrimSpace(order.Currency))
+	order.Channel = NormalizeChannelCode(order.Channel)
+	order.Adapter = strings.TrimSpace(order.Adapter)
+	order.CredentialSet = strings.TrimSpace(order.CredentialSet)
+	order.Payer = strings.TrimSpace(order.Payer)
+	order.Status = OrderStatusCreated
+
+	if err := order.Validate(); err != nil {
+		return Order{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	if _, err := r.collection.InsertOne(ctx, order); err != nil {
+		return Order{}, fmt.Errorf("insert order: %w", err)
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":        "order_created",
+		"order_id":     order.OrderID,
+		"merchant_id":  order.MerchantID,
+		"amount_minor": order.AmountMinor,
+		"currency":     order.Currency,
+		"channel":      order.Channel,
+		"adapter":      order.Adapter,
+	}).Info("created order")
+
+	return order, nil
+}
+
+// GetByID fetches an order by order_id.
+func (r *OrderRepository) GetByID(ctx context.Context, orderID string) (Order, error) {
+	if r == nil || r.collection == nil {
+		return Order{}, errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return Order{}, errors.New("context is required")
+	}
+	orderID = strings.TrimSpace(orderID)
+	if orderID == "" {
+		return Order{}, errors.New("order_id is required")
+	}
+
+	return r.findOne(ctx, bson.M{"order_id": orderID})
+}
+
+// ListExpirable returns up to limit created or pending orders created before
+// createdBefore, oldest first.
+func (r *OrderRepository) ListExpirable(ctx context.Context, createdBefore time.Time, limit int64) ([]Order, error) {
+	if r == nil || r.collection == nil {
+		return nil, errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return nil, errors.New("context is required")
+	}
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+
+	cursor, err := r.collection.Find(ctx,
+		bson.M{
+			"status":     bson.M{"$in": bson.A{OrderStatusCreated, OrderStatusPending}},
+			"created_at": bson.M{"$lt": createdBefore},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find expirable orders: %w", err)
+	}
+
+	orders := make([]Order, 0)
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// GetByTelegramChargeID fetches the order paid with the given Telegram
+// payment charge ID.
+func (r *OrderRepository) GetByTelegramChargeID(ctx context.Context, chargeID string) (Order, error) {
+	if r == nil || r.collection == nil {
+		return Order{}, errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return Order{}, errors.New("context is required")
+	}
+	chargeID = strings.TrimSpace(chargeID)
+	if chargeID == "" {
+		return Order{}, errors.New("telegram_payment_charge_id is required")
+	}
+
+	return r.findOne(ctx, bson.M{"telegram_payment_charge_id": chargeID})
+}
+
+func (r *OrderRepository) findOne(ctx context.Context, filter bson.M) (Order, error) {
+	result := r.collection.FindOne(ctx, filter)
+	if result == nil {
+		return Order{}, errors.New("find order returned no result")
+	}
+	if err := result.Err(); err != nil {
+		return Order{}, fmt.Errorf("find order: %w", err)
+	}
+
+	var order Order
+	if err := result.Decode(&order); err != nil {
+		return Order{}, fmt.Errorf("decode order: %w", err)
+	}
+
+	return order, nil
+}
+
+// SetChannelRef records the upstream channel's reference on an order that has
+// none yet, whatever its status. It covers orders a callback moved on before
+// the channel's answer to the create request was recorded. An order that
+// already has a reference is returned unchanged.
+func (r *OrderRepository) SetChannelRef(ctx context.Context, orderID, channelRef string) (Order, error) {
+	if r == nil || r.collection == nil {
+		return Order{}, errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return Order{}, errors.New("context is required")
+	}
+	orderID = strings.TrimSpace(orderID)
+	if orderID == "" {
+		return Order{}, errors.New("order_id is required")
+	}
+	channelRef = strings.TrimSpace(channelRef)
+	if channelRef == "" {
+		return Order{}, errors.New("channel_ref is required")
+	}
+
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"order_id": orderID, "channel_ref": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"$set": bson.M{
+			"channel_ref": channelRef,
+			"updated_at":  time.Now().UTC().Truncate(time.Millisecond),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return Order{}, errors.New("set channel_ref returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return r.GetByID(ctx, orderID)
+		}
+		return Order{}, fmt.Errorf("set channel_ref: %w", err)
+	}
+
+	var order Order
+	if err := result.Decode(&order); err != nil {
+		return Order{}, fmt.Errorf("decode order: %w", err)
+	}
+
+	return order, nil
+}
+
+// ClaimRefund marks a paid order as being refunded. Only one caller can hold
+// the claim: a paid order already claimed returns ErrRefundInProgress, and an
+// order that is no longer paid returns a *StatusConflictError. Both return the
+// current order.
+func (r *OrderRepository) ClaimRefund(ctx context.Context, orderID string) (Order, error) {
+	if r == nil || r.collection == nil {
+		return Order{}, errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return Order{}, errors.New("context is required")
+	}
+	orderID = strings.TrimSpace(orderID)
+	if orderID == "" {
+		return Order{}, errors.New("order_id is required")
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"order_id": orderID, "status": OrderStatusPaid, "refund_started_at": bson.M{"$in": bson.A{nil}}},
+		bson.M{"$set": bson.M{
+			"refund_started_at": now,
+			"updated_at":        now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return Order{}, errors.New("claim refund returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return Order{}, fmt.Errorf("claim refund: %w", err)
+		}
+
+		current, getErr := r.GetByID(ctx, orderID)
+		if getErr != nil {
+			return Order{}, getErr
+		}
+		if current.Status == OrderStatusPaid {
+			return current, ErrRefundInProgress
+		}
+		return current, &StatusConflictError{OrderID: orderID, Expected: OrderStatusPaid, Actual: current.Status}
+	}
+
+	var order Order
+	if err := result.Decode(&order); err != nil {
+		return Order{}, fmt.Errorf("decode order: %w", err)
+	}
+
+	return order, nil
+}
+
+// ReleaseRefund drops the refund claim of an order that is still paid, so a
+// refund the channel did not carry out can be retried.
+func (r *OrderRepository) ReleaseRefund(ctx context.Context, orderID string) error {
+	if r == nil || r.collection == nil {
+		return errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	orderID = strings.TrimSpace(orderID)
+	if orderID == "" {
+		return errors.New("order_id is required")
+	}
+
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"order_id": orderID, "status": OrderStatusPaid},
+		bson.M{
+			"$unset": bson.M{"refund_started_at": ""},
+			"$set":   bson.M{"updated_at": time.Now().UTC().Truncate(time.Millisecond)},
+		},
+	)
+	if result == nil {
+		return errors.New("release refund returned no result")
+	}
+	if err := result.Err(); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("release refund: %w", err)
+	}
+
+	return nil
+}
+
+// Transition moves an order from t.From to t.To with a conditional update that
+// only matches while the order still holds t.From, so concurrent callers
+// cannot apply the same transition twice. Illegal transitions return an
+// *InvalidTransitionError; orders no longer in t.From return a
+// *StatusConflictError carrying the current status. Listeners run in the same
+// transaction as the update, so their writes commit or roll back with it.
+func (r *OrderRepository) Transition(ctx context.Context, t OrderTransition) (Order, error) {
+	if r == nil || r.collection == nil {
+		return Order{}, errors.New("order repository is not initialized")
+	}
+	if ctx == nil {
+		return Order{}, errors.New("context is required")
+	}
+	t.OrderID = strings.TrimSpace(t.OrderID)
+	if t.OrderID == "" {
+		return Order{}, errors.New("order_id is required")
+	}
+
+	fields := logging.Fields{
+		"order_id": t.OrderID,
+		"from":     t.From,
+		"to":       t.To,
+	}
+	if t.Reason != "" {
+		fields["reason"] = t.Reason
+	}
+
+	if !CanTransitionOrder(t.From, t.To) {
+		fields["event"] = "order_transition_rejected"
+		r.logger.WithFields(fields).Warn("rejected illegal order transition")
+		return Order{}, &InvalidTransitionError{OrderID: t.OrderID, From: t.From, To: t.To}
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	set := bson.M{
+		"status":                   t.To,
+		"updated_at":               now,
+		orderStatusTimeField(t.To): now,
+	}
+	if ref := strings.TrimSpace(t.ChannelRef); ref != "" {
+		set["channel_ref"] = ref
+	}
+	if id := strings.TrimSpace(t.TelegramChargeID); id != "" {
+		set["telegram_payment_charge_id"] = id
+	}
+	if id := strings.TrimSpace(t.ProviderChargeID); id != "" {
+		set["provider_payment_charge_id"] = id
+	}
+	if t.PayerUserID != 0 {
+		set["payer_user_id"] = t.PayerUserID
+	}
+
+	var order Order
+	apply := func(ctx context.Context) error {
+		result := r.collection.FindOneAndUpdate(ctx,
+			bson.M{"order_id": t.OrderID, "status": t.From},
+			bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		)
+		if result == nil {
+			return errors.New("transition order returned no result")
+		}
+		if err := result.Err(); err != nil {
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				return fmt.Errorf("transition order: %w", err)
+			}
+
+			current, getErr := r.GetByID(ctx, t.OrderID)
+			if getErr != nil {
+				return getErr
+			}
+			order = current
+			return &StatusConflictError{OrderID: t.OrderID, Expected: t.From, Actual: current.Status}
+		}
+
+		if err := result.Decode(&order); err != nil {
+			return fmt.Errorf("decode order: %w", err)
+		}
+
+		for _, listener := range r.listeners {
+			if err := listener(ctx, order, t.From); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var err error
+	switch {
+	case len(r.listeners) == 0:
+		err = apply(ctx)
+	case r.tx == nil:
+		return Order{}, errors.New("order repository transactor is not configured")
+	default:
+		err = r.tx.WithTransaction(ctx, apply)
+	}
+
+	var conflict *StatusConflictError
+	if errors.As(err, &conflict) {
+		fields["event"] = "order_transition_conflict"
+		fields["actual"] = conflict.Actual
+		r.logger.WithFields(fields).Warn("order status changed before transition")
+		return order, err
+	}
+	if err != nil {
+		return Order{}, err
+	}
+
+	fields["event"] = "order_transition"
+	fields["merchant_id"] = order.MerchantID
+	r.logger.WithFields(fields).Info("order status changed")
+
+	return order, nil
+}
@@ -0,0 +1,480 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+	allowed := map[string][]string{
+		OrderStatusCreated: {OrderStatusPending, OrderStatusFailed, OrderStatusExpired},
+		OrderStatusPending: {OrderStatusPaid, OrderStatusFailed, OrderStatusExpired},
+		OrderStatusPaid:    {OrderStatusRefunded},
+		OrderStatusExpired: {OrderStatusPaid},
+	}
+	statuses := []string{OrderStatusCreated, OrderStatusPending, OrderStatusPaid, OrderStatusFailed, OrderStatusExpired, OrderStatusRefunded}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := false
+			for _, next := range allowed[from] {
+				if next == to {
+					want = true
+				}
+			}
+			if got := CanTransitionOrder(from, to); got != want {
+				t.Fatalf("CanTransitionOrder(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	for _, status := range []string{OrderStatusFailed, OrderStatusRefunded} {
+		if !IsFinalOrderStatus(status) {
+			t.Fatalf("expected %s to be final", status)
+		}
+	}
+	if IsFinalOrderStatus(OrderStatusPaid) || IsFinalOrderStatus(OrderStatusExpired) || IsFinalOrderStatus("unknown") {
+		t.Fatalf("expected paid, expired and unknown statuses not to be final")
+	}
+}
+
+func TestOrderRepositoryCreate(t *testing.T) {
+	coll := newFakeOrderCollection(t)
+	hookLogger, hook := logtest.NewNullLogger()
+	repo := NewOrderRepository(coll, nil, logrus.NewEntry(hookLogger))
+
+	created, err := repo.Create(context.Background(), Order{
+		MerchantID:  " Shop_01 ",
+		AmountMinor: 1250,
+		Currency:    "usd",
+		Channel:     "Mock",
+		Payer:       " 42 ",
+		Status:      OrderStatusPaid,
+	})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if created.OrderID == "" || created.MerchantID != "shop_01" || created.Currency != "USD" || created.Channel != "mock" || created.Payer != "42" {
+		t.Fatalf("expected normalized order, got %+v", created)
+	}
+	if created.Status != OrderStatusCreated {
+		t.Fatalf("expected new orders to start as %s, got %s", OrderStatusCreated, created.Status)
+	}
+	if coll.docs[created.OrderID] == nil {
+		t.Fatalf("expected order document to be stored")
+	}
+	if entry := findLogEvent(hook.AllEntries(), "order_created"); entry == nil || entry.Data["order_id"] != created.OrderID {
+		t.Fatalf("expected order_created log keyed by order_id")
+	}
+
+	invalid := []Order{
+		{MerchantID: "shop_01", AmountMinor: 0, Currency: "USD", Channel: "mock"},
+		{MerchantID: "x", AmountMinor: 1, Currency: "USD", Channel: "mock"},
+		{MerchantID: "shop_01", AmountMinor: 1, Currency: "US", Channel: "mock"},
+		{MerchantID: "shop_01", AmountMinor: 1, Currency: "USD"},
+		{OrderID: "bad id", MerchantID: "shop_01", AmountMinor: 1, Currency: "USD", Channel: "mock"},
+	}
+	for _, order := range invalid {
+		if _, err := repo.Create(context.Background(), order); err == nil {
+			t.Fatalf("expected validation error for %+v", order)
+		}
+	}
+}
+
+func TestOrderRepositoryTransition(t *testing.T) {
+	coll := newFakeOrderCollection(t)
+	hookLogger, hook := logtest.NewNullLogger()
+	repo := NewOrderRepository(coll, &fakeOrderTransactor{coll: coll}, logrus.NewEntry(hookLogger))
+	ctx := context.Background()
+
+	var observed []string
+	repo.OnTransition(func(_ context.Context, order Order, from string) error {
+		observed = append(observed, from+"->"+order.Status)
+		return nil
+	})
+
+	order, err := repo.Create(ctx, Order{OrderID: "ord_test1", MerchantID: "shop", AmountMinor: 100, Currency: "USD", Channel: "mock"})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	pending, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusCreated, To: OrderStatusPending})
+	if err != nil {
+		t.Fatalf("Transition to pending returned error: %v", err)
+	}
+	if pending.Status != OrderStatusPending || pending.PendingAt == nil {
+		t.Fatalf("expected pending order with pending_at, got %+v", pending)
+	}
+
+	paid, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusPending, To: OrderStatusPaid, ChannelRef: "up-1", TelegramChargeID: "tg-1", ProviderChargeID: "prov-1", PayerUserID: 42})
+	if err != nil {
+		t.Fatalf("Transition to paid returned error: %v", err)
+	}
+	if paid.Status != OrderStatusPaid || paid.PaidAt == nil || paid.ChannelRef != "up-1" || paid.TelegramChargeID != "tg-1" || paid.ProviderChargeID != "prov-1" {
+		t.Fatalf("expected paid order with paid_at, channel_ref and charge ids, got %+v", paid)
+	}
+	if byCharge, err := repo.GetByTelegramChargeID(ctx, "tg-1"); err != nil || byCharge.OrderID != order.OrderID || byCharge.PayerUserID != 42 {
+		t.Fatalf("expected lookup by charge id to find the order with its payer, got %+v err=%v", byCharge, err)
+	}
+	if _, err := repo.GetByTelegramChargeID(ctx, "tg-missing"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for unknown charge id, got %v", err)
+	}
+
+	entry := findLogEvent(hook.AllEntries(), "order_transition")
+	if entry == nil || entry.Data["order_id"] != order.OrderID || entry.Data["merchant_id"] != "shop" {
+		t.Fatalf("expected order_transition log keyed by order_id, got %+v", entry)
+	}
+
+	_, err = repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusPaid, To: OrderStatusPending})
+	var invalid *InvalidTransitionError
+	if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Fatalf("expected InvalidTransitionError, got %v", err)
+	}
+	if findLogEvent(hook.AllEntries(), "order_transition_rejected") == nil {
+		t.Fatalf("expected order_transition_rejected log entry")
+	}
+
+	current, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusPending, To: OrderStatusPaid})
+	var conflict *StatusConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrOrderStatusConflict) {
+		t.Fatalf("expected StatusConflictError on replay, got %v", err)
+	}
+	if conflict.Actual != OrderStatusPaid || current.Status != OrderStatusPaid {
+		t.Fatalf("expected conflict to report current status paid, got %+v / %+v", conflict, current)
+	}
+
+	if _, err := repo.Transition(ctx, OrderTransition{OrderID: "ord_missing", From: OrderStatusCreated, To: OrderStatusPending}); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for unknown order, got %v", err)
+	}
+
+	if len(observed) != 2 || observed[0] != "created->pending" || observed[1] != "pending->paid" {
+		t.Fatalf("expected listeners to observe only applied transitions, got %v", observed)
+	}
+}
+
+func TestOrderRepositorySetChannelRefKeepsExistingRef(t *testing.T) {
+	coll := newFakeOrderCollection(t)
+	repo := NewOrderRepository(coll, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	order, err := repo.Create(ctx, Order{OrderID: "ord_ref1", MerchantID: "shop", AmountMinor: 100, Currency: "USD", Channel: "mock"})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if _, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusCreated, To: OrderStatusPending}); err != nil {
+		t.Fatalf("Transition returned error: %v", err)
+	}
+
+	updated, err := repo.SetChannelRef(ctx, order.OrderID, " up-1 ")
+	if err != nil || updated.ChannelRef != "up-1" || updated.Status != OrderStatusPending {
+		t.Fatalf("expected channel_ref on the pending order, got %+v err=%v", updated, err)
+	}
+	kept, err := repo.SetChannelRef(ctx, order.OrderID, "up-2")
+	if err != nil || kept.ChannelRef != "up-1" {
+		t.Fatalf("expected the first channel_ref to be kept, got %+v err=%v", kept, err)
+	}
+	if _, err := repo.SetChannelRef(ctx, "ord_missing", "up-3"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for unknown order, got %v", err)
+	}
+	if _, err := repo.SetChannelRef(ctx, order.OrderID, " "); err == nil {
+		t.Fatalf("expected empty channel_ref to be rejected")
+	}
+}
+
+func TestOrderRepositoryClaimRefundOnce(t *testing.T) {
+	coll := newFakeOrderCollection(t)
+	repo := NewOrderRepository(coll, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	order, err := repo.Create(ctx, Order{OrderID: "ord_refund1", MerchantID: "shop", AmountMinor: 100, Currency: "USD", Channel: "mock"})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if _, err := repo.ClaimRefund(ctx, order.OrderID); !errors.Is(err, ErrOrderStatusConflict) {
+		t.Fatalf("expected unpaid order not to be claimed, got %v", err)
+	}
+	for _, step := range []OrderTransition{
+		{OrderID: order.OrderID, From: OrderStatusCreated, To: OrderStatusPending},
+		{OrderID: order.OrderID, From: OrderStatusPending, To: OrderStatusPaid},
+	} {
+		if _, err := repo.Transition(ctx, step); err != nil {
+			t.Fatalf("Transition returned error: %v", err)
+		}
+	}
+
+	claimed, err := repo.ClaimRefund(ctx, order.OrderID)
+	if err != nil || claimed.RefundStartedAt == nil {
+		t.Fatalf("expected refund claim, got %+v err=%v", claimed, err)
+	}
+	if _, err := repo.ClaimRefund(ctx, order.OrderID); !errors.Is(err, ErrRefundInProgress) {
+		t.Fatalf("expected second claim to be refused, got %v", err)
+	}
+
+	if err := repo.ReleaseRefund(ctx, order.OrderID); err != nil {
+		t.Fatalf("ReleaseRefund returned error: %v", err)
+	}
+	if _, err := repo.ClaimRefund(ctx, order.OrderID); err != nil {
+		t.Fatalf("expected released order to be claimable again, got %v", err)
+	}
+}
+
+func TestOrderRepositoryListExpirable(t *testing.T) {
+	coll := newFakeOrderCollection(t)
+	repo := NewOrderRepository(coll, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for i, status := range []string{OrderStatusCreated, OrderStatusPending, OrderStatusPaid, OrderStatusPending} {
+		id := fmt.Sprintf("ord_exp%03d", i)
+		if _, err := repo.Create(ctx, Order{OrderID: id, MerchantID: "shop", AmountMinor: 100, Currency: "USD", Channel: "mock"}); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		coll.docs[id]["status"] = status
+		coll.docs[id]["created_at"] = now.Add(-time.Duration(4-i) * time.Hour)
+	}
+	// The last pending order is still within the TTL.
+	coll.docs["ord_exp003"]["created_at"] = now
+
+	orders, err := repo.ListExpirable(ctx, now.Add(-time.Minute), 10)
+	if err != nil {
+		t.Fatalf("ListExpirable returned error: %v", err)
+	}
+	if len(orders) != 2 || orders[0].OrderID != "ord_exp000" || orders[1].OrderID != "ord_exp001" {
+		t.Fatalf("expected the stale created and pending orders oldest first, got %+v", orders)
+	}
+
+	if orders, err := repo.ListExpirable(ctx, now.Add(-time.Minute), 1); err != nil || len(orders) != 1 {
+		t.Fatalf("expected limit to cap the batch, got %+v err=%v", orders, err)
+	}
+	if _, err := repo.ListExpirable(ctx, now, 0); err == nil {
+		t.Fatalf("expected non-positive limit to be rejected")
+	}
+}
+
+func TestOrderRepositoryTransitionRollsBackOnListenerError(t *testing.T) {
+	coll := newFakeOrderCollection(t)
+	repo := NewOrderRepository(coll, &fakeOrderTransactor{coll: coll}, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	listenerErr := errors.New("journal insert failed")
+	repo.OnTransition(func(_ context.Context, order Order, _ string) error {
+		if order.Status == OrderStatusPaid {
+			return listenerErr
+		}
+		return nil
+	})
+
+	order, err := repo.Create(ctx, Order{OrderID: "ord_rollback1", MerchantID: "shop", AmountMinor: 100, Currency: "USD", Channel: "mock"})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if _, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusCreated, To: OrderStatusPending}); err != nil {
+		t.Fatalf("Transition to pending returned error: %v", err)
+	}
+
+	if _, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusPending, To: OrderStatusPaid}); !errors.Is(err, listenerErr) {
+		t.Fatalf("expected listener error, got %v", err)
+	}
+	if current, _ := repo.GetByID(ctx, order.OrderID); current.Status != OrderStatusPending {
+		t.Fatalf("expected failed listener to roll the transition back, got %s", current.Status)
+	}
+
+	if _, err := NewOrderRepository(coll, nil, nil).Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusPending, To: OrderStatusPaid}); err != nil {
+		t.Fatalf("expected transition without listeners to need no transactor, got %v", err)
+	}
+	repo.tx = nil
+	if _, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusPaid, To: OrderStatusRefunded}); err == nil {
+		t.Fatalf("expected listeners without a transactor to be refused")
+	}
+}
+
+func TestOrderRepositoryTransitionAppliesOnce(t *testing.T) {
+	coll := newFakeOrderCollection(t)
+	repo := NewOrderRepository(coll, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	order, err := repo.Create(ctx, Order{OrderID: "ord_race1", MerchantID: "shop", AmountMinor: 100, Currency: "USD", Channel: "mock"})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if _, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusCreated, To: OrderStatusPending}); err != nil {
+		t.Fatalf("Transition returned error: %v", err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		conflicts int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Transition(ctx, OrderTransition{OrderID: order.OrderID, From: OrderStatusPending, To: OrderStatusPaid})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrOrderStatusConflict):
+				conflicts++
+			default:
+				t.Errorf("unexpected transition error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 || conflicts != 7 {
+		t.Fatalf("expected exactly one transition to apply, got %d successes and %d conflicts", succeeded, conflicts)
+	}
+}
+
+type fakeOrderCollection struct {
+	t    *testing.T
+	mu   sync.Mutex
+	docs map[string]bson.M
+}
+
+func newFakeOrderCollection(t *testing.T) *fakeOrderCollection {
+	t.Helper()
+	return &fakeOrderCollection{t: t, docs: make(map[string]bson.M)}
+}
+
+func (f *fakeOrderCollection) InsertOne(_ context.Context, document interface{}, _ ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc := marshalDoc(f.t, document)
+	id, _ := doc["order_id"].(string)
+	if _, exists := f.docs[id]; exists {
+		return nil, fmt.Errorf("duplicate order_id %s", id)
+	}
+
+	f.docs[id] = doc
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+func (f *fakeOrderCollection) FindOne(_ context.Context, filter interface{}, _ ...*options.FindOneOptions) *mongo.SingleResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc := f.match(filter.(bson.M))
+	if doc == nil {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (f *fakeOrderCollection) Find(_ context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	matched := make([]interface{}, 0)
+	for _, doc := range f.docs {
+		if matchesFilter(doc, filter.(bson.M)) {
+			matched = append(matched, doc)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return timeBefore(matched[i].(bson.M)["created_at"], matched[j].(bson.M)["created_at"])
+	})
+	if len(opts) > 0 && opts[0].Limit != nil && int64(len(matched)) > *opts[0].Limit {
+		matched = matched[:*opts[0].Limit]
+	}
+
+	return mongo.NewCursorFromDocuments(matched, nil, nil)
+}
+
+func (f *fakeOrderCollection) FindOneAndUpdate(_ context.Context, filter interface{}, update interface{}, _ ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	doc := f.match(filter.(bson.M))
+	if doc == nil {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+
+	if set, ok := update.(bson.M)["$set"].(bson.M); ok {
+		for field, value := range set {
+			doc[field] = value
+		}
+	}
+	if unset, ok := update.(bson.M)["$unset"].(bson.M); ok {
+		for field := range unset {
+			delete(doc, field)
+		}
+	}
+
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+// fakeOrderTransactor restores the collection's documents when fn fails.
+type fakeOrderTransactor struct {
+	coll *fakeOrderCollection
+}
+
+func (f *fakeOrderTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.coll.mu.Lock()
+	snapshot := make(map[string]bson.M, len(f.coll.docs))
+	for id, doc := range f.coll.docs {
+		copied := make(bson.M, len(doc))
+		for field, value := range doc {
+			copied[field] = value
+		}
+		snapshot[id] = copied
+	}
+	f.coll.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		f.coll.mu.Lock()
+		f.coll.docs = snapshot
+		f.coll.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (f *fakeOrderCollection) match(filter bson.M) bson.M {
+	id, ok := filter["order_id"].(string)
+	if !ok {
+		for _, doc := range f.docs {
+			if matchesFilter(doc, filter) {
+				return doc
+			}
+		}
+		return nil
+	}
+
+	doc := f.docs[id]
+	if doc == nil || !matchesFilter(doc, filter) {
+		return nil
+	}
+
+	return doc
+}
+
+func findLogEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+
+	return nil
+}
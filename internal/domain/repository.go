@@ -14,15 +14,21 @@ import (
 type insertFindCollection interface {
 	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
 	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+}
+
+type userCollection interface {
+	insertFindCollection
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
 }
 
 // UserRepository persists and retrieves users in MongoDB.
 type UserRepository struct {
-	collection insertFindCollection
+	collection userCollection
 }
 
 // NewUserRepository constructs a UserRepository.
-func NewUserRepository(collection insertFindCollection) *UserRepository {
+func NewUserRepository(collection userCollection) *UserRepository {
 	return &UserRepository{collection: collection}
 }
 
@@ -86,6 +92,154 @@ func (r *UserRepository) GetByID(ctx context.Context, userID int64) (User, error
 	return user, nil
 }
 
+// GetByUsername fetches a user by Telegram username, ignoring case and a
+// leading "@". A username is only known once the user has messaged the bot.
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (User, error) {
+	if r == nil || r.collection == nil {
+		return User{}, errors.New("user repository is not initialized")
+	}
+	if ctx == nil {
+		return User{}, errors.New("context is required")
+	}
+	normalized := NormalizeUsername(username)
+	if normalized == "" {
+		return User{}, errors.New("username is required")
+	}
+
+	result := r.collection.FindOne(ctx, bson.M{"username_lower": normalized})
+	if result == nil {
+		return User{}, errors.New("find user returned no result")
+	}
+	if err := result.Err(); err != nil {
+		return User{}, fmt.Errorf("find user by username: %w", err)
+	}
+
+	var user User
+	if err := result.Decode(&user); err != nil {
+		return User{}, fmt.Errorf("decode user: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListByRole returns all users holding the given role ordered by user_id.
+func (r *UserRepository) ListByRole(ctx context.Context, role string) ([]User, error) {
+	if r == nil || r.collection == nil {
+		return nil, errors.New("user repository is not initialized")
+	}
+	if ctx == nil {
+		return nil, errors.New("context is required")
+	}
+	if RolePriority(role) == 0 {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"role": role},
+		options.Find().SetSort(bson.D{{Key: "user_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find users by role: %w", err)
+	}
+
+	users := make([]User, 0)
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("decode users by role: %w", err)
+	}
+
+	return users, nil
+}
+
+// UpdateRole moves a user from one role to another, appending the change to
+// the bounded role history. The update is conditional on the current role so
+// concurrent changes cannot overwrite each other: a missing user yields
+// mongo.ErrNoDocuments and a role mismatch yields ErrUserRoleConflict. The
+// owner role is never granted or revoked here.
+func (r *UserRepository) UpdateRole(ctx context.Context, userID int64, from, to string, actorID int64) (User, error) {
+	if r == nil || r.collection == nil {
+		return User{}, errors.New("user repository is not initialized")
+	}
+	if ctx == nil {
+		return User{}, errors.New("context is required")
+	}
+	if userID == 0 {
+		return User{}, errors.New("user_id is required")
+	}
+	if RolePriority(from) == 0 || RolePriority(to) == 0 {
+		return User{}, fmt.Errorf("unknown role change %q -> %q", from, to)
+	}
+	if from == RoleOwner || to == RoleOwner {
+		return User{}, ErrOwnerRoleImmutable
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "role": from},
+		bson.M{
+			"$set": bson.M{
+				"role":       to,
+				"updated_at": now,
+			},
+			"$push": bson.M{"role_history": bson.M{
+				"$each":  bson.A{RoleChange{From: from, To: to, ChangedBy: actorID, ChangedAt: now}},
+				"$slice": -MaxRoleHistoryKept,
+			}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return User{}, errors.New("update user role returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return User{}, fmt.Errorf("update user role: %w", err)
+		}
+		// Distinguish an unknown user from one whose role moved on.
+		if _, getErr := r.GetByID(ctx, userID); getErr != nil {
+			return User{}, getErr
+		}
+		return User{}, ErrUserRoleConflict
+	}
+
+	var user User
+	if err := result.Decode(&user); err != nil {
+		return User{}, fmt.Errorf("decode user: %w", err)
+	}
+
+	return user, nil
+}
+
+// MarkInactive flags a user who blocked the bot so broadcasts skip them. It
+// returns mongo.ErrNoDocuments when the user is unknown.
+func (r *UserRepository) MarkInactive(ctx context.Context, userID int64, at time.Time) error {
+	if r == nil || r.collection == nil {
+		return errors.New("user repository is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if userID == 0 {
+		return errors.New("user id is required")
+	}
+
+	result := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"inactive": true, "inactive_at": at, "updated_at": at}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"user_id": 1}),
+	)
+	if result == nil {
+		return errors.New("mark user inactive returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		return fmt.Errorf("mark user inactive: %w", err)
+	}
+
+	return nil
+}
+
 // GroupRepository persists and retrieves groups in MongoDB.
 type GroupRepository struct {
 	collection insertFindCollection
@@ -124,6 +278,33 @@ func (r *GroupRepository) Create(ctx context.Context, group Group) (Group, error
 	return group, nil
 }
 
+// ListActive returns the groups the bot is still a member of, sorted by
+// chat_id. Groups recorded before membership was tracked have no bot_status
+// and count as active.
+func (r *GroupRepository) ListActive(ctx context.Context) ([]Group, error) {
+	if r == nil || r.collection == nil {
+		return nil, errors.New("group repository is not initialized")
+	}
+	if ctx == nil {
+		return nil, errors.New("context is required")
+	}
+
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"bot_status": bson.M{"$nin": bson.A{GroupBotStatusLeft, GroupBotStatusKicked}}},
+		options.Find().SetSort(bson.D{{Key: "chat_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find active groups: %w", err)
+	}
+
+	groups := make([]Group, 0)
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("decode active groups: %w", err)
+	}
+
+	return groups, nil
+}
+
 // GetByChatID fetches a group by chat_id.
 func (r *GroupRepository) GetByChatID(ctx context.Context, chatID int64) (Group, error) {
 	if r == nil || r.collection == nil {
@@ -2,7 +2,9 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"testing"
 	"time"
 
@@ -116,6 +118,133 @@ func TestGroupRepositoryCreateAndGet(t *testing.T) {
 	}
 }
 
+func TestGroupRepositoryListActive(t *testing.T) {
+	coll := newFakeInsertFindCollection(t)
+	repo := NewGroupRepository(coll)
+
+	ctx := context.Background()
+	for _, group := range []Group{
+		{ChatID: -3, BotStatus: GroupBotStatusMember},
+		{ChatID: -2, BotStatus: GroupBotStatusKicked},
+		{ChatID: -1},
+		{ChatID: -4, BotStatus: GroupBotStatusLeft},
+	} {
+		if _, err := repo.Create(ctx, group); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+	}
+
+	groups, err := repo.ListActive(ctx)
+	if err != nil {
+		t.Fatalf("ListActive returned error: %v", err)
+	}
+	if len(groups) != 2 || groups[0].ChatID != -3 || groups[1].ChatID != -1 {
+		t.Fatalf("expected groups -3 and -1 sorted by chat_id, got %+v", groups)
+	}
+}
+
+func TestUserRepositoryListByRole(t *testing.T) {
+	coll := newFakeInsertFindCollection(t)
+	repo := NewUserRepository(coll)
+
+	ctx := context.Background()
+	for _, user := range []User{
+		{UserID: 30, Role: RoleAdmin},
+		{UserID: 10, Role: RoleAdmin},
+		{UserID: 20, Role: RoleUser},
+	} {
+		if _, err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+	}
+
+	admins, err := repo.ListByRole(ctx, RoleAdmin)
+	if err != nil {
+		t.Fatalf("ListByRole returned error: %v", err)
+	}
+
+	if len(admins) != 2 || admins[0].UserID != 10 || admins[1].UserID != 30 {
+		t.Fatalf("expected admins 10 and 30 sorted by user_id, got %+v", admins)
+	}
+
+	if _, err := repo.ListByRole(ctx, "superuser"); err == nil {
+		t.Fatalf("expected error for unknown role")
+	}
+}
+
+func TestUserRepositoryGetByUsername(t *testing.T) {
+	coll := newFakeInsertFindCollection(t)
+	repo := NewUserRepository(coll)
+	ctx := context.Background()
+
+	if _, err := repo.Create(ctx, User{UserID: 7, Username: "Alice_Pay", UsernameLower: "alice_pay"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	for _, query := range []string{"alice_pay", "@Alice_Pay", " @ALICE_PAY "} {
+		found, err := repo.GetByUsername(ctx, query)
+		if err != nil || found.UserID != 7 || found.Username != "Alice_Pay" {
+			t.Fatalf("expected %q to resolve user 7, got %+v err=%v", query, found, err)
+		}
+	}
+
+	if _, err := repo.GetByUsername(ctx, "@bob"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for unknown username, got %v", err)
+	}
+	if _, err := repo.GetByUsername(ctx, "@"); err == nil {
+		t.Fatalf("expected error for empty username")
+	}
+}
+
+func TestUserRepositoryUpdateRole(t *testing.T) {
+	coll := newFakeInsertFindCollection(t)
+	repo := NewUserRepository(coll)
+
+	ctx := context.Background()
+	if _, err := repo.Create(ctx, User{UserID: 10}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	promoted, err := repo.UpdateRole(ctx, 10, RoleUser, RoleAdmin, 1)
+	if err != nil {
+		t.Fatalf("UpdateRole returned error: %v", err)
+	}
+	if promoted.Role != RoleAdmin || len(promoted.RoleHistory) != 1 {
+		t.Fatalf("expected admin with one history entry, got %+v", promoted)
+	}
+	change := promoted.RoleHistory[0]
+	if change.From != RoleUser || change.To != RoleAdmin || change.ChangedBy != 1 || change.ChangedAt.IsZero() {
+		t.Fatalf("unexpected role change %+v", change)
+	}
+
+	if _, err := repo.UpdateRole(ctx, 10, RoleUser, RoleAdmin, 1); !errors.Is(err, ErrUserRoleConflict) {
+		t.Fatalf("expected ErrUserRoleConflict for a stale role, got %v", err)
+	}
+	if _, err := repo.UpdateRole(ctx, 99, RoleUser, RoleAdmin, 1); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("expected ErrNoDocuments for an unknown user, got %v", err)
+	}
+	if _, err := repo.UpdateRole(ctx, 10, RoleAdmin, RoleOwner, 1); !errors.Is(err, ErrOwnerRoleImmutable) {
+		t.Fatalf("expected ErrOwnerRoleImmutable, got %v", err)
+	}
+
+	for i := 0; i < MaxRoleHistoryKept; i++ {
+		from, to := RoleAdmin, RoleUser
+		if i%2 == 1 {
+			from, to = to, from
+		}
+		if _, err := repo.UpdateRole(ctx, 10, from, to, 1); err != nil {
+			t.Fatalf("UpdateRole #%d returned error: %v", i, err)
+		}
+	}
+	found, err := repo.GetByID(ctx, 10)
+	if err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	if len(found.RoleHistory) != MaxRoleHistoryKept || found.RoleHistory[0].From != RoleAdmin {
+		t.Fatalf("expected history trimmed to the latest %d changes, got %d", MaxRoleHistoryKept, len(found.RoleHistory))
+	}
+}
+
 func TestRolePriority(t *testing.T) {
 	tests := []struct {
 		role     string
@@ -168,14 +297,79 @@ func (f *fakeInsertFindCollection) FindOne(ctx context.Context, filter interface
 		if val, ok := filterDoc[idKey]; ok {
 			doc, found := f.docs[f.key(idKey, val)]
 			if !found {
-				return mongo.NewSingleResultFromDocument(nil, mongo.ErrNoDocuments, nil)
+				return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
 			}
 
 			return mongo.NewSingleResultFromDocument(doc, nil, nil)
 		}
 	}
 
-	return mongo.NewSingleResultFromDocument(nil, fmt.Errorf("missing id filter in %v", filterDoc), nil)
+	for _, doc := range f.docs {
+		if matchesFilter(doc, filterDoc) {
+			return mongo.NewSingleResultFromDocument(doc, nil, nil)
+		}
+	}
+
+	return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+}
+
+func (f *fakeInsertFindCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	filterDoc, ok := filter.(bson.M)
+	if !ok {
+		return nil, fmt.Errorf("unexpected filter type %T", filter)
+	}
+
+	matches := make([]bson.M, 0)
+	for _, doc := range f.docs {
+		if matchesFilter(doc, filterDoc) {
+			matches = append(matches, doc)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		_, left := idField(matches[i])
+		_, right := idField(matches[j])
+		leftID, _ := left.(int64)
+		rightID, _ := right.(int64)
+		return leftID < rightID
+	})
+
+	docs := make([]interface{}, 0, len(matches))
+	for _, doc := range matches {
+		docs = append(docs, doc)
+	}
+
+	return mongo.NewCursorFromDocuments(docs, nil, nil)
+}
+
+func (f *fakeInsertFindCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	filterDoc := filter.(bson.M)
+	doc, found := f.docs[f.key("user_id", filterDoc["user_id"])]
+	if !found || !matchesFilter(doc, filterDoc) {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+
+	updateDoc := update.(bson.M)
+	if set, ok := updateDoc["$set"].(bson.M); ok {
+		for field, value := range set {
+			doc[field] = value
+		}
+	}
+	if push, ok := updateDoc["$push"].(bson.M); ok {
+		for field, value := range push {
+			spec := value.(bson.M)
+			arr, _ := doc[field].(bson.A)
+			for _, item := range spec["$each"].(bson.A) {
+				arr = append(arr, marshalDoc(f.t, item))
+			}
+			if keep, ok := spec["$slice"].(int); ok && len(arr) > -keep {
+				arr = arr[len(arr)+keep:]
+			}
+			doc[field] = arr
+		}
+	}
+
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
 }
 
 func (f *fakeInsertFindCollection) key(field string, value interface{}) string {
@@ -193,6 +387,58 @@ func (f *fakeInsertFindCollection) docFor(t *testing.T, field string, id interfa
 	return doc
 }
 
+func matchesFilter(doc, filter bson.M) bool {
+	for field, expected := range filter {
+		if cond, ok := expected.(bson.M); ok {
+			if in, ok := cond["$in"]; ok && !matchesIn(doc[field], in) {
+				return false
+			}
+			if nin, ok := cond["$nin"]; ok && matchesIn(doc[field], nin) {
+				return false
+			}
+			if bound, ok := cond["$lt"]; ok && !timeBefore(doc[field], bound) {
+				return false
+			}
+			continue
+		}
+		if doc[field] != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesIn supports the $in and $nin operators the fakes need.
+func matchesIn(value, in interface{}) bool {
+	candidates, _ := in.(bson.A)
+	for _, candidate := range candidates {
+		if value == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timeBefore supports $lt on timestamps stored as primitive.DateTime.
+func timeBefore(value, bound interface{}) bool {
+	toTime := func(v interface{}) (time.Time, bool) {
+		switch t := v.(type) {
+		case time.Time:
+			return t, true
+		case primitive.DateTime:
+			return t.Time(), true
+		default:
+			return time.Time{}, false
+		}
+	}
+
+	at, ok := toTime(value)
+	limit, boundOK := toTime(bound)
+	return ok && boundOK && at.Before(limit)
+}
+
 func marshalDoc(t *testing.T, document interface{}) bson.M {
 	t.Helper()
 
@@ -1,12 +1,88 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// MaxRoleHistoryKept bounds the role changes retained on a user record.
+const MaxRoleHistoryKept = 20
+
+// MaxUsernameHistoryKept bounds the username changes retained on a user record.
+const MaxUsernameHistoryKept = 10
+
+// ErrOwnerRoleImmutable is returned when a role change would grant or revoke
+// the owner role, which only follows the BOT_OWNER setting.
+var ErrOwnerRoleImmutable = errors.New("owner role cannot be changed by command")
+
+// ErrUserRoleConflict is returned when the user's role no longer matches the
+// role a change was based on.
+var ErrUserRoleConflict = errors.New("user role changed concurrently")
 
 // User represents a Telegram user registered with the bot.
 type User struct {
-	UserID     int64     `bson:"user_id" json:"user_id"`
-	Role       string    `bson:"role" json:"role"`
-	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
-	LastSeenAt time.Time `bson:"last_seen_at" json:"last_seen_at"`
+	UserID       int64  `bson:"user_id" json:"user_id"`
+	Role         string `bson:"role" json:"role"`
+	Username     string `bson:"username,omitempty" json:"username,omitempty"`
+	FirstName    string `bson:"first_name,omitempty" json:"first_name,omitempty"`
+	LastName     string `bson:"last_name,omitempty" json:"last_name,omitempty"`
+	LanguageCode string `bson:"language_code,omitempty" json:"language_code,omitempty"`
+	IsBot        bool   `bson:"is_bot" json:"is_bot"`
+	IsPremium    bool   `bson:"is_premium" json:"is_premium"`
+	// UsernameLower backs the unique sparse index used to resolve @username;
+	// it is absent while the user has no username.
+	UsernameLower   string           `bson:"username_lower,omitempty" json:"-"`
+	UsernameHistory []UsernameChange `bson:"username_history,omitempty" json:"username_history,omitempty"`
+	RoleHistory     []RoleChange     `bson:"role_history,omitempty" json:"role_history,omitempty"`
+	// Inactive is set when a broadcast found that the user blocked the bot and
+	// cleared on their next interaction; inactive users receive no broadcasts.
+	Inactive   bool       `bson:"inactive,omitempty" json:"inactive,omitempty"`
+	InactiveAt *time.Time `bson:"inactive_at,omitempty" json:"inactive_at,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
+	LastSeenAt time.Time  `bson:"last_seen_at" json:"last_seen_at"`
+}
+
+// DisplayName returns "@username" when set, otherwise the user's full name,
+// otherwise an empty string.
+func (u User) DisplayName() string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// UserProfile is the Telegram profile data refreshed on every update.
+type UserProfile struct {
+	UserID       int64
+	Username     string
+	FirstName    string
+	LastName     string
+	LanguageCode string
+	IsBot        bool
+	IsPremium    bool
+}
+
+// UsernameChange records a username transition; an empty value means the
+// user had no username.
+type UsernameChange struct {
+	From      string    `bson:"from" json:"from"`
+	To        string    `bson:"to" json:"to"`
+	ChangedAt time.Time `bson:"changed_at" json:"changed_at"`
+}
+
+// NormalizeUsername strips a leading "@" and lowercases the username for
+// lookups; Telegram usernames are case-insensitive.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+// RoleChange records a single role transition and who made it.
+type RoleChange struct {
+	From      string    `bson:"from" json:"from"`
+	To        string    `bson:"to" json:"to"`
+	ChangedBy int64     `bson:"changed_by" json:"changed_by"`
+	ChangedAt time.Time `bson:"changed_at" json:"changed_at"`
 }
@@ -10,32 +10,45 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"tg_pay_gateway_bot/internal/domain"
 	"tg_pay_gateway_bot/internal/logging"
 )
 
 type groupCollection interface {
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	ReplaceOne(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+}
+
+// merchantGroupMover rebinds a merchant's group when the chat ID changes.
+type merchantGroupMover interface {
+	MoveGroup(ctx context.Context, fromChatID, toChatID int64) (domain.Merchant, error)
 }
 
 // Registrar ensures groups are persisted when the bot encounters them and keeps
 // their last-seen timestamp updated.
 type Registrar struct {
-	groups groupCollection
-	logger *logrus.Entry
+	groups    groupCollection
+	merchants merchantGroupMover
+	logger    *logrus.Entry
 }
 
 // NewRegistrar constructs a Registrar for the provided groups collection.
-func NewRegistrar(groups groupCollection, logger *logrus.Entry) *Registrar {
+// merchants may be nil when merchant bindings need not follow migrations.
+func NewRegistrar(groups groupCollection, merchants merchantGroupMover, logger *logrus.Entry) *Registrar {
 	if logger == nil {
 		logger = logging.Logger()
 	}
 
 	return &Registrar{
-		groups: groups,
-		logger: logger,
+		groups:    groups,
+		merchants: merchants,
+		logger:    logger,
 	}
 }
 
@@ -95,3 +108,211 @@ func (r *Registrar) EnsureGroup(ctx context.Context, chatID int64, title string)
 
 	return false, nil
 }
+
+// RecordBotMembership stores the bot's member status and admin rights from a
+// my_chat_member update. Joining (from left/kicked to an active status) records
+// added_by/added_at and leaving records removed_by/removed_at; the group is
+// created when it is not yet known.
+func (r *Registrar) RecordBotMembership(ctx context.Context, change domain.BotMembership) error {
+	if r == nil || r.groups == nil {
+		return errors.New("group registrar is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if change.ChatID == 0 {
+		return errors.New("chat id is required")
+	}
+	if strings.TrimSpace(change.Status) == "" {
+		return errors.New("bot status is required")
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	changedAt := change.ChangedAt.UTC()
+	if changedAt.IsZero() {
+		changedAt = now
+	}
+
+	setFields := bson.M{
+		"bot_status":        change.Status,
+		"status_changed_by": change.ChangedBy,
+		"status_changed_at": changedAt,
+		"last_seen_at":      now,
+	}
+	if title := strings.TrimSpace(change.Title); title != "" {
+		setFields["title"] = title
+	}
+
+	update := bson.M{
+		"$set": setFields,
+		"$setOnInsert": bson.M{
+			"chat_id":   change.ChatID,
+			"joined_at": changedAt,
+		},
+	}
+
+	if change.Rights != nil {
+		setFields["bot_rights"] = change.Rights
+	} else {
+		update["$unset"] = bson.M{"bot_rights": ""}
+	}
+
+	wasActive := domain.IsActiveBotStatus(change.OldStatus)
+	isActive := domain.IsActiveBotStatus(change.Status)
+	switch {
+	case !wasActive && isActive:
+		setFields["added_by"] = change.ChangedBy
+		setFields["added_at"] = changedAt
+	case wasActive && !isActive:
+		setFields["removed_by"] = change.ChangedBy
+		setFields["removed_at"] = changedAt
+	}
+
+	if _, err := r.groups.UpdateOne(ctx,
+		bson.M{"chat_id": change.ChatID},
+		update,
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return fmt.Errorf("record bot membership: %w", err)
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":      "group_bot_status_changed",
+		"chat_id":    change.ChatID,
+		"from":       change.OldStatus,
+		"to":         change.Status,
+		"changed_by": change.ChangedBy,
+	}).Info("recorded bot membership change")
+
+	return nil
+}
+
+// MigrateGroup merges the record of a basic group into its supergroup after a
+// Telegram upgrade. Both the old and the new chat announce the migration, so
+// the call is idempotent: the merchant binding moves first, then the old
+// record (keeping the earliest joined_at and any fields the new record lacks)
+// replaces the new one and is deleted. It reports whether a record was merged.
+func (r *Registrar) MigrateGroup(ctx context.Context, fromChatID, toChatID int64, title string) (bool, error) {
+	if r == nil || r.groups == nil {
+		return false, errors.New("group registrar is not initialized")
+	}
+	if ctx == nil {
+		return false, errors.New("context is required")
+	}
+	if fromChatID == 0 || toChatID == 0 || fromChatID == toChatID {
+		return false, fmt.Errorf("invalid group migration %d -> %d", fromChatID, toChatID)
+	}
+
+	merchantID, err := r.moveMerchant(ctx, fromChatID, toChatID)
+	if err != nil {
+		return false, err
+	}
+
+	old, found, err := r.find(ctx, fromChatID)
+	if err != nil || !found {
+		return false, err
+	}
+	current, _, err := r.find(ctx, toChatID)
+	if err != nil {
+		return false, err
+	}
+
+	merged := mergeGroups(old, current)
+	merged["chat_id"] = toChatID
+	merged["migrated_from_chat_id"] = fromChatID
+	merged["last_seen_at"] = time.Now().UTC().Truncate(time.Millisecond)
+	if trimmed := strings.TrimSpace(title); trimmed != "" {
+		merged["title"] = trimmed
+	}
+
+	if _, err := r.groups.ReplaceOne(ctx,
+		bson.M{"chat_id": toChatID},
+		merged,
+		options.Replace().SetUpsert(true),
+	); err != nil {
+		return false, fmt.Errorf("merge migrated group: %w", err)
+	}
+	if _, err := r.groups.DeleteOne(ctx, bson.M{"chat_id": fromChatID}); err != nil {
+		return false, fmt.Errorf("delete migrated group: %w", err)
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":        "group_migrated",
+		"from_chat_id": fromChatID,
+		"to_chat_id":   toChatID,
+		"merchant_id":  merchantID,
+	}).Info("merged migrated group into supergroup")
+
+	return true, nil
+}
+
+// moveMerchant rebinds the merchant bound to fromChatID, returning its ID or an
+// empty string when the group is not bound.
+func (r *Registrar) moveMerchant(ctx context.Context, fromChatID, toChatID int64) (string, error) {
+	if r.merchants == nil {
+		return "", nil
+	}
+
+	merchant, err := r.merchants.MoveGroup(ctx, fromChatID, toChatID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("move merchant group: %w", err)
+	}
+
+	return merchant.MerchantID, nil
+}
+
+func (r *Registrar) find(ctx context.Context, chatID int64) (bson.M, bool, error) {
+	result := r.groups.FindOne(ctx, bson.M{"chat_id": chatID})
+	if result == nil {
+		return nil, false, errors.New("find group returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("find group: %w", err)
+	}
+
+	var doc bson.M
+	if err := result.Decode(&doc); err != nil {
+		return nil, false, fmt.Errorf("decode group: %w", err)
+	}
+
+	return doc, true, nil
+}
+
+// mergeGroups overlays the newer record on the older one so fields only the
+// old group had (settings, who added the bot) survive, keeping the earliest
+// joined_at.
+func mergeGroups(old, current bson.M) bson.M {
+	merged := bson.M{}
+	for field, value := range old {
+		merged[field] = value
+	}
+	for field, value := range current {
+		merged[field] = value
+	}
+	delete(merged, "_id")
+
+	oldJoined, oldOK := timeValue(old["joined_at"])
+	currentJoined, currentOK := timeValue(current["joined_at"])
+	if oldOK && (!currentOK || oldJoined.Before(currentJoined)) {
+		merged["joined_at"] = oldJoined
+	}
+
+	return merged
+}
+
+func timeValue(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case primitive.DateTime:
+		return v.Time().UTC(), v != 0
+	default:
+		return time.Time{}, false
+	}
+}
@@ -10,12 +10,14 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"tg_pay_gateway_bot/internal/domain"
 )
 
 func TestEnsureGroupCreatesNewRecord(t *testing.T) {
 	hookLogger, _ := logtest.NewNullLogger()
 	coll := newFakeGroupCollection(t)
-	registrar := NewRegistrar(coll, logrus.NewEntry(hookLogger))
+	registrar := NewRegistrar(coll, nil, logrus.NewEntry(hookLogger))
 
 	ctx := context.Background()
 	created, err := registrar.EnsureGroup(ctx, -100200, " Test Group ")
@@ -53,7 +55,7 @@ func TestEnsureGroupUpdatesLastSeenAndTitle(t *testing.T) {
 		"last_seen_at": initialLastSeen,
 	})
 
-	registrar := NewRegistrar(coll, logrus.NewEntry(hookLogger))
+	registrar := NewRegistrar(coll, nil, logrus.NewEntry(hookLogger))
 
 	ctx := context.Background()
 	created, err := registrar.EnsureGroup(ctx, -200300, "Updated Title")
@@ -76,6 +78,138 @@ func TestEnsureGroupUpdatesLastSeenAndTitle(t *testing.T) {
 	}
 }
 
+func TestRecordBotMembershipTracksJoinRightsAndRemoval(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	coll := newFakeGroupCollection(t)
+	registrar := NewRegistrar(coll, nil, logrus.NewEntry(hookLogger))
+	ctx := context.Background()
+
+	addedAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := registrar.RecordBotMembership(ctx, domain.BotMembership{
+		ChatID:    -100500,
+		Title:     "Shop Ops",
+		OldStatus: domain.GroupBotStatusLeft,
+		Status:    domain.GroupBotStatusMember,
+		ChangedBy: 42,
+		ChangedAt: addedAt,
+	}); err != nil {
+		t.Fatalf("RecordBotMembership returned error: %v", err)
+	}
+
+	doc := coll.docFor(t, -100500)
+	assertFieldEquals(t, doc, "bot_status", domain.GroupBotStatusMember)
+	assertFieldEquals(t, doc, "added_by", int64(42))
+	assertFieldEquals(t, doc, "added_at", addedAt)
+	assertFieldEquals(t, doc, "joined_at", addedAt)
+	assertFieldEquals(t, doc, "title", "Shop Ops")
+
+	rights := &domain.BotRights{CanDeleteMessages: true, CanPinMessages: true}
+	if err := registrar.RecordBotMembership(ctx, domain.BotMembership{
+		ChatID:    -100500,
+		OldStatus: domain.GroupBotStatusMember,
+		Status:    domain.GroupBotStatusAdministrator,
+		Rights:    rights,
+		ChangedBy: 43,
+		ChangedAt: addedAt.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("RecordBotMembership returned error: %v", err)
+	}
+	doc = coll.docFor(t, -100500)
+	assertFieldEquals(t, doc, "bot_rights", rights)
+	assertFieldEquals(t, doc, "added_by", int64(42))
+
+	removedAt := addedAt.Add(2 * time.Hour)
+	if err := registrar.RecordBotMembership(ctx, domain.BotMembership{
+		ChatID:    -100500,
+		OldStatus: domain.GroupBotStatusAdministrator,
+		Status:    domain.GroupBotStatusKicked,
+		ChangedBy: 44,
+		ChangedAt: removedAt,
+	}); err != nil {
+		t.Fatalf("RecordBotMembership returned error: %v", err)
+	}
+	doc = coll.docFor(t, -100500)
+	assertFieldEquals(t, doc, "bot_status", domain.GroupBotStatusKicked)
+	assertFieldEquals(t, doc, "removed_by", int64(44))
+	assertFieldEquals(t, doc, "removed_at", removedAt)
+	assertFieldEquals(t, doc, "status_changed_at", removedAt)
+	if _, ok := doc["bot_rights"]; ok {
+		t.Fatalf("expected bot_rights to be cleared after removal, got %v", doc["bot_rights"])
+	}
+
+	var changes int
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["event"] == "group_bot_status_changed" {
+			changes++
+		}
+	}
+	if changes != 3 {
+		t.Fatalf("expected 3 group_bot_status_changed log entries, got %d", changes)
+	}
+
+	if err := registrar.RecordBotMembership(ctx, domain.BotMembership{ChatID: -100500}); err == nil {
+		t.Fatalf("expected error without a status")
+	}
+}
+
+func TestMigrateGroupMergesIntoSupergroup(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	coll := newFakeGroupCollection(t)
+	merchants := &fakeMerchants{bindings: map[int64]string{-900: "shop"}}
+	registrar := NewRegistrar(coll, merchants, logrus.NewEntry(hookLogger))
+	ctx := context.Background()
+
+	joinedAt := time.Date(2025, 5, 1, 8, 0, 0, 0, time.UTC)
+	coll.seed(t, bson.M{
+		"chat_id":      int64(-900),
+		"title":        "Ops",
+		"joined_at":    joinedAt,
+		"last_seen_at": joinedAt,
+		"added_by":     int64(7),
+		"settings":     bson.M{"locale": "de"},
+	})
+
+	// The supergroup's first message registered a fresh record already.
+	if _, err := registrar.EnsureGroup(ctx, -100900, "Ops"); err != nil {
+		t.Fatalf("EnsureGroup returned error: %v", err)
+	}
+
+	merged, err := registrar.MigrateGroup(ctx, -900, -100900, "Ops HQ")
+	if err != nil || !merged {
+		t.Fatalf("expected migration to merge, got merged=%v err=%v", merged, err)
+	}
+
+	if _, found := coll.docs[-900]; found {
+		t.Fatalf("expected the old group record to be removed")
+	}
+	doc := coll.docFor(t, -100900)
+	assertFieldEquals(t, doc, "chat_id", int64(-100900))
+	assertFieldEquals(t, doc, "migrated_from_chat_id", int64(-900))
+	assertFieldEquals(t, doc, "joined_at", joinedAt)
+	assertFieldEquals(t, doc, "added_by", int64(7))
+	assertFieldEquals(t, doc, "title", "Ops HQ")
+	if settings, _ := doc["settings"].(bson.M); settings["locale"] != "de" {
+		t.Fatalf("expected settings to be preserved, got %v", doc["settings"])
+	}
+	if merchants.bindings[-100900] != "shop" {
+		t.Fatalf("expected merchant binding to follow the migration, got %v", merchants.bindings)
+	}
+
+	entry := findEvent(hook.AllEntries(), "group_migrated")
+	if entry == nil || entry.Data["merchant_id"] != "shop" {
+		t.Fatalf("expected group_migrated log entry, got %+v", entry)
+	}
+
+	// The second migration notice finds nothing left to merge.
+	merged, err = registrar.MigrateGroup(ctx, -900, -100900, "Ops HQ")
+	if err != nil || merged {
+		t.Fatalf("expected repeated migration to be a no-op, got merged=%v err=%v", merged, err)
+	}
+	if len(coll.docs) != 1 {
+		t.Fatalf("expected a single group record, got %v", coll.docs)
+	}
+}
+
 type fakeGroupCollection struct {
 	t    *testing.T
 	docs map[int64]bson.M
@@ -120,6 +254,10 @@ func (f *fakeGroupCollection) UpdateOne(_ context.Context, filter interface{}, u
 	}
 
 	merge(doc, setDoc)
+	unsetDoc, _ := updateDoc["$unset"].(bson.M)
+	for field := range unsetDoc {
+		delete(doc, field)
+	}
 	f.docs[chatID] = doc
 
 	result := &mongo.UpdateResult{
@@ -136,6 +274,52 @@ func (f *fakeGroupCollection) UpdateOne(_ context.Context, filter interface{}, u
 	return result, nil
 }
 
+func (f *fakeGroupCollection) FindOne(_ context.Context, filter interface{}, _ ...*options.FindOneOptions) *mongo.SingleResult {
+	chatID := readInt64(f.t, filter.(bson.M)["chat_id"])
+	doc, found := f.docs[chatID]
+	if !found {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (f *fakeGroupCollection) ReplaceOne(_ context.Context, filter interface{}, replacement interface{}, _ ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	chatID := readInt64(f.t, filter.(bson.M)["chat_id"])
+	doc, ok := replacement.(bson.M)
+	if !ok {
+		return nil, f.Errorf("unexpected replacement type %T", replacement)
+	}
+
+	f.docs[chatID] = doc
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (f *fakeGroupCollection) DeleteOne(_ context.Context, filter interface{}, _ ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	chatID := readInt64(f.t, filter.(bson.M)["chat_id"])
+	if _, found := f.docs[chatID]; !found {
+		return &mongo.DeleteResult{}, nil
+	}
+
+	delete(f.docs, chatID)
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+type fakeMerchants struct {
+	bindings map[int64]string
+}
+
+func (f *fakeMerchants) MoveGroup(_ context.Context, fromChatID, toChatID int64) (domain.Merchant, error) {
+	merchantID, ok := f.bindings[fromChatID]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+
+	delete(f.bindings, fromChatID)
+	f.bindings[toChatID] = merchantID
+	return domain.Merchant{MerchantID: merchantID, GroupChatIDs: []int64{toChatID}}, nil
+}
+
 func (f *fakeGroupCollection) docFor(t *testing.T, chatID int64) bson.M {
 	t.Helper()
 
@@ -165,6 +349,15 @@ func (f *fakeGroupCollection) Errorf(format string, args ...interface{}) error {
 	return nil
 }
 
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
+
 func merge(dst bson.M, updates bson.M) {
 	for k, v := range updates {
 		dst[k] = v
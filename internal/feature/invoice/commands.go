@@ -0,0 +1,231 @@
+// Package invoice lets merchant groups bill payers through Telegram Payments,
+// in provider currencies or Telegram Stars, records the resulting payments on
+// the order, and gives the owner Stars refunds and reports.
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+// Channel is the order channel code for Telegram invoice payments.
+const Channel = "telegram"
+
+const (
+	invoiceUsage = "Usage: /invoice <amount_minor> <currency> <description>, with whole stars for XTR"
+	// maxTitleChars and maxDescriptionChars mirror Telegram's sendInvoice
+	// limits.
+	maxTitleChars       = 32
+	maxDescriptionChars = 255
+)
+
+// invoiceCurrency matches the ISO 4217 codes Telegram Payments accepts and
+// XTR for Telegram Stars.
+var invoiceCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type orderStore interface {
+	Create(ctx context.Context, order domain.Order) (domain.Order, error)
+	GetByID(ctx context.Context, orderID string) (domain.Order, error)
+	GetByTelegramChargeID(ctx context.Context, chargeID string) (domain.Order, error)
+	Transition(ctx context.Context, t domain.OrderTransition) (domain.Order, error)
+}
+
+type merchantReader interface {
+	GetByGroupChatID(ctx context.Context, chatID int64) (domain.Merchant, error)
+}
+
+type paymentsClient interface {
+	PaymentsEnabled() bool
+	SendInvoice(ctx context.Context, chatID int64, invoice telegram.Invoice) (int, error)
+	RefundStarPayment(ctx context.Context, userID int64, chargeID string) error
+	StarBalance(ctx context.Context) (int64, error)
+	StarTransactions(ctx context.Context, offset, limit int) ([]telegram.StarTransaction, error)
+}
+
+// auditRecorder writes Stars refunds, including refused ones, to the audit
+// trail.
+type auditRecorder interface {
+	Record(ctx context.Context, entry audit.Entry)
+}
+
+// Service implements the invoice and Stars commands and the Telegram payment
+// processor.
+type Service struct {
+	orders     orderStore
+	merchants  merchantReader
+	client     paymentsClient
+	audit      auditRecorder
+	logger     *logrus.Entry
+	retryDelay time.Duration
+}
+
+// NewService constructs a Service. audit may be nil when no audit trail is
+// kept.
+func NewService(orders orderStore, merchants merchantReader, client paymentsClient, audit auditRecorder, logger *logrus.Entry) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Service{
+		orders:     orders,
+		merchants:  merchants,
+		client:     client,
+		audit:      audit,
+		logger:     logger,
+		retryDelay: paymentRetryDelay,
+	}
+}
+
+// Commands returns the invoice commands for registration with the Telegram
+// client.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			// The group binding scopes access: invoices are always issued
+			// for the merchant the group is bound to.
+			Name:        "invoice",
+			Description: "Send a payment invoice to this group",
+			ChatTypes:   []string{telegram.ChatTypeGroup},
+			Handler:     telegram.ReplyHandler(s.logger, s.invoiceCommand),
+		},
+		{
+			Name:        "refund_star",
+			Description: "Refund a Telegram Stars payment",
+			MinRole:     domain.RoleOwner,
+			Handler:     telegram.ReplyHandler(s.logger, s.refundStarCommand),
+		},
+		{
+			// Private only: transactions name paying users.
+			Name:        "stars",
+			Description: "Show the Telegram Stars balance and transactions",
+			MinRole:     domain.RoleOwner,
+			ChatTypes:   []string{telegram.ChatTypePrivate},
+			Handler:     telegram.ReplyHandler(s.logger, s.starsCommand),
+		},
+	}
+}
+
+func (s *Service) check(ctx context.Context) error {
+	if s == nil || s.orders == nil || s.merchants == nil || s.client == nil {
+		return errors.New("invoice service is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
+
+func (s *Service) invoiceCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	if len(req.Args) < 3 {
+		return invoiceUsage, nil
+	}
+
+	amount, err := strconv.ParseInt(req.Args[0], 10, 64)
+	if err != nil || amount <= 0 {
+		return fmt.Sprintf("Invalid amount %q: use a positive integer in minor units.", req.Args[0]), nil
+	}
+	currency := strings.ToUpper(req.Args[1])
+	if !invoiceCurrency.MatchString(currency) {
+		return fmt.Sprintf("Invalid currency %q: use a 3-letter ISO 4217 code, or XTR for Telegram Stars.", req.Args[1]), nil
+	}
+	description := strings.Join(req.Args[2:], " ")
+	if len([]rune(description)) > maxDescriptionChars {
+		return fmt.Sprintf("Description is too long: use at most %d characters.", maxDescriptionChars), nil
+	}
+
+	merchant, err := s.merchants.GetByGroupChatID(ctx, req.ChatID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "This group is not bound to a merchant.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if merchant.Status != domain.MerchantStatusActive {
+		return fmt.Sprintf("Merchant %s is %s and cannot issue invoices.", merchant.MerchantID, merchant.Status), nil
+	}
+	if currency != domain.CurrencyStars && !s.client.PaymentsEnabled() {
+		return "Telegram Payments are not configured for this bot; invoice in XTR to charge Telegram Stars.", nil
+	}
+
+	created, err := s.orders.Create(ctx, domain.Order{
+		MerchantID:  merchant.MerchantID,
+		AmountMinor: amount,
+		Currency:    currency,
+		Channel:     Channel,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The order is pending before the invoice goes out so a fast payer's
+	// pre-checkout query never finds it still in created.
+	if _, err := s.orders.Transition(ctx, domain.OrderTransition{
+		OrderID: created.OrderID,
+		From:    domain.OrderStatusCreated,
+		To:      domain.OrderStatusPending,
+		Reason:  "invoice_issued",
+	}); err != nil {
+		return "", err
+	}
+
+	if _, err := s.client.SendInvoice(ctx, req.ChatID, telegram.Invoice{
+		Title:       invoiceTitle(merchant),
+		Description: description,
+		Payload:     created.OrderID,
+		Currency:    currency,
+		Amount:      amount,
+	}); err != nil {
+		if _, failErr := s.orders.Transition(ctx, domain.OrderTransition{
+			OrderID: created.OrderID,
+			From:    domain.OrderStatusPending,
+			To:      domain.OrderStatusFailed,
+			Reason:  "invoice_send_failed",
+		}); failErr != nil {
+			err = errors.Join(err, failErr)
+		}
+		return "", fmt.Errorf("send invoice for order %s: %w", created.OrderID, err)
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":        "invoice_sent",
+		"order_id":     created.OrderID,
+		"merchant_id":  merchant.MerchantID,
+		"amount_minor": amount,
+		"currency":     currency,
+		"user_id":      req.UserID,
+		"chat_id":      req.ChatID,
+	}).Info("sent telegram invoice")
+
+	return fmt.Sprintf("Invoice sent for %s %s (order_id: %s).", domain.FormatAmount(amount, currency), currency, created.OrderID), nil
+}
+
+// invoiceTitle uses the merchant name, falling back to the ID, cut to
+// Telegram's title limit.
+func invoiceTitle(merchant domain.Merchant) string {
+	title := strings.TrimSpace(merchant.Name)
+	if title == "" {
+		title = merchant.MerchantID
+	}
+	if runes := []rune(title); len(runes) > maxTitleChars {
+		title = strings.TrimSpace(string(runes[:maxTitleChars]))
+	}
+
+	return title
+}
@@ -0,0 +1,247 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+func TestCommandsScopes(t *testing.T) {
+	service := NewService(newFakeOrders(), fakeMerchants{}, &fakeClient{}, nil, logrus.NewEntry(logrus.New()))
+
+	commands := service.Commands()
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 commands, got %+v", commands)
+	}
+	if commands[0].Name != "invoice" || len(commands[0].ChatTypes) != 1 || commands[0].ChatTypes[0] != telegram.ChatTypeGroup {
+		t.Fatalf("expected group-only /invoice, got %+v", commands[0])
+	}
+	if commands[1].Name != "refund_star" || commands[1].MinRole != domain.RoleOwner {
+		t.Fatalf("expected owner-only /refund_star, got %+v", commands[1])
+	}
+	if commands[2].Name != "stars" || commands[2].MinRole != domain.RoleOwner || commands[2].ChatTypes[0] != telegram.ChatTypePrivate {
+		t.Fatalf("expected owner-only private /stars, got %+v", commands[2])
+	}
+}
+
+func TestInvoiceCommandSendsInvoice(t *testing.T) {
+	orders := newFakeOrders()
+	sender := &fakeClient{enabled: true}
+	service := NewService(orders, testMerchants(), sender, nil, logrus.NewEntry(logrus.New()))
+
+	reply, err := service.invoiceCommand(context.Background(), groupRequest("1250", "usd", "Two", "coffees"))
+	if err != nil {
+		t.Fatalf("invoiceCommand returned error: %v", err)
+	}
+	if len(orders.items) != 1 || len(sender.invoices) != 1 {
+		t.Fatalf("expected one order and one invoice, got %d orders and %d invoices", len(orders.items), len(sender.invoices))
+	}
+
+	var created domain.Order
+	for _, order := range orders.items {
+		created = order
+	}
+	if created.Status != domain.OrderStatusPending || created.Channel != Channel || created.MerchantID != "acme" || created.AmountMinor != 1250 || created.Currency != "USD" {
+		t.Fatalf("unexpected order %+v", created)
+	}
+	invoice := sender.invoices[0]
+	if invoice.Title != "Acme Coffee Roasters and Bakery" || invoice.Description != "Two coffees" || invoice.Payload != created.OrderID || invoice.Amount != 1250 {
+		t.Fatalf("unexpected invoice %+v", invoice)
+	}
+	if reply != "Invoice sent for 12.50 USD (order_id: "+created.OrderID+")." {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+}
+
+func TestInvoiceCommandRejectsBadInput(t *testing.T) {
+	sender := &fakeClient{enabled: true}
+	service := NewService(newFakeOrders(), testMerchants(), sender, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	cases := []struct {
+		req  telegram.CommandRequest
+		want string
+	}{
+		{groupRequest("1250", "USD"), invoiceUsage},
+		{groupRequest("12.50", "USD", "coffee"), "Invalid amount"},
+		{groupRequest("1250", "USDT", "coffee"), "Invalid currency"},
+		{groupRequest("1250", "USD", strings.Repeat("x", maxDescriptionChars+1)), "Description is too long"},
+		{telegram.CommandRequest{ChatID: -200, Args: []string{"1250", "USD", "coffee"}}, "This group is not bound to a merchant."},
+		{telegram.CommandRequest{ChatID: -300, Args: []string{"1250", "USD", "coffee"}}, "Merchant paused is suspended"},
+	}
+	for _, tc := range cases {
+		reply, err := service.invoiceCommand(ctx, tc.req)
+		if err != nil || !strings.HasPrefix(reply, tc.want) {
+			t.Fatalf("invoice(%v): expected reply starting with %q, got %q err=%v", tc.req.Args, tc.want, reply, err)
+		}
+	}
+
+	sender.enabled = false
+	if reply, _ := service.invoiceCommand(ctx, groupRequest("1250", "USD", "coffee")); !strings.Contains(reply, "not configured") {
+		t.Fatalf("expected payments disabled reply, got %q", reply)
+	}
+	if len(sender.invoices) != 0 {
+		t.Fatalf("expected no invoices to be sent, got %d", len(sender.invoices))
+	}
+
+	reply, err := service.invoiceCommand(ctx, groupRequest("50", "xtr", "Sticker", "pack"))
+	if err != nil || reply != "Invoice sent for 50 XTR (order_id: ord_test0)." {
+		t.Fatalf("expected Stars invoice without a provider token, got %q err=%v", reply, err)
+	}
+}
+
+func TestInvoiceCommandFailsOrderWhenSendFails(t *testing.T) {
+	orders := newFakeOrders()
+	sender := &fakeClient{enabled: true, err: errors.New("PAYMENT_PROVIDER_INVALID")}
+	service := NewService(orders, testMerchants(), sender, nil, logrus.NewEntry(logrus.New()))
+
+	if _, err := service.invoiceCommand(context.Background(), groupRequest("1250", "USD", "coffee")); err == nil {
+		t.Fatalf("expected send failure to be returned")
+	}
+	for _, order := range orders.items {
+		if order.Status != domain.OrderStatusFailed {
+			t.Fatalf("expected order to be failed, got %q", order.Status)
+		}
+	}
+}
+
+func groupRequest(args ...string) telegram.CommandRequest {
+	return telegram.CommandRequest{UserID: 7, ChatID: -100, ChatType: telegram.ChatTypeGroup, Args: args}
+}
+
+func testMerchants() fakeMerchants {
+	return fakeMerchants{
+		-100: {MerchantID: "acme", Name: "Acme Coffee Roasters and Bakery Ltd", Status: domain.MerchantStatusActive},
+		-300: {MerchantID: "paused", Name: "Paused", Status: domain.MerchantStatusSuspended},
+	}
+}
+
+type fakeOrders struct {
+	items  map[string]domain.Order
+	nextID int
+	// transitionErrs fail the next transitions, one error each.
+	transitionErrs []error
+	transitions    int
+}
+
+func newFakeOrders() *fakeOrders {
+	return &fakeOrders{items: make(map[string]domain.Order)}
+}
+
+func (f *fakeOrders) Create(_ context.Context, order domain.Order) (domain.Order, error) {
+	f.nextID++
+	order.OrderID = "ord_test" + strings.Repeat("0", f.nextID)
+	order.Status = domain.OrderStatusCreated
+	f.items[order.OrderID] = order
+	return order, nil
+}
+
+func (f *fakeOrders) GetByID(_ context.Context, orderID string) (domain.Order, error) {
+	order, ok := f.items[orderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	return order, nil
+}
+
+func (f *fakeOrders) GetByTelegramChargeID(_ context.Context, chargeID string) (domain.Order, error) {
+	for _, order := range f.items {
+		if order.TelegramChargeID == chargeID {
+			return order, nil
+		}
+	}
+	return domain.Order{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeOrders) Transition(_ context.Context, t domain.OrderTransition) (domain.Order, error) {
+	f.transitions++
+	if len(f.transitionErrs) > 0 {
+		err := f.transitionErrs[0]
+		f.transitionErrs = f.transitionErrs[1:]
+		return domain.Order{}, err
+	}
+	order, ok := f.items[t.OrderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	if !domain.CanTransitionOrder(t.From, t.To) {
+		return domain.Order{}, &domain.InvalidTransitionError{OrderID: t.OrderID, From: t.From, To: t.To}
+	}
+	if order.Status != t.From {
+		return order, &domain.StatusConflictError{OrderID: t.OrderID, Expected: t.From, Actual: order.Status}
+	}
+	order.Status = t.To
+	if t.TelegramChargeID != "" {
+		order.TelegramChargeID = t.TelegramChargeID
+	}
+	if t.ProviderChargeID != "" {
+		order.ProviderChargeID = t.ProviderChargeID
+	}
+	if t.PayerUserID != 0 {
+		order.PayerUserID = t.PayerUserID
+	}
+	f.items[t.OrderID] = order
+	return order, nil
+}
+
+type fakeMerchants map[int64]domain.Merchant
+
+func (f fakeMerchants) GetByGroupChatID(_ context.Context, chatID int64) (domain.Merchant, error) {
+	merchant, ok := f[chatID]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	return merchant, nil
+}
+
+type fakeClient struct {
+	enabled      bool
+	err          error
+	invoices     []telegram.Invoice
+	refunds      []string
+	transactions []telegram.StarTransaction
+}
+
+func (f *fakeClient) PaymentsEnabled() bool { return f.enabled }
+
+func (f *fakeClient) SendInvoice(_ context.Context, _ int64, invoice telegram.Invoice) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.invoices = append(f.invoices, invoice)
+	return len(f.invoices), nil
+}
+
+func (f *fakeClient) RefundStarPayment(_ context.Context, userID int64, chargeID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.refunds = append(f.refunds, fmt.Sprintf("%d:%s", userID, chargeID))
+	return nil
+}
+
+func (f *fakeClient) StarBalance(context.Context) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return 1500, nil
+}
+
+func (f *fakeClient) StarTransactions(_ context.Context, offset, limit int) ([]telegram.StarTransaction, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	end := min(offset+limit, len(f.transactions))
+	if offset >= end {
+		return nil, nil
+	}
+	return f.transactions[offset:end], nil
+}
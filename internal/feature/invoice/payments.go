@@ -0,0 +1,159 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const (
+	orderMissingText    = "This order no longer exists."
+	orderNotPayableText = "This order is no longer awaiting payment."
+	orderMismatchText   = "The invoice does not match this order."
+)
+
+const (
+	// paymentAttempts bounds how often recording a charged payment is tried
+	// before it is left to manual reconciliation; paymentRetryDelay is the
+	// pause between tries.
+	paymentAttempts   = 3
+	paymentRetryDelay = 500 * time.Millisecond
+)
+
+// errPaymentMismatch reports a payment that does not match its order. Retrying
+// cannot fix it.
+var errPaymentMismatch = errors.New("payment does not match order")
+
+// PreCheckout approves a pre-checkout query only while the order behind the
+// invoice payload is pending and the amount and currency still match.
+func (s *Service) PreCheckout(ctx context.Context, req telegram.PreCheckoutRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+
+	found, err := s.orders.GetByID(ctx, req.Payload)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return orderMissingText, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if found.Channel != Channel {
+		return orderMissingText, nil
+	}
+	if found.Status != domain.OrderStatusPending {
+		return orderNotPayableText, nil
+	}
+	if found.AmountMinor != req.Amount || found.Currency != req.Currency {
+		return orderMismatchText, nil
+	}
+
+	return "", nil
+}
+
+// PaymentReceived marks the order paid and records the Telegram and provider
+// charge IDs. The payer has already been charged, so an order that expired in
+// the meantime is paid late, and store failures are retried. A repeated
+// delivery of the same payment is ignored.
+func (s *Service) PaymentReceived(ctx context.Context, req telegram.PaymentRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+
+	for attempt := 1; ; attempt++ {
+		text, err := s.recordPayment(ctx, req)
+		if err == nil || !retryablePaymentError(err) || attempt == paymentAttempts {
+			return text, err
+		}
+
+		s.logger.WithFields(logging.Fields{
+			"event":                      "invoice_payment_retry",
+			"payload":                    req.Payload,
+			"telegram_payment_charge_id": req.TelegramChargeID,
+			"attempt":                    attempt,
+		}).WithError(err).Warn("retrying telegram payment")
+
+		timer := time.NewTimer(s.retryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", err
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Service) recordPayment(ctx context.Context, req telegram.PaymentRequest) (string, error) {
+	found, err := s.orders.GetByID(ctx, req.Payload)
+	if err != nil {
+		return "", fmt.Errorf("load paid order %s: %w", req.Payload, err)
+	}
+	if found.Channel != Channel || found.AmountMinor != req.Amount || found.Currency != req.Currency {
+		return "", fmt.Errorf("%w: %d %s for order %s", errPaymentMismatch, req.Amount, req.Currency, found.OrderID)
+	}
+
+	t := domain.OrderTransition{
+		OrderID:          found.OrderID,
+		From:             domain.OrderStatusPending,
+		To:               domain.OrderStatusPaid,
+		TelegramChargeID: req.TelegramChargeID,
+		ProviderChargeID: req.ProviderChargeID,
+		PayerUserID:      req.UserID,
+		Reason:           "telegram_payment",
+	}
+	paid, err := s.orders.Transition(ctx, t)
+
+	var conflict *domain.StatusConflictError
+	if errors.As(err, &conflict) && conflict.Actual == domain.OrderStatusExpired {
+		s.logger.WithFields(logging.Fields{
+			"event":                      "invoice_paid_late",
+			"order_id":                   found.OrderID,
+			"telegram_payment_charge_id": req.TelegramChargeID,
+		}).Warn("recording telegram payment for an expired order")
+
+		t.From, t.Reason = domain.OrderStatusExpired, "telegram_payment_late"
+		paid, err = s.orders.Transition(ctx, t)
+	}
+	if errors.As(err, &conflict) && conflict.Actual == domain.OrderStatusPaid && paid.TelegramChargeID == req.TelegramChargeID {
+		s.logger.WithFields(logging.Fields{
+			"event":                      "invoice_payment_duplicate",
+			"order_id":                   found.OrderID,
+			"telegram_payment_charge_id": req.TelegramChargeID,
+		}).Info("ignored duplicate telegram payment")
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":                      "invoice_paid",
+		"order_id":                   paid.OrderID,
+		"merchant_id":                paid.MerchantID,
+		"amount_minor":               paid.AmountMinor,
+		"currency":                   paid.Currency,
+		"telegram_payment_charge_id": req.TelegramChargeID,
+		"user_id":                    req.UserID,
+	}).Info("recorded telegram payment")
+
+	return fmt.Sprintf("Payment received for order %s: %s %s.", paid.OrderID, domain.FormatAmount(paid.AmountMinor, paid.Currency), paid.Currency), nil
+}
+
+// retryablePaymentError reports whether recording a payment failed for a
+// reason that may pass, such as a lost connection, rather than because the
+// payment or the order's status rules it out.
+func retryablePaymentError(err error) bool {
+	return !errors.Is(err, mongo.ErrNoDocuments) &&
+		!errors.Is(err, errPaymentMismatch) &&
+		!errors.Is(err, domain.ErrOrderStatusConflict) &&
+		!errors.Is(err, domain.ErrInvalidOrderTransition) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
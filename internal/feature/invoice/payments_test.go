@@ -0,0 +1,138 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const testOrderID = "ord_0123456789abcdef01234567"
+
+func TestPreCheckoutValidatesOrder(t *testing.T) {
+	orders := newFakeOrders()
+	orders.items[testOrderID] = domain.Order{OrderID: testOrderID, MerchantID: "acme", AmountMinor: 1250, Currency: "USD", Channel: Channel, Status: domain.OrderStatusPending}
+	orders.items["ord_mock_channel"] = domain.Order{OrderID: "ord_mock_channel", AmountMinor: 1250, Currency: "USD", Channel: "mock", Status: domain.OrderStatusPending}
+	service := NewService(orders, testMerchants(), &fakeClient{enabled: true}, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	cases := []struct {
+		req  telegram.PreCheckoutRequest
+		want string
+	}{
+		{telegram.PreCheckoutRequest{Payload: testOrderID, Currency: "USD", Amount: 1250}, ""},
+		{telegram.PreCheckoutRequest{Payload: testOrderID, Currency: "USD", Amount: 999}, orderMismatchText},
+		{telegram.PreCheckoutRequest{Payload: testOrderID, Currency: "EUR", Amount: 1250}, orderMismatchText},
+		{telegram.PreCheckoutRequest{Payload: "ord_missing", Currency: "USD", Amount: 1250}, orderMissingText},
+		{telegram.PreCheckoutRequest{Payload: "ord_mock_channel", Currency: "USD", Amount: 1250}, orderMissingText},
+	}
+	for _, tc := range cases {
+		reason, err := service.PreCheckout(ctx, tc.req)
+		if err != nil || reason != tc.want {
+			t.Fatalf("PreCheckout(%+v) = %q err=%v, want %q", tc.req, reason, err, tc.want)
+		}
+	}
+
+	paid := orders.items[testOrderID]
+	paid.Status = domain.OrderStatusPaid
+	orders.items[testOrderID] = paid
+	if reason, _ := service.PreCheckout(ctx, cases[0].req); reason != orderNotPayableText {
+		t.Fatalf("expected paid order to be declined, got %q", reason)
+	}
+}
+
+func TestPaymentReceivedMarksOrderPaidOnce(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	orders := newFakeOrders()
+	orders.items[testOrderID] = domain.Order{OrderID: testOrderID, MerchantID: "acme", AmountMinor: 1250, Currency: "USD", Channel: Channel, Status: domain.OrderStatusPending}
+	service := NewService(orders, testMerchants(), &fakeClient{enabled: true}, nil, logrus.NewEntry(hookLogger))
+	ctx := context.Background()
+
+	req := telegram.PaymentRequest{
+		UserID:           7,
+		ChatID:           -100,
+		Payload:          testOrderID,
+		Currency:         "USD",
+		Amount:           1250,
+		TelegramChargeID: "tg_charge",
+		ProviderChargeID: "prov_charge",
+	}
+	reply, err := service.PaymentReceived(ctx, req)
+	if err != nil {
+		t.Fatalf("PaymentReceived returned error: %v", err)
+	}
+	if reply != "Payment received for order "+testOrderID+": 12.50 USD." {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+	paid := orders.items[testOrderID]
+	if paid.Status != domain.OrderStatusPaid || paid.TelegramChargeID != "tg_charge" || paid.ProviderChargeID != "prov_charge" || paid.PayerUserID != 7 {
+		t.Fatalf("unexpected paid order %+v", paid)
+	}
+
+	reply, err = service.PaymentReceived(ctx, req)
+	if err != nil || reply != "" {
+		t.Fatalf("expected duplicate payment to be ignored, got %q err=%v", reply, err)
+	}
+	if last := hook.LastEntry(); last == nil || last.Data["event"] != "invoice_payment_duplicate" {
+		t.Fatalf("expected duplicate to be logged, got %+v", last)
+	}
+
+	req.TelegramChargeID = "other_charge"
+	if _, err := service.PaymentReceived(ctx, req); err == nil {
+		t.Fatalf("expected a second charge for a paid order to be reported")
+	}
+	req.Amount = 1
+	if _, err := service.PaymentReceived(ctx, req); err == nil {
+		t.Fatalf("expected amount mismatch to be reported")
+	}
+}
+
+func TestPaymentReceivedRecordsLateAndRetriedPayments(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	orders := newFakeOrders()
+	orders.items[testOrderID] = domain.Order{OrderID: testOrderID, MerchantID: "acme", AmountMinor: 1250, Currency: "USD", Channel: Channel, Status: domain.OrderStatusExpired}
+	service := NewService(orders, testMerchants(), &fakeClient{enabled: true}, nil, logrus.NewEntry(hookLogger))
+	service.retryDelay = 0
+	ctx := context.Background()
+
+	req := telegram.PaymentRequest{UserID: 7, Payload: testOrderID, Currency: "USD", Amount: 1250, TelegramChargeID: "tg_late"}
+	orders.transitionErrs = []error{errors.New("connection reset")}
+	if reply, err := service.PaymentReceived(ctx, req); err != nil || reply == "" {
+		t.Fatalf("expected late payment to be recorded after a retry, got %q err=%v", reply, err)
+	}
+	if paid := orders.items[testOrderID]; paid.Status != domain.OrderStatusPaid || paid.TelegramChargeID != "tg_late" {
+		t.Fatalf("expected expired order to be paid late, got %+v", paid)
+	}
+	for _, event := range []string{"invoice_payment_retry", "invoice_paid_late", "invoice_paid"} {
+		if findEntry(hook.AllEntries(), event) == nil {
+			t.Fatalf("expected %s log entry", event)
+		}
+	}
+
+	orders.transitions = 0
+	orders.transitionErrs = []error{errors.New("mongo down"), errors.New("mongo down"), errors.New("mongo down")}
+	req.TelegramChargeID = "tg_other"
+	if _, err := service.PaymentReceived(ctx, req); err == nil || orders.transitions != paymentAttempts {
+		t.Fatalf("expected %d attempts before giving up, got %d err=%v", paymentAttempts, orders.transitions, err)
+	}
+
+	orders.transitions = 0
+	req.Amount = 1
+	if _, err := service.PaymentReceived(ctx, req); !errors.Is(err, errPaymentMismatch) || orders.transitions != 0 {
+		t.Fatalf("expected mismatch to fail without retrying, got %d transitions err=%v", orders.transitions, err)
+	}
+}
+
+func findEntry(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const (
+	refundStarUsage = "Usage: /refund_star <telegram_payment_charge_id>"
+	starsUsage      = "Usage: /stars [n] [page]"
+	// defaultStarsPageSize and maxStarsPageSize bound the transactions listed
+	// by /stars.
+	defaultStarsPageSize = 10
+	maxStarsPageSize     = 50
+)
+
+func (s *Service) refundStarCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	if len(req.Args) != 1 {
+		return refundStarUsage, nil
+	}
+	chargeID := req.Args[0]
+
+	found, err := s.orders.GetByTelegramChargeID(ctx, chargeID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Sprintf("No order was paid with charge %s.", chargeID), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	entry := audit.Entry{
+		ActorID:   req.UserID,
+		ActorRole: req.Role,
+		ChatID:    req.ChatID,
+		Action:    audit.ActionStarRefund,
+		Target:    audit.OrderTarget(found.OrderID),
+		Before:    found.Status,
+		After:     domain.OrderStatusRefunded,
+	}
+
+	if reason, reply := checkRefund(found); reason != "" {
+		entry.Outcome, entry.Reason = audit.OutcomeDenied, reason
+		s.record(ctx, entry)
+		return reply, nil
+	}
+
+	if err := s.client.RefundStarPayment(ctx, found.PayerUserID, chargeID); err != nil {
+		entry.Outcome, entry.Reason = audit.OutcomeFailed, err.Error()
+		s.record(ctx, entry)
+		if telegram.IsBadRequest(err) {
+			return fmt.Sprintf("Telegram refused the refund for order %s: %v", found.OrderID, err), nil
+		}
+		return "", err
+	}
+
+	// The stars are back with the payer at this point, so a failure to
+	// record it is logged with the charge ID for manual reconciliation.
+	if _, err := s.orders.Transition(ctx, domain.OrderTransition{
+		OrderID: found.OrderID,
+		From:    domain.OrderStatusPaid,
+		To:      domain.OrderStatusRefunded,
+		Reason:  "star_refund",
+	}); err != nil {
+		entry.Outcome, entry.Reason = audit.OutcomeFailed, "refunded_unrecorded: "+err.Error()
+		s.record(ctx, entry)
+		s.logger.WithFields(logging.Fields{
+			"event":                      "star_refund_record_failed",
+			"order_id":                   found.OrderID,
+			"telegram_payment_charge_id": chargeID,
+			"user_id":                    req.UserID,
+		}).WithError(err).Error("refunded stars but failed to update the order")
+		return "", err
+	}
+
+	entry.Outcome = audit.OutcomeSuccess
+	s.record(ctx, entry)
+
+	s.logger.WithFields(logging.Fields{
+		"event":                      "star_refunded",
+		"order_id":                   found.OrderID,
+		"merchant_id":                found.MerchantID,
+		"amount_minor":               found.AmountMinor,
+		"telegram_payment_charge_id": chargeID,
+		"payer_user_id":              found.PayerUserID,
+		"user_id":                    req.UserID,
+	}).Info("refunded telegram stars payment")
+
+	return fmt.Sprintf("Refunded %d XTR to user %d for order %s.", found.AmountMinor, found.PayerUserID, found.OrderID), nil
+}
+
+// checkRefund returns the audit reason and reply explaining why an order's
+// payment cannot be refunded in Stars, or empty strings when it can.
+func checkRefund(found domain.Order) (string, string) {
+	switch {
+	case found.Currency != domain.CurrencyStars:
+		return "not_stars", fmt.Sprintf("Order %s was paid in %s; only Telegram Stars payments can be refunded here.", found.OrderID, found.Currency)
+	case found.Status != domain.OrderStatusPaid:
+		return "not_paid", fmt.Sprintf("Order %s is %s; only paid orders can be refunded.", found.OrderID, found.Status)
+	case found.PayerUserID == 0:
+		return "payer_unknown", fmt.Sprintf("Order %s has no recorded payer to refund.", found.OrderID)
+	}
+
+	return "", ""
+}
+
+func (s *Service) starsCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+
+	size, page, ok := parseStarsPage(req.Args)
+	if !ok {
+		return fmt.Sprintf("%s (n: 1-%d, page: 1 or more)", starsUsage, maxStarsPageSize), nil
+	}
+
+	balance, err := s.client.StarBalance(ctx)
+	if err != nil {
+		return "", err
+	}
+	transactions, err := s.client.StarTransactions(ctx, (page-1)*size, size)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{fmt.Sprintf("Stars balance: %d XTR", balance)}
+	if len(transactions) == 0 {
+		lines = append(lines, fmt.Sprintf("No transactions on page %d.", page))
+		return strings.Join(lines, "\n"), nil
+	}
+
+	lines = append(lines, fmt.Sprintf("Transactions, page %d:", page))
+	for _, tx := range transactions {
+		lines = append(lines, formatStarTransaction(tx))
+	}
+	if len(transactions) == size {
+		lines = append(lines, fmt.Sprintf("Older: /stars %d %d", size, page+1))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// parseStarsPage reads the optional page size and 1-based page number.
+func parseStarsPage(args []string) (int, int, bool) {
+	size, page := defaultStarsPageSize, 1
+	if len(args) > 2 {
+		return 0, 0, false
+	}
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > maxStarsPageSize {
+			return 0, 0, false
+		}
+		size = n
+	}
+	if len(args) > 1 {
+		p, err := strconv.Atoi(args[1])
+		if err != nil || p < 1 {
+			return 0, 0, false
+		}
+		page = p
+	}
+
+	return size, page, true
+}
+
+func formatStarTransaction(tx telegram.StarTransaction) string {
+	sign, direction := "-", "to"
+	if tx.Incoming {
+		sign, direction = "+", "from"
+	}
+
+	partner := tx.Partner
+	if partner == "" {
+		partner = "unknown"
+	}
+	if tx.UserID != 0 {
+		partner = fmt.Sprintf("user %d", tx.UserID)
+	}
+
+	line := fmt.Sprintf("- %s %s%d XTR %s %s", tx.Date.UTC().Format(time.RFC3339), sign, tx.Amount, direction, partner)
+	if tx.Payload != "" {
+		line += fmt.Sprintf(" (order_id: %s)", tx.Payload)
+	}
+
+	return line
+}
+
+func (s *Service) record(ctx context.Context, entry audit.Entry) {
+	if s.audit != nil {
+		s.audit.Record(ctx, entry)
+	}
+}
@@ -0,0 +1,136 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+func TestRefundStarCommand(t *testing.T) {
+	orders := newFakeOrders()
+	orders.items[testOrderID] = domain.Order{OrderID: testOrderID, MerchantID: "acme", AmountMinor: 50, Currency: domain.CurrencyStars, Channel: Channel, Status: domain.OrderStatusPaid, TelegramChargeID: "stxCharge", PayerUserID: 42}
+	orders.items["ord_usd_paid"] = domain.Order{OrderID: "ord_usd_paid", AmountMinor: 1250, Currency: "USD", Channel: Channel, Status: domain.OrderStatusPaid, TelegramChargeID: "usdCharge", PayerUserID: 42}
+	client := &fakeClient{}
+	auditor := &recordingAuditor{}
+	service := NewService(orders, testMerchants(), client, auditor, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+	owner := func(args ...string) telegram.CommandRequest {
+		return telegram.CommandRequest{UserID: 1, ChatID: 1, Role: domain.RoleOwner, Args: args}
+	}
+
+	reply, err := service.refundStarCommand(ctx, owner("stxCharge"))
+	if err != nil || reply != "Refunded 50 XTR to user 42 for order "+testOrderID+"." {
+		t.Fatalf("unexpected refund reply %q err=%v", reply, err)
+	}
+	if len(client.refunds) != 1 || client.refunds[0] != "42:stxCharge" {
+		t.Fatalf("expected refund to the payer, got %v", client.refunds)
+	}
+	if orders.items[testOrderID].Status != domain.OrderStatusRefunded {
+		t.Fatalf("expected order to be refunded, got %q", orders.items[testOrderID].Status)
+	}
+
+	for _, tc := range []struct {
+		req  telegram.CommandRequest
+		want string
+	}{
+		{owner(), refundStarUsage},
+		{owner("missing"), "No order was paid with charge missing."},
+		{owner("usdCharge"), "Order ord_usd_paid was paid in USD"},
+		{owner("stxCharge"), "Order " + testOrderID + " is refunded"},
+	} {
+		reply, err := service.refundStarCommand(ctx, tc.req)
+		if err != nil || !strings.HasPrefix(reply, tc.want) {
+			t.Fatalf("refund_star(%v): expected reply starting with %q, got %q err=%v", tc.req.Args, tc.want, reply, err)
+		}
+	}
+	if len(client.refunds) != 1 {
+		t.Fatalf("expected refused refunds not to reach Telegram, got %v", client.refunds)
+	}
+
+	if len(auditor.entries) != 3 {
+		t.Fatalf("expected success and two denials to be audited, got %+v", auditor.entries)
+	}
+	if got := auditor.entries[0]; got.Action != audit.ActionStarRefund || got.Outcome != audit.OutcomeSuccess || got.Target != "order:"+testOrderID || got.Before != domain.OrderStatusPaid || got.ActorID != 1 {
+		t.Fatalf("unexpected success entry %+v", got)
+	}
+	if auditor.entries[1].Reason != "not_stars" || auditor.entries[2].Reason != "not_paid" {
+		t.Fatalf("unexpected denial reasons %+v", auditor.entries[1:])
+	}
+}
+
+func TestRefundStarCommandReportsTelegramRejection(t *testing.T) {
+	orders := newFakeOrders()
+	orders.items[testOrderID] = domain.Order{OrderID: testOrderID, AmountMinor: 50, Currency: domain.CurrencyStars, Channel: Channel, Status: domain.OrderStatusPaid, TelegramChargeID: "stxCharge", PayerUserID: 42}
+	client := &fakeClient{err: fmt.Errorf("%w, CHARGE_ALREADY_REFUNDED", bot.ErrorBadRequest)}
+	auditor := &recordingAuditor{}
+	service := NewService(orders, testMerchants(), client, auditor, logrus.NewEntry(logrus.New()))
+	req := telegram.CommandRequest{UserID: 1, Role: domain.RoleOwner, Args: []string{"stxCharge"}}
+
+	reply, err := service.refundStarCommand(context.Background(), req)
+	if err != nil || !strings.Contains(reply, "CHARGE_ALREADY_REFUNDED") {
+		t.Fatalf("expected Telegram's reason in the reply, got %q err=%v", reply, err)
+	}
+	if orders.items[testOrderID].Status != domain.OrderStatusPaid {
+		t.Fatalf("expected order to stay paid, got %q", orders.items[testOrderID].Status)
+	}
+	if len(auditor.entries) != 1 || auditor.entries[0].Outcome != audit.OutcomeFailed {
+		t.Fatalf("expected failed refund to be audited, got %+v", auditor.entries)
+	}
+
+	client.err = errors.New("connection reset")
+	if _, err := service.refundStarCommand(context.Background(), req); err == nil {
+		t.Fatalf("expected transport errors to be returned")
+	}
+}
+
+func TestStarsCommandListsTransactions(t *testing.T) {
+	date := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	client := &fakeClient{transactions: []telegram.StarTransaction{
+		{ID: "tx1", Amount: 50, Date: date, Incoming: true, Partner: "user", UserID: 42, Payload: testOrderID},
+		{ID: "tx2", Amount: 1000, Date: date, Partner: "fragment"},
+		{ID: "tx3", Amount: 20, Date: date, Incoming: true, Partner: "user", UserID: 43},
+	}}
+	service := NewService(newFakeOrders(), testMerchants(), client, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	reply, err := service.starsCommand(ctx, telegram.CommandRequest{Args: []string{"2"}})
+	if err != nil {
+		t.Fatalf("starsCommand returned error: %v", err)
+	}
+	want := strings.Join([]string{
+		"Stars balance: 1500 XTR",
+		"Transactions, page 1:",
+		"- 2026-01-02T03:00:00Z +50 XTR from user 42 (order_id: " + testOrderID + ")",
+		"- 2026-01-02T03:00:00Z -1000 XTR to fragment",
+		"Older: /stars 2 2",
+	}, "\n")
+	if reply != want {
+		t.Fatalf("unexpected stars reply:\n%s\nwant:\n%s", reply, want)
+	}
+
+	reply, _ = service.starsCommand(ctx, telegram.CommandRequest{Args: []string{"2", "3"}})
+	if !strings.HasSuffix(reply, "No transactions on page 3.") {
+		t.Fatalf("expected empty page notice, got %q", reply)
+	}
+	if reply, _ := service.starsCommand(ctx, telegram.CommandRequest{Args: []string{"500"}}); !strings.HasPrefix(reply, starsUsage) {
+		t.Fatalf("expected usage for oversized page, got %q", reply)
+	}
+}
+
+type recordingAuditor struct {
+	entries []audit.Entry
+}
+
+func (r *recordingAuditor) Record(_ context.Context, entry audit.Entry) {
+	r.entries = append(r.entries, entry)
+}
@@ -0,0 +1,350 @@
+// Package merchant provides the admin commands that create merchants and link
+// them to their Telegram operations groups.
+package merchant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+// createDialog is the step-by-step form behind /merchant_create without
+// arguments.
+const createDialog = "merchant_create"
+
+const (
+	createUsage = "Usage: /merchant_create <merchant_id> <fee_bps> <currency> <name>, or /merchant_create alone to be asked step by step"
+	bindUsage   = "Usage: /merchant_bind <merchant_id>"
+	infoUsage   = "Usage: /merchant_info <merchant_id>"
+	notifyUsage = "Usage: /merchant_notify <merchant_id> <url>"
+)
+
+type merchantStore interface {
+	Create(ctx context.Context, merchant domain.Merchant) (domain.Merchant, error)
+	GetByID(ctx context.Context, merchantID string) (domain.Merchant, error)
+	GetByGroupChatID(ctx context.Context, chatID int64) (domain.Merchant, error)
+	BindGroup(ctx context.Context, merchantID string, chatID int64) (domain.Merchant, error)
+	SetNotifyURL(ctx context.Context, merchantID, notifyURL, secret string) (domain.Merchant, error)
+}
+
+type dialogStarter interface {
+	StartDialog(ctx context.Context, name string, chatID, userID int64, values map[string]string) (string, error)
+}
+
+// Service implements the merchant management commands.
+type Service struct {
+	merchants merchantStore
+	dialogs   dialogStarter
+	logger    *logrus.Entry
+}
+
+// NewService constructs a Service backed by the merchant repository. dialogs
+// may be nil, in which case /merchant_create only accepts inline arguments.
+func NewService(merchants merchantStore, dialogs dialogStarter, logger *logrus.Entry) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Service{
+		merchants: merchants,
+		dialogs:   dialogs,
+		logger:    logger,
+	}
+}
+
+// Commands returns the merchant commands for registration with the Telegram
+// client. All of them require at least the admin role.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			Name:        "merchant_create",
+			Description: "Create a merchant account",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.create),
+		},
+		{
+			Name:        "merchant_bind",
+			Description: "Bind this group to a merchant",
+			MinRole:     domain.RoleAdmin,
+			ChatTypes:   []string{telegram.ChatTypeGroup},
+			Handler:     telegram.ReplyHandler(s.logger, s.bind),
+		},
+		{
+			Name:        "merchant_info",
+			Description: "Show merchant details",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.info),
+		},
+		{
+			// Private only: the reply contains the new signing secret.
+			Name:        "merchant_notify",
+			Description: "Set a merchant's notification URL",
+			MinRole:     domain.RoleAdmin,
+			ChatTypes:   []string{telegram.ChatTypePrivate},
+			Handler:     telegram.ReplyHandler(s.logger, s.notify),
+		},
+	}
+}
+
+// Dialogs returns the merchant dialogs for registration with the Telegram
+// client.
+func (s *Service) Dialogs() []telegram.Dialog {
+	return []telegram.Dialog{
+		{
+			Name:    createDialog,
+			Command: "merchant_create",
+			Steps: []telegram.DialogStep{
+				{Key: "merchant_id", Prompt: "Send the merchant ID (3-32 characters of a-z, 0-9, _ and -).", Validate: validateMerchantIDAnswer},
+				{Key: "fee_bps", Prompt: "Send the fee rate in basis points, e.g. 250 for 2.5%.", Validate: validateFeeAnswer},
+				{Key: "currency", Prompt: "Send the settlement currency, e.g. USDT.", Validate: validateCurrencyAnswer},
+				{Key: "name", Prompt: "Send the merchant's display name."},
+			},
+			Complete: s.completeCreate,
+		},
+	}
+}
+
+func (s *Service) create(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.merchants == nil {
+		return "", errors.New("merchant service is not initialized")
+	}
+	if len(req.Args) == 0 && s.dialogs != nil {
+		return s.dialogs.StartDialog(ctx, createDialog, req.ChatID, req.UserID, nil)
+	}
+	if len(req.Args) < 4 {
+		return createUsage, nil
+	}
+
+	feeRate, err := strconv.ParseInt(req.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Sprintf("Invalid fee rate %q: use an integer number of basis points.", req.Args[1]), nil
+	}
+
+	return s.createMerchant(ctx, req.UserID, domain.Merchant{
+		MerchantID:         req.Args[0],
+		Name:               strings.Join(req.Args[3:], " "),
+		FeeRateBps:         feeRate,
+		SettlementCurrency: req.Args[2],
+	})
+}
+
+// completeCreate creates the merchant collected by the create dialog. The
+// answers were validated step by step, so only the existence check remains.
+func (s *Service) completeCreate(ctx context.Context, req telegram.DialogRequest) (string, error) {
+	if s == nil || s.merchants == nil {
+		return "", errors.New("merchant service is not initialized")
+	}
+
+	feeRate, err := strconv.ParseInt(req.Values["fee_bps"], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("parse dialog fee rate: %w", err)
+	}
+
+	return s.createMerchant(ctx, req.UserID, domain.Merchant{
+		MerchantID:         req.Values["merchant_id"],
+		Name:               req.Values["name"],
+		FeeRateBps:         feeRate,
+		SettlementCurrency: req.Values["currency"],
+	})
+}
+
+func (s *Service) createMerchant(ctx context.Context, userID int64, merchant domain.Merchant) (string, error) {
+	merchant.MerchantID = domain.NormalizeMerchantID(merchant.MerchantID)
+	if err := validateInput(merchant); err != nil {
+		return fmt.Sprintf("Invalid merchant: %v", err), nil
+	}
+
+	if _, err := s.merchants.GetByID(ctx, merchant.MerchantID); err == nil {
+		return fmt.Sprintf("Merchant %s already exists.", merchant.MerchantID), nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", err
+	}
+
+	created, err := s.merchants.Create(ctx, merchant)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Sprintf("Merchant %s already exists.", merchant.MerchantID), nil
+		}
+		return "", err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "merchant_created",
+		"merchant_id": created.MerchantID,
+		"user_id":     userID,
+	}).Info("created merchant")
+
+	return "Merchant created.\n" + merchantDetails(created), nil
+}
+
+func (s *Service) bind(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.merchants == nil {
+		return "", errors.New("merchant service is not initialized")
+	}
+	if len(req.Args) != 1 {
+		return bindUsage, nil
+	}
+
+	merchant, err := s.merchants.BindGroup(ctx, req.Args[0], req.ChatID)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return fmt.Sprintf("Merchant %s not found.", domain.NormalizeMerchantID(req.Args[0])), nil
+	case errors.Is(err, domain.ErrGroupBoundToOtherMerchant):
+		return "This group is already bound to another merchant.", nil
+	case err != nil:
+		return "", err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "merchant_group_bound",
+		"merchant_id": merchant.MerchantID,
+		"chat_id":     req.ChatID,
+		"user_id":     req.UserID,
+	}).Info("bound group to merchant")
+
+	return fmt.Sprintf("Group bound to merchant %s.", merchant.MerchantID), nil
+}
+
+func (s *Service) info(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.merchants == nil {
+		return "", errors.New("merchant service is not initialized")
+	}
+
+	var (
+		merchant domain.Merchant
+		err      error
+	)
+	switch {
+	case len(req.Args) == 1:
+		merchant, err = s.merchants.GetByID(ctx, req.Args[0])
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Sprintf("Merchant %s not found.", domain.NormalizeMerchantID(req.Args[0])), nil
+		}
+	case len(req.Args) == 0 && req.ChatType == telegram.ChatTypeGroup:
+		merchant, err = s.merchants.GetByGroupChatID(ctx, req.ChatID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "This group is not bound to a merchant.", nil
+		}
+	default:
+		return infoUsage, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return merchantDetails(merchant), nil
+}
+
+func (s *Service) notify(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.merchants == nil {
+		return "", errors.New("merchant service is not initialized")
+	}
+	if len(req.Args) != 2 {
+		return notifyUsage, nil
+	}
+	if err := domain.ValidateNotifyURL(req.Args[1]); err != nil {
+		return fmt.Sprintf("Invalid URL: %v", err), nil
+	}
+
+	secret, err := domain.NewNotifySecret()
+	if err != nil {
+		return "", err
+	}
+
+	merchant, err := s.merchants.SetNotifyURL(ctx, req.Args[0], req.Args[1], secret)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Sprintf("Merchant %s not found.", domain.NormalizeMerchantID(req.Args[0])), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "merchant_notify_url_set",
+		"merchant_id": merchant.MerchantID,
+		"user_id":     req.UserID,
+	}).Info("set merchant notify url")
+
+	return fmt.Sprintf("Notify URL for %s set to %s.\nSigning secret (shown once): %s", merchant.MerchantID, merchant.NotifyURL, secret), nil
+}
+
+// validateMerchantIDAnswer, validateFeeAnswer and validateCurrencyAnswer check
+// the merchant_create dialog's answers and return them normalized.
+func validateMerchantIDAnswer(text string) (string, error) {
+	merchantID := domain.NormalizeMerchantID(text)
+	if err := domain.ValidateMerchantID(merchantID); err != nil {
+		return "", fmt.Errorf("invalid merchant: %v", err)
+	}
+
+	return merchantID, nil
+}
+
+func validateFeeAnswer(text string) (string, error) {
+	feeRate, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid fee rate %q: use an integer number of basis points", text)
+	}
+	if err := domain.ValidateFeeRateBps(feeRate); err != nil {
+		return "", fmt.Errorf("invalid merchant: %v", err)
+	}
+
+	return strconv.FormatInt(feeRate, 10), nil
+}
+
+func validateCurrencyAnswer(text string) (string, error) {
+	currency := strings.ToUpper(text)
+	if err := domain.ValidateSettlementCurrency(currency); err != nil {
+		return "", fmt.Errorf("invalid merchant: %v", err)
+	}
+
+	return currency, nil
+}
+
+// validateInput applies the repository's normalization and validation so input
+// mistakes are reported to the caller instead of failing the command.
+func validateInput(merchant domain.Merchant) error {
+	merchant.Name = strings.TrimSpace(merchant.Name)
+	merchant.SettlementCurrency = strings.ToUpper(strings.TrimSpace(merchant.SettlementCurrency))
+	if merchant.Status == "" {
+		merchant.Status = domain.MerchantStatusActive
+	}
+
+	return merchant.Validate()
+}
+
+func merchantDetails(merchant domain.Merchant) string {
+	groups := "none"
+	if len(merchant.GroupChatIDs) > 0 {
+		ids := make([]string, 0, len(merchant.GroupChatIDs))
+		for _, id := range merchant.GroupChatIDs {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+		groups = strings.Join(ids, ", ")
+	}
+
+	notifyURL := merchant.NotifyURL
+	if notifyURL == "" {
+		notifyURL = "none"
+	}
+
+	lines := []string{
+		fmt.Sprintf("merchant_id: %s", merchant.MerchantID),
+		fmt.Sprintf("name: %s", merchant.Name),
+		fmt.Sprintf("status: %s", merchant.Status),
+		fmt.Sprintf("fee_rate_bps: %d", merchant.FeeRateBps),
+		fmt.Sprintf("settlement_currency: %s", merchant.SettlementCurrency),
+		fmt.Sprintf("groups: %s", groups),
+		fmt.Sprintf("notify_url: %s", notifyURL),
+	}
+
+	return strings.Join(lines, "\n")
+}
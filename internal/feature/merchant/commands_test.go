@@ -0,0 +1,307 @@
+package merchant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+func TestCommandsRequireAdmin(t *testing.T) {
+	service := NewService(newFakeMerchants(), nil, logrus.NewEntry(logrus.New()))
+
+	commands := service.Commands()
+	if len(commands) != 4 {
+		t.Fatalf("expected 4 merchant commands, got %d", len(commands))
+	}
+	for _, cmd := range commands {
+		if cmd.MinRole != domain.RoleAdmin {
+			t.Fatalf("expected %s to require admin, got %q", cmd.Name, cmd.MinRole)
+		}
+		if cmd.Handler == nil {
+			t.Fatalf("expected %s to have a handler", cmd.Name)
+		}
+	}
+	if bind := commands[1]; bind.Name != "merchant_bind" || len(bind.ChatTypes) != 1 || bind.ChatTypes[0] != telegram.ChatTypeGroup {
+		t.Fatalf("expected merchant_bind to be group-only, got %+v", bind)
+	}
+	if notify := commands[3]; notify.Name != "merchant_notify" || len(notify.ChatTypes) != 1 || notify.ChatTypes[0] != telegram.ChatTypePrivate {
+		t.Fatalf("expected merchant_notify to be private-only, got %+v", notify)
+	}
+}
+
+func TestCreateMerchant(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	store := newFakeMerchants()
+	service := NewService(store, nil, logrus.NewEntry(hookLogger))
+	ctx := context.Background()
+
+	reply, err := service.create(ctx, telegram.CommandRequest{UserID: 1, Args: []string{"Shop_01", "250", "usdt", "Demo", "Shop"}})
+	if err != nil {
+		t.Fatalf("create returned error: %v", err)
+	}
+	if !strings.Contains(reply, "merchant_id: shop_01") || !strings.Contains(reply, "name: Demo Shop") {
+		t.Fatalf("unexpected create reply: %q", reply)
+	}
+	if _, ok := store.merchants["shop_01"]; !ok {
+		t.Fatalf("expected merchant to be stored")
+	}
+	if findEvent(hook.AllEntries(), "merchant_created") == nil {
+		t.Fatalf("expected merchant_created log entry")
+	}
+
+	replies := map[string][]string{
+		createUsage:                {"shop_02", "250"},
+		"Invalid fee rate":         {"shop_02", "abc", "USD", "Name"},
+		"Invalid merchant":         {"shop_02", "20000", "USD", "Name"},
+		"Merchant shop_01 already": {"SHOP_01", "100", "USD", "Again"},
+	}
+	for want, args := range replies {
+		reply, err := service.create(ctx, telegram.CommandRequest{Args: args})
+		if err != nil {
+			t.Fatalf("create(%v) returned error: %v", args, err)
+		}
+		if !strings.HasPrefix(reply, want) {
+			t.Fatalf("create(%v): expected reply starting with %q, got %q", args, want, reply)
+		}
+	}
+
+	store.err = errors.New("mongo down")
+	if _, err := service.create(ctx, telegram.CommandRequest{Args: []string{"shop_03", "1", "USD", "Name"}}); err == nil {
+		t.Fatalf("expected store failure to surface as error")
+	}
+}
+
+func TestCreateWithoutArgsStartsDialog(t *testing.T) {
+	store := newFakeMerchants()
+	starter := &fakeDialogStarter{prompt: "Send the merchant ID."}
+	service := NewService(store, starter, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	reply, err := service.create(ctx, telegram.CommandRequest{UserID: 1, ChatID: 5})
+	if err != nil || reply != starter.prompt {
+		t.Fatalf("expected the dialog prompt, got %q err=%v", reply, err)
+	}
+	if starter.name != createDialog || starter.chatID != 5 || starter.userID != 1 {
+		t.Fatalf("unexpected dialog start %+v", starter)
+	}
+
+	dialogs := service.Dialogs()
+	if len(dialogs) != 1 || dialogs[0].Name != createDialog || len(dialogs[0].Steps) != 4 {
+		t.Fatalf("unexpected merchant dialogs %+v", dialogs)
+	}
+	answers := map[string]string{}
+	for _, step := range dialogs[0].Steps {
+		input := map[string]string{"merchant_id": "Shop_01", "fee_bps": "250", "currency": "usdt", "name": "Demo Shop"}[step.Key]
+		if step.Validate == nil {
+			answers[step.Key] = input
+			continue
+		}
+		value, err := step.Validate(input)
+		if err != nil {
+			t.Fatalf("step %s rejected %q: %v", step.Key, input, err)
+		}
+		answers[step.Key] = value
+	}
+	if answers["merchant_id"] != "shop_01" || answers["currency"] != "USDT" {
+		t.Fatalf("expected answers to be normalized, got %v", answers)
+	}
+	for key, input := range map[int]string{0: "x", 1: "abc", 2: "usd1"} {
+		if _, err := dialogs[0].Steps[key].Validate(input); err == nil {
+			t.Fatalf("expected step %s to reject %q", dialogs[0].Steps[key].Key, input)
+		}
+	}
+	if _, err := validateFeeAnswer("20000"); err == nil || !strings.HasPrefix(err.Error(), "invalid merchant:") {
+		t.Fatalf("expected out of range fee to be rejected, got %v", err)
+	}
+
+	reply, err = dialogs[0].Complete(ctx, telegram.DialogRequest{UserID: 1, ChatID: 5, Values: answers})
+	if err != nil || !strings.HasPrefix(reply, "Merchant created.") {
+		t.Fatalf("expected merchant to be created from the dialog, got %q err=%v", reply, err)
+	}
+	if stored := store.merchants["shop_01"]; stored.FeeRateBps != 250 || stored.Name != "Demo Shop" {
+		t.Fatalf("unexpected stored merchant %+v", stored)
+	}
+
+	if reply, _ := service.create(ctx, telegram.CommandRequest{Args: []string{"shop_02"}}); reply != createUsage {
+		t.Fatalf("expected usage for partial arguments, got %q", reply)
+	}
+}
+
+func TestBindAndInfo(t *testing.T) {
+	store := newFakeMerchants()
+	store.merchants["alpha"] = domain.Merchant{MerchantID: "alpha", Name: "Alpha", Status: domain.MerchantStatusActive, SettlementCurrency: "USD"}
+	service := NewService(store, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+	group := telegram.CommandRequest{ChatID: -100, ChatType: telegram.ChatTypeGroup}
+
+	reply, err := service.info(ctx, group)
+	if err != nil || reply != "This group is not bound to a merchant." {
+		t.Fatalf("expected unbound group reply, got %q err=%v", reply, err)
+	}
+
+	bindReq := group
+	bindReq.Args = []string{"ALPHA"}
+	reply, err = service.bind(ctx, bindReq)
+	if err != nil || reply != "Group bound to merchant alpha." {
+		t.Fatalf("unexpected bind reply %q err=%v", reply, err)
+	}
+
+	reply, err = service.info(ctx, group)
+	if err != nil || !strings.Contains(reply, "groups: -100") {
+		t.Fatalf("expected info for bound group, got %q err=%v", reply, err)
+	}
+
+	bindReq.Args = []string{"missing"}
+	if reply, _ := service.bind(ctx, bindReq); reply != "Merchant missing not found." {
+		t.Fatalf("unexpected bind reply for unknown merchant: %q", reply)
+	}
+
+	store.bindErr = domain.ErrGroupBoundToOtherMerchant
+	bindReq.Args = []string{"alpha"}
+	if reply, _ := service.bind(ctx, bindReq); reply != "This group is already bound to another merchant." {
+		t.Fatalf("unexpected bind reply for conflicting group: %q", reply)
+	}
+
+	if reply, _ := service.info(ctx, telegram.CommandRequest{ChatType: telegram.ChatTypePrivate}); reply != infoUsage {
+		t.Fatalf("expected usage in private chat without args, got %q", reply)
+	}
+	if reply, _ := service.info(ctx, telegram.CommandRequest{Args: []string{"nope"}}); reply != "Merchant nope not found." {
+		t.Fatalf("unexpected info reply for unknown merchant: %q", reply)
+	}
+}
+
+func TestSetNotifyURL(t *testing.T) {
+	store := newFakeMerchants()
+	store.merchants["alpha"] = domain.Merchant{MerchantID: "alpha", Name: "Alpha", Status: domain.MerchantStatusActive}
+	service := NewService(store, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	reply, err := service.notify(ctx, telegram.CommandRequest{Args: []string{"Alpha", "https://shop.example/hook"}})
+	if err != nil {
+		t.Fatalf("notify returned error: %v", err)
+	}
+	stored := store.merchants["alpha"]
+	if stored.NotifyURL != "https://shop.example/hook" || len(stored.NotifySecret) != 48 {
+		t.Fatalf("expected notify url and secret to be stored, got %+v", stored)
+	}
+	if !strings.Contains(reply, stored.NotifySecret) {
+		t.Fatalf("expected reply to show the signing secret once, got %q", reply)
+	}
+
+	replies := map[string][]string{
+		notifyUsage:                  {"alpha"},
+		"Invalid URL":                {"alpha", "ftp://shop.example"},
+		"Merchant missing not found": {"missing", "https://shop.example/hook"},
+	}
+	for want, args := range replies {
+		reply, err := service.notify(ctx, telegram.CommandRequest{Args: args})
+		if err != nil {
+			t.Fatalf("notify(%v) returned error: %v", args, err)
+		}
+		if !strings.HasPrefix(reply, want) {
+			t.Fatalf("notify(%v): expected reply starting with %q, got %q", args, want, reply)
+		}
+	}
+
+	if reply, _ := service.info(ctx, telegram.CommandRequest{Args: []string{"alpha"}}); !strings.Contains(reply, "notify_url: https://shop.example/hook") || strings.Contains(reply, stored.NotifySecret) {
+		t.Fatalf("expected info to show notify url without the secret, got %q", reply)
+	}
+}
+
+type fakeMerchants struct {
+	merchants map[string]domain.Merchant
+	err       error
+	bindErr   error
+}
+
+func newFakeMerchants() *fakeMerchants {
+	return &fakeMerchants{merchants: make(map[string]domain.Merchant)}
+}
+
+func (f *fakeMerchants) Create(_ context.Context, merchant domain.Merchant) (domain.Merchant, error) {
+	if f.err != nil {
+		return domain.Merchant{}, f.err
+	}
+	merchant.Name = strings.TrimSpace(merchant.Name)
+	merchant.SettlementCurrency = strings.ToUpper(merchant.SettlementCurrency)
+	merchant.Status = domain.MerchantStatusActive
+	f.merchants[merchant.MerchantID] = merchant
+	return merchant, nil
+}
+
+func (f *fakeMerchants) GetByID(_ context.Context, merchantID string) (domain.Merchant, error) {
+	if f.err != nil {
+		return domain.Merchant{}, f.err
+	}
+	merchant, ok := f.merchants[domain.NormalizeMerchantID(merchantID)]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	return merchant, nil
+}
+
+func (f *fakeMerchants) GetByGroupChatID(_ context.Context, chatID int64) (domain.Merchant, error) {
+	for _, merchant := range f.merchants {
+		if merchant.HasGroup(chatID) {
+			return merchant, nil
+		}
+	}
+	return domain.Merchant{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeMerchants) BindGroup(_ context.Context, merchantID string, chatID int64) (domain.Merchant, error) {
+	if f.bindErr != nil {
+		return domain.Merchant{}, f.bindErr
+	}
+	id := domain.NormalizeMerchantID(merchantID)
+	merchant, ok := f.merchants[id]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	if !merchant.HasGroup(chatID) {
+		merchant.GroupChatIDs = append(merchant.GroupChatIDs, chatID)
+	}
+	f.merchants[id] = merchant
+	return merchant, nil
+}
+
+func (f *fakeMerchants) SetNotifyURL(_ context.Context, merchantID, notifyURL, secret string) (domain.Merchant, error) {
+	id := domain.NormalizeMerchantID(merchantID)
+	merchant, ok := f.merchants[id]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	merchant.NotifyURL = notifyURL
+	merchant.NotifySecret = secret
+	f.merchants[id] = merchant
+	return merchant, nil
+}
+
+type fakeDialogStarter struct {
+	prompt string
+	name   string
+	chatID int64
+	userID int64
+}
+
+func (f *fakeDialogStarter) StartDialog(_ context.Context, name string, chatID, userID int64, _ map[string]string) (string, error) {
+	f.name, f.chatID, f.userID = name, chatID, userID
+	return f.prompt, nil
+}
+
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Package order provides the order lookup command for merchant operators and
+// admins, and the sweep that expires unpaid orders.
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const lookupUsage = "Usage: /order <order_id>, or reply /order to a message containing an order id"
+
+var (
+	// labeledOrderID matches "order_id: <id>" style lines in forwarded
+	// messages, including the bot's own order details.
+	labeledOrderID = regexp.MustCompile(`(?i)\border[_ ]?id(?:\s*[:=]\s*|\s+)([A-Za-z0-9_-]{6,64})`)
+	// generatedOrderID matches ids produced by domain.NewOrderID anywhere in
+	// the text.
+	generatedOrderID = regexp.MustCompile(`\bord_[0-9a-f]{24}\b`)
+)
+
+type orderReader interface {
+	GetByID(ctx context.Context, orderID string) (domain.Order, error)
+}
+
+type merchantReader interface {
+	GetByGroupChatID(ctx context.Context, chatID int64) (domain.Merchant, error)
+}
+
+type notificationLister interface {
+	ListByOrder(ctx context.Context, orderID string) ([]domain.Notification, error)
+}
+
+// Service implements the order lookup command.
+type Service struct {
+	orders        orderReader
+	merchants     merchantReader
+	notifications notificationLister
+	logger        *logrus.Entry
+}
+
+// NewService constructs a Service.
+func NewService(orders orderReader, merchants merchantReader, notifications notificationLister, logger *logrus.Entry) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Service{
+		orders:        orders,
+		merchants:     merchants,
+		notifications: notifications,
+		logger:        logger,
+	}
+}
+
+// Commands returns the order commands for registration with the Telegram
+// client.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			// Requiring the user role makes the router resolve the caller's
+			// role, which decides cross-merchant access.
+			Name:        "order",
+			Description: "Look up an order",
+			MinRole:     domain.RoleUser,
+			Handler:     telegram.ReplyHandler(s.logger, s.lookup),
+		},
+	}
+}
+
+func (s *Service) lookup(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if s == nil || s.orders == nil || s.merchants == nil {
+		return "", errors.New("order service is not initialized")
+	}
+
+	orderID := ""
+	switch {
+	case len(req.Args) == 1:
+		orderID = req.Args[0]
+	case len(req.Args) == 0:
+		orderID = extractOrderID(req.ReplyText)
+	}
+	if orderID == "" {
+		return lookupUsage, nil
+	}
+
+	notFound := fmt.Sprintf("Order %s not found.", orderID)
+
+	found, err := s.orders.GetByID(ctx, orderID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return notFound, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	allowed, err := s.canView(ctx, req, found)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		// Same reply as a missing order so other merchants' ids are not
+		// confirmed.
+		s.logger.WithFields(logging.Fields{
+			"event":       "order_lookup_denied",
+			"order_id":    found.OrderID,
+			"merchant_id": found.MerchantID,
+			"user_id":     req.UserID,
+			"chat_id":     req.ChatID,
+		}).Info("denied order lookup outside the merchant group")
+		return notFound, nil
+	}
+
+	var notifications []domain.Notification
+	if s.notifications != nil {
+		notifications, err = s.notifications.ListByOrder(ctx, found.OrderID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return orderDetails(found, notifications), nil
+}
+
+// canView allows admins and owners everywhere and everyone else only in a group
+// bound to the order's merchant.
+func (s *Service) canView(ctx context.Context, req telegram.CommandRequest, found domain.Order) (bool, error) {
+	if domain.RolePriority(req.Role) >= domain.RolePriority(domain.RoleAdmin) {
+		return true, nil
+	}
+	if req.ChatType != telegram.ChatTypeGroup {
+		return false, nil
+	}
+
+	merchant, err := s.merchants.GetByGroupChatID(ctx, req.ChatID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return merchant.MerchantID == found.MerchantID, nil
+}
+
+// extractOrderID finds an order id in a replied-to message.
+func extractOrderID(text string) string {
+	if match := labeledOrderID.FindStringSubmatch(text); match != nil {
+		return match[1]
+	}
+
+	return generatedOrderID.FindString(text)
+}
+
+func orderDetails(found domain.Order, notifications []domain.Notification) string {
+	lines := []string{
+		fmt.Sprintf("order_id: %s", found.OrderID),
+		fmt.Sprintf("merchant_id: %s", found.MerchantID),
+		fmt.Sprintf("status: %s", found.Status),
+		fmt.Sprintf("amount: %s %s", domain.FormatAmount(found.AmountMinor, found.Currency), found.Currency),
+		fmt.Sprintf("channel: %s", found.Channel),
+	}
+	if found.Adapter != "" {
+		lines = append(lines, fmt.Sprintf("adapter: %s (credential_set: %s)", found.Adapter, found.CredentialSet))
+	}
+	if found.ChannelRef != "" {
+		lines = append(lines, fmt.Sprintf("channel_ref: %s", found.ChannelRef))
+	}
+	if found.TelegramChargeID != "" {
+		lines = append(lines, fmt.Sprintf("telegram_payment_charge_id: %s", found.TelegramChargeID))
+	}
+	if found.ProviderChargeID != "" {
+		lines = append(lines, fmt.Sprintf("provider_payment_charge_id: %s", found.ProviderChargeID))
+	}
+
+	lines = append(lines, fmt.Sprintf("created_at: %s", formatTime(found.CreatedAt)))
+	for _, stamp := range []struct {
+		label string
+		at    *time.Time
+	}{
+		{"pending_at", found.PendingAt},
+		{"paid_at", found.PaidAt},
+		{"failed_at", found.FailedAt},
+		{"expired_at", found.ExpiredAt},
+		{"refunded_at", found.RefundedAt},
+	} {
+		if stamp.at != nil {
+			lines = append(lines, fmt.Sprintf("%s: %s", stamp.label, formatTime(*stamp.at)))
+		}
+	}
+
+	if len(notifications) == 0 {
+		lines = append(lines, "notifications: none")
+		return strings.Join(lines, "\n")
+	}
+
+	lines = append(lines, "notifications:")
+	for _, n := range notifications {
+		line := fmt.Sprintf("- %s: %s, %d attempt(s)", n.Event, n.Status, n.AttemptCount)
+		if len(n.Attempts) > 0 {
+			last := n.Attempts[len(n.Attempts)-1]
+			line += fmt.Sprintf(", last %s", formatTime(last.At))
+			if last.HTTPStatus != 0 {
+				line += fmt.Sprintf(" HTTP %d", last.HTTPStatus)
+			}
+			if last.Error != "" {
+				line += fmt.Sprintf(" (%s)", last.Error)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
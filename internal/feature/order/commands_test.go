@@ -0,0 +1,177 @@
+package order
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const testOrderID = "ord_0123456789abcdef01234567"
+
+func TestCommandsResolveRole(t *testing.T) {
+	service := NewService(fakeOrders{}, fakeMerchants{}, nil, logrus.NewEntry(logrus.New()))
+
+	commands := service.Commands()
+	if len(commands) != 1 || commands[0].Name != "order" || commands[0].MinRole != domain.RoleUser {
+		t.Fatalf("expected /order requiring the user role, got %+v", commands)
+	}
+}
+
+func TestLookupInBoundGroup(t *testing.T) {
+	service := newTestService()
+	ctx := context.Background()
+	group := telegram.CommandRequest{ChatID: -100, ChatType: telegram.ChatTypeGroup, Role: domain.RoleUser, Args: []string{testOrderID}}
+
+	reply, err := service.lookup(ctx, group)
+	if err != nil {
+		t.Fatalf("lookup returned error: %v", err)
+	}
+	for _, want := range []string{
+		"order_id: " + testOrderID,
+		"status: paid",
+		"amount: 12.50 USD",
+		"channel: mock",
+		"channel_ref: up-1",
+		"paid_at: 2026-01-02T03:05:00Z",
+		"- order.paid: failed, 8 attempt(s), last 2026-01-02T04:00:00Z HTTP 502 (merchant responded with status 502)",
+	} {
+		if !strings.Contains(reply, want) {
+			t.Fatalf("expected reply to contain %q, got %q", want, reply)
+		}
+	}
+	if strings.Contains(reply, "refunded_at") {
+		t.Fatalf("expected unreached statuses to be omitted, got %q", reply)
+	}
+}
+
+func TestLookupFromRepliedMessage(t *testing.T) {
+	service := newTestService()
+	ctx := context.Background()
+
+	texts := []string{
+		"Forwarded from shop\nOrder ID: " + testOrderID + "\nAmount 12.50",
+		"payment " + testOrderID + " is stuck",
+		"order_id=" + testOrderID,
+	}
+	for _, text := range texts {
+		req := telegram.CommandRequest{ChatID: -100, ChatType: telegram.ChatTypeGroup, ReplyText: text}
+		reply, err := service.lookup(ctx, req)
+		if err != nil || !strings.HasPrefix(reply, "order_id: "+testOrderID) {
+			t.Fatalf("expected lookup from replied text %q, got %q err=%v", text, reply, err)
+		}
+	}
+
+	req := telegram.CommandRequest{ChatID: -100, ChatType: telegram.ChatTypeGroup, ReplyText: "no id here"}
+	if reply, _ := service.lookup(ctx, req); reply != lookupUsage {
+		t.Fatalf("expected usage when no order id is found, got %q", reply)
+	}
+}
+
+func TestLookupRestrictsOtherMerchants(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	service := newTestService()
+	service.logger = logrus.NewEntry(hookLogger)
+	ctx := context.Background()
+	notFound := "Order " + testOrderID + " not found."
+
+	denied := []telegram.CommandRequest{
+		{ChatID: -200, ChatType: telegram.ChatTypeGroup, Role: domain.RoleUser, Args: []string{testOrderID}},
+		{ChatID: -300, ChatType: telegram.ChatTypeGroup, Role: domain.RoleUser, Args: []string{testOrderID}},
+		{ChatID: 42, ChatType: telegram.ChatTypePrivate, Role: domain.RoleUser, Args: []string{testOrderID}},
+	}
+	for _, req := range denied {
+		if reply, err := service.lookup(ctx, req); err != nil || reply != notFound {
+			t.Fatalf("expected lookup from chat %d to be hidden, got %q err=%v", req.ChatID, reply, err)
+		}
+	}
+	if findEvent(hook.AllEntries(), "order_lookup_denied") == nil {
+		t.Fatalf("expected order_lookup_denied log entry")
+	}
+
+	for _, role := range []string{domain.RoleAdmin, domain.RoleOwner} {
+		req := telegram.CommandRequest{ChatID: 42, ChatType: telegram.ChatTypePrivate, Role: role, Args: []string{testOrderID}}
+		if reply, _ := service.lookup(ctx, req); !strings.HasPrefix(reply, "order_id: ") {
+			t.Fatalf("expected %s to see any order, got %q", role, reply)
+		}
+	}
+
+	missing := telegram.CommandRequest{Role: domain.RoleAdmin, Args: []string{"ord_missing"}}
+	if reply, _ := service.lookup(ctx, missing); reply != "Order ord_missing not found." {
+		t.Fatalf("unexpected reply for unknown order: %q", reply)
+	}
+}
+
+func newTestService() *Service {
+	paidAt := time.Date(2026, 1, 2, 3, 5, 0, 0, time.UTC)
+	found := domain.Order{
+		OrderID:     testOrderID,
+		MerchantID:  "shop",
+		AmountMinor: 1250,
+		Currency:    "USD",
+		Channel:     "mock",
+		ChannelRef:  "up-1",
+		Status:      domain.OrderStatusPaid,
+		CreatedAt:   time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC),
+		PaidAt:      &paidAt,
+	}
+	notifications := fakeNotifications{testOrderID: {{
+		Event:        domain.NotificationEventOrderPaid,
+		Status:       domain.NotificationStatusFailed,
+		AttemptCount: 8,
+		Attempts: []domain.NotificationAttempt{{
+			Attempt:    8,
+			At:         time.Date(2026, 1, 2, 4, 0, 0, 0, time.UTC),
+			HTTPStatus: 502,
+			Error:      "merchant responded with status 502",
+		}},
+	}}}
+	merchants := fakeMerchants{
+		-100: {MerchantID: "shop"},
+		-200: {MerchantID: "other"},
+	}
+
+	return NewService(fakeOrders{testOrderID: found}, merchants, notifications, logrus.NewEntry(logrus.New()))
+}
+
+type fakeOrders map[string]domain.Order
+
+func (f fakeOrders) GetByID(_ context.Context, orderID string) (domain.Order, error) {
+	found, ok := f[orderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	return found, nil
+}
+
+type fakeMerchants map[int64]domain.Merchant
+
+func (f fakeMerchants) GetByGroupChatID(_ context.Context, chatID int64) (domain.Merchant, error) {
+	merchant, ok := f[chatID]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	return merchant, nil
+}
+
+type fakeNotifications map[string][]domain.Notification
+
+func (f fakeNotifications) ListByOrder(_ context.Context, orderID string) ([]domain.Notification, error) {
+	return f[orderID], nil
+}
+
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+const (
+	expirySweepInterval = time.Minute
+	expiryBatchSize     = 100
+)
+
+type orderExpirer interface {
+	ListExpirable(ctx context.Context, createdBefore time.Time, limit int64) ([]domain.Order, error)
+	Transition(ctx context.Context, t domain.OrderTransition) (domain.Order, error)
+}
+
+// Expirer moves created and pending orders that outlived their TTL to
+// expired. A payment that still arrives afterwards moves the order on to paid.
+type Expirer struct {
+	orders   orderExpirer
+	ttl      time.Duration
+	interval time.Duration
+	now      func() time.Time
+	logger   *logrus.Entry
+}
+
+// NewExpirer constructs an Expirer for orders older than ttl.
+func NewExpirer(orders orderExpirer, ttl time.Duration, logger *logrus.Entry) *Expirer {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Expirer{
+		orders:   orders,
+		ttl:      ttl,
+		interval: expirySweepInterval,
+		now:      time.Now,
+		logger:   logger,
+	}
+}
+
+// Start sweeps once right away and then every minute until ctx is canceled.
+func (e *Expirer) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	e.logger.WithFields(logging.Fields{
+		"event": "order_expiry_started",
+		"ttl":   e.ttl.String(),
+	}).Info("starting order expiry sweep")
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.Sweep(ctx); err != nil && ctx.Err() == nil {
+			e.logger.WithField("event", "order_expiry_failed").WithError(err).Error("order expiry sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			e.logger.WithField("event", "order_expiry_stopped").Info("order expiry sweep stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires every created or pending order older than the TTL and
+// returns how many it moved. Orders a payment moved on in the meantime are
+// skipped; orders that fail to update are logged and retried on the next
+// sweep.
+func (e *Expirer) Sweep(ctx context.Context) (int, error) {
+	if e == nil || e.orders == nil {
+		return 0, errors.New("order expirer is not initialized")
+	}
+	if ctx == nil {
+		return 0, errors.New("context is required")
+	}
+
+	expired := 0
+	for ctx.Err() == nil {
+		batch, err := e.orders.ListExpirable(ctx, e.now().Add(-e.ttl), expiryBatchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		failed := false
+		for _, order := range batch {
+			_, err := e.orders.Transition(ctx, domain.OrderTransition{
+				OrderID: order.OrderID,
+				From:    order.Status,
+				To:      domain.OrderStatusExpired,
+				Reason:  "ttl_expired",
+			})
+			switch {
+			case err == nil:
+				expired++
+			case errors.Is(err, domain.ErrOrderStatusConflict):
+				// A callback or payment moved the order first.
+			default:
+				failed = true
+				e.logger.WithFields(logging.Fields{
+					"event":    "order_expire_failed",
+					"order_id": order.OrderID,
+					"status":   order.Status,
+				}).WithError(err).Error("failed to expire order")
+			}
+		}
+
+		// A short batch was the last one; after a failure the rest waits for
+		// the next sweep instead of listing the same orders again.
+		if len(batch) < expiryBatchSize || failed {
+			break
+		}
+	}
+
+	if expired > 0 {
+		e.logger.WithFields(logging.Fields{
+			"event": "orders_expired",
+			"count": expired,
+		}).Info("expired unpaid orders")
+	}
+
+	return expired, nil
+}
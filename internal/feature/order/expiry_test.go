@@ -0,0 +1,144 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func TestSweepExpiresStaleOrders(t *testing.T) {
+	now := time.Date(2026, 5, 6, 7, 0, 0, 0, time.UTC)
+	orders := newFakeExpiringOrders()
+	orders.add("ord_created", domain.OrderStatusCreated, now.Add(-3*time.Hour))
+	orders.add("ord_pending", domain.OrderStatusPending, now.Add(-2*time.Hour))
+	orders.add("ord_paid", domain.OrderStatusPaid, now.Add(-5*time.Hour))
+	orders.add("ord_fresh", domain.OrderStatusPending, now.Add(-10*time.Minute))
+	orders.add("ord_raced", domain.OrderStatusPending, now.Add(-4*time.Hour))
+	// A callback pays ord_raced between the listing and the transition.
+	orders.raced["ord_raced"] = domain.OrderStatusPaid
+
+	hookLogger, hook := logtest.NewNullLogger()
+	expirer := NewExpirer(orders, time.Hour, logrus.NewEntry(hookLogger))
+	expirer.now = func() time.Time { return now }
+
+	count, err := expirer.Sweep(context.Background())
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2 expired orders, got %d err=%v", count, err)
+	}
+	for id, want := range map[string]string{
+		"ord_created": domain.OrderStatusExpired,
+		"ord_pending": domain.OrderStatusExpired,
+		"ord_paid":    domain.OrderStatusPaid,
+		"ord_fresh":   domain.OrderStatusPending,
+		"ord_raced":   domain.OrderStatusPaid,
+	} {
+		if got := orders.items[id].Status; got != want {
+			t.Fatalf("expected %s to be %s, got %s", id, want, got)
+		}
+	}
+	if entry := findEvent(hook.AllEntries(), "orders_expired"); entry == nil || entry.Data["count"] != 2 {
+		t.Fatalf("expected orders_expired event with count 2, got %+v", entry)
+	}
+	if orders.reasons["ord_created"] != "ttl_expired" {
+		t.Fatalf("expected ttl_expired reason, got %q", orders.reasons["ord_created"])
+	}
+
+	if count, err := expirer.Sweep(context.Background()); err != nil || count != 0 {
+		t.Fatalf("expected nothing left to expire, got %d err=%v", count, err)
+	}
+}
+
+func TestSweepWorksThroughBatches(t *testing.T) {
+	now := time.Date(2026, 5, 6, 7, 0, 0, 0, time.UTC)
+	orders := newFakeExpiringOrders()
+	for i := 0; i < expiryBatchSize+20; i++ {
+		orders.add(fmt.Sprintf("ord_batch%03d", i), domain.OrderStatusPending, now.Add(-time.Duration(i+2)*time.Hour))
+	}
+	expirer := NewExpirer(orders, time.Hour, logrus.NewEntry(logrus.New()))
+	expirer.now = func() time.Time { return now }
+
+	if count, err := expirer.Sweep(context.Background()); err != nil || count != expiryBatchSize+20 {
+		t.Fatalf("expected every stale order to expire, got %d err=%v", count, err)
+	}
+
+	orders.add("ord_stuck", domain.OrderStatusPending, now.Add(-2*time.Hour))
+	orders.transitionErr = errors.New("mongo down")
+	hookLogger, hook := logtest.NewNullLogger()
+	expirer.logger = logrus.NewEntry(hookLogger)
+	if count, err := expirer.Sweep(context.Background()); err != nil || count != 0 {
+		t.Fatalf("expected failed transitions to be skipped, got %d err=%v", count, err)
+	}
+	if findEvent(hook.AllEntries(), "order_expire_failed") == nil {
+		t.Fatalf("expected order_expire_failed event")
+	}
+
+	orders.listErr = errors.New("mongo down")
+	if _, err := expirer.Sweep(context.Background()); !errors.Is(err, orders.listErr) {
+		t.Fatalf("expected list failure to be returned, got %v", err)
+	}
+}
+
+type fakeExpiringOrders struct {
+	items         map[string]domain.Order
+	raced         map[string]string
+	reasons       map[string]string
+	listErr       error
+	transitionErr error
+}
+
+func newFakeExpiringOrders() *fakeExpiringOrders {
+	return &fakeExpiringOrders{
+		items:   make(map[string]domain.Order),
+		raced:   make(map[string]string),
+		reasons: make(map[string]string),
+	}
+}
+
+func (f *fakeExpiringOrders) add(orderID, status string, createdAt time.Time) {
+	f.items[orderID] = domain.Order{OrderID: orderID, Status: status, CreatedAt: createdAt}
+}
+
+func (f *fakeExpiringOrders) ListExpirable(_ context.Context, createdBefore time.Time, limit int64) ([]domain.Order, error) {
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+
+	var found []domain.Order
+	for _, order := range f.items {
+		if (order.Status == domain.OrderStatusCreated || order.Status == domain.OrderStatusPending) && order.CreatedAt.Before(createdBefore) {
+			found = append(found, order)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].CreatedAt.Before(found[j].CreatedAt) })
+	if int64(len(found)) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+func (f *fakeExpiringOrders) Transition(_ context.Context, t domain.OrderTransition) (domain.Order, error) {
+	if f.transitionErr != nil {
+		return domain.Order{}, f.transitionErr
+	}
+
+	order := f.items[t.OrderID]
+	if status, ok := f.raced[t.OrderID]; ok {
+		order.Status = status
+		f.items[t.OrderID] = order
+	}
+	if order.Status != t.From {
+		return order, &domain.StatusConflictError{OrderID: t.OrderID, Expected: t.From, Actual: order.Status}
+	}
+	order.Status = t.To
+	f.items[t.OrderID] = order
+	f.reasons[t.OrderID] = t.Reason
+	return order, nil
+}
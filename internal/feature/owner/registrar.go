@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -13,35 +14,47 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"tg_pay_gateway_bot/internal/audit"
 	"tg_pay_gateway_bot/internal/domain"
 	"tg_pay_gateway_bot/internal/logging"
 )
 
 type userCollection interface {
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
 	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 }
 
+// auditRecorder writes the role changes made by the bootstrap to the audit
+// trail.
+type auditRecorder interface {
+	Record(ctx context.Context, entry audit.Entry)
+}
+
 // Registrar bootstraps the configured bot owner record.
 type Registrar struct {
 	users  userCollection
+	audit  auditRecorder
 	logger *logrus.Entry
 }
 
-// NewRegistrar constructs a Registrar for the provided users collection.
-func NewRegistrar(users userCollection, logger *logrus.Entry) *Registrar {
+// NewRegistrar constructs a Registrar for the provided users collection. audit
+// may be nil when no audit trail is kept.
+func NewRegistrar(users userCollection, audit auditRecorder, logger *logrus.Entry) *Registrar {
 	if logger == nil {
 		logger = logging.Logger()
 	}
 
 	return &Registrar{
 		users:  users,
+		audit:  audit,
 		logger: logger,
 	}
 }
 
 // EnsureOwner upserts the configured owner user_id with role=owner and demotes
-// any previous owners to admin.
+// any previous owners to admin. Each resulting role change is audited as a
+// system action; a restart with an unchanged owner records nothing.
 func (r *Registrar) EnsureOwner(ctx context.Context, ownerID int64) error {
 	if r == nil || r.users == nil {
 		return errors.New("owner registrar is not initialized")
@@ -53,6 +66,11 @@ func (r *Registrar) EnsureOwner(ctx context.Context, ownerID int64) error {
 		return errors.New("owner id is required")
 	}
 
+	before, err := r.currentRoles(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().UTC()
 
 	demoteResult, err := r.users.UpdateMany(ctx,
@@ -92,9 +110,75 @@ func (r *Registrar) EnsureOwner(ctx context.Context, ownerID int64) error {
 		"upserted_owner": upsertedCount(upsertResult),
 	}).Info("ensured bot owner")
 
+	r.auditChanges(ctx, ownerID, before)
+
 	return nil
 }
 
+// currentRoles returns the roles of existing owners and the configured owner
+// keyed by user_id, before the bootstrap changes them.
+func (r *Registrar) currentRoles(ctx context.Context, ownerID int64) (map[int64]string, error) {
+	cursor, err := r.users.Find(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"role": domain.RoleOwner},
+			bson.M{"user_id": ownerID},
+		}},
+		options.Find().SetProjection(bson.M{"user_id": 1, "role": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find current owners: %w", err)
+	}
+
+	var users []domain.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("decode current owners: %w", err)
+	}
+
+	roles := make(map[int64]string, len(users))
+	for _, user := range users {
+		roles[user.UserID] = user.Role
+	}
+
+	return roles, nil
+}
+
+func (r *Registrar) auditChanges(ctx context.Context, ownerID int64, before map[int64]string) {
+	if r.audit == nil {
+		return
+	}
+
+	demoted := make([]int64, 0, len(before))
+	for userID, role := range before {
+		if userID != ownerID && role == domain.RoleOwner {
+			demoted = append(demoted, userID)
+		}
+	}
+	sort.Slice(demoted, func(i, j int) bool { return demoted[i] < demoted[j] })
+
+	for _, userID := range demoted {
+		r.audit.Record(ctx, audit.Entry{
+			ActorID: audit.SystemActor,
+			Action:  audit.ActionRoleChange,
+			Target:  audit.UserTarget(userID),
+			Before:  domain.RoleOwner,
+			After:   domain.RoleAdmin,
+			Outcome: audit.OutcomeSuccess,
+			Reason:  audit.ActionOwnerBootstrap,
+		})
+	}
+
+	if previous := before[ownerID]; previous != domain.RoleOwner {
+		r.audit.Record(ctx, audit.Entry{
+			ActorID: audit.SystemActor,
+			Action:  audit.ActionOwnerBootstrap,
+			Target:  audit.UserTarget(ownerID),
+			Before:  previous,
+			After:   domain.RoleOwner,
+			Outcome: audit.OutcomeSuccess,
+		})
+	}
+}
+
 func modifiedCount(result *mongo.UpdateResult) int64 {
 	if result == nil {
 		return 0
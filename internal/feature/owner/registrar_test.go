@@ -13,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"tg_pay_gateway_bot/internal/audit"
 	"tg_pay_gateway_bot/internal/domain"
 )
 
@@ -23,7 +24,7 @@ func TestEnsureOwnerDemotesPreviousAndUpsertsConfiguredOwner(t *testing.T) {
 		updateOneResult:  &mongo.UpdateResult{MatchedCount: 0, UpsertedCount: 1},
 	}
 
-	registrar := NewRegistrar(fake, logrus.NewEntry(hookLogger))
+	registrar := NewRegistrar(fake, nil, logrus.NewEntry(hookLogger))
 
 	ctx := context.Background()
 	ownerID := int64(999)
@@ -121,6 +122,44 @@ func TestEnsureOwnerDemotesPreviousAndUpsertsConfiguredOwner(t *testing.T) {
 	}
 }
 
+func TestEnsureOwnerAuditsRoleChanges(t *testing.T) {
+	hookLogger, _ := logtest.NewNullLogger()
+	fake := &fakeUsers{findDocs: []interface{}{
+		bson.M{"user_id": int64(7), "role": domain.RoleOwner},
+		bson.M{"user_id": int64(3), "role": domain.RoleOwner},
+		bson.M{"user_id": int64(999), "role": domain.RoleAdmin},
+	}}
+	trail := &fakeAudit{}
+
+	if err := NewRegistrar(fake, trail, logrus.NewEntry(hookLogger)).EnsureOwner(context.Background(), 999); err != nil {
+		t.Fatalf("EnsureOwner returned error: %v", err)
+	}
+
+	want := []audit.Entry{
+		{Action: audit.ActionRoleChange, Target: "user:3", Before: domain.RoleOwner, After: domain.RoleAdmin, Outcome: audit.OutcomeSuccess, Reason: audit.ActionOwnerBootstrap},
+		{Action: audit.ActionRoleChange, Target: "user:7", Before: domain.RoleOwner, After: domain.RoleAdmin, Outcome: audit.OutcomeSuccess, Reason: audit.ActionOwnerBootstrap},
+		{Action: audit.ActionOwnerBootstrap, Target: "user:999", Before: domain.RoleAdmin, After: domain.RoleOwner, Outcome: audit.OutcomeSuccess},
+	}
+	if len(trail.entries) != len(want) {
+		t.Fatalf("expected %d audit entries, got %+v", len(want), trail.entries)
+	}
+	for i, entry := range trail.entries {
+		if entry != want[i] {
+			t.Fatalf("audit entry %d: expected %+v, got %+v", i, want[i], entry)
+		}
+	}
+
+	// A restart with the same owner changes nothing and records nothing.
+	trail.entries = nil
+	fake.findDocs = []interface{}{bson.M{"user_id": int64(999), "role": domain.RoleOwner}}
+	if err := NewRegistrar(fake, trail, logrus.NewEntry(hookLogger)).EnsureOwner(context.Background(), 999); err != nil {
+		t.Fatalf("EnsureOwner returned error: %v", err)
+	}
+	if len(trail.entries) != 0 {
+		t.Fatalf("expected no audit entries for an unchanged owner, got %+v", trail.entries)
+	}
+}
+
 func TestEnsureOwnerValidatesAndPropagatesErrors(t *testing.T) {
 	hookLogger, _ := logtest.NewNullLogger()
 	tests := []struct {
@@ -139,30 +178,39 @@ func TestEnsureOwnerValidatesAndPropagatesErrors(t *testing.T) {
 		},
 		{
 			name:      "nil collection",
-			registrar: NewRegistrar(nil, logrus.NewEntry(hookLogger)),
+			registrar: NewRegistrar(nil, nil, logrus.NewEntry(hookLogger)),
 			ctx:       context.Background(),
 			ownerID:   1,
 			expectErr: "registrar is not initialized",
 		},
 		{
 			name:      "nil context",
-			registrar: NewRegistrar(&fakeUsers{}, logrus.NewEntry(hookLogger)),
+			registrar: NewRegistrar(&fakeUsers{}, nil, logrus.NewEntry(hookLogger)),
 			ctx:       nil,
 			ownerID:   1,
 			expectErr: "context is required",
 		},
 		{
 			name:      "zero owner id",
-			registrar: NewRegistrar(&fakeUsers{}, logrus.NewEntry(hookLogger)),
+			registrar: NewRegistrar(&fakeUsers{}, nil, logrus.NewEntry(hookLogger)),
 			ctx:       context.Background(),
 			ownerID:   0,
 			expectErr: "owner id is required",
 		},
+		{
+			name: "find error",
+			registrar: NewRegistrar(&fakeUsers{
+				findErr: errors.New("find fail"),
+			}, nil, logrus.NewEntry(hookLogger)),
+			ctx:       context.Background(),
+			ownerID:   99,
+			expectErr: "find fail",
+		},
 		{
 			name: "demote error",
 			registrar: NewRegistrar(&fakeUsers{
 				updateManyErr: errors.New("demote fail"),
-			}, logrus.NewEntry(hookLogger)),
+			}, nil, logrus.NewEntry(hookLogger)),
 			ctx:       context.Background(),
 			ownerID:   99,
 			expectErr: "demote fail",
@@ -171,7 +219,7 @@ func TestEnsureOwnerValidatesAndPropagatesErrors(t *testing.T) {
 			name: "upsert error",
 			registrar: NewRegistrar(&fakeUsers{
 				updateOneErr: errors.New("upsert fail"),
-			}, logrus.NewEntry(hookLogger)),
+			}, nil, logrus.NewEntry(hookLogger)),
 			ctx:       context.Background(),
 			ownerID:   99,
 			expectErr: "upsert fail",
@@ -201,6 +249,8 @@ type updateOneCall struct {
 }
 
 type fakeUsers struct {
+	findDocs         []interface{}
+	findErr          error
 	updateManyCalls  []updateManyCall
 	updateOneCalls   []updateOneCall
 	updateManyErr    error
@@ -209,6 +259,13 @@ type fakeUsers struct {
 	updateOneResult  *mongo.UpdateResult
 }
 
+func (f *fakeUsers) Find(context.Context, interface{}, ...*options.FindOptions) (*mongo.Cursor, error) {
+	if f.findErr != nil {
+		return nil, f.findErr
+	}
+	return mongo.NewCursorFromDocuments(f.findDocs, nil, nil)
+}
+
 func (f *fakeUsers) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
 	f.updateManyCalls = append(f.updateManyCalls, updateManyCall{filter: filter, update: update})
 	return f.updateManyResult, f.updateManyErr
@@ -219,6 +276,14 @@ func (f *fakeUsers) UpdateOne(ctx context.Context, filter interface{}, update in
 	return f.updateOneResult, f.updateOneErr
 }
 
+type fakeAudit struct {
+	entries []audit.Entry
+}
+
+func (f *fakeAudit) Record(_ context.Context, entry audit.Entry) {
+	f.entries = append(f.entries, entry)
+}
+
 func findLogEvent(entries []*logrus.Entry, event string) *logrus.Entry {
 	for _, entry := range entries {
 		if entry.Data["event"] == event {
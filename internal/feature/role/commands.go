@@ -0,0 +1,311 @@
+// Package role provides the commands the owner uses to grant and revoke the
+// admin role.
+package role
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const (
+	promoteUsage = "Usage: /promote <user_id|@username>, or reply /promote to a message from the user"
+	demoteUsage  = "Usage: /demote <user_id|@username>, or reply /demote to a message from the user"
+
+	ownerImmutableReply = "The owner's role follows BOT_OWNER and cannot be changed by command."
+)
+
+const menuRefreshTimeout = 5 * time.Second
+
+type userStore interface {
+	GetByID(ctx context.Context, userID int64) (domain.User, error)
+	GetByUsername(ctx context.Context, username string) (domain.User, error)
+	ListByRole(ctx context.Context, role string) ([]domain.User, error)
+	UpdateRole(ctx context.Context, userID int64, from, to string, actorID int64) (domain.User, error)
+}
+
+// auditRecorder writes role changes, including refused ones, to the audit
+// trail.
+type auditRecorder interface {
+	Record(ctx context.Context, entry audit.Entry)
+}
+
+// menuPublisher refreshes a user's Telegram command menu after a role change.
+type menuPublisher interface {
+	PublishUserCommands(ctx context.Context, userID int64, role string) error
+}
+
+// Service implements the role management commands.
+type Service struct {
+	users  userStore
+	menus  menuPublisher
+	audit  auditRecorder
+	logger *logrus.Entry
+}
+
+// NewService constructs a Service. menus and audit may be nil when command
+// menus are not published or no audit trail is kept.
+func NewService(users userStore, menus menuPublisher, audit auditRecorder, logger *logrus.Entry) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Service{
+		users:  users,
+		menus:  menus,
+		audit:  audit,
+		logger: logger,
+	}
+}
+
+// Commands returns the role commands for registration with the Telegram
+// client. Only the owner may grant or revoke admin, so admins can neither
+// touch the owner nor each other; admins may list who holds elevated roles.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			Name:        "promote",
+			Description: "Grant a user the admin role",
+			MinRole:     domain.RoleOwner,
+			Handler:     telegram.ReplyHandler(s.logger, s.promote),
+		},
+		{
+			Name:        "demote",
+			Description: "Revoke a user's admin role",
+			MinRole:     domain.RoleOwner,
+			Handler:     telegram.ReplyHandler(s.logger, s.demote),
+		},
+		{
+			Name:        "admins",
+			Description: "List the owner and admins",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.listAdmins),
+		},
+	}
+}
+
+func (s *Service) promote(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	return s.changeRole(ctx, req, domain.RoleUser, domain.RoleAdmin, promoteUsage)
+}
+
+func (s *Service) demote(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	return s.changeRole(ctx, req, domain.RoleAdmin, domain.RoleUser, demoteUsage)
+}
+
+func (s *Service) changeRole(ctx context.Context, req telegram.CommandRequest, from, to, usage string) (string, error) {
+	if s == nil || s.users == nil {
+		return "", errors.New("role service is not initialized")
+	}
+
+	targetID, username, ok := parseTarget(req)
+	if !ok {
+		return usage, nil
+	}
+	if targetID == req.UserID {
+		return "You cannot change your own role.", nil
+	}
+
+	var target domain.User
+	var err error
+	if username != "" {
+		target, err = s.users.GetByUsername(ctx, username)
+	} else {
+		target, err = s.users.GetByID(ctx, targetID)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ref := "@" + username
+		if username == "" {
+			ref = strconv.FormatInt(targetID, 10)
+		}
+		return fmt.Sprintf("User %s is unknown; they need to message the bot first.", ref), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	targetID = target.UserID
+	if targetID == req.UserID {
+		return "You cannot change your own role.", nil
+	}
+
+	entry := audit.Entry{
+		ActorID:   req.UserID,
+		ActorRole: req.Role,
+		ChatID:    req.ChatID,
+		Action:    audit.ActionRoleChange,
+		Target:    audit.UserTarget(targetID),
+		Before:    target.Role,
+		After:     to,
+	}
+
+	if reason, reply := checkChange(req.Role, target, from, to); reason != "" {
+		entry.Outcome, entry.Reason = audit.OutcomeDenied, reason
+		s.record(ctx, entry)
+		return reply, nil
+	}
+
+	updated, err := s.users.UpdateRole(ctx, targetID, from, to, req.UserID)
+	if err != nil {
+		entry.Outcome, entry.Reason = audit.OutcomeFailed, err.Error()
+		s.record(ctx, entry)
+	}
+	switch {
+	case errors.Is(err, domain.ErrUserRoleConflict):
+		return fmt.Sprintf("User %d's role changed meanwhile; check /admins and try again.", targetID), nil
+	case errors.Is(err, domain.ErrOwnerRoleImmutable):
+		return ownerImmutableReply, nil
+	case err != nil:
+		return "", err
+	}
+
+	entry.Outcome = audit.OutcomeSuccess
+	s.record(ctx, entry)
+
+	s.logger.WithFields(logging.Fields{
+		"event":          "user_role_changed",
+		"user_id":        req.UserID,
+		"chat_id":        req.ChatID,
+		"target_user_id": targetID,
+		"from":           from,
+		"to":             to,
+	}).Info("changed user role")
+
+	s.refreshMenu(ctx, updated)
+
+	return fmt.Sprintf("User %d is now %s (was %s).", targetID, to, from), nil
+}
+
+func (s *Service) record(ctx context.Context, entry audit.Entry) {
+	if s.audit != nil {
+		s.audit.Record(ctx, entry)
+	}
+}
+
+// checkChange returns the audit reason and reply explaining why the caller may
+// not move target from one role to another, or empty strings when the change
+// is allowed.
+func checkChange(callerRole string, target domain.User, from, to string) (string, string) {
+	if target.Role == domain.RoleOwner {
+		return "owner_immutable", ownerImmutableReply
+	}
+	// Defense in depth: the router already restricts these commands to the
+	// owner, and nobody below the owner may touch admins.
+	if callerRole != domain.RoleOwner {
+		return "insufficient_role", "Only the owner can grant or revoke admin."
+	}
+	if target.Role == to {
+		return "unchanged", fmt.Sprintf("User %d is already %s.", target.UserID, to)
+	}
+	if target.Role != from {
+		return "role_mismatch", fmt.Sprintf("User %d is %s, not %s.", target.UserID, target.Role, from)
+	}
+
+	return "", ""
+}
+
+// refreshMenu updates the target's command menu; failures are logged because
+// the role change itself already succeeded.
+func (s *Service) refreshMenu(ctx context.Context, user domain.User) {
+	if s.menus == nil {
+		return
+	}
+
+	refreshCtx, cancel := context.WithTimeout(ctx, menuRefreshTimeout)
+	defer cancel()
+
+	if err := s.menus.PublishUserCommands(refreshCtx, user.UserID, user.Role); err != nil {
+		s.logger.WithFields(logging.Fields{
+			"event":          "user_commands_refresh_failed",
+			"target_user_id": user.UserID,
+			"role":           user.Role,
+		}).WithError(err).Warn("failed to refresh command menu after role change")
+	}
+}
+
+func (s *Service) listAdmins(ctx context.Context, _ telegram.CommandRequest) (string, error) {
+	if s == nil || s.users == nil {
+		return "", errors.New("role service is not initialized")
+	}
+
+	owners, err := s.users.ListByRole(ctx, domain.RoleOwner)
+	if err != nil {
+		return "", err
+	}
+	admins, err := s.users.ListByRole(ctx, domain.RoleAdmin)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(owners)+len(admins)+2)
+	for _, owner := range owners {
+		lines = append(lines, "owner: "+userLabel(owner))
+	}
+	if len(admins) == 0 {
+		lines = append(lines, "admins: none")
+		return strings.Join(lines, "\n"), nil
+	}
+
+	lines = append(lines, fmt.Sprintf("admins (%d):", len(admins)))
+	for _, admin := range admins {
+		lines = append(lines, adminLine(admin))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// userLabel renders the user id followed by the username or name, when known.
+func userLabel(user domain.User) string {
+	label := strconv.FormatInt(user.UserID, 10)
+	if name := user.DisplayName(); name != "" {
+		label += " (" + name + ")"
+	}
+
+	return label
+}
+
+// adminLine describes an admin and, when recorded, who promoted them.
+func adminLine(admin domain.User) string {
+	line := "- " + userLabel(admin)
+	for i := len(admin.RoleHistory) - 1; i >= 0; i-- {
+		change := admin.RoleHistory[i]
+		if change.To != domain.RoleAdmin {
+			continue
+		}
+		return line + fmt.Sprintf(", promoted by %d at %s", change.ChangedBy, change.ChangedAt.UTC().Format(time.RFC3339))
+	}
+
+	return line
+}
+
+// parseTarget reads the target from a numeric id or @username argument,
+// falling back to the sender of the replied-to message. Exactly one of the
+// returned id and username is set when ok.
+func parseTarget(req telegram.CommandRequest) (int64, string, bool) {
+	switch len(req.Args) {
+	case 0:
+		return req.ReplyUserID, "", req.ReplyUserID != 0
+	case 1:
+		arg := req.Args[0]
+		if strings.HasPrefix(arg, "@") {
+			username := domain.NormalizeUsername(arg)
+			return 0, username, username != ""
+		}
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return 0, "", false
+		}
+		return id, "", true
+	default:
+		return 0, "", false
+	}
+}
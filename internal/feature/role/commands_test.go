@@ -0,0 +1,260 @@
+package role
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const ownerID = 1
+
+func TestCommandsRequireOwnerToChangeRoles(t *testing.T) {
+	service := NewService(newFakeUsers(), nil, nil, logrus.NewEntry(logrus.New()))
+
+	want := map[string]string{"promote": domain.RoleOwner, "demote": domain.RoleOwner, "admins": domain.RoleAdmin}
+	commands := service.Commands()
+	if len(commands) != len(want) {
+		t.Fatalf("expected %d commands, got %d", len(want), len(commands))
+	}
+	for _, cmd := range commands {
+		if want[cmd.Name] != cmd.MinRole {
+			t.Fatalf("expected /%s to require %q, got %q", cmd.Name, want[cmd.Name], cmd.MinRole)
+		}
+	}
+}
+
+func TestPromoteAndDemote(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	users := newFakeUsers()
+	menus := &fakeMenus{}
+	trail := &fakeAudit{}
+	service := NewService(users, menus, trail, logrus.NewEntry(hookLogger))
+	ctx := context.Background()
+
+	reply, err := service.promote(ctx, ownerRequest("20"))
+	if err != nil || reply != "User 20 is now admin (was user)." {
+		t.Fatalf("unexpected promote reply %q err=%v", reply, err)
+	}
+	if users.byID[20].Role != domain.RoleAdmin || users.byID[20].RoleHistory[0].ChangedBy != ownerID {
+		t.Fatalf("expected user 20 promoted by the owner, got %+v", users.byID[20])
+	}
+	if len(menus.calls) != 1 || menus.calls[0] != "20:admin" {
+		t.Fatalf("expected the admin menu to be published, got %v", menus.calls)
+	}
+	entry := findEvent(hook.AllEntries(), "user_role_changed")
+	if entry == nil || entry.Data["target_user_id"] != int64(20) || entry.Data["to"] != domain.RoleAdmin {
+		t.Fatalf("expected user_role_changed log entry, got %+v", entry)
+	}
+
+	// Replying to the user's message resolves the target without an argument.
+	req := ownerRequest()
+	req.ReplyUserID = 20
+	reply, err = service.demote(ctx, req)
+	if err != nil || reply != "User 20 is now user (was admin)." {
+		t.Fatalf("unexpected demote reply %q err=%v", reply, err)
+	}
+	if len(menus.calls) != 2 || menus.calls[1] != "20:user" {
+		t.Fatalf("expected the admin menu to be cleared, got %v", menus.calls)
+	}
+
+	// Usernames resolve case-insensitively.
+	reply, err = service.promote(ctx, ownerRequest("@BOB"))
+	if err != nil || reply != "User 20 is now admin (was user)." {
+		t.Fatalf("unexpected promote-by-username reply %q err=%v", reply, err)
+	}
+
+	if len(trail.entries) != 3 {
+		t.Fatalf("expected both changes in the audit trail, got %+v", trail.entries)
+	}
+	promoted := trail.entries[0]
+	if promoted.Action != audit.ActionRoleChange || promoted.ActorID != ownerID || promoted.Target != "user:20" ||
+		promoted.Before != domain.RoleUser || promoted.After != domain.RoleAdmin || promoted.Outcome != audit.OutcomeSuccess {
+		t.Fatalf("unexpected audit entry %+v", promoted)
+	}
+}
+
+func TestRoleChangeRejections(t *testing.T) {
+	users := newFakeUsers()
+	trail := &fakeAudit{}
+	service := NewService(users, nil, trail, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	adminReq := ownerRequest("20")
+	adminReq.UserID, adminReq.Role = 10, domain.RoleAdmin
+
+	cases := []struct {
+		name string
+		fn   telegram.ReplyFunc
+		req  telegram.CommandRequest
+		want string
+	}{
+		{"usage", service.promote, ownerRequest(), promoteUsage},
+		{"bad id", service.demote, ownerRequest("bob"), demoteUsage},
+		{"bare at", service.demote, ownerRequest("@"), demoteUsage},
+		{"self by username", service.demote, ownerRequest("@Owner"), "You cannot change your own role."},
+		{"self", service.demote, ownerRequest("1"), "You cannot change your own role."},
+		{"extra args", service.demote, ownerRequest("20", "extra"), demoteUsage},
+		{"unknown", service.promote, ownerRequest("99"), "User 99 is unknown; they need to message the bot first."},
+		{"unknown username", service.promote, ownerRequest("@nobody"), "User @nobody is unknown; they need to message the bot first."},
+		{"already admin", service.promote, ownerRequest("10"), "User 10 is already admin."},
+		{"not admin", service.demote, ownerRequest("20"), "User 20 is already user."},
+		{"admin caller", service.promote, adminReq, "Only the owner can grant or revoke admin."},
+	}
+	for _, tc := range cases {
+		reply, err := tc.fn(ctx, tc.req)
+		if err != nil || reply != tc.want {
+			t.Fatalf("%s: expected %q, got %q err=%v", tc.name, tc.want, reply, err)
+		}
+	}
+
+	// An admin cannot touch the owner even if the router let them through.
+	ownerTarget := adminReq
+	ownerTarget.Args = []string{"1"}
+	if reply, _ := service.demote(ctx, ownerTarget); reply != ownerImmutableReply {
+		t.Fatalf("expected owner to be protected, got %q", reply)
+	}
+
+	users.conflict = true
+	if reply, _ := service.promote(ctx, ownerRequest("20")); !strings.Contains(reply, "changed meanwhile") {
+		t.Fatalf("expected conflict reply, got %q", reply)
+	}
+
+	outcomes := make([]string, 0, len(trail.entries))
+	for _, entry := range trail.entries {
+		outcomes = append(outcomes, entry.Outcome+":"+entry.Reason)
+	}
+	want := []string{
+		"denied:unchanged",
+		"denied:unchanged",
+		"denied:insufficient_role",
+		"denied:owner_immutable",
+		"failed:" + domain.ErrUserRoleConflict.Error(),
+	}
+	if strings.Join(outcomes, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected audited refusals %v, got %v", want, outcomes)
+	}
+}
+
+func TestListAdmins(t *testing.T) {
+	users := newFakeUsers()
+	service := NewService(users, nil, nil, logrus.NewEntry(logrus.New()))
+	ctx := context.Background()
+
+	reply, err := service.listAdmins(ctx, telegram.CommandRequest{})
+	if err != nil {
+		t.Fatalf("listAdmins returned error: %v", err)
+	}
+	want := "owner: 1 (@Owner)\nadmins (1):\n- 10 (Ada Admin), promoted by 1 at 2026-01-02T03:04:05Z"
+	if reply != want {
+		t.Fatalf("expected %q, got %q", want, reply)
+	}
+
+	delete(users.byID, 10)
+	if reply, _ := service.listAdmins(ctx, telegram.CommandRequest{}); reply != "owner: 1 (@Owner)\nadmins: none" {
+		t.Fatalf("unexpected reply without admins %q", reply)
+	}
+}
+
+func ownerRequest(args ...string) telegram.CommandRequest {
+	return telegram.CommandRequest{UserID: ownerID, ChatID: ownerID, Role: domain.RoleOwner, Args: args}
+}
+
+type fakeUsers struct {
+	byID     map[int64]domain.User
+	conflict bool
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{byID: map[int64]domain.User{
+		1: {UserID: 1, Role: domain.RoleOwner, Username: "Owner", UsernameLower: "owner"},
+		10: {UserID: 10, Role: domain.RoleAdmin, FirstName: "Ada", LastName: "Admin", RoleHistory: []domain.RoleChange{{
+			From:      domain.RoleUser,
+			To:        domain.RoleAdmin,
+			ChangedBy: 1,
+			ChangedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		}}},
+		20: {UserID: 20, Role: domain.RoleUser, Username: "Bob", UsernameLower: "bob"},
+	}}
+}
+
+func (f *fakeUsers) GetByID(_ context.Context, userID int64) (domain.User, error) {
+	user, ok := f.byID[userID]
+	if !ok {
+		return domain.User{}, mongo.ErrNoDocuments
+	}
+	return user, nil
+}
+
+func (f *fakeUsers) GetByUsername(_ context.Context, username string) (domain.User, error) {
+	for _, user := range f.byID {
+		if user.UsernameLower == domain.NormalizeUsername(username) {
+			return user, nil
+		}
+	}
+	return domain.User{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeUsers) ListByRole(_ context.Context, role string) ([]domain.User, error) {
+	var users []domain.User
+	for _, user := range f.byID {
+		if user.Role == role {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users, nil
+}
+
+func (f *fakeUsers) UpdateRole(_ context.Context, userID int64, from, to string, actorID int64) (domain.User, error) {
+	user, ok := f.byID[userID]
+	if !ok {
+		return domain.User{}, mongo.ErrNoDocuments
+	}
+	if f.conflict || user.Role != from {
+		return domain.User{}, domain.ErrUserRoleConflict
+	}
+	if from == domain.RoleOwner || to == domain.RoleOwner {
+		return domain.User{}, domain.ErrOwnerRoleImmutable
+	}
+	user.Role = to
+	user.RoleHistory = append(user.RoleHistory, domain.RoleChange{From: from, To: to, ChangedBy: actorID, ChangedAt: time.Now()})
+	f.byID[userID] = user
+	return user, nil
+}
+
+type fakeMenus struct {
+	calls []string
+}
+
+func (f *fakeMenus) PublishUserCommands(_ context.Context, userID int64, role string) error {
+	f.calls = append(f.calls, fmt.Sprintf("%d:%s", userID, role))
+	return nil
+}
+
+type fakeAudit struct {
+	entries []audit.Entry
+}
+
+func (f *fakeAudit) Record(_ context.Context, entry audit.Entry) {
+	f.entries = append(f.entries, entry)
+}
+
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
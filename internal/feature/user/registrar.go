@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -17,11 +18,13 @@ import (
 )
 
 type userCollection interface {
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 }
 
 // Registrar ensures users are present in the database and keeps their
-// last-seen timestamp updated on every interaction.
+// last-seen timestamp and Telegram profile updated on every interaction.
 type Registrar struct {
 	users  userCollection
 	logger *logrus.Entry
@@ -39,54 +42,192 @@ func NewRegistrar(users userCollection, logger *logrus.Entry) *Registrar {
 	}
 }
 
-// EnsureUser upserts the user record with a default role if missing and updates
-// last_seen_at/updated_at on every call.
-func (r *Registrar) EnsureUser(ctx context.Context, userID int64) (bool, error) {
+// EnsureUser upserts the user record with a default role if missing, refreshes
+// the profile fields and last_seen_at/updated_at on every call, records
+// username changes in the bounded username history, and clears the inactive
+// mark left by a blocked broadcast.
+func (r *Registrar) EnsureUser(ctx context.Context, profile domain.UserProfile) (bool, error) {
 	if r == nil || r.users == nil {
 		return false, errors.New("user registrar is not initialized")
 	}
 	if ctx == nil {
 		return false, errors.New("context is required")
 	}
-	if userID == 0 {
+	if profile.UserID == 0 {
 		return false, errors.New("user id is required")
 	}
 
 	now := time.Now().UTC().Truncate(time.Millisecond)
+	username := strings.TrimPrefix(strings.TrimSpace(profile.Username), "@")
+	update := profileUpdate(profile, username, now)
+
+	previous, created, err := r.upsert(ctx, profile.UserID, update)
+	if mongo.IsDuplicateKeyError(err) && username != "" {
+		// Telegram usernames are unique at any moment, so a stale record still
+		// holding this username belongs to someone who has since changed it.
+		if err := r.releaseUsername(ctx, profile.UserID, username, now); err != nil {
+			return false, err
+		}
+		previous, created, err = r.upsert(ctx, profile.UserID, update)
+	}
+	if err != nil {
+		return false, fmt.Errorf("ensure user: %w", err)
+	}
+
+	if created {
+		r.logger.WithFields(logging.Fields{
+			"event":    "user_registered",
+			"user_id":  profile.UserID,
+			"username": username,
+		}).Info("registered new user")
+		return true, nil
+	}
+
+	// Records written before profiles were captured have no first_name (which
+	// Telegram always sets); filling them in is not a username change.
+	backfill := previous.FirstName == ""
+	if previous.Username != username && !backfill {
+		if err := r.recordUsernameChange(ctx, profile.UserID, previous.Username, username, now); err != nil {
+			return false, err
+		}
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":   "user_seen",
+		"user_id": profile.UserID,
+	}).Debug("updated user last seen")
+
+	return false, nil
+}
+
+func profileUpdate(profile domain.UserProfile, username string, now time.Time) bson.M {
+	set := bson.M{
+		"first_name":    strings.TrimSpace(profile.FirstName),
+		"last_name":     strings.TrimSpace(profile.LastName),
+		"language_code": strings.TrimSpace(profile.LanguageCode),
+		"is_bot":        profile.IsBot,
+		"is_premium":    profile.IsPremium,
+		"updated_at":    now,
+		"last_seen_at":  now,
+	}
 	update := bson.M{
-		"$set": bson.M{
-			"updated_at":   now,
-			"last_seen_at": now,
-		},
+		"$set": set,
 		"$setOnInsert": bson.M{
-			"user_id":    userID,
+			"user_id":    profile.UserID,
 			"role":       domain.RoleUser,
 			"created_at": now,
 		},
 	}
 
-	result, err := r.users.UpdateOne(ctx,
+	// Any interaction means the user can be reached again.
+	unset := bson.M{"inactive": "", "inactive_at": ""}
+	update["$unset"] = unset
+
+	// username_lower must be absent rather than empty so the sparse unique
+	// index ignores users without a username.
+	if username == "" {
+		unset["username"] = ""
+		unset["username_lower"] = ""
+	} else {
+		set["username"] = username
+		set["username_lower"] = domain.NormalizeUsername(username)
+	}
+
+	return update
+}
+
+// upsert applies the profile update and returns the profile stored before it
+// and whether the user was created.
+func (r *Registrar) upsert(ctx context.Context, userID int64, update bson.M) (domain.User, bool, error) {
+	result := r.users.FindOneAndUpdate(ctx,
 		bson.M{"user_id": userID},
 		update,
-		options.Update().SetUpsert(true),
+		options.FindOneAndUpdate().
+			SetUpsert(true).
+			SetReturnDocument(options.Before).
+			SetProjection(bson.M{"username": 1, "first_name": 1}),
 	)
-	if err != nil {
-		return false, fmt.Errorf("ensure user: %w", err)
+	if result == nil {
+		return domain.User{}, false, errors.New("upsert user returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return domain.User{}, true, nil
+		}
+		return domain.User{}, false, err
 	}
 
-	created := result != nil && result.UpsertedCount > 0
-	if created {
-		r.logger.WithFields(logging.Fields{
-			"event":   "user_registered",
-			"user_id": userID,
-		}).Info("registered new user")
-		return true, nil
+	var previous domain.User
+	if err := result.Decode(&previous); err != nil {
+		return domain.User{}, false, fmt.Errorf("decode user: %w", err)
+	}
+
+	return previous, false, nil
+}
+
+// releaseUsername clears username from any other user still holding it.
+func (r *Registrar) releaseUsername(ctx context.Context, userID int64, username string, now time.Time) error {
+	result := r.users.FindOne(ctx,
+		bson.M{"username_lower": domain.NormalizeUsername(username), "user_id": bson.M{"$ne": userID}},
+		options.FindOne().SetProjection(bson.M{"user_id": 1, "username": 1}),
+	)
+	if result == nil {
+		return errors.New("find username holder returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return fmt.Errorf("find username holder: %w", err)
+	}
+
+	var holder domain.User
+	if err := result.Decode(&holder); err != nil {
+		return fmt.Errorf("decode username holder: %w", err)
+	}
+
+	if _, err := r.users.UpdateOne(ctx,
+		bson.M{"user_id": holder.UserID, "username": holder.Username},
+		bson.M{
+			"$unset": bson.M{"username": "", "username_lower": ""},
+			"$set":   bson.M{"updated_at": now},
+			"$push":  usernameHistoryPush(holder.Username, "", now),
+		},
+	); err != nil {
+		return fmt.Errorf("release username: %w", err)
 	}
 
 	r.logger.WithFields(logging.Fields{
-		"event":   "user_seen",
+		"event":         "user_username_released",
+		"user_id":       holder.UserID,
+		"username":      holder.Username,
+		"new_holder_id": userID,
+	}).Info("released username held by a stale user record")
+
+	return nil
+}
+
+func (r *Registrar) recordUsernameChange(ctx context.Context, userID int64, from, to string, now time.Time) error {
+	if _, err := r.users.UpdateOne(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$push": usernameHistoryPush(from, to, now)},
+	); err != nil {
+		return fmt.Errorf("record username change: %w", err)
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":   "user_username_changed",
 		"user_id": userID,
-	}).Debug("updated user last seen")
+		"from":    from,
+		"to":      to,
+	}).Info("user changed username")
 
-	return false, nil
+	return nil
+}
+
+func usernameHistoryPush(from, to string, now time.Time) bson.M {
+	return bson.M{"username_history": bson.M{
+		"$each":  bson.A{domain.UsernameChange{From: from, To: to, ChangedAt: now}},
+		"$slice": -domain.MaxUsernameHistoryKept,
+	}}
 }
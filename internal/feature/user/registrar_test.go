@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -20,7 +21,7 @@ func TestEnsureUserCreatesNewRecord(t *testing.T) {
 	registrar := NewRegistrar(coll, logrus.NewEntry(hookLogger))
 
 	ctx := context.Background()
-	created, err := registrar.EnsureUser(ctx, 123)
+	created, err := registrar.EnsureUser(ctx, domain.UserProfile{UserID: 123, Username: "Alice", FirstName: "Alice", LanguageCode: "en", IsPremium: true})
 	if err != nil {
 		t.Fatalf("EnsureUser returned error: %v", err)
 	}
@@ -32,6 +33,14 @@ func TestEnsureUserCreatesNewRecord(t *testing.T) {
 
 	assertFieldEquals(t, doc, "user_id", int64(123))
 	assertFieldEquals(t, doc, "role", domain.RoleUser)
+	assertFieldEquals(t, doc, "username", "Alice")
+	assertFieldEquals(t, doc, "username_lower", "alice")
+	assertFieldEquals(t, doc, "first_name", "Alice")
+	assertFieldEquals(t, doc, "language_code", "en")
+	assertFieldEquals(t, doc, "is_premium", true)
+	if _, ok := doc["username_history"]; ok {
+		t.Fatalf("expected no username history for a new user, got %v", doc["username_history"])
+	}
 
 	createdAt := assertTimeField(t, doc, "created_at")
 	updatedAt := assertTimeField(t, doc, "updated_at")
@@ -60,7 +69,7 @@ func TestEnsureUserUpdatesLastSeenOnly(t *testing.T) {
 	registrar := NewRegistrar(coll, logrus.NewEntry(hookLogger))
 
 	ctx := context.Background()
-	created, err := registrar.EnsureUser(ctx, 777)
+	created, err := registrar.EnsureUser(ctx, domain.UserProfile{UserID: 777, FirstName: "Owner"})
 	if err != nil {
 		t.Fatalf("EnsureUser returned error: %v", err)
 	}
@@ -84,6 +93,87 @@ func TestEnsureUserUpdatesLastSeenOnly(t *testing.T) {
 	}
 }
 
+func TestEnsureUserRecordsUsernameChanges(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	coll := newFakeUserCollection(t)
+	registrar := NewRegistrar(coll, logrus.NewEntry(hookLogger))
+	ctx := context.Background()
+
+	names := []string{"alice", "alice", "Alice_2", ""}
+	for i := 0; i < domain.MaxUsernameHistoryKept; i++ {
+		names = append(names, fmt.Sprintf("alice_%d", i))
+	}
+	for _, name := range names {
+		if _, err := registrar.EnsureUser(ctx, domain.UserProfile{UserID: 5, Username: name, FirstName: "Alice"}); err != nil {
+			t.Fatalf("EnsureUser(%q) returned error: %v", name, err)
+		}
+	}
+
+	doc := coll.docFor(t, 5)
+	history, _ := doc["username_history"].(bson.A)
+	if len(history) != domain.MaxUsernameHistoryKept {
+		t.Fatalf("expected history bounded to %d entries, got %d", domain.MaxUsernameHistoryKept, len(history))
+	}
+	last := history[len(history)-1].(domain.UsernameChange)
+	if last.From != fmt.Sprintf("alice_%d", domain.MaxUsernameHistoryKept-2) || last.To != fmt.Sprintf("alice_%d", domain.MaxUsernameHistoryKept-1) {
+		t.Fatalf("unexpected last username change %+v", last)
+	}
+	if findEvent(hook.AllEntries(), "user_username_changed") == nil {
+		t.Fatalf("expected user_username_changed log entry")
+	}
+
+	// Clearing the username removes the index key instead of storing "".
+	if _, err := registrar.EnsureUser(ctx, domain.UserProfile{UserID: 5, FirstName: "Alice"}); err != nil {
+		t.Fatalf("EnsureUser returned error: %v", err)
+	}
+	doc = coll.docFor(t, 5)
+	if _, ok := doc["username_lower"]; ok {
+		t.Fatalf("expected username_lower to be unset, got %v", doc["username_lower"])
+	}
+}
+
+func TestEnsureUserBackfillsLegacyRecordWithoutHistory(t *testing.T) {
+	hookLogger, _ := logtest.NewNullLogger()
+	coll := newFakeUserCollection(t)
+	coll.seed(t, bson.M{"user_id": int64(8), "role": domain.RoleUser})
+	registrar := NewRegistrar(coll, logrus.NewEntry(hookLogger))
+
+	if _, err := registrar.EnsureUser(context.Background(), domain.UserProfile{UserID: 8, Username: "bob", FirstName: "Bob"}); err != nil {
+		t.Fatalf("EnsureUser returned error: %v", err)
+	}
+
+	doc := coll.docFor(t, 8)
+	assertFieldEquals(t, doc, "username", "bob")
+	if _, ok := doc["username_history"]; ok {
+		t.Fatalf("expected backfill not to be recorded as a change, got %v", doc["username_history"])
+	}
+}
+
+func TestEnsureUserReleasesStaleUsername(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	coll := newFakeUserCollection(t)
+	coll.seed(t, bson.M{"user_id": int64(1), "role": domain.RoleUser, "first_name": "Old", "username": "Shop", "username_lower": "shop"})
+	registrar := NewRegistrar(coll, logrus.NewEntry(hookLogger))
+
+	created, err := registrar.EnsureUser(context.Background(), domain.UserProfile{UserID: 2, Username: "shop", FirstName: "New"})
+	if err != nil || !created {
+		t.Fatalf("expected user 2 to be created after releasing the username, got created=%v err=%v", created, err)
+	}
+
+	assertFieldEquals(t, coll.docFor(t, 2), "username_lower", "shop")
+	stale := coll.docFor(t, 1)
+	if _, ok := stale["username_lower"]; ok {
+		t.Fatalf("expected stale holder to lose the username, got %v", stale)
+	}
+	history, _ := stale["username_history"].(bson.A)
+	if len(history) != 1 || history[0].(domain.UsernameChange) != (domain.UsernameChange{From: "Shop", To: "", ChangedAt: history[0].(domain.UsernameChange).ChangedAt}) {
+		t.Fatalf("expected release recorded in history, got %v", history)
+	}
+	if findEvent(hook.AllEntries(), "user_username_released") == nil {
+		t.Fatalf("expected user_username_released log entry")
+	}
+}
+
 type fakeUserCollection struct {
 	t    *testing.T
 	docs map[int64]bson.M
@@ -97,51 +187,105 @@ func newFakeUserCollection(t *testing.T) *fakeUserCollection {
 	}
 }
 
-func (f *fakeUserCollection) UpdateOne(_ context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+func (f *fakeUserCollection) FindOne(_ context.Context, filter interface{}, _ ...*options.FindOneOptions) *mongo.SingleResult {
 	filterDoc, ok := filter.(bson.M)
 	if !ok {
-		return nil, f.Errorf("unexpected filter type %T", filter)
+		return mongo.NewSingleResultFromDocument(bson.M{}, f.Errorf("unexpected filter type %T", filter), nil)
 	}
 
-	userID := readInt64(f.t, filterDoc["user_id"])
+	for _, doc := range f.docs {
+		if matches(doc, filterDoc) {
+			return mongo.NewSingleResultFromDocument(doc, nil, nil)
+		}
+	}
 
+	return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+}
+
+func (f *fakeUserCollection) FindOneAndUpdate(_ context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	filterDoc, ok := filter.(bson.M)
+	if !ok {
+		return mongo.NewSingleResultFromDocument(bson.M{}, f.Errorf("unexpected filter type %T", filter), nil)
+	}
 	updateDoc, ok := update.(bson.M)
 	if !ok {
-		return nil, f.Errorf("unexpected update type %T", update)
+		return mongo.NewSingleResultFromDocument(bson.M{}, f.Errorf("unexpected update type %T", update), nil)
 	}
 
+	userID := readInt64(f.t, filterDoc["user_id"])
 	setDoc, _ := updateDoc["$set"].(bson.M)
-	setOnInsertDoc, _ := updateDoc["$setOnInsert"].(bson.M)
 
-	upsert := len(opts) > 0 && opts[0] != nil && opts[0].Upsert != nil && *opts[0].Upsert
+	// Enforce the unique username_lower index.
+	if lower, ok := setDoc["username_lower"]; ok {
+		for id, doc := range f.docs {
+			if id != userID && doc["username_lower"] == lower {
+				return mongo.NewSingleResultFromDocument(bson.M{}, mongo.CommandError{Code: 11000, Message: "E11000 duplicate key"}, nil)
+			}
+		}
+	}
 
+	upsert := len(opts) > 0 && opts[0] != nil && opts[0].Upsert != nil && *opts[0].Upsert
 	doc, found := f.docs[userID]
 	if !found && !upsert {
-		return &mongo.UpdateResult{
-			MatchedCount:  0,
-			ModifiedCount: 0,
-		}, nil
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
 	}
+
+	before := bson.M{}
+	merge(before, doc)
+
 	if !found {
 		doc = bson.M{}
+		setOnInsertDoc, _ := updateDoc["$setOnInsert"].(bson.M)
 		merge(doc, setOnInsertDoc)
 	}
-
-	merge(doc, setDoc)
+	f.apply(doc, updateDoc)
 	f.docs[userID] = doc
 
-	result := &mongo.UpdateResult{
-		MatchedCount:  1,
-		ModifiedCount: 1,
+	if !found {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(before, nil, nil)
+}
+
+func (f *fakeUserCollection) UpdateOne(_ context.Context, filter interface{}, update interface{}, _ ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	filterDoc, ok := filter.(bson.M)
+	if !ok {
+		return nil, f.Errorf("unexpected filter type %T", filter)
+	}
+	updateDoc, ok := update.(bson.M)
+	if !ok {
+		return nil, f.Errorf("unexpected update type %T", update)
+	}
+
+	doc, found := f.docs[readInt64(f.t, filterDoc["user_id"])]
+	if !found || !matches(doc, filterDoc) {
+		return &mongo.UpdateResult{}, nil
 	}
 
-	if !found && upsert {
-		result.MatchedCount = 0
-		result.UpsertedCount = 1
-		result.UpsertedID = userID
+	f.apply(doc, updateDoc)
+
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (f *fakeUserCollection) apply(doc bson.M, update bson.M) {
+	setDoc, _ := update["$set"].(bson.M)
+	merge(doc, setDoc)
+
+	unsetDoc, _ := update["$unset"].(bson.M)
+	for field := range unsetDoc {
+		delete(doc, field)
 	}
 
-	return result, nil
+	pushDoc, _ := update["$push"].(bson.M)
+	for field, value := range pushDoc {
+		spec := value.(bson.M)
+		arr, _ := doc[field].(bson.A)
+		arr = append(arr, spec["$each"].(bson.A)...)
+		if keep, ok := spec["$slice"].(int); ok && len(arr) > -keep {
+			arr = arr[len(arr)+keep:]
+		}
+		doc[field] = arr
+	}
 }
 
 func (f *fakeUserCollection) docFor(t *testing.T, userID int64) bson.M {
@@ -172,6 +316,32 @@ func (f *fakeUserCollection) Errorf(format string, args ...interface{}) error {
 	return nil
 }
 
+// matches compares plain field values, treating {"$ne": v} as inequality.
+func matches(doc, filter bson.M) bool {
+	for field, expected := range filter {
+		if ne, ok := expected.(bson.M); ok {
+			if doc[field] == ne["$ne"] {
+				return false
+			}
+			continue
+		}
+		if doc[field] != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
+
 func merge(dst bson.M, updates bson.M) {
 	for k, v := range updates {
 		dst[k] = v
@@ -0,0 +1,260 @@
+// Package health serves HTTP liveness and readiness probes for container
+// orchestration.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// Probe paths.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// Probe and component statuses.
+const (
+	StatusOK           = "ok"
+	StatusDown         = "down"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Readiness components.
+const (
+	ComponentMongo    = "mongo"
+	ComponentIndexes  = "indexes"
+	ComponentTelegram = "telegram"
+)
+
+const mongoPingTimeout = 2 * time.Second
+
+// Pinger verifies database connectivity.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// RunningChecker reports whether updates are being received.
+type RunningChecker interface {
+	Running() bool
+}
+
+// ComponentStatus is the result of one readiness check.
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the JSON body of both probes.
+type Report struct {
+	Status        string                     `json:"status"`
+	UptimeSeconds int64                      `json:"uptime_seconds,omitempty"`
+	Components    map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// Probes tracks startup and shutdown state and evaluates readiness on demand.
+// Readiness requires a successful Mongo ping, ensured indexes, and a running
+// Telegram client, and is withdrawn for good once shutdown begins.
+type Probes struct {
+	mongo        Pinger
+	processStart time.Time
+	now          func() time.Time
+	logger       *logrus.Entry
+
+	mu       sync.RWMutex
+	telegram RunningChecker
+
+	indexesReady atomic.Bool
+	shuttingDown atomic.Bool
+	lastReady    atomic.Bool
+}
+
+// NewProbes constructs Probes. The Telegram client is attached later with
+// SetTelegram because probes start serving before it exists.
+func NewProbes(mongo Pinger, processStart time.Time, logger *logrus.Entry) *Probes {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+	if processStart.IsZero() {
+		processStart = time.Now()
+	}
+
+	return &Probes{
+		mongo:        mongo,
+		processStart: processStart,
+		now:          time.Now,
+		logger:       logger,
+	}
+}
+
+// SetTelegram attaches the Telegram client whose update intake gates
+// readiness.
+func (p *Probes) SetTelegram(telegram RunningChecker) {
+	p.mu.Lock()
+	p.telegram = telegram
+	p.mu.Unlock()
+}
+
+// MarkIndexesReady records that the base MongoDB indexes were ensured.
+func (p *Probes) MarkIndexesReady() {
+	p.indexesReady.Store(true)
+}
+
+// MarkShuttingDown withdraws readiness so traffic drains before the bot stops
+// receiving updates.
+func (p *Probes) MarkShuttingDown() {
+	if p.shuttingDown.Swap(true) {
+		return
+	}
+	p.logger.WithField("event", "readiness_withdrawn").Info("readiness withdrawn for shutdown")
+}
+
+// Liveness reports that the process is up and serving.
+func (p *Probes) Liveness() Report {
+	return Report{
+		Status:        StatusOK,
+		UptimeSeconds: int64(p.now().Sub(p.processStart).Seconds()),
+	}
+}
+
+// Readiness runs the component checks and reports whether the bot can take
+// traffic.
+func (p *Probes) Readiness(ctx context.Context) (Report, bool) {
+	if p.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}, false
+	}
+
+	components := map[string]ComponentStatus{
+		ComponentMongo:    p.checkMongo(ctx),
+		ComponentIndexes:  p.checkFlag(p.indexesReady.Load(), "indexes not ensured yet"),
+		ComponentTelegram: p.checkTelegram(),
+	}
+
+	ready := true
+	for _, component := range components {
+		if component.Status != StatusOK {
+			ready = false
+		}
+	}
+
+	report := Report{Status: StatusOK, Components: components}
+	if !ready {
+		report.Status = StatusUnavailable
+	}
+	p.logTransition(ready, components)
+
+	return report, ready
+}
+
+func (p *Probes) checkMongo(ctx context.Context) ComponentStatus {
+	if p.mongo == nil {
+		return ComponentStatus{Status: StatusDown, Error: "mongo not configured"}
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, mongoPingTimeout)
+	defer cancel()
+
+	start := p.now()
+	err := p.mongo.Ping(pingCtx)
+	status := ComponentStatus{Status: StatusOK, LatencyMS: milliseconds(p.now().Sub(start))}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+func (p *Probes) checkTelegram() ComponentStatus {
+	p.mu.RLock()
+	telegram := p.telegram
+	p.mu.RUnlock()
+
+	if telegram == nil {
+		return ComponentStatus{Status: StatusDown, Error: "telegram client not started"}
+	}
+
+	return p.checkFlag(telegram.Running(), "telegram updates not running")
+}
+
+func (p *Probes) checkFlag(ok bool, reason string) ComponentStatus {
+	if !ok {
+		return ComponentStatus{Status: StatusDown, Error: reason}
+	}
+
+	return ComponentStatus{Status: StatusOK}
+}
+
+// logTransition logs readiness changes only, since probes poll constantly.
+func (p *Probes) logTransition(ready bool, components map[string]ComponentStatus) {
+	if p.lastReady.Swap(ready) == ready {
+		return
+	}
+
+	if ready {
+		p.logger.WithField("event", "readiness_ready").Info("bot is ready")
+		return
+	}
+
+	fields := logging.Fields{"event": "readiness_lost"}
+	for name, component := range components {
+		if component.Status != StatusOK {
+			fields[name] = component.Error
+		}
+	}
+	p.logger.WithFields(fields).Warn("bot is not ready")
+}
+
+// Mux is the subset of http.ServeMux used to mount the probes.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// Register mounts both probes on mux, for sharing another listener.
+func (p *Probes) Register(mux Mux) {
+	mux.Handle("GET "+LivenessPath, p.LivenessHandler())
+	mux.Handle("GET "+ReadinessPath, p.ReadinessHandler())
+}
+
+// LivenessHandler always answers 200 while the process can serve HTTP.
+func (p *Probes) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		p.writeReport(w, http.StatusOK, p.Liveness())
+	})
+}
+
+// ReadinessHandler answers 200 when ready and 503 otherwise.
+func (p *Probes) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, ready := p.Readiness(r.Context())
+		code := http.StatusOK
+		if !ready {
+			code = http.StatusServiceUnavailable
+		}
+		p.writeReport(w, code, report)
+	})
+}
+
+func (p *Probes) writeReport(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		p.logger.WithField("event", "health_write_failed").WithError(err).Warn("failed to write probe response")
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
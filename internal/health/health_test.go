@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+type stubPinger struct {
+	err error
+}
+
+func (s *stubPinger) Ping(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("expected a ping deadline")
+	}
+	return s.err
+}
+
+type stubTelegram struct {
+	running bool
+}
+
+func (s *stubTelegram) Running() bool {
+	return s.running
+}
+
+func get(t *testing.T, handler http.Handler, path string) (int, Report) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected JSON content type, got %q", ct)
+	}
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode %s response: %v", path, err)
+	}
+
+	return rec.Code, report
+}
+
+func TestLivenessReportsUptime(t *testing.T) {
+	probes := NewProbes(nil, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), logrus.NewEntry(logrus.New()))
+	probes.now = func() time.Time { return time.Date(2026, 1, 1, 0, 1, 30, 0, time.UTC) }
+	probes.MarkShuttingDown()
+
+	code, report := get(t, NewServer(":0", probes, nil).Handler(), LivenessPath)
+	if code != http.StatusOK || report.Status != StatusOK || report.UptimeSeconds != 90 {
+		t.Fatalf("expected live with 90s uptime even while shutting down, got %d %+v", code, report)
+	}
+}
+
+func TestReadinessRequiresAllComponents(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	mongo := &stubPinger{}
+	telegram := &stubTelegram{}
+	probes := NewProbes(mongo, time.Now(), logrus.NewEntry(hookLogger))
+	handler := NewServer(":0", probes, nil).Handler()
+
+	code, report := get(t, handler, ReadinessPath)
+	if code != http.StatusServiceUnavailable || report.Status != StatusUnavailable {
+		t.Fatalf("expected not ready during startup, got %d %+v", code, report)
+	}
+	if report.Components[ComponentMongo].Status != StatusOK {
+		t.Fatalf("expected mongo ok, got %+v", report.Components[ComponentMongo])
+	}
+	if report.Components[ComponentIndexes].Status != StatusDown || report.Components[ComponentTelegram].Status != StatusDown {
+		t.Fatalf("expected indexes and telegram down, got %+v", report.Components)
+	}
+
+	probes.MarkIndexesReady()
+	probes.SetTelegram(telegram)
+	if code, _ := get(t, handler, ReadinessPath); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready until telegram runs, got %d", code)
+	}
+
+	telegram.running = true
+	code, report = get(t, handler, ReadinessPath)
+	if code != http.StatusOK || report.Status != StatusOK || len(report.Components) != 3 {
+		t.Fatalf("expected ready, got %d %+v", code, report)
+	}
+	if hook.LastEntry() == nil || hook.LastEntry().Data["event"] != "readiness_ready" {
+		t.Fatalf("expected readiness_ready log entry")
+	}
+
+	mongo.err = errors.New("no primary")
+	code, report = get(t, handler, ReadinessPath)
+	if code != http.StatusServiceUnavailable || report.Components[ComponentMongo].Error != "no primary" {
+		t.Fatalf("expected mongo failure to withdraw readiness, got %d %+v", code, report)
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Data["event"] != "readiness_lost" || entry.Data[ComponentMongo] != "no primary" {
+		t.Fatalf("expected readiness_lost log entry naming mongo, got %+v", entry)
+	}
+}
+
+func TestReadinessWithdrawnAtShutdown(t *testing.T) {
+	probes := NewProbes(&stubPinger{}, time.Now(), logrus.NewEntry(logrus.New()))
+	probes.MarkIndexesReady()
+	probes.SetTelegram(&stubTelegram{running: true})
+
+	if _, ready := probes.Readiness(context.Background()); !ready {
+		t.Fatalf("expected ready before shutdown")
+	}
+
+	probes.MarkShuttingDown()
+	code, report := get(t, probes.ReadinessHandler(), ReadinessPath)
+	if code != http.StatusServiceUnavailable || report.Status != StatusShuttingDown {
+		t.Fatalf("expected shutting_down 503, got %d %+v", code, report)
+	}
+}
+
+func TestRegisterSharesAnotherMux(t *testing.T) {
+	probes := NewProbes(nil, time.Now(), logrus.NewEntry(logrus.New()))
+	mux := http.NewServeMux()
+	probes.Register(mux)
+
+	if code, _ := get(t, mux, LivenessPath); code != http.StatusOK {
+		t.Fatalf("expected liveness on the shared mux, got %d", code)
+	}
+	code, report := get(t, mux, ReadinessPath)
+	if code != http.StatusServiceUnavailable || report.Components[ComponentMongo].Status != StatusDown {
+		t.Fatalf("expected missing mongo to be reported down, got %d %+v", code, report)
+	}
+}
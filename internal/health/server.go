@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// Server exposes the probes on a dedicated listener.
+type Server struct {
+	listenAddr string
+	mux        *http.ServeMux
+	logger     *logrus.Entry
+}
+
+// NewServer constructs a Server serving probes on listenAddr.
+func NewServer(listenAddr string, probes *Probes, logger *logrus.Entry) *Server {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	mux := http.NewServeMux()
+	probes.Register(mux)
+
+	return &Server{
+		listenAddr: listenAddr,
+		mux:        mux,
+		logger:     logger,
+	}
+}
+
+// Handler returns the HTTP handler serving the probes.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves until the context is canceled, then shuts the listener down
+// gracefully.
+func (s *Server) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	server := &http.Server{
+		Addr:              s.listenAddr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "health_listen",
+		"listen_addr": s.listenAddr,
+	}).Info("starting health probe listener")
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithFields(logging.Fields{
+				"event":       "health_server_error",
+				"listen_addr": s.listenAddr,
+			}).WithError(err).Error("health probe listener failed")
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.logger.WithField("event", "health_shutdown_error").WithError(err).Error("failed to stop health probe listener")
+	}
+	cancel()
+
+	s.logger.WithField("event", "health_stopped").Info("health probe listener stopped")
+}
@@ -0,0 +1,163 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const settleUsage = "Usage: /settle <merchant_id> <amount_minor> <currency>"
+
+// maxUnbalancedShown bounds the journal ids listed by /ledger_check.
+const maxUnbalancedShown = 10
+
+// Commands returns the ledger commands for registration with the Telegram
+// client.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			// The group binding scopes access: a group only sees the balance
+			// of the merchant it is bound to.
+			Name:        "balance",
+			Description: "Show this merchant's balance",
+			ChatTypes:   []string{telegram.ChatTypeGroup},
+			Handler:     telegram.ReplyHandler(s.logger, s.balanceCommand),
+		},
+		{
+			Name:        "settle",
+			Description: "Move pending merchant funds to available",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.settleCommand),
+		},
+		{
+			Name:        "ledger_check",
+			Description: "Verify that ledger journals sum to zero",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.checkCommand),
+		},
+	}
+}
+
+func (s *Service) balanceCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+
+	merchant, err := s.merchants.GetByGroupChatID(ctx, req.ChatID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "This group is not bound to a merchant.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	balances, err := s.Balances(ctx, merchant.MerchantID)
+	if err != nil {
+		return "", err
+	}
+	if len(balances) == 0 {
+		return fmt.Sprintf("Merchant %s has no ledger entries yet.", merchant.MerchantID), nil
+	}
+
+	lines := []string{fmt.Sprintf("Balance for %s", merchant.MerchantID)}
+	for _, balance := range balances {
+		lines = append(lines, balance.Currency)
+		for _, accountType := range AccountTypes {
+			lines = append(lines, fmt.Sprintf("  %s: %s", accountType, domain.FormatAmount(balance.Amount(accountType), balance.Currency)))
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Service) settleCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	if len(req.Args) != 3 {
+		return settleUsage, nil
+	}
+
+	amount, err := strconv.ParseInt(req.Args[1], 10, 64)
+	if err != nil || amount <= 0 {
+		return fmt.Sprintf("Invalid amount %q: use a positive integer in minor units.", req.Args[1]), nil
+	}
+
+	merchant, err := s.merchants.GetByID(ctx, req.Args[0])
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Sprintf("Merchant %s not found.", domain.NormalizeMerchantID(req.Args[0])), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	reference, err := settlementReference(req)
+	if err != nil {
+		return "", err
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.Args[2]))
+	journal, err := s.Settle(ctx, merchant.MerchantID, currency, amount, reference, fmt.Sprintf("settled by %d", req.UserID))
+	if errors.Is(err, ErrDuplicateJournal) && journal.JournalID != "" {
+		return fmt.Sprintf("This message was already settled (%s).", journal.JournalID), nil
+	}
+	if errors.Is(err, ErrInsufficientFunds) {
+		return fmt.Sprintf("Pending %s balance of %s does not cover %s.", currency, merchant.MerchantID, domain.FormatAmount(amount, currency)), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "ledger_settled",
+		"journal_id":  journal.JournalID,
+		"merchant_id": merchant.MerchantID,
+		"user_id":     req.UserID,
+	}).Info("settled merchant funds")
+
+	return fmt.Sprintf("Settled %s %s for %s (%s).", domain.FormatAmount(amount, currency), currency, merchant.MerchantID, journal.JournalID), nil
+}
+
+// settlementReference names a settlement after the chat and message of the
+// /settle command, so one message can never settle twice.
+func settlementReference(req telegram.CommandRequest) (string, error) {
+	if req.ChatID == 0 || req.Update == nil || req.Update.Message == nil {
+		return "", errors.New("settlement needs the command message")
+	}
+
+	return fmt.Sprintf("%d:%d", req.ChatID, req.Update.Message.ID), nil
+}
+
+func (s *Service) checkCommand(ctx context.Context, _ telegram.CommandRequest) (string, error) {
+	report, err := s.CheckInvariants(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(report.Currencies)+2)
+	if report.Balanced() {
+		lines = append(lines, "Ledger balanced.")
+	} else {
+		lines = append(lines, "Ledger NOT balanced.")
+	}
+	for _, currency := range report.Currencies {
+		lines = append(lines, fmt.Sprintf("%s: %d journals, total %d", currency.Currency, currency.Journals, currency.Total))
+	}
+	if len(report.Unbalanced) > 0 {
+		shown := report.Unbalanced
+		if len(shown) > maxUnbalancedShown {
+			shown = shown[:maxUnbalancedShown]
+		}
+		lines = append(lines, fmt.Sprintf("Unbalanced journals (%d): %s", len(report.Unbalanced), strings.Join(shown, ", ")))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,103 @@
+package ledger
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+func TestCommandsScopes(t *testing.T) {
+	env := newLedgerEnv()
+
+	commands := env.service.Commands()
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 ledger commands, got %d", len(commands))
+	}
+	if balance := commands[0]; balance.Name != "balance" || len(balance.ChatTypes) != 1 || balance.ChatTypes[0] != telegram.ChatTypeGroup {
+		t.Fatalf("expected balance to be group-only, got %+v", balance)
+	}
+	for _, cmd := range commands[1:] {
+		if cmd.MinRole != domain.RoleAdmin {
+			t.Fatalf("expected %s to require admin, got %q", cmd.Name, cmd.MinRole)
+		}
+	}
+}
+
+func TestBalanceCommand(t *testing.T) {
+	env := newLedgerEnv()
+	ctx := context.Background()
+
+	reply, err := env.service.balanceCommand(ctx, telegram.CommandRequest{ChatID: -999})
+	if err != nil || reply != "This group is not bound to a merchant." {
+		t.Fatalf("expected unbound group reply, got %q err=%v", reply, err)
+	}
+
+	reply, _ = env.service.balanceCommand(ctx, telegram.CommandRequest{ChatID: -100})
+	if reply != "Merchant shop has no ledger entries yet." {
+		t.Fatalf("unexpected empty balance reply %q", reply)
+	}
+
+	if err := env.service.RecordPayment(ctx, env.order(123456)); err != nil {
+		t.Fatalf("RecordPayment returned error: %v", err)
+	}
+	reply, err = env.service.balanceCommand(ctx, telegram.CommandRequest{ChatID: -100})
+	if err != nil {
+		t.Fatalf("balanceCommand returned error: %v", err)
+	}
+	for _, want := range []string{"Balance for shop", "USD", "available: 0.00", "pending: 1203.70", "fees: 30.86"} {
+		if !strings.Contains(reply, want) {
+			t.Fatalf("expected balance reply to contain %q, got %q", want, reply)
+		}
+	}
+}
+
+func TestSettleCommand(t *testing.T) {
+	env := newLedgerEnv()
+	ctx := context.Background()
+
+	if err := env.service.RecordPayment(ctx, env.order(1000)); err != nil {
+		t.Fatalf("RecordPayment returned error: %v", err)
+	}
+
+	req := telegram.CommandRequest{UserID: 7, ChatID: 70, Args: []string{"SHOP", "500", "usd"}, Update: &models.Update{Message: &models.Message{ID: 12}}}
+	reply, err := env.service.settleCommand(ctx, req)
+	if err != nil || !strings.HasPrefix(reply, "Settled 5.00 USD for shop") {
+		t.Fatalf("unexpected settle reply %q err=%v", reply, err)
+	}
+
+	// Handling the same message again, e.g. a redelivered update, must not
+	// move the funds twice.
+	reply, err = env.service.settleCommand(ctx, req)
+	if err != nil || !strings.HasPrefix(reply, "This message was already settled") {
+		t.Fatalf("unexpected replayed settle reply %q err=%v", reply, err)
+	}
+	if balance := env.balance(t, "USD"); balance.Available != 500 {
+		t.Fatalf("expected a single settlement, got %+v", balance)
+	}
+
+	replies := map[string][]string{
+		settleUsage:               {"shop", "1"},
+		"Invalid amount":          {"shop", "-1", "USD"},
+		"Merchant nope not found": {"nope", "1", "USD"},
+		"Pending USD balance":     {"shop", "1000", "USD"},
+	}
+	for want, args := range replies {
+		reply, err := env.service.settleCommand(ctx, telegram.CommandRequest{ChatID: 70, Args: args, Update: &models.Update{Message: &models.Message{ID: 13}}})
+		if err != nil {
+			t.Fatalf("settle(%v) returned error: %v", args, err)
+		}
+		if !strings.HasPrefix(reply, want) {
+			t.Fatalf("settle(%v): expected reply starting with %q, got %q", args, want, reply)
+		}
+	}
+
+	reply, err = env.service.checkCommand(ctx, telegram.CommandRequest{})
+	if err != nil || !strings.HasPrefix(reply, "Ledger balanced.") || !strings.Contains(reply, "USD: 3 journals, total 0") {
+		t.Fatalf("unexpected ledger_check reply %q err=%v", reply, err)
+	}
+}
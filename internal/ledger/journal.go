@@ -0,0 +1,191 @@
+// Package ledger records merchant balances as balanced double-entry journals.
+// Balances are never stored; they are derived by summing journal postings.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Merchant account types. Each merchant has one account of each type per
+// currency.
+const (
+	// AccountPending holds paid funds that have not settled yet.
+	AccountPending = "pending"
+	// AccountAvailable holds settled funds.
+	AccountAvailable = "available"
+	// AccountFrozen holds funds withheld from the merchant.
+	AccountFrozen = "frozen"
+	// AccountFees accumulates the fees charged to the merchant.
+	AccountFees = "fees"
+)
+
+// AccountTypes lists the merchant account types in display order.
+var AccountTypes = []string{AccountAvailable, AccountPending, AccountFrozen, AccountFees}
+
+// ClearingAccount is the system account that mirrors money moving between
+// payment channels and the gateway. Its balance is the negative of all funds
+// held for merchants.
+const ClearingAccount = "system:clearing"
+
+// Journal kinds.
+const (
+	// KindPayment moves a paid order amount from clearing into the merchant's
+	// pending account.
+	KindPayment = "payment"
+	// KindFee deducts the merchant fee from pending into the fees account.
+	KindFee = "fee"
+	// KindRefund returns a refunded order amount from the merchant to clearing.
+	KindRefund = "refund"
+	// KindSettlement moves settled funds from pending to available.
+	KindSettlement = "settlement"
+)
+
+var (
+	// ErrDuplicateJournal reports that a journal with the same id was already
+	// posted.
+	ErrDuplicateJournal = errors.New("journal already posted")
+	// ErrUnbalancedJournal reports a journal whose postings do not sum to
+	// zero.
+	ErrUnbalancedJournal = errors.New("journal postings do not sum to zero")
+	// ErrInsufficientFunds reports that an account cannot cover a debit.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrPaymentNotPosted reports a refund for an order without a payment
+	// journal.
+	ErrPaymentNotPosted = errors.New("payment not posted")
+)
+
+// Posting is a single signed movement on an account. Credits to merchant
+// accounts are positive.
+type Posting struct {
+	Account string `bson:"account" json:"account"`
+	Amount  int64  `bson:"amount" json:"amount"`
+}
+
+// Journal is an immutable, balanced set of postings in one currency.
+type Journal struct {
+	JournalID  string    `bson:"journal_id" json:"journal_id"`
+	Kind       string    `bson:"kind" json:"kind"`
+	MerchantID string    `bson:"merchant_id" json:"merchant_id"`
+	OrderID    string    `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Currency   string    `bson:"currency" json:"currency"`
+	Postings   []Posting `bson:"postings" json:"postings"`
+	Memo       string    `bson:"memo,omitempty" json:"memo,omitempty"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Validate checks that the journal is complete and balanced.
+func (j Journal) Validate() error {
+	if strings.TrimSpace(j.JournalID) == "" {
+		return errors.New("journal_id is required")
+	}
+	switch j.Kind {
+	case KindPayment, KindFee, KindRefund, KindSettlement:
+	default:
+		return fmt.Errorf("unknown journal kind %q", j.Kind)
+	}
+	if j.MerchantID == "" {
+		return errors.New("merchant_id is required")
+	}
+	if j.Currency == "" {
+		return errors.New("currency is required")
+	}
+	if len(j.Postings) < 2 {
+		return fmt.Errorf("journal %s needs at least two postings", j.JournalID)
+	}
+
+	var total int64
+	for _, posting := range j.Postings {
+		if posting.Account == "" {
+			return fmt.Errorf("journal %s has a posting without an account", j.JournalID)
+		}
+		if posting.Amount == 0 {
+			return fmt.Errorf("journal %s has a zero posting on %s", j.JournalID, posting.Account)
+		}
+		total += posting.Amount
+	}
+	if total != 0 {
+		return fmt.Errorf("%w: journal %s is off by %d", ErrUnbalancedJournal, j.JournalID, total)
+	}
+
+	return nil
+}
+
+// JournalID returns the deterministic id of an order-driven journal.
+func JournalID(kind, reference string) string {
+	return kind + ":" + reference
+}
+
+// MerchantAccount returns the account name of a merchant account type.
+func MerchantAccount(merchantID, accountType string) string {
+	return "merchant:" + merchantID + ":" + accountType
+}
+
+// Balance is a merchant's derived balance in one currency.
+type Balance struct {
+	Currency  string
+	Available int64
+	Pending   int64
+	Frozen    int64
+	Fees      int64
+}
+
+// Amount returns the balance of the given account type.
+func (b Balance) Amount(accountType string) int64 {
+	switch accountType {
+	case AccountAvailable:
+		return b.Available
+	case AccountPending:
+		return b.Pending
+	case AccountFrozen:
+		return b.Frozen
+	case AccountFees:
+		return b.Fees
+	default:
+		return 0
+	}
+}
+
+func (b *Balance) add(accountType string, amount int64) {
+	switch accountType {
+	case AccountAvailable:
+		b.Available += amount
+	case AccountPending:
+		b.Pending += amount
+	case AccountFrozen:
+		b.Frozen += amount
+	case AccountFees:
+		b.Fees += amount
+	}
+}
+
+// CurrencyTotal summarizes all journals in one currency.
+type CurrencyTotal struct {
+	Currency string `bson:"_id"`
+	Journals int64  `bson:"journals"`
+	Total    int64  `bson:"total"`
+}
+
+// Report is the result of an invariant check over every journal.
+type Report struct {
+	Currencies []CurrencyTotal
+	// Unbalanced lists journals whose postings do not sum to zero.
+	Unbalanced []string
+}
+
+// Balanced reports whether every journal, and therefore every currency, sums
+// to zero.
+func (r Report) Balanced() bool {
+	if len(r.Unbalanced) > 0 {
+		return false
+	}
+	for _, currency := range r.Currencies {
+		if currency.Total != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,225 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type journalCollection interface {
+	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+}
+
+type headCollection interface {
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+}
+
+// Repository persists journals in MongoDB and derives balances from them.
+// Account heads serialize postings that debit a merchant's pending balance.
+type Repository struct {
+	collection journalCollection
+	heads      headCollection
+}
+
+// NewRepository constructs a Repository over the journal and account head
+// collections.
+func NewRepository(collection journalCollection, heads headCollection) *Repository {
+	return &Repository{collection: collection, heads: heads}
+}
+
+// Lock writes the merchant's account head for currency. Called inside a
+// transaction, it makes concurrent transactions that lock the same head fail
+// with a write conflict and retry, so a balance read after Lock stays valid
+// until commit.
+func (r *Repository) Lock(ctx context.Context, merchantID, currency string) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if r.heads == nil {
+		return errors.New("ledger account heads are not configured")
+	}
+
+	if _, err := r.heads.UpdateOne(ctx,
+		bson.M{"merchant_id": merchantID, "currency": currency},
+		bson.M{
+			"$inc": bson.M{"version": int64(1)},
+			"$set": bson.M{"updated_at": time.Now().UTC().Truncate(time.Millisecond)},
+		},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return fmt.Errorf("lock ledger account: %w", err)
+	}
+
+	return nil
+}
+
+// Insert stores journals in order. A journal id that already exists yields
+// ErrDuplicateJournal. Callers needing all-or-nothing semantics run Insert
+// inside a transaction.
+func (r *Repository) Insert(ctx context.Context, journals ...Journal) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if len(journals) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(journals))
+	for _, journal := range journals {
+		docs = append(docs, journal)
+	}
+
+	if _, err := r.collection.InsertMany(ctx, docs); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%w: %v", ErrDuplicateJournal, err)
+		}
+		return fmt.Errorf("insert journals: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID returns a journal by id. It returns mongo.ErrNoDocuments when the
+// journal does not exist.
+func (r *Repository) GetByID(ctx context.Context, journalID string) (Journal, error) {
+	if err := r.check(ctx); err != nil {
+		return Journal{}, err
+	}
+
+	result := r.collection.FindOne(ctx, bson.M{"journal_id": journalID})
+	if result == nil {
+		return Journal{}, errors.New("find journal returned no result")
+	}
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Journal{}, err
+		}
+		return Journal{}, fmt.Errorf("find journal: %w", err)
+	}
+
+	var journal Journal
+	if err := result.Decode(&journal); err != nil {
+		return Journal{}, fmt.Errorf("decode journal: %w", err)
+	}
+
+	return journal, nil
+}
+
+// Balances sums the merchant's postings per currency and account type.
+func (r *Repository) Balances(ctx context.Context, merchantID string) ([]Balance, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	accounts := make(bson.A, 0, len(AccountTypes))
+	for _, accountType := range AccountTypes {
+		accounts = append(accounts, MerchantAccount(merchantID, accountType))
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"merchant_id": merchantID}}},
+		{{Key: "$unwind", Value: "$postings"}},
+		{{Key: "$match", Value: bson.M{"postings.account": bson.M{"$in": accounts}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"currency": "$currency", "account": "$postings.account"},
+			"amount": bson.M{"$sum": "$postings.amount"},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aggregate balances: %w", err)
+	}
+
+	var rows []struct {
+		Key struct {
+			Currency string `bson:"currency"`
+			Account  string `bson:"account"`
+		} `bson:"_id"`
+		Amount int64 `bson:"amount"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("decode balances: %w", err)
+	}
+
+	prefix := MerchantAccount(merchantID, "")
+	byCurrency := make(map[string]*Balance)
+	for _, row := range rows {
+		balance := byCurrency[row.Key.Currency]
+		if balance == nil {
+			balance = &Balance{Currency: row.Key.Currency}
+			byCurrency[row.Key.Currency] = balance
+		}
+		balance.add(strings.TrimPrefix(row.Key.Account, prefix), row.Amount)
+	}
+
+	balances := make([]Balance, 0, len(byCurrency))
+	for _, balance := range byCurrency {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Currency < balances[j].Currency })
+
+	return balances, nil
+}
+
+// Check sums every journal and reports per-currency totals together with any
+// journal whose postings do not sum to zero.
+func (r *Repository) Check(ctx context.Context) (Report, error) {
+	if err := r.check(ctx); err != nil {
+		return Report{}, err
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{
+			"journal_id": 1,
+			"currency":   1,
+			"total":      bson.M{"$sum": "$postings.amount"},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$currency",
+			"journals": bson.M{"$sum": 1},
+			"total":    bson.M{"$sum": "$total"},
+			"unbalanced": bson.M{"$push": bson.M{
+				"$cond": bson.A{bson.M{"$ne": bson.A{"$total", 0}}, "$journal_id", "$$REMOVE"},
+			}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("aggregate journals: %w", err)
+	}
+
+	var rows []struct {
+		CurrencyTotal `bson:",inline"`
+		Unbalanced    []string `bson:"unbalanced"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return Report{}, fmt.Errorf("decode journal totals: %w", err)
+	}
+
+	report := Report{Currencies: make([]CurrencyTotal, 0, len(rows))}
+	for _, row := range rows {
+		report.Currencies = append(report.Currencies, row.CurrencyTotal)
+		report.Unbalanced = append(report.Unbalanced, row.Unbalanced...)
+	}
+
+	return report, nil
+}
+
+func (r *Repository) check(ctx context.Context) error {
+	if r == nil || r.collection == nil {
+		return errors.New("ledger repository is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRepositoryInsertMapsDuplicates(t *testing.T) {
+	coll := &recordingJournalCollection{}
+	repo := NewRepository(coll, &recordingHeadCollection{})
+	ctx := context.Background()
+
+	journal := Journal{JournalID: "payment:ord_1", Kind: KindPayment, MerchantID: "shop", Currency: "USD"}
+	if err := repo.Insert(ctx, journal, journal); err != nil {
+		t.Fatalf("Insert returned error: %v", err)
+	}
+	if len(coll.inserted) != 2 {
+		t.Fatalf("expected both journals in one InsertMany, got %d", len(coll.inserted))
+	}
+
+	coll.insertErr = mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: 11000}}}}
+	if err := repo.Insert(ctx, journal); !errors.Is(err, ErrDuplicateJournal) {
+		t.Fatalf("expected ErrDuplicateJournal, got %v", err)
+	}
+
+	if err := NewRepository(nil, nil).Insert(ctx, journal); err == nil {
+		t.Fatalf("expected uninitialized repository to fail")
+	}
+}
+
+func TestRepositoryBalancesDecodesAggregation(t *testing.T) {
+	coll := &recordingJournalCollection{results: []interface{}{
+		bson.M{"_id": bson.M{"currency": "USD", "account": "merchant:shop:pending"}, "amount": int64(970)},
+		bson.M{"_id": bson.M{"currency": "USD", "account": "merchant:shop:fees"}, "amount": int64(30)},
+		bson.M{"_id": bson.M{"currency": "EUR", "account": "merchant:shop:available"}, "amount": int64(-5)},
+	}}
+	repo := NewRepository(coll, &recordingHeadCollection{})
+
+	balances, err := repo.Balances(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("Balances returned error: %v", err)
+	}
+	if len(balances) != 2 || balances[0].Currency != "EUR" || balances[1].Currency != "USD" {
+		t.Fatalf("expected balances sorted by currency, got %+v", balances)
+	}
+	if balances[0].Available != -5 || balances[1].Pending != 970 || balances[1].Fees != 30 {
+		t.Fatalf("unexpected balances %+v", balances)
+	}
+
+	match := coll.pipeline[0][0].Value.(bson.M)
+	if match["merchant_id"] != "shop" {
+		t.Fatalf("expected balances to be scoped to the merchant, got %v", match)
+	}
+}
+
+func TestRepositoryCheckDecodesReport(t *testing.T) {
+	coll := &recordingJournalCollection{results: []interface{}{
+		bson.M{"_id": "EUR", "journals": int64(2), "total": int64(0), "unbalanced": bson.A{}},
+		bson.M{"_id": "USD", "journals": int64(3), "total": int64(7), "unbalanced": bson.A{"payment:ord_bad"}},
+	}}
+	repo := NewRepository(coll, &recordingHeadCollection{})
+
+	report, err := repo.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if len(report.Currencies) != 2 || report.Currencies[1].Currency != "USD" || report.Currencies[1].Journals != 3 || report.Currencies[1].Total != 7 {
+		t.Fatalf("unexpected currency totals %+v", report.Currencies)
+	}
+	if len(report.Unbalanced) != 1 || report.Unbalanced[0] != "payment:ord_bad" || report.Balanced() {
+		t.Fatalf("expected one unbalanced journal, got %+v", report)
+	}
+}
+
+func TestRepositoryLockUpsertsAccountHead(t *testing.T) {
+	heads := &recordingHeadCollection{}
+	repo := NewRepository(&recordingJournalCollection{}, heads)
+
+	if err := repo.Lock(context.Background(), "shop", "USD"); err != nil {
+		t.Fatalf("Lock returned error: %v", err)
+	}
+	filter := heads.filter.(bson.M)
+	if filter["merchant_id"] != "shop" || filter["currency"] != "USD" {
+		t.Fatalf("unexpected head filter %v", filter)
+	}
+	if inc := heads.update.(bson.M)["$inc"].(bson.M); inc["version"] != int64(1) {
+		t.Fatalf("expected the head version to be bumped, got %v", heads.update)
+	}
+	if heads.upsert == nil || !*heads.upsert {
+		t.Fatalf("expected the head to be created on first use")
+	}
+
+	heads.err = errors.New("write conflict")
+	if err := repo.Lock(context.Background(), "shop", "USD"); !errors.Is(err, heads.err) {
+		t.Fatalf("expected lock errors to propagate, got %v", err)
+	}
+}
+
+type recordingHeadCollection struct {
+	filter interface{}
+	update interface{}
+	upsert *bool
+	err    error
+}
+
+func (c *recordingHeadCollection) UpdateOne(_ context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	c.filter, c.update = filter, update
+	for _, opt := range opts {
+		if opt.Upsert != nil {
+			c.upsert = opt.Upsert
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &mongo.UpdateResult{}, nil
+}
+
+type recordingJournalCollection struct {
+	inserted  []interface{}
+	insertErr error
+	results   []interface{}
+	pipeline  mongo.Pipeline
+}
+
+func (c *recordingJournalCollection) InsertMany(_ context.Context, documents []interface{}, _ ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	if c.insertErr != nil {
+		return nil, c.insertErr
+	}
+	c.inserted = append(c.inserted, documents...)
+	return &mongo.InsertManyResult{}, nil
+}
+
+func (c *recordingJournalCollection) FindOne(context.Context, interface{}, ...*options.FindOneOptions) *mongo.SingleResult {
+	return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+}
+
+func (c *recordingJournalCollection) Aggregate(_ context.Context, pipeline interface{}, _ ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	c.pipeline = pipeline.(mongo.Pipeline)
+	return mongo.NewCursorFromDocuments(c.results, nil, nil)
+}
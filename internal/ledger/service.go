@@ -0,0 +1,396 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+type journalStore interface {
+	Insert(ctx context.Context, journals ...Journal) error
+	Lock(ctx context.Context, merchantID, currency string) error
+	GetByID(ctx context.Context, journalID string) (Journal, error)
+	Balances(ctx context.Context, merchantID string) ([]Balance, error)
+	Check(ctx context.Context) (Report, error)
+}
+
+// transactor runs fn atomically. store.Manager satisfies it with a MongoDB
+// multi-document transaction.
+type transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type merchantReader interface {
+	GetByID(ctx context.Context, merchantID string) (domain.Merchant, error)
+	GetByGroupChatID(ctx context.Context, chatID int64) (domain.Merchant, error)
+}
+
+// Service posts journals for order events and settlements and reads derived
+// balances.
+type Service struct {
+	journals  journalStore
+	tx        transactor
+	merchants merchantReader
+	logger    *logrus.Entry
+	now       func() time.Time
+}
+
+// NewService constructs a Service. Every posting runs inside tx.
+func NewService(journals journalStore, tx transactor, merchants merchantReader, logger *logrus.Entry) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Service{
+		journals:  journals,
+		tx:        tx,
+		merchants: merchants,
+		logger:    logger,
+		now:       func() time.Time { return time.Now().UTC().Truncate(time.Millisecond) },
+	}
+}
+
+// OrderTransitioned posts the payment and fee journals when an order becomes
+// paid and the refund journal when it is refunded. It matches
+// domain.OrderTransitionListener and runs in the transition's transaction, so a
+// returned error rolls the status change back. Journals already posted for the
+// order are skipped; their ids are deterministic.
+func (s *Service) OrderTransitioned(ctx context.Context, order domain.Order, _ string) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+
+	var (
+		kind   string
+		record func(ctx context.Context, order domain.Order) error
+	)
+	switch order.Status {
+	case domain.OrderStatusPaid:
+		kind, record = KindPayment, s.RecordPayment
+	case domain.OrderStatusRefunded:
+		kind, record = KindRefund, s.RecordRefund
+	default:
+		return nil
+	}
+
+	fields := logging.Fields{
+		"order_id":    order.OrderID,
+		"merchant_id": order.MerchantID,
+		"kind":        kind,
+	}
+
+	// A failed duplicate insert would abort the surrounding transaction, so
+	// replays are detected before writing.
+	_, err := s.journals.GetByID(ctx, JournalID(kind, order.OrderID))
+	if err == nil {
+		fields["event"] = "ledger_duplicate"
+		s.logger.WithFields(fields).Info("ledger journal already posted")
+		return nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("find %s journal: %w", kind, err)
+	}
+
+	if err := record(ctx, order); err != nil {
+		fields["event"] = "ledger_post_failed"
+		s.logger.WithFields(fields).WithError(err).Error("failed to post ledger journal")
+		return fmt.Errorf("post %s journal: %w", kind, err)
+	}
+
+	return nil
+}
+
+// RecordPayment credits the order amount to the merchant's pending account and
+// deducts the merchant fee into the fees account, atomically.
+func (s *Service) RecordPayment(ctx context.Context, order domain.Order) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+
+	merchant, err := s.merchants.GetByID(ctx, order.MerchantID)
+	if err != nil {
+		return fmt.Errorf("load merchant: %w", err)
+	}
+
+	now := s.now()
+	pending := MerchantAccount(order.MerchantID, AccountPending)
+	journals := []Journal{{
+		JournalID:  JournalID(KindPayment, order.OrderID),
+		Kind:       KindPayment,
+		MerchantID: order.MerchantID,
+		OrderID:    order.OrderID,
+		Currency:   order.Currency,
+		Postings: []Posting{
+			{Account: ClearingAccount, Amount: -order.AmountMinor},
+			{Account: pending, Amount: order.AmountMinor},
+		},
+		CreatedAt: now,
+	}}
+
+	if fee := order.AmountMinor * merchant.FeeRateBps / domain.MaxFeeRateBps; fee > 0 {
+		journals = append(journals, Journal{
+			JournalID:  JournalID(KindFee, order.OrderID),
+			Kind:       KindFee,
+			MerchantID: order.MerchantID,
+			OrderID:    order.OrderID,
+			Currency:   order.Currency,
+			Postings: []Posting{
+				{Account: pending, Amount: -fee},
+				{Account: MerchantAccount(order.MerchantID, AccountFees), Amount: fee},
+			},
+			Memo:      fmt.Sprintf("%d bps", merchant.FeeRateBps),
+			CreatedAt: now,
+		})
+	}
+
+	return s.post(ctx, journals...)
+}
+
+// RecordRefund returns the paid amount to clearing. The merchant bears the
+// whole amount and fees are not returned. Funds come from pending first and the
+// remainder from available, which may then go negative. The account head is
+// locked so a concurrent settlement cannot spend the same pending funds.
+func (s *Service) RecordRefund(ctx context.Context, order domain.Order) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+
+	var journal Journal
+	err := s.transact(ctx, func(ctx context.Context) error {
+		if err := s.journals.Lock(ctx, order.MerchantID, order.Currency); err != nil {
+			return err
+		}
+
+		payment, err := s.journals.GetByID(ctx, JournalID(KindPayment, order.OrderID))
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("%w: order %s", ErrPaymentNotPosted, order.OrderID)
+		}
+		if err != nil {
+			return err
+		}
+
+		amount := credited(payment, MerchantAccount(order.MerchantID, AccountPending))
+		balance, err := s.balance(ctx, order.MerchantID, payment.Currency)
+		if err != nil {
+			return err
+		}
+		fromPending := min(max(balance.Pending, 0), amount)
+
+		postings := make([]Posting, 0, 3)
+		if fromPending > 0 {
+			postings = append(postings, Posting{Account: MerchantAccount(order.MerchantID, AccountPending), Amount: -fromPending})
+		}
+		if rest := amount - fromPending; rest > 0 {
+			postings = append(postings, Posting{Account: MerchantAccount(order.MerchantID, AccountAvailable), Amount: -rest})
+		}
+		postings = append(postings, Posting{Account: ClearingAccount, Amount: amount})
+
+		journal = Journal{
+			JournalID:  JournalID(KindRefund, order.OrderID),
+			Kind:       KindRefund,
+			MerchantID: order.MerchantID,
+			OrderID:    order.OrderID,
+			Currency:   payment.Currency,
+			Postings:   postings,
+			CreatedAt:  s.now(),
+		}
+		if err := journal.Validate(); err != nil {
+			return err
+		}
+
+		return s.journals.Insert(ctx, journal)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logPosted(journal)
+
+	return nil
+}
+
+// Settle moves amount from the merchant's pending account to available. It
+// returns ErrInsufficientFunds when pending does not cover the amount. The
+// account head is locked before the balance is read, so concurrent
+// settlements and refunds for the merchant and currency are serialized.
+// reference identifies the request and names the journal: a reference that
+// was already settled returns its journal with ErrDuplicateJournal and posts
+// nothing.
+func (s *Service) Settle(ctx context.Context, merchantID, currency string, amount int64, reference, memo string) (Journal, error) {
+	if err := s.check(ctx); err != nil {
+		return Journal{}, err
+	}
+	if amount <= 0 {
+		return Journal{}, errors.New("settlement amount must be positive")
+	}
+	if reference == "" {
+		return Journal{}, errors.New("settlement reference is required")
+	}
+
+	journal := Journal{
+		JournalID:  JournalID(KindSettlement, reference),
+		Kind:       KindSettlement,
+		MerchantID: merchantID,
+		Currency:   currency,
+		Postings: []Posting{
+			{Account: MerchantAccount(merchantID, AccountPending), Amount: -amount},
+			{Account: MerchantAccount(merchantID, AccountAvailable), Amount: amount},
+		},
+		Memo:      memo,
+		CreatedAt: s.now(),
+	}
+	if err := journal.Validate(); err != nil {
+		return Journal{}, err
+	}
+
+	var existing Journal
+	err := s.transact(ctx, func(ctx context.Context) error {
+		if err := s.journals.Lock(ctx, merchantID, currency); err != nil {
+			return err
+		}
+
+		// Checked before inserting so a replay does not abort the transaction.
+		found, err := s.journals.GetByID(ctx, journal.JournalID)
+		if err == nil {
+			existing = found
+			return fmt.Errorf("%w: %s", ErrDuplicateJournal, journal.JournalID)
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+
+		balance, err := s.balance(ctx, merchantID, currency)
+		if err != nil {
+			return err
+		}
+		if balance.Pending < amount {
+			return fmt.Errorf("%w: pending %d < %d", ErrInsufficientFunds, balance.Pending, amount)
+		}
+
+		return s.journals.Insert(ctx, journal)
+	})
+	if errors.Is(err, ErrDuplicateJournal) && existing.JournalID != "" {
+		return existing, err
+	}
+	if err != nil {
+		return Journal{}, err
+	}
+
+	s.logPosted(journal)
+
+	return journal, nil
+}
+
+// Balances returns the merchant's derived balances per currency.
+func (s *Service) Balances(ctx context.Context, merchantID string) ([]Balance, error) {
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.journals.Balances(ctx, merchantID)
+}
+
+// CheckInvariants verifies that every journal, and every currency overall,
+// sums to zero. Violations are logged as ledger_invariant_violation.
+func (s *Service) CheckInvariants(ctx context.Context) (Report, error) {
+	if err := s.check(ctx); err != nil {
+		return Report{}, err
+	}
+
+	report, err := s.journals.Check(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if !report.Balanced() {
+		s.logger.WithFields(logging.Fields{
+			"event":      "ledger_invariant_violation",
+			"unbalanced": report.Unbalanced,
+		}).Error("ledger journals do not sum to zero")
+	}
+
+	return report, nil
+}
+
+func (s *Service) post(ctx context.Context, journals ...Journal) error {
+	for _, journal := range journals {
+		if err := journal.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.transact(ctx, func(ctx context.Context) error {
+		return s.journals.Insert(ctx, journals...)
+	}); err != nil {
+		return err
+	}
+
+	for _, journal := range journals {
+		s.logPosted(journal)
+	}
+
+	return nil
+}
+
+func (s *Service) transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.tx == nil {
+		return errors.New("ledger transactor is not configured")
+	}
+
+	return s.tx.WithTransaction(ctx, fn)
+}
+
+func (s *Service) balance(ctx context.Context, merchantID, currency string) (Balance, error) {
+	balances, err := s.journals.Balances(ctx, merchantID)
+	if err != nil {
+		return Balance{}, err
+	}
+	for _, balance := range balances {
+		if balance.Currency == currency {
+			return balance, nil
+		}
+	}
+
+	return Balance{Currency: currency}, nil
+}
+
+func (s *Service) logPosted(journal Journal) {
+	s.logger.WithFields(logging.Fields{
+		"event":       "ledger_posted",
+		"journal_id":  journal.JournalID,
+		"kind":        journal.Kind,
+		"merchant_id": journal.MerchantID,
+		"order_id":    journal.OrderID,
+		"currency":    journal.Currency,
+	}).Info("posted ledger journal")
+}
+
+func (s *Service) check(ctx context.Context) error {
+	if s == nil || s.journals == nil || s.merchants == nil {
+		return errors.New("ledger service is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
+
+// credited returns the amount the journal posts to account.
+func credited(journal Journal, account string) int64 {
+	var amount int64
+	for _, posting := range journal.Postings {
+		if posting.Account == account {
+			amount += posting.Amount
+		}
+	}
+
+	return amount
+}
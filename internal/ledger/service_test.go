@@ -0,0 +1,412 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func TestJournalValidate(t *testing.T) {
+	valid := Journal{
+		JournalID:  "payment:ord_1",
+		Kind:       KindPayment,
+		MerchantID: "shop",
+		Currency:   "USD",
+		Postings:   []Posting{{Account: ClearingAccount, Amount: -100}, {Account: "merchant:shop:pending", Amount: 100}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid journal, got %v", err)
+	}
+
+	unbalanced := valid
+	unbalanced.Postings = []Posting{{Account: ClearingAccount, Amount: -100}, {Account: "merchant:shop:pending", Amount: 99}}
+	if err := unbalanced.Validate(); !errors.Is(err, ErrUnbalancedJournal) {
+		t.Fatalf("expected ErrUnbalancedJournal, got %v", err)
+	}
+
+	single := valid
+	single.Postings = valid.Postings[:1]
+	zero := valid
+	zero.Postings = []Posting{{Account: ClearingAccount, Amount: 0}, {Account: "merchant:shop:pending", Amount: 0}}
+	unknown := valid
+	unknown.Kind = "bonus"
+	for _, journal := range []Journal{single, zero, unknown} {
+		if err := journal.Validate(); err == nil {
+			t.Fatalf("expected validation error for %+v", journal)
+		}
+	}
+}
+
+func TestRecordPaymentPostsPaymentAndFee(t *testing.T) {
+	env := newLedgerEnv()
+	ctx := context.Background()
+
+	if err := env.service.RecordPayment(ctx, env.order(1000)); err != nil {
+		t.Fatalf("RecordPayment returned error: %v", err)
+	}
+	if env.tx.calls != 1 {
+		t.Fatalf("expected payment and fee to post in one transaction, got %d", env.tx.calls)
+	}
+
+	balance := env.balance(t, "USD")
+	if balance.Pending != 975 || balance.Fees != 25 || balance.Available != 0 {
+		t.Fatalf("unexpected balance after payment: %+v", balance)
+	}
+	if fee, err := env.store.GetByID(ctx, JournalID(KindFee, "ord_ledger1")); err != nil || fee.Memo != "250 bps" {
+		t.Fatalf("expected fee journal with rate memo, got %+v err=%v", fee, err)
+	}
+
+	if err := env.service.RecordPayment(ctx, env.order(1000)); !errors.Is(err, ErrDuplicateJournal) {
+		t.Fatalf("expected replayed payment to be rejected, got %v", err)
+	}
+	if balance := env.balance(t, "USD"); balance.Pending != 975 {
+		t.Fatalf("expected replay not to change balances, got %+v", balance)
+	}
+
+	assertBalanced(t, env.service)
+}
+
+func TestRecordRefundDrainsPendingBeforeAvailable(t *testing.T) {
+	env := newLedgerEnv()
+	ctx := context.Background()
+
+	if err := env.service.RecordRefund(ctx, env.order(1000)); !errors.Is(err, ErrPaymentNotPosted) {
+		t.Fatalf("expected refund without payment to fail, got %v", err)
+	}
+
+	if err := env.service.RecordPayment(ctx, env.order(1000)); err != nil {
+		t.Fatalf("RecordPayment returned error: %v", err)
+	}
+	if _, err := env.service.Settle(ctx, "shop", "USD", 975, "-100:1", "test"); err != nil {
+		t.Fatalf("Settle returned error: %v", err)
+	}
+	if err := env.service.RecordRefund(ctx, env.order(1000)); err != nil {
+		t.Fatalf("RecordRefund returned error: %v", err)
+	}
+
+	refund, _ := env.store.GetByID(ctx, JournalID(KindRefund, "ord_ledger1"))
+	if refund.Postings[0].Account != MerchantAccount("shop", AccountAvailable) || refund.Postings[0].Amount != -1000 {
+		t.Fatalf("expected settled order to be refunded from available, got %+v", refund.Postings)
+	}
+	if balance := env.balance(t, "USD"); balance.Available != -25 || balance.Pending != 0 || balance.Fees != 25 {
+		t.Fatalf("expected merchant to bear the fee on refund, got %+v", balance)
+	}
+
+	second := env.order(400)
+	second.OrderID = "ord_ledger2"
+	if err := env.service.RecordPayment(ctx, second); err != nil {
+		t.Fatalf("RecordPayment returned error: %v", err)
+	}
+	if err := env.service.RecordRefund(ctx, second); err != nil {
+		t.Fatalf("RecordRefund returned error: %v", err)
+	}
+	refund, _ = env.store.GetByID(ctx, JournalID(KindRefund, "ord_ledger2"))
+	if refund.Postings[0].Amount != -390 || refund.Postings[1].Account != MerchantAccount("shop", AccountAvailable) || refund.Postings[1].Amount != -10 {
+		t.Fatalf("expected refund to drain pending before available, got %+v", refund.Postings)
+	}
+
+	assertBalanced(t, env.service)
+}
+
+func TestSettleRequiresPendingFunds(t *testing.T) {
+	env := newLedgerEnv()
+	ctx := context.Background()
+
+	if _, err := env.service.Settle(ctx, "shop", "USD", 1, "-100:2", "test"); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+	if _, err := env.service.Settle(ctx, "shop", "USD", 0, "-100:3", "test"); err == nil {
+		t.Fatalf("expected non-positive settlement to fail")
+	}
+
+	if err := env.service.RecordPayment(ctx, env.order(1000)); err != nil {
+		t.Fatalf("RecordPayment returned error: %v", err)
+	}
+	journal, err := env.service.Settle(ctx, "shop", "USD", 500, "-100:4", "test")
+	if err != nil {
+		t.Fatalf("Settle returned error: %v", err)
+	}
+	if journal.JournalID != JournalID(KindSettlement, "-100:4") {
+		t.Fatalf("unexpected settlement journal id %q", journal.JournalID)
+	}
+	replayed, err := env.service.Settle(ctx, "shop", "USD", 100, "-100:4", "test")
+	if !errors.Is(err, ErrDuplicateJournal) || replayed.JournalID != journal.JournalID || replayed.Postings[1].Amount != 500 {
+		t.Fatalf("expected a settled reference to return its journal, got %+v err=%v", replayed, err)
+	}
+	if balance := env.balance(t, "USD"); balance.Pending != 475 || balance.Available != 500 {
+		t.Fatalf("unexpected balance after settlement: %+v", balance)
+	}
+	if len(env.store.locks) != 3 || env.store.locks[1] != "shop/USD" {
+		t.Fatalf("expected every settlement to lock the account head, got %v", env.store.locks)
+	}
+}
+
+func TestOrderTransitionedPostsOnPaidAndRefunded(t *testing.T) {
+	env := newLedgerEnv()
+	hookLogger, hook := logtest.NewNullLogger()
+	env.service.logger = logrus.NewEntry(hookLogger)
+	ctx := context.Background()
+
+	order := env.order(1000)
+	order.Status = domain.OrderStatusPending
+	if err := env.service.OrderTransitioned(ctx, order, domain.OrderStatusCreated); err != nil || len(env.store.journals) != 0 {
+		t.Fatalf("expected pending transition not to post journals, got err=%v", err)
+	}
+
+	order.Status = domain.OrderStatusPaid
+	if err := env.service.OrderTransitioned(ctx, order, domain.OrderStatusPending); err != nil {
+		t.Fatalf("OrderTransitioned returned error: %v", err)
+	}
+	if err := env.service.OrderTransitioned(ctx, order, domain.OrderStatusPending); err != nil {
+		t.Fatalf("expected replayed transition to be skipped, got %v", err)
+	}
+	if findEvent(hook.AllEntries(), "ledger_duplicate") == nil {
+		t.Fatalf("expected replayed transition to log ledger_duplicate")
+	}
+
+	order.Status = domain.OrderStatusRefunded
+	if err := env.service.OrderTransitioned(ctx, order, domain.OrderStatusPaid); err != nil {
+		t.Fatalf("OrderTransitioned returned error: %v", err)
+	}
+	if _, err := env.store.GetByID(ctx, JournalID(KindRefund, order.OrderID)); err != nil {
+		t.Fatalf("expected refund journal, got %v", err)
+	}
+
+	env.store.insertErr = errors.New("mongo down")
+	other := env.order(10)
+	other.OrderID = "ord_ledger3"
+	other.Status = domain.OrderStatusPaid
+	if err := env.service.OrderTransitioned(ctx, other, domain.OrderStatusPending); !errors.Is(err, env.store.insertErr) {
+		t.Fatalf("expected failed posting to fail the transition, got %v", err)
+	}
+	if findEvent(hook.AllEntries(), "ledger_post_failed") == nil {
+		t.Fatalf("expected ledger_post_failed log entry")
+	}
+}
+
+func TestCheckInvariantsReportsUnbalancedJournals(t *testing.T) {
+	env := newLedgerEnv()
+	hookLogger, hook := logtest.NewNullLogger()
+	env.service.logger = logrus.NewEntry(hookLogger)
+	ctx := context.Background()
+
+	if err := env.service.RecordPayment(ctx, env.order(1000)); err != nil {
+		t.Fatalf("RecordPayment returned error: %v", err)
+	}
+	assertBalanced(t, env.service)
+
+	// Bypass validation to simulate a corrupted journal.
+	env.store.journals = append(env.store.journals, Journal{
+		JournalID: "payment:ord_corrupt",
+		Currency:  "USD",
+		Postings:  []Posting{{Account: ClearingAccount, Amount: -5}},
+	})
+
+	report, err := env.service.CheckInvariants(ctx)
+	if err != nil {
+		t.Fatalf("CheckInvariants returned error: %v", err)
+	}
+	if report.Balanced() || len(report.Unbalanced) != 1 || report.Unbalanced[0] != "payment:ord_corrupt" {
+		t.Fatalf("expected corrupted journal to be reported, got %+v", report)
+	}
+	if findEvent(hook.AllEntries(), "ledger_invariant_violation") == nil {
+		t.Fatalf("expected ledger_invariant_violation log entry")
+	}
+}
+
+type ledgerEnv struct {
+	service   *Service
+	store     *memoryJournals
+	tx        *fakeTransactor
+	merchants fakeMerchants
+}
+
+func newLedgerEnv() *ledgerEnv {
+	store := &memoryJournals{}
+	tx := &fakeTransactor{}
+	merchants := fakeMerchants{"shop": {MerchantID: "shop", FeeRateBps: 250, GroupChatIDs: []int64{-100}}}
+
+	return &ledgerEnv{
+		service:   NewService(store, tx, merchants, logrus.NewEntry(logrus.New())),
+		store:     store,
+		tx:        tx,
+		merchants: merchants,
+	}
+}
+
+func (e *ledgerEnv) order(amount int64) domain.Order {
+	return domain.Order{OrderID: "ord_ledger1", MerchantID: "shop", AmountMinor: amount, Currency: "USD", Status: domain.OrderStatusPaid}
+}
+
+func (e *ledgerEnv) balance(t *testing.T, currency string) Balance {
+	t.Helper()
+
+	balance, err := e.service.balance(context.Background(), "shop", currency)
+	if err != nil {
+		t.Fatalf("balance returned error: %v", err)
+	}
+	return balance
+}
+
+func assertBalanced(t *testing.T, service *Service) {
+	t.Helper()
+
+	report, err := service.CheckInvariants(context.Background())
+	if err != nil {
+		t.Fatalf("CheckInvariants returned error: %v", err)
+	}
+	if !report.Balanced() {
+		t.Fatalf("expected ledger to be balanced, got %+v", report)
+	}
+}
+
+type fakeTransactor struct {
+	calls int
+}
+
+func (f *fakeTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.calls++
+	return fn(ctx)
+}
+
+type fakeMerchants map[string]domain.Merchant
+
+func (f fakeMerchants) GetByID(_ context.Context, merchantID string) (domain.Merchant, error) {
+	merchant, ok := f[domain.NormalizeMerchantID(merchantID)]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	return merchant, nil
+}
+
+func (f fakeMerchants) GetByGroupChatID(_ context.Context, chatID int64) (domain.Merchant, error) {
+	for _, merchant := range f {
+		if merchant.HasGroup(chatID) {
+			return merchant, nil
+		}
+	}
+	return domain.Merchant{}, mongo.ErrNoDocuments
+}
+
+// memoryJournals evaluates balances and invariants in Go over the stored
+// journals, mirroring the repository's aggregations.
+type memoryJournals struct {
+	mu        sync.Mutex
+	journals  []Journal
+	locks     []string
+	insertErr error
+}
+
+func (m *memoryJournals) Lock(_ context.Context, merchantID, currency string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.locks = append(m.locks, merchantID+"/"+currency)
+	return nil
+}
+
+func (m *memoryJournals) Insert(_ context.Context, journals ...Journal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.insertErr != nil {
+		return m.insertErr
+	}
+	for _, journal := range journals {
+		for _, existing := range m.journals {
+			if existing.JournalID == journal.JournalID {
+				return fmt.Errorf("%w: %s", ErrDuplicateJournal, journal.JournalID)
+			}
+		}
+	}
+	m.journals = append(m.journals, journals...)
+	return nil
+}
+
+func (m *memoryJournals) GetByID(_ context.Context, journalID string) (Journal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, journal := range m.journals {
+		if journal.JournalID == journalID {
+			return journal, nil
+		}
+	}
+	return Journal{}, mongo.ErrNoDocuments
+}
+
+func (m *memoryJournals) Balances(_ context.Context, merchantID string) ([]Balance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byCurrency := make(map[string]*Balance)
+	prefix := MerchantAccount(merchantID, "")
+	for _, journal := range m.journals {
+		for _, posting := range journal.Postings {
+			if !strings.HasPrefix(posting.Account, prefix) {
+				continue
+			}
+			balance := byCurrency[journal.Currency]
+			if balance == nil {
+				balance = &Balance{Currency: journal.Currency}
+				byCurrency[journal.Currency] = balance
+			}
+			balance.add(strings.TrimPrefix(posting.Account, prefix), posting.Amount)
+		}
+	}
+
+	balances := make([]Balance, 0, len(byCurrency))
+	for _, balance := range byCurrency {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Currency < balances[j].Currency })
+	return balances, nil
+}
+
+func (m *memoryJournals) Check(context.Context) (Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals := make(map[string]*CurrencyTotal)
+	var report Report
+	for _, journal := range m.journals {
+		var sum int64
+		for _, posting := range journal.Postings {
+			sum += posting.Amount
+		}
+		if sum != 0 {
+			report.Unbalanced = append(report.Unbalanced, journal.JournalID)
+		}
+		total := totals[journal.Currency]
+		if total == nil {
+			total = &CurrencyTotal{Currency: journal.Currency}
+			totals[journal.Currency] = total
+		}
+		total.Journals++
+		total.Total += sum
+	}
+	for _, total := range totals {
+		report.Currencies = append(report.Currencies, *total)
+	}
+	sort.Slice(report.Currencies, func(i, j int) bool { return report.Currencies[i].Currency < report.Currencies[j].Currency })
+	return report, nil
+}
+
+func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
+	for _, entry := range entries {
+		if entry.Data["event"] == event {
+			return entry
+		}
+	}
+	return nil
+}
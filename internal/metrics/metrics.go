@@ -0,0 +1,174 @@
+// Package metrics collects Prometheus metrics for the bot and serves them over
+// HTTP at /metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tg_bot"
+
+// Metrics owns a registry and the bot's collectors. Every method is safe on a
+// nil receiver so callers can leave metrics disabled.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	updates        *prometheus.CounterVec
+	commands       *prometheus.CounterVec
+	registrations  *prometheus.CounterVec
+	telegramErrors *prometheus.CounterVec
+	updateLatency  *prometheus.HistogramVec
+	mongoLatency   *prometheus.HistogramVec
+}
+
+// New builds the collectors on a private registry, including the Go runtime
+// and process collectors and an uptime gauge measured from processStart.
+func New(processStart time.Time) *Metrics {
+	if processStart.IsZero() {
+		processStart = time.Now()
+	}
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_total",
+			Help:      "Telegram updates received, by update type.",
+		}, []string{"type"}),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_total",
+			Help:      "Commands routed, by command name and outcome.",
+		}, []string{"command", "outcome"}),
+		registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "registrations_total",
+			Help:      "Users and groups seen for the first time.",
+		}, []string{"kind"}),
+		telegramErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "telegram_request_errors_total",
+			Help:      "Failed Telegram Bot API requests, by method.",
+		}, []string{"method"}),
+		updateLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "update_handler_duration_seconds",
+			Help:      "Time spent handling one Telegram update, by update type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type"}),
+		mongoLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mongo_operation_duration_seconds",
+			Help:      "MongoDB command latency, by command, collection, and outcome.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "collection", "outcome"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.updates,
+		m.commands,
+		m.registrations,
+		m.telegramErrors,
+		m.updateLatency,
+		m.mongoLatency,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "uptime_seconds",
+			Help:      "Seconds since the process started.",
+		}, func() float64 {
+			return time.Since(processStart).Seconds()
+		}),
+	)
+
+	return m
+}
+
+// Registry exposes the private registry, mainly so tests can gather from it.
+func (m *Metrics) Registry() *prometheus.Registry {
+	if m == nil {
+		return nil
+	}
+	return m.registry
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// UpdateReceived counts an incoming update.
+func (m *Metrics) UpdateReceived(updateType string) {
+	if m == nil {
+		return
+	}
+	m.updates.WithLabelValues(updateType).Inc()
+}
+
+// UpdateHandled records how long handling an update took.
+func (m *Metrics) UpdateHandled(updateType string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.updateLatency.WithLabelValues(updateType).Observe(d.Seconds())
+}
+
+// CommandRouted counts a command by name and outcome.
+func (m *Metrics) CommandRouted(command, outcome string) {
+	if m == nil {
+		return
+	}
+	m.commands.WithLabelValues(command, outcome).Inc()
+}
+
+// Registered counts a user or group stored for the first time.
+func (m *Metrics) Registered(kind string) {
+	if m == nil {
+		return
+	}
+	m.registrations.WithLabelValues(kind).Inc()
+}
+
+// TelegramRequestFailed counts a failed Bot API call.
+func (m *Metrics) TelegramRequestFailed(method string) {
+	if m == nil {
+		return
+	}
+	m.telegramErrors.WithLabelValues(method).Inc()
+}
+
+// ObserveMongoOperation records the latency of one MongoDB command.
+func (m *Metrics) ObserveMongoOperation(operation, collection string, d time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+	outcome := "ok"
+	if failed {
+		outcome = "error"
+	}
+	m.mongoLatency.WithLabelValues(operation, collection, outcome).Observe(d.Seconds())
+}
+
+// TrackUpdateQueue exports the update dispatcher's queue depth, read on every
+// scrape.
+func (m *Metrics) TrackUpdateQueue(depth func() int) {
+	if m == nil || depth == nil {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "update_queue_depth",
+		Help:      "Telegram updates waiting for a dispatcher worker.",
+	}, func() float64 {
+		return float64(depth())
+	}))
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsRecordsCounters(t *testing.T) {
+	m := New(time.Now().Add(-time.Minute))
+
+	m.UpdateReceived("message")
+	m.UpdateReceived("message")
+	m.CommandRouted("status", "denied")
+	m.Registered("group")
+	m.TelegramRequestFailed("sendMessage")
+
+	if got := testutil.ToFloat64(m.updates.WithLabelValues("message")); got != 2 {
+		t.Fatalf("expected 2 message updates, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.commands.WithLabelValues("status", "denied")); got != 1 {
+		t.Fatalf("expected 1 denied status command, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.registrations.WithLabelValues("group")); got != 1 {
+		t.Fatalf("expected 1 group registration, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.telegramErrors.WithLabelValues("sendMessage")); got != 1 {
+		t.Fatalf("expected 1 sendMessage failure, got %v", got)
+	}
+}
+
+func TestMetricsRecordsLatencies(t *testing.T) {
+	m := New(time.Now())
+
+	m.UpdateHandled("message", 20*time.Millisecond)
+	m.ObserveMongoOperation("find", "users", 3*time.Millisecond, false)
+	m.ObserveMongoOperation("insert", "orders", time.Millisecond, true)
+
+	if got := testutil.CollectAndCount(m.updateLatency); got != 1 {
+		t.Fatalf("expected one update latency series, got %d", got)
+	}
+	if got := testutil.CollectAndCount(m.mongoLatency); got != 2 {
+		t.Fatalf("expected ok and error mongo series, got %d", got)
+	}
+}
+
+func TestHandlerServesExpositionFormat(t *testing.T) {
+	m := New(time.Now().Add(-time.Hour))
+	m.TrackUpdateQueue(func() int { return 3 })
+	m.UpdateReceived("callback_query")
+
+	server := httptest.NewServer(NewServer(":0", m, nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + Path)
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	for _, want := range []string{
+		`tg_bot_updates_total{type="callback_query"} 1`,
+		"tg_bot_update_queue_depth 3",
+		"tg_bot_uptime_seconds",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("expected %q in scrape output", want)
+		}
+	}
+}
+
+func TestNilMetricsAreNoops(t *testing.T) {
+	var m *Metrics
+
+	m.UpdateReceived("message")
+	m.UpdateHandled("message", time.Second)
+	m.CommandRouted("status", "handled")
+	m.Registered("user")
+	m.TelegramRequestFailed("getMe")
+	m.ObserveMongoOperation("find", "users", time.Millisecond, false)
+	m.TrackUpdateQueue(func() int { return 1 })
+
+	if m.Registry() != nil {
+		t.Fatalf("expected nil registry")
+	}
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 from nil metrics, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// Path is where the metrics are served.
+const Path = "/metrics"
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// Server exposes the metrics over HTTP. Further operational endpoints can be
+// mounted on the same listener with Handle before Start.
+type Server struct {
+	listenAddr string
+	mux        *http.ServeMux
+	logger     *logrus.Entry
+}
+
+// NewServer constructs a Server serving m at Path on listenAddr.
+func NewServer(listenAddr string, m *Metrics, logger *logrus.Entry) *Server {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET "+Path, m.Handler())
+
+	return &Server{
+		listenAddr: listenAddr,
+		mux:        mux,
+		logger:     logger,
+	}
+}
+
+// Handle registers an additional handler on the listener.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Handler returns the HTTP handler serving all registered endpoints.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves until the context is canceled, then shuts the listener down
+// gracefully.
+func (s *Server) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	server := &http.Server{
+		Addr:              s.listenAddr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "metrics_listen",
+		"listen_addr": s.listenAddr,
+	}).Info("starting metrics listener")
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithFields(logging.Fields{
+				"event":       "metrics_server_error",
+				"listen_addr": s.listenAddr,
+			}).WithError(err).Error("metrics listener failed")
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.logger.WithField("event", "metrics_shutdown_error").WithError(err).Error("failed to stop metrics listener")
+	}
+	cancel()
+
+	s.logger.WithField("event", "metrics_stopped").Info("metrics listener stopped")
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const retryUsage = "Usage: /notify_retry <order_id>"
+
+// Commands returns the notification commands for registration with the
+// Telegram client.
+func (d *Dispatcher) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			Name:        "notify_retry",
+			Description: "Retry merchant notifications for an order",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(d.logger, d.retry),
+		},
+	}
+}
+
+func (d *Dispatcher) retry(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if d == nil || d.notifications == nil || d.orders == nil {
+		return "", errors.New("notification dispatcher is not initialized")
+	}
+	if len(req.Args) != 1 {
+		return retryUsage, nil
+	}
+
+	orderID := req.Args[0]
+	count, err := d.Retry(ctx, orderID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Sprintf("Order %s not found.", orderID), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return fmt.Sprintf("Order %s has no merchant notifications to send.", orderID), nil
+	}
+
+	d.logger.WithFields(logging.Fields{
+		"event":    "notify_retry_requested",
+		"order_id": orderID,
+		"user_id":  req.UserID,
+	}).Info("merchant notification retry requested")
+
+	return fmt.Sprintf("Queued %d notification(s) for order %s.", count, orderID), nil
+}
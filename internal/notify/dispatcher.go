@@ -0,0 +1,468 @@
+// Package notify delivers signed merchant webhooks for order events from the
+// Mongo-backed notification outbox.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// Headers sent with every merchant notification.
+const (
+	SignatureHeader = "X-Notify-Signature"
+	EventHeader     = "X-Notify-Event"
+)
+
+const (
+	storeTimeout     = 5 * time.Second
+	maxResponseBytes = 4 << 10
+)
+
+type notificationStore interface {
+	Enqueue(ctx context.Context, order domain.Order, event string) (bool, error)
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (domain.Notification, error)
+	RecordAttempt(ctx context.Context, notificationID string, lockedUntil time.Time, attempt domain.NotificationAttempt, status string, nextAttemptAt time.Time) error
+	Requeue(ctx context.Context, orderID string) (int64, error)
+}
+
+type orderReader interface {
+	GetByID(ctx context.Context, orderID string) (domain.Order, error)
+}
+
+type merchantReader interface {
+	GetByID(ctx context.Context, merchantID string) (domain.Merchant, error)
+}
+
+// Settings tunes delivery concurrency and retry behavior.
+type Settings struct {
+	// Workers is the number of concurrent delivery workers.
+	Workers int
+	// MaxAttempts caps delivery attempts before a notification is marked
+	// failed.
+	MaxAttempts int
+	// BaseBackoff is the delay after the first failed attempt; it doubles for
+	// each further failure up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// PollInterval is how often idle workers look for due notifications.
+	PollInterval time.Duration
+	// RequestTimeout bounds each HTTP delivery.
+	RequestTimeout time.Duration
+	// Lease is how long a claimed notification stays reserved for a worker.
+	Lease time.Duration
+}
+
+// DefaultSettings returns the production delivery settings.
+func DefaultSettings() Settings {
+	return Settings{
+		Workers:        4,
+		MaxAttempts:    8,
+		BaseBackoff:    30 * time.Second,
+		MaxBackoff:     time.Hour,
+		PollInterval:   5 * time.Second,
+		RequestTimeout: 10 * time.Second,
+		Lease:          time.Minute,
+	}
+}
+
+// Option configures optional Dispatcher dependencies.
+type Option func(*Dispatcher)
+
+// WithSettings overrides the delivery settings. Zero fields keep defaults.
+func WithSettings(settings Settings) Option {
+	return func(d *Dispatcher) {
+		defaults := d.settings
+		d.settings = settings
+		if d.settings.Workers <= 0 {
+			d.settings.Workers = defaults.Workers
+		}
+		if d.settings.MaxAttempts <= 0 {
+			d.settings.MaxAttempts = defaults.MaxAttempts
+		}
+		if d.settings.BaseBackoff <= 0 {
+			d.settings.BaseBackoff = defaults.BaseBackoff
+		}
+		if d.settings.MaxBackoff <= 0 {
+			d.settings.MaxBackoff = defaults.MaxBackoff
+		}
+		if d.settings.PollInterval <= 0 {
+			d.settings.PollInterval = defaults.PollInterval
+		}
+		if d.settings.RequestTimeout <= 0 {
+			d.settings.RequestTimeout = defaults.RequestTimeout
+		}
+		if d.settings.Lease <= 0 {
+			d.settings.Lease = defaults.Lease
+		}
+	}
+}
+
+// WithHTTPClient replaces the HTTP client used for deliveries.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		if client != nil {
+			d.httpClient = client
+		}
+	}
+}
+
+// WithClock injects the time source used for scheduling.
+func WithClock(now func() time.Time) Option {
+	return func(d *Dispatcher) {
+		if now != nil {
+			d.now = now
+		}
+	}
+}
+
+// Dispatcher enqueues merchant notifications on order events and delivers
+// them with a worker pool, retrying failures with exponential backoff.
+type Dispatcher struct {
+	notifications notificationStore
+	orders        orderReader
+	merchants     merchantReader
+	logger        *logrus.Entry
+	settings      Settings
+	httpClient    *http.Client
+	now           func() time.Time
+	wake          chan struct{}
+}
+
+// NewDispatcher constructs a Dispatcher over the notification outbox.
+func NewDispatcher(notifications notificationStore, orders orderReader, merchants merchantReader, logger *logrus.Entry, opts ...Option) *Dispatcher {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	d := &Dispatcher{
+		notifications: notifications,
+		orders:        orders,
+		merchants:     merchants,
+		logger:        logger,
+		settings:      DefaultSettings(),
+		httpClient:    &http.Client{},
+		now:           func() time.Time { return time.Now().UTC() },
+		wake:          make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(d)
+		}
+	}
+
+	return d
+}
+
+// OrderTransitioned enqueues a notification when an order becomes paid or
+// refunded. It matches domain.OrderTransitionListener and runs in the
+// transition's transaction, so the outbox entry commits with the status change
+// and a failed enqueue rolls the transition back. Workers pick the entry up on
+// their next poll if the wake-up arrives before the commit.
+func (d *Dispatcher) OrderTransitioned(ctx context.Context, order domain.Order, _ string) error {
+	event := domain.NotificationEventForStatus(order.Status)
+	if event == "" {
+		return nil
+	}
+
+	fields := logging.Fields{
+		"order_id":    order.OrderID,
+		"merchant_id": order.MerchantID,
+		"notify":      event,
+	}
+
+	created, err := d.notifications.Enqueue(ctx, order, event)
+	if err != nil {
+		fields["event"] = "notify_enqueue_failed"
+		d.logger.WithFields(fields).WithError(err).Error("failed to enqueue merchant notification")
+		return err
+	}
+	if created {
+		fields["event"] = "notify_enqueued"
+		d.logger.WithFields(fields).Info("enqueued merchant notification")
+	}
+
+	d.signal()
+	return nil
+}
+
+// Retry requeues the order's undelivered notifications with a fresh attempt
+// budget. When none are left, one is enqueued for the order's current status
+// unless it already exists. It returns how many notifications were queued;
+// zero means there is nothing left to send.
+func (d *Dispatcher) Retry(ctx context.Context, orderID string) (int64, error) {
+	count, err := d.notifications.Requeue(ctx, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		order, err := d.orders.GetByID(ctx, orderID)
+		if err != nil {
+			return 0, err
+		}
+
+		event := domain.NotificationEventForStatus(order.Status)
+		if event == "" {
+			return 0, nil
+		}
+		created, err := d.notifications.Enqueue(ctx, order, event)
+		if err != nil {
+			return 0, err
+		}
+		if !created {
+			return 0, nil
+		}
+		count = 1
+	}
+
+	d.logger.WithFields(logging.Fields{
+		"event":    "notify_requeued",
+		"order_id": orderID,
+		"count":    count,
+	}).Info("requeued merchant notifications")
+
+	d.signal()
+
+	return count, nil
+}
+
+// Start runs the worker pool until the context is canceled and waits for
+// in-flight deliveries to finish. Interrupted deliveries are not recorded and
+// are retried once their lease expires.
+func (d *Dispatcher) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	d.logger.WithFields(logging.Fields{
+		"event":        "notify_started",
+		"workers":      d.settings.Workers,
+		"max_attempts": d.settings.MaxAttempts,
+	}).Info("starting merchant notification workers")
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.settings.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	d.logger.WithField("event", "notify_stopped").Info("merchant notification workers stopped")
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	timer := time.NewTimer(d.settings.PollInterval)
+	defer timer.Stop()
+
+	for ctx.Err() == nil {
+		notification, err := d.notifications.ClaimDue(ctx, d.now(), d.settings.Lease)
+		if err == nil {
+			d.deliver(ctx, notification)
+			continue
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+			d.logger.WithField("event", "notify_claim_failed").WithError(err).Error("failed to claim merchant notification")
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(d.settings.PollInterval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+type payload struct {
+	Event       string `json:"event"`
+	OrderID     string `json:"order_id"`
+	MerchantID  string `json:"merchant_id"`
+	Status      string `json:"status"`
+	AmountMinor int64  `json:"amount_minor"`
+	Currency    string `json:"currency"`
+	Channel     string `json:"channel"`
+	ChannelRef  string `json:"channel_ref,omitempty"`
+	Attempt     int    `json:"attempt"`
+	SentAt      string `json:"sent_at"`
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, n domain.Notification) {
+	attempt := domain.NotificationAttempt{
+		Attempt: n.AttemptCount + 1,
+		At:      d.now().Truncate(time.Millisecond),
+	}
+
+	started := time.Now()
+	httpStatus, err := d.send(ctx, n, attempt.Attempt)
+	attempt.LatencyMs = time.Since(started).Milliseconds()
+	attempt.HTTPStatus = httpStatus
+
+	if ctx.Err() != nil {
+		// Shutting down: leave the lease to expire so the next run retries.
+		return
+	}
+
+	fields := logging.Fields{
+		"notification_id": n.NotificationID,
+		"order_id":        n.OrderID,
+		"merchant_id":     n.MerchantID,
+		"notify":          n.Event,
+		"attempt":         attempt.Attempt,
+		"latency_ms":      attempt.LatencyMs,
+	}
+	if httpStatus != 0 {
+		fields["http_status"] = httpStatus
+	}
+
+	status := domain.NotificationStatusDelivered
+	next := attempt.At
+	switch {
+	case err == nil:
+		fields["event"] = "notify_delivered"
+		d.logger.WithFields(fields).Info("delivered merchant notification")
+	case attempt.Attempt >= d.settings.MaxAttempts:
+		attempt.Error = err.Error()
+		status = domain.NotificationStatusFailed
+		fields["event"] = "notify_gave_up"
+		d.logger.WithFields(fields).WithError(err).Error("merchant notification failed permanently")
+	default:
+		attempt.Error = err.Error()
+		status = domain.NotificationStatusPending
+		next = attempt.At.Add(d.backoff(attempt.Attempt))
+		fields["event"] = "notify_attempt_failed"
+		fields["next_attempt_at"] = next.Format(time.RFC3339)
+		d.logger.WithFields(fields).WithError(err).Warn("merchant notification attempt failed")
+	}
+
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
+	err = d.notifications.RecordAttempt(recordCtx, n.NotificationID, n.LockedUntil, attempt, status, next)
+	switch {
+	case errors.Is(err, domain.ErrNotificationLeaseLost):
+		// The lease expired mid-delivery and another worker owns the entry now;
+		// its outcome is the one that counts.
+		fields["event"] = "notify_lease_lost"
+		d.logger.WithFields(fields).Warn("merchant notification lease lost before recording attempt")
+	case err != nil:
+		fields["event"] = "notify_record_failed"
+		d.logger.WithFields(fields).WithError(err).Error("failed to record merchant notification attempt")
+	}
+}
+
+// send posts the signed payload and returns the HTTP status when a response
+// was received.
+func (d *Dispatcher) send(ctx context.Context, n domain.Notification, attempt int) (int, error) {
+	// The payload reports the status the event announced; the order may have
+	// moved on (paid, then refunded) before this notification is delivered.
+	status := domain.NotificationStatusForEvent(n.Event)
+	if status == "" {
+		return 0, fmt.Errorf("unknown notification event %q", n.Event)
+	}
+	order, err := d.orders.GetByID(ctx, n.OrderID)
+	if err != nil {
+		return 0, fmt.Errorf("load order: %w", err)
+	}
+	merchant, err := d.merchants.GetByID(ctx, n.MerchantID)
+	if err != nil {
+		return 0, fmt.Errorf("load merchant: %w", err)
+	}
+	if merchant.NotifyURL == "" {
+		return 0, errors.New("merchant has no notify_url")
+	}
+
+	body, err := json.Marshal(payload{
+		Event:       n.Event,
+		OrderID:     order.OrderID,
+		MerchantID:  order.MerchantID,
+		Status:      status,
+		AmountMinor: order.AmountMinor,
+		Currency:    order.Currency,
+		Channel:     order.Channel,
+		ChannelRef:  order.ChannelRef,
+		Attempt:     attempt,
+		SentAt:      d.now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("encode payload: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, d.settings.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, merchant.NotifyURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, n.Event)
+	req.Header.Set(SignatureHeader, Sign(merchant.NotifySecret, body))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("merchant responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.settings.BaseBackoff
+	for i := 1; i < attempt && delay < d.settings.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.settings.MaxBackoff {
+		delay = d.settings.MaxBackoff
+	}
+
+	return delay
+}
+
+// Sign returns the lowercase hex HMAC-SHA256 of body keyed by the merchant's
+// notify secret. Merchants verify the SignatureHeader value against it.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
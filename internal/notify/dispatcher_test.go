@@ -0,0 +1,485 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const testSecret = "merchant-secret"
+
+func TestDispatcherDeliversSignedNotification(t *testing.T) {
+	received := make(chan payload, 1)
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(SignatureHeader); got != Sign(testSecret, body) {
+			t.Errorf("unexpected signature %q", got)
+		}
+		if got := r.Header.Get(EventHeader); got != domain.NotificationEventOrderPaid {
+			t.Errorf("unexpected event header %q", got)
+		}
+		var p payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		received <- p
+	}))
+	defer merchant.Close()
+
+	env := newTestEnv(merchant.URL)
+	dispatcher := env.dispatcher(Settings{PollInterval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Start(ctx)
+		close(done)
+	}()
+
+	dispatcher.OrderTransitioned(ctx, env.order, domain.OrderStatusPending)
+
+	select {
+	case p := <-received:
+		if p.OrderID != env.order.OrderID || p.Status != domain.OrderStatusPaid || p.AmountMinor != 1500 || p.Attempt != 1 {
+			t.Fatalf("unexpected payload %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for merchant notification")
+	}
+
+	waitFor(t, func() bool {
+		n := env.store.get(domain.NotificationID(env.order.OrderID, domain.NotificationEventOrderPaid))
+		return n.Status == domain.NotificationStatusDelivered
+	})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("dispatcher did not stop after cancellation")
+	}
+
+	n := env.store.get(domain.NotificationID(env.order.OrderID, domain.NotificationEventOrderPaid))
+	if len(n.Attempts) != 1 || n.Attempts[0].HTTPStatus != http.StatusOK {
+		t.Fatalf("expected one recorded 200 attempt, got %+v", n.Attempts)
+	}
+}
+
+func TestDispatcherDropsAttemptAfterLeaseExpires(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int
+	var callsMu sync.Mutex
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		callsMu.Lock()
+		calls++
+		first := calls == 1
+		callsMu.Unlock()
+		if first {
+			// The first worker stalls past its lease and then fails.
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer merchant.Close()
+
+	env := newTestEnv(merchant.URL)
+	var clockMu sync.Mutex
+	now := env.now
+	clock := func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	dispatcher := NewDispatcher(env.store, env.orders, env.merchants, logrus.NewEntry(logrus.New()),
+		WithSettings(Settings{Workers: 2, Lease: time.Minute, PollInterval: 5 * time.Millisecond}),
+		WithClock(clock),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Start(ctx)
+		close(done)
+	}()
+
+	id := domain.NotificationID(env.order.OrderID, domain.NotificationEventOrderPaid)
+	dispatcher.OrderTransitioned(ctx, env.order, domain.OrderStatusPending)
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for the first delivery")
+	}
+
+	// Expire the first lease so the second worker claims and delivers it.
+	clockMu.Lock()
+	now = now.Add(2 * time.Minute)
+	clockMu.Unlock()
+	waitFor(t, func() bool { return env.store.get(id).Status == domain.NotificationStatusDelivered })
+
+	close(release)
+	waitFor(t, func() bool {
+		env.store.mu.Lock()
+		defer env.store.mu.Unlock()
+		return env.store.leaseLost == 1
+	})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("dispatcher did not stop after cancellation")
+	}
+
+	n := env.store.get(id)
+	if n.Status != domain.NotificationStatusDelivered || n.AttemptCount != 1 {
+		t.Fatalf("expected the second worker's delivery to stand, got %+v", n)
+	}
+	if len(n.Attempts) != 1 || n.Attempts[0].HTTPStatus != http.StatusOK {
+		t.Fatalf("expected only the delivered attempt to be recorded, got %+v", n.Attempts)
+	}
+}
+
+func TestOrderTransitionedFailsTransitionWhenEnqueueFails(t *testing.T) {
+	env := newTestEnv("http://127.0.0.1:0")
+	dispatcher := env.dispatcher(Settings{})
+	ctx := context.Background()
+
+	env.store.enqueueErr = errors.New("mongo down")
+	if err := dispatcher.OrderTransitioned(ctx, env.order, domain.OrderStatusPending); !errors.Is(err, env.store.enqueueErr) {
+		t.Fatalf("expected enqueue failure to be returned, got %v", err)
+	}
+
+	env.store.enqueueErr = nil
+	pending := env.order
+	pending.Status = domain.OrderStatusPending
+	if err := dispatcher.OrderTransitioned(ctx, pending, domain.OrderStatusCreated); err != nil {
+		t.Fatalf("expected unnotified status to be ignored, got %v", err)
+	}
+	if err := dispatcher.OrderTransitioned(ctx, env.order, domain.OrderStatusPending); err != nil {
+		t.Fatalf("OrderTransitioned returned error: %v", err)
+	}
+	if n := env.store.get(domain.NotificationID(env.order.OrderID, domain.NotificationEventOrderPaid)); n.Status != domain.NotificationStatusPending {
+		t.Fatalf("expected pending notification, got %+v", n)
+	}
+}
+
+func TestDispatcherBacksOffAndGivesUp(t *testing.T) {
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer merchant.Close()
+
+	env := newTestEnv(merchant.URL)
+	dispatcher := env.dispatcher(Settings{MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: 90 * time.Second})
+	ctx := context.Background()
+
+	if _, err := env.store.Enqueue(ctx, env.order, domain.NotificationEventOrderPaid); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	id := domain.NotificationID(env.order.OrderID, domain.NotificationEventOrderPaid)
+
+	wantDelays := []time.Duration{time.Minute, 90 * time.Second}
+	for i, delay := range wantDelays {
+		dispatcher.deliver(ctx, env.store.get(id))
+		n := env.store.get(id)
+		if n.Status != domain.NotificationStatusPending || n.AttemptCount != i+1 {
+			t.Fatalf("attempt %d: expected pending retry, got %+v", i+1, n)
+		}
+		if got := n.NextAttemptAt.Sub(env.now); got != delay {
+			t.Fatalf("attempt %d: expected backoff %v, got %v", i+1, delay, got)
+		}
+		if last := n.Attempts[len(n.Attempts)-1]; last.HTTPStatus != http.StatusBadGateway || last.Error == "" {
+			t.Fatalf("attempt %d: expected recorded 502, got %+v", i+1, last)
+		}
+	}
+
+	dispatcher.deliver(ctx, env.store.get(id))
+	if n := env.store.get(id); n.Status != domain.NotificationStatusFailed || n.AttemptCount != 3 {
+		t.Fatalf("expected notification to fail after max attempts, got %+v", n)
+	}
+}
+
+func TestDispatcherReportsEventStatusAfterRefund(t *testing.T) {
+	received := make(chan payload, 2)
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		received <- p
+	}))
+	defer merchant.Close()
+
+	env := newTestEnv(merchant.URL)
+	dispatcher := env.dispatcher(Settings{})
+	ctx := context.Background()
+
+	refunded := env.order
+	refunded.Status = domain.OrderStatusRefunded
+	env.orders[refunded.OrderID] = refunded
+	for _, event := range []string{domain.NotificationEventOrderPaid, domain.NotificationEventOrderRefunded} {
+		if _, err := env.store.Enqueue(ctx, refunded, event); err != nil {
+			t.Fatalf("Enqueue returned error: %v", err)
+		}
+		dispatcher.deliver(ctx, env.store.get(domain.NotificationID(refunded.OrderID, event)))
+	}
+
+	if paid, refund := <-received, <-received; paid.Status != domain.OrderStatusPaid || refund.Status != domain.OrderStatusRefunded {
+		t.Fatalf("expected each payload to report its event's status, got %q and %q", paid.Status, refund.Status)
+	}
+}
+
+func TestDispatcherRecordsMissingNotifyURL(t *testing.T) {
+	env := newTestEnv("")
+	dispatcher := env.dispatcher(Settings{})
+	ctx := context.Background()
+
+	if _, err := env.store.Enqueue(ctx, env.order, domain.NotificationEventOrderPaid); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	id := domain.NotificationID(env.order.OrderID, domain.NotificationEventOrderPaid)
+
+	dispatcher.deliver(ctx, env.store.get(id))
+	n := env.store.get(id)
+	if n.Status != domain.NotificationStatusPending || len(n.Attempts) != 1 || !strings.Contains(n.Attempts[0].Error, "notify_url") {
+		t.Fatalf("expected failed attempt mentioning notify_url, got %+v", n)
+	}
+}
+
+func TestRetryCommand(t *testing.T) {
+	env := newTestEnv("https://shop.example/hook")
+	dispatcher := env.dispatcher(Settings{})
+	ctx := context.Background()
+
+	commands := dispatcher.Commands()
+	if len(commands) != 1 || commands[0].Name != "notify_retry" || commands[0].MinRole != domain.RoleAdmin {
+		t.Fatalf("expected admin notify_retry command, got %+v", commands)
+	}
+
+	reply, err := dispatcher.retry(ctx, telegram.CommandRequest{Args: []string{env.order.OrderID}})
+	if err != nil || reply != "Queued 1 notification(s) for order ord_notify1." {
+		t.Fatalf("expected missing notification to be enqueued, got %q err=%v", reply, err)
+	}
+	id := domain.NotificationID(env.order.OrderID, domain.NotificationEventOrderPaid)
+	if env.store.get(id).Status != domain.NotificationStatusPending {
+		t.Fatalf("expected pending notification after retry")
+	}
+
+	env.store.update(id, func(n *domain.Notification) {
+		n.Status = domain.NotificationStatusFailed
+		n.AttemptCount = 8
+	})
+	if reply, _ := dispatcher.retry(ctx, telegram.CommandRequest{Args: []string{env.order.OrderID}}); reply != "Queued 1 notification(s) for order ord_notify1." {
+		t.Fatalf("unexpected requeue reply %q", reply)
+	}
+	if n := env.store.get(id); n.Status != domain.NotificationStatusPending || n.AttemptCount != 0 {
+		t.Fatalf("expected requeue to reset the attempt budget, got %+v", n)
+	}
+
+	env.store.update(id, func(n *domain.Notification) { n.Status = domain.NotificationStatusDelivered })
+	if reply, _ := dispatcher.retry(ctx, telegram.CommandRequest{Args: []string{env.order.OrderID}}); !strings.Contains(reply, "no merchant notifications") {
+		t.Fatalf("expected delivered notification not to be sent again, got %q", reply)
+	}
+	if n := env.store.get(id); n.Status != domain.NotificationStatusDelivered {
+		t.Fatalf("expected delivered notification to stay delivered, got %+v", n)
+	}
+
+	pending := env.order
+	pending.Status = domain.OrderStatusPending
+	env.orders[pending.OrderID] = pending
+	env.store.clear()
+	if reply, _ := dispatcher.retry(ctx, telegram.CommandRequest{Args: []string{env.order.OrderID}}); !strings.Contains(reply, "no merchant notifications") {
+		t.Fatalf("expected unpaid order to have nothing to send, got %q", reply)
+	}
+	if reply, _ := dispatcher.retry(ctx, telegram.CommandRequest{Args: []string{"ord_missing"}}); reply != "Order ord_missing not found." {
+		t.Fatalf("unexpected reply for unknown order: %q", reply)
+	}
+	if reply, _ := dispatcher.retry(ctx, telegram.CommandRequest{}); reply != retryUsage {
+		t.Fatalf("expected usage without args, got %q", reply)
+	}
+}
+
+type testEnv struct {
+	order     domain.Order
+	orders    fakeOrders
+	merchants fakeMerchants
+	store     *fakeNotifications
+	now       time.Time
+}
+
+func newTestEnv(notifyURL string) *testEnv {
+	order := domain.Order{
+		OrderID:     "ord_notify1",
+		MerchantID:  "shop",
+		AmountMinor: 1500,
+		Currency:    "USD",
+		Channel:     "mock",
+		Status:      domain.OrderStatusPaid,
+	}
+
+	return &testEnv{
+		order:     order,
+		orders:    fakeOrders{order.OrderID: order},
+		merchants: fakeMerchants{"shop": {MerchantID: "shop", NotifyURL: notifyURL, NotifySecret: testSecret}},
+		store:     newFakeNotifications(),
+		now:       time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+	}
+}
+
+func (e *testEnv) dispatcher(settings Settings) *Dispatcher {
+	return NewDispatcher(e.store, e.orders, e.merchants, logrus.NewEntry(logrus.New()),
+		WithSettings(settings),
+		WithClock(func() time.Time { return e.now }),
+	)
+}
+
+type fakeOrders map[string]domain.Order
+
+func (f fakeOrders) GetByID(_ context.Context, orderID string) (domain.Order, error) {
+	order, ok := f[orderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	return order, nil
+}
+
+type fakeMerchants map[string]domain.Merchant
+
+func (f fakeMerchants) GetByID(_ context.Context, merchantID string) (domain.Merchant, error) {
+	merchant, ok := f[merchantID]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	return merchant, nil
+}
+
+type fakeNotifications struct {
+	mu         sync.Mutex
+	docs       map[string]*domain.Notification
+	enqueueErr error
+	leaseLost  int
+}
+
+func newFakeNotifications() *fakeNotifications {
+	return &fakeNotifications{docs: make(map[string]*domain.Notification)}
+}
+
+func (f *fakeNotifications) Enqueue(_ context.Context, order domain.Order, event string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.enqueueErr != nil {
+		return false, f.enqueueErr
+	}
+	id := domain.NotificationID(order.OrderID, event)
+	if _, ok := f.docs[id]; ok {
+		return false, nil
+	}
+	f.docs[id] = &domain.Notification{
+		NotificationID: id,
+		OrderID:        order.OrderID,
+		MerchantID:     order.MerchantID,
+		Event:          event,
+		Status:         domain.NotificationStatusPending,
+	}
+	return true, nil
+}
+
+func (f *fakeNotifications) ClaimDue(_ context.Context, now time.Time, lease time.Duration) (domain.Notification, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, n := range f.docs {
+		if n.Status == domain.NotificationStatusPending && !n.NextAttemptAt.After(now) && !n.LockedUntil.After(now) {
+			n.LockedUntil = now.Add(lease)
+			return *n, nil
+		}
+	}
+	return domain.Notification{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeNotifications) RecordAttempt(_ context.Context, notificationID string, lockedUntil time.Time, attempt domain.NotificationAttempt, status string, nextAttemptAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := f.docs[notificationID]
+	if n == nil || n.Status != domain.NotificationStatusPending || !n.LockedUntil.Equal(lockedUntil) {
+		f.leaseLost++
+		return domain.ErrNotificationLeaseLost
+	}
+	n.Status = status
+	n.AttemptCount = attempt.Attempt
+	n.NextAttemptAt = nextAttemptAt
+	n.LockedUntil = time.Time{}
+	n.Attempts = append(n.Attempts, attempt)
+	return nil
+}
+
+func (f *fakeNotifications) Requeue(_ context.Context, orderID string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matched int64
+	for _, n := range f.docs {
+		if n.OrderID == orderID && n.Status != domain.NotificationStatusDelivered {
+			n.Status = domain.NotificationStatusPending
+			n.AttemptCount = 0
+			n.NextAttemptAt = time.Time{}
+			n.LockedUntil = time.Time{}
+			matched++
+		}
+	}
+	return matched, nil
+}
+
+func (f *fakeNotifications) get(id string) domain.Notification {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if n, ok := f.docs[id]; ok {
+		return *n
+	}
+	return domain.Notification{}
+}
+
+func (f *fakeNotifications) update(id string, fn func(*domain.Notification)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fn(f.docs[id])
+}
+
+func (f *fakeNotifications) clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.docs = make(map[string]*domain.Notification)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
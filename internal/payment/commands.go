@@ -0,0 +1,371 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+const (
+	payUsage           = "Usage: /pay <amount_minor> <currency> [description]"
+	refundUsage        = "Usage: /refund <order_id>"
+	paymentStatusUsage = "Usage: /payment_status <order_id>"
+	channelToggleUsage = "Usage: /channel_toggle <code>"
+)
+
+var payCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Commands returns the payment channel commands for registration with the
+// Telegram client.
+func (s *Service) Commands() []telegram.Command {
+	return []telegram.Command{
+		{
+			// The group binding scopes access: payments are always created
+			// for the merchant the group is bound to.
+			Name:        "pay",
+			Description: "Create a payment link through a routed payment channel",
+			ChatTypes:   []string{telegram.ChatTypeGroup},
+			Handler:     telegram.ReplyHandler(s.logger, s.payCommand),
+		},
+		{
+			Name:        "refund",
+			Description: "Refund a channel payment",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.refundCommand),
+		},
+		{
+			Name:        "payment_status",
+			Description: "Ask the payment channel for an order's status",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.paymentStatusCommand),
+		},
+		{
+			Name:        "channels",
+			Description: "Show payment channel health and routing limits",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.channelsCommand),
+		},
+		{
+			Name:        "channel_toggle",
+			Description: "Enable or disable a payment channel for routing",
+			MinRole:     domain.RoleAdmin,
+			Handler:     telegram.ReplyHandler(s.logger, s.channelToggleCommand),
+		},
+	}
+}
+
+func (s *Service) payCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	if len(req.Args) < 2 {
+		return payUsage, nil
+	}
+
+	amount, err := strconv.ParseInt(req.Args[0], 10, 64)
+	if err != nil || amount <= 0 {
+		return fmt.Sprintf("Invalid amount %q: use a positive integer in minor units.", req.Args[0]), nil
+	}
+	currency := strings.ToUpper(req.Args[1])
+	if !payCurrency.MatchString(currency) || currency == domain.CurrencyStars {
+		return fmt.Sprintf("Invalid currency %q: use a 3-letter ISO 4217 code.", req.Args[1]), nil
+	}
+
+	merchant, err := s.merchants.GetByGroupChatID(ctx, req.ChatID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "This group is not bound to a merchant.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if merchant.Status != domain.MerchantStatusActive {
+		return fmt.Sprintf("Merchant %s is %s and cannot take payments.", merchant.MerchantID, merchant.Status), nil
+	}
+
+	created, payment, err := s.CreatePayment(ctx, Order{
+		MerchantID:  merchant.MerchantID,
+		AmountMinor: amount,
+		Currency:    currency,
+		Description: strings.Join(req.Args[2:], " "),
+	})
+	if errors.Is(err, ErrNoRoute) {
+		return fmt.Sprintf("No payment channel can take %s %s right now.", domain.FormatAmount(amount, currency), currency), nil
+	}
+	if errors.Is(err, ErrPaymentUnconfirmed) {
+		return fmt.Sprintf("Channel %s did not confirm the payment for order %s. Check it with /payment_status %s before trying again.", created.Channel, created.OrderID, created.OrderID), nil
+	}
+	if errors.Is(err, ErrDeclined) {
+		return fmt.Sprintf("Payment channels declined the payment (last order_id: %s):\n%v", created.OrderID, err), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "channel_payment_requested",
+		"order_id":    created.OrderID,
+		"merchant_id": merchant.MerchantID,
+		"channel":     created.Channel,
+		"user_id":     req.UserID,
+		"chat_id":     req.ChatID,
+	}).Info("created payment link")
+
+	lines := []string{
+		fmt.Sprintf("Payment of %s %s created on %s (order_id: %s).", domain.FormatAmount(amount, currency), currency, created.Channel, created.OrderID),
+	}
+	if payment.PayURL != "" {
+		lines = append(lines, "Pay here: "+payment.PayURL)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Service) refundCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	if len(req.Args) != 1 {
+		return refundUsage, nil
+	}
+
+	found, err := s.orders.GetByID(ctx, req.Args[0])
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Sprintf("Order %s not found.", req.Args[0]), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	entry := audit.Entry{
+		ActorID:   req.UserID,
+		ActorRole: req.Role,
+		ChatID:    req.ChatID,
+		Action:    audit.ActionChannelRefund,
+		Target:    audit.OrderTarget(found.OrderID),
+		Before:    found.Status,
+		After:     domain.OrderStatusRefunded,
+	}
+
+	refund, err := s.Refund(ctx, found)
+	var denied *RefundDeniedError
+	switch {
+	case errors.As(err, &denied):
+		entry.Outcome, entry.Reason = audit.OutcomeDenied, denied.Reason
+		s.record(ctx, entry)
+		return denied.Message, nil
+	case errors.Is(err, ErrDeclined):
+		entry.Outcome, entry.Reason = audit.OutcomeFailed, err.Error()
+		s.record(ctx, entry)
+		return fmt.Sprintf("Channel %s refused the refund for order %s: %v", found.Channel, found.OrderID, err), nil
+	case err != nil:
+		entry.Outcome, entry.Reason = audit.OutcomeFailed, err.Error()
+		s.record(ctx, entry)
+		return "", err
+	}
+
+	entry.Outcome = audit.OutcomeSuccess
+	s.record(ctx, entry)
+
+	return fmt.Sprintf("Refunded %s %s for order %s through %s (refund_ref: %s).",
+		domain.FormatAmount(found.AmountMinor, found.Currency), found.Currency, found.OrderID, found.Channel, refund.RefundRef), nil
+}
+
+func (s *Service) paymentStatusCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	if len(req.Args) != 1 {
+		return paymentStatusUsage, nil
+	}
+
+	found, err := s.orders.GetByID(ctx, req.Args[0])
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Sprintf("Order %s not found.", req.Args[0]), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if found.Adapter == "" {
+		return fmt.Sprintf("Order %s was not created through a payment channel.", found.OrderID), nil
+	}
+
+	status, err := s.QueryStatus(ctx, found)
+	if errors.Is(err, ErrUnknownChannel) {
+		return fmt.Sprintf("Channel %s is no longer configured.", found.Channel), nil
+	}
+	if errors.Is(err, ErrDeclined) {
+		return fmt.Sprintf("Channel %s could not report order %s: %v", found.Channel, found.OrderID, err), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		fmt.Sprintf("order_id: %s", found.OrderID),
+		fmt.Sprintf("channel: %s (%s, credential_set: %s)", found.Channel, found.Adapter, found.CredentialSet),
+		fmt.Sprintf("order_status: %s", found.Status),
+		fmt.Sprintf("channel_status: %s", status.Status),
+		fmt.Sprintf("channel_amount: %s %s", domain.FormatAmount(status.AmountMinor, found.Currency), found.Currency),
+	}
+	if status.ChannelRef != "" {
+		lines = append(lines, fmt.Sprintf("channel_ref: %s", status.ChannelRef))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Service) channelsCommand(ctx context.Context, _ telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+
+	health, err := s.router.Health(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(health) == 0 {
+		return "No payment channels are configured.", nil
+	}
+
+	now := s.router.now()
+	lines := []string{fmt.Sprintf("Payment channels (success over the last %s):", s.router.policy.Window)}
+	for _, channel := range health {
+		lines = append(lines, "")
+		lines = append(lines, formatChannelHealth(channel, now)...)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Service) channelToggleCommand(ctx context.Context, req telegram.CommandRequest) (string, error) {
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	if len(req.Args) != 1 {
+		return s.withChannels(channelToggleUsage), nil
+	}
+
+	state, err := s.router.Toggle(ctx, req.Args[0], req.UserID)
+	if errors.Is(err, ErrUnknownChannel) {
+		return s.withChannels(fmt.Sprintf("Unknown channel %q.", req.Args[0])), nil
+	}
+	entry := audit.Entry{
+		ActorID:   req.UserID,
+		ActorRole: req.Role,
+		ChatID:    req.ChatID,
+		Action:    audit.ActionChannelToggle,
+		Target:    audit.ChannelTarget(domain.NormalizeChannelCode(req.Args[0])),
+	}
+	if err != nil {
+		entry.Outcome, entry.Reason = audit.OutcomeFailed, err.Error()
+		s.record(ctx, entry)
+		return "", err
+	}
+
+	entry.Before, entry.After = channelEnabledLabel(!state.Disabled), channelEnabledLabel(state.Disabled)
+	entry.Outcome = audit.OutcomeSuccess
+	s.record(ctx, entry)
+
+	if state.Disabled {
+		return fmt.Sprintf("Channel %s disabled; new payments are routed to the other channels.", state.Code), nil
+	}
+
+	return fmt.Sprintf("Channel %s enabled and its circuit breaker reset.", state.Code), nil
+}
+
+// formatChannelHealth renders one channel for /channels.
+func formatChannelHealth(channel ChannelHealth, now time.Time) []string {
+	lines := []string{
+		fmt.Sprintf("%s (%s, credential_set: %s), weight %d", channel.Code, channel.Adapter, channel.CredentialSet, channel.Weight),
+	}
+
+	switch {
+	case channel.State.Disabled:
+		status := "status: disabled"
+		if channel.State.ToggledAt != nil {
+			status += fmt.Sprintf(" by %d at %s", channel.State.ToggledBy, channel.State.ToggledAt.UTC().Format(time.RFC3339))
+		}
+		lines = append(lines, status)
+	case channel.State.BreakerOpen(now):
+		lines = append(lines, fmt.Sprintf("status: circuit open until %s (%s)", channel.State.BreakerOpenUntil.UTC().Format(time.RFC3339), channel.State.BreakerReason))
+	default:
+		lines = append(lines, "status: healthy")
+	}
+
+	if total := channel.Outcomes.Total(); total > 0 {
+		lines = append(lines, fmt.Sprintf("success: %d/%d (%d%%)", channel.Outcomes.Successes, total, 100-channel.Outcomes.FailurePercent()))
+	} else {
+		lines = append(lines, "success: no recent payments")
+	}
+
+	if len(channel.Volume) == 0 {
+		lines = append(lines, "today: no volume")
+	}
+	for _, volume := range channel.Volume {
+		line := fmt.Sprintf("today: %s %s", domain.FormatAmount(volume.AmountMinor, volume.Currency), volume.Currency)
+		if channel.DailyCap > 0 {
+			line += fmt.Sprintf(" of %s cap", domain.FormatAmount(channel.DailyCap, volume.Currency))
+		}
+		lines = append(lines, line)
+	}
+
+	if limits := formatChannelLimits(channel.Entry); limits != "" {
+		lines = append(lines, limits)
+	}
+
+	return lines
+}
+
+// formatChannelLimits describes the configured amount limits in minor units,
+// or returns empty when the channel has none.
+func formatChannelLimits(entry Entry) string {
+	var limits []string
+	if entry.MinAmount > 0 {
+		limits = append(limits, fmt.Sprintf("min %d", entry.MinAmount))
+	}
+	if entry.MaxAmount > 0 {
+		limits = append(limits, fmt.Sprintf("max %d", entry.MaxAmount))
+	}
+	if entry.DailyCap > 0 {
+		limits = append(limits, fmt.Sprintf("daily cap %d", entry.DailyCap))
+	}
+	if len(limits) == 0 {
+		return ""
+	}
+
+	return "limits (minor units): " + strings.Join(limits, ", ")
+}
+
+func channelEnabledLabel(disabled bool) string {
+	if disabled {
+		return "disabled"
+	}
+
+	return "enabled"
+}
+
+// withChannels appends the configured channel codes to a reply.
+func (s *Service) withChannels(reply string) string {
+	entries := s.channels.Entries()
+	if len(entries) == 0 {
+		return reply + "\nNo payment channels are configured."
+	}
+
+	codes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		codes = append(codes, entry.Code)
+	}
+
+	return reply + "\nChannels: " + strings.Join(codes, ", ")
+}
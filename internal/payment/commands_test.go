@@ -0,0 +1,264 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/telegram"
+)
+
+func TestCommandsScopes(t *testing.T) {
+	service := newTestService(newFakeOrders(), &Registry{}, newFakeRouting(), nil, "")
+
+	commands := service.Commands()
+	if len(commands) != 5 {
+		t.Fatalf("expected 5 commands, got %+v", commands)
+	}
+	if commands[0].Name != "pay" || len(commands[0].ChatTypes) != 1 || commands[0].ChatTypes[0] != telegram.ChatTypeGroup {
+		t.Fatalf("expected group-only /pay, got %+v", commands[0])
+	}
+	if commands[1].Name != "refund" || commands[1].MinRole != domain.RoleAdmin {
+		t.Fatalf("expected admin /refund, got %+v", commands[1])
+	}
+	if commands[2].Name != "payment_status" || commands[2].MinRole != domain.RoleAdmin {
+		t.Fatalf("expected admin /payment_status, got %+v", commands[2])
+	}
+	for _, command := range commands[3:] {
+		if command.MinRole != domain.RoleAdmin {
+			t.Fatalf("expected admin /%s, got %+v", command.Name, command)
+		}
+	}
+}
+
+func TestPayCommand(t *testing.T) {
+	orders := newFakeOrders()
+	channel := &fakeChannel{payment: Payment{ChannelRef: "mock_1", PayURL: "http://stub/pay/mock_1"}}
+	routing := newFakeRouting()
+	service := newTestService(orders, testRegistry(t, channel), routing, nil, "")
+	ctx := context.Background()
+
+	reply, err := service.payCommand(ctx, groupRequest("1250", "usd", "Two", "coffees"))
+	want := "Payment of 12.50 USD created on mock (order_id: ord_test0).\nPay here: http://stub/pay/mock_1"
+	if err != nil || reply != want {
+		t.Fatalf("unexpected pay reply %q err=%v", reply, err)
+	}
+	if channel.created[0].Description != "Two coffees" {
+		t.Fatalf("expected description to reach the channel, got %+v", channel.created[0])
+	}
+
+	for _, tc := range []struct {
+		req  telegram.CommandRequest
+		want string
+	}{
+		{groupRequest("1250"), payUsage},
+		{groupRequest("12.50", "USD"), "Invalid amount"},
+		{groupRequest("50", "XTR"), "Invalid currency"},
+		{telegram.CommandRequest{ChatID: -200, Args: []string{"1250", "USD"}}, "This group is not bound to a merchant."},
+		{telegram.CommandRequest{ChatID: -300, Args: []string{"1250", "USD"}}, "Merchant paused is suspended"},
+	} {
+		reply, err := service.payCommand(ctx, tc.req)
+		if err != nil || !strings.HasPrefix(reply, tc.want) {
+			t.Fatalf("pay(%v): expected reply starting with %q, got %q err=%v", tc.req.Args, tc.want, reply, err)
+		}
+	}
+	if len(orders.items) != 1 {
+		t.Fatalf("expected rejected requests not to create orders, got %d", len(orders.items))
+	}
+
+	channel.err = fmt.Errorf("%w: amount above limit", ErrDeclined)
+	reply, err = service.payCommand(ctx, groupRequest("999999", "USD"))
+	if err != nil || !strings.Contains(reply, "declined") || !strings.Contains(reply, "amount above limit") {
+		t.Fatalf("expected declined reply, got %q err=%v", reply, err)
+	}
+
+	channel.err, channel.queryErr = errors.New("i/o timeout"), errors.New("i/o timeout")
+	reply, err = service.payCommand(ctx, groupRequest("1250", "USD"))
+	if err != nil || !strings.HasPrefix(reply, "Channel mock did not confirm the payment") || !strings.Contains(reply, "/payment_status") {
+		t.Fatalf("expected unconfirmed reply, got %q err=%v", reply, err)
+	}
+
+	routing.states["mock"] = ChannelState{Code: "mock", Disabled: true}
+	reply, err = service.payCommand(ctx, groupRequest("1250", "USD"))
+	if err != nil || reply != "No payment channel can take 12.50 USD right now." {
+		t.Fatalf("expected no route reply, got %q err=%v", reply, err)
+	}
+}
+
+func TestRefundCommand(t *testing.T) {
+	orders := newFakeOrders()
+	orders.items["ord_paid"] = domain.Order{OrderID: "ord_paid", AmountMinor: 1250, Currency: "USD", Channel: "mock", Adapter: "fake", CredentialSet: "2026-10", ChannelRef: "mock_1", Status: domain.OrderStatusPaid}
+	orders.items["ord_invoice"] = domain.Order{OrderID: "ord_invoice", AmountMinor: 1250, Currency: "USD", Channel: "telegram", Status: domain.OrderStatusPaid}
+	channel := &fakeChannel{refund: Refund{RefundRef: "rf_mock_1"}}
+	auditor := &recordingAuditor{}
+	service := newTestService(orders, testRegistry(t, channel), newFakeRouting(), auditor, "")
+	ctx := context.Background()
+	admin := func(args ...string) telegram.CommandRequest {
+		return telegram.CommandRequest{UserID: 5, Role: domain.RoleAdmin, Args: args}
+	}
+
+	reply, err := service.refundCommand(ctx, admin("ord_paid"))
+	if err != nil || reply != "Refunded 12.50 USD for order ord_paid through mock (refund_ref: rf_mock_1)." {
+		t.Fatalf("unexpected refund reply %q err=%v", reply, err)
+	}
+
+	for _, tc := range []struct {
+		req  telegram.CommandRequest
+		want string
+	}{
+		{admin(), refundUsage},
+		{admin("ord_missing"), "Order ord_missing not found."},
+		{admin("ord_invoice"), "Order ord_invoice was not paid through a payment channel."},
+		{admin("ord_paid"), "Order ord_paid is refunded"},
+	} {
+		reply, err := service.refundCommand(ctx, tc.req)
+		if err != nil || !strings.HasPrefix(reply, tc.want) {
+			t.Fatalf("refund(%v): expected reply starting with %q, got %q err=%v", tc.req.Args, tc.want, reply, err)
+		}
+	}
+	if len(channel.refunds) != 1 {
+		t.Fatalf("expected refused refunds not to reach the channel, got %+v", channel.refunds)
+	}
+
+	if len(auditor.entries) != 3 {
+		t.Fatalf("expected success and two denials to be audited, got %+v", auditor.entries)
+	}
+	if got := auditor.entries[0]; got.Action != audit.ActionChannelRefund || got.Outcome != audit.OutcomeSuccess || got.Target != "order:ord_paid" || got.ActorID != 5 {
+		t.Fatalf("unexpected success entry %+v", got)
+	}
+	if auditor.entries[1].Reason != "no_adapter" || auditor.entries[2].Reason != "not_paid" {
+		t.Fatalf("unexpected denial reasons %+v", auditor.entries[1:])
+	}
+}
+
+func TestPaymentStatusCommand(t *testing.T) {
+	orders := newFakeOrders()
+	orders.items["ord_pending"] = domain.Order{OrderID: "ord_pending", AmountMinor: 1250, Currency: "USD", Channel: "mock", Adapter: "fake", CredentialSet: "2026-10", ChannelRef: "mock_1", Status: domain.OrderStatusPending}
+	orders.items["ord_gone"] = domain.Order{OrderID: "ord_gone", AmountMinor: 1250, Currency: "USD", Channel: "retired", Adapter: "fake", Status: domain.OrderStatusPending}
+	channel := &fakeChannel{status: PaymentStatus{ChannelRef: "mock_1", Status: domain.OrderStatusPaid, AmountMinor: 1250}}
+	service := newTestService(orders, testRegistry(t, channel), newFakeRouting(), nil, "")
+	ctx := context.Background()
+
+	reply, err := service.paymentStatusCommand(ctx, telegram.CommandRequest{Args: []string{"ord_pending"}})
+	want := strings.Join([]string{
+		"order_id: ord_pending",
+		"channel: mock (fake, credential_set: 2026-10)",
+		"order_status: pending",
+		"channel_status: paid",
+		"channel_amount: 12.50 USD",
+		"channel_ref: mock_1",
+	}, "\n")
+	if err != nil || reply != want {
+		t.Fatalf("unexpected status reply:\n%s\nwant:\n%s\nerr=%v", reply, want, err)
+	}
+	if got := orders.items["ord_pending"].Status; got != domain.OrderStatusPending {
+		t.Fatalf("expected status query not to change the order, got %q", got)
+	}
+
+	reply, err = service.paymentStatusCommand(ctx, telegram.CommandRequest{Args: []string{"ord_gone"}})
+	if err != nil || reply != "Channel retired is no longer configured." {
+		t.Fatalf("expected removed channel reply, got %q err=%v", reply, err)
+	}
+}
+
+func TestChannelsCommand(t *testing.T) {
+	registry := &Registry{}
+	for _, entry := range []Entry{
+		{Code: "mock", Adapter: "fake", CredentialSet: "2026-10", Weight: 2, MinAmount: 100, DailyCap: 500000},
+		{Code: "spare", Adapter: "fake", Weight: 1},
+		{Code: "tripped", Adapter: "fake", Weight: 1},
+	} {
+		entry.Channel = &fakeChannel{}
+		if err := registry.Register(entry); err != nil {
+			t.Fatalf("register channel: %v", err)
+		}
+	}
+	routing := newFakeRouting()
+	service := newTestService(newFakeOrders(), registry, routing, nil, "")
+	toggledAt := time.Date(2026, 10, 16, 11, 0, 0, 0, time.UTC)
+	openUntil := time.Date(2026, 10, 16, 12, 5, 0, 0, time.UTC)
+	routing.states["spare"] = ChannelState{Code: "spare", Disabled: true, ToggledBy: 5, ToggledAt: &toggledAt}
+	routing.states["tripped"] = ChannelState{Code: "tripped", BreakerOpenUntil: &openUntil, BreakerReason: "80% of 10 payments failed"}
+	routing.outcomes["mock"] = Outcomes{Successes: 9, Failures: 1}
+	routing.volume["mock/USD"] = 12500
+
+	reply, err := service.channelsCommand(context.Background(), telegram.CommandRequest{})
+	want := strings.Join([]string{
+		"Payment channels (success over the last 15m0s):",
+		"",
+		"mock (fake, credential_set: 2026-10), weight 2",
+		"status: healthy",
+		"success: 9/10 (90%)",
+		"today: 125.00 USD of 5000.00 cap",
+		"limits (minor units): min 100, daily cap 500000",
+		"",
+		"spare (fake, credential_set: default), weight 1",
+		"status: disabled by 5 at 2026-10-16T11:00:00Z",
+		"success: no recent payments",
+		"today: no volume",
+		"",
+		"tripped (fake, credential_set: default), weight 1",
+		"status: circuit open until 2026-10-16T12:05:00Z (80% of 10 payments failed)",
+		"success: no recent payments",
+		"today: no volume",
+	}, "\n")
+	if err != nil || reply != want {
+		t.Fatalf("unexpected channels reply:\n%s\nwant:\n%s\nerr=%v", reply, want, err)
+	}
+}
+
+func TestChannelToggleCommand(t *testing.T) {
+	routing := newFakeRouting()
+	auditor := &recordingAuditor{}
+	service := newTestService(newFakeOrders(), testRegistry(t, &fakeChannel{}), routing, auditor, "")
+	ctx := context.Background()
+	admin := func(args ...string) telegram.CommandRequest {
+		return telegram.CommandRequest{UserID: 5, Role: domain.RoleAdmin, Args: args}
+	}
+
+	reply, err := service.channelToggleCommand(ctx, admin("mock"))
+	if err != nil || reply != "Channel mock disabled; new payments are routed to the other channels." || !routing.states["mock"].Disabled {
+		t.Fatalf("unexpected disable reply %q err=%v", reply, err)
+	}
+	reply, err = service.channelToggleCommand(ctx, admin("mock"))
+	if err != nil || reply != "Channel mock enabled and its circuit breaker reset." || routing.states["mock"].Disabled {
+		t.Fatalf("unexpected enable reply %q err=%v", reply, err)
+	}
+
+	for _, tc := range []struct {
+		req  telegram.CommandRequest
+		want string
+	}{
+		{admin(), channelToggleUsage + "\nChannels: mock"},
+		{admin("nope"), "Unknown channel \"nope\".\nChannels: mock"},
+	} {
+		reply, err := service.channelToggleCommand(ctx, tc.req)
+		if err != nil || reply != tc.want {
+			t.Fatalf("channel_toggle(%v): expected %q, got %q err=%v", tc.req.Args, tc.want, reply, err)
+		}
+	}
+
+	if len(auditor.entries) != 2 {
+		t.Fatalf("expected both toggles to be audited, got %+v", auditor.entries)
+	}
+	if got := auditor.entries[0]; got.Action != audit.ActionChannelToggle || got.Target != "channel:mock" || got.Before != "enabled" || got.After != "disabled" || got.Outcome != audit.OutcomeSuccess {
+		t.Fatalf("unexpected toggle entry %+v", got)
+	}
+}
+
+func groupRequest(args ...string) telegram.CommandRequest {
+	return telegram.CommandRequest{UserID: 7, ChatID: -100, ChatType: telegram.ChatTypeGroup, Args: args}
+}
+
+type recordingAuditor struct {
+	entries []audit.Entry
+}
+
+func (r *recordingAuditor) Record(_ context.Context, entry audit.Entry) {
+	r.entries = append(r.entries, entry)
+}
@@ -0,0 +1,170 @@
+// Package mock is the reference payment channel adapter. It speaks a small
+// form-over-HTTP protocol signed with the channel secret, served in-process
+// by Stub for development and tests.
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/payment"
+)
+
+// AdapterName is the adapter name used in PAYMENT_CHANNELS.
+const AdapterName = "mock"
+
+const (
+	requestTimeout   = 10 * time.Second
+	maxResponseBytes = 64 << 10
+)
+
+// Adapter implements payment.Channel against the mock channel API.
+type Adapter struct {
+	baseURL    string
+	merchantID string
+	secret     string
+	client     *http.Client
+}
+
+// New constructs an Adapter for a configured channel. It matches
+// payment.Factory.
+func New(channel config.PaymentChannel) (payment.Channel, error) {
+	if channel.BaseURL == "" {
+		return nil, errors.New("mock adapter requires a base url")
+	}
+	if channel.MerchantID == "" || channel.Secret == "" {
+		return nil, errors.New("mock adapter requires a merchant id and secret")
+	}
+
+	return &Adapter{
+		baseURL:    strings.TrimRight(channel.BaseURL, "/"),
+		merchantID: channel.MerchantID,
+		secret:     channel.Secret,
+		client:     &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// CreatePayment registers the order with the channel.
+func (a *Adapter) CreatePayment(ctx context.Context, req payment.PaymentRequest) (payment.Payment, error) {
+	var resp struct {
+		ChannelRef string `json:"channel_ref"`
+		PayURL     string `json:"pay_url"`
+	}
+	if err := a.post(ctx, "/payments", url.Values{
+		"order_id":    {req.OrderID},
+		"amount":      {strconv.FormatInt(req.AmountMinor, 10)},
+		"currency":    {req.Currency},
+		"description": {req.Description},
+		"notify_url":  {req.NotifyURL},
+	}, &resp); err != nil {
+		return payment.Payment{}, err
+	}
+
+	return payment.Payment{ChannelRef: resp.ChannelRef, PayURL: resp.PayURL}, nil
+}
+
+// QueryStatus asks the channel for the payment's status.
+func (a *Adapter) QueryStatus(ctx context.Context, orderID, channelRef string) (payment.PaymentStatus, error) {
+	var resp struct {
+		ChannelRef string `json:"channel_ref"`
+		Status     string `json:"status"`
+		Amount     int64  `json:"amount"`
+	}
+	if err := a.post(ctx, "/payments/query", url.Values{
+		"order_id":    {orderID},
+		"channel_ref": {channelRef},
+	}, &resp); err != nil {
+		return payment.PaymentStatus{}, err
+	}
+
+	return payment.PaymentStatus{ChannelRef: resp.ChannelRef, Status: resp.Status, AmountMinor: resp.Amount}, nil
+}
+
+// Refund refunds the payment in full.
+func (a *Adapter) Refund(ctx context.Context, req payment.RefundRequest) (payment.Refund, error) {
+	var resp struct {
+		RefundRef string `json:"refund_ref"`
+	}
+	if err := a.post(ctx, "/refunds", url.Values{
+		"order_id":        {req.OrderID},
+		"channel_ref":     {req.ChannelRef},
+		"amount":          {strconv.FormatInt(req.AmountMinor, 10)},
+		"idempotency_key": {req.IdempotencyKey},
+	}, &resp); err != nil {
+		return payment.Refund{}, err
+	}
+
+	return payment.Refund{RefundRef: resp.RefundRef}, nil
+}
+
+// VerifyCallback checks the form signature against the channel secret.
+func (a *Adapter) VerifyCallback(req payment.CallbackRequest) error {
+	form, err := url.ParseQuery(string(req.Body))
+	if err != nil || !payment.Verify(a.secret, form) {
+		return payment.ErrInvalidCallback
+	}
+
+	return nil
+}
+
+// ParseCallback reads the notification fields from the form body.
+func (a *Adapter) ParseCallback(req payment.CallbackRequest) (payment.Notification, error) {
+	form, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return payment.Notification{}, fmt.Errorf("parse callback body: %w", err)
+	}
+
+	return payment.ParseNotification(form)
+}
+
+// post sends a signed form to the channel and decodes the JSON answer. 4xx
+// answers carry the channel's reason and are returned as payment.ErrDeclined.
+func (a *Adapter) post(ctx context.Context, path string, form url.Values, out any) error {
+	form.Set("merchant_id", a.merchantID)
+	form.Set(payment.SignatureParam, payment.Sign(a.secret, form))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("build mock channel request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("call mock channel %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("read mock channel %s response: %w", path, err)
+	}
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("mock channel %s returned status %d", path, resp.StatusCode)
+	case resp.StatusCode >= http.StatusBadRequest:
+		var reason struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &reason) != nil || reason.Error == "" {
+			reason.Error = http.StatusText(resp.StatusCode)
+		}
+		return fmt.Errorf("%w: %s", payment.ErrDeclined, reason.Error)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode mock channel %s response: %w", path, err)
+	}
+
+	return nil
+}
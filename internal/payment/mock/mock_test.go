@@ -0,0 +1,117 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/payment"
+)
+
+func TestAdapterPaymentLifecycle(t *testing.T) {
+	stub := NewStub(map[string]string{"m-1": "stub-secret"}, logrus.NewEntry(logrus.New()))
+	stubServer := httptest.NewServer(stub.Handler())
+	t.Cleanup(stubServer.Close)
+
+	channel, err := New(config.PaymentChannel{Code: "mock", Adapter: AdapterName, MerchantID: "m-1", Secret: "stub-secret", BaseURL: stubServer.URL + "/"})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	notifications := make(chan payment.Notification, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := payment.CallbackRequest{Header: r.Header, Body: body}
+		if err := channel.VerifyCallback(req); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		n, err := channel.ParseCallback(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		notifications <- n
+	}))
+	t.Cleanup(receiver.Close)
+
+	ctx := context.Background()
+	created, err := channel.CreatePayment(ctx, payment.PaymentRequest{OrderID: "ord_1", AmountMinor: 1250, Currency: "USD", NotifyURL: receiver.URL + "/callbacks/mock"})
+	if err != nil || created.ChannelRef == "" || created.PayURL != stubServer.URL+"/pay/"+created.ChannelRef {
+		t.Fatalf("unexpected payment %+v err=%v", created, err)
+	}
+	if _, err := channel.CreatePayment(ctx, payment.PaymentRequest{OrderID: "ord_1", AmountMinor: 1250, Currency: "USD"}); !errors.Is(err, payment.ErrDeclined) {
+		t.Fatalf("expected duplicate order to be declined, got %v", err)
+	}
+
+	if _, err := channel.Refund(ctx, payment.RefundRequest{OrderID: "ord_1", ChannelRef: created.ChannelRef, AmountMinor: 1250}); !errors.Is(err, payment.ErrDeclined) {
+		t.Fatalf("expected refund of a pending payment to be declined, got %v", err)
+	}
+
+	resp, err := http.Get(created.PayURL)
+	if err != nil {
+		t.Fatalf("open pay url: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected pay page to settle the payment, got %d", resp.StatusCode)
+	}
+	select {
+	case n := <-notifications:
+		if n.OrderID != "ord_1" || n.Status != domain.OrderStatusPaid || n.AmountMinor != 1250 || n.ChannelRef != created.ChannelRef {
+			t.Fatalf("unexpected notification %+v", n)
+		}
+	default:
+		t.Fatalf("expected a signed callback to be delivered")
+	}
+
+	status, err := channel.QueryStatus(ctx, "ord_1", "")
+	if err != nil || status.Status != domain.OrderStatusPaid || status.AmountMinor != 1250 || status.ChannelRef != created.ChannelRef {
+		t.Fatalf("unexpected status %+v err=%v", status, err)
+	}
+
+	refundReq := payment.RefundRequest{OrderID: "ord_1", ChannelRef: created.ChannelRef, AmountMinor: 1250, IdempotencyKey: payment.RefundIdempotencyKey("ord_1")}
+	refund, err := channel.Refund(ctx, refundReq)
+	if err != nil || refund.RefundRef == "" {
+		t.Fatalf("unexpected refund %+v err=%v", refund, err)
+	}
+	if replay, err := channel.Refund(ctx, refundReq); err != nil || replay.RefundRef != refund.RefundRef {
+		t.Fatalf("expected a retried refund to return the original, got %+v err=%v", replay, err)
+	}
+	refundReq.IdempotencyKey = ""
+	if _, err := channel.Refund(ctx, refundReq); !errors.Is(err, payment.ErrDeclined) {
+		t.Fatalf("expected an unkeyed second refund to be declined, got %v", err)
+	}
+	if status, _ := channel.QueryStatus(ctx, "ord_1", created.ChannelRef); status.Status != domain.OrderStatusRefunded {
+		t.Fatalf("expected refunded status, got %+v", status)
+	}
+}
+
+func TestAdapterRejectsWrongCredentials(t *testing.T) {
+	stub := NewStub(map[string]string{"m-1": "stub-secret"}, logrus.NewEntry(logrus.New()))
+	stubServer := httptest.NewServer(stub.Handler())
+	t.Cleanup(stubServer.Close)
+
+	channel, err := New(config.PaymentChannel{MerchantID: "m-1", Secret: "wrong", BaseURL: stubServer.URL})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if _, err := channel.CreatePayment(context.Background(), payment.PaymentRequest{OrderID: "ord_1", AmountMinor: 1, Currency: "USD"}); !errors.Is(err, payment.ErrDeclined) {
+		t.Fatalf("expected signature rejection, got %v", err)
+	}
+
+	if err := channel.VerifyCallback(payment.CallbackRequest{Body: []byte("order_id=ord_1&status=paid&amount=1&sign=00")}); !errors.Is(err, payment.ErrInvalidCallback) {
+		t.Fatalf("expected forged callback to fail verification, got %v", err)
+	}
+
+	if _, err := New(config.PaymentChannel{MerchantID: "m-1", Secret: "s"}); err == nil {
+		t.Fatalf("expected missing base url to be rejected")
+	}
+}
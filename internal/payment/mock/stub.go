@@ -0,0 +1,366 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+	"tg_pay_gateway_bot/internal/payment"
+)
+
+const (
+	stubReadHeaderTimeout = 5 * time.Second
+	stubShutdownTimeout   = 5 * time.Second
+	notifyTimeout         = 10 * time.Second
+	maxStubBodyBytes      = 64 << 10
+)
+
+// Stub is an in-process mock payment channel. It accepts payments from
+// Adapter, pretends the payer completed them when GET /pay/{ref} is opened,
+// and posts signed callbacks to each payment's notify URL.
+type Stub struct {
+	mu       sync.Mutex
+	secrets  map[string]string
+	payments map[string]*stubPayment
+	byOrder  map[string]string
+	seq      int
+
+	listener net.Listener
+	client   *http.Client
+	logger   *logrus.Entry
+}
+
+type stubPayment struct {
+	ref        string
+	merchantID string
+	orderID    string
+	amount     int64
+	currency   string
+	notifyURL  string
+	status     string
+	refundKey  string
+}
+
+// NewStub constructs a Stub accepting the given merchant IDs, each signing
+// with its secret.
+func NewStub(merchants map[string]string, logger *logrus.Entry) *Stub {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	secrets := make(map[string]string, len(merchants))
+	for id, secret := range merchants {
+		secrets[id] = secret
+	}
+
+	return &Stub{
+		secrets:  secrets,
+		payments: make(map[string]*stubPayment),
+		byOrder:  make(map[string]string),
+		client:   &http.Client{Timeout: notifyTimeout},
+		logger:   logger,
+	}
+}
+
+// Handler returns the stub's HTTP API.
+func (s *Stub) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payments", s.handleCreate)
+	mux.HandleFunc("POST /payments/query", s.handleQuery)
+	mux.HandleFunc("POST /refunds", s.handleRefund)
+	mux.HandleFunc("GET /pay/{ref}", s.handlePay)
+
+	return mux
+}
+
+// Listen binds the stub to addr, e.g. "127.0.0.1:0", and returns its base
+// URL. Start serves on the bound listener.
+func (s *Stub) Listen(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("listen mock channel stub: %w", err)
+	}
+	s.listener = listener
+
+	return "http://" + listener.Addr().String(), nil
+}
+
+// Start serves the stub until the context is canceled. Listen must be called
+// first.
+func (s *Stub) Start(ctx context.Context) {
+	if s.listener == nil {
+		s.logger.WithField("event", "mock_stub_not_listening").Error("mock channel stub started without a listener")
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: stubReadHeaderTimeout,
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "mock_stub_listen",
+		"listen_addr": s.listener.Addr().String(),
+	}).Info("starting mock payment channel stub")
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(s.listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithField("event", "mock_stub_error").WithError(err).Error("mock payment channel stub failed")
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), stubShutdownTimeout)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.logger.WithField("event", "mock_stub_shutdown_error").WithError(err).Error("failed to stop mock payment channel stub")
+	}
+	cancel()
+}
+
+// Settle moves a pending payment to paid or failed and posts the callback
+// to its notify URL, if any.
+func (s *Stub) Settle(ctx context.Context, ref, status string) error {
+	if status != domain.OrderStatusPaid && status != domain.OrderStatusFailed {
+		return fmt.Errorf("unsupported settlement status %q", status)
+	}
+
+	s.mu.Lock()
+	p, ok := s.payments[ref]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("payment %s not found", ref)
+	}
+	if p.status != domain.OrderStatusPending {
+		s.mu.Unlock()
+		return fmt.Errorf("payment %s is already %s", ref, p.status)
+	}
+	p.status = status
+	settled := *p
+	secret := s.secrets[p.merchantID]
+	s.mu.Unlock()
+
+	if settled.notifyURL == "" {
+		return nil
+	}
+
+	return s.notify(ctx, settled, secret)
+}
+
+func (s *Stub) notify(ctx context.Context, p stubPayment, secret string) error {
+	form := url.Values{
+		"merchant_id": {p.merchantID},
+		"order_id":    {p.orderID},
+		"status":      {p.status},
+		"amount":      {strconv.FormatInt(p.amount, 10)},
+		"currency":    {p.currency},
+		"channel_ref": {p.ref},
+	}
+	form.Set(payment.SignatureParam, payment.Sign(secret, form))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.notifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("build callback for %s: %w", p.ref, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post callback for %s: %w", p.ref, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("callback for %s returned status %d", p.ref, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *Stub) handleCreate(w http.ResponseWriter, r *http.Request) {
+	form, merchantID, ok := s.verify(w, r)
+	if !ok {
+		return
+	}
+
+	amount, err := strconv.ParseInt(form.Get("amount"), 10, 64)
+	orderID := form.Get("order_id")
+	if err != nil || amount <= 0 || orderID == "" || form.Get("currency") == "" {
+		writeStubError(w, http.StatusBadRequest, "order_id, amount and currency are required")
+		return
+	}
+
+	s.mu.Lock()
+	if _, exists := s.byOrder[merchantID+"/"+orderID]; exists {
+		s.mu.Unlock()
+		writeStubError(w, http.StatusConflict, "duplicate order_id")
+		return
+	}
+	s.seq++
+	p := &stubPayment{
+		ref:        fmt.Sprintf("mock_%06d", s.seq),
+		merchantID: merchantID,
+		orderID:    orderID,
+		amount:     amount,
+		currency:   form.Get("currency"),
+		notifyURL:  form.Get("notify_url"),
+		status:     domain.OrderStatusPending,
+	}
+	s.payments[p.ref] = p
+	s.byOrder[merchantID+"/"+orderID] = p.ref
+	s.mu.Unlock()
+
+	writeStubJSON(w, map[string]any{
+		"channel_ref": p.ref,
+		"pay_url":     "http://" + r.Host + "/pay/" + p.ref,
+	})
+}
+
+func (s *Stub) handleQuery(w http.ResponseWriter, r *http.Request) {
+	form, merchantID, ok := s.verify(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	p, found := s.lookup(merchantID, form.Get("order_id"), form.Get("channel_ref"))
+	var current stubPayment
+	if found {
+		current = *p
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeStubError(w, http.StatusNotFound, "payment not found")
+		return
+	}
+
+	writeStubJSON(w, map[string]any{
+		"channel_ref": current.ref,
+		"status":      current.status,
+		"amount":      current.amount,
+	})
+}
+
+func (s *Stub) handleRefund(w http.ResponseWriter, r *http.Request) {
+	form, merchantID, ok := s.verify(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, found := s.lookup(merchantID, form.Get("order_id"), form.Get("channel_ref"))
+	key := form.Get("idempotency_key")
+	switch {
+	case !found:
+		writeStubError(w, http.StatusNotFound, "payment not found")
+		return
+	case p.status == domain.OrderStatusRefunded && key != "" && key == p.refundKey:
+		// A retried refund gets the original answer.
+		writeStubJSON(w, map[string]any{"refund_ref": "rf_" + p.ref})
+		return
+	case p.status != domain.OrderStatusPaid:
+		writeStubError(w, http.StatusConflict, "payment is "+p.status)
+		return
+	case form.Get("amount") != strconv.FormatInt(p.amount, 10):
+		writeStubError(w, http.StatusBadRequest, "only full refunds are supported")
+		return
+	}
+	p.status = domain.OrderStatusRefunded
+	p.refundKey = key
+
+	writeStubJSON(w, map[string]any{"refund_ref": "rf_" + p.ref})
+}
+
+// handlePay plays the payer completing the payment page; ?status=failed
+// declines it instead.
+func (s *Stub) handlePay(w http.ResponseWriter, r *http.Request) {
+	status := domain.OrderStatusPaid
+	if r.URL.Query().Get("status") == domain.OrderStatusFailed {
+		status = domain.OrderStatusFailed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), notifyTimeout)
+	defer cancel()
+
+	ref := r.PathValue("ref")
+	if err := s.Settle(ctx, ref, status); err != nil {
+		s.logger.WithFields(logging.Fields{
+			"event":       "mock_stub_settle_failed",
+			"channel_ref": ref,
+		}).WithError(err).Warn("mock payment settlement failed")
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "Payment %s %s.\n", ref, status)
+}
+
+// verify parses the signed form and checks it against the merchant's secret.
+func (s *Stub) verify(w http.ResponseWriter, r *http.Request) (url.Values, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxStubBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		writeStubError(w, http.StatusBadRequest, "malformed form body")
+		return nil, "", false
+	}
+
+	merchantID := r.PostForm.Get("merchant_id")
+	s.mu.Lock()
+	secret, ok := s.secrets[merchantID]
+	s.mu.Unlock()
+	if !ok || !payment.Verify(secret, r.PostForm) {
+		writeStubError(w, http.StatusUnauthorized, "invalid merchant or signature")
+		return nil, "", false
+	}
+
+	return r.PostForm, merchantID, true
+}
+
+// lookup finds a merchant's payment by reference or order ID. The caller
+// holds s.mu.
+func (s *Stub) lookup(merchantID, orderID, ref string) (*stubPayment, bool) {
+	if ref == "" {
+		ref = s.byOrder[merchantID+"/"+orderID]
+	}
+
+	p, ok := s.payments[ref]
+	if !ok || p.merchantID != merchantID {
+		return nil, false
+	}
+
+	return p, true
+}
+
+func writeStubJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeStubError(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": reason})
+}
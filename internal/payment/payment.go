@@ -0,0 +1,135 @@
+// Package payment defines the adapter interface upstream payment channels
+// implement, the registry resolving channel codes to configured adapters, and
+// the commands that create, query and refund orders through them.
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+// ErrDeclined is matched by errors an adapter returns when the channel
+// answered but refused the request, as opposed to transport failures.
+var ErrDeclined = errors.New("payment channel declined the request")
+
+// ErrInvalidCallback is matched by errors from VerifyCallback when the
+// callback is not authentic.
+var ErrInvalidCallback = errors.New("invalid payment callback signature")
+
+// Channel is implemented by each upstream payment channel adapter. One value
+// serves one channel code with one credential set.
+type Channel interface {
+	// CreatePayment registers the order with the channel and returns where
+	// the payer completes it.
+	CreatePayment(ctx context.Context, req PaymentRequest) (Payment, error)
+	// QueryStatus asks the channel for the current state of an order's
+	// payment.
+	QueryStatus(ctx context.Context, orderID, channelRef string) (PaymentStatus, error)
+	// Refund returns a paid order's full amount to the payer.
+	Refund(ctx context.Context, req RefundRequest) (Refund, error)
+	// VerifyCallback authenticates an inbound notification, returning an
+	// error matching ErrInvalidCallback when it was not sent by the channel.
+	VerifyCallback(req CallbackRequest) error
+	// ParseCallback extracts the notification from a verified callback.
+	ParseCallback(req CallbackRequest) (Notification, error)
+}
+
+// PaymentRequest describes an order to be paid through a channel.
+type PaymentRequest struct {
+	OrderID     string
+	AmountMinor int64
+	Currency    string
+	Description string
+	// NotifyURL receives the channel's callbacks; empty when the callback
+	// listener is not publicly reachable.
+	NotifyURL string
+}
+
+// Payment is the channel's acceptance of a payment request.
+type Payment struct {
+	ChannelRef string
+	PayURL     string
+}
+
+// PaymentStatus is the channel's view of a payment. Status uses the order
+// status values.
+type PaymentStatus struct {
+	ChannelRef  string
+	Status      string
+	AmountMinor int64
+}
+
+// RefundRequest identifies the paid order to refund. IdempotencyKey is the
+// same for every attempt to refund the order; channels that support it
+// answer a repeated key with the original refund.
+type RefundRequest struct {
+	OrderID        string
+	ChannelRef     string
+	AmountMinor    int64
+	IdempotencyKey string
+}
+
+// RefundIdempotencyKey is the idempotency key sent with refunds of orderID.
+func RefundIdempotencyKey(orderID string) string {
+	return "refund:" + orderID
+}
+
+// Refund is the channel's acceptance of a refund.
+type Refund struct {
+	RefundRef string
+}
+
+// CallbackRequest is an inbound channel notification as received over HTTP.
+type CallbackRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+// Notification is a parsed payment-channel callback.
+type Notification struct {
+	Channel     string
+	OrderID     string
+	Status      string
+	AmountMinor int64
+	// Currency is empty when the channel does not report one.
+	Currency   string
+	ChannelRef string
+}
+
+// ParseNotification reads the order_id, status, amount, optional currency and
+// channel_ref form fields shared by the built-in channels. Only paid and
+// failed statuses are accepted.
+func ParseNotification(form url.Values) (Notification, error) {
+	get := func(key string) string {
+		return strings.TrimSpace(form.Get(key))
+	}
+
+	n := Notification{
+		OrderID:    get("order_id"),
+		Status:     strings.ToLower(get("status")),
+		Currency:   strings.ToUpper(get("currency")),
+		ChannelRef: get("channel_ref"),
+	}
+
+	if n.OrderID == "" {
+		return Notification{}, errors.New("order_id is required")
+	}
+	if n.Status != domain.OrderStatusPaid && n.Status != domain.OrderStatusFailed {
+		return Notification{}, fmt.Errorf("unsupported status %q", n.Status)
+	}
+
+	amount, err := strconv.ParseInt(get("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		return Notification{}, errors.New("amount must be a positive integer in minor units")
+	}
+	n.AmountMinor = amount
+
+	return n, nil
+}
@@ -0,0 +1,145 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+// Factory builds an adapter for one configured channel.
+type Factory func(channel config.PaymentChannel) (Channel, error)
+
+// Entry is a channel registered under its code, with the adapter and
+// credential set that serve it and its routing limits.
+type Entry struct {
+	Code          string
+	Adapter       string
+	CredentialSet string
+	Channel       Channel
+
+	// Weight is the channel's share of routed orders; zero keeps it for
+	// failover only.
+	Weight int
+	// MinAmount, MaxAmount and DailyCap are in minor units; zero means no
+	// limit. DailyCap applies per currency and UTC day.
+	MinAmount int64
+	MaxAmount int64
+	DailyCap  int64
+}
+
+// Accepts reports whether amount is within the channel's per-order limits.
+func (e Entry) Accepts(amount int64) bool {
+	if e.MinAmount > 0 && amount < e.MinAmount {
+		return false
+	}
+	if e.MaxAmount > 0 && amount > e.MaxAmount {
+		return false
+	}
+
+	return true
+}
+
+// Registry resolves channel codes to their adapters. It is safe for
+// concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// NewRegistry builds an adapter for each configured channel using the
+// factory registered under its adapter name.
+func NewRegistry(channels []config.PaymentChannel, factories map[string]Factory) (*Registry, error) {
+	registry := &Registry{entries: make(map[string]Entry)}
+	for _, channel := range channels {
+		factory, ok := factories[channel.Adapter]
+		if !ok {
+			return nil, fmt.Errorf("payment channel %s: unknown adapter %q", channel.Code, channel.Adapter)
+		}
+
+		adapter, err := factory(channel)
+		if err != nil {
+			return nil, fmt.Errorf("payment channel %s: %w", channel.Code, err)
+		}
+
+		if err := registry.Register(Entry{
+			Code:          channel.Code,
+			Adapter:       channel.Adapter,
+			CredentialSet: channel.CredentialSet,
+			Channel:       adapter,
+			Weight:        channel.Weight,
+			MinAmount:     channel.MinAmount,
+			MaxAmount:     channel.MaxAmount,
+			DailyCap:      channel.DailyCap,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// Register adds a channel; codes must be unique.
+func (r *Registry) Register(entry Entry) error {
+	if r == nil {
+		return errors.New("payment registry is not initialized")
+	}
+
+	entry.Code = domain.NormalizeChannelCode(entry.Code)
+	if entry.Code == "" || entry.Adapter == "" || entry.Channel == nil {
+		return errors.New("payment channel code, adapter and implementation are required")
+	}
+	if entry.CredentialSet == "" {
+		entry.CredentialSet = config.DefaultCredentialSet
+	}
+	if entry.Weight < 0 {
+		return fmt.Errorf("payment channel %s: weight must not be negative", entry.Code)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.entries == nil {
+		r.entries = make(map[string]Entry)
+	}
+	if _, exists := r.entries[entry.Code]; exists {
+		return fmt.Errorf("payment channel %s is already registered", entry.Code)
+	}
+	r.entries[entry.Code] = entry
+
+	return nil
+}
+
+// Get returns the channel registered under code.
+func (r *Registry) Get(code string) (Entry, bool) {
+	if r == nil {
+		return Entry{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.entries[domain.NormalizeChannelCode(code)]
+	return entry, ok
+}
+
+// Entries returns the registered channels sorted by code.
+func (r *Registry) Entries() []Entry {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Code < entries[j].Code })
+
+	return entries
+}
@@ -0,0 +1,57 @@
+package payment
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"tg_pay_gateway_bot/internal/config"
+)
+
+func TestNewRegistryBuildsConfiguredChannels(t *testing.T) {
+	var built []string
+	factories := map[string]Factory{
+		"fake": func(channel config.PaymentChannel) (Channel, error) {
+			built = append(built, channel.Code+"/"+channel.MerchantID)
+			return &fakeChannel{}, nil
+		},
+	}
+
+	registry, err := NewRegistry([]config.PaymentChannel{
+		{Code: "zeta", Adapter: "fake", CredentialSet: "2026-10", MerchantID: "m-2"},
+		{Code: "alpha", Adapter: "fake", MerchantID: "m-1"},
+	}, factories)
+	if err != nil {
+		t.Fatalf("NewRegistry returned error: %v", err)
+	}
+	if len(built) != 2 || built[0] != "zeta/m-2" || built[1] != "alpha/m-1" {
+		t.Fatalf("expected a factory call per channel, got %v", built)
+	}
+
+	entry, ok := registry.Get(" ZETA ")
+	if !ok || entry.Adapter != "fake" || entry.CredentialSet != "2026-10" {
+		t.Fatalf("unexpected entry %+v ok=%v", entry, ok)
+	}
+	if entry, _ := registry.Get("alpha"); entry.CredentialSet != config.DefaultCredentialSet {
+		t.Fatalf("expected default credential set, got %q", entry.CredentialSet)
+	}
+	if entries := registry.Entries(); len(entries) != 2 || entries[0].Code != "alpha" || entries[1].Code != "zeta" {
+		t.Fatalf("expected entries sorted by code, got %+v", entries)
+	}
+	if err := registry.Register(Entry{Code: "alpha", Adapter: "fake", Channel: &fakeChannel{}}); err == nil {
+		t.Fatalf("expected duplicate code to be rejected")
+	}
+
+	if _, err := NewRegistry([]config.PaymentChannel{{Code: "beta", Adapter: "missing"}}, factories); err == nil || !strings.Contains(err.Error(), "unknown adapter") {
+		t.Fatalf("expected unknown adapter error, got %v", err)
+	}
+	failing := map[string]Factory{"fake": func(config.PaymentChannel) (Channel, error) { return nil, errors.New("no base url") }}
+	if _, err := NewRegistry([]config.PaymentChannel{{Code: "beta", Adapter: "fake"}}, failing); err == nil || !strings.Contains(err.Error(), "beta") {
+		t.Fatalf("expected factory error naming the channel, got %v", err)
+	}
+
+	var nilRegistry *Registry
+	if _, ok := nilRegistry.Get("alpha"); ok {
+		t.Fatalf("expected nil registry to have no channels")
+	}
+}
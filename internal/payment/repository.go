@@ -0,0 +1,313 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDailyCapReached is returned when a payment would take a channel over its
+// daily volume cap.
+var ErrDailyCapReached = errors.New("channel daily volume cap reached")
+
+type stateCollection interface {
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+}
+
+// ChannelState is the runtime state of a channel shared by all bot
+// instances. A channel without a stored state is enabled with a closed
+// breaker.
+type ChannelState struct {
+	Code             string     `bson:"code"`
+	Disabled         bool       `bson:"disabled"`
+	ToggledBy        int64      `bson:"toggled_by,omitempty"`
+	ToggledAt        *time.Time `bson:"toggled_at,omitempty"`
+	BreakerOpenUntil *time.Time `bson:"breaker_open_until,omitempty"`
+	BreakerReason    string     `bson:"breaker_reason,omitempty"`
+	UpdatedAt        time.Time  `bson:"updated_at"`
+}
+
+// BreakerOpen reports whether the circuit breaker keeps the channel out of
+// routing at now.
+func (s ChannelState) BreakerOpen(now time.Time) bool {
+	return s.BreakerOpenUntil != nil && now.Before(*s.BreakerOpenUntil)
+}
+
+// Outcomes counts payment creation results for one channel.
+type Outcomes struct {
+	Successes int64 `bson:"successes"`
+	Failures  int64 `bson:"failures"`
+}
+
+// Total returns the number of counted attempts.
+func (o Outcomes) Total() int64 {
+	return o.Successes + o.Failures
+}
+
+// FailurePercent returns the share of failed attempts, or zero when there
+// were none.
+func (o Outcomes) FailurePercent() int64 {
+	if o.Total() == 0 {
+		return 0
+	}
+
+	return o.Failures * 100 / o.Total()
+}
+
+// Volume is the amount a channel took in one currency on one UTC day.
+type Volume struct {
+	Code        string    `bson:"code"`
+	Day         time.Time `bson:"day"`
+	Currency    string    `bson:"currency"`
+	AmountMinor int64     `bson:"amount_minor"`
+}
+
+// Repository keeps channel runtime state, outcome counters and daily volume
+// in MongoDB so every bot instance routes from the same view.
+type Repository struct {
+	channels stateCollection
+	outcomes stateCollection
+	volume   stateCollection
+}
+
+// NewRepository constructs a Repository over the channel state, outcome and
+// volume collections.
+func NewRepository(channels, outcomes, volume stateCollection) *Repository {
+	return &Repository{channels: channels, outcomes: outcomes, volume: volume}
+}
+
+// States returns the stored channel states keyed by code.
+func (r *Repository) States(ctx context.Context) (map[string]ChannelState, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.channels.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("find channel states: %w", err)
+	}
+
+	var states []ChannelState
+	if err := cursor.All(ctx, &states); err != nil {
+		return nil, fmt.Errorf("decode channel states: %w", err)
+	}
+
+	byCode := make(map[string]ChannelState, len(states))
+	for _, state := range states {
+		byCode[state.Code] = state
+	}
+
+	return byCode, nil
+}
+
+// ToggleDisabled flips a channel between enabled and disabled on behalf of
+// actorID and returns the new state. The flip is a single update pipeline, so
+// concurrent toggles each apply in turn instead of writing the same value.
+// Enabling a channel also closes its circuit breaker.
+func (r *Repository) ToggleDisabled(ctx context.Context, code string, actorID int64, at time.Time) (ChannelState, error) {
+	if err := r.check(ctx); err != nil {
+		return ChannelState{}, err
+	}
+
+	// A channel without a stored state is enabled, and $not of a missing
+	// field is true.
+	keepWhileDisabled := func(field string) bson.M {
+		return bson.M{"$cond": bson.A{"$disabled", "$" + field, "$$REMOVE"}}
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"disabled":   bson.M{"$not": bson.A{"$disabled"}},
+			"toggled_by": actorID,
+			"toggled_at": at,
+			"updated_at": at,
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"breaker_open_until": keepWhileDisabled("breaker_open_until"),
+			"breaker_reason":     keepWhileDisabled("breaker_reason"),
+		}}},
+	}
+
+	result := r.channels.FindOneAndUpdate(ctx, bson.M{"code": code}, update,
+		options.FindOneAndUpdate().
+			SetUpsert(true).
+			SetReturnDocument(options.After),
+	)
+	if result == nil {
+		return ChannelState{}, errors.New("update channel state returned no result")
+	}
+	if err := result.Err(); err != nil {
+		return ChannelState{}, fmt.Errorf("update channel state: %w", err)
+	}
+
+	var state ChannelState
+	if err := result.Decode(&state); err != nil {
+		return ChannelState{}, fmt.Errorf("decode channel state: %w", err)
+	}
+
+	return state, nil
+}
+
+// OpenBreaker keeps the channel out of routing until the given time.
+func (r *Repository) OpenBreaker(ctx context.Context, code string, until time.Time, reason string, at time.Time) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+
+	if _, err := r.channels.UpdateOne(ctx,
+		bson.M{"code": code},
+		bson.M{
+			"$set": bson.M{
+				"breaker_open_until": until,
+				"breaker_reason":     reason,
+				"updated_at":         at,
+			},
+			"$setOnInsert": bson.M{"disabled": false},
+		},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return fmt.Errorf("open channel breaker: %w", err)
+	}
+
+	return nil
+}
+
+// RecordOutcome counts one payment creation attempt in the channel's bucket
+// for the minute of at.
+func (r *Repository) RecordOutcome(ctx context.Context, code string, success bool, at time.Time) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+
+	field := "failures"
+	if success {
+		field = "successes"
+	}
+
+	if _, err := r.outcomes.UpdateOne(ctx,
+		bson.M{"code": code, "bucket": at.UTC().Truncate(time.Minute)},
+		bson.M{"$inc": bson.M{field: int64(1)}},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return fmt.Errorf("record channel outcome: %w", err)
+	}
+
+	return nil
+}
+
+// Outcomes sums the attempts per channel from since on. Counters are kept per
+// minute, so since is rounded down to the minute.
+func (r *Repository) Outcomes(ctx context.Context, since time.Time) (map[string]Outcomes, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.outcomes.Find(ctx, bson.M{"bucket": bson.M{"$gte": since.UTC().Truncate(time.Minute)}})
+	if err != nil {
+		return nil, fmt.Errorf("find channel outcomes: %w", err)
+	}
+
+	var buckets []struct {
+		Code     string `bson:"code"`
+		Outcomes `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, fmt.Errorf("decode channel outcomes: %w", err)
+	}
+
+	byCode := make(map[string]Outcomes)
+	for _, bucket := range buckets {
+		total := byCode[bucket.Code]
+		total.Successes += bucket.Successes
+		total.Failures += bucket.Failures
+		byCode[bucket.Code] = total
+	}
+
+	return byCode, nil
+}
+
+// ReserveVolume adds amount to the channel's volume for the day and
+// currency. With a positive dailyCap the reservation is refused with
+// ErrDailyCapReached when it would exceed the cap; the check and the
+// increment are a single write, so concurrent instances cannot overshoot.
+func (r *Repository) ReserveVolume(ctx context.Context, code string, day time.Time, currency string, amount, dailyCap int64) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if dailyCap > 0 && amount > dailyCap {
+		return ErrDailyCapReached
+	}
+
+	filter := bson.M{"code": code, "day": day, "currency": currency}
+	if dailyCap > 0 {
+		// A full day matches no document, so the upsert collides with the
+		// unique index instead of adding to it.
+		filter["amount_minor"] = bson.M{"$lte": dailyCap - amount}
+	}
+
+	_, err := r.volume.UpdateOne(ctx, filter,
+		bson.M{"$inc": bson.M{"amount_minor": amount}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDailyCapReached
+	}
+	if err != nil {
+		return fmt.Errorf("reserve channel volume: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseVolume returns a reservation made by ReserveVolume.
+func (r *Repository) ReleaseVolume(ctx context.Context, code string, day time.Time, currency string, amount int64) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+
+	if _, err := r.volume.UpdateOne(ctx,
+		bson.M{"code": code, "day": day, "currency": currency},
+		bson.M{"$inc": bson.M{"amount_minor": -amount}},
+	); err != nil {
+		return fmt.Errorf("release channel volume: %w", err)
+	}
+
+	return nil
+}
+
+// Volumes returns every channel's volume for the day.
+func (r *Repository) Volumes(ctx context.Context, day time.Time) ([]Volume, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.volume.Find(ctx, bson.M{"day": day},
+		options.Find().SetSort(bson.D{{Key: "code", Value: 1}, {Key: "currency", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("find channel volume: %w", err)
+	}
+
+	var volumes []Volume
+	if err := cursor.All(ctx, &volumes); err != nil {
+		return nil, fmt.Errorf("decode channel volume: %w", err)
+	}
+
+	return volumes, nil
+}
+
+func (r *Repository) check(ctx context.Context) error {
+	if r == nil || r.channels == nil || r.outcomes == nil || r.volume == nil {
+		return errors.New("payment channel repository is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
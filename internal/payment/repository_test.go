@@ -0,0 +1,132 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRepositoryReserveVolumeEnforcesCap(t *testing.T) {
+	volume := &recordingStateCollection{}
+	repo := NewRepository(&recordingStateCollection{}, &recordingStateCollection{}, volume)
+	ctx := context.Background()
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	if err := repo.ReserveVolume(ctx, "mock", day, "USD", 1500, 2000); err != nil {
+		t.Fatalf("ReserveVolume returned error: %v", err)
+	}
+	filter := volume.filters[0].(bson.M)
+	if filter["code"] != "mock" || filter["currency"] != "USD" || !filter["day"].(time.Time).Equal(day) {
+		t.Fatalf("unexpected reservation filter %v", filter)
+	}
+	if bound := filter["amount_minor"].(bson.M)["$lte"]; bound != int64(500) {
+		t.Fatalf("expected reservation to require room for the amount, got %v", bound)
+	}
+
+	volume.updateErr = mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+	if err := repo.ReserveVolume(ctx, "mock", day, "USD", 1500, 2000); !errors.Is(err, ErrDailyCapReached) {
+		t.Fatalf("expected duplicate key to mean the cap is reached, got %v", err)
+	}
+	volume.updateErr = nil
+	if err := repo.ReserveVolume(ctx, "mock", day, "USD", 2500, 2000); !errors.Is(err, ErrDailyCapReached) || len(volume.filters) != 2 {
+		t.Fatalf("expected an amount above the cap to be refused without a write, got %v", err)
+	}
+
+	if err := repo.ReserveVolume(ctx, "mock", day, "USD", 2500, 0); err != nil {
+		t.Fatalf("ReserveVolume without cap returned error: %v", err)
+	}
+	if _, bounded := volume.filters[2].(bson.M)["amount_minor"]; bounded {
+		t.Fatalf("expected uncapped reservation to be unbounded, got %v", volume.filters[2])
+	}
+
+	if err := NewRepository(nil, nil, nil).ReserveVolume(ctx, "mock", day, "USD", 1, 0); err == nil {
+		t.Fatalf("expected uninitialized repository to fail")
+	}
+}
+
+func TestRepositoryOutcomesSumsBuckets(t *testing.T) {
+	outcomes := &recordingStateCollection{results: []interface{}{
+		bson.M{"code": "mock", "bucket": time.Now(), "successes": int64(3)},
+		bson.M{"code": "mock", "bucket": time.Now(), "successes": int64(1), "failures": int64(2)},
+		bson.M{"code": "spare", "bucket": time.Now(), "failures": int64(1)},
+	}}
+	repo := NewRepository(&recordingStateCollection{}, outcomes, &recordingStateCollection{})
+
+	since := time.Date(2026, 10, 16, 11, 45, 30, 0, time.UTC)
+	byCode, err := repo.Outcomes(context.Background(), since)
+	if err != nil {
+		t.Fatalf("Outcomes returned error: %v", err)
+	}
+	if byCode["mock"] != (Outcomes{Successes: 4, Failures: 2}) || byCode["spare"].FailurePercent() != 100 {
+		t.Fatalf("unexpected outcomes %+v", byCode)
+	}
+	bucket := outcomes.filters[0].(bson.M)["bucket"].(bson.M)["$gte"].(time.Time)
+	if !bucket.Equal(since.Truncate(time.Minute)) {
+		t.Fatalf("expected window start rounded to the minute, got %v", bucket)
+	}
+}
+
+func TestRepositoryToggleDisabledFlipsInOneUpdate(t *testing.T) {
+	channels := &recordingStateCollection{results: []interface{}{bson.M{"code": "mock", "disabled": true}}}
+	repo := NewRepository(channels, &recordingStateCollection{}, &recordingStateCollection{})
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	state, err := repo.ToggleDisabled(context.Background(), "mock", 5, at)
+	if err != nil || state.Code != "mock" || !state.Disabled {
+		t.Fatalf("unexpected state %+v err=%v", state, err)
+	}
+	if filter := channels.filters[0].(bson.M); len(filter) != 1 || filter["code"] != "mock" {
+		t.Fatalf("expected toggle to match the channel only by code, got %v", filter)
+	}
+
+	pipeline, ok := channels.updates[0].(mongo.Pipeline)
+	if !ok || len(pipeline) != 2 {
+		t.Fatalf("expected a two-stage update pipeline, got %#v", channels.updates[0])
+	}
+	flip := pipeline[0][0].Value.(bson.M)
+	if not := flip["disabled"].(bson.M)["$not"]; len(not.(bson.A)) != 1 || not.(bson.A)[0] != "$disabled" {
+		t.Fatalf("expected disabled to be negated server-side, got %v", flip["disabled"])
+	}
+	if flip["toggled_by"] != int64(5) || flip["toggled_at"] != at {
+		t.Fatalf("expected toggle actor and time, got %v", flip)
+	}
+	breaker := pipeline[1][0].Value.(bson.M)["breaker_open_until"].(bson.M)["$cond"].(bson.A)
+	if breaker[0] != "$disabled" || breaker[2] != "$$REMOVE" {
+		t.Fatalf("expected enabling to clear the breaker, got %v", breaker)
+	}
+}
+
+type recordingStateCollection struct {
+	results   []interface{}
+	updateErr error
+	filters   []interface{}
+	updates   []interface{}
+}
+
+func (c *recordingStateCollection) Find(_ context.Context, filter interface{}, _ ...*options.FindOptions) (*mongo.Cursor, error) {
+	c.filters = append(c.filters, filter)
+	return mongo.NewCursorFromDocuments(c.results, nil, nil)
+}
+
+func (c *recordingStateCollection) FindOneAndUpdate(_ context.Context, filter interface{}, update interface{}, _ ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	c.filters = append(c.filters, filter)
+	c.updates = append(c.updates, update)
+	if len(c.results) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(c.results[0], nil, nil)
+}
+
+func (c *recordingStateCollection) UpdateOne(_ context.Context, filter interface{}, update interface{}, _ ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	c.filters = append(c.filters, filter)
+	c.updates = append(c.updates, update)
+	if c.updateErr != nil {
+		return nil, c.updateErr
+	}
+	return &mongo.UpdateResult{}, nil
+}
@@ -0,0 +1,324 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// ErrNoRoute is returned when no channel can take a payment: every channel
+// is disabled, has an open circuit breaker, does not accept the amount or is
+// at its daily cap.
+var ErrNoRoute = errors.New("no payment channel can take the payment")
+
+type routingStore interface {
+	States(ctx context.Context) (map[string]ChannelState, error)
+	ToggleDisabled(ctx context.Context, code string, actorID int64, at time.Time) (ChannelState, error)
+	OpenBreaker(ctx context.Context, code string, until time.Time, reason string, at time.Time) error
+	RecordOutcome(ctx context.Context, code string, success bool, at time.Time) error
+	Outcomes(ctx context.Context, since time.Time) (map[string]Outcomes, error)
+	ReserveVolume(ctx context.Context, code string, day time.Time, currency string, amount, dailyCap int64) error
+	ReleaseVolume(ctx context.Context, code string, day time.Time, currency string, amount int64) error
+	Volumes(ctx context.Context, day time.Time) ([]Volume, error)
+}
+
+// ChannelHealth is a channel's routing view for /channels.
+type ChannelHealth struct {
+	Entry
+	State    ChannelState
+	Outcomes Outcomes
+	Volume   []Volume
+}
+
+// Router picks the channels for each order. Channel state, outcomes and
+// volume live in the shared store so all instances agree on which channels
+// are usable; the weighted round-robin position is kept per instance.
+type Router struct {
+	channels *Registry
+	store    routingStore
+	policy   config.PaymentRouting
+	logger   *logrus.Entry
+	now      func() time.Time
+
+	mu      sync.Mutex
+	current map[string]int
+}
+
+// NewRouter constructs a Router over the registered channels. policy tunes
+// the circuit breaker.
+func NewRouter(channels *Registry, store routingStore, policy config.PaymentRouting, logger *logrus.Entry) *Router {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Router{
+		channels: channels,
+		store:    store,
+		policy:   policy,
+		logger:   logger,
+		now:      time.Now,
+		current:  make(map[string]int),
+	}
+}
+
+func (r *Router) check(ctx context.Context) error {
+	if r == nil || r.channels == nil || r.store == nil {
+		return errors.New("payment router is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
+
+// Route returns the channels that may take a payment of amount, in the order
+// they should be tried. The first is picked by smooth weighted round-robin;
+// the others follow as failover by descending weight. Channels with weight
+// zero are only used for failover.
+func (r *Router) Route(ctx context.Context, amount int64) ([]Entry, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	states, err := r.store.States(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	var eligible []Entry
+	for _, entry := range r.channels.Entries() {
+		state := states[entry.Code]
+		if state.Disabled || state.BreakerOpen(now) || !entry.Accepts(amount) {
+			continue
+		}
+		eligible = append(eligible, entry)
+	}
+	if len(eligible) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	first := r.pick(eligible)
+	failover := make([]Entry, 0, len(eligible))
+	for i, entry := range eligible {
+		if i != first {
+			failover = append(failover, entry)
+		}
+	}
+	sort.SliceStable(failover, func(i, j int) bool { return failover[i].Weight > failover[j].Weight })
+	if first < 0 {
+		return failover, nil
+	}
+
+	return append([]Entry{eligible[first]}, failover...), nil
+}
+
+// pick advances the smooth weighted round-robin over the eligible channels
+// and returns the index of the chosen one, or -1 when all weights are zero.
+func (r *Router) pick(eligible []Entry) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	best, total := -1, 0
+	for i, entry := range eligible {
+		if entry.Weight <= 0 {
+			continue
+		}
+		r.current[entry.Code] += entry.Weight
+		total += entry.Weight
+		if best < 0 || r.current[entry.Code] > r.current[eligible[best].Code] {
+			best = i
+		}
+	}
+	if best >= 0 {
+		r.current[eligible[best].Code] -= total
+	}
+
+	return best
+}
+
+// Reserve counts amount against the channel's daily cap for today (UTC). It
+// returns ErrDailyCapReached when the channel cannot take the amount today.
+func (r *Router) Reserve(ctx context.Context, entry Entry, amount int64, currency string) (Volume, error) {
+	if err := r.check(ctx); err != nil {
+		return Volume{}, err
+	}
+
+	reserved := Volume{Code: entry.Code, Day: utcDay(r.now()), Currency: currency, AmountMinor: amount}
+	if err := r.store.ReserveVolume(ctx, entry.Code, reserved.Day, currency, amount, entry.DailyCap); err != nil {
+		return Volume{}, err
+	}
+
+	return reserved, nil
+}
+
+// Release returns a reservation for a payment the channel did not create.
+// Failures are logged; the volume is then overstated until the day ends.
+func (r *Router) Release(ctx context.Context, reserved Volume) {
+	if err := r.check(ctx); err != nil {
+		return
+	}
+
+	if err := r.store.ReleaseVolume(ctx, reserved.Code, reserved.Day, reserved.Currency, reserved.AmountMinor); err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":        "channel_volume_release_failed",
+			"channel":      reserved.Code,
+			"currency":     reserved.Currency,
+			"amount_minor": reserved.AmountMinor,
+		}).WithError(err).Warn("failed to release channel volume")
+	}
+}
+
+// RecordOutcome counts a payment creation attempt and opens the channel's
+// circuit breaker when its failure rate over the window reaches the
+// threshold. Store failures are logged so they never fail the payment.
+func (r *Router) RecordOutcome(ctx context.Context, code string, success bool) {
+	if err := r.check(ctx); err != nil {
+		return
+	}
+
+	now := r.now()
+	if err := r.store.RecordOutcome(ctx, code, success, now); err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   "channel_outcome_record_failed",
+			"channel": code,
+			"success": success,
+		}).WithError(err).Warn("failed to record channel outcome")
+		return
+	}
+	if success {
+		return
+	}
+
+	if err := r.checkBreaker(ctx, code, now); err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   "channel_breaker_check_failed",
+			"channel": code,
+		}).WithError(err).Warn("failed to evaluate channel circuit breaker")
+	}
+}
+
+func (r *Router) checkBreaker(ctx context.Context, code string, now time.Time) error {
+	states, err := r.store.States(ctx)
+	if err != nil {
+		return err
+	}
+	state := states[code]
+	if state.BreakerOpen(now) {
+		return nil
+	}
+
+	// Failures from before the breaker last closed were already acted on.
+	since := now.Add(-r.policy.Window)
+	if state.BreakerOpenUntil != nil && state.BreakerOpenUntil.After(since) {
+		since = *state.BreakerOpenUntil
+	}
+
+	outcomes, err := r.store.Outcomes(ctx, since)
+	if err != nil {
+		return err
+	}
+	counted := outcomes[code]
+	if counted.Total() < int64(r.policy.MinSamples) || counted.FailurePercent() < int64(r.policy.FailureRatePercent) {
+		return nil
+	}
+
+	until := now.Add(r.policy.Cooldown)
+	reason := fmt.Sprintf("%d%% of %d payments failed", counted.FailurePercent(), counted.Total())
+	if err := r.store.OpenBreaker(ctx, code, until, reason, now); err != nil {
+		return err
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":        "channel_breaker_opened",
+		"channel":      code,
+		"failures":     counted.Failures,
+		"attempts":     counted.Total(),
+		"open_until":   until.UTC().Format(time.RFC3339),
+		"failure_rate": counted.FailurePercent(),
+	}).Warn("opened channel circuit breaker")
+
+	return nil
+}
+
+// Toggle enables a disabled channel or disables an enabled one on behalf of
+// actorID. Enabling also closes the circuit breaker.
+func (r *Router) Toggle(ctx context.Context, code string, actorID int64) (ChannelState, error) {
+	if err := r.check(ctx); err != nil {
+		return ChannelState{}, err
+	}
+
+	entry, ok := r.channels.Get(code)
+	if !ok {
+		return ChannelState{}, fmt.Errorf("%w: %s", ErrUnknownChannel, code)
+	}
+
+	state, err := r.store.ToggleDisabled(ctx, entry.Code, actorID, r.now())
+	if err != nil {
+		return ChannelState{}, err
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":    "channel_toggled",
+		"channel":  entry.Code,
+		"disabled": state.Disabled,
+		"user_id":  actorID,
+	}).Info("toggled payment channel")
+
+	return state, nil
+}
+
+// Health returns every registered channel with its state, outcomes over the
+// routing window and today's volume.
+func (r *Router) Health(ctx context.Context) ([]ChannelHealth, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	states, err := r.store.States(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outcomes, err := r.store.Outcomes(ctx, now.Add(-r.policy.Window))
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := r.store.Volumes(ctx, utcDay(now))
+	if err != nil {
+		return nil, err
+	}
+
+	byCode := make(map[string][]Volume)
+	for _, volume := range volumes {
+		byCode[volume.Code] = append(byCode[volume.Code], volume)
+	}
+
+	entries := r.channels.Entries()
+	health := make([]ChannelHealth, 0, len(entries))
+	for _, entry := range entries {
+		health = append(health, ChannelHealth{
+			Entry:    entry,
+			State:    states[entry.Code],
+			Outcomes: outcomes[entry.Code],
+			Volume:   byCode[entry.Code],
+		})
+	}
+
+	return health, nil
+}
+
+// utcDay returns the start of t's day in UTC, the key daily caps reset on.
+func utcDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,216 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/config"
+)
+
+var testPolicy = config.PaymentRouting{Window: 15 * time.Minute, MinSamples: 4, FailureRatePercent: 50, Cooldown: 5 * time.Minute}
+
+func TestRouteWeightedRoundRobinWithFailover(t *testing.T) {
+	registry := &Registry{}
+	for _, entry := range []Entry{
+		{Code: "alpha", Weight: 3},
+		{Code: "beta", Weight: 1},
+		{Code: "backup", Weight: 0},
+	} {
+		entry.Adapter, entry.Channel = "fake", &fakeChannel{}
+		if err := registry.Register(entry); err != nil {
+			t.Fatalf("register channel: %v", err)
+		}
+	}
+	router := newTestRouter(registry, newFakeRouting())
+	ctx := context.Background()
+
+	var picks []string
+	for i := 0; i < 4; i++ {
+		candidates, err := router.Route(ctx, 100)
+		if err != nil {
+			t.Fatalf("Route returned error: %v", err)
+		}
+		picks = append(picks, candidates[0].Code)
+		if i == 0 && routeCodes(candidates) != "alpha,beta,backup" {
+			t.Fatalf("expected failover by weight, got %s", routeCodes(candidates))
+		}
+	}
+	if got := strings.Join(picks, ","); got != "alpha,alpha,beta,alpha" {
+		t.Fatalf("expected smooth 3:1 rotation, got %s", got)
+	}
+}
+
+func TestRouteSkipsUnusableChannels(t *testing.T) {
+	registry := &Registry{}
+	for _, entry := range []Entry{
+		{Code: "off", Weight: 5},
+		{Code: "tripped", Weight: 5},
+		{Code: "small", Weight: 5, MaxAmount: 1000},
+		{Code: "big", Weight: 1, MinAmount: 500},
+	} {
+		entry.Adapter, entry.Channel = "fake", &fakeChannel{}
+		if err := registry.Register(entry); err != nil {
+			t.Fatalf("register channel: %v", err)
+		}
+	}
+	routing := newFakeRouting()
+	router := newTestRouter(registry, routing)
+	until := router.now().Add(time.Minute)
+	routing.states["off"] = ChannelState{Code: "off", Disabled: true}
+	routing.states["tripped"] = ChannelState{Code: "tripped", BreakerOpenUntil: &until}
+	ctx := context.Background()
+
+	for amount, want := range map[int64]string{100: "small", 700: "small,big", 5000: "big"} {
+		candidates, err := router.Route(ctx, amount)
+		if err != nil || routeCodes(candidates) != want {
+			t.Fatalf("Route(%d): expected %s, got %s err=%v", amount, want, routeCodes(candidates), err)
+		}
+	}
+
+	routing.states["big"] = ChannelState{Code: "big", Disabled: true}
+	if _, err := router.Route(ctx, 5000); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("expected ErrNoRoute, got %v", err)
+	}
+
+	past := router.now().Add(-time.Second)
+	routing.states["tripped"] = ChannelState{Code: "tripped", BreakerOpenUntil: &past}
+	if candidates, _ := router.Route(ctx, 5000); routeCodes(candidates) != "tripped" {
+		t.Fatalf("expected channel back after the cooldown, got %s", routeCodes(candidates))
+	}
+}
+
+func TestRecordOutcomeOpensBreaker(t *testing.T) {
+	routing := newFakeRouting()
+	router := newTestRouter(testRegistry(t, &fakeChannel{}), routing)
+	ctx := context.Background()
+
+	router.RecordOutcome(ctx, "mock", true)
+	router.RecordOutcome(ctx, "mock", false)
+	router.RecordOutcome(ctx, "mock", false)
+	if routing.states["mock"].BreakerOpenUntil != nil {
+		t.Fatalf("expected breaker to stay closed below the minimum samples")
+	}
+
+	router.RecordOutcome(ctx, "mock", false)
+	state := routing.states["mock"]
+	if !state.BreakerOpen(router.now()) || !state.BreakerOpenUntil.Equal(router.now().Add(testPolicy.Cooldown)) {
+		t.Fatalf("expected breaker open for the cooldown, got %+v", state)
+	}
+	if state.BreakerReason != "75% of 4 payments failed" {
+		t.Fatalf("unexpected breaker reason %q", state.BreakerReason)
+	}
+	if _, err := router.Route(ctx, 100); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("expected tripped channel to leave no route, got %v", err)
+	}
+
+	disabled, err := router.Toggle(ctx, "MOCK", 5)
+	if err != nil || !disabled.Disabled || disabled.ToggledBy != 5 {
+		t.Fatalf("expected channel to be disabled, got %+v err=%v", disabled, err)
+	}
+	enabled, err := router.Toggle(ctx, "mock", 5)
+	if err != nil || enabled.Disabled || enabled.BreakerOpenUntil != nil {
+		t.Fatalf("expected enabling to reset the breaker, got %+v err=%v", enabled, err)
+	}
+	if _, err := router.Toggle(ctx, "nope", 5); !errors.Is(err, ErrUnknownChannel) {
+		t.Fatalf("expected unknown channel error, got %v", err)
+	}
+}
+
+func newTestRouter(registry *Registry, routing *fakeRouting) *Router {
+	router := NewRouter(registry, routing, testPolicy, logrus.NewEntry(logrus.New()))
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	router.now = func() time.Time { return now }
+	return router
+}
+
+func routeCodes(entries []Entry) string {
+	codes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		codes = append(codes, entry.Code)
+	}
+	return strings.Join(codes, ",")
+}
+
+// fakeRouting keeps routing state in memory. Outcomes ignores the window
+// start and returns everything recorded.
+type fakeRouting struct {
+	states   map[string]ChannelState
+	outcomes map[string]Outcomes
+	volume   map[string]int64
+}
+
+func newFakeRouting() *fakeRouting {
+	return &fakeRouting{
+		states:   make(map[string]ChannelState),
+		outcomes: make(map[string]Outcomes),
+		volume:   make(map[string]int64),
+	}
+}
+
+func (f *fakeRouting) States(context.Context) (map[string]ChannelState, error) {
+	states := make(map[string]ChannelState, len(f.states))
+	for code, state := range f.states {
+		states[code] = state
+	}
+	return states, nil
+}
+
+func (f *fakeRouting) ToggleDisabled(_ context.Context, code string, actorID int64, at time.Time) (ChannelState, error) {
+	state := f.states[code]
+	state.Code, state.Disabled, state.ToggledBy, state.ToggledAt = code, !state.Disabled, actorID, &at
+	if !state.Disabled {
+		state.BreakerOpenUntil, state.BreakerReason = nil, ""
+	}
+	f.states[code] = state
+	return state, nil
+}
+
+func (f *fakeRouting) OpenBreaker(_ context.Context, code string, until time.Time, reason string, _ time.Time) error {
+	state := f.states[code]
+	state.Code, state.BreakerOpenUntil, state.BreakerReason = code, &until, reason
+	f.states[code] = state
+	return nil
+}
+
+func (f *fakeRouting) RecordOutcome(_ context.Context, code string, success bool, _ time.Time) error {
+	outcomes := f.outcomes[code]
+	if success {
+		outcomes.Successes++
+	} else {
+		outcomes.Failures++
+	}
+	f.outcomes[code] = outcomes
+	return nil
+}
+
+func (f *fakeRouting) Outcomes(context.Context, time.Time) (map[string]Outcomes, error) {
+	return f.outcomes, nil
+}
+
+func (f *fakeRouting) ReserveVolume(_ context.Context, code string, _ time.Time, currency string, amount, dailyCap int64) error {
+	key := code + "/" + currency
+	if dailyCap > 0 && f.volume[key]+amount > dailyCap {
+		return ErrDailyCapReached
+	}
+	f.volume[key] += amount
+	return nil
+}
+
+func (f *fakeRouting) ReleaseVolume(_ context.Context, code string, _ time.Time, currency string, amount int64) error {
+	f.volume[code+"/"+currency] -= amount
+	return nil
+}
+
+func (f *fakeRouting) Volumes(_ context.Context, day time.Time) ([]Volume, error) {
+	var volumes []Volume
+	for key, amount := range f.volume {
+		code, currency, _ := strings.Cut(key, "/")
+		volumes = append(volumes, Volume{Code: code, Day: day, Currency: currency, AmountMinor: amount})
+	}
+	return volumes, nil
+}
@@ -0,0 +1,443 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/audit"
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// CallbackPath is the callback listener path channels post notifications to;
+// the channel code follows it.
+const CallbackPath = "/callbacks/"
+
+// ErrUnknownChannel is returned for channel codes with no registered adapter.
+var ErrUnknownChannel = errors.New("unknown payment channel")
+
+// ErrPaymentUnconfirmed is returned by CreatePayment when the channel failed
+// without a definitive answer and could not say whether it registered the
+// payment. The order is left pending for callbacks or /payment_status to
+// settle.
+var ErrPaymentUnconfirmed = errors.New("payment channel did not confirm the payment")
+
+type orderStore interface {
+	Create(ctx context.Context, order domain.Order) (domain.Order, error)
+	GetByID(ctx context.Context, orderID string) (domain.Order, error)
+	Transition(ctx context.Context, t domain.OrderTransition) (domain.Order, error)
+	SetChannelRef(ctx context.Context, orderID, channelRef string) (domain.Order, error)
+	ClaimRefund(ctx context.Context, orderID string) (domain.Order, error)
+	ReleaseRefund(ctx context.Context, orderID string) error
+}
+
+type merchantReader interface {
+	GetByGroupChatID(ctx context.Context, chatID int64) (domain.Merchant, error)
+}
+
+// auditRecorder writes channel refunds, including refused ones, to the audit
+// trail.
+type auditRecorder interface {
+	Record(ctx context.Context, entry audit.Entry)
+}
+
+// RefundDeniedError is returned by Refund when the order cannot be refunded
+// through its channel. Reason is a short code for the audit trail.
+type RefundDeniedError struct {
+	OrderID string
+	Reason  string
+	Message string
+}
+
+func (e *RefundDeniedError) Error() string {
+	return fmt.Sprintf("order %s cannot be refunded: %s", e.OrderID, e.Reason)
+}
+
+// Order describes a payment a merchant requests; the router picks the
+// channel.
+type Order struct {
+	MerchantID  string
+	AmountMinor int64
+	Currency    string
+	Description string
+}
+
+// Service creates, queries and refunds orders through the registered channel
+// adapters.
+type Service struct {
+	orders        orderStore
+	merchants     merchantReader
+	channels      *Registry
+	router        *Router
+	audit         auditRecorder
+	notifyBaseURL string
+	logger        *logrus.Entry
+}
+
+// NewService constructs a Service. notifyBaseURL is the public base URL of
+// the callback listener and may be empty; audit may be nil when no audit
+// trail is kept.
+func NewService(orders orderStore, merchants merchantReader, channels *Registry, router *Router, audit auditRecorder, notifyBaseURL string, logger *logrus.Entry) *Service {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return &Service{
+		orders:        orders,
+		merchants:     merchants,
+		channels:      channels,
+		router:        router,
+		audit:         audit,
+		notifyBaseURL: strings.TrimRight(notifyBaseURL, "/"),
+		logger:        logger,
+	}
+}
+
+func (s *Service) check(ctx context.Context) error {
+	if s == nil || s.orders == nil || s.merchants == nil || s.channels == nil || s.router == nil {
+		return errors.New("payment service is not initialized")
+	}
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+
+	return nil
+}
+
+// CreatePayment routes the order to a channel, records the adapter and
+// credential set that handle it, and registers it with the channel. The
+// order is pending when the channel accepted it. A channel that declines
+// leaves a failed order behind and the next routed channel is tried with a
+// new order; when all decline, the last failed order is returned with the
+// joined errors. Other channel errors may hide a payment the channel did
+// register, so the channel is asked about the order instead of failing over;
+// when it cannot tell, the order is left pending with ErrPaymentUnconfirmed.
+func (s *Service) CreatePayment(ctx context.Context, req Order) (domain.Order, Payment, error) {
+	if err := s.check(ctx); err != nil {
+		return domain.Order{}, Payment{}, err
+	}
+
+	candidates, err := s.router.Route(ctx, req.AmountMinor)
+	if err != nil {
+		return domain.Order{}, Payment{}, err
+	}
+
+	var (
+		last     domain.Order
+		failures []error
+	)
+	for _, entry := range candidates {
+		reserved, err := s.router.Reserve(ctx, entry, req.AmountMinor, req.Currency)
+		if errors.Is(err, ErrDailyCapReached) {
+			continue
+		}
+		if err != nil {
+			return last, Payment{}, err
+		}
+
+		created, err := s.orders.Create(ctx, domain.Order{
+			MerchantID:    req.MerchantID,
+			AmountMinor:   req.AmountMinor,
+			Currency:      req.Currency,
+			Channel:       entry.Code,
+			Adapter:       entry.Adapter,
+			CredentialSet: entry.CredentialSet,
+		})
+		if err != nil {
+			s.router.Release(ctx, reserved)
+			return last, Payment{}, err
+		}
+		last = created
+
+		payment, err := entry.Channel.CreatePayment(ctx, PaymentRequest{
+			OrderID:     created.OrderID,
+			AmountMinor: created.AmountMinor,
+			Currency:    created.Currency,
+			Description: req.Description,
+			NotifyURL:   s.notifyURL(entry.Code),
+		})
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, which says nothing about the channel. The
+			// request may have reached it, so the order and the reservation
+			// stay for reconciliation.
+			return created, Payment{}, fmt.Errorf("create payment for order %s on %s: %w", created.OrderID, entry.Code, err)
+		}
+		s.router.RecordOutcome(ctx, entry.Code, err == nil)
+
+		if err != nil && !errors.Is(err, ErrDeclined) {
+			found, registered, queryErr := s.reconcile(ctx, entry, created)
+			switch {
+			case queryErr != nil:
+				return s.leaveUnconfirmed(ctx, entry, created, errors.Join(err, queryErr))
+			case registered:
+				payment, err = found, nil
+			}
+		}
+		if err != nil {
+			s.router.Release(ctx, reserved)
+			failures = append(failures, s.failOrder(ctx, created, entry, err))
+			continue
+		}
+
+		return s.markPending(ctx, entry, created, payment)
+	}
+
+	if len(failures) == 0 {
+		return last, Payment{}, fmt.Errorf("%w: daily volume caps reached", ErrNoRoute)
+	}
+
+	return last, Payment{}, errors.Join(failures...)
+}
+
+// reconcile asks the channel about an order whose creation failed without a
+// definitive answer. registered reports whether the channel holds a live
+// payment for it; a declined query or a failed payment means it does not and
+// the next channel may be tried. err is set when the channel could not tell.
+func (s *Service) reconcile(ctx context.Context, entry Entry, created domain.Order) (Payment, bool, error) {
+	status, err := entry.Channel.QueryStatus(ctx, created.OrderID, "")
+	if errors.Is(err, ErrDeclined) {
+		return Payment{}, false, nil
+	}
+	if err != nil {
+		return Payment{}, false, err
+	}
+	if status.Status == domain.OrderStatusFailed {
+		return Payment{}, false, nil
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "channel_payment_reconciled",
+		"order_id":    created.OrderID,
+		"channel":     entry.Code,
+		"channel_ref": status.ChannelRef,
+		"status":      status.Status,
+	}).Warn("channel registered the payment despite an error")
+
+	return Payment{ChannelRef: status.ChannelRef}, true, nil
+}
+
+// leaveUnconfirmed moves an order the channel may or may not have registered
+// to pending, so a later callback or status query settles it, and returns
+// ErrPaymentUnconfirmed. The volume reservation is kept.
+func (s *Service) leaveUnconfirmed(ctx context.Context, entry Entry, created domain.Order, cause error) (domain.Order, Payment, error) {
+	s.logger.WithFields(logging.Fields{
+		"event":       "channel_payment_unconfirmed",
+		"order_id":    created.OrderID,
+		"merchant_id": created.MerchantID,
+		"channel":     entry.Code,
+		"adapter":     entry.Adapter,
+	}).WithError(cause).Warn("channel did not confirm the payment")
+
+	pending, err := s.orders.Transition(ctx, domain.OrderTransition{
+		OrderID: created.OrderID,
+		From:    domain.OrderStatusCreated,
+		To:      domain.OrderStatusPending,
+		Reason:  "channel_payment_unconfirmed",
+	})
+	var conflict *domain.StatusConflictError
+	if err != nil && !errors.As(err, &conflict) {
+		cause = errors.Join(cause, err)
+		pending = created
+	}
+
+	return pending, Payment{}, fmt.Errorf("%w: order %s on %s: %w", ErrPaymentUnconfirmed, created.OrderID, entry.Code, cause)
+}
+
+// failOrder marks an order the channel declined as failed and returns the
+// channel error annotated with the order and channel.
+func (s *Service) failOrder(ctx context.Context, created domain.Order, entry Entry, err error) error {
+	if _, failErr := s.orders.Transition(ctx, domain.OrderTransition{
+		OrderID: created.OrderID,
+		From:    domain.OrderStatusCreated,
+		To:      domain.OrderStatusFailed,
+		Reason:  "channel_create_failed",
+	}); failErr != nil {
+		err = errors.Join(err, failErr)
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":       "channel_payment_failed",
+		"order_id":    created.OrderID,
+		"merchant_id": created.MerchantID,
+		"channel":     entry.Code,
+		"adapter":     entry.Adapter,
+	}).WithError(err).Warn("channel failed to create payment")
+
+	return fmt.Errorf("create payment for order %s on %s: %w", created.OrderID, entry.Code, err)
+}
+
+// markPending moves an order the channel accepted to pending.
+func (s *Service) markPending(ctx context.Context, entry Entry, created domain.Order, payment Payment) (domain.Order, Payment, error) {
+	pending, err := s.orders.Transition(ctx, domain.OrderTransition{
+		OrderID:    created.OrderID,
+		From:       domain.OrderStatusCreated,
+		To:         domain.OrderStatusPending,
+		ChannelRef: payment.ChannelRef,
+		Reason:     "channel_payment_created",
+	})
+	var conflict *domain.StatusConflictError
+	if errors.As(err, &conflict) {
+		// A fast callback already moved the order on; the payment exists
+		// either way, and refunds need its reference.
+		if payment.ChannelRef == "" || pending.ChannelRef != "" {
+			return pending, payment, nil
+		}
+		updated, err := s.orders.SetChannelRef(ctx, created.OrderID, payment.ChannelRef)
+		if err != nil {
+			return pending, payment, fmt.Errorf("record channel_ref for order %s: %w", created.OrderID, err)
+		}
+		return updated, payment, nil
+	}
+	if err != nil {
+		return created, payment, err
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":          "channel_payment_created",
+		"order_id":       pending.OrderID,
+		"merchant_id":    pending.MerchantID,
+		"amount_minor":   pending.AmountMinor,
+		"currency":       pending.Currency,
+		"channel":        entry.Code,
+		"adapter":        entry.Adapter,
+		"credential_set": entry.CredentialSet,
+		"channel_ref":    payment.ChannelRef,
+	}).Info("created channel payment")
+
+	return pending, payment, nil
+}
+
+// QueryStatus asks the order's channel for the payment status. The order is
+// not changed; callbacks remain the source of status transitions.
+func (s *Service) QueryStatus(ctx context.Context, found domain.Order) (PaymentStatus, error) {
+	if err := s.check(ctx); err != nil {
+		return PaymentStatus{}, err
+	}
+
+	entry, ok := s.channels.Get(found.Channel)
+	if !ok {
+		return PaymentStatus{}, fmt.Errorf("%w: %s", ErrUnknownChannel, found.Channel)
+	}
+
+	return entry.Channel.QueryStatus(ctx, found.OrderID, found.ChannelRef)
+}
+
+// Refund returns a paid order's amount through its channel and marks the
+// order refunded. The channel must still be served by the credential set
+// that took the payment; ineligible orders yield a *RefundDeniedError.
+func (s *Service) Refund(ctx context.Context, found domain.Order) (Refund, error) {
+	if err := s.check(ctx); err != nil {
+		return Refund{}, err
+	}
+
+	entry, denied := s.refundEntry(found)
+	if denied != nil {
+		return Refund{}, denied
+	}
+
+	// Claim the order before asking the channel so concurrent /refund
+	// commands cannot refund the same payment twice.
+	current, err := s.orders.ClaimRefund(ctx, found.OrderID)
+	switch {
+	case errors.Is(err, domain.ErrRefundInProgress):
+		return Refund{}, &RefundDeniedError{OrderID: found.OrderID, Reason: "in_progress",
+			Message: fmt.Sprintf("A refund of order %s is already in progress.", found.OrderID)}
+	case errors.Is(err, domain.ErrOrderStatusConflict):
+		return Refund{}, &RefundDeniedError{OrderID: found.OrderID, Reason: "not_paid",
+			Message: fmt.Sprintf("Order %s is %s; only paid orders can be refunded.", found.OrderID, current.Status)}
+	case err != nil:
+		return Refund{}, fmt.Errorf("claim refund: %w", err)
+	}
+
+	refund, err := entry.Channel.Refund(ctx, RefundRequest{
+		OrderID:        found.OrderID,
+		ChannelRef:     found.ChannelRef,
+		AmountMinor:    found.AmountMinor,
+		IdempotencyKey: RefundIdempotencyKey(found.OrderID),
+	})
+	if err != nil {
+		// The idempotency key lets the channel recognize a retry of a refund
+		// it did carry out, so the claim is released for another attempt.
+		if releaseErr := s.orders.ReleaseRefund(context.WithoutCancel(ctx), found.OrderID); releaseErr != nil {
+			s.logger.WithFields(logging.Fields{
+				"event":    "channel_refund_release_failed",
+				"order_id": found.OrderID,
+				"channel":  entry.Code,
+			}).WithError(releaseErr).Error("failed to release refund claim")
+		}
+		return Refund{}, err
+	}
+
+	// The money is back with the payer at this point, so a failure to
+	// record it is logged with the refund reference for reconciliation.
+	if _, err := s.orders.Transition(ctx, domain.OrderTransition{
+		OrderID: found.OrderID,
+		From:    domain.OrderStatusPaid,
+		To:      domain.OrderStatusRefunded,
+		Reason:  "channel_refund",
+	}); err != nil {
+		s.logger.WithFields(logging.Fields{
+			"event":      "channel_refund_record_failed",
+			"order_id":   found.OrderID,
+			"channel":    entry.Code,
+			"refund_ref": refund.RefundRef,
+		}).WithError(err).Error("refunded payment but failed to update the order")
+		return refund, fmt.Errorf("record refund %s for order %s: %w", refund.RefundRef, found.OrderID, err)
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"event":          "channel_refunded",
+		"order_id":       found.OrderID,
+		"merchant_id":    found.MerchantID,
+		"amount_minor":   found.AmountMinor,
+		"channel":        entry.Code,
+		"credential_set": entry.CredentialSet,
+		"refund_ref":     refund.RefundRef,
+	}).Info("refunded channel payment")
+
+	return refund, nil
+}
+
+// refundEntry returns the channel that refunds the order, or why it cannot.
+func (s *Service) refundEntry(found domain.Order) (Entry, *RefundDeniedError) {
+	deny := func(reason, format string, args ...any) (Entry, *RefundDeniedError) {
+		return Entry{}, &RefundDeniedError{OrderID: found.OrderID, Reason: reason, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if found.Adapter == "" {
+		return deny("no_adapter", "Order %s was not paid through a payment channel.", found.OrderID)
+	}
+	if found.Status != domain.OrderStatusPaid {
+		return deny("not_paid", "Order %s is %s; only paid orders can be refunded.", found.OrderID, found.Status)
+	}
+	entry, ok := s.channels.Get(found.Channel)
+	if !ok {
+		return deny("channel_removed", "Channel %s is no longer configured.", found.Channel)
+	}
+	if entry.Adapter != found.Adapter || entry.CredentialSet != found.CredentialSet {
+		return deny("credentials_changed", "Order %s was paid through %s with credential set %s, but the channel now uses %s with %s.",
+			found.OrderID, found.Adapter, found.CredentialSet, entry.Adapter, entry.CredentialSet)
+	}
+
+	return entry, nil
+}
+
+// notifyURL is where the channel posts callbacks, or empty when no public
+// callback URL is configured.
+func (s *Service) notifyURL(code string) string {
+	if s.notifyBaseURL == "" {
+		return ""
+	}
+
+	return s.notifyBaseURL + CallbackPath + code
+}
+
+func (s *Service) record(ctx context.Context, entry audit.Entry) {
+	if s.audit != nil {
+		s.audit.Record(ctx, entry)
+	}
+}
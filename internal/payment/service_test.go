@@ -0,0 +1,412 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func TestCreatePaymentRecordsAdapterAndCredentialSet(t *testing.T) {
+	orders := newFakeOrders()
+	channel := &fakeChannel{payment: Payment{ChannelRef: "mock_1", PayURL: "http://stub/pay/mock_1"}}
+	service := newTestService(orders, testRegistry(t, channel), newFakeRouting(), nil, "https://pay.example.com/")
+
+	created, payment, err := service.CreatePayment(context.Background(), Order{MerchantID: "acme", AmountMinor: 1250, Currency: "USD", Description: "coffee"})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	if created.Status != domain.OrderStatusPending || created.Channel != "mock" || created.Adapter != "fake" || created.CredentialSet != "2026-10" || created.ChannelRef != "mock_1" {
+		t.Fatalf("unexpected order %+v", created)
+	}
+	if payment.PayURL != "http://stub/pay/mock_1" {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+	req := channel.created[0]
+	if req.OrderID != created.OrderID || req.AmountMinor != 1250 || req.Description != "coffee" || req.NotifyURL != "https://pay.example.com/callbacks/mock" {
+		t.Fatalf("unexpected payment request %+v", req)
+	}
+
+	channel.err = fmt.Errorf("%w: merchant disabled", ErrDeclined)
+	failed, _, err := service.CreatePayment(context.Background(), Order{MerchantID: "acme", AmountMinor: 500, Currency: "USD"})
+	if !errors.Is(err, ErrDeclined) {
+		t.Fatalf("expected declined error, got %v", err)
+	}
+	if got := orders.items[failed.OrderID].Status; got != domain.OrderStatusFailed {
+		t.Fatalf("expected declined order to be failed, got %q", got)
+	}
+}
+
+func TestCreatePaymentKeepsChannelRefWhenCallbackWinsTheRace(t *testing.T) {
+	orders := newFakeOrders()
+	orders.onCreate = func(order domain.Order) {
+		order.Status = domain.OrderStatusPaid
+		orders.items[order.OrderID] = order
+	}
+	channel := &fakeChannel{payment: Payment{ChannelRef: "mock_1"}}
+	service := newTestService(orders, testRegistry(t, channel), newFakeRouting(), nil, "")
+
+	created, _, err := service.CreatePayment(context.Background(), Order{MerchantID: "acme", AmountMinor: 1250, Currency: "USD"})
+	if err != nil {
+		t.Fatalf("CreatePayment returned error: %v", err)
+	}
+	if created.Status != domain.OrderStatusPaid || created.ChannelRef != "mock_1" || orders.items[created.OrderID].ChannelRef != "mock_1" {
+		t.Fatalf("expected the paid order to keep the channel_ref, got %+v", created)
+	}
+}
+
+func TestCreatePaymentFailsOverAndTracksVolume(t *testing.T) {
+	orders := newFakeOrders()
+	// The primary fails ambiguously, then reports it has no such payment.
+	primary := &fakeChannel{err: errors.New("connection refused"), queryErr: fmt.Errorf("%w: payment not found", ErrDeclined)}
+	secondary := &fakeChannel{payment: Payment{ChannelRef: "sec_1"}}
+	registry := &Registry{}
+	for _, entry := range []Entry{
+		{Code: "primary", Adapter: "fake", Channel: primary, Weight: 1},
+		{Code: "secondary", Adapter: "fake", Channel: secondary, DailyCap: 2000},
+	} {
+		if err := registry.Register(entry); err != nil {
+			t.Fatalf("register channel: %v", err)
+		}
+	}
+	routing := newFakeRouting()
+	service := newTestService(orders, registry, routing, nil, "")
+	ctx := context.Background()
+
+	created, _, err := service.CreatePayment(ctx, Order{MerchantID: "acme", AmountMinor: 1500, Currency: "USD"})
+	if err != nil || created.Channel != "secondary" || created.Status != domain.OrderStatusPending {
+		t.Fatalf("expected failover to secondary, got %+v err=%v", created, err)
+	}
+	if len(orders.items) != 2 || orders.items["ord_test0"].Status != domain.OrderStatusFailed || orders.items["ord_test0"].Channel != "primary" {
+		t.Fatalf("expected a failed order on primary, got %+v", orders.items)
+	}
+	if routing.volume["primary/USD"] != 0 || routing.volume["secondary/USD"] != 1500 {
+		t.Fatalf("expected volume only on the channel that took the payment, got %v", routing.volume)
+	}
+	if routing.outcomes["primary"].Failures != 1 || routing.outcomes["secondary"].Successes != 1 {
+		t.Fatalf("expected outcomes per channel, got %+v", routing.outcomes)
+	}
+
+	// The secondary cap leaves 500 USD today, so a second 1500 has nowhere
+	// to go once the primary fails again.
+	if _, _, err := service.CreatePayment(ctx, Order{MerchantID: "acme", AmountMinor: 1500, Currency: "USD"}); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected the primary failure once the cap is reached, got %v", err)
+	}
+	routing.states["primary"] = ChannelState{Code: "primary", Disabled: true}
+	if _, _, err := service.CreatePayment(ctx, Order{MerchantID: "acme", AmountMinor: 1500, Currency: "USD"}); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("expected ErrNoRoute when every cap is reached, got %v", err)
+	}
+}
+
+func TestCreatePaymentReconcilesAmbiguousErrors(t *testing.T) {
+	orders := newFakeOrders()
+	primary := &fakeChannel{err: errors.New("read: connection reset by peer"), queryErr: errors.New("i/o timeout")}
+	secondary := &fakeChannel{payment: Payment{ChannelRef: "sec_1"}}
+	registry := &Registry{}
+	for _, entry := range []Entry{
+		{Code: "primary", Adapter: "fake", Channel: primary, Weight: 1},
+		{Code: "secondary", Adapter: "fake", Channel: secondary},
+	} {
+		if err := registry.Register(entry); err != nil {
+			t.Fatalf("register channel: %v", err)
+		}
+	}
+	routing := newFakeRouting()
+	service := newTestService(orders, registry, routing, nil, "")
+	ctx := context.Background()
+
+	unconfirmed, _, err := service.CreatePayment(ctx, Order{MerchantID: "acme", AmountMinor: 1500, Currency: "USD"})
+	if !errors.Is(err, ErrPaymentUnconfirmed) || unconfirmed.Channel != "primary" || orders.items[unconfirmed.OrderID].Status != domain.OrderStatusPending {
+		t.Fatalf("expected the order to stay pending on primary, got %+v err=%v", unconfirmed, err)
+	}
+	if len(secondary.created) != 0 || routing.volume["primary/USD"] != 1500 {
+		t.Fatalf("expected no failover and a kept reservation, got %d requests and volume %v", len(secondary.created), routing.volume)
+	}
+	if routing.outcomes["primary"].Failures != 1 {
+		t.Fatalf("expected the ambiguous error to count against the channel, got %+v", routing.outcomes)
+	}
+
+	primary.queryErr, primary.status = nil, PaymentStatus{ChannelRef: "pri_2", Status: domain.OrderStatusPending}
+	reconciled, _, err := service.CreatePayment(ctx, Order{MerchantID: "acme", AmountMinor: 1500, Currency: "USD"})
+	if err != nil || reconciled.Channel != "primary" || reconciled.Status != domain.OrderStatusPending || reconciled.ChannelRef != "pri_2" {
+		t.Fatalf("expected the channel's payment to be adopted, got %+v err=%v", reconciled, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	primary.err = context.Canceled
+	if _, _, err := service.CreatePayment(canceled, Order{MerchantID: "acme", AmountMinor: 1500, Currency: "USD"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation to be returned, got %v", err)
+	}
+	if routing.outcomes["primary"].Failures != 2 || len(secondary.created) != 0 {
+		t.Fatalf("expected cancellation not to count or fail over, got %+v", routing.outcomes)
+	}
+}
+
+func TestRefundRequiresTheOrdersCredentialSet(t *testing.T) {
+	orders := newFakeOrders()
+	paid := domain.Order{OrderID: "ord_paid", MerchantID: "acme", AmountMinor: 1250, Currency: "USD", Channel: "mock", Adapter: "fake", CredentialSet: "2026-10", ChannelRef: "mock_1", Status: domain.OrderStatusPaid}
+	orders.items[paid.OrderID] = paid
+	channel := &fakeChannel{refund: Refund{RefundRef: "rf_mock_1"}}
+	service := newTestService(orders, testRegistry(t, channel), newFakeRouting(), nil, "")
+	ctx := context.Background()
+
+	rotated := paid
+	rotated.CredentialSet = "2026-04"
+	var denied *RefundDeniedError
+	if _, err := service.Refund(ctx, rotated); !errors.As(err, &denied) || denied.Reason != "credentials_changed" {
+		t.Fatalf("expected credentials_changed denial, got %v", err)
+	}
+	if len(channel.refunds) != 0 {
+		t.Fatalf("expected no refund request with other credentials, got %+v", channel.refunds)
+	}
+
+	refund, err := service.Refund(ctx, paid)
+	if err != nil || refund.RefundRef != "rf_mock_1" {
+		t.Fatalf("unexpected refund %+v err=%v", refund, err)
+	}
+	if got := channel.refunds[0]; got.OrderID != "ord_paid" || got.ChannelRef != "mock_1" || got.AmountMinor != 1250 || got.IdempotencyKey != "refund:ord_paid" {
+		t.Fatalf("unexpected refund request %+v", got)
+	}
+	if got := orders.items[paid.OrderID].Status; got != domain.OrderStatusRefunded {
+		t.Fatalf("expected order to be refunded, got %q", got)
+	}
+}
+
+func TestRefundClaimsTheOrderBeforeCallingTheChannel(t *testing.T) {
+	orders := newFakeOrders()
+	paid := domain.Order{OrderID: "ord_paid", MerchantID: "acme", AmountMinor: 1250, Currency: "USD", Channel: "mock", Adapter: "fake", CredentialSet: "2026-10", ChannelRef: "mock_1", Status: domain.OrderStatusPaid}
+	orders.items[paid.OrderID] = paid
+	channel := &fakeChannel{refund: Refund{RefundRef: "rf_mock_1"}, err: ErrDeclined}
+	service := newTestService(orders, testRegistry(t, channel), newFakeRouting(), nil, "")
+	ctx := context.Background()
+
+	if _, err := service.Refund(ctx, paid); !errors.Is(err, ErrDeclined) {
+		t.Fatalf("expected declined refund, got %v", err)
+	}
+	if orders.items[paid.OrderID].RefundStartedAt != nil {
+		t.Fatalf("expected a declined refund to release the claim")
+	}
+
+	channel.err = nil
+	channel.gate = make(chan struct{})
+	const callers = 5
+	results := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			_, err := service.Refund(ctx, paid)
+			results <- err
+		}()
+	}
+
+	// Every caller but the one holding the claim is turned away while the
+	// channel has not answered yet.
+	for i := 0; i < callers-1; i++ {
+		var denied *RefundDeniedError
+		if err := <-results; !errors.As(err, &denied) || denied.Reason != "in_progress" {
+			t.Fatalf("expected in_progress denial, got %v", err)
+		}
+	}
+	close(channel.gate)
+	if err := <-results; err != nil {
+		t.Fatalf("expected the claiming caller to refund, got %v", err)
+	}
+
+	if len(channel.refunds) != 2 {
+		t.Fatalf("expected one refund request besides the declined one, got %+v", channel.refunds)
+	}
+	if got := orders.items[paid.OrderID].Status; got != domain.OrderStatusRefunded {
+		t.Fatalf("expected order to be refunded, got %q", got)
+	}
+
+	var denied *RefundDeniedError
+	if _, err := service.Refund(ctx, paid); !errors.As(err, &denied) || denied.Reason != "not_paid" {
+		t.Fatalf("expected a stale paid order to be denied, got %v", err)
+	}
+	if len(channel.refunds) != 2 {
+		t.Fatalf("expected no refund request for a refunded order, got %+v", channel.refunds)
+	}
+}
+
+func newTestService(orders *fakeOrders, registry *Registry, routing *fakeRouting, auditor auditRecorder, notifyBaseURL string) *Service {
+	return NewService(orders, testMerchants(), registry, newTestRouter(registry, routing), auditor, notifyBaseURL, logrus.NewEntry(logrus.New()))
+}
+
+func testRegistry(t *testing.T, channel Channel) *Registry {
+	t.Helper()
+
+	registry := &Registry{}
+	if err := registry.Register(Entry{Code: "mock", Adapter: "fake", CredentialSet: "2026-10", Channel: channel, Weight: 1}); err != nil {
+		t.Fatalf("register channel: %v", err)
+	}
+	return registry
+}
+
+type fakeChannel struct {
+	payment  Payment
+	status   PaymentStatus
+	refund   Refund
+	err      error
+	queryErr error
+
+	// gate, when set, holds refunds until it is closed.
+	gate chan struct{}
+
+	mu      sync.Mutex
+	created []PaymentRequest
+	refunds []RefundRequest
+}
+
+func (f *fakeChannel) CreatePayment(_ context.Context, req PaymentRequest) (Payment, error) {
+	f.created = append(f.created, req)
+	return f.payment, f.err
+}
+
+func (f *fakeChannel) QueryStatus(context.Context, string, string) (PaymentStatus, error) {
+	return f.status, f.queryErr
+}
+
+func (f *fakeChannel) Refund(_ context.Context, req RefundRequest) (Refund, error) {
+	f.mu.Lock()
+	f.refunds = append(f.refunds, req)
+	f.mu.Unlock()
+
+	if f.gate != nil {
+		<-f.gate
+	}
+	return f.refund, f.err
+}
+
+func (f *fakeChannel) VerifyCallback(CallbackRequest) error { return f.err }
+
+func (f *fakeChannel) ParseCallback(CallbackRequest) (Notification, error) {
+	return Notification{}, f.err
+}
+
+type fakeOrders struct {
+	mu     sync.Mutex
+	items  map[string]domain.Order
+	nextID int
+	// onCreate runs after an order is created, standing in for a callback
+	// that arrives before the channel's answer.
+	onCreate func(order domain.Order)
+}
+
+func newFakeOrders() *fakeOrders {
+	return &fakeOrders{items: make(map[string]domain.Order)}
+}
+
+func (f *fakeOrders) Create(_ context.Context, order domain.Order) (domain.Order, error) {
+	f.nextID++
+	order.OrderID = "ord_test" + strings.Repeat("0", f.nextID)
+	order.Channel = domain.NormalizeChannelCode(order.Channel)
+	order.Status = domain.OrderStatusCreated
+	f.items[order.OrderID] = order
+	if f.onCreate != nil {
+		f.onCreate(order)
+	}
+	return order, nil
+}
+
+func (f *fakeOrders) GetByID(_ context.Context, orderID string) (domain.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, ok := f.items[orderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	return order, nil
+}
+
+func (f *fakeOrders) Transition(_ context.Context, t domain.OrderTransition) (domain.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, ok := f.items[t.OrderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	if !domain.CanTransitionOrder(t.From, t.To) {
+		return domain.Order{}, &domain.InvalidTransitionError{OrderID: t.OrderID, From: t.From, To: t.To}
+	}
+	if order.Status != t.From {
+		return order, &domain.StatusConflictError{OrderID: t.OrderID, Expected: t.From, Actual: order.Status}
+	}
+	order.Status = t.To
+	if t.ChannelRef != "" {
+		order.ChannelRef = t.ChannelRef
+	}
+	f.items[t.OrderID] = order
+	return order, nil
+}
+
+func (f *fakeOrders) SetChannelRef(_ context.Context, orderID, channelRef string) (domain.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, ok := f.items[orderID]
+	if !ok {
+		return domain.Order{}, mongo.ErrNoDocuments
+	}
+	if order.ChannelRef == "" {
+		order.ChannelRef = channelRef
+		f.items[orderID] = order
+	}
+	return order, nil
+}
+
+func (f *fakeOrders) ClaimRefund(_ context.Context, orderID string) (domain.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, ok := f.items[orderID]
+	switch {
+	case !ok:
+		return domain.Order{}, mongo.ErrNoDocuments
+	case order.Status != domain.OrderStatusPaid:
+		return order, &domain.StatusConflictError{OrderID: orderID, Expected: domain.OrderStatusPaid, Actual: order.Status}
+	case order.RefundStartedAt != nil:
+		return order, domain.ErrRefundInProgress
+	}
+	now := time.Now()
+	order.RefundStartedAt = &now
+	f.items[orderID] = order
+	return order, nil
+}
+
+func (f *fakeOrders) ReleaseRefund(_ context.Context, orderID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if order, ok := f.items[orderID]; ok && order.Status == domain.OrderStatusPaid {
+		order.RefundStartedAt = nil
+		f.items[orderID] = order
+	}
+	return nil
+}
+
+type fakeMerchants map[int64]domain.Merchant
+
+func (f fakeMerchants) GetByGroupChatID(_ context.Context, chatID int64) (domain.Merchant, error) {
+	merchant, ok := f[chatID]
+	if !ok {
+		return domain.Merchant{}, mongo.ErrNoDocuments
+	}
+	return merchant, nil
+}
+
+func testMerchants() fakeMerchants {
+	return fakeMerchants{
+		-100: {MerchantID: "acme", Name: "Acme", Status: domain.MerchantStatusActive},
+		-300: {MerchantID: "paused", Name: "Paused", Status: domain.MerchantStatusSuspended},
+	}
+}
@@ -0,0 +1,58 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SignatureParam is the form field carrying the notification signature.
+const SignatureParam = "sign"
+
+// Canonicalize renders the parameters as key=value pairs sorted by key and
+// joined with "&". The signature field and empty values are skipped; only the
+// first value of repeated keys is used.
+func Canonicalize(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key == SignatureParam || params.Get(key) == "" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+params.Get(key))
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// Sign returns the lowercase hex HMAC-SHA256 of the canonicalized parameters.
+func Sign(secret string, params url.Values) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(Canonicalize(params)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the parameters carry a valid signature for secret.
+func Verify(secret string, params url.Values) bool {
+	if secret == "" {
+		return false
+	}
+
+	got, err := hex.DecodeString(strings.ToLower(strings.TrimSpace(params.Get(SignatureParam))))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+
+	want, _ := hex.DecodeString(Sign(secret, params))
+
+	return hmac.Equal(got, want)
+}
@@ -0,0 +1,38 @@
+package payment
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testSecret = "mock-secret"
+
+func TestSignAndVerify(t *testing.T) {
+	params := url.Values{
+		"order_id": {"ord_1"},
+		"amount":   {"100"},
+		"status":   {"paid"},
+		"empty":    {""},
+	}
+
+	if got := Canonicalize(params); got != "amount=100&order_id=ord_1&status=paid" {
+		t.Fatalf("unexpected canonical form %q", got)
+	}
+
+	params.Set(SignatureParam, strings.ToUpper(Sign(testSecret, params)))
+	if !Verify(testSecret, params) {
+		t.Fatalf("expected signature to verify regardless of hex case")
+	}
+	if Verify("other", params) {
+		t.Fatalf("expected signature to fail with another secret")
+	}
+
+	params.Set("amount", "1000")
+	if Verify(testSecret, params) {
+		t.Fatalf("expected tampered params to fail verification")
+	}
+	if Verify(testSecret, url.Values{"order_id": {"ord_1"}}) {
+		t.Fatalf("expected missing signature to fail verification")
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+type recipientCollection interface {
+	countCollection
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+}
+
+// Recipients pages through broadcast audiences in chat ID order: users who
+// have not blocked the bot, and groups the bot is still a member of.
+type Recipients struct {
+	users  recipientCollection
+	groups recipientCollection
+}
+
+// NewRecipients constructs Recipients backed by the user and group
+// collections.
+func NewRecipients(users, groups recipientCollection) *Recipients {
+	return &Recipients{
+		users:  users,
+		groups: groups,
+	}
+}
+
+// Count returns how many chats the audience currently holds.
+func (r *Recipients) Count(ctx context.Context, audience string) (int64, error) {
+	coll, filter, _, err := r.audience(ctx, audience)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("count %s: %w", audience, err)
+	}
+
+	return count, nil
+}
+
+// ListAfter returns up to limit chat IDs of the audience greater than after,
+// in ascending order.
+func (r *Recipients) ListAfter(ctx context.Context, audience string, after int64, limit int) ([]int64, error) {
+	coll, filter, key, err := r.audience(ctx, audience)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	filter[key] = bson.M{"$gt": after}
+
+	cursor, err := coll.Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: key, Value: 1}}).
+			SetLimit(int64(limit)).
+			SetProjection(bson.M{key: 1, "_id": 0}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find %s: %w", audience, err)
+	}
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", audience, err)
+	}
+
+	ids := make([]int64, 0, len(docs))
+	for _, doc := range docs {
+		switch id := doc[key].(type) {
+		case int64:
+			ids = append(ids, id)
+		case int32:
+			ids = append(ids, int64(id))
+		}
+	}
+
+	return ids, nil
+}
+
+func (r *Recipients) audience(ctx context.Context, audience string) (recipientCollection, bson.M, string, error) {
+	if ctx == nil {
+		return nil, nil, "", errors.New("context is required")
+	}
+	if r == nil || r.users == nil || r.groups == nil {
+		return nil, nil, "", errors.New("recipients are not initialized")
+	}
+
+	switch audience {
+	case domain.BroadcastAudienceUsers:
+		return r.users, bson.M{"inactive": bson.M{"$ne": true}, "is_bot": bson.M{"$ne": true}}, "user_id", nil
+	case domain.BroadcastAudienceGroups:
+		return r.groups, bson.M{"bot_status": bson.M{"$nin": departedStatuses}}, "chat_id", nil
+	default:
+		return nil, nil, "", fmt.Errorf("unknown broadcast audience %q", audience)
+	}
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func TestRecipientsListAfterPagesActiveUsers(t *testing.T) {
+	users := &stubRecipientCollection{docs: []interface{}{bson.M{"user_id": int64(5)}, bson.M{"user_id": int32(9)}}}
+	recipients := NewRecipients(users, &stubRecipientCollection{})
+
+	ids, err := recipients.ListAfter(context.Background(), domain.BroadcastAudienceUsers, 2, 50)
+	if err != nil {
+		t.Fatalf("ListAfter returned error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int64{5, 9}) {
+		t.Fatalf("expected ids [5 9], got %v", ids)
+	}
+
+	want := bson.M{"inactive": bson.M{"$ne": true}, "is_bot": bson.M{"$ne": true}, "user_id": bson.M{"$gt": int64(2)}}
+	if !reflect.DeepEqual(users.filter, want) {
+		t.Fatalf("expected active users after the cursor, got %v", users.filter)
+	}
+	if users.opts == nil || *users.opts.Limit != 50 || !reflect.DeepEqual(users.opts.Sort, bson.D{{Key: "user_id", Value: 1}}) {
+		t.Fatalf("expected ascending page of 50, got %+v", users.opts)
+	}
+}
+
+func TestRecipientsCountGroupsTheBotIsIn(t *testing.T) {
+	groups := &stubRecipientCollection{stubCountCollection: stubCountCollection{count: 4}}
+	recipients := NewRecipients(&stubRecipientCollection{}, groups)
+
+	count, err := recipients.Count(context.Background(), domain.BroadcastAudienceGroups)
+	if err != nil || count != 4 {
+		t.Fatalf("expected 4 groups, got %d err=%v", count, err)
+	}
+	if !reflect.DeepEqual(groups.filter, bson.M{"bot_status": bson.M{"$nin": departedStatuses}}) {
+		t.Fatalf("expected active groups filter, got %v", groups.filter)
+	}
+
+	if _, err := recipients.Count(context.Background(), "admins"); err == nil {
+		t.Fatalf("expected unknown audience to be rejected")
+	}
+}
+
+type stubRecipientCollection struct {
+	stubCountCollection
+	docs []interface{}
+	opts *options.FindOptions
+}
+
+func (s *stubRecipientCollection) Find(_ context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	s.filter = filter
+	s.opts = options.MergeFindOptions(opts...)
+	return mongo.NewCursorFromDocuments(s.docs, nil, nil)
+}
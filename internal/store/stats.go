@@ -8,8 +8,12 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"tg_pay_gateway_bot/internal/domain"
 )
 
+var departedStatuses = bson.A{domain.GroupBotStatusLeft, domain.GroupBotStatusKicked}
+
 type countCollection interface {
 	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
 }
@@ -47,8 +51,20 @@ func (p *StatsProvider) CountUsers(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
-// CountGroups returns the number of documents in the groups collection.
+// CountGroups returns the number of groups the bot is still a member of.
+// Groups recorded before membership was tracked have no bot_status and count
+// as active.
 func (p *StatsProvider) CountGroups(ctx context.Context) (int64, error) {
+	return p.countGroups(ctx, bson.M{"bot_status": bson.M{"$nin": departedStatuses}})
+}
+
+// CountDepartedGroups returns the number of groups the bot left or was removed
+// from.
+func (p *StatsProvider) CountDepartedGroups(ctx context.Context) (int64, error) {
+	return p.countGroups(ctx, bson.M{"bot_status": bson.M{"$in": departedStatuses}})
+}
+
+func (p *StatsProvider) countGroups(ctx context.Context, filter bson.M) (int64, error) {
 	if ctx == nil {
 		return 0, errors.New("context is required")
 	}
@@ -56,7 +72,7 @@ func (p *StatsProvider) CountGroups(ctx context.Context) (int64, error) {
 		return 0, errors.New("stats provider is not initialized")
 	}
 
-	count, err := p.groups.CountDocuments(ctx, bson.D{})
+	count, err := p.groups.CountDocuments(ctx, filter)
 	if err != nil {
 		return 0, fmt.Errorf("count groups: %w", err)
 	}
@@ -3,8 +3,10 @@ package store
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -37,6 +39,16 @@ func TestStatsProviderCountsUsersAndGroups(t *testing.T) {
 	if groups.calls != 1 {
 		t.Fatalf("expected groups count to be called once, got %d", groups.calls)
 	}
+	if !reflect.DeepEqual(groups.filter, bson.M{"bot_status": bson.M{"$nin": departedStatuses}}) {
+		t.Fatalf("expected active groups filter, got %v", groups.filter)
+	}
+
+	if _, err := provider.CountDepartedGroups(ctx); err != nil {
+		t.Fatalf("expected departed group count to succeed, got error: %v", err)
+	}
+	if !reflect.DeepEqual(groups.filter, bson.M{"bot_status": bson.M{"$in": departedStatuses}}) {
+		t.Fatalf("expected departed groups filter, got %v", groups.filter)
+	}
 }
 
 func TestStatsProviderRequiresContext(t *testing.T) {
@@ -77,12 +89,14 @@ func TestStatsProviderPropagatesErrors(t *testing.T) {
 }
 
 type stubCountCollection struct {
-	count int64
-	err   error
-	calls int
+	count  int64
+	err    error
+	calls  int
+	filter interface{}
 }
 
 func (s *stubCountCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
 	s.calls++
+	s.filter = filter
 	return s.count, s.err
 }
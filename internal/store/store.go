@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -16,10 +19,28 @@ import (
 
 // Collection names used across the bot.
 const (
-	CollectionUsers  = "users"
-	CollectionGroups = "groups"
+	CollectionUsers         = "users"
+	CollectionGroups        = "groups"
+	CollectionMerchants     = "merchants"
+	CollectionOrders        = "orders"
+	CollectionNotifications = "notifications"
+	CollectionLedger        = "ledger_journals"
+	CollectionLedgerHeads   = "ledger_heads"
+	CollectionAudit         = "audit"
+	CollectionBroadcasts    = "broadcasts"
+	CollectionConversations = "conversations"
+	CollectionChannels      = "payment_channels"
+	CollectionChannelStats  = "payment_channel_outcomes"
+	CollectionChannelVolume = "payment_channel_volume"
 )
 
+// auditTTLIndex expires audit entries once they outlive the retention period.
+const auditTTLIndex = "created_at_ttl"
+
+// codeIndexOptionsConflict is returned by createIndexes when an index exists
+// with the same keys but different options.
+const codeIndexOptionsConflict = 85
+
 // mongoClient captures the subset of mongo.Client behavior we rely on to allow
 // lightweight stubbing in tests without a live Mongo deployment.
 type mongoClient interface {
@@ -38,20 +59,99 @@ var createIndexes = func(ctx context.Context, coll *mongo.Collection, models []m
 	return coll.Indexes().CreateMany(ctx, models)
 }
 
+// modifyTTL is overridable for tests.
+var modifyTTL = func(ctx context.Context, db *mongo.Database, collection, index string, expireAfterSeconds int32) error {
+	return db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: index},
+			{Key: "expireAfterSeconds", Value: expireAfterSeconds},
+		}},
+	}).Err()
+}
+
+// OperationObserver receives the latency of every MongoDB command the client
+// issues, such as find or update, with the collection it targeted when known.
+type OperationObserver interface {
+	ObserveMongoOperation(operation, collection string, d time.Duration, failed bool)
+}
+
+// ManagerOption configures optional Manager behavior.
+type ManagerOption func(*options.ClientOptions)
+
+// WithOperationObserver reports command latencies to observer.
+func WithOperationObserver(observer OperationObserver) ManagerOption {
+	return func(opts *options.ClientOptions) {
+		if observer != nil {
+			opts.SetMonitor(commandMonitor(observer))
+		}
+	}
+}
+
+// commandMonitor times commands between their started and finished events.
+// The collection only appears in the started event, so it is held by request
+// ID until the command finishes.
+func commandMonitor(observer OperationObserver) *event.CommandMonitor {
+	var collections sync.Map
+
+	finish := func(requestID int64, operation string, d time.Duration, failed bool) {
+		collection := ""
+		if value, ok := collections.LoadAndDelete(requestID); ok {
+			collection = value.(string)
+		}
+		observer.ObserveMongoOperation(operation, collection, d, failed)
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			collections.Store(evt.RequestID, commandCollection(evt.Command))
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			finish(evt.RequestID, evt.CommandName, evt.Duration, false)
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			finish(evt.RequestID, evt.CommandName, evt.Duration, true)
+		},
+	}
+}
+
+// commandCollection returns the collection named by a CRUD command, whose
+// first element maps the command name to the collection, e.g. {find: "users"}.
+func commandCollection(command bson.Raw) string {
+	first, err := command.IndexErr(0)
+	if err != nil {
+		return ""
+	}
+	collection, ok := first.Value().StringValueOK()
+	if !ok {
+		return ""
+	}
+
+	return collection
+}
+
 // Manager owns a MongoDB client and the configured database handle.
 type Manager struct {
-	client mongoClient
-	db     *mongo.Database
+	client         mongoClient
+	db             *mongo.Database
+	auditRetention time.Duration
 }
 
 // NewManager initializes the Mongo client using the supplied configuration and
 // verifies connectivity with a ping.
-func NewManager(ctx context.Context, cfg config.Config) (*Manager, error) {
+func NewManager(ctx context.Context, cfg config.Config, opts ...ManagerOption) (*Manager, error) {
 	if ctx == nil {
 		return nil, errors.New("context is required")
 	}
 
-	client, err := connectMongo(ctx, options.Client().ApplyURI(cfg.MongoURI))
+	clientOpts := options.Client().ApplyURI(cfg.MongoURI)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(clientOpts)
+		}
+	}
+
+	client, err := connectMongo(ctx, clientOpts)
 	if err != nil {
 		return nil, fmt.Errorf("connect mongo: %w", err)
 	}
@@ -61,9 +161,15 @@ func NewManager(ctx context.Context, cfg config.Config) (*Manager, error) {
 		return nil, fmt.Errorf("ping mongo: %w", err)
 	}
 
+	retentionDays := cfg.AuditRetentionDays
+	if retentionDays <= 0 {
+		retentionDays = config.DefaultAuditRetentionDays
+	}
+
 	return &Manager{
-		client: client,
-		db:     client.Database(cfg.MongoDB),
+		client:         client,
+		db:             client.Database(cfg.MongoDB),
+		auditRetention: time.Duration(retentionDays) * 24 * time.Hour,
 	}, nil
 }
 
@@ -97,6 +203,92 @@ func (m *Manager) Groups() *mongo.Collection {
 	return m.Collection(CollectionGroups)
 }
 
+// Merchants returns the merchants collection handle.
+func (m *Manager) Merchants() *mongo.Collection {
+	return m.Collection(CollectionMerchants)
+}
+
+// Orders returns the orders collection handle.
+func (m *Manager) Orders() *mongo.Collection {
+	return m.Collection(CollectionOrders)
+}
+
+// Notifications returns the merchant notification outbox collection handle.
+func (m *Manager) Notifications() *mongo.Collection {
+	return m.Collection(CollectionNotifications)
+}
+
+// Ledger returns the ledger journals collection handle.
+func (m *Manager) Ledger() *mongo.Collection {
+	return m.Collection(CollectionLedger)
+}
+
+// LedgerHeads returns the ledger account head collection handle.
+func (m *Manager) LedgerHeads() *mongo.Collection {
+	return m.Collection(CollectionLedgerHeads)
+}
+
+// Broadcasts returns the owner broadcast collection handle.
+func (m *Manager) Broadcasts() *mongo.Collection {
+	return m.Collection(CollectionBroadcasts)
+}
+
+// Conversations returns the multi-step dialog state collection handle.
+func (m *Manager) Conversations() *mongo.Collection {
+	return m.Collection(CollectionConversations)
+}
+
+// PaymentChannels returns the payment channel runtime state collection.
+func (m *Manager) PaymentChannels() *mongo.Collection {
+	return m.Collection(CollectionChannels)
+}
+
+// PaymentChannelOutcomes returns the per-minute channel outcome collection.
+func (m *Manager) PaymentChannelOutcomes() *mongo.Collection {
+	return m.Collection(CollectionChannelStats)
+}
+
+// PaymentChannelVolume returns the daily channel volume collection.
+func (m *Manager) PaymentChannelVolume() *mongo.Collection {
+	return m.Collection(CollectionChannelVolume)
+}
+
+// Audit returns the audit log collection handle.
+func (m *Manager) Audit() *mongo.Collection {
+	return m.Collection(CollectionAudit)
+}
+
+// WithTransaction runs fn inside a multi-document transaction on a new session,
+// retrying transient errors as the driver allows. The context passed to fn
+// carries the session and must be used for every operation that belongs to the
+// transaction. When ctx already carries a session, fn joins that transaction
+// instead of starting its own. Transactions require MongoDB to run as a
+// replica set.
+func (m *Manager) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	client := m.Client()
+	if client == nil {
+		return errors.New("store manager is not initialized")
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return fmt.Errorf("start mongo session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+
+	return err
+}
+
 // Ping verifies Mongo connectivity. It returns an error when the manager or
 // context are invalid, or when the ping fails.
 func (m *Manager) Ping(ctx context.Context) error {
@@ -114,8 +306,12 @@ func (m *Manager) Ping(ctx context.Context) error {
 	return nil
 }
 
-// EnsureBaseIndexes creates the foundational indexes for the users and groups
-// collections. Collections are created implicitly if they do not already exist.
+// EnsureBaseIndexes creates the foundational indexes for the users, groups,
+// merchants, orders, notifications, ledger journals and heads, broadcasts,
+// conversations, payment channel state, and audit collections.
+// Collections are created implicitly if they do not already exist. The audit
+// TTL index follows the configured retention, updating an existing index in
+// place when the retention changed.
 func (m *Manager) EnsureBaseIndexes(ctx context.Context) error {
 	if ctx == nil {
 		return errors.New("context is required")
@@ -131,6 +327,15 @@ func (m *Manager) EnsureBaseIndexes(ctx context.Context) error {
 				SetName("user_id_unique").
 				SetUnique(true),
 		},
+		{
+			// Sparse so users without a username are not indexed; lets
+			// commands resolve @username.
+			Keys: bson.D{{Key: "username_lower", Value: 1}},
+			Options: options.Index().
+				SetName("username_lower_unique").
+				SetUnique(true).
+				SetSparse(true),
+		},
 	}
 
 	if _, err := createIndexes(ctx, m.Users(), userIndexes); err != nil {
@@ -150,6 +355,260 @@ func (m *Manager) EnsureBaseIndexes(ctx context.Context) error {
 		return fmt.Errorf("create groups indexes: %w", err)
 	}
 
+	merchantIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "merchant_id", Value: 1}},
+			Options: options.Index().
+				SetName("merchant_id_unique").
+				SetUnique(true),
+		},
+		{
+			// A group chat may be bound to at most one merchant. The partial
+			// filter skips merchants without bound groups.
+			Keys: bson.D{{Key: "group_chat_ids", Value: 1}},
+			Options: options.Index().
+				SetName("group_chat_ids_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"group_chat_ids": bson.M{"$type": "long"}}),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.Merchants(), merchantIndexes); err != nil {
+		return fmt.Errorf("create merchants indexes: %w", err)
+	}
+
+	orderIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}},
+			Options: options.Index().
+				SetName("order_id_unique").
+				SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "merchant_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().
+				SetName("merchant_id_created_at"),
+		},
+		{
+			// The expiry sweep lists created and pending orders by age.
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().
+				SetName("status_created_at"),
+		},
+		{
+			// Telegram charge IDs identify a payment for refunds. The partial
+			// filter skips orders not paid through a Telegram invoice.
+			Keys: bson.D{{Key: "telegram_payment_charge_id", Value: 1}},
+			Options: options.Index().
+				SetName("telegram_payment_charge_id_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"telegram_payment_charge_id": bson.M{"$type": "string"}}),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.Orders(), orderIndexes); err != nil {
+		return fmt.Errorf("create orders indexes: %w", err)
+	}
+
+	notificationIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "notification_id", Value: 1}},
+			Options: options.Index().
+				SetName("notification_id_unique").
+				SetUnique(true),
+		},
+		{
+			// Serves the worker claim query for due pending notifications.
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().
+				SetName("status_next_attempt_at"),
+		},
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}},
+			Options: options.Index().
+				SetName("order_id"),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.Notifications(), notificationIndexes); err != nil {
+		return fmt.Errorf("create notifications indexes: %w", err)
+	}
+
+	ledgerIndexes := []mongo.IndexModel{
+		{
+			// Order-driven journal ids are deterministic, so the unique index
+			// keeps each payment, fee, and refund from posting twice.
+			Keys: bson.D{{Key: "journal_id", Value: 1}},
+			Options: options.Index().
+				SetName("journal_id_unique").
+				SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "merchant_id", Value: 1}, {Key: "currency", Value: 1}},
+			Options: options.Index().
+				SetName("merchant_id_currency"),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.Ledger(), ledgerIndexes); err != nil {
+		return fmt.Errorf("create ledger indexes: %w", err)
+	}
+
+	ledgerHeadIndexes := []mongo.IndexModel{
+		{
+			// One head per merchant and currency, so transactions that lock
+			// the same balance write the same document.
+			Keys: bson.D{{Key: "merchant_id", Value: 1}, {Key: "currency", Value: 1}},
+			Options: options.Index().
+				SetName("merchant_id_currency_unique").
+				SetUnique(true),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.LedgerHeads(), ledgerHeadIndexes); err != nil {
+		return fmt.Errorf("create ledger head indexes: %w", err)
+	}
+
+	broadcastIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "broadcast_id", Value: 1}},
+			Options: options.Index().
+				SetName("broadcast_id_unique").
+				SetUnique(true),
+		},
+		{
+			// Serves the worker claim and the latest-broadcast lookup.
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().
+				SetName("status_created_at"),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.Broadcasts(), broadcastIndexes); err != nil {
+		return fmt.Errorf("create broadcasts indexes: %w", err)
+	}
+
+	conversationIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "chat_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().
+				SetName("chat_id_user_id_unique").
+				SetUnique(true),
+		},
+		{
+			// Abandoned dialogs are removed once they expire.
+			Keys: bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().
+				SetName("expires_at_ttl").
+				SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.Conversations(), conversationIndexes); err != nil {
+		return fmt.Errorf("create conversations indexes: %w", err)
+	}
+
+	if err := m.ensureChannelIndexes(ctx); err != nil {
+		return err
+	}
+
+	return m.ensureAuditIndexes(ctx)
+}
+
+// channelStateRetention bounds how long routing counters are kept; it
+// outlasts the longest routing window and a full UTC day of volume.
+const channelStateRetention = 48 * time.Hour
+
+func (m *Manager) ensureChannelIndexes(ctx context.Context) error {
+	channelIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().
+				SetName("code_unique").
+				SetUnique(true),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.PaymentChannels(), channelIndexes); err != nil {
+		return fmt.Errorf("create payment channel indexes: %w", err)
+	}
+
+	expireAfter := int32(channelStateRetention / time.Second)
+
+	outcomeIndexes := []mongo.IndexModel{
+		{
+			// One counter document per channel and minute.
+			Keys: bson.D{{Key: "code", Value: 1}, {Key: "bucket", Value: 1}},
+			Options: options.Index().
+				SetName("code_bucket_unique").
+				SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "bucket", Value: 1}},
+			Options: options.Index().
+				SetName("bucket_ttl").
+				SetExpireAfterSeconds(expireAfter),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.PaymentChannelOutcomes(), outcomeIndexes); err != nil {
+		return fmt.Errorf("create payment channel outcome indexes: %w", err)
+	}
+
+	volumeIndexes := []mongo.IndexModel{
+		{
+			// The daily cap is reserved with an upsert; the unique index
+			// turns a reservation over the cap into a duplicate key error.
+			Keys: bson.D{{Key: "code", Value: 1}, {Key: "day", Value: 1}, {Key: "currency", Value: 1}},
+			Options: options.Index().
+				SetName("code_day_currency_unique").
+				SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "day", Value: 1}},
+			Options: options.Index().
+				SetName("day_ttl").
+				SetExpireAfterSeconds(expireAfter),
+		},
+	}
+
+	if _, err := createIndexes(ctx, m.PaymentChannelVolume(), volumeIndexes); err != nil {
+		return fmt.Errorf("create payment channel volume indexes: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Manager) ensureAuditIndexes(ctx context.Context) error {
+	expireAfter := int32(m.auditRetention / time.Second)
+
+	auditIndexes := []mongo.IndexModel{
+		{
+			// Also serves the newest-first listing.
+			Keys: bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().
+				SetName(auditTTLIndex).
+				SetExpireAfterSeconds(expireAfter),
+		},
+		{
+			Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().
+				SetName("actor_id_created_at"),
+		},
+	}
+
+	_, err := createIndexes(ctx, m.Audit(), auditIndexes)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == codeIndexOptionsConflict {
+		if err := modifyTTL(ctx, m.db, CollectionAudit, auditTTLIndex, expireAfter); err != nil {
+			return fmt.Errorf("update audit retention: %w", err)
+		}
+		_, err = createIndexes(ctx, m.Audit(), auditIndexes)
+	}
+	if err != nil {
+		return fmt.Errorf("create audit indexes: %w", err)
+	}
+
 	return nil
 }
 
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -57,6 +58,55 @@ func TestNewManagerConnectsAndExposesCollections(t *testing.T) {
 	}
 }
 
+func TestWithOperationObserverTimesCommands(t *testing.T) {
+	var gotOpts *options.ClientOptions
+	prev := connectMongo
+	connectMongo = func(_ context.Context, opts *options.ClientOptions) (mongoClient, error) {
+		gotOpts = opts
+		return newFakeMongoClient(t), nil
+	}
+	t.Cleanup(func() { connectMongo = prev })
+
+	observer := &fakeObserver{}
+	cfg := config.Config{MongoURI: "mongodb://stub-host:27017", MongoDB: "tg_bot_test"}
+	if _, err := NewManager(context.Background(), cfg, WithOperationObserver(observer)); err != nil {
+		t.Fatalf("NewManager returned error: %v", err)
+	}
+	monitor := gotOpts.Monitor
+	if monitor == nil {
+		t.Fatalf("expected a command monitor on the client options")
+	}
+
+	ctx := context.Background()
+	find, _ := bson.Marshal(bson.D{{Key: "find", Value: CollectionUsers}, {Key: "filter", Value: bson.D{}}})
+	ping, _ := bson.Marshal(bson.D{{Key: "ping", Value: 1}})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: find, CommandName: "find", RequestID: 1})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: ping, CommandName: "ping", RequestID: 2})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: "find", RequestID: 1, Duration: 3 * time.Millisecond,
+	}})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: "ping", RequestID: 2, Duration: time.Millisecond,
+	}})
+
+	want := []string{"find users 3ms ok", "ping  1ms failed"}
+	if len(observer.calls) != len(want) || observer.calls[0] != want[0] || observer.calls[1] != want[1] {
+		t.Fatalf("expected observations %q, got %q", want, observer.calls)
+	}
+}
+
+type fakeObserver struct {
+	calls []string
+}
+
+func (f *fakeObserver) ObserveMongoOperation(operation, collection string, d time.Duration, failed bool) {
+	outcome := "ok"
+	if failed {
+		outcome = "failed"
+	}
+	f.calls = append(f.calls, operation+" "+collection+" "+d.String()+" "+outcome)
+}
+
 func TestNewManagerFailsOnPingAndCleansUp(t *testing.T) {
 	fake := newFakeMongoClient(t)
 	fake.pingErr = errors.New("ping failed")
@@ -193,21 +243,180 @@ func TestEnsureBaseIndexesCreatesUniqueIndexes(t *testing.T) {
 		t.Fatalf("expected indexes to be created, got error: %v", err)
 	}
 
-	if len(recorder.calls) != 2 {
-		t.Fatalf("expected 2 index creation calls, got %d", len(recorder.calls))
+	if len(recorder.calls) != 13 {
+		t.Fatalf("expected 13 index creation calls, got %d", len(recorder.calls))
 	}
 
 	userCall := recorder.calls[0]
 	if userCall.collection != CollectionUsers {
 		t.Fatalf("expected first collection %s, got %s", CollectionUsers, userCall.collection)
 	}
-	assertUniqueIndex(t, userCall.models, "user_id", "user_id_unique")
+	if len(userCall.models) != 2 {
+		t.Fatalf("expected 2 user index models, got %d", len(userCall.models))
+	}
+	assertUniqueIndex(t, userCall.models[:1], "user_id", "user_id_unique")
+	assertUniqueIndex(t, userCall.models[1:], "username_lower", "username_lower_unique")
+	if sparse := userCall.models[1].Options.Sparse; sparse == nil || !*sparse {
+		t.Fatalf("expected username_lower index to be sparse")
+	}
 
 	groupCall := recorder.calls[1]
 	if groupCall.collection != CollectionGroups {
 		t.Fatalf("expected second collection %s, got %s", CollectionGroups, groupCall.collection)
 	}
 	assertUniqueIndex(t, groupCall.models, "chat_id", "chat_id_unique")
+
+	merchantCall := recorder.calls[2]
+	if merchantCall.collection != CollectionMerchants {
+		t.Fatalf("expected third collection %s, got %s", CollectionMerchants, merchantCall.collection)
+	}
+	if len(merchantCall.models) != 2 {
+		t.Fatalf("expected 2 merchant index models, got %d", len(merchantCall.models))
+	}
+	assertUniqueIndex(t, merchantCall.models[:1], "merchant_id", "merchant_id_unique")
+	assertUniqueIndex(t, merchantCall.models[1:], "group_chat_ids", "group_chat_ids_unique")
+	if merchantCall.models[1].Options.PartialFilterExpression == nil {
+		t.Fatalf("expected partial filter on group_chat_ids index")
+	}
+
+	orderCall := recorder.calls[3]
+	if orderCall.collection != CollectionOrders {
+		t.Fatalf("expected fourth collection %s, got %s", CollectionOrders, orderCall.collection)
+	}
+	if len(orderCall.models) != 4 {
+		t.Fatalf("expected 4 order index models, got %d", len(orderCall.models))
+	}
+	assertUniqueIndex(t, orderCall.models[:1], "order_id", "order_id_unique")
+	if name := orderCall.models[1].Options.Name; name == nil || *name != "merchant_id_created_at" {
+		t.Fatalf("expected merchant_id_created_at index, got %v", name)
+	}
+	if name := orderCall.models[2].Options.Name; name == nil || *name != "status_created_at" {
+		t.Fatalf("expected status_created_at index, got %v", name)
+	}
+	assertUniqueIndex(t, orderCall.models[3:], "telegram_payment_charge_id", "telegram_payment_charge_id_unique")
+	if orderCall.models[3].Options.PartialFilterExpression == nil {
+		t.Fatalf("expected partial filter on telegram_payment_charge_id index")
+	}
+
+	notificationCall := recorder.calls[4]
+	if notificationCall.collection != CollectionNotifications {
+		t.Fatalf("expected fifth collection %s, got %s", CollectionNotifications, notificationCall.collection)
+	}
+	if len(notificationCall.models) != 3 {
+		t.Fatalf("expected 3 notification index models, got %d", len(notificationCall.models))
+	}
+	assertUniqueIndex(t, notificationCall.models[:1], "notification_id", "notification_id_unique")
+	if name := notificationCall.models[1].Options.Name; name == nil || *name != "status_next_attempt_at" {
+		t.Fatalf("expected status_next_attempt_at index, got %v", name)
+	}
+
+	ledgerCall := recorder.calls[5]
+	if ledgerCall.collection != CollectionLedger {
+		t.Fatalf("expected sixth collection %s, got %s", CollectionLedger, ledgerCall.collection)
+	}
+	assertUniqueIndex(t, ledgerCall.models[:1], "journal_id", "journal_id_unique")
+
+	ledgerHeadCall := recorder.calls[6]
+	if ledgerHeadCall.collection != CollectionLedgerHeads {
+		t.Fatalf("expected seventh collection %s, got %s", CollectionLedgerHeads, ledgerHeadCall.collection)
+	}
+	if opts := ledgerHeadCall.models[0].Options; opts.Name == nil || *opts.Name != "merchant_id_currency_unique" || opts.Unique == nil || !*opts.Unique {
+		t.Fatalf("expected unique merchant_id_currency index, got %+v", opts)
+	}
+
+	broadcastCall := recorder.calls[7]
+	if broadcastCall.collection != CollectionBroadcasts {
+		t.Fatalf("expected eighth collection %s, got %s", CollectionBroadcasts, broadcastCall.collection)
+	}
+	assertUniqueIndex(t, broadcastCall.models[:1], "broadcast_id", "broadcast_id_unique")
+
+	conversationCall := recorder.calls[8]
+	if conversationCall.collection != CollectionConversations {
+		t.Fatalf("expected ninth collection %s, got %s", CollectionConversations, conversationCall.collection)
+	}
+	if len(conversationCall.models) != 2 {
+		t.Fatalf("expected 2 conversation index models, got %d", len(conversationCall.models))
+	}
+	if opts := conversationCall.models[0].Options; opts.Name == nil || *opts.Name != "chat_id_user_id_unique" || opts.Unique == nil || !*opts.Unique {
+		t.Fatalf("expected unique chat_id_user_id index, got %+v", opts)
+	}
+	if expire := conversationCall.models[1].Options.ExpireAfterSeconds; expire == nil || *expire != 0 {
+		t.Fatalf("expected conversations to expire at expires_at, got %v", expire)
+	}
+
+	channelCall := recorder.calls[9]
+	if channelCall.collection != CollectionChannels {
+		t.Fatalf("expected tenth collection %s, got %s", CollectionChannels, channelCall.collection)
+	}
+	assertUniqueIndex(t, channelCall.models, "code", "code_unique")
+
+	outcomeCall := recorder.calls[10]
+	if outcomeCall.collection != CollectionChannelStats {
+		t.Fatalf("expected eleventh collection %s, got %s", CollectionChannelStats, outcomeCall.collection)
+	}
+	if opts := outcomeCall.models[0].Options; opts.Name == nil || *opts.Name != "code_bucket_unique" || opts.Unique == nil || !*opts.Unique {
+		t.Fatalf("expected unique code_bucket index, got %+v", opts)
+	}
+	if expire := outcomeCall.models[1].Options.ExpireAfterSeconds; expire == nil || *expire != int32(channelStateRetention/time.Second) {
+		t.Fatalf("expected outcome buckets to expire, got %v", expire)
+	}
+
+	volumeCall := recorder.calls[11]
+	if volumeCall.collection != CollectionChannelVolume {
+		t.Fatalf("expected twelfth collection %s, got %s", CollectionChannelVolume, volumeCall.collection)
+	}
+	if opts := volumeCall.models[0].Options; opts.Name == nil || *opts.Name != "code_day_currency_unique" || opts.Unique == nil || !*opts.Unique {
+		t.Fatalf("expected unique code_day_currency index, got %+v", opts)
+	}
+
+	auditCall := recorder.calls[12]
+	if auditCall.collection != CollectionAudit {
+		t.Fatalf("expected thirteenth collection %s, got %s", CollectionAudit, auditCall.collection)
+	}
+	ttl := auditCall.models[0].Options
+	if ttl.Name == nil || *ttl.Name != auditTTLIndex || ttl.ExpireAfterSeconds == nil {
+		t.Fatalf("expected audit TTL index, got %+v", ttl)
+	}
+	if want := int32(config.DefaultAuditRetentionDays * 24 * 60 * 60); *ttl.ExpireAfterSeconds != want {
+		t.Fatalf("expected default retention of %d seconds, got %d", want, *ttl.ExpireAfterSeconds)
+	}
+}
+
+func TestEnsureBaseIndexesUpdatesChangedAuditRetention(t *testing.T) {
+	fake := newFakeMongoClient(t)
+	restoreConnect := stubConnect(fake, nil)
+	t.Cleanup(restoreConnect)
+
+	manager, err := NewManager(context.Background(), config.Config{MongoURI: "mongodb://stub", MongoDB: "tg_bot_test", AuditRetentionDays: 7})
+	if err != nil {
+		t.Fatalf("expected manager to initialize, got error: %v", err)
+	}
+
+	recorder := newIndexRecorder(t, "")
+	recorder.conflictOnce = CollectionAudit
+	restoreIndexes := recorder.stub()
+	t.Cleanup(restoreIndexes)
+
+	var modified []int32
+	prevModify := modifyTTL
+	modifyTTL = func(_ context.Context, _ *mongo.Database, collection, index string, expireAfterSeconds int32) error {
+		if collection != CollectionAudit || index != auditTTLIndex {
+			t.Fatalf("unexpected collMod target %s.%s", collection, index)
+		}
+		modified = append(modified, expireAfterSeconds)
+		return nil
+	}
+	t.Cleanup(func() { modifyTTL = prevModify })
+
+	if err := manager.EnsureBaseIndexes(context.Background()); err != nil {
+		t.Fatalf("expected conflict to be resolved, got error: %v", err)
+	}
+	if len(modified) != 1 || modified[0] != 7*24*60*60 {
+		t.Fatalf("expected retention to be updated to 7 days, got %v", modified)
+	}
+	if len(recorder.calls) != 14 {
+		t.Fatalf("expected audit indexes to be retried after collMod, got %d calls", len(recorder.calls))
+	}
 }
 
 func TestEnsureBaseIndexesFailsFastOnErrors(t *testing.T) {
@@ -251,6 +460,26 @@ func TestEnsureBaseIndexesValidatesContext(t *testing.T) {
 	}
 }
 
+func TestWithTransactionRequiresMongoClient(t *testing.T) {
+	fake := newFakeMongoClient(t)
+	restoreConnect := stubConnect(fake, nil)
+	t.Cleanup(restoreConnect)
+
+	manager, err := NewManager(context.Background(), config.Config{MongoURI: "mongodb://stub", MongoDB: "tg_bot_test"})
+	if err != nil {
+		t.Fatalf("expected manager to initialize, got error: %v", err)
+	}
+
+	called := false
+	err = manager.WithTransaction(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Fatalf("expected transaction to fail without a mongo client, got err=%v called=%v", err, called)
+	}
+}
+
 type fakeMongoClient struct {
 	client           *mongo.Client
 	pingErr          error
@@ -312,6 +541,7 @@ type indexRecorder struct {
 	t               *testing.T
 	calls           []indexCall
 	errorCollection string
+	conflictOnce    string
 }
 
 func newIndexRecorder(t *testing.T, errorCollection string) *indexRecorder {
@@ -326,6 +556,10 @@ func (r *indexRecorder) stub() func() {
 		if r.errorCollection == coll.Name() {
 			return nil, errIndexFailure
 		}
+		if r.conflictOnce == coll.Name() {
+			r.conflictOnce = ""
+			return nil, mongo.CommandError{Code: codeIndexOptionsConflict, Name: "IndexOptionsConflict"}
+		}
 		return []string{coll.Name() + "_idx"}, nil
 	}
 
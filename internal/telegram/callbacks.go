@@ -0,0 +1,358 @@
+package telegram
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// DefaultCallbackTTL is how long buttons stay valid when a Callback does not
+// set its own TTL.
+const DefaultCallbackTTL = 24 * time.Hour
+
+const (
+	callbackDataSeparator = ":"
+	callbackFailedText    = "Action failed. Please try again later."
+	callbackInvalidText   = "This button is no longer valid."
+	callbackExpiredText   = "This button has expired. Please run the command again."
+	// callbackDataMaxBytes is Telegram's limit on inline button data.
+	callbackDataMaxBytes = 64
+	// callbackSignatureBytes is how much of the HMAC is kept in button data;
+	// 8 bytes encode to 11 characters.
+	callbackSignatureBytes = 8
+)
+
+var errInvalidCallbackData = errors.New("invalid callback data")
+
+var answerCallbackQuery = func(ctx context.Context, b *bot.Bot, params *bot.AnswerCallbackQueryParams) (bool, error) {
+	return b.AnswerCallbackQuery(ctx, params)
+}
+
+// InlineButton is a callback button attached below a message. Data is the
+// unsigned payload built with CallbackData; the client appends the issue time
+// and signature when sending.
+type InlineButton struct {
+	Text string
+	Data string
+}
+
+// CallbackData joins a namespace and its arguments into inline button data,
+// e.g. CallbackData("order", "refund", id) gives "order:refund:<id>".
+func CallbackData(namespace string, args ...string) string {
+	return strings.Join(append([]string{namespace}, args...), callbackDataSeparator)
+}
+
+// Callback declares how button presses of one namespace are handled.
+type Callback struct {
+	Namespace string
+	// MinRole is the lowest role allowed to press the buttons; empty means
+	// anyone. Owner-level buttons also require the BOT_OWNER id.
+	MinRole string
+	// TTL is how long a button stays valid after it was sent. Zero uses
+	// DefaultCallbackTTL.
+	TTL     time.Duration
+	Handler CallbackFunc
+}
+
+// CallbackRequest carries an inline button press passed to a CallbackFunc.
+// Data is the verified payload without its signature and Args are its fields
+// after the namespace. Role is only set for callbacks declaring a MinRole.
+type CallbackRequest struct {
+	UserID    int64
+	ChatID    int64
+	MessageID int
+	Data      string
+	Args      []string
+	Role      string
+	IssuedAt  time.Time
+	Update    *models.Update
+}
+
+// CallbackFunc handles a button press and returns the short notice shown to
+// the user. Every press is answered; an error is logged and answered with a
+// generic failure notice.
+type CallbackFunc func(ctx context.Context, req CallbackRequest) (string, error)
+
+// RegisterCallback routes button presses of cb's namespace to its handler.
+// Registration must happen before Start.
+func (c *Client) RegisterCallback(cb Callback) error {
+	if c == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	return c.router.registerCallback(cb)
+}
+
+// RegisterCallbacks registers each callback in order, stopping at the first
+// error.
+func (c *Client) RegisterCallbacks(callbacks ...Callback) error {
+	for _, cb := range callbacks {
+		if err := c.RegisterCallback(cb); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *messageRouter) registerCallback(cb Callback) error {
+	cb.Namespace = strings.ToLower(strings.TrimSpace(cb.Namespace))
+	if !commandNamePattern.MatchString(cb.Namespace) {
+		return fmt.Errorf("invalid callback namespace %q: use 1-32 characters of a-z, 0-9 and _", cb.Namespace)
+	}
+	if cb.Handler == nil {
+		return fmt.Errorf("callback %q: handler is required", cb.Namespace)
+	}
+	if cb.MinRole != "" && domain.RolePriority(cb.MinRole) == 0 {
+		return fmt.Errorf("callback %q: unknown role %q", cb.Namespace, cb.MinRole)
+	}
+	if cb.TTL < 0 {
+		return fmt.Errorf("callback %q: ttl must not be negative", cb.Namespace)
+	}
+	if cb.TTL == 0 {
+		cb.TTL = DefaultCallbackTTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.callbacks[cb.Namespace]; exists {
+		return fmt.Errorf("callback %q is already registered", cb.Namespace)
+	}
+	r.callbacks[cb.Namespace] = cb
+
+	return nil
+}
+
+// routeCallback verifies a button press, enforces its namespace's expiry and
+// role, hands it to the handler, and always answers the query so the client
+// stops showing progress.
+func (r *messageRouter) routeCallback(ctx context.Context, b *bot.Bot, update *models.Update, meta updateMeta) string {
+	query := update.CallbackQuery
+	chatType := normalizeChatType(meta.chatType)
+
+	data, issued, err := r.verifyCallbackData(query.Data)
+	if err != nil {
+		r.logRoute(meta, chatType, "callback_invalid", "callback", "")
+		r.rejectCallback(meta, "callback_invalid", "invalid_signature")
+		r.answerCallback(ctx, b, query.ID, "callback_invalid", meta, callbackInvalidText, true)
+		return "callback_invalid"
+	}
+
+	fields := strings.Split(data, callbackDataSeparator)
+	namespace := fields[0]
+
+	r.mu.RLock()
+	cb, ok := r.callbacks[namespace]
+	r.mu.RUnlock()
+
+	if !ok {
+		r.logRoute(meta, chatType, "callback_unknown", "callback", "")
+		r.answerCallback(ctx, b, query.ID, "callback_unknown", meta, "", false)
+		return "callback_unknown"
+	}
+
+	handlerName := "callback_" + namespace
+	r.logRoute(meta, chatType, handlerName, "callback", "")
+
+	if r.now().Sub(issued) > cb.TTL {
+		r.rejectCallback(meta, handlerName, "expired")
+		r.answerCallback(ctx, b, query.ID, handlerName, meta, callbackExpiredText, true)
+		return handlerName
+	}
+
+	role, allowed := r.authorizeCallback(ctx, cb, fields[1:], meta)
+	if !allowed {
+		r.answerCallback(ctx, b, query.ID, handlerName, meta, permissionDeniedText, true)
+		return handlerName
+	}
+
+	req := CallbackRequest{
+		UserID:   meta.userID,
+		ChatID:   meta.chatID,
+		Data:     data,
+		Args:     fields[1:],
+		Role:     role,
+		IssuedAt: issued,
+		Update:   update,
+	}
+	if query.Message.Message != nil {
+		req.MessageID = query.Message.Message.ID
+	}
+
+	notice, err := cb.Handler(ctx, req)
+	if err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   handlerName + "_error",
+			"user_id": meta.userID,
+			"chat_id": meta.chatID,
+		}).WithError(err).Error("callback handler failed")
+		notice = callbackFailedText
+	}
+
+	r.answerCallback(ctx, b, query.ID, handlerName, meta, notice, false)
+
+	return handlerName
+}
+
+// authorizeCallback applies the same role rules as commands and audits
+// privileged presses and denials.
+func (r *messageRouter) authorizeCallback(ctx context.Context, cb Callback, args []string, meta updateMeta) (string, bool) {
+	if cb.MinRole == "" {
+		return "", true
+	}
+
+	role, reason, err := r.resolveRole(ctx, meta)
+	if reason == "" {
+		allowed := domain.RolePriority(role) >= domain.RolePriority(cb.MinRole)
+		if cb.MinRole == domain.RoleOwner && meta.userID != r.botOwnerID {
+			allowed = false
+		}
+		if !allowed {
+			reason = "insufficient_role"
+		}
+	}
+
+	if r.auditor != nil && (reason != "" || domain.RolePriority(cb.MinRole) >= domain.RolePriorityAdmin) {
+		r.auditor.AuditCommand(ctx, CommandAudit{
+			Command:  cb.Namespace,
+			Args:     args,
+			UserID:   meta.userID,
+			ChatID:   meta.chatID,
+			Role:     role,
+			MinRole:  cb.MinRole,
+			Allowed:  reason == "",
+			Reason:   reason,
+			Callback: true,
+		})
+	}
+
+	if reason == "" {
+		return role, true
+	}
+
+	entry := r.logger.WithFields(logging.Fields{
+		"event":    "callback_denied",
+		"handler":  "callback_" + cb.Namespace,
+		"reason":   reason,
+		"required": cb.MinRole,
+		"role":     role,
+		"user_id":  meta.userID,
+		"chat_id":  meta.chatID,
+	})
+	if err != nil {
+		entry.WithError(err).Error("callback denied after user lookup failure")
+	} else {
+		entry.Info("callback denied")
+	}
+
+	return role, false
+}
+
+func (r *messageRouter) rejectCallback(meta updateMeta, handlerName, reason string) {
+	r.logger.WithFields(logging.Fields{
+		"event":   "callback_rejected",
+		"handler": handlerName,
+		"reason":  reason,
+		"user_id": meta.userID,
+		"chat_id": meta.chatID,
+	}).Info("rejected callback query")
+}
+
+func (r *messageRouter) answerCallback(ctx context.Context, b *bot.Bot, queryID, handlerName string, meta updateMeta, text string, alert bool) {
+	if b == nil {
+		return
+	}
+
+	if _, err := answerCallbackQuery(ctx, b, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: queryID,
+		Text:            text,
+		ShowAlert:       alert,
+	}); err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   "callback_answer_failed",
+			"handler": handlerName,
+			"user_id": meta.userID,
+		}).WithError(err).Warn("failed to answer callback query")
+	}
+}
+
+// signCallbackData appends the issue time (base-36 Unix seconds) and a
+// truncated HMAC-SHA256 to data, keeping it within Telegram's 64-byte limit.
+func (r *messageRouter) signCallbackData(data string) (string, error) {
+	issued := strconv.FormatInt(r.now().Unix(), 36)
+	payload := data + callbackDataSeparator + issued
+	signed := payload + callbackDataSeparator + r.callbackSignature(payload)
+	if len(signed) > callbackDataMaxBytes {
+		return "", fmt.Errorf("callback data %q exceeds %d bytes once signed", data, callbackDataMaxBytes)
+	}
+
+	return signed, nil
+}
+
+// verifyCallbackData checks the signature appended by signCallbackData and
+// returns the original data with its issue time.
+func (r *messageRouter) verifyCallbackData(signed string) (string, time.Time, error) {
+	sigAt := strings.LastIndex(signed, callbackDataSeparator)
+	if sigAt <= 0 {
+		return "", time.Time{}, errInvalidCallbackData
+	}
+	payload, signature := signed[:sigAt], signed[sigAt+1:]
+	if !hmac.Equal([]byte(signature), []byte(r.callbackSignature(payload))) {
+		return "", time.Time{}, errInvalidCallbackData
+	}
+
+	issuedAt := strings.LastIndex(payload, callbackDataSeparator)
+	if issuedAt <= 0 {
+		return "", time.Time{}, errInvalidCallbackData
+	}
+	seconds, err := strconv.ParseInt(payload[issuedAt+1:], 36, 64)
+	if err != nil {
+		return "", time.Time{}, errInvalidCallbackData
+	}
+
+	return payload[:issuedAt], time.Unix(seconds, 0), nil
+}
+
+func (r *messageRouter) callbackSignature(payload string) string {
+	mac := hmac.New(sha256.New, r.callbackKey)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSignatureBytes])
+}
+
+// callbackSigningKey derives the button signing key from the bot token, so
+// buttons stay valid across restarts and replicas without extra config.
+func callbackSigningKey(token string) []byte {
+	sum := sha256.Sum256([]byte("callback-data:" + token))
+	return sum[:]
+}
+
+func (r *messageRouter) inlineKeyboard(buttons []InlineButton) (models.ReplyMarkup, error) {
+	if len(buttons) == 0 {
+		return nil, nil
+	}
+
+	row := make([]models.InlineKeyboardButton, 0, len(buttons))
+	for _, button := range buttons {
+		data, err := r.signCallbackData(button.Data)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, models.InlineKeyboardButton{Text: button.Text, CallbackData: data})
+	}
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}, nil
+}
@@ -0,0 +1,253 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func TestRouteCallbackDispatchesByNamespaceAndAnswers(t *testing.T) {
+	answers := stubAnswerCallbackQuery(t)
+	router := newCallbackTestRouter(&stubUserFetcher{})
+
+	var got CallbackRequest
+	if err := router.registerCallback(Callback{Namespace: "order", Handler: func(_ context.Context, req CallbackRequest) (string, error) {
+		got = req
+		return "Refund requested.", nil
+	}}); err != nil {
+		t.Fatalf("registerCallback returned error: %v", err)
+	}
+	noop := func(context.Context, CallbackRequest) (string, error) { return "", nil }
+	if err := router.registerCallback(Callback{Namespace: "order", Handler: noop}); err == nil {
+		t.Fatalf("expected duplicate namespace to be rejected")
+	}
+	if err := router.registerCallback(Callback{Namespace: "bad:ns", Handler: noop}); err == nil {
+		t.Fatalf("expected invalid namespace to be rejected")
+	}
+	if err := router.registerCallback(Callback{Namespace: "other", MinRole: "root", Handler: noop}); err == nil {
+		t.Fatalf("expected unknown role to be rejected")
+	}
+
+	update := signedCallbackUpdate(t, router, "q1", CallbackData("order", "refund", "ord_1"))
+	if handler := router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update)); handler != "callback_order" {
+		t.Fatalf("expected order callback handler, got %q", handler)
+	}
+	if got.UserID != 42 || got.ChatID != 42 || got.MessageID != 9 || got.Data != "order:refund:ord_1" || strings.Join(got.Args, ",") != "refund,ord_1" {
+		t.Fatalf("unexpected callback request %+v", got)
+	}
+	if !got.IssuedAt.Equal(router.now().Truncate(time.Second)) {
+		t.Fatalf("expected issue time %v, got %v", router.now(), got.IssuedAt)
+	}
+	if len(*answers) != 1 || (*answers)[0].CallbackQueryID != "q1" || (*answers)[0].Text != "Refund requested." || (*answers)[0].ShowAlert {
+		t.Fatalf("expected the query to be answered with the notice, got %+v", *answers)
+	}
+
+	unknown := signedCallbackUpdate(t, router, "q2", "missing:1")
+	if handler := router.route(context.Background(), &bot.Bot{}, unknown, extractUpdateMeta(unknown)); handler != "callback_unknown" {
+		t.Fatalf("expected unknown callback handler, got %q", handler)
+	}
+	if len(*answers) != 2 || (*answers)[1].Text != "" {
+		t.Fatalf("expected unknown callbacks to be answered silently, got %+v", *answers)
+	}
+}
+
+func TestRouteCallbackRejectsTamperedAndExpiredButtons(t *testing.T) {
+	answers := stubAnswerCallbackQuery(t)
+	router := newCallbackTestRouter(&stubUserFetcher{})
+
+	calls := 0
+	if err := router.registerCallback(Callback{Namespace: "order", TTL: time.Hour, Handler: func(context.Context, CallbackRequest) (string, error) {
+		calls++
+		return "", nil
+	}}); err != nil {
+		t.Fatalf("registerCallback returned error: %v", err)
+	}
+
+	signed, err := router.signCallbackData("order:refund:ord_1")
+	if err != nil {
+		t.Fatalf("signCallbackData returned error: %v", err)
+	}
+	for _, data := range []string{
+		strings.Replace(signed, "ord_1", "ord_2", 1),
+		"order:refund:ord_1",
+		"",
+	} {
+		update := callbackUpdate("q", data)
+		if handler := router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update)); handler != "callback_invalid" {
+			t.Fatalf("expected %q to be rejected, got handler %q", data, handler)
+		}
+	}
+	if last := (*answers)[len(*answers)-1]; last.Text != callbackInvalidText || !last.ShowAlert {
+		t.Fatalf("expected invalid buttons to be answered with an alert, got %+v", last)
+	}
+
+	update := callbackUpdate("q", signed)
+	router.now = func() time.Time { return time.Date(2026, 5, 6, 9, 0, 1, 0, time.UTC) }
+	router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	if last := (*answers)[len(*answers)-1]; last.Text != callbackExpiredText {
+		t.Fatalf("expected stale button to expire, got %+v", last)
+	}
+	if calls != 0 {
+		t.Fatalf("expected rejected buttons not to reach the handler, got %d calls", calls)
+	}
+}
+
+func TestRouteCallbackEnforcesMinRole(t *testing.T) {
+	answers := stubAnswerCallbackQuery(t)
+	fetcher := &stubUserFetcher{user: domain.User{UserID: 42, Role: domain.RoleUser}}
+	router := newCallbackTestRouter(fetcher)
+	auditor := &recordingAuditor{}
+	router.auditor = auditor
+
+	var role string
+	if err := router.registerCallback(Callback{Namespace: "order", MinRole: domain.RoleAdmin, Handler: func(_ context.Context, req CallbackRequest) (string, error) {
+		role = req.Role
+		return "done", nil
+	}}); err != nil {
+		t.Fatalf("registerCallback returned error: %v", err)
+	}
+
+	update := signedCallbackUpdate(t, router, "q1", "order:refund:ord_1")
+	router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	if role != "" || (*answers)[0].Text != permissionDeniedText || !(*answers)[0].ShowAlert {
+		t.Fatalf("expected users to be denied, got role=%q answers=%+v", role, *answers)
+	}
+
+	fetcher.user.Role = domain.RoleAdmin
+	router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	if role != domain.RoleAdmin || (*answers)[1].Text != "done" {
+		t.Fatalf("expected admins to pass with their role, got role=%q answers=%+v", role, *answers)
+	}
+
+	if len(auditor.records) != 2 || auditor.records[0].Allowed || auditor.records[0].Reason != "insufficient_role" || !auditor.records[1].Allowed || !auditor.records[1].Callback {
+		t.Fatalf("expected denied and allowed presses to be audited, got %+v", auditor.records)
+	}
+	if auditor.records[1].Command != "order" || strings.Join(auditor.records[1].Args, " ") != "refund ord_1" {
+		t.Fatalf("unexpected audit record %+v", auditor.records[1])
+	}
+}
+
+func TestRouteCallbackAnswersHandlerErrors(t *testing.T) {
+	answers := stubAnswerCallbackQuery(t)
+	router := newCallbackTestRouter(&stubUserFetcher{})
+	if err := router.registerCallback(Callback{Namespace: "order", Handler: func(context.Context, CallbackRequest) (string, error) {
+		return "", errors.New("mongo down")
+	}}); err != nil {
+		t.Fatalf("registerCallback returned error: %v", err)
+	}
+
+	update := signedCallbackUpdate(t, router, "q1", "order:refund:ord_1")
+	router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	if (*answers)[0].Text != callbackFailedText {
+		t.Fatalf("expected generic failure notice, got %q", (*answers)[0].Text)
+	}
+}
+
+func TestSendTextAttachesSignedButtons(t *testing.T) {
+	fb := &fakeBot{}
+	router := newCallbackTestRouter(&stubUserFetcher{})
+	client := &Client{bot: fb, router: router}
+
+	err := client.SendText(context.Background(), 42, "Send?",
+		InlineButton{Text: "Yes", Data: CallbackData("broadcast", "confirm", "bc_0123456789ab")},
+		InlineButton{Text: "No", Data: CallbackData("broadcast", "cancel", "bc_0123456789ab")},
+	)
+	if err != nil {
+		t.Fatalf("SendText returned error: %v", err)
+	}
+	if len(fb.sendCalls) != 1 {
+		t.Fatalf("expected one sendMessage call, got %d", len(fb.sendCalls))
+	}
+	markup, ok := fb.sendCalls[0].ReplyMarkup.(*models.InlineKeyboardMarkup)
+	if !ok || len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 2 {
+		t.Fatalf("unexpected reply markup %+v", fb.sendCalls[0].ReplyMarkup)
+	}
+	signed := markup.InlineKeyboard[0][1].CallbackData
+	if len(signed) > callbackDataMaxBytes {
+		t.Fatalf("expected signed data within %d bytes, got %d", callbackDataMaxBytes, len(signed))
+	}
+	if data, _, err := router.verifyCallbackData(signed); err != nil || data != "broadcast:cancel:bc_0123456789ab" {
+		t.Fatalf("expected button data to verify, got %q err=%v", data, err)
+	}
+
+	if err := client.SendText(context.Background(), 42, "x", InlineButton{Text: "Big", Data: strings.Repeat("a", 50)}); err == nil {
+		t.Fatalf("expected oversized callback data to be rejected")
+	}
+
+	if err := client.EditText(context.Background(), 42, 9, "Done."); err != nil {
+		t.Fatalf("EditText returned error: %v", err)
+	}
+	if len(fb.editCalls) != 1 || fb.editCalls[0].ReplyMarkup != nil {
+		t.Fatalf("expected edit without buttons to drop the keyboard, got %+v", fb.editCalls)
+	}
+}
+
+func TestDeliveryErrorHelpers(t *testing.T) {
+	if !IsBlocked(errors.Join(bot.ErrorForbidden, errors.New("bot was blocked by the user"))) {
+		t.Fatalf("expected forbidden errors to be reported as blocked")
+	}
+	if IsBlocked(errors.New("chat not found")) {
+		t.Fatalf("expected other errors not to be reported as blocked")
+	}
+	if wait, ok := RetryAfter(&bot.TooManyRequestsError{RetryAfter: 3}); !ok || wait != 3*time.Second {
+		t.Fatalf("expected 3s retry after, got %v ok=%v", wait, ok)
+	}
+	if !IsBadRequest(fmt.Errorf("%w, CHARGE_ALREADY_REFUNDED", bot.ErrorBadRequest)) || IsBadRequest(bot.ErrorForbidden) {
+		t.Fatalf("expected only 400 errors to be reported as bad requests")
+	}
+	if _, ok := RetryAfter(bot.ErrorForbidden); ok {
+		t.Fatalf("expected non-429 errors to have no retry after")
+	}
+}
+
+func newCallbackTestRouter(fetcher UserFetcher) *messageRouter {
+	router := newMessageRouter(logrus.NewEntry(logrus.New()), 42, commandDiagnostics{userFetcher: fetcher})
+	router.callbackKey = callbackSigningKey("test-token")
+	router.now = func() time.Time { return time.Date(2026, 5, 6, 7, 8, 9, 0, time.UTC) }
+	return router
+}
+
+func stubAnswerCallbackQuery(t *testing.T) *[]*bot.AnswerCallbackQueryParams {
+	t.Helper()
+
+	origAnswer := answerCallbackQuery
+	t.Cleanup(func() { answerCallbackQuery = origAnswer })
+
+	answers := &[]*bot.AnswerCallbackQueryParams{}
+	answerCallbackQuery = func(_ context.Context, _ *bot.Bot, params *bot.AnswerCallbackQueryParams) (bool, error) {
+		*answers = append(*answers, params)
+		return true, nil
+	}
+	return answers
+}
+
+func signedCallbackUpdate(t *testing.T, router *messageRouter, id, data string) *models.Update {
+	t.Helper()
+
+	signed, err := router.signCallbackData(data)
+	if err != nil {
+		t.Fatalf("signCallbackData returned error: %v", err)
+	}
+	return callbackUpdate(id, signed)
+}
+
+func callbackUpdate(id, data string) *models.Update {
+	return &models.Update{CallbackQuery: &models.CallbackQuery{
+		ID:   id,
+		From: models.User{ID: 42},
+		Data: data,
+		Message: models.MaybeInaccessibleMessage{
+			Type:    models.MaybeInaccessibleMessageTypeMessage,
+			Message: &models.Message{ID: 9, Chat: models.Chat{ID: 42, Type: models.ChatTypePrivate}},
+		},
+	}}
+}
@@ -0,0 +1,302 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// Normalized chat types accepted by Command.ChatTypes. Supergroups are treated
+// as groups.
+const (
+	ChatTypePrivate = "private"
+	ChatTypeGroup   = "group"
+)
+
+const (
+	commandRoleLookupTimeout = 2 * time.Second
+	permissionDeniedText     = "permission denied"
+)
+
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Command describes a slash command served by the router. Feature packages
+// build Commands and register them on the Client before Start is called.
+type Command struct {
+	// Name is the command without the leading slash, e.g. "status".
+	Name string
+	// Description is the short help text shown to users.
+	Description string
+	// MinRole is the lowest domain role allowed to run the command. Empty means
+	// the command is public.
+	MinRole string
+	// ChatTypes limits the chats where the command is accepted. Empty means any
+	// chat type.
+	ChatTypes []string
+	// Handler runs after the chat type and role checks pass.
+	Handler bot.HandlerFunc
+}
+
+// CommandAudit describes a privileged command invocation or a denied command
+// for the audit trail.
+type CommandAudit struct {
+	Command string
+	Args    []string
+	UserID  int64
+	ChatID  int64
+	Role    string
+	MinRole string
+	Allowed bool
+	Reason  string
+	// Callback marks an inline button press: Command is the callback
+	// namespace and Args the data fields after it.
+	Callback bool
+}
+
+type registeredCommand struct {
+	Command
+	handlerName string
+}
+
+func (c Command) validate() error {
+	if !commandNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid command name %q: use 1-32 characters of a-z, 0-9 and _", c.Name)
+	}
+	if c.Handler == nil {
+		return fmt.Errorf("command %q: handler is required", c.Name)
+	}
+	if c.MinRole != "" && domain.RolePriority(c.MinRole) == 0 {
+		return fmt.Errorf("command %q: unknown role %q", c.Name, c.MinRole)
+	}
+	for _, chatType := range c.ChatTypes {
+		if chatType != ChatTypePrivate && chatType != ChatTypeGroup {
+			return fmt.Errorf("command %q: unsupported chat type %q", c.Name, chatType)
+		}
+	}
+
+	return nil
+}
+
+func (c Command) allowsChatType(chatType string) bool {
+	if len(c.ChatTypes) == 0 {
+		return true
+	}
+
+	for _, allowed := range c.ChatTypes {
+		if allowed == chatType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RegisterCommand adds a command to the router. Registration must happen
+// before Start; duplicate names are rejected.
+func (c *Client) RegisterCommand(cmd Command) error {
+	if c == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	return c.router.register(cmd)
+}
+
+// RegisterCommands registers each command in order, stopping at the first
+// error.
+func (c *Client) RegisterCommands(cmds ...Command) error {
+	for _, cmd := range cmds {
+		if err := c.RegisterCommand(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Commands returns the registered commands in registration order.
+func (c *Client) Commands() []Command {
+	if c == nil || c.router == nil {
+		return nil
+	}
+
+	return c.router.commandList()
+}
+
+func (r *messageRouter) register(cmd Command) error {
+	cmd.Name = strings.ToLower(strings.TrimSpace(cmd.Name))
+	cmd.Description = strings.TrimSpace(cmd.Description)
+
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.commands[cmd.Name]; exists {
+		return fmt.Errorf("command %q is already registered", cmd.Name)
+	}
+
+	r.commands[cmd.Name] = registeredCommand{
+		Command:     cmd,
+		handlerName: "command_" + cmd.Name,
+	}
+	r.commandOrder = append(r.commandOrder, cmd.Name)
+
+	return nil
+}
+
+func (r *messageRouter) lookup(name string) (registeredCommand, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+func (r *messageRouter) commandList() []Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Command, 0, len(r.commandOrder))
+	for _, name := range r.commandOrder {
+		list = append(list, r.commands[name].Command)
+	}
+
+	return list
+}
+
+// authorize enforces the command's minimum role, replying with a uniform
+// permission denied message when the caller is not allowed. Allowed callers get
+// a context carrying their resolved role; public commands skip the lookup.
+func (r *messageRouter) authorize(ctx context.Context, b *bot.Bot, cmd registeredCommand, meta updateMeta) (context.Context, bool) {
+	if cmd.MinRole == "" {
+		return ctx, true
+	}
+
+	role, reason, err := r.resolveRole(ctx, meta)
+	if reason == "" {
+		allowed := domain.RolePriority(role) >= domain.RolePriority(cmd.MinRole)
+		if cmd.MinRole == domain.RoleOwner && meta.userID != r.botOwnerID {
+			allowed = false
+		}
+		if allowed {
+			r.audit(ctx, cmd, meta, role, "")
+			return context.WithValue(ctx, callerRoleKey{}, role), true
+		}
+		reason = "insufficient_role"
+	}
+
+	r.audit(ctx, cmd, meta, role, reason)
+
+	fields := logging.Fields{
+		"event":     "command_denied",
+		"handler":   cmd.handlerName,
+		"command":   cmd.Name,
+		"reason":    reason,
+		"required":  cmd.MinRole,
+		"role":      role,
+		"user_id":   meta.userID,
+		"chat_id":   meta.chatID,
+		"chat_type": normalizeChatType(meta.chatType),
+	}
+
+	entry := r.logger.WithFields(fields)
+	if err != nil {
+		entry.WithError(err).Error("command denied after user lookup failure")
+	} else {
+		entry.Info("command denied")
+	}
+
+	r.replyPermissionDenied(ctx, b, cmd, meta)
+
+	return ctx, false
+}
+
+// audit reports allowed admin and owner commands and every denial to the
+// configured auditor. User-level commands that pass are not recorded.
+func (r *messageRouter) audit(ctx context.Context, cmd registeredCommand, meta updateMeta, role, reason string) {
+	if r.auditor == nil {
+		return
+	}
+	if reason == "" && domain.RolePriority(cmd.MinRole) < domain.RolePriorityAdmin {
+		return
+	}
+
+	r.auditor.AuditCommand(ctx, CommandAudit{
+		Command: cmd.Name,
+		Args:    commandArgs(meta.text),
+		UserID:  meta.userID,
+		ChatID:  meta.chatID,
+		Role:    role,
+		MinRole: cmd.MinRole,
+		Allowed: reason == "",
+		Reason:  reason,
+	})
+}
+
+type callerRoleKey struct{}
+
+// CallerRole returns the role resolved for the caller while authorizing the
+// current command, or "" when the command is public.
+func CallerRole(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	role, _ := ctx.Value(callerRoleKey{}).(string)
+	return role
+}
+
+func (r *messageRouter) resolveRole(ctx context.Context, meta updateMeta) (string, string, error) {
+	if meta.userID == 0 {
+		return "", "missing_user_id", nil
+	}
+	if r.userFetcher == nil {
+		return "", "user_lookup_missing", nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, commandRoleLookupTimeout)
+	defer cancel()
+
+	user, err := r.userFetcher.GetByID(lookupCtx, meta.userID)
+	if err != nil {
+		return "", "user_lookup_failed", err
+	}
+
+	return strings.TrimSpace(user.Role), "", nil
+}
+
+func (r *messageRouter) replyPermissionDenied(ctx context.Context, b *bot.Bot, cmd registeredCommand, meta updateMeta) {
+	fields := logging.Fields{
+		"event":     "command_denied_send_failed",
+		"handler":   cmd.handlerName,
+		"user_id":   meta.userID,
+		"chat_id":   meta.chatID,
+		"chat_type": normalizeChatType(meta.chatType),
+	}
+
+	if meta.chatID == 0 {
+		r.logger.WithFields(fields).Error("cannot send permission denied response without chat_id")
+		return
+	}
+	if b == nil {
+		r.logger.WithFields(fields).Error("cannot send permission denied response without telegram client")
+		return
+	}
+
+	if _, err := sendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID: meta.chatID,
+		Text:   permissionDeniedText,
+	}); err != nil {
+		r.logger.WithFields(fields).WithError(err).Error("failed to send permission denied response")
+	}
+}
@@ -0,0 +1,326 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func noopHandler(context.Context, *bot.Bot, *models.Update) {}
+
+func TestRegisterCommandValidates(t *testing.T) {
+	router := newMessageRouter(logrus.NewEntry(logrus.New()), 0, commandDiagnostics{})
+
+	tests := []struct {
+		name string
+		cmd  Command
+	}{
+		{name: "empty name", cmd: Command{Handler: noopHandler}},
+		{name: "invalid characters", cmd: Command{Name: "bad-name", Handler: noopHandler}},
+		{name: "missing handler", cmd: Command{Name: "valid"}},
+		{name: "unknown role", cmd: Command{Name: "valid", MinRole: "superuser", Handler: noopHandler}},
+		{name: "unknown chat type", cmd: Command{Name: "valid", ChatTypes: []string{"channel"}, Handler: noopHandler}},
+		{name: "duplicate builtin", cmd: Command{Name: "Ping", Handler: noopHandler}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := router.register(tt.cmd); err == nil {
+				t.Fatalf("expected register to fail for %+v", tt.cmd)
+			}
+		})
+	}
+}
+
+func TestClientRegisterCommandRoutesToHandler(t *testing.T) {
+	origCreateBot := createBot
+	defer func() { createBot = origCreateBot }()
+
+	createBot = func(string, ...bot.Option) (botRunner, error) {
+		return &fakeBot{}, nil
+	}
+
+	hookLogger, hook := logtest.NewNullLogger()
+	fetcher := &stubUserFetcher{user: domain.User{UserID: 70, Role: domain.RoleAdmin}}
+
+	client, err := NewClient(config.Config{TelegramToken: "token", BotOwnerID: 1}, logrus.NewEntry(hookLogger),
+		WithUserFetcher(fetcher),
+	)
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+
+	called := 0
+	role := ""
+	if err := client.RegisterCommand(Command{
+		Name:        "Audit",
+		Description: " Show audit trail ",
+		MinRole:     domain.RoleAdmin,
+		Handler: func(ctx context.Context, _ *bot.Bot, _ *models.Update) {
+			called++
+			role = CallerRole(ctx)
+		},
+	}); err != nil {
+		t.Fatalf("RegisterCommand returned error: %v", err)
+	}
+
+	commands := client.Commands()
+	last := commands[len(commands)-1]
+	if last.Name != "audit" || last.Description != "Show audit trail" {
+		t.Fatalf("expected normalized command registration, got %+v", last)
+	}
+	if commands[0].Name != "start" {
+		t.Fatalf("expected builtin commands first, got %s", commands[0].Name)
+	}
+
+	handler := routedHandler(client.logger, nil, nil, client.router)
+	handler(context.Background(), nil, &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 70},
+			Chat: models.Chat{ID: 170, Type: models.ChatTypePrivate},
+			Text: "/audit@my_bot",
+		},
+	})
+
+	if called != 1 {
+		t.Fatalf("expected registered handler to be called once, got %d", called)
+	}
+	if role != domain.RoleAdmin {
+		t.Fatalf("expected handler context to carry the caller role, got %q", role)
+	}
+
+	routeEntry := findEvent(hook.AllEntries(), "telegram_route")
+	if routeEntry == nil || routeEntry.Data["handler"] != "command_audit" {
+		t.Fatalf("expected telegram_route with handler=command_audit, got %v", routeEntry)
+	}
+}
+
+func TestRouterDeniesWhenRoleBelowMinimum(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+
+	origSendMessage := sendMessage
+	defer func() { sendMessage = origSendMessage }()
+
+	var sent []string
+	sendMessage = func(_ context.Context, _ *bot.Bot, params *bot.SendMessageParams) (*models.Message, error) {
+		sent = append(sent, params.Text)
+		return &models.Message{}, nil
+	}
+
+	fetcher := &stubUserFetcher{user: domain.User{UserID: 71, Role: domain.RoleUser}}
+	router := newMessageRouter(logrus.NewEntry(hookLogger), 1, commandDiagnostics{userFetcher: fetcher})
+
+	called := false
+	if err := router.register(Command{
+		Name:    "secret",
+		MinRole: domain.RoleAdmin,
+		Handler: func(context.Context, *bot.Bot, *models.Update) { called = true },
+	}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+
+	update := &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 71},
+			Chat: models.Chat{ID: -171, Type: models.ChatTypeGroup},
+			Text: "/secret",
+		},
+	}
+	router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+
+	if called {
+		t.Fatalf("expected handler not to run for insufficient role")
+	}
+	if len(sent) != 1 || sent[0] != permissionDeniedText {
+		t.Fatalf("expected a single permission denied reply, got %v", sent)
+	}
+
+	entry := findEvent(hook.AllEntries(), "command_denied")
+	if entry == nil {
+		t.Fatalf("expected command_denied log entry")
+	}
+	if entry.Data["role"] != domain.RoleUser || entry.Data["required"] != domain.RoleAdmin {
+		t.Fatalf("expected role=user required=admin, got role=%v required=%v", entry.Data["role"], entry.Data["required"])
+	}
+}
+
+func TestRouterAuditsPrivilegedCommandsAndDenials(t *testing.T) {
+	origSendMessage := sendMessage
+	defer func() { sendMessage = origSendMessage }()
+	sendMessage = func(context.Context, *bot.Bot, *bot.SendMessageParams) (*models.Message, error) {
+		return &models.Message{}, nil
+	}
+
+	fetcher := &stubUserFetcher{user: domain.User{UserID: 72, Role: domain.RoleAdmin}}
+	auditor := &recordingAuditor{}
+	router := newMessageRouter(logrus.NewEntry(logrus.New()), 1, commandDiagnostics{userFetcher: fetcher})
+	router.auditor = auditor
+
+	for _, cmd := range []Command{
+		{Name: "secret", MinRole: domain.RoleAdmin, Handler: noopHandler},
+		{Name: "mine", MinRole: domain.RoleUser, Handler: noopHandler},
+	} {
+		if err := router.register(cmd); err != nil {
+			t.Fatalf("register returned error: %v", err)
+		}
+	}
+
+	send := func(text string) {
+		update := &models.Update{
+			Message: &models.Message{
+				From: &models.User{ID: 72},
+				Chat: models.Chat{ID: 172, Type: models.ChatTypePrivate},
+				Text: text,
+			},
+		}
+		router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	}
+
+	send("/secret shop 10")
+	send("/mine")
+	fetcher.user.Role = domain.RoleUser
+	send("/secret")
+
+	if len(auditor.records) != 2 {
+		t.Fatalf("expected the admin command and the denial to be audited, got %+v", auditor.records)
+	}
+	allowed := auditor.records[0]
+	if !allowed.Allowed || allowed.Command != "secret" || allowed.Role != domain.RoleAdmin || len(allowed.Args) != 2 || allowed.ChatID != 172 {
+		t.Fatalf("unexpected allowed record %+v", allowed)
+	}
+	denied := auditor.records[1]
+	if denied.Allowed || denied.Reason != "insufficient_role" || denied.UserID != 72 || denied.MinRole != domain.RoleAdmin {
+		t.Fatalf("unexpected denied record %+v", denied)
+	}
+}
+
+type recordingAuditor struct {
+	records []CommandAudit
+}
+
+func (a *recordingAuditor) AuditCommand(_ context.Context, record CommandAudit) {
+	a.records = append(a.records, record)
+}
+
+func TestRouterDeniesWhenUserLookupFails(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+
+	origSendMessage := sendMessage
+	defer func() { sendMessage = origSendMessage }()
+
+	sendMessage = func(context.Context, *bot.Bot, *bot.SendMessageParams) (*models.Message, error) {
+		return &models.Message{}, nil
+	}
+
+	fetcher := &stubUserFetcher{err: errors.New("mongo down")}
+	router := newMessageRouter(logrus.NewEntry(hookLogger), 72, commandDiagnostics{userFetcher: fetcher})
+
+	update := &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 72},
+			Chat: models.Chat{ID: 172, Type: models.ChatTypePrivate},
+			Text: "/status",
+		},
+	}
+	router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+
+	entry := findEvent(hook.AllEntries(), "command_denied")
+	if entry == nil {
+		t.Fatalf("expected command_denied log entry")
+	}
+	if entry.Data["reason"] != "user_lookup_failed" {
+		t.Fatalf("expected reason=user_lookup_failed, got %v", entry.Data["reason"])
+	}
+	if entry.Level != logrus.ErrorLevel {
+		t.Fatalf("expected lookup failure to log at error level, got %s", entry.Level)
+	}
+}
+
+func TestRouterDeniesOwnerCommandForOtherOwnerRole(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+
+	fetcher := &stubUserFetcher{user: domain.User{UserID: 73, Role: domain.RoleOwner}}
+	router := newMessageRouter(logrus.NewEntry(hookLogger), 999, commandDiagnostics{userFetcher: fetcher})
+
+	update := &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 73},
+			Chat: models.Chat{ID: 173, Type: models.ChatTypePrivate},
+			Text: "/status",
+		},
+	}
+	router.route(context.Background(), nil, update, extractUpdateMeta(update))
+
+	entry := findEvent(hook.AllEntries(), "command_denied")
+	if entry == nil || entry.Data["reason"] != "insufficient_role" {
+		t.Fatalf("expected insufficient_role denial when user is not BOT_OWNER, got %v", entry)
+	}
+	if findEvent(hook.AllEntries(), "command_status_sent") != nil {
+		t.Fatalf("expected status handler not to run")
+	}
+}
+
+func TestRouterIgnoresCommandOutsideAllowedChatTypes(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	router := newMessageRouter(logrus.NewEntry(hookLogger), 0, commandDiagnostics{})
+
+	update := &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 74},
+			Chat: models.Chat{ID: -174, Type: models.ChatTypeSupergroup},
+			Text: "/start",
+		},
+	}
+	handlerName := router.route(context.Background(), nil, update, extractUpdateMeta(update))
+
+	if handlerName != "command_start" {
+		t.Fatalf("expected handler name command_start, got %s", handlerName)
+	}
+	if findEvent(hook.AllEntries(), "command_ignored") == nil {
+		t.Fatalf("expected command_ignored log entry")
+	}
+	if findEvent(hook.AllEntries(), "command_handler") != nil {
+		t.Fatalf("expected start handler not to run in group chat")
+	}
+}
+
+func TestRouterIgnoresCommandsInEditedMessages(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	router := newMessageRouter(logrus.NewEntry(hookLogger), 0, commandDiagnostics{})
+
+	settled := 0
+	if err := router.register(Command{
+		Name: "settle",
+		Handler: func(context.Context, *bot.Bot, *models.Update) {
+			settled++
+		},
+	}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+
+	message := &models.Message{
+		ID:   9,
+		From: &models.User{ID: 75},
+		Chat: models.Chat{ID: 175, Type: models.ChatTypePrivate},
+		Text: "/settle shop 100 USD",
+	}
+	for _, update := range []*models.Update{{Message: message}, {EditedMessage: message}} {
+		router.route(context.Background(), nil, update, extractUpdateMeta(update))
+	}
+
+	if settled != 1 {
+		t.Fatalf("expected the edit not to settle again, got %d settlements", settled)
+	}
+	if findEvent(hook.AllEntries(), "command_edit_ignored") == nil {
+		t.Fatalf("expected command_edit_ignored log entry")
+	}
+}
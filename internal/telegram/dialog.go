@@ -0,0 +1,429 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// DefaultDialogTTL is how long a conversation waits for the next answer when
+// a Dialog does not set its own TTL.
+const DefaultDialogTTL = 15 * time.Minute
+
+const (
+	dialogCancelHint    = "Send /cancel to stop."
+	dialogCancelledText = "Cancelled."
+	dialogNothingText   = "Nothing to cancel."
+	dialogExpiredText   = "That conversation expired. Please run the command again."
+	dialogStoreTimeout  = 2 * time.Second
+)
+
+// ConversationStore persists dialog state per chat and user. Get returns
+// mongo.ErrNoDocuments when the user has no conversation in the chat.
+type ConversationStore interface {
+	Get(ctx context.Context, chatID, userID int64) (domain.Conversation, error)
+	Save(ctx context.Context, conversation domain.Conversation) error
+	Delete(ctx context.Context, chatID, userID int64) (bool, error)
+}
+
+// WithConversationStore enables multi-step dialogs and the /cancel command.
+func WithConversationStore(store ConversationStore) ClientOption {
+	return func(opts *clientOptions) {
+		opts.conversations = store
+	}
+}
+
+// DialogStep asks for one value of a dialog.
+type DialogStep struct {
+	// Key names the value in DialogRequest.Values.
+	Key string
+	// Prompt is sent when the step is waiting for an answer.
+	Prompt string
+	// Validate checks the answer and returns the value to store. Its error
+	// is shown to the user before the prompt is repeated. Nil accepts any
+	// non-empty text.
+	Validate func(text string) (string, error)
+}
+
+// Dialog declares a multi-step conversation. It is started by a command
+// through Client.StartDialog; the command's role check gates who can enter.
+type Dialog struct {
+	Name string
+	// Command names the command that starts the dialog. Its MinRole is
+	// checked again before Complete runs, so a user whose role was lowered
+	// mid-conversation cannot finish it. Empty skips the check.
+	Command string
+	Steps   []DialogStep
+	// TTL is how long the dialog waits for each answer. Zero uses
+	// DefaultDialogTTL.
+	TTL time.Duration
+	// Complete runs once every step has a value.
+	Complete DialogFunc
+}
+
+// DialogRequest carries a finished dialog passed to a DialogFunc. Update is
+// the message holding the final answer.
+type DialogRequest struct {
+	UserID int64
+	ChatID int64
+	Dialog string
+	Values map[string]string
+	Update *models.Update
+}
+
+// DialogFunc completes a dialog and returns the text to send back. Like
+// ReplyFunc, an error is logged and answered with a generic failure message.
+type DialogFunc func(ctx context.Context, req DialogRequest) (string, error)
+
+// RegisterDialog makes a dialog available to StartDialog. Registration must
+// happen before Start.
+func (c *Client) RegisterDialog(dialog Dialog) error {
+	if c == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	return c.router.registerDialog(dialog)
+}
+
+// RegisterDialogs registers each dialog in order, stopping at the first error.
+func (c *Client) RegisterDialogs(dialogs ...Dialog) error {
+	for _, dialog := range dialogs {
+		if err := c.RegisterDialog(dialog); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartDialog begins the named dialog for userID in chatID, replacing any
+// conversation the user already had there. Values pre-fills steps, which are
+// then skipped. It returns the first prompt for the caller to send.
+func (c *Client) StartDialog(ctx context.Context, name string, chatID, userID int64, values map[string]string) (string, error) {
+	if c == nil || c.router == nil {
+		return "", errors.New("telegram client is not initialized")
+	}
+
+	return c.router.startDialog(ctx, name, chatID, userID, values)
+}
+
+func (r *messageRouter) registerDialog(dialog Dialog) error {
+	dialog.Name = strings.ToLower(strings.TrimSpace(dialog.Name))
+	if !commandNamePattern.MatchString(dialog.Name) {
+		return fmt.Errorf("invalid dialog name %q: use 1-32 characters of a-z, 0-9 and _", dialog.Name)
+	}
+	dialog.Command = strings.ToLower(strings.TrimSpace(dialog.Command))
+	if dialog.Command != "" && !commandNamePattern.MatchString(dialog.Command) {
+		return fmt.Errorf("dialog %q: invalid command name %q", dialog.Name, dialog.Command)
+	}
+	if dialog.Complete == nil {
+		return fmt.Errorf("dialog %q: complete handler is required", dialog.Name)
+	}
+	if len(dialog.Steps) == 0 {
+		return fmt.Errorf("dialog %q: at least one step is required", dialog.Name)
+	}
+	keys := make(map[string]bool, len(dialog.Steps))
+	for _, step := range dialog.Steps {
+		if step.Key == "" || strings.TrimSpace(step.Prompt) == "" {
+			return fmt.Errorf("dialog %q: steps need a key and a prompt", dialog.Name)
+		}
+		if keys[step.Key] {
+			return fmt.Errorf("dialog %q: duplicate step %q", dialog.Name, step.Key)
+		}
+		keys[step.Key] = true
+	}
+	if dialog.TTL < 0 {
+		return fmt.Errorf("dialog %q: ttl must not be negative", dialog.Name)
+	}
+	if dialog.TTL == 0 {
+		dialog.TTL = DefaultDialogTTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.dialogs[dialog.Name]; exists {
+		return fmt.Errorf("dialog %q is already registered", dialog.Name)
+	}
+	r.dialogs[dialog.Name] = dialog
+
+	return nil
+}
+
+// enableConversations sets the dialog store and registers /cancel.
+func (r *messageRouter) enableConversations(store ConversationStore) error {
+	r.conversations = store
+
+	return r.register(Command{
+		Name:        "cancel",
+		Description: "Cancel the current conversation",
+		Handler:     ReplyHandler(r.logger, r.cancelDialog),
+	})
+}
+
+func (r *messageRouter) startDialog(ctx context.Context, name string, chatID, userID int64, values map[string]string) (string, error) {
+	if r.conversations == nil {
+		return "", errors.New("conversation store is not configured")
+	}
+	if chatID == 0 || userID == 0 {
+		return "", errors.New("chat_id and user_id are required")
+	}
+
+	r.mu.RLock()
+	dialog, ok := r.dialogs[name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("dialog %q is not registered", name)
+	}
+
+	conversation := domain.Conversation{
+		ChatID: chatID,
+		UserID: userID,
+		Dialog: dialog.Name,
+		Values: make(map[string]string, len(dialog.Steps)),
+	}
+	for key, value := range values {
+		conversation.Values[key] = value
+	}
+
+	// Dialogs whose every step is pre-filled still need an answer to finish,
+	// so callers should only start a dialog for missing values.
+	conversation.Step = nextDialogStep(dialog, conversation.Values, 0)
+	if conversation.Step >= len(dialog.Steps) {
+		return "", fmt.Errorf("dialog %q: every step is already filled", dialog.Name)
+	}
+	conversation.ExpiresAt = r.now().Add(dialog.TTL)
+
+	if err := r.conversations.Save(ctx, conversation); err != nil {
+		return "", err
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":   "dialog_started",
+		"dialog":  dialog.Name,
+		"user_id": userID,
+		"chat_id": chatID,
+	}).Info("started dialog")
+
+	return dialogPrompt(dialog.Steps[conversation.Step]), nil
+}
+
+// routeDialog hands a plain text message to the sender's active conversation.
+// It reports false when there is none, leaving the message to the generic
+// handler.
+func (r *messageRouter) routeDialog(ctx context.Context, b *bot.Bot, update *models.Update, meta updateMeta) (string, bool) {
+	if r.conversations == nil || update.Message == nil || meta.userID == 0 || meta.chatID == 0 {
+		return "", false
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, dialogStoreTimeout)
+	conversation, err := r.conversations.Get(lookupCtx, meta.chatID, meta.userID)
+	cancel()
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			r.logger.WithFields(logging.Fields{
+				"event":   "dialog_lookup_failed",
+				"user_id": meta.userID,
+				"chat_id": meta.chatID,
+			}).WithError(err).Error("failed to load conversation")
+		}
+		return "", false
+	}
+
+	r.mu.RLock()
+	dialog, ok := r.dialogs[conversation.Dialog]
+	r.mu.RUnlock()
+
+	handlerName := "dialog_" + conversation.Dialog
+	chatType := normalizeChatType(meta.chatType)
+
+	if !ok || conversation.Step < 0 || conversation.Step >= len(dialog.Steps) {
+		// Left behind by a dialog that was removed or reshaped.
+		r.deleteConversation(ctx, meta, handlerName)
+		return "", false
+	}
+
+	r.logRoute(meta, chatType, handlerName, "dialog", "")
+
+	if conversation.Expired(r.now()) {
+		r.deleteConversation(ctx, meta, handlerName)
+		r.replyDialog(ctx, b, meta, handlerName, dialogExpiredText)
+		return handlerName, true
+	}
+
+	step := dialog.Steps[conversation.Step]
+	value, err := validateDialogAnswer(step, meta.text)
+	if err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   "dialog_invalid_answer",
+			"dialog":  dialog.Name,
+			"step":    step.Key,
+			"user_id": meta.userID,
+			"chat_id": meta.chatID,
+		}).WithError(err).Info("rejected dialog answer")
+		r.replyDialog(ctx, b, meta, handlerName, err.Error()+"\n\n"+dialogPrompt(step))
+		return handlerName, true
+	}
+
+	if conversation.Values == nil {
+		conversation.Values = make(map[string]string, len(dialog.Steps))
+	}
+	conversation.Values[step.Key] = value
+	conversation.Step = nextDialogStep(dialog, conversation.Values, conversation.Step+1)
+
+	if conversation.Step < len(dialog.Steps) {
+		conversation.ExpiresAt = r.now().Add(dialog.TTL)
+		if err := r.conversations.Save(ctx, conversation); err != nil {
+			r.logger.WithFields(logging.Fields{
+				"event":   handlerName + "_error",
+				"user_id": meta.userID,
+				"chat_id": meta.chatID,
+			}).WithError(err).Error("failed to save conversation")
+			r.replyDialog(ctx, b, meta, handlerName, commandFailedText)
+			return handlerName, true
+		}
+		r.replyDialog(ctx, b, meta, handlerName, dialogPrompt(dialog.Steps[conversation.Step]))
+		return handlerName, true
+	}
+
+	// Remove the state first so a failing handler cannot leave the user stuck.
+	r.deleteConversation(ctx, meta, handlerName)
+
+	ctx, allowed := r.authorizeDialog(ctx, b, dialog, meta, handlerName)
+	if !allowed {
+		return handlerName, true
+	}
+
+	text, err := dialog.Complete(ctx, DialogRequest{
+		UserID: meta.userID,
+		ChatID: meta.chatID,
+		Dialog: dialog.Name,
+		Values: conversation.Values,
+		Update: update,
+	})
+	if err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   handlerName + "_error",
+			"user_id": meta.userID,
+			"chat_id": meta.chatID,
+		}).WithError(err).Error("dialog handler failed")
+		text = commandFailedText
+	}
+
+	r.logger.WithFields(logging.Fields{
+		"event":   "dialog_completed",
+		"dialog":  dialog.Name,
+		"user_id": meta.userID,
+		"chat_id": meta.chatID,
+	}).Info("completed dialog")
+
+	r.replyDialog(ctx, b, meta, handlerName, text)
+
+	return handlerName, true
+}
+
+// authorizeDialog applies the starting command's role check again before the
+// dialog completes, replying and auditing like the command would. Allowed
+// callers get a context carrying their resolved role.
+func (r *messageRouter) authorizeDialog(ctx context.Context, b *bot.Bot, dialog Dialog, meta updateMeta, handlerName string) (context.Context, bool) {
+	if dialog.Command == "" {
+		return ctx, true
+	}
+
+	cmd, ok := r.lookup(dialog.Command)
+	if !ok {
+		r.logger.WithFields(logging.Fields{
+			"event":   handlerName + "_error",
+			"command": dialog.Command,
+			"user_id": meta.userID,
+			"chat_id": meta.chatID,
+		}).Error("dialog command is not registered")
+		r.replyDialog(ctx, b, meta, handlerName, commandFailedText)
+		return ctx, false
+	}
+
+	// The answer is not the command's arguments; keep it out of the audit.
+	meta.text = "/" + cmd.Name
+
+	return r.authorize(ctx, b, cmd, meta)
+}
+
+func (r *messageRouter) cancelDialog(ctx context.Context, req CommandRequest) (string, error) {
+	if r.conversations == nil {
+		return dialogNothingText, nil
+	}
+
+	existed, err := r.conversations.Delete(ctx, req.ChatID, req.UserID)
+	if err != nil {
+		return "", err
+	}
+	if !existed {
+		return dialogNothingText, nil
+	}
+
+	return dialogCancelledText, nil
+}
+
+func (r *messageRouter) deleteConversation(ctx context.Context, meta updateMeta, handlerName string) {
+	if _, err := r.conversations.Delete(ctx, meta.chatID, meta.userID); err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   handlerName + "_delete_failed",
+			"user_id": meta.userID,
+			"chat_id": meta.chatID,
+		}).WithError(err).Error("failed to delete conversation")
+	}
+}
+
+func (r *messageRouter) replyDialog(ctx context.Context, b *bot.Bot, meta updateMeta, handlerName, text string) {
+	if strings.TrimSpace(text) == "" || b == nil {
+		return
+	}
+
+	if _, err := sendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID: meta.chatID,
+		Text:   text,
+	}); err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   handlerName + "_send_failed",
+			"user_id": meta.userID,
+			"chat_id": meta.chatID,
+		}).WithError(err).Error("failed to send dialog response")
+	}
+}
+
+// nextDialogStep returns the first step from start on without a value, or
+// len(dialog.Steps) when all are answered.
+func nextDialogStep(dialog Dialog, values map[string]string, start int) int {
+	for i := start; i < len(dialog.Steps); i++ {
+		if _, ok := values[dialog.Steps[i].Key]; !ok {
+			return i
+		}
+	}
+
+	return len(dialog.Steps)
+}
+
+func validateDialogAnswer(step DialogStep, text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if step.Validate != nil {
+		return step.Validate(text)
+	}
+	if text == "" {
+		return "", errors.New("Please send a text answer.")
+	}
+
+	return text, nil
+}
+
+func dialogPrompt(step DialogStep) string {
+	return step.Prompt + "\n" + dialogCancelHint
+}
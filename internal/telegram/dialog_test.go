@@ -0,0 +1,280 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func TestRouteDialogCollectsStepsAndCompletes(t *testing.T) {
+	sent := stubDialogSend(t)
+	store := newFakeConversations()
+	router := newDialogTestRouter(t, store)
+
+	var got DialogRequest
+	if err := router.registerDialog(Dialog{
+		Name: "payout",
+		Steps: []DialogStep{
+			{Key: "amount", Prompt: "Amount?", Validate: func(text string) (string, error) {
+				if _, err := strconv.Atoi(text); err != nil {
+					return "", errors.New("Amount must be a number.")
+				}
+				return text, nil
+			}},
+			{Key: "currency", Prompt: "Currency?"},
+			{Key: "note", Prompt: "Note?"},
+		},
+		Complete: func(_ context.Context, req DialogRequest) (string, error) {
+			got = req
+			return "Payout queued.", nil
+		},
+	}); err != nil {
+		t.Fatalf("registerDialog returned error: %v", err)
+	}
+
+	prompt, err := router.startDialog(context.Background(), "payout", 5, 7, map[string]string{"currency": "USD"})
+	if err != nil {
+		t.Fatalf("startDialog returned error: %v", err)
+	}
+	if !strings.HasPrefix(prompt, "Amount?") || !strings.Contains(prompt, "/cancel") {
+		t.Fatalf("expected first prompt with cancel hint, got %q", prompt)
+	}
+
+	for _, text := range []string{"ten", "10", "rent"} {
+		update := dialogMessage(5, 7, text)
+		if handler := router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update)); handler != "dialog_payout" {
+			t.Fatalf("expected %q to reach the dialog, got handler %q", text, handler)
+		}
+	}
+
+	if len(*sent) != 3 || !strings.HasPrefix((*sent)[0], "Amount must be a number.") || !strings.HasPrefix((*sent)[1], "Note?") || (*sent)[2] != "Payout queued." {
+		t.Fatalf("expected re-prompt, skipped pre-filled step and completion, got %q", *sent)
+	}
+	if got.Values["amount"] != "10" || got.Values["currency"] != "USD" || got.Values["note"] != "rent" || got.UserID != 7 || got.ChatID != 5 {
+		t.Fatalf("unexpected dialog request %+v", got)
+	}
+	if len(store.items) != 0 {
+		t.Fatalf("expected completed conversation to be removed, got %+v", store.items)
+	}
+
+	update := dialogMessage(5, 7, "hello again")
+	if handler := router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update)); handler != "generic_message" {
+		t.Fatalf("expected messages after completion to reach the generic handler, got %q", handler)
+	}
+}
+
+func TestRouteDialogIsScopedToChatAndUserAndExpires(t *testing.T) {
+	sent := stubDialogSend(t)
+	store := newFakeConversations()
+	router := newDialogTestRouter(t, store)
+
+	calls := 0
+	if err := router.registerDialog(Dialog{
+		Name:  "note",
+		TTL:   time.Minute,
+		Steps: []DialogStep{{Key: "text", Prompt: "Text?"}},
+		Complete: func(context.Context, DialogRequest) (string, error) {
+			calls++
+			return "", nil
+		},
+	}); err != nil {
+		t.Fatalf("registerDialog returned error: %v", err)
+	}
+	if _, err := router.startDialog(context.Background(), "note", 5, 7, nil); err != nil {
+		t.Fatalf("startDialog returned error: %v", err)
+	}
+
+	for _, update := range []*models.Update{dialogMessage(5, 8, "other user"), dialogMessage(6, 7, "other chat")} {
+		if handler := router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update)); handler != "generic_message" {
+			t.Fatalf("expected unrelated messages to skip the dialog, got %q", handler)
+		}
+	}
+
+	edited := &models.Update{EditedMessage: dialogMessage(5, 7, "edit").Message}
+	if handler := router.route(context.Background(), &bot.Bot{}, edited, extractUpdateMeta(edited)); handler != "generic_message" {
+		t.Fatalf("expected edited messages to skip the dialog, got %q", handler)
+	}
+
+	router.now = func() time.Time { return time.Date(2026, 5, 6, 7, 9, 10, 0, time.UTC) }
+	update := dialogMessage(5, 7, "late")
+	router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	if calls != 0 || len(*sent) != 1 || (*sent)[0] != dialogExpiredText {
+		t.Fatalf("expected expired conversation to be rejected, got calls=%d sent=%q", calls, *sent)
+	}
+	if len(store.items) != 0 {
+		t.Fatalf("expected expired conversation to be removed")
+	}
+}
+
+func TestRouteDialogRechecksCommandRoleBeforeCompleting(t *testing.T) {
+	sent := stubDialogSend(t)
+	store := newFakeConversations()
+	fetcher := &stubUserFetcher{user: domain.User{UserID: 7, Role: domain.RoleAdmin}}
+	router := newMessageRouter(logrus.NewEntry(logrus.New()), 1, commandDiagnostics{userFetcher: fetcher})
+	router.now = func() time.Time { return time.Date(2026, 5, 6, 7, 8, 9, 0, time.UTC) }
+	if err := router.enableConversations(store); err != nil {
+		t.Fatalf("enableConversations returned error: %v", err)
+	}
+	auditor := &recordingAuditor{}
+	router.auditor = auditor
+
+	if err := router.register(Command{Name: "payout", MinRole: domain.RoleAdmin, Handler: noopHandler}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+	var roles []string
+	if err := router.registerDialog(Dialog{
+		Name:    "payout",
+		Command: "payout",
+		Steps:   []DialogStep{{Key: "amount", Prompt: "Amount?"}},
+		Complete: func(ctx context.Context, _ DialogRequest) (string, error) {
+			roles = append(roles, CallerRole(ctx))
+			return "Payout queued.", nil
+		},
+	}); err != nil {
+		t.Fatalf("registerDialog returned error: %v", err)
+	}
+
+	for _, role := range []string{domain.RoleAdmin, domain.RoleUser} {
+		if _, err := router.startDialog(context.Background(), "payout", 5, 7, nil); err != nil {
+			t.Fatalf("startDialog returned error: %v", err)
+		}
+		fetcher.user.Role = role
+		update := dialogMessage(5, 7, "10")
+		router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	}
+
+	if len(roles) != 1 || roles[0] != domain.RoleAdmin {
+		t.Fatalf("expected only the admin to complete the dialog, got %v", roles)
+	}
+	if len(*sent) != 2 || (*sent)[0] != "Payout queued." || (*sent)[1] != permissionDeniedText {
+		t.Fatalf("expected completion then permission denied, got %q", *sent)
+	}
+	if len(store.items) != 0 {
+		t.Fatalf("expected denied conversation to be removed, got %+v", store.items)
+	}
+	if len(auditor.records) != 2 || auditor.records[1].Allowed || len(auditor.records[1].Args) != 0 {
+		t.Fatalf("expected the denial to be audited without the answer, got %+v", auditor.records)
+	}
+}
+
+func TestCancelCommandClearsConversation(t *testing.T) {
+	sent := stubDialogSend(t)
+	store := newFakeConversations()
+	router := newDialogTestRouter(t, store)
+
+	if err := router.registerDialog(Dialog{
+		Name:     "note",
+		Steps:    []DialogStep{{Key: "text", Prompt: "Text?"}},
+		Complete: func(context.Context, DialogRequest) (string, error) { return "done", nil },
+	}); err != nil {
+		t.Fatalf("registerDialog returned error: %v", err)
+	}
+	if _, err := router.startDialog(context.Background(), "note", 5, 7, nil); err != nil {
+		t.Fatalf("startDialog returned error: %v", err)
+	}
+
+	for range 2 {
+		update := dialogMessage(5, 7, "/cancel")
+		if handler := router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update)); handler != "command_cancel" {
+			t.Fatalf("expected /cancel command, got %q", handler)
+		}
+	}
+	if len(*sent) != 2 || (*sent)[0] != dialogCancelledText || (*sent)[1] != dialogNothingText {
+		t.Fatalf("expected cancel then nothing to cancel, got %q", *sent)
+	}
+}
+
+func TestRegisterDialogValidates(t *testing.T) {
+	router := newDialogTestRouter(t, newFakeConversations())
+	complete := func(context.Context, DialogRequest) (string, error) { return "", nil }
+
+	invalid := []Dialog{
+		{Name: "Bad Name", Steps: []DialogStep{{Key: "a", Prompt: "A?"}}, Complete: complete},
+		{Name: "empty", Complete: complete},
+		{Name: "nohandler", Steps: []DialogStep{{Key: "a", Prompt: "A?"}}},
+		{Name: "dupe", Steps: []DialogStep{{Key: "a", Prompt: "A?"}, {Key: "a", Prompt: "Again?"}}, Complete: complete},
+		{Name: "badcmd", Command: "Bad Command", Steps: []DialogStep{{Key: "a", Prompt: "A?"}}, Complete: complete},
+	}
+	for _, dialog := range invalid {
+		if err := router.registerDialog(dialog); err == nil {
+			t.Fatalf("expected dialog %q to be rejected", dialog.Name)
+		}
+	}
+
+	if _, err := router.startDialog(context.Background(), "missing", 5, 7, nil); err == nil {
+		t.Fatalf("expected unknown dialog to be rejected")
+	}
+}
+
+func newDialogTestRouter(t *testing.T, store ConversationStore) *messageRouter {
+	t.Helper()
+
+	router := newMessageRouter(logrus.NewEntry(logrus.New()), 1, commandDiagnostics{})
+	router.now = func() time.Time { return time.Date(2026, 5, 6, 7, 8, 9, 0, time.UTC) }
+	if err := router.enableConversations(store); err != nil {
+		t.Fatalf("enableConversations returned error: %v", err)
+	}
+	return router
+}
+
+func stubDialogSend(t *testing.T) *[]string {
+	t.Helper()
+
+	origSendMessage := sendMessage
+	t.Cleanup(func() { sendMessage = origSendMessage })
+
+	sent := &[]string{}
+	sendMessage = func(_ context.Context, _ *bot.Bot, params *bot.SendMessageParams) (*models.Message, error) {
+		*sent = append(*sent, params.Text)
+		return &models.Message{}, nil
+	}
+	return sent
+}
+
+func dialogMessage(chatID, userID int64, text string) *models.Update {
+	return &models.Update{Message: &models.Message{
+		From: &models.User{ID: userID},
+		Chat: models.Chat{ID: chatID, Type: models.ChatTypePrivate},
+		Text: text,
+	}}
+}
+
+type conversationKey struct{ chatID, userID int64 }
+
+type fakeConversations struct {
+	items map[conversationKey]domain.Conversation
+}
+
+func newFakeConversations() *fakeConversations {
+	return &fakeConversations{items: make(map[conversationKey]domain.Conversation)}
+}
+
+func (f *fakeConversations) Get(_ context.Context, chatID, userID int64) (domain.Conversation, error) {
+	conversation, ok := f.items[conversationKey{chatID, userID}]
+	if !ok {
+		return domain.Conversation{}, mongo.ErrNoDocuments
+	}
+	return conversation, nil
+}
+
+func (f *fakeConversations) Save(_ context.Context, conversation domain.Conversation) error {
+	f.items[conversationKey{conversation.ChatID, conversation.UserID}] = conversation
+	return nil
+}
+
+func (f *fakeConversations) Delete(_ context.Context, chatID, userID int64) (bool, error) {
+	key := conversationKey{chatID, userID}
+	_, ok := f.items[key]
+	delete(f.items, key)
+	return ok, nil
+}
@@ -0,0 +1,324 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// slowHandlerThreshold is the handler latency above which an update is logged
+// as update_handler_slow.
+const slowHandlerThreshold = 5 * time.Second
+
+// DispatcherSettings tunes concurrent update processing.
+type DispatcherSettings struct {
+	// Workers is the number of updates handled concurrently. Each chat is
+	// pinned to one worker so its updates run in arrival order.
+	Workers int
+	// QueueSize bounds the updates waiting across all workers. When a
+	// worker's share is full, intake blocks until it drains, which stops
+	// long polling or holds webhook requests open.
+	QueueSize int
+	// DrainTimeout bounds how long queued and in-flight updates are still
+	// handled after shutdown begins. Updates left after it are discarded.
+	DrainTimeout time.Duration
+}
+
+// DefaultDispatcherSettings returns the production dispatcher settings.
+func DefaultDispatcherSettings() DispatcherSettings {
+	return DispatcherSettings{
+		Workers:      8,
+		QueueSize:    256,
+		DrainTimeout: 5 * time.Second,
+	}
+}
+
+// WithDispatcherSettings overrides the update dispatcher settings. Zero fields
+// keep defaults.
+func WithDispatcherSettings(settings DispatcherSettings) ClientOption {
+	return func(opts *clientOptions) {
+		opts.dispatcher = settings
+	}
+}
+
+// DispatcherStats is a point-in-time snapshot of the update dispatcher.
+type DispatcherStats struct {
+	Workers       int
+	QueueCapacity int
+	// QueueDepth counts updates waiting for a worker, excluding those being
+	// handled.
+	QueueDepth int
+	// Processed counts updates whose handler returned.
+	Processed uint64
+	// BackPressured counts updates that found their worker's queue full and
+	// had to wait.
+	BackPressured uint64
+	// Dropped counts updates discarded because the dispatcher stopped, or its
+	// drain timeout passed, before they were handled.
+	Dropped           uint64
+	HandlerLatencyAvg time.Duration
+	HandlerLatencyMax time.Duration
+}
+
+type dispatchItem struct {
+	b          *bot.Bot
+	update     *models.Update
+	updateType string
+}
+
+// updateDispatcher fans updates out to a fixed worker pool. Updates are
+// sharded by chat (or sender when there is no chat), so different chats are
+// handled concurrently while each chat sees strictly ordered handling.
+type updateDispatcher struct {
+	handler      bot.HandlerFunc
+	metrics      MetricsRecorder
+	logger       *logrus.Entry
+	queues       []chan dispatchItem
+	drainTimeout time.Duration
+	now          func() time.Time
+
+	depth         atomic.Int64
+	processed     atomic.Uint64
+	backPressured atomic.Uint64
+	dropped       atomic.Uint64
+	latencyTotal  atomic.Int64
+	latencyMax    atomic.Int64
+}
+
+func newUpdateDispatcher(settings DispatcherSettings, handler bot.HandlerFunc, logger *logrus.Entry) *updateDispatcher {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	defaults := DefaultDispatcherSettings()
+	if settings.Workers <= 0 {
+		settings.Workers = defaults.Workers
+	}
+	if settings.QueueSize <= 0 {
+		settings.QueueSize = defaults.QueueSize
+	}
+	if settings.DrainTimeout <= 0 {
+		settings.DrainTimeout = defaults.DrainTimeout
+	}
+	perWorker := (settings.QueueSize + settings.Workers - 1) / settings.Workers
+
+	queues := make([]chan dispatchItem, settings.Workers)
+	for i := range queues {
+		queues[i] = make(chan dispatchItem, perWorker)
+	}
+
+	return &updateDispatcher{
+		handler:      handler,
+		metrics:      noopMetrics{},
+		logger:       logger,
+		queues:       queues,
+		drainTimeout: settings.DrainTimeout,
+		now:          time.Now,
+	}
+}
+
+// Dispatch queues the update on its chat's worker, blocking while that
+// worker's queue is full. It gives up when ctx is canceled. It has the
+// bot.HandlerFunc signature so the bot hands every update to it.
+func (d *updateDispatcher) Dispatch(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	meta := extractUpdateMeta(update)
+	key := shardKey(meta)
+	shard := d.shard(key)
+	queue := d.queues[shard]
+	item := dispatchItem{b: b, update: update, updateType: meta.updateType}
+
+	d.depth.Add(1)
+	select {
+	case queue <- item:
+		return
+	default:
+	}
+
+	d.backPressured.Add(1)
+	d.logger.WithFields(logging.Fields{
+		"event":       "update_queue_full",
+		"update_id":   update.ID,
+		"shard":       shard,
+		"shard_key":   key,
+		"queue_depth": d.depth.Load(),
+	}).Warn("update queue full, waiting for a worker")
+
+	select {
+	case queue <- item:
+	case <-ctx.Done():
+		d.depth.Add(-1)
+		d.dropped.Add(1)
+		d.logger.WithFields(logging.Fields{
+			"event":     "update_dropped",
+			"update_id": update.ID,
+			"shard":     shard,
+		}).WithError(ctx.Err()).Warn("dropped update while waiting for queue space")
+	}
+}
+
+// Run starts the workers and blocks until ctx is canceled and the queues are
+// drained. Handlers run on a context that outlives ctx by the drain timeout,
+// so updates already queued at shutdown are still answered; whatever is left
+// when the timeout passes is discarded and counted as dropped.
+func (d *updateDispatcher) Run(ctx context.Context) {
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+			return
+		}
+
+		timer := time.NewTimer(d.drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancelHandlers()
+		case <-stopped:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for shard, queue := range d.queues {
+		wg.Add(1)
+		go func(shard int, queue chan dispatchItem) {
+			defer wg.Done()
+			d.work(ctx, handlerCtx, shard, queue)
+		}(shard, queue)
+	}
+	wg.Wait()
+
+	discarded := 0
+	for _, queue := range d.queues {
+		for drained := false; !drained; {
+			select {
+			case <-queue:
+				discarded++
+			default:
+				drained = true
+			}
+		}
+	}
+	if discarded > 0 {
+		d.depth.Add(int64(-discarded))
+		d.dropped.Add(uint64(discarded))
+		d.logger.WithFields(logging.Fields{
+			"event":     "update_queue_discarded",
+			"discarded": discarded,
+		}).Warn("discarded queued updates after the drain timeout")
+	}
+}
+
+// work handles the queue's updates until ctx is canceled and the queue is
+// empty, or until handlerCtx ends at the drain deadline.
+func (d *updateDispatcher) work(ctx, handlerCtx context.Context, shard int, queue chan dispatchItem) {
+	for handlerCtx.Err() == nil {
+		select {
+		case item := <-queue:
+			d.depth.Add(-1)
+			d.handle(handlerCtx, shard, item)
+			continue
+		default:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case item := <-queue:
+			d.depth.Add(-1)
+			d.handle(handlerCtx, shard, item)
+		}
+	}
+}
+
+// handle runs the handler for one update, recording its latency and keeping
+// the worker alive if the handler panics.
+func (d *updateDispatcher) handle(ctx context.Context, shard int, item dispatchItem) {
+	start := d.now()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			d.logger.WithFields(logging.Fields{
+				"event":     "update_handler_panic",
+				"update_id": item.update.ID,
+				"shard":     shard,
+			}).WithError(fmt.Errorf("panic: %v", recovered)).Error("update handler panicked")
+		}
+
+		latency := d.now().Sub(start)
+		d.metrics.UpdateHandled(item.updateType, latency)
+		d.processed.Add(1)
+		d.latencyTotal.Add(int64(latency))
+		for {
+			current := d.latencyMax.Load()
+			if int64(latency) <= current || d.latencyMax.CompareAndSwap(current, int64(latency)) {
+				break
+			}
+		}
+
+		if latency >= slowHandlerThreshold {
+			d.logger.WithFields(logging.Fields{
+				"event":      "update_handler_slow",
+				"update_id":  item.update.ID,
+				"shard":      shard,
+				"latency_ms": latency.Milliseconds(),
+			}).Warn("slow update handler")
+		}
+	}()
+
+	d.handler(ctx, item.b, item.update)
+}
+
+// Stats returns the current queue and latency figures.
+func (d *updateDispatcher) Stats() DispatcherStats {
+	stats := DispatcherStats{
+		Workers:           len(d.queues),
+		QueueDepth:        int(d.depth.Load()),
+		Processed:         d.processed.Load(),
+		BackPressured:     d.backPressured.Load(),
+		Dropped:           d.dropped.Load(),
+		HandlerLatencyMax: time.Duration(d.latencyMax.Load()),
+	}
+	for _, queue := range d.queues {
+		stats.QueueCapacity += cap(queue)
+	}
+	if stats.Processed > 0 {
+		stats.HandlerLatencyAvg = time.Duration(d.latencyTotal.Load() / int64(stats.Processed))
+	}
+
+	return stats
+}
+
+func (d *updateDispatcher) shard(key int64) int {
+	return int(uint64(key) % uint64(len(d.queues)))
+}
+
+// shardKey picks the ordering key of an update: its chat, or its sender for
+// chatless updates such as inline queries. Updates with neither share key 0.
+func shardKey(meta updateMeta) int64 {
+	if meta.chatID != 0 {
+		return meta.chatID
+	}
+
+	return meta.userID
+}
@@ -0,0 +1,251 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func chatUpdate(id, chatID int64) *models.Update {
+	return &models.Update{
+		ID: id,
+		Message: &models.Message{
+			From: &models.User{ID: chatID},
+			Chat: models.Chat{ID: chatID, Type: models.ChatTypePrivate},
+			Text: "hello",
+		},
+	}
+}
+
+func TestDispatcherKeepsChatOrderAndRunsChatsConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[int64][]int64)
+	slowStarted := make(chan struct{})
+	releaseSlow := make(chan struct{})
+
+	handler := func(_ context.Context, _ *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		if chatID == 1 && update.ID == 1 {
+			close(slowStarted)
+			<-releaseSlow
+		}
+		mu.Lock()
+		seen[chatID] = append(seen[chatID], update.ID)
+		mu.Unlock()
+	}
+
+	dispatcher := newUpdateDispatcher(DispatcherSettings{Workers: 2, QueueSize: 100}, handler, logrus.NewEntry(logrus.New()))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	// Chat 1 blocks on its first update; chat 2 lives on the other worker.
+	for id := int64(1); id <= 5; id++ {
+		dispatcher.Dispatch(ctx, nil, chatUpdate(id, 1))
+	}
+	<-slowStarted
+	for id := int64(1); id <= 5; id++ {
+		dispatcher.Dispatch(ctx, nil, chatUpdate(id, 2))
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen[2]) == 5
+	})
+	mu.Lock()
+	if len(seen[1]) != 0 {
+		t.Fatalf("expected chat 1 to wait behind its slow update, got %v", seen[1])
+	}
+	mu.Unlock()
+	if depth := dispatcher.Stats().QueueDepth; depth != 4 {
+		t.Fatalf("expected 4 queued chat 1 updates, got %d", depth)
+	}
+
+	close(releaseSlow)
+	waitFor(t, func() bool { return dispatcher.Stats().Processed == 10 })
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, chatID := range []int64{1, 2} {
+		for i, id := range seen[chatID] {
+			if id != int64(i+1) {
+				t.Fatalf("expected chat %d updates in order, got %v", chatID, seen[chatID])
+			}
+		}
+	}
+
+	stats := dispatcher.Stats()
+	if stats.Workers != 2 || stats.QueueCapacity != 100 || stats.QueueDepth != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.HandlerLatencyMax <= 0 || stats.HandlerLatencyAvg <= 0 || stats.HandlerLatencyAvg > stats.HandlerLatencyMax {
+		t.Fatalf("expected recorded handler latency, got avg=%s max=%s", stats.HandlerLatencyAvg, stats.HandlerLatencyMax)
+	}
+}
+
+func TestDispatcherAppliesBackPressureWhenQueueIsFull(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	handler := func(context.Context, *bot.Bot, *models.Update) {
+		started <- struct{}{}
+		<-release
+	}
+
+	dispatcher := newUpdateDispatcher(DispatcherSettings{Workers: 1, QueueSize: 1}, handler, logrus.NewEntry(hookLogger))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	dispatcher.Dispatch(ctx, nil, chatUpdate(1, 5))
+	<-started
+	dispatcher.Dispatch(ctx, nil, chatUpdate(2, 5))
+
+	// The worker is busy and the queue holds one update, so intake blocks.
+	blocked := make(chan struct{})
+	go func() {
+		dispatcher.Dispatch(ctx, nil, chatUpdate(3, 5))
+		close(blocked)
+	}()
+	waitFor(t, func() bool { return dispatcher.Stats().BackPressured == 1 })
+	select {
+	case <-blocked:
+		t.Fatalf("expected dispatch to block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if findEvent(hook.AllEntries(), "update_queue_full") == nil {
+		t.Fatalf("expected update_queue_full log entry")
+	}
+
+	release <- struct{}{}
+	<-blocked
+
+	// A canceled intake context gives up instead of waiting forever.
+	dropCtx, cancelDrop := context.WithCancel(context.Background())
+	cancelDrop()
+	dispatcher.Dispatch(dropCtx, nil, chatUpdate(4, 5))
+	if dispatcher.Stats().Dropped != 1 || findEvent(hook.AllEntries(), "update_dropped") == nil {
+		t.Fatalf("expected the update to be dropped, got %+v", dispatcher.Stats())
+	}
+
+	// Stopping drains what is still queued.
+	<-started
+	cancel()
+	close(release)
+	<-done
+
+	stats := dispatcher.Stats()
+	if stats.Processed != 3 || stats.Dropped != 1 || stats.QueueDepth != 0 {
+		t.Fatalf("expected the queued update to be handled on shutdown, got %+v", stats)
+	}
+}
+
+func TestDispatcherDiscardsQueueAfterDrainTimeout(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	started := make(chan struct{}, 1)
+
+	// The handler holds its worker until its context ends at the drain
+	// deadline.
+	handler := func(ctx context.Context, _ *bot.Bot, _ *models.Update) {
+		started <- struct{}{}
+		<-ctx.Done()
+	}
+
+	dispatcher := newUpdateDispatcher(DispatcherSettings{Workers: 1, QueueSize: 4, DrainTimeout: 20 * time.Millisecond}, handler, logrus.NewEntry(hookLogger))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	dispatcher.Dispatch(ctx, nil, chatUpdate(1, 5))
+	dispatcher.Dispatch(ctx, nil, chatUpdate(2, 5))
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected the dispatcher to stop after the drain timeout")
+	}
+
+	stats := dispatcher.Stats()
+	if stats.Processed != 1 || stats.Dropped != 1 || stats.QueueDepth != 0 {
+		t.Fatalf("expected the queued update to be discarded, got %+v", stats)
+	}
+	if findEvent(hook.AllEntries(), "update_queue_discarded") == nil {
+		t.Fatalf("expected update_queue_discarded log entry")
+	}
+}
+
+func TestDispatcherRecoversFromHandlerPanic(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	handled := make(chan int64, 2)
+
+	handler := func(_ context.Context, _ *bot.Bot, update *models.Update) {
+		if update.ID == 1 {
+			panic("boom")
+		}
+		handled <- update.ID
+	}
+
+	dispatcher := newUpdateDispatcher(DispatcherSettings{Workers: 1, QueueSize: 4}, handler, logrus.NewEntry(hookLogger))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	dispatcher.Dispatch(ctx, nil, chatUpdate(1, 9))
+	dispatcher.Dispatch(ctx, nil, chatUpdate(2, 9))
+
+	select {
+	case id := <-handled:
+		if id != 2 {
+			t.Fatalf("expected update 2 after the panic, got %d", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected the worker to survive the panic")
+	}
+	if findEvent(hook.AllEntries(), "update_handler_panic") == nil {
+		t.Fatalf("expected update_handler_panic log entry")
+	}
+}
+
+func TestShardKeyFallsBackToSender(t *testing.T) {
+	// Callback queries on inline messages carry no chat.
+	inline := &models.Update{CallbackQuery: &models.CallbackQuery{From: models.User{ID: 77}, InlineMessageID: "abc"}}
+	if key := shardKey(extractUpdateMeta(inline)); key != 77 {
+		t.Fatalf("expected chatless updates to shard by sender, got %d", key)
+	}
+	if key := shardKey(extractUpdateMeta(chatUpdate(1, -100))); key != -100 {
+		t.Fatalf("expected chat updates to shard by chat, got %d", key)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,363 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+// groupMember is a user who gets a chat member scope in tracked groups.
+type groupMember struct {
+	name   string
+	userID int64
+	menu   []models.BotCommand
+}
+
+type menuScope struct {
+	name     string
+	chatID   int64
+	userID   int64
+	scope    models.BotCommandScope
+	commands []models.BotCommand
+}
+
+// PublishCommands pushes the registered commands to Telegram's command menu
+// with setMyCommands. Public commands go to the default scope (group chats
+// omit private-only commands), known admins get admin commands in their
+// private chats and in every tracked group, and the BOT_OWNER private chat
+// lists every command. Each scope is attempted even when another fails;
+// failures are joined into the result. With many groups this takes one call
+// per group and member, so callers should not wait on it; it stops once ctx
+// is done.
+func (c *Client) PublishCommands(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if c == nil || c.bot == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	scopes, err := c.menuScopes(ctx)
+
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, scope := range scopes {
+		if len(scope.commands) == 0 {
+			continue
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("publish command menus: %w", ctx.Err()))
+			break
+		}
+
+		if _, setErr := c.bot.SetMyCommands(ctx, &bot.SetMyCommandsParams{
+			Commands: scope.commands,
+			Scope:    scope.scope,
+		}); setErr != nil {
+			errs = append(errs, fmt.Errorf("set commands for %s scope: %w", scope.name, setErr))
+			continue
+		}
+
+		fields := logging.Fields{
+			"event":    "telegram_commands_published",
+			"scope":    scope.name,
+			"commands": len(scope.commands),
+		}
+		if scope.chatID != 0 {
+			fields["chat_id"] = scope.chatID
+		}
+		if scope.userID != 0 {
+			fields["user_id"] = scope.userID
+		}
+		c.logger.WithFields(fields).Info("published telegram command menu")
+	}
+
+	return errors.Join(errs...)
+}
+
+// PublishUserCommands refreshes the command menus of a single user after a
+// role change: admins get the admin menu in their private chat and in every
+// tracked group, and anyone else falls back to the default scopes. The
+// BOT_OWNER's menus are left to PublishCommands.
+func (c *Client) PublishUserCommands(ctx context.Context, userID int64, role string) error {
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if c == nil || c.bot == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+	if userID == 0 || userID == c.botOwnerID {
+		return nil
+	}
+
+	scope := &models.BotCommandScopeChat{ChatID: userID}
+	if role != domain.RoleAdmin {
+		if _, err := c.bot.DeleteMyCommands(ctx, &bot.DeleteMyCommandsParams{Scope: scope}); err != nil {
+			return fmt.Errorf("delete commands for user %d: %w", userID, err)
+		}
+
+		c.logger.WithFields(logging.Fields{
+			"event":   "telegram_commands_cleared",
+			"scope":   "admin_chat",
+			"chat_id": userID,
+		}).Info("cleared telegram command menu")
+		return c.publishUserGroupCommands(ctx, userID, role)
+	}
+
+	commands := commandMenu(c.router.commandList(), domain.RoleAdmin, ChatTypePrivate)
+	if _, err := c.bot.SetMyCommands(ctx, &bot.SetMyCommandsParams{
+		Commands: commands,
+		Scope:    scope,
+	}); err != nil {
+		return fmt.Errorf("set commands for user %d: %w", userID, err)
+	}
+
+	c.logger.WithFields(logging.Fields{
+		"event":    "telegram_commands_published",
+		"scope":    "admin_chat",
+		"chat_id":  userID,
+		"commands": len(commands),
+	}).Info("published telegram command menu")
+
+	return c.publishUserGroupCommands(ctx, userID, role)
+}
+
+// PublishGroupCommands sets the chat member scopes of known admins and the
+// BOT_OWNER in one group, for a group the bot has just joined; PublishCommands
+// covers the groups known at startup. Each member is attempted even when
+// another fails.
+func (c *Client) PublishGroupCommands(ctx context.Context, chatID int64) error {
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if c == nil || c.bot == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+	if chatID == 0 {
+		return errors.New("chat id is required")
+	}
+
+	var admins []domain.User
+	if c.userLister != nil {
+		var err error
+		if admins, err = c.userLister.ListByRole(ctx, domain.RoleAdmin); err != nil {
+			return fmt.Errorf("list admins for group %d commands: %w", chatID, err)
+		}
+	}
+
+	members := c.groupMembers(c.router.commandList(), admins)
+	var errs []error
+	for _, m := range members {
+		scope := &models.BotCommandScopeChatMember{ChatID: chatID, UserID: m.userID}
+		if _, err := c.bot.SetMyCommands(ctx, &bot.SetMyCommandsParams{Commands: m.menu, Scope: scope}); err != nil {
+			errs = append(errs, fmt.Errorf("set commands for user %d in chat %d: %w", m.userID, chatID, err))
+		}
+	}
+
+	if len(members) > 0 {
+		c.logger.WithFields(logging.Fields{
+			"event":   "telegram_group_commands_published",
+			"chat_id": chatID,
+			"members": len(members),
+			"failed":  len(errs),
+		}).Info("published telegram command menus for group")
+	}
+
+	return errors.Join(errs...)
+}
+
+// publishUserGroupCommands sets or removes a user's chat member scope in every
+// tracked group, matching what groupMenuScopes publishes for admins.
+func (c *Client) publishUserGroupCommands(ctx context.Context, userID int64, role string) error {
+	if c.groupLister == nil {
+		return nil
+	}
+
+	commands := c.router.commandList()
+	adminMenu := commandMenu(commands, domain.RoleAdmin, ChatTypeGroup)
+	if len(adminMenu) == len(commandMenu(commands, domain.RoleUser, ChatTypeGroup)) {
+		return nil
+	}
+
+	groups, err := c.groupLister.ListActive(ctx)
+	if err != nil {
+		return fmt.Errorf("list groups for user %d commands: %w", userID, err)
+	}
+
+	var errs []error
+	for _, group := range groups {
+		scope := &models.BotCommandScopeChatMember{ChatID: group.ChatID, UserID: userID}
+		if role == domain.RoleAdmin {
+			if _, err := c.bot.SetMyCommands(ctx, &bot.SetMyCommandsParams{Commands: adminMenu, Scope: scope}); err != nil {
+				errs = append(errs, fmt.Errorf("set commands for user %d in chat %d: %w", userID, group.ChatID, err))
+			}
+			continue
+		}
+		if _, err := c.bot.DeleteMyCommands(ctx, &bot.DeleteMyCommandsParams{Scope: scope}); err != nil {
+			errs = append(errs, fmt.Errorf("delete commands for user %d in chat %d: %w", userID, group.ChatID, err))
+		}
+	}
+
+	c.logger.WithFields(logging.Fields{
+		"event":   "telegram_group_commands_refreshed",
+		"scope":   "admin_group",
+		"user_id": userID,
+		"role":    role,
+		"groups":  len(groups),
+		"failed":  len(errs),
+	}).Info("refreshed telegram group command menus")
+
+	return errors.Join(errs...)
+}
+
+func (c *Client) menuScopes(ctx context.Context) ([]menuScope, error) {
+	commands := c.router.commandList()
+
+	scopes := []menuScope{
+		{
+			name:     "default",
+			scope:    &models.BotCommandScopeDefault{},
+			commands: commandMenu(commands, domain.RoleUser, ""),
+		},
+		{
+			name:     "all_group_chats",
+			scope:    &models.BotCommandScopeAllGroupChats{},
+			commands: commandMenu(commands, domain.RoleUser, ChatTypeGroup),
+		},
+	}
+
+	var errs []error
+	var admins []domain.User
+	if c.userLister != nil {
+		var err error
+		admins, err = c.userLister.ListByRole(ctx, domain.RoleAdmin)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("list admins for command menu: %w", err))
+		}
+
+		adminMenu := commandMenu(commands, domain.RoleAdmin, ChatTypePrivate)
+		for _, admin := range admins {
+			if admin.UserID == 0 || admin.UserID == c.botOwnerID {
+				continue
+			}
+			scopes = append(scopes, menuScope{
+				name:     "admin_chat",
+				chatID:   admin.UserID,
+				scope:    &models.BotCommandScopeChat{ChatID: admin.UserID},
+				commands: adminMenu,
+			})
+		}
+	}
+
+	groupScopes, err := c.groupMenuScopes(ctx, commands, admins)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	scopes = append(scopes, groupScopes...)
+
+	if c.botOwnerID != 0 {
+		scopes = append(scopes, menuScope{
+			name:     "owner_chat",
+			chatID:   c.botOwnerID,
+			scope:    &models.BotCommandScopeChat{ChatID: c.botOwnerID},
+			commands: commandMenu(commands, domain.RoleOwner, ChatTypePrivate),
+		})
+	}
+
+	return scopes, errors.Join(errs...)
+}
+
+// groupMenuScopes gives each known admin and the BOT_OWNER a chat member scope
+// in every tracked group, so group commands above the user role (such as
+// /merchant_bind) show up in their group menus. Nothing is returned when no
+// group command needs more than the user role.
+func (c *Client) groupMenuScopes(ctx context.Context, commands []Command, admins []domain.User) ([]menuScope, error) {
+	if c.groupLister == nil {
+		return nil, nil
+	}
+
+	members := c.groupMembers(commands, admins)
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	groups, err := c.groupLister.ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list groups for command menu: %w", err)
+	}
+
+	scopes := make([]menuScope, 0, len(groups)*len(members))
+	for _, group := range groups {
+		for _, m := range members {
+			scopes = append(scopes, menuScope{
+				name:     m.name,
+				chatID:   group.ChatID,
+				userID:   m.userID,
+				scope:    &models.BotCommandScopeChatMember{ChatID: group.ChatID, UserID: m.userID},
+				commands: m.menu,
+			})
+		}
+	}
+
+	return scopes, nil
+}
+
+// groupMembers lists the admins and the BOT_OWNER with the group menu each of
+// them gets, or nothing when no group command needs more than the user role.
+func (c *Client) groupMembers(commands []Command, admins []domain.User) []groupMember {
+	userMenu := commandMenu(commands, domain.RoleUser, ChatTypeGroup)
+	adminMenu := commandMenu(commands, domain.RoleAdmin, ChatTypeGroup)
+	ownerMenu := commandMenu(commands, domain.RoleOwner, ChatTypeGroup)
+	if len(ownerMenu) == len(userMenu) {
+		return nil
+	}
+
+	var members []groupMember
+	if len(adminMenu) > len(userMenu) {
+		for _, admin := range admins {
+			if admin.UserID != 0 && admin.UserID != c.botOwnerID {
+				members = append(members, groupMember{name: "admin_group", userID: admin.UserID, menu: adminMenu})
+			}
+		}
+	}
+	if c.botOwnerID != 0 {
+		members = append(members, groupMember{name: "owner_group", userID: c.botOwnerID, menu: ownerMenu})
+	}
+
+	return members
+}
+
+// commandMenu lists the commands a caller with the given role may run in the
+// given normalized chat type. An empty chat type keeps every chat type.
+func commandMenu(commands []Command, role, chatType string) []models.BotCommand {
+	menu := make([]models.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		if cmd.MinRole != "" && domain.RolePriority(cmd.MinRole) > domain.RolePriority(role) {
+			continue
+		}
+		if chatType != "" && !cmd.allowsChatType(chatType) {
+			continue
+		}
+
+		description := cmd.Description
+		if description == "" {
+			description = cmd.Name
+		}
+
+		menu = append(menu, models.BotCommand{
+			Command:     cmd.Name,
+			Description: description,
+		})
+	}
+
+	return menu
+}
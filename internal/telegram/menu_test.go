@@ -0,0 +1,311 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/domain"
+)
+
+func TestPublishCommandsScopesByRole(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	logger := logrus.NewEntry(hookLogger)
+	fb := &fakeBot{}
+
+	client := &Client{
+		bot:        fb,
+		logger:     logger,
+		router:     newMessageRouter(logger, 1, commandDiagnostics{}),
+		botOwnerID: 1,
+		userLister: &stubUserLister{users: []domain.User{
+			{UserID: 1, Role: domain.RoleAdmin},
+			{UserID: 2, Role: domain.RoleAdmin},
+		}},
+	}
+
+	if err := client.RegisterCommand(Command{
+		Name:        "audit",
+		Description: "Show audit trail",
+		MinRole:     domain.RoleAdmin,
+		Handler:     noopHandler,
+	}); err != nil {
+		t.Fatalf("RegisterCommand returned error: %v", err)
+	}
+
+	if err := client.PublishCommands(context.Background()); err != nil {
+		t.Fatalf("PublishCommands returned error: %v", err)
+	}
+
+	if len(fb.setCommandsCalls) != 4 {
+		t.Fatalf("expected 4 setMyCommands calls (default, groups, admin, owner), got %d", len(fb.setCommandsCalls))
+	}
+
+	assertMenu(t, fb.setCommandsCalls[0].Commands, "start", "ping")
+	if _, ok := fb.setCommandsCalls[0].Scope.(*models.BotCommandScopeDefault); !ok {
+		t.Fatalf("expected default scope first, got %T", fb.setCommandsCalls[0].Scope)
+	}
+
+	assertMenu(t, fb.setCommandsCalls[1].Commands, "ping")
+
+	adminScope, ok := fb.setCommandsCalls[2].Scope.(*models.BotCommandScopeChat)
+	if !ok || adminScope.ChatID != int64(2) {
+		t.Fatalf("expected admin chat scope for user 2, got %#v", fb.setCommandsCalls[2].Scope)
+	}
+	assertMenu(t, fb.setCommandsCalls[2].Commands, "start", "ping", "audit")
+
+	ownerScope, ok := fb.setCommandsCalls[3].Scope.(*models.BotCommandScopeChat)
+	if !ok || ownerScope.ChatID != int64(1) {
+		t.Fatalf("expected owner chat scope for user 1, got %#v", fb.setCommandsCalls[3].Scope)
+	}
+	assertMenu(t, fb.setCommandsCalls[3].Commands, "start", "ping", "status", "audit")
+
+	if findEvent(hook.AllEntries(), "telegram_commands_published") == nil {
+		t.Fatalf("expected telegram_commands_published log entry")
+	}
+}
+
+func TestPublishCommandsScopesAdminsInGroups(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	fb := &fakeBot{}
+
+	client := &Client{
+		bot:        fb,
+		logger:     logger,
+		router:     newMessageRouter(logger, 1, commandDiagnostics{}),
+		botOwnerID: 1,
+		userLister: &stubUserLister{users: []domain.User{
+			{UserID: 1, Role: domain.RoleAdmin},
+			{UserID: 2, Role: domain.RoleAdmin},
+		}},
+		groupLister: &stubGroupLister{groups: []domain.Group{{ChatID: -10}, {ChatID: -20}}},
+	}
+
+	if err := client.RegisterCommand(Command{
+		Name:        "bind",
+		Description: "Bind this group",
+		MinRole:     domain.RoleAdmin,
+		ChatTypes:   []string{ChatTypeGroup},
+		Handler:     noopHandler,
+	}); err != nil {
+		t.Fatalf("RegisterCommand returned error: %v", err)
+	}
+
+	if err := client.PublishCommands(context.Background()); err != nil {
+		t.Fatalf("PublishCommands returned error: %v", err)
+	}
+
+	var members []*models.BotCommandScopeChatMember
+	for _, call := range fb.setCommandsCalls {
+		scope, ok := call.Scope.(*models.BotCommandScopeChatMember)
+		if !ok {
+			continue
+		}
+		members = append(members, scope)
+		if scope.UserID == 2 {
+			assertMenu(t, call.Commands, "ping", "bind")
+		}
+	}
+	if len(members) != 4 {
+		t.Fatalf("expected a chat member scope per group for the admin and the owner, got %d", len(members))
+	}
+	if members[0].ChatID != int64(-10) || members[0].UserID != 2 || members[1].UserID != 1 || members[3].ChatID != int64(-20) {
+		t.Fatalf("unexpected chat member scopes %+v %+v %+v %+v", members[0], members[1], members[2], members[3])
+	}
+
+	fb.setCommandsCalls = nil
+	client.groupLister = &stubGroupLister{err: errors.New("list failed")}
+	if err := client.PublishCommands(context.Background()); err == nil {
+		t.Fatalf("expected the group listing error to be reported")
+	}
+	if len(fb.setCommandsCalls) != 4 {
+		t.Fatalf("expected the other scopes to be published, got %d calls", len(fb.setCommandsCalls))
+	}
+
+	fb.setCommandsCalls = nil
+	client.groupLister = &stubGroupLister{groups: []domain.Group{{ChatID: -10}, {ChatID: -20}}}
+	if err := client.PublishUserCommands(context.Background(), 5, domain.RoleAdmin); err != nil {
+		t.Fatalf("PublishUserCommands returned error: %v", err)
+	}
+	if len(fb.setCommandsCalls) != 3 {
+		t.Fatalf("expected the private menu and one per group for a promoted admin, got %d calls", len(fb.setCommandsCalls))
+	}
+	if scope, ok := fb.setCommandsCalls[2].Scope.(*models.BotCommandScopeChatMember); !ok || scope.ChatID != int64(-20) || scope.UserID != 5 {
+		t.Fatalf("expected chat member scope for user 5 in -20, got %#v", fb.setCommandsCalls[2].Scope)
+	}
+	if err := client.PublishUserCommands(context.Background(), 5, domain.RoleUser); err != nil {
+		t.Fatalf("PublishUserCommands returned error: %v", err)
+	}
+	if len(fb.deleteCommandsCalls) != 3 {
+		t.Fatalf("expected the private menu and group menus of a demoted admin to be deleted, got %d calls", len(fb.deleteCommandsCalls))
+	}
+}
+
+func TestPublishGroupCommandsForJoinedGroup(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	fb := &fakeBot{}
+
+	client := &Client{
+		bot:        fb,
+		logger:     logger,
+		router:     newMessageRouter(logger, 1, commandDiagnostics{}),
+		botOwnerID: 1,
+		userLister: &stubUserLister{users: []domain.User{
+			{UserID: 1, Role: domain.RoleAdmin},
+			{UserID: 2, Role: domain.RoleAdmin},
+		}},
+	}
+	if err := client.RegisterCommand(Command{
+		Name:        "bind",
+		Description: "Bind this group",
+		MinRole:     domain.RoleAdmin,
+		ChatTypes:   []string{ChatTypeGroup},
+		Handler:     noopHandler,
+	}); err != nil {
+		t.Fatalf("RegisterCommand returned error: %v", err)
+	}
+
+	if err := client.PublishGroupCommands(context.Background(), -30); err != nil {
+		t.Fatalf("PublishGroupCommands returned error: %v", err)
+	}
+	if len(fb.setCommandsCalls) != 2 {
+		t.Fatalf("expected the admin and the owner to get a scope in the group, got %d calls", len(fb.setCommandsCalls))
+	}
+	for i, userID := range []int64{2, 1} {
+		scope, ok := fb.setCommandsCalls[i].Scope.(*models.BotCommandScopeChatMember)
+		if !ok || scope.ChatID != int64(-30) || scope.UserID != userID {
+			t.Fatalf("expected chat member scope for user %d in -30, got %#v", userID, fb.setCommandsCalls[i].Scope)
+		}
+	}
+	assertMenu(t, fb.setCommandsCalls[0].Commands, "ping", "bind")
+
+	fb.setCommandsCalls = nil
+	client.userLister = &stubUserLister{err: errors.New("list failed")}
+	if err := client.PublishGroupCommands(context.Background(), -30); err == nil || len(fb.setCommandsCalls) != 0 {
+		t.Fatalf("expected the admin listing error without publishing, got %v and %d calls", err, len(fb.setCommandsCalls))
+	}
+}
+
+func TestPublishCommandsStopsWhenCanceled(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	fb := &fakeBot{}
+
+	client := &Client{
+		bot:         fb,
+		logger:      logger,
+		router:      newMessageRouter(logger, 1, commandDiagnostics{}),
+		botOwnerID:  1,
+		groupLister: &stubGroupLister{groups: []domain.Group{{ChatID: -10}, {ChatID: -20}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.PublishCommands(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation to be reported, got %v", err)
+	}
+	if len(fb.setCommandsCalls) != 0 {
+		t.Fatalf("expected no calls after cancellation, got %d", len(fb.setCommandsCalls))
+	}
+}
+
+func TestPublishCommandsContinuesAfterErrors(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	listErr := errors.New("list failed")
+	setErr := errors.New("set failed")
+	fb := &fakeBot{setCommandsErr: setErr}
+
+	client := &Client{
+		bot:        fb,
+		logger:     logger,
+		router:     newMessageRouter(logger, 1, commandDiagnostics{}),
+		botOwnerID: 1,
+		userLister: &stubUserLister{err: listErr},
+	}
+
+	err := client.PublishCommands(context.Background())
+	if !errors.Is(err, listErr) || !errors.Is(err, setErr) {
+		t.Fatalf("expected joined list and set errors, got %v", err)
+	}
+	if len(fb.setCommandsCalls) != 3 {
+		t.Fatalf("expected remaining scopes to be attempted, got %d calls", len(fb.setCommandsCalls))
+	}
+}
+
+func TestPublishUserCommandsFollowsRole(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	fb := &fakeBot{}
+
+	client := &Client{
+		bot:        fb,
+		logger:     logger,
+		router:     newMessageRouter(logger, 1, commandDiagnostics{}),
+		botOwnerID: 1,
+	}
+	ctx := context.Background()
+
+	if err := client.PublishUserCommands(ctx, 5, domain.RoleAdmin); err != nil {
+		t.Fatalf("PublishUserCommands returned error: %v", err)
+	}
+	if len(fb.setCommandsCalls) != 1 {
+		t.Fatalf("expected one setMyCommands call, got %d", len(fb.setCommandsCalls))
+	}
+	if scope, ok := fb.setCommandsCalls[0].Scope.(*models.BotCommandScopeChat); !ok || scope.ChatID != int64(5) {
+		t.Fatalf("expected chat scope for user 5, got %#v", fb.setCommandsCalls[0].Scope)
+	}
+	assertMenu(t, fb.setCommandsCalls[0].Commands, "start", "ping")
+
+	if err := client.PublishUserCommands(ctx, 5, domain.RoleUser); err != nil {
+		t.Fatalf("PublishUserCommands returned error: %v", err)
+	}
+	if len(fb.deleteCommandsCalls) != 1 {
+		t.Fatalf("expected demoted menu to be deleted, got %d calls", len(fb.deleteCommandsCalls))
+	}
+	if scope, ok := fb.deleteCommandsCalls[0].Scope.(*models.BotCommandScopeChat); !ok || scope.ChatID != int64(5) {
+		t.Fatalf("expected chat scope for user 5, got %#v", fb.deleteCommandsCalls[0].Scope)
+	}
+
+	if err := client.PublishUserCommands(ctx, 1, domain.RoleUser); err != nil {
+		t.Fatalf("PublishUserCommands returned error: %v", err)
+	}
+	if len(fb.setCommandsCalls) != 1 || len(fb.deleteCommandsCalls) != 1 {
+		t.Fatalf("expected the owner chat to be left alone")
+	}
+}
+
+func assertMenu(t *testing.T, menu []models.BotCommand, names ...string) {
+	t.Helper()
+
+	if len(menu) != len(names) {
+		t.Fatalf("expected menu %v, got %v", names, menu)
+	}
+	for i, name := range names {
+		if menu[i].Command != name {
+			t.Fatalf("expected menu %v, got %v", names, menu)
+		}
+		if menu[i].Description == "" {
+			t.Fatalf("expected description for %s", name)
+		}
+	}
+}
+
+type stubUserLister struct {
+	users []domain.User
+	err   error
+}
+
+func (s *stubUserLister) ListByRole(_ context.Context, role string) ([]domain.User, error) {
+	return s.users, s.err
+}
+
+type stubGroupLister struct {
+	groups []domain.Group
+	err    error
+}
+
+func (s *stubGroupLister) ListActive(context.Context) ([]domain.Group, error) {
+	return s.groups, s.err
+}
@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// Command outcomes reported to MetricsRecorder.CommandRouted.
+const (
+	CommandOutcomeHandled     = "handled"
+	CommandOutcomeDenied      = "denied"
+	CommandOutcomeRateLimited = "rate_limited"
+	CommandOutcomeIgnored     = "ignored"
+	CommandOutcomeUnknown     = "unknown"
+)
+
+// Registration kinds reported to MetricsRecorder.Registered.
+const (
+	RegistrationUser  = "user"
+	RegistrationGroup = "group"
+)
+
+// unknownCommandLabel replaces the name of unregistered commands so arbitrary
+// user input cannot grow the command label set.
+const unknownCommandLabel = "unknown"
+
+// telegramPollTimeout matches the bot library's default HTTP timeout, which
+// has to cover the long-poll wait.
+const telegramPollTimeout = time.Minute
+
+// MetricsRecorder receives counters and latencies from update handling.
+type MetricsRecorder interface {
+	UpdateReceived(updateType string)
+	UpdateHandled(updateType string, d time.Duration)
+	CommandRouted(command, outcome string)
+	Registered(kind string)
+	TelegramRequestFailed(method string)
+}
+
+// WithMetrics reports update, command, registration, and Bot API error
+// metrics to recorder.
+func WithMetrics(recorder MetricsRecorder) ClientOption {
+	return func(opts *clientOptions) {
+		opts.metrics = recorder
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) UpdateReceived(string)               {}
+func (noopMetrics) UpdateHandled(string, time.Duration) {}
+func (noopMetrics) CommandRouted(string, string)        {}
+func (noopMetrics) Registered(string)                   {}
+func (noopMetrics) TelegramRequestFailed(string)        {}
+
+// instrumentedHTTPClient counts failed Bot API requests by method. Requests
+// abandoned because their context ended, such as long polls during shutdown,
+// are not failures.
+type instrumentedHTTPClient struct {
+	next    bot.HttpClient
+	metrics MetricsRecorder
+}
+
+func newInstrumentedHTTPClient(metrics MetricsRecorder) *instrumentedHTTPClient {
+	return &instrumentedHTTPClient{
+		next:    &http.Client{Timeout: telegramPollTimeout},
+		metrics: metrics,
+	}
+}
+
+func (c *instrumentedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.Do(req)
+	if req.Context().Err() != nil {
+		return resp, err
+	}
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		// The path is /bot<token>/<method>; only the method is reported.
+		c.metrics.TelegramRequestFailed(path.Base(req.URL.Path))
+	}
+
+	return resp, err
+}
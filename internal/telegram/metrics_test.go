@@ -0,0 +1,175 @@
+package telegram
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+type fakeRecorder struct {
+	mu         sync.Mutex
+	updates    []string
+	handled    []string
+	commands   []string
+	registered []string
+	failed     []string
+}
+
+func (f *fakeRecorder) UpdateReceived(updateType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, updateType)
+}
+
+func (f *fakeRecorder) UpdateHandled(updateType string, _ time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handled = append(f.handled, updateType)
+}
+
+func (f *fakeRecorder) CommandRouted(command, outcome string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, command+":"+outcome)
+}
+
+func (f *fakeRecorder) Registered(kind string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.registered = append(f.registered, kind)
+}
+
+func (f *fakeRecorder) TelegramRequestFailed(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed = append(f.failed, method)
+}
+
+func TestRoutedHandlerRecordsMetrics(t *testing.T) {
+	hookLogger, _ := logtest.NewNullLogger()
+	logger := logrus.NewEntry(hookLogger)
+
+	origSendMessage := sendMessage
+	defer func() { sendMessage = origSendMessage }()
+	sendMessage = func(context.Context, *bot.Bot, *bot.SendMessageParams) (*models.Message, error) {
+		return &models.Message{}, nil
+	}
+
+	recorder := &fakeRecorder{}
+	router := newMessageRouter(logger, 0, commandDiagnostics{})
+	router.metrics = recorder
+	for _, cmd := range []Command{
+		{Name: "echo", Handler: func(context.Context, *bot.Bot, *models.Update) {}},
+		{Name: "groups_only", ChatTypes: []string{"group"}, Handler: func(context.Context, *bot.Bot, *models.Update) {}},
+	} {
+		if err := router.register(cmd); err != nil {
+			t.Fatalf("register returned error: %v", err)
+		}
+	}
+
+	handler := routedHandler(logger, &stubUserRegistrar{created: true}, &stubGroupRegistrar{created: true}, router)
+	for _, text := range []string{"/echo", "/groups_only", "/nonsense_input", "hello"} {
+		handler(context.Background(), &bot.Bot{}, &models.Update{
+			Message: &models.Message{
+				From: &models.User{ID: 12},
+				Chat: models.Chat{ID: 12, Type: models.ChatTypePrivate},
+				Text: text,
+			},
+		})
+	}
+	handler(context.Background(), &bot.Bot{}, &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 12},
+			Chat: models.Chat{ID: -300, Type: models.ChatTypeGroup, Title: "Ops"},
+			Text: "hello",
+		},
+	})
+
+	if len(recorder.updates) != 5 || recorder.updates[0] != "message" {
+		t.Fatalf("expected five message updates, got %v", recorder.updates)
+	}
+	wantCommands := []string{"echo:handled", "groups_only:ignored", "unknown:unknown"}
+	if len(recorder.commands) != len(wantCommands) {
+		t.Fatalf("expected commands %v, got %v", wantCommands, recorder.commands)
+	}
+	for i, want := range wantCommands {
+		if recorder.commands[i] != want {
+			t.Fatalf("expected commands %v, got %v", wantCommands, recorder.commands)
+		}
+	}
+	users, groups := 0, 0
+	for _, kind := range recorder.registered {
+		switch kind {
+		case RegistrationUser:
+			users++
+		case RegistrationGroup:
+			groups++
+		}
+	}
+	if users != 5 || groups != 1 {
+		t.Fatalf("expected 5 user and 1 group registrations from the stubs, got %v", recorder.registered)
+	}
+}
+
+func TestDispatcherRecordsHandlerLatency(t *testing.T) {
+	recorder := &fakeRecorder{}
+	dispatcher := newUpdateDispatcher(DispatcherSettings{Workers: 1, QueueSize: 1}, func(context.Context, *bot.Bot, *models.Update) {}, logrus.NewEntry(logrus.New()))
+	dispatcher.metrics = recorder
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	dispatcher.Dispatch(ctx, nil, chatUpdate(1, 4))
+	waitFor(t, func() bool { return dispatcher.Stats().Processed == 1 })
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.handled) != 1 || recorder.handled[0] != "message" {
+		t.Fatalf("expected one handled message update, got %v", recorder.handled)
+	}
+}
+
+func TestInstrumentedHTTPClientCountsFailedRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bottoken/sendMessage" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	recorder := &fakeRecorder{}
+	client := newInstrumentedHTTPClient(recorder)
+
+	do := func(ctx context.Context, method string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/bottoken/"+method, nil)
+		if err != nil {
+			t.Fatalf("build request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	do(context.Background(), "sendMessage")
+	do(context.Background(), "getMe")
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	do(canceled, "getUpdates")
+
+	if len(recorder.failed) != 1 || recorder.failed[0] != "sendMessage" {
+		t.Fatalf("expected only sendMessage to count as failed, got %v", recorder.failed)
+	}
+}
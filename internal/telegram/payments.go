@@ -0,0 +1,260 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"tg_pay_gateway_bot/internal/domain"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+const (
+	paymentsUnavailableText = "Payments are not available right now. Please try again later."
+	preCheckoutFailedText   = "We could not verify this order. Please try again later."
+	// preCheckoutTimeout keeps the answer within Telegram's 10 second window.
+	preCheckoutTimeout = 8 * time.Second
+	// invoiceTitleMaxChars and invoiceDescriptionMaxChars are Telegram's
+	// limits for sendInvoice.
+	invoiceTitleMaxChars       = 32
+	invoiceDescriptionMaxChars = 255
+)
+
+// ErrPaymentsDisabled is returned by SendInvoice when no payment provider
+// token is configured.
+var ErrPaymentsDisabled = errors.New("telegram payments are not configured")
+
+var answerPreCheckoutQuery = func(ctx context.Context, b *bot.Bot, params *bot.AnswerPreCheckoutQueryParams) (bool, error) {
+	return b.AnswerPreCheckoutQuery(ctx, params)
+}
+
+// Invoice describes a single-price Telegram Payments invoice. Payload comes
+// back in the pre-checkout query and the successful payment, so it carries
+// the order ID. Amount is in the currency's minor units, or whole stars for
+// domain.CurrencyStars.
+type Invoice struct {
+	Title       string
+	Description string
+	Payload     string
+	Currency    string
+	Amount      int64
+}
+
+// PreCheckoutRequest carries a pre_checkout_query passed to a
+// PaymentProcessor before the payer is charged.
+type PreCheckoutRequest struct {
+	QueryID  string
+	UserID   int64
+	Payload  string
+	Currency string
+	Amount   int64
+}
+
+// PaymentRequest carries a successful_payment service message.
+type PaymentRequest struct {
+	UserID           int64
+	ChatID           int64
+	Payload          string
+	Currency         string
+	Amount           int64
+	TelegramChargeID string
+	ProviderChargeID string
+	Update           *models.Update
+}
+
+// PaymentProcessor validates and records Telegram Payments.
+type PaymentProcessor interface {
+	// PreCheckout returns "" to let the payment proceed or the reason shown
+	// to the payer when declining it. An error declines with a generic
+	// reason.
+	PreCheckout(ctx context.Context, req PreCheckoutRequest) (string, error)
+	// PaymentReceived records a completed payment and returns the text sent
+	// back to the chat.
+	PaymentReceived(ctx context.Context, req PaymentRequest) (string, error)
+}
+
+// SetPaymentProcessor routes pre-checkout queries and successful payments to
+// p. It must be called before Start; without a processor every pre-checkout
+// query is declined.
+func (c *Client) SetPaymentProcessor(p PaymentProcessor) error {
+	if c == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+	if p == nil {
+		return errors.New("payment processor is required")
+	}
+
+	c.router.payments = p
+
+	return nil
+}
+
+// PaymentsEnabled reports whether a payment provider token is configured.
+// Stars invoices work without one.
+func (c *Client) PaymentsEnabled() bool {
+	return c != nil && c.paymentProviderToken != ""
+}
+
+// SendInvoice sends a Telegram Payments invoice to a chat and returns the
+// invoice message ID. Invoices in domain.CurrencyStars need no provider token;
+// any other currency uses the configured one.
+func (c *Client) SendInvoice(ctx context.Context, chatID int64, invoice Invoice) (int, error) {
+	if c == nil || c.bot == nil {
+		return 0, errors.New("telegram client is not initialized")
+	}
+	// Stars invoices are paid to the bot itself and take no provider token.
+	providerToken := ""
+	if invoice.Currency != domain.CurrencyStars {
+		if c.paymentProviderToken == "" {
+			return 0, ErrPaymentsDisabled
+		}
+		providerToken = c.paymentProviderToken
+	}
+	if err := invoice.validate(); err != nil {
+		return 0, err
+	}
+
+	msg, err := c.bot.SendInvoice(ctx, &bot.SendInvoiceParams{
+		ChatID:        chatID,
+		Title:         invoice.Title,
+		Description:   invoice.Description,
+		Payload:       invoice.Payload,
+		ProviderToken: providerToken,
+		Currency:      invoice.Currency,
+		Prices:        []models.LabeledPrice{{Label: invoice.Title, Amount: int(invoice.Amount)}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return msg.ID, nil
+}
+
+func (i Invoice) validate() error {
+	switch {
+	case strings.TrimSpace(i.Title) == "" || len([]rune(i.Title)) > invoiceTitleMaxChars:
+		return fmt.Errorf("invoice title must be 1-%d characters", invoiceTitleMaxChars)
+	case strings.TrimSpace(i.Description) == "" || len([]rune(i.Description)) > invoiceDescriptionMaxChars:
+		return fmt.Errorf("invoice description must be 1-%d characters", invoiceDescriptionMaxChars)
+	case i.Payload == "":
+		return errors.New("invoice payload is required")
+	case i.Amount <= 0:
+		return errors.New("invoice amount must be positive")
+	}
+
+	return nil
+}
+
+// routePreCheckout asks the payment processor whether the order behind the
+// query may still be paid and always answers the query, since Telegram
+// cancels the payment when no answer arrives in time.
+func (r *messageRouter) routePreCheckout(ctx context.Context, b *bot.Bot, update *models.Update, meta updateMeta) string {
+	const handlerName = "pre_checkout"
+	query := update.PreCheckoutQuery
+	r.logRoute(meta, "", handlerName, "payment", "")
+
+	reason := paymentsUnavailableText
+	if r.payments != nil {
+		checkCtx, cancel := context.WithTimeout(ctx, preCheckoutTimeout)
+		var err error
+		reason, err = r.payments.PreCheckout(checkCtx, PreCheckoutRequest{
+			QueryID:  query.ID,
+			UserID:   meta.userID,
+			Payload:  query.InvoicePayload,
+			Currency: query.Currency,
+			Amount:   int64(query.TotalAmount),
+		})
+		cancel()
+		if err != nil {
+			r.logger.WithFields(logging.Fields{
+				"event":   handlerName + "_error",
+				"payload": query.InvoicePayload,
+				"user_id": meta.userID,
+			}).WithError(err).Error("pre-checkout validation failed")
+			reason = preCheckoutFailedText
+		}
+	}
+
+	fields := logging.Fields{
+		"event":    "pre_checkout_approved",
+		"payload":  query.InvoicePayload,
+		"currency": query.Currency,
+		"amount":   query.TotalAmount,
+		"user_id":  meta.userID,
+	}
+	if reason != "" {
+		fields["event"] = "pre_checkout_declined"
+		fields["reason"] = reason
+	}
+	r.logger.WithFields(fields).Info("answered pre-checkout query")
+
+	if b == nil {
+		return handlerName
+	}
+	if _, err := answerPreCheckoutQuery(ctx, b, &bot.AnswerPreCheckoutQueryParams{
+		PreCheckoutQueryID: query.ID,
+		OK:                 reason == "",
+		ErrorMessage:       reason,
+	}); err != nil {
+		r.logger.WithFields(logging.Fields{
+			"event":   "pre_checkout_answer_failed",
+			"payload": query.InvoicePayload,
+			"user_id": meta.userID,
+		}).WithError(err).Error("failed to answer pre-checkout query")
+	}
+
+	return handlerName
+}
+
+// routePayment hands a successful_payment service message to the payment
+// processor and sends its reply to the chat.
+func (r *messageRouter) routePayment(ctx context.Context, b *bot.Bot, update *models.Update, meta updateMeta) string {
+	const handlerName = "successful_payment"
+	payment := update.Message.SuccessfulPayment
+	r.logRoute(meta, normalizeChatType(meta.chatType), handlerName, "payment", "")
+
+	fields := logging.Fields{
+		"event":                      handlerName + "_error",
+		"payload":                    payment.InvoicePayload,
+		"telegram_payment_charge_id": payment.TelegramPaymentChargeID,
+		"user_id":                    meta.userID,
+		"chat_id":                    meta.chatID,
+	}
+
+	// The payer has been charged at this point, so failures are logged
+	// with the charge ID for manual reconciliation.
+	if r.payments == nil {
+		r.logger.WithFields(fields).Error("received payment without a payment processor")
+		return handlerName
+	}
+
+	text, err := r.payments.PaymentReceived(ctx, PaymentRequest{
+		UserID:           meta.userID,
+		ChatID:           meta.chatID,
+		Payload:          payment.InvoicePayload,
+		Currency:         payment.Currency,
+		Amount:           int64(payment.TotalAmount),
+		TelegramChargeID: payment.TelegramPaymentChargeID,
+		ProviderChargeID: payment.ProviderPaymentChargeID,
+		Update:           update,
+	})
+	if err != nil {
+		r.logger.WithFields(fields).WithError(err).Error("failed to record payment")
+		return handlerName
+	}
+
+	if strings.TrimSpace(text) == "" || b == nil || meta.chatID == 0 {
+		return handlerName
+	}
+	if _, err := sendMessage(ctx, b, &bot.SendMessageParams{ChatID: meta.chatID, Text: text}); err != nil {
+		fields["event"] = handlerName + "_send_failed"
+		r.logger.WithFields(fields).WithError(err).Error("failed to send payment confirmation")
+	}
+
+	return handlerName
+}
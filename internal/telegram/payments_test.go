@@ -0,0 +1,167 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/config"
+)
+
+func TestDefaultHandlerDeclinesPreCheckoutWithoutProcessor(t *testing.T) {
+	answers := stubAnswerPreCheckout(t)
+	hookLogger, hook := logtest.NewNullLogger()
+	handler := defaultHandler(logrus.NewEntry(hookLogger), nil, nil, 0, commandDiagnostics{})
+
+	handler(context.Background(), &bot.Bot{}, preCheckoutUpdate("pcq1", "ord_abc123", "USD", 1250))
+
+	if len(*answers) != 1 || (*answers)[0].PreCheckoutQueryID != "pcq1" || (*answers)[0].OK || (*answers)[0].ErrorMessage != paymentsUnavailableText {
+		t.Fatalf("expected the query to be declined, got %+v", *answers)
+	}
+	entry := findEvent(hook.AllEntries(), "telegram_update")
+	if entry == nil || entry.Data["update_type"] != "pre_checkout_query" || entry.Data["handler"] != "pre_checkout" || entry.Data["user_id"] != int64(42) {
+		t.Fatalf("expected pre-checkout update to be logged, got %+v", entry)
+	}
+	if !slices.Contains(defaultAllowedUpdates, "pre_checkout_query") {
+		t.Fatalf("expected pre_checkout_query in allowed updates")
+	}
+}
+
+func TestRoutedHandlerProcessesPayments(t *testing.T) {
+	answers := stubAnswerPreCheckout(t)
+	sent := stubDialogSend(t)
+	router := newMessageRouter(logrus.NewEntry(logrus.New()), 1, commandDiagnostics{})
+	processor := &fakePaymentProcessor{decline: map[string]string{"ord_gone": "This order is no longer awaiting payment."}}
+	router.payments = processor
+	handler := routedHandler(router.logger, nil, nil, router)
+
+	handler(context.Background(), &bot.Bot{}, preCheckoutUpdate("pcq1", "ord_abc123", "USD", 1250))
+	handler(context.Background(), &bot.Bot{}, preCheckoutUpdate("pcq2", "ord_gone", "USD", 1250))
+	processor.err = errors.New("mongo down")
+	handler(context.Background(), &bot.Bot{}, preCheckoutUpdate("pcq3", "ord_abc123", "USD", 1250))
+	processor.err = nil
+
+	if len(*answers) != 3 || !(*answers)[0].OK || (*answers)[1].OK || (*answers)[1].ErrorMessage != "This order is no longer awaiting payment." || (*answers)[2].ErrorMessage != preCheckoutFailedText {
+		t.Fatalf("unexpected pre-checkout answers %+v", *answers)
+	}
+	if got := processor.checks[0]; got.UserID != 42 || got.Payload != "ord_abc123" || got.Currency != "USD" || got.Amount != 1250 {
+		t.Fatalf("unexpected pre-checkout request %+v", got)
+	}
+
+	handler(context.Background(), &bot.Bot{}, &models.Update{Message: &models.Message{
+		From: &models.User{ID: 42},
+		Chat: models.Chat{ID: -100, Type: models.ChatTypeSupergroup},
+		SuccessfulPayment: &models.SuccessfulPayment{
+			Currency:                "USD",
+			TotalAmount:             1250,
+			InvoicePayload:          "ord_abc123",
+			TelegramPaymentChargeID: "tg_charge",
+			ProviderPaymentChargeID: "prov_charge",
+		},
+	}})
+
+	if len(processor.payments) != 1 {
+		t.Fatalf("expected one recorded payment, got %d", len(processor.payments))
+	}
+	if got := processor.payments[0]; got.ChatID != -100 || got.Payload != "ord_abc123" || got.TelegramChargeID != "tg_charge" || got.ProviderChargeID != "prov_charge" || got.Amount != 1250 {
+		t.Fatalf("unexpected payment request %+v", got)
+	}
+	if len(*sent) != 1 || (*sent)[0] != "Payment received for order ord_abc123." {
+		t.Fatalf("expected payment confirmation, got %q", *sent)
+	}
+}
+
+func TestSendInvoiceUsesProviderToken(t *testing.T) {
+	fb := &fakeBot{}
+	client := &Client{bot: fb, router: newMessageRouter(logrus.NewEntry(logrus.New()), 1, commandDiagnostics{})}
+	invoice := Invoice{Title: "Demo Shop", Description: "Order ord_abc123", Payload: "ord_abc123", Currency: "USD", Amount: 1250}
+
+	if _, err := client.SendInvoice(context.Background(), -100, invoice); !errors.Is(err, ErrPaymentsDisabled) {
+		t.Fatalf("expected ErrPaymentsDisabled without a provider token, got %v", err)
+	}
+
+	client.paymentProviderToken = "provider-token"
+	messageID, err := client.SendInvoice(context.Background(), -100, invoice)
+	if err != nil {
+		t.Fatalf("SendInvoice returned error: %v", err)
+	}
+	if messageID != 101 || len(fb.invoiceCalls) != 1 {
+		t.Fatalf("expected one invoice message, got id=%d calls=%d", messageID, len(fb.invoiceCalls))
+	}
+	params := fb.invoiceCalls[0]
+	if params.ProviderToken != "provider-token" || params.Payload != "ord_abc123" || params.Currency != "USD" || len(params.Prices) != 1 || params.Prices[0].Amount != 1250 {
+		t.Fatalf("unexpected invoice params %+v", params)
+	}
+
+	invoice.Title = "A title that is far too long for Telegram"
+	if _, err := client.SendInvoice(context.Background(), -100, invoice); err == nil {
+		t.Fatalf("expected long title to be rejected")
+	}
+}
+
+func TestNewClientPassesProviderToken(t *testing.T) {
+	origCreate := createBot
+	t.Cleanup(func() { createBot = origCreate })
+	createBot = func(string, ...bot.Option) (botRunner, error) { return &fakeBot{}, nil }
+
+	client, err := NewClient(config.Config{TelegramToken: "token", PaymentProviderToken: "provider-token"}, logrus.NewEntry(logrus.New()))
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	if client.paymentProviderToken != "provider-token" {
+		t.Fatalf("expected provider token to be kept, got %q", client.paymentProviderToken)
+	}
+	if err := client.SetPaymentProcessor(nil); err == nil {
+		t.Fatalf("expected nil processor to be rejected")
+	}
+}
+
+func stubAnswerPreCheckout(t *testing.T) *[]*bot.AnswerPreCheckoutQueryParams {
+	t.Helper()
+
+	origAnswer := answerPreCheckoutQuery
+	t.Cleanup(func() { answerPreCheckoutQuery = origAnswer })
+
+	answers := &[]*bot.AnswerPreCheckoutQueryParams{}
+	answerPreCheckoutQuery = func(_ context.Context, _ *bot.Bot, params *bot.AnswerPreCheckoutQueryParams) (bool, error) {
+		*answers = append(*answers, params)
+		return true, nil
+	}
+	return answers
+}
+
+func preCheckoutUpdate(id, payload, currency string, amount int) *models.Update {
+	return &models.Update{PreCheckoutQuery: &models.PreCheckoutQuery{
+		ID:             id,
+		From:           &models.User{ID: 42},
+		Currency:       currency,
+		TotalAmount:    amount,
+		InvoicePayload: payload,
+	}}
+}
+
+type fakePaymentProcessor struct {
+	decline  map[string]string
+	err      error
+	checks   []PreCheckoutRequest
+	payments []PaymentRequest
+}
+
+func (f *fakePaymentProcessor) PreCheckout(_ context.Context, req PreCheckoutRequest) (string, error) {
+	f.checks = append(f.checks, req)
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.decline[req.Payload], nil
+}
+
+func (f *fakePaymentProcessor) PaymentReceived(_ context.Context, req PaymentRequest) (string, error) {
+	f.payments = append(f.payments, req)
+	return "Payment received for order " + req.Payload + ".", nil
+}
@@ -0,0 +1,220 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+const (
+	rateScopeUser = "user"
+	rateScopeChat = "chat"
+
+	// rateSweepInterval bounds how often idle buckets are dropped so the map
+	// does not grow with every user that ever sent a command.
+	rateSweepInterval = time.Minute
+)
+
+// rateLimiter applies token buckets per user and per chat to each command.
+// A command runs only when every applicable bucket holds a token, and a
+// throttled caller is told at most once per window. It is safe for
+// concurrent use; a nil limiter allows everything.
+type rateLimiter struct {
+	user     config.RateLimit
+	chat     config.RateLimit
+	commands map[string]config.RateLimit
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[rateBucketKey]*tokenBucket
+	lastSweep time.Time
+}
+
+type rateBucketKey struct {
+	scope   string
+	id      int64
+	command string
+}
+
+type tokenBucket struct {
+	limit      config.RateLimit
+	tokens     float64
+	updated    time.Time
+	notifiedAt time.Time
+}
+
+// rateDecision describes the outcome of a rate limit check. When the command
+// is throttled, scope and limit name the exhausted bucket and notify reports
+// whether the caller should be told.
+type rateDecision struct {
+	allowed    bool
+	scope      string
+	limit      config.RateLimit
+	retryAfter time.Duration
+	notify     bool
+}
+
+func newRateLimiter(user, chat config.RateLimit, commands map[string]config.RateLimit, now func() time.Time) *rateLimiter {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &rateLimiter{
+		user:     user,
+		chat:     chat,
+		commands: commands,
+		now:      now,
+		buckets:  make(map[rateBucketKey]*tokenBucket),
+	}
+}
+
+// allow takes a token from the user and chat buckets of the command. Private
+// chats share the sender's id, so only the user bucket applies there.
+func (l *rateLimiter) allow(command string, userID, chatID int64) rateDecision {
+	if l == nil {
+		return rateDecision{allowed: true}
+	}
+
+	userLimit := l.user
+	if override, ok := l.commands[command]; ok {
+		userLimit = override
+	}
+
+	type check struct {
+		scope string
+		id    int64
+		limit config.RateLimit
+	}
+	checks := make([]check, 0, 2)
+	if userID != 0 && userLimit.Enabled() {
+		checks = append(checks, check{scope: rateScopeUser, id: userID, limit: userLimit})
+	}
+	if chatID != 0 && chatID != userID && l.chat.Enabled() {
+		checks = append(checks, check{scope: rateScopeChat, id: chatID, limit: l.chat})
+	}
+	if len(checks) == 0 {
+		return rateDecision{allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	buckets := make([]*tokenBucket, 0, len(checks))
+	for _, c := range checks {
+		bucket := l.bucket(rateBucketKey{scope: c.scope, id: c.id, command: command}, c.limit, now)
+		if bucket.tokens < 1 {
+			decision := rateDecision{
+				scope:      c.scope,
+				limit:      c.limit,
+				retryAfter: bucket.retryAfter(),
+			}
+			if bucket.notifiedAt.IsZero() || now.Sub(bucket.notifiedAt) >= c.limit.Window {
+				bucket.notifiedAt = now
+				decision.notify = true
+			}
+			return decision
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+
+	return rateDecision{allowed: true}
+}
+
+// bucket returns the refilled bucket for key, creating a full one when absent
+// or when the configured limit no longer matches.
+func (l *rateLimiter) bucket(key rateBucketKey, limit config.RateLimit, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[key]
+	if !ok || bucket.limit != limit {
+		bucket = &tokenBucket{limit: limit, tokens: float64(limit.Burst), updated: now}
+		l.buckets[key] = bucket
+		return bucket
+	}
+
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+elapsed.Seconds()*bucket.rate())
+		bucket.updated = now
+	}
+
+	return bucket
+}
+
+// sweep drops buckets that have refilled completely and whose throttle notice
+// has expired; recreating them later is equivalent.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= bucket.limit.Window && now.Sub(bucket.notifiedAt) >= bucket.limit.Window {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rate is the refill speed in tokens per second.
+func (b *tokenBucket) rate() float64 {
+	return float64(b.limit.Burst) / b.limit.Window.Seconds()
+}
+
+// retryAfter is the wait until the next token, rounded up to whole seconds.
+func (b *tokenBucket) retryAfter() time.Duration {
+	wait := time.Duration((1 - b.tokens) / b.rate() * float64(time.Second))
+	return time.Duration(math.Ceil(wait.Seconds())) * time.Second
+}
+
+func rateLimitedText(command string, retryAfter time.Duration) string {
+	return fmt.Sprintf("Too many requests; please wait %s before using /%s again.", retryAfter, command)
+}
+
+// checkRateLimit reports whether the command may run, logging throttled calls
+// and sending the throttle notice when due.
+func (r *messageRouter) checkRateLimit(ctx context.Context, b *bot.Bot, cmd registeredCommand, meta updateMeta) bool {
+	decision := r.limiter.allow(cmd.Name, meta.userID, meta.chatID)
+	if decision.allowed {
+		return true
+	}
+
+	fields := logging.Fields{
+		"event":       "rate_limited",
+		"handler":     cmd.handlerName,
+		"command":     cmd.Name,
+		"scope":       decision.scope,
+		"limit":       decision.limit.String(),
+		"retry_after": decision.retryAfter.String(),
+		"notified":    decision.notify,
+		"user_id":     meta.userID,
+		"chat_id":     meta.chatID,
+		"chat_type":   normalizeChatType(meta.chatType),
+	}
+	r.logger.WithFields(fields).Warn("rate limited command")
+
+	if !decision.notify || meta.chatID == 0 || b == nil {
+		return false
+	}
+
+	if _, err := sendMessage(ctx, b, &bot.SendMessageParams{
+		ChatID: meta.chatID,
+		Text:   rateLimitedText(cmd.Name, decision.retryAfter),
+	}); err != nil {
+		fields["event"] = "rate_limited_send_failed"
+		r.logger.WithFields(fields).WithError(err).Error("failed to send rate limit response")
+	}
+
+	return false
+}
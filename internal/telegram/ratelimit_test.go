@@ -0,0 +1,193 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/config"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestRateLimiterRefillsAndNotifiesOncePerWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	limiter := newRateLimiter(config.RateLimit{Burst: 2, Window: 10 * time.Second}, config.RateLimit{}, nil, clock.Now)
+
+	for i := 0; i < 2; i++ {
+		if !limiter.allow("ping", 7, 7).allowed {
+			t.Fatalf("expected call %d within burst to be allowed", i+1)
+		}
+	}
+
+	first := limiter.allow("ping", 7, 7)
+	if first.allowed || !first.notify || first.scope != rateScopeUser || first.retryAfter != 5*time.Second {
+		t.Fatalf("expected a notified user-scope throttle with 5s retry, got %+v", first)
+	}
+	if again := limiter.allow("ping", 7, 7); again.allowed || again.notify {
+		t.Fatalf("expected a silent throttle within the window, got %+v", again)
+	}
+	if other := limiter.allow("ping", 8, 8); !other.allowed {
+		t.Fatalf("expected other users to keep their own bucket")
+	}
+	if otherCommand := limiter.allow("help", 7, 7); !otherCommand.allowed {
+		t.Fatalf("expected other commands to keep their own bucket")
+	}
+
+	// One token refills every five seconds.
+	clock.Advance(5 * time.Second)
+	if !limiter.allow("ping", 7, 7).allowed {
+		t.Fatalf("expected a refilled token to be allowed")
+	}
+	if limiter.allow("ping", 7, 7).notify {
+		t.Fatalf("expected no second notice within the window")
+	}
+
+	clock.Advance(10 * time.Second)
+	limiter.allow("ping", 7, 7)
+	limiter.allow("ping", 7, 7)
+	if decision := limiter.allow("ping", 7, 7); decision.allowed || !decision.notify {
+		t.Fatalf("expected a new notice once the window passed, got %+v", decision)
+	}
+}
+
+func TestRateLimiterAppliesChatLimitAndOverrides(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	limiter := newRateLimiter(
+		config.RateLimit{Burst: 5, Window: time.Minute},
+		config.RateLimit{Burst: 3, Window: time.Minute},
+		map[string]config.RateLimit{"status": {Burst: 1, Window: time.Minute}, "help": {}},
+		clock.Now,
+	)
+
+	for userID := int64(1); userID <= 3; userID++ {
+		if !limiter.allow("ping", userID, -100).allowed {
+			t.Fatalf("expected user %d within the chat burst to be allowed", userID)
+		}
+	}
+	if decision := limiter.allow("ping", 4, -100); decision.allowed || decision.scope != rateScopeChat {
+		t.Fatalf("expected the chat bucket to throttle, got %+v", decision)
+	}
+	if !limiter.allow("ping", 4, -200).allowed {
+		t.Fatalf("expected a throttled chat not to consume the user's token elsewhere")
+	}
+
+	if !limiter.allow("status", 9, 9).allowed {
+		t.Fatalf("expected the first /status to be allowed")
+	}
+	if decision := limiter.allow("status", 9, 9); decision.allowed || decision.limit.String() != "1/1m0s" {
+		t.Fatalf("expected the /status override to throttle, got %+v", decision)
+	}
+	for i := 0; i < 10; i++ {
+		if !limiter.allow("help", 9, 9).allowed {
+			t.Fatalf("expected /help to be exempt")
+		}
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	limiter := newRateLimiter(config.RateLimit{Burst: 1, Window: time.Second}, config.RateLimit{}, nil, clock.Now)
+
+	limiter.allow("ping", 1, 1)
+	limiter.allow("ping", 2, 2)
+	clock.Advance(2 * rateSweepInterval)
+	limiter.allow("ping", 3, 3)
+
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("expected idle buckets to be swept, got %d", len(limiter.buckets))
+	}
+}
+
+func TestRateLimiterIsSafeForConcurrentUse(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	limiter := newRateLimiter(config.RateLimit{Burst: 10, Window: time.Hour}, config.RateLimit{Burst: 25, Window: time.Hour}, nil, clock.Now)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			if limiter.allow("ping", userID, -100).allowed {
+				allowed.Add(1)
+			}
+		}(int64(i%5 + 1))
+	}
+	wg.Wait()
+
+	if allowed.Load() != 25 {
+		t.Fatalf("expected exactly the chat burst of 25 calls, got %d", allowed.Load())
+	}
+}
+
+func TestRouterRateLimitsCommands(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+
+	origSendMessage := sendMessage
+	defer func() { sendMessage = origSendMessage }()
+
+	var sent []string
+	sendMessage = func(_ context.Context, _ *bot.Bot, params *bot.SendMessageParams) (*models.Message, error) {
+		sent = append(sent, params.Text)
+		return &models.Message{}, nil
+	}
+
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	router := newMessageRouter(logrus.NewEntry(hookLogger), 0, commandDiagnostics{})
+	router.limiter = newRateLimiter(config.RateLimit{Burst: 1, Window: 30 * time.Second}, config.RateLimit{}, nil, clock.Now)
+
+	calls := 0
+	if err := router.register(Command{
+		Name:    "echo",
+		Handler: func(context.Context, *bot.Bot, *models.Update) { calls++ },
+	}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+
+	update := &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 81},
+			Chat: models.Chat{ID: 81, Type: models.ChatTypePrivate},
+			Text: "/echo",
+		},
+	}
+	for i := 0; i < 3; i++ {
+		router.route(context.Background(), &bot.Bot{}, update, extractUpdateMeta(update))
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected only the first call to reach the handler, got %d", calls)
+	}
+	want := "Too many requests; please wait 30s before using /echo again."
+	if len(sent) != 1 || sent[0] != want {
+		t.Fatalf("expected a single throttle notice %q, got %v", want, sent)
+	}
+
+	entry := findEvent(hook.AllEntries(), "rate_limited")
+	if entry == nil || entry.Data["scope"] != rateScopeUser || entry.Data["command"] != "echo" || entry.Data["limit"] != "1/30s" {
+		t.Fatalf("expected rate_limited log entry, got %+v", entry)
+	}
+}
@@ -0,0 +1,118 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+const commandFailedText = "Command failed. Please try again later."
+
+// CommandRequest carries the parsed command invocation passed to a ReplyFunc.
+// Role is the caller's resolved role and is only set for commands declaring a
+// MinRole; ReplyText and ReplyUserID are the text (or caption) and sender of
+// the message the command replies to.
+type CommandRequest struct {
+	UserID      int64
+	ChatID      int64
+	ChatType    string
+	ChatTitle   string
+	Command     string
+	Args        []string
+	Role        string
+	ReplyText   string
+	ReplyUserID int64
+	Update      *models.Update
+}
+
+// ReplyFunc handles a command and returns the text to send back to the chat.
+// Returning an error logs it and replies with a generic failure message; user
+// mistakes should be reported through the returned text instead.
+type ReplyFunc func(ctx context.Context, req CommandRequest) (string, error)
+
+// ReplyHandler adapts a ReplyFunc into a bot.HandlerFunc that parses command
+// arguments and sends the returned text to the originating chat.
+func ReplyHandler(logger *logrus.Entry, fn ReplyFunc) bot.HandlerFunc {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if ctx == nil || update == nil || fn == nil {
+			return
+		}
+
+		meta := extractUpdateMeta(update)
+		req := CommandRequest{
+			UserID:      meta.userID,
+			ChatID:      meta.chatID,
+			ChatType:    normalizeChatType(meta.chatType),
+			ChatTitle:   meta.chatTitle,
+			Command:     commandName(meta.text),
+			Args:        commandArgs(meta.text),
+			Role:        CallerRole(ctx),
+			ReplyText:   meta.replyText,
+			ReplyUserID: meta.replyUserID,
+			Update:      update,
+		}
+
+		handlerName := "command_" + req.Command
+		logCommandHandled(logger, handlerName, meta)
+
+		fields := logging.Fields{
+			"event":     handlerName + "_send_failed",
+			"user_id":   req.UserID,
+			"chat_id":   req.ChatID,
+			"chat_type": req.ChatType,
+		}
+
+		text, err := fn(ctx, req)
+		if err != nil {
+			logger.WithFields(logging.Fields{
+				"event":     handlerName + "_error",
+				"user_id":   req.UserID,
+				"chat_id":   req.ChatID,
+				"chat_type": req.ChatType,
+			}).WithError(err).Error("command handler failed")
+			text = commandFailedText
+		}
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+
+		if req.ChatID == 0 {
+			logger.WithFields(fields).Error("cannot send command response without chat_id")
+			return
+		}
+		if b == nil {
+			logger.WithFields(fields).Error("cannot send command response without telegram client")
+			return
+		}
+
+		if _, err := sendMessage(ctx, b, &bot.SendMessageParams{
+			ChatID: req.ChatID,
+			Text:   text,
+		}); err != nil {
+			logger.WithFields(fields).WithError(err).Error("failed to send command response")
+			return
+		}
+
+		fields["event"] = handlerName + "_sent"
+		logger.WithFields(fields).Info("sent command response")
+	}
+}
+
+// commandArgs returns the whitespace-separated arguments following the command.
+func commandArgs(text string) []string {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) <= 1 || !strings.HasPrefix(fields[0], "/") {
+		return nil
+	}
+
+	return fields[1:]
+}
@@ -0,0 +1,98 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestReplyHandlerParsesArgsAndSendsText(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+
+	origSendMessage := sendMessage
+	defer func() { sendMessage = origSendMessage }()
+
+	var sent []*bot.SendMessageParams
+	sendMessage = func(_ context.Context, _ *bot.Bot, params *bot.SendMessageParams) (*models.Message, error) {
+		sent = append(sent, params)
+		return &models.Message{}, nil
+	}
+
+	var got CommandRequest
+	handler := ReplyHandler(logrus.NewEntry(hookLogger), func(_ context.Context, req CommandRequest) (string, error) {
+		got = req
+		return "done", nil
+	})
+
+	handler(context.Background(), &bot.Bot{}, &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 80},
+			Chat: models.Chat{ID: -180, Type: models.ChatTypeSupergroup, Title: "Ops"},
+			Text: "/Merchant_Bind@my_bot  shop_01   extra",
+		},
+	})
+
+	if got.Command != "merchant_bind" || got.ChatType != ChatTypeGroup || got.ChatTitle != "Ops" {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+	if !reflect.DeepEqual(got.Args, []string{"shop_01", "extra"}) {
+		t.Fatalf("expected parsed args, got %v", got.Args)
+	}
+	if len(sent) != 1 || sent[0].Text != "done" || sent[0].ChatID != int64(-180) {
+		t.Fatalf("expected a single reply to the chat, got %+v", sent)
+	}
+	if findEvent(hook.AllEntries(), "command_merchant_bind_sent") == nil {
+		t.Fatalf("expected command_merchant_bind_sent log entry")
+	}
+}
+
+func TestReplyHandlerRepliesWithGenericFailureOnError(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+
+	origSendMessage := sendMessage
+	defer func() { sendMessage = origSendMessage }()
+
+	var sent []string
+	sendMessage = func(_ context.Context, _ *bot.Bot, params *bot.SendMessageParams) (*models.Message, error) {
+		sent = append(sent, params.Text)
+		return &models.Message{}, nil
+	}
+
+	handler := ReplyHandler(logrus.NewEntry(hookLogger), func(context.Context, CommandRequest) (string, error) {
+		return "", errors.New("mongo down")
+	})
+
+	handler(context.Background(), &bot.Bot{}, &models.Update{
+		Message: &models.Message{
+			From: &models.User{ID: 81},
+			Chat: models.Chat{ID: 181, Type: models.ChatTypePrivate},
+			Text: "/merchant_info",
+		},
+	})
+
+	if len(sent) != 1 || sent[0] != commandFailedText {
+		t.Fatalf("expected generic failure reply, got %v", sent)
+	}
+	entry := findEvent(hook.AllEntries(), "command_merchant_info_error")
+	if entry == nil || entry.Level != logrus.ErrorLevel {
+		t.Fatalf("expected command_merchant_info_error at error level, got %v", entry)
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	if args := commandArgs("/ping"); args != nil {
+		t.Fatalf("expected no args, got %v", args)
+	}
+	if args := commandArgs("hello world"); args != nil {
+		t.Fatalf("expected no args for non-command text, got %v", args)
+	}
+	if args := commandArgs(" /cmd a  b "); !reflect.DeepEqual(args, []string{"a", "b"}) {
+		t.Fatalf("expected [a b], got %v", args)
+	}
+}
@@ -0,0 +1,89 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// SendText sends text to a chat, with an optional row of inline buttons.
+func (c *Client) SendText(ctx context.Context, chatID int64, text string, buttons ...InlineButton) error {
+	if c == nil || c.bot == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	markup, err := c.router.inlineKeyboard(buttons)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ReplyMarkup: markup,
+	})
+
+	return err
+}
+
+// CopyMessage copies a message into another chat without a forward header.
+func (c *Client) CopyMessage(ctx context.Context, chatID, fromChatID int64, messageID int) error {
+	if c == nil || c.bot == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	_, err := c.bot.CopyMessage(ctx, &bot.CopyMessageParams{
+		ChatID:     chatID,
+		FromChatID: fromChatID,
+		MessageID:  messageID,
+	})
+
+	return err
+}
+
+// EditText replaces a message's text and its inline buttons; without buttons
+// the keyboard is removed.
+func (c *Client) EditText(ctx context.Context, chatID int64, messageID int, text string, buttons ...InlineButton) error {
+	if c == nil || c.bot == nil || c.router == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	markup, err := c.router.inlineKeyboard(buttons)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.bot.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		Text:        text,
+		ReplyMarkup: markup,
+	})
+
+	return err
+}
+
+// IsBlocked reports whether a Bot API error means the bot may not write to the
+// chat any more, e.g. the user blocked it or it was removed from the group.
+func IsBlocked(err error) bool {
+	return errors.Is(err, bot.ErrorForbidden)
+}
+
+// IsBadRequest reports whether Telegram rejected a Bot API call as invalid,
+// e.g. a refund for a charge that was already refunded.
+func IsBadRequest(err error) bool {
+	return errors.Is(err, bot.ErrorBadRequest)
+}
+
+// RetryAfter returns how long Telegram asked to wait when err is a flood
+// control (429) error.
+func RetryAfter(err error) (time.Duration, bool) {
+	var tooMany *bot.TooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		return 0, false
+	}
+
+	return time.Duration(tooMany.RetryAfter) * time.Second, true
+}
@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// StarTransactionsMaxLimit is the most transactions getStarTransactions
+// returns per call.
+const StarTransactionsMaxLimit = 100
+
+// StarTransaction is one entry of the bot's Telegram Stars history. Amount is
+// in whole stars; incoming transactions carry the paying partner and outgoing
+// ones (refunds, withdrawals) the receiving partner.
+type StarTransaction struct {
+	ID       string
+	Amount   int64
+	Date     time.Time
+	Incoming bool
+	// Partner is the transaction partner type, e.g. "user" or "fragment".
+	Partner string
+	// UserID is set when the partner is a user.
+	UserID int64
+	// Payload is the invoice payload of a user payment.
+	Payload string
+}
+
+// RefundStarPayment returns a Stars payment to the user who made it.
+func (c *Client) RefundStarPayment(ctx context.Context, userID int64, chargeID string) error {
+	if c == nil || c.bot == nil {
+		return errors.New("telegram client is not initialized")
+	}
+	chargeID = strings.TrimSpace(chargeID)
+	if userID == 0 || chargeID == "" {
+		return errors.New("user id and charge id are required")
+	}
+
+	if _, err := c.bot.RefundStarPayment(ctx, &bot.RefundStarPaymentParams{
+		UserID:                  userID,
+		TelegramPaymentChargeID: chargeID,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// StarBalance returns the bot's current Telegram Stars balance in whole
+// stars.
+func (c *Client) StarBalance(ctx context.Context) (int64, error) {
+	if c == nil || c.bot == nil {
+		return 0, errors.New("telegram client is not initialized")
+	}
+
+	balance, err := c.bot.GetMyStarBalance(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(balance.Amount), nil
+}
+
+// StarTransactions returns up to limit of the bot's Stars transactions,
+// newest first, skipping the first offset.
+func (c *Client) StarTransactions(ctx context.Context, offset, limit int) ([]StarTransaction, error) {
+	if c == nil || c.bot == nil {
+		return nil, errors.New("telegram client is not initialized")
+	}
+	if offset < 0 || limit < 1 || limit > StarTransactionsMaxLimit {
+		return nil, errors.New("star transactions offset must be non-negative and limit between 1 and 100")
+	}
+
+	result, err := c.bot.GetStarTransactions(ctx, &bot.GetStarTransactionsParams{Offset: offset, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]StarTransaction, 0, len(result.Transactions))
+	for _, tx := range result.Transactions {
+		transactions = append(transactions, starTransaction(tx))
+	}
+
+	return transactions, nil
+}
+
+func starTransaction(tx models.StarTransaction) StarTransaction {
+	out := StarTransaction{
+		ID:     tx.ID,
+		Amount: int64(tx.Amount),
+		Date:   time.Unix(int64(tx.Date), 0).UTC(),
+	}
+
+	partner := tx.Receiver
+	if tx.Source != nil {
+		out.Incoming = true
+		partner = tx.Source
+	}
+	if partner == nil {
+		return out
+	}
+
+	out.Partner = string(partner.Type)
+	if partner.User != nil {
+		out.UserID = partner.User.User.ID
+		out.Payload = partner.User.InvoicePayload
+	}
+
+	return out
+}
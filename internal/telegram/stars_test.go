@@ -0,0 +1,92 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSendInvoiceInStarsSkipsProviderToken(t *testing.T) {
+	fb := &fakeBot{}
+	client := &Client{bot: fb, router: newMessageRouter(logrus.NewEntry(logrus.New()), 1, commandDiagnostics{})}
+
+	invoice := Invoice{Title: "Demo Shop", Description: "Sticker pack", Payload: "ord_abc123", Currency: "XTR", Amount: 50}
+	if _, err := client.SendInvoice(context.Background(), -100, invoice); err != nil {
+		t.Fatalf("expected Stars invoice without a provider token, got %v", err)
+	}
+
+	client.paymentProviderToken = "provider-token"
+	if _, err := client.SendInvoice(context.Background(), -100, invoice); err != nil {
+		t.Fatalf("SendInvoice returned error: %v", err)
+	}
+	for _, params := range fb.invoiceCalls {
+		if params.ProviderToken != "" || params.Currency != "XTR" || params.Prices[0].Amount != 50 {
+			t.Fatalf("expected Stars invoice without provider token, got %+v", params)
+		}
+	}
+}
+
+func TestRefundStarPayment(t *testing.T) {
+	fb := &fakeBot{}
+	client := &Client{bot: fb}
+
+	if err := client.RefundStarPayment(context.Background(), 42, "charge-1"); err != nil {
+		t.Fatalf("RefundStarPayment returned error: %v", err)
+	}
+	if len(fb.refundCalls) != 1 || fb.refundCalls[0].UserID != 42 || fb.refundCalls[0].TelegramPaymentChargeID != "charge-1" {
+		t.Fatalf("unexpected refund calls %+v", fb.refundCalls)
+	}
+	if err := client.RefundStarPayment(context.Background(), 0, "charge-1"); err == nil {
+		t.Fatalf("expected missing user id to be rejected")
+	}
+
+	fb.sendErr = errors.New("bad request, CHARGE_ALREADY_REFUNDED")
+	if err := client.RefundStarPayment(context.Background(), 42, "charge-1"); err == nil {
+		t.Fatalf("expected Bot API error to be returned")
+	}
+}
+
+func TestStarBalanceAndTransactions(t *testing.T) {
+	fb := &fakeBot{starTransactions: []models.StarTransaction{
+		{ID: "tx1", Amount: 50, Date: 1767322800, Source: &models.TransactionPartner{
+			Type: models.TransactionPartnerTypeUser,
+			User: &models.TransactionPartnerUser{User: models.User{ID: 42}, InvoicePayload: "ord_abc123"},
+		}},
+		{ID: "tx2", Amount: 50, Date: 1767326400, Receiver: &models.TransactionPartner{
+			Type: models.TransactionPartnerTypeUser,
+			User: &models.TransactionPartnerUser{User: models.User{ID: 42}},
+		}},
+		{ID: "tx3", Amount: 1000, Date: 1767330000, Receiver: &models.TransactionPartner{Type: models.TransactionPartnerTypeFragment}},
+	}}
+	client := &Client{bot: fb}
+
+	balance, err := client.StarBalance(context.Background())
+	if err != nil || balance != 1500 {
+		t.Fatalf("expected balance 1500, got %d err=%v", balance, err)
+	}
+
+	txs, err := client.StarTransactions(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("StarTransactions returned error: %v", err)
+	}
+	if len(txs) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(txs))
+	}
+	if got := txs[0]; !got.Incoming || got.UserID != 42 || got.Payload != "ord_abc123" || got.Partner != "user" || !got.Date.Equal(time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected incoming transaction %+v", got)
+	}
+	if got := txs[1]; got.Incoming || got.UserID != 42 {
+		t.Fatalf("unexpected refund transaction %+v", got)
+	}
+	if got := txs[2]; got.Incoming || got.Partner != "fragment" || got.UserID != 0 {
+		t.Fatalf("unexpected withdrawal transaction %+v", got)
+	}
+
+	if _, err := client.StarTransactions(context.Background(), 0, StarTransactionsMaxLimit+1); err == nil {
+		t.Fatalf("expected oversized limit to be rejected")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-telegram/bot"
@@ -20,12 +23,25 @@ import (
 
 type botRunner interface {
 	Start(ctx context.Context)
+	StartWebhook(ctx context.Context)
+	WebhookHandler() http.HandlerFunc
+	SetWebhook(ctx context.Context, params *bot.SetWebhookParams) (bool, error)
+	DeleteWebhook(ctx context.Context, params *bot.DeleteWebhookParams) (bool, error)
+	SetMyCommands(ctx context.Context, params *bot.SetMyCommandsParams) (bool, error)
+	DeleteMyCommands(ctx context.Context, params *bot.DeleteMyCommandsParams) (bool, error)
+	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
+	CopyMessage(ctx context.Context, params *bot.CopyMessageParams) (*models.MessageID, error)
+	EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error)
+	SendInvoice(ctx context.Context, params *bot.SendInvoiceParams) (*models.Message, error)
+	RefundStarPayment(ctx context.Context, params *bot.RefundStarPaymentParams) (bool, error)
+	GetMyStarBalance(ctx context.Context) (*models.StarAmount, error)
+	GetStarTransactions(ctx context.Context, params *bot.GetStarTransactionsParams) (*models.StarTransactions, error)
 }
 
 const (
-	pingMongoTimeout    = 2 * time.Second
-	statusLookupTimeout = 2 * time.Second
-	statusCountTimeout  = 2 * time.Second
+	pingMongoTimeout   = 2 * time.Second
+	statusCountTimeout = 2 * time.Second
+	groupMenuTimeout   = 10 * time.Second
 )
 
 var (
@@ -35,6 +51,7 @@ var (
 		"callback_query",
 		"my_chat_member",
 		"chat_member",
+		"pre_checkout_query",
 	}
 
 	createBot = func(token string, options ...bot.Option) (botRunner, error) {
@@ -46,14 +63,18 @@ var (
 	}
 )
 
-// UserRegistrar ensures users are persisted and tracked when updates arrive.
+// UserRegistrar ensures users are persisted and tracked when updates arrive,
+// refreshing their Telegram profile each time.
 type UserRegistrar interface {
-	EnsureUser(ctx context.Context, userID int64) (bool, error)
+	EnsureUser(ctx context.Context, profile domain.UserProfile) (bool, error)
 }
 
-// GroupRegistrar ensures groups are persisted when the bot encounters them.
+// GroupRegistrar ensures groups are persisted when the bot encounters them and
+// tracks the bot's own membership from my_chat_member updates.
 type GroupRegistrar interface {
 	EnsureGroup(ctx context.Context, chatID int64, title string) (bool, error)
+	RecordBotMembership(ctx context.Context, change domain.BotMembership) error
+	MigrateGroup(ctx context.Context, fromChatID, toChatID int64, title string) (bool, error)
 }
 
 // MongoChecker allows health checks against MongoDB.
@@ -66,10 +87,31 @@ type UserFetcher interface {
 	GetByID(ctx context.Context, userID int64) (domain.User, error)
 }
 
-// StatsProvider exposes simple collection counts for diagnostics.
+// UserLister lists users by role, used to scope the command menu.
+type UserLister interface {
+	ListByRole(ctx context.Context, role string) ([]domain.User, error)
+}
+
+// GroupLister lists the groups the bot is still a member of, used to show
+// admins their group commands.
+type GroupLister interface {
+	ListActive(ctx context.Context) ([]domain.Group, error)
+}
+
+// CommandAuditor records privileged command invocations and denials.
+// Implementations must not block the update for long; failures are theirs to
+// report.
+type CommandAuditor interface {
+	AuditCommand(ctx context.Context, record CommandAudit)
+}
+
+// StatsProvider exposes simple collection counts for diagnostics. CountGroups
+// counts groups the bot is still in; CountDepartedGroups those it left or was
+// removed from.
 type StatsProvider interface {
 	CountUsers(ctx context.Context) (int64, error)
 	CountGroups(ctx context.Context) (int64, error)
+	CountDepartedGroups(ctx context.Context) (int64, error)
 }
 
 type commandDiagnostics struct {
@@ -86,7 +128,13 @@ type clientOptions struct {
 	mongoChecker   MongoChecker
 	processStart   time.Time
 	userFetcher    UserFetcher
+	userLister     UserLister
+	groupLister    GroupLister
 	statsProvider  StatsProvider
+	commandAuditor CommandAuditor
+	dispatcher     DispatcherSettings
+	metrics        MetricsRecorder
+	conversations  ConversationStore
 }
 
 // ClientOption configures optional Telegram client dependencies.
@@ -127,6 +175,21 @@ func WithUserFetcher(fetcher UserFetcher) ClientOption {
 	}
 }
 
+// WithUserLister supplies a role-based user lister for command menu scopes.
+func WithUserLister(lister UserLister) ClientOption {
+	return func(opts *clientOptions) {
+		opts.userLister = lister
+	}
+}
+
+// WithGroupLister supplies the tracked groups for per-admin group command
+// menu scopes.
+func WithGroupLister(lister GroupLister) ClientOption {
+	return func(opts *clientOptions) {
+		opts.groupLister = lister
+	}
+}
+
 // WithStatsProvider supplies a diagnostics provider for live collection counts.
 func WithStatsProvider(provider StatsProvider) ClientOption {
 	return func(opts *clientOptions) {
@@ -134,13 +197,31 @@ func WithStatsProvider(provider StatsProvider) ClientOption {
 	}
 }
 
+// WithCommandAuditor records admin and owner command invocations plus every
+// permission denial.
+func WithCommandAuditor(auditor CommandAuditor) ClientOption {
+	return func(opts *clientOptions) {
+		opts.commandAuditor = auditor
+	}
+}
+
 // Client wraps the Telegram bot instance and logging dependencies.
 type Client struct {
-	bot    botRunner
-	logger *logrus.Entry
+	bot         botRunner
+	logger      *logrus.Entry
+	router      *messageRouter
+	dispatcher  *updateDispatcher
+	webhook     webhookSettings
+	botOwnerID  int64
+	userLister  UserLister
+	groupLister GroupLister
+	// paymentProviderToken is sent with Telegram Payments invoices.
+	paymentProviderToken string
+	running              atomic.Bool
 }
 
-// NewClient initializes the Telegram bot with long polling and default handlers.
+// NewClient initializes the Telegram bot with default handlers. Updates are
+// received via long polling unless the configuration selects webhook mode.
 func NewClient(cfg config.Config, logger *logrus.Entry, opts ...ClientOption) (*Client, error) {
 	if strings.TrimSpace(cfg.TelegramToken) == "" {
 		return nil, errors.New("telegram token is required")
@@ -164,27 +245,88 @@ func NewClient(cfg config.Config, logger *logrus.Entry, opts ...ClientOption) (*
 		statsProvider: clientOpts.statsProvider,
 	})
 
-	tgBot, err := createBot(cfg.TelegramToken,
+	router := newMessageRouter(logger, cfg.BotOwnerID, diag)
+	router.auditor = clientOpts.commandAuditor
+	router.callbackKey = callbackSigningKey(cfg.TelegramToken)
+	router.limiter = newRateLimiter(cfg.RateLimitUser, cfg.RateLimitChat, cfg.RateLimitCommands, time.Now)
+	if clientOpts.conversations != nil {
+		if err := router.enableConversations(clientOpts.conversations); err != nil {
+			return nil, fmt.Errorf("enable conversations: %w", err)
+		}
+	}
+
+	dispatcher := newUpdateDispatcher(clientOpts.dispatcher,
+		routedHandler(logger, clientOpts.userRegistrar, clientOpts.groupRegistrar, router), logger)
+
+	// The bot hands updates to the dispatcher synchronously so a full queue
+	// pushes back on polling instead of spawning a goroutine per update.
+	botOpts := []bot.Option{
 		bot.WithAllowedUpdates(defaultAllowedUpdates),
-		bot.WithDefaultHandler(defaultHandler(logger, clientOpts.userRegistrar, clientOpts.groupRegistrar, cfg.BotOwnerID, diag)),
+		bot.WithDefaultHandler(dispatcher.Dispatch),
+		bot.WithNotAsyncHandlers(),
 		bot.WithErrorsHandler(errorHandler(logger)),
-	)
+	}
+	if clientOpts.metrics != nil {
+		router.metrics = clientOpts.metrics
+		dispatcher.metrics = clientOpts.metrics
+		botOpts = append(botOpts, bot.WithHTTPClient(telegramPollTimeout, newInstrumentedHTTPClient(clientOpts.metrics)))
+	}
+
+	tgBot, err := createBot(cfg.TelegramToken, botOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("init telegram bot client: %w", err)
 	}
 
-	return &Client{
-		bot:    tgBot,
-		logger: logger,
-	}, nil
+	client := &Client{
+		bot:         tgBot,
+		logger:      logger,
+		router:      router,
+		dispatcher:  dispatcher,
+		webhook:     newWebhookSettings(cfg),
+		botOwnerID:  cfg.BotOwnerID,
+		userLister:  clientOpts.userLister,
+		groupLister: clientOpts.groupLister,
+
+		paymentProviderToken: cfg.PaymentProviderToken,
+	}
+	router.groupJoined = client.refreshGroupMenu
+
+	return client, nil
+}
+
+// refreshGroupMenu publishes the admin and owner menus in a group the bot
+// joined after startup; failures are logged because the membership itself is
+// already recorded.
+func (c *Client) refreshGroupMenu(ctx context.Context, chatID int64) {
+	menuCtx, cancel := context.WithTimeout(ctx, groupMenuTimeout)
+	defer cancel()
+
+	if err := c.PublishGroupCommands(menuCtx, chatID); err != nil {
+		c.logger.WithFields(logging.Fields{
+			"event":   "telegram_group_commands_failed",
+			"chat_id": chatID,
+		}).WithError(err).Warn("failed to publish command menus for joined group")
+	}
 }
 
-// Start begins receiving updates via long polling until the context is canceled.
+// Start begins receiving updates until the context is canceled, using the
+// webhook listener in webhook mode and long polling otherwise.
 func (c *Client) Start(ctx context.Context) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	dispatcherDone := c.runDispatcher(ctx)
+	defer func() { <-dispatcherDone }()
+
+	c.running.Store(true)
+	defer c.running.Store(false)
+
+	if c.webhook.enabled {
+		c.startWebhook(ctx)
+		return
+	}
+
 	c.logger.WithFields(logging.Fields{
 		"event":           "telegram_listen",
 		"allowed_updates": defaultAllowedUpdates,
@@ -195,14 +337,63 @@ func (c *Client) Start(ctx context.Context) {
 	c.logger.WithField("event", "telegram_stopped").Info("telegram polling stopped")
 }
 
+// Running reports whether Start is receiving updates, by long polling or
+// through the webhook listener.
+func (c *Client) Running() bool {
+	if c == nil {
+		return false
+	}
+
+	return c.running.Load()
+}
+
+// runDispatcher starts the update workers and returns a channel closed once
+// they stop after ctx is canceled.
+func (c *Client) runDispatcher(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	if c.dispatcher == nil {
+		close(done)
+		return done
+	}
+
+	go func() {
+		c.dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	return done
+}
+
+// DispatcherStats reports the update queue depth, throughput, and handler
+// latency.
+func (c *Client) DispatcherStats() DispatcherStats {
+	if c == nil || c.dispatcher == nil {
+		return DispatcherStats{}
+	}
+
+	return c.dispatcher.Stats()
+}
+
 type updateMeta struct {
-	userID     int64
+	userID int64
+	// profile is the sender's Telegram profile; UserID matches userID.
+	profile    domain.UserProfile
 	chatID     int64
 	text       string
 	updateType string
 	chatType   string
 	chatTitle  string
-	timestamp  time.Time
+	// replyText is the text or caption of the message being replied to.
+	replyText string
+	// replyUserID is the sender of the message being replied to.
+	replyUserID int64
+	// membership is the bot's own status change in my_chat_member updates.
+	membership *domain.BotMembership
+	// migrateToChatID and migrateFromChatID carry a group-to-supergroup
+	// upgrade, announced in the old and the new chat respectively.
+	migrateToChatID   int64
+	migrateFromChatID int64
+	timestamp         time.Time
 }
 
 type registeredHandler struct {
@@ -211,10 +402,25 @@ type registeredHandler struct {
 }
 
 type messageRouter struct {
-	logger          *logrus.Entry
-	commandHandlers map[string]registeredHandler
-	unknownHandler  registeredHandler
-	genericHandler  registeredHandler
+	logger        *logrus.Entry
+	botOwnerID    int64
+	userFetcher   UserFetcher
+	auditor       CommandAuditor
+	limiter       *rateLimiter
+	metrics       MetricsRecorder
+	mu            sync.RWMutex
+	commands      map[string]registeredCommand
+	commandOrder  []string
+	callbacks     map[string]Callback
+	callbackKey   []byte
+	dialogs       map[string]Dialog
+	conversations ConversationStore
+	payments      PaymentProcessor
+	// groupJoined publishes the group menus of a group the bot just joined.
+	groupJoined    func(ctx context.Context, chatID int64)
+	now            func() time.Time
+	unknownHandler registeredHandler
+	genericHandler registeredHandler
 }
 
 func normalizeDiagnostics(diag commandDiagnostics) commandDiagnostics {
@@ -229,22 +435,15 @@ func normalizeDiagnostics(diag commandDiagnostics) commandDiagnostics {
 }
 
 func newMessageRouter(logger *logrus.Entry, botOwnerID int64, diag commandDiagnostics) *messageRouter {
-	return &messageRouter{
-		logger: logger,
-		commandHandlers: map[string]registeredHandler{
-			"start": {
-				name:    "command_start",
-				handler: startCommandHandler(logger, botOwnerID),
-			},
-			"ping": {
-				name:    "command_ping",
-				handler: pingCommandHandler(logger, diag),
-			},
-			"status": {
-				name:    "command_status",
-				handler: statusCommandHandler(logger, botOwnerID, diag),
-			},
-		},
+	router := &messageRouter{
+		logger:      logger,
+		botOwnerID:  botOwnerID,
+		userFetcher: diag.userFetcher,
+		metrics:     noopMetrics{},
+		commands:    make(map[string]registeredCommand),
+		callbacks:   make(map[string]Callback),
+		dialogs:     make(map[string]Dialog),
+		now:         time.Now,
 		unknownHandler: registeredHandler{
 			name:    "command_unknown",
 			handler: commandLoggerHandler(logger, "command_unknown"),
@@ -254,9 +453,47 @@ func newMessageRouter(logger *logrus.Entry, botOwnerID int64, diag commandDiagno
 			handler: genericLoggerHandler(logger),
 		},
 	}
+
+	builtins := []Command{
+		{
+			Name:        "start",
+			Description: "Register with the bot and show your role",
+			ChatTypes:   []string{ChatTypePrivate},
+			Handler:     startCommandHandler(logger, botOwnerID),
+		},
+		{
+			Name:        "ping",
+			Description: "Check bot health",
+			Handler:     pingCommandHandler(logger, diag),
+		},
+		{
+			Name:        "status",
+			Description: "Show bot status and registration counts",
+			MinRole:     domain.RoleOwner,
+			Handler:     statusCommandHandler(logger, diag),
+		},
+	}
+
+	for _, cmd := range builtins {
+		if err := router.register(cmd); err != nil {
+			panic(fmt.Sprintf("register builtin command: %v", err))
+		}
+	}
+
+	return router
 }
 
 func (r *messageRouter) route(ctx context.Context, b *bot.Bot, update *models.Update, meta updateMeta) string {
+	if update != nil && update.CallbackQuery != nil {
+		return r.routeCallback(ctx, b, update, meta)
+	}
+	if update != nil && update.PreCheckoutQuery != nil {
+		return r.routePreCheckout(ctx, b, update, meta)
+	}
+	if update != nil && update.Message != nil && update.Message.SuccessfulPayment != nil {
+		return r.routePayment(ctx, b, update, meta)
+	}
+
 	msg := primaryMessage(update)
 	if msg == nil {
 		return ""
@@ -265,15 +502,64 @@ func (r *messageRouter) route(ctx context.Context, b *bot.Bot, update *models.Up
 	normalizedChatType := normalizeChatType(meta.chatType)
 
 	if isCommand(meta.text) {
-		cmd := commandName(meta.text)
-		target, ok := r.commandHandlers[cmd]
+		name := commandName(meta.text)
+		if update.Message == nil {
+			// Editing a command message must not run it again: some
+			// commands move money or create orders.
+			r.logger.WithFields(logging.Fields{
+				"event":     "command_edit_ignored",
+				"command":   name,
+				"chat_type": normalizedChatType,
+				"user_id":   meta.userID,
+				"chat_id":   meta.chatID,
+			}).Info("ignored command in edited message")
+			return ""
+		}
+
+		cmd, ok := r.lookup(name)
 		if !ok {
-			target = r.unknownHandler
+			r.logRoute(meta, normalizedChatType, r.unknownHandler.name, "command", name)
+			r.metrics.CommandRouted(unknownCommandLabel, CommandOutcomeUnknown)
+			r.unknownHandler.handler(ctx, b, update)
+			return r.unknownHandler.name
+		}
+
+		r.logRoute(meta, normalizedChatType, cmd.handlerName, "command", name)
+
+		if !cmd.allowsChatType(normalizedChatType) {
+			r.logger.WithFields(logging.Fields{
+				"event":     "command_ignored",
+				"handler":   cmd.handlerName,
+				"command":   name,
+				"chat_type": normalizedChatType,
+				"user_id":   meta.userID,
+				"chat_id":   meta.chatID,
+			}).Info("ignored command in unsupported chat type")
+			r.metrics.CommandRouted(cmd.Name, CommandOutcomeIgnored)
+			return cmd.handlerName
 		}
 
-		r.logRoute(meta, normalizedChatType, target.name, "command", cmd)
-		target.handler(ctx, b, update)
-		return target.name
+		// Throttle before authorizing so floods never reach the user store.
+		if !r.checkRateLimit(ctx, b, cmd, meta) {
+			r.metrics.CommandRouted(cmd.Name, CommandOutcomeRateLimited)
+			return cmd.handlerName
+		}
+
+		handlerCtx, ok := r.authorize(ctx, b, cmd, meta)
+		if !ok {
+			r.metrics.CommandRouted(cmd.Name, CommandOutcomeDenied)
+			return cmd.handlerName
+		}
+
+		r.metrics.CommandRouted(cmd.Name, CommandOutcomeHandled)
+		cmd.Handler(handlerCtx, b, update)
+		return cmd.handlerName
+	}
+
+	// Free text goes to the sender's active conversation, if any, before
+	// falling back to the generic handler.
+	if handlerName, ok := r.routeDialog(ctx, b, update, meta); ok {
+		return handlerName
 	}
 
 	r.logRoute(meta, normalizedChatType, r.genericHandler.name, "message", "")
@@ -308,8 +594,11 @@ func defaultHandler(logger *logrus.Entry, userRegistrar UserRegistrar, groupRegi
 	}
 
 	diag = normalizeDiagnostics(diag)
-	router := newMessageRouter(logger, botOwnerID, diag)
 
+	return routedHandler(logger, userRegistrar, groupRegistrar, newMessageRouter(logger, botOwnerID, diag))
+}
+
+func routedHandler(logger *logrus.Entry, userRegistrar UserRegistrar, groupRegistrar GroupRegistrar, router *messageRouter) bot.HandlerFunc {
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
 		if update == nil {
 			return
@@ -326,24 +615,36 @@ func defaultHandler(logger *logrus.Entry, userRegistrar UserRegistrar, groupRegi
 		}
 
 		normalizedChatType := normalizeChatType(meta.chatType)
+		router.metrics.UpdateReceived(meta.updateType)
 
 		if userRegistrar != nil && meta.userID != 0 {
-			if _, err := userRegistrar.EnsureUser(ctx, meta.userID); err != nil {
+			created, err := userRegistrar.EnsureUser(ctx, meta.profile)
+			if err != nil {
 				logger.WithFields(logging.Fields{
 					"event":   "user_registration_failed",
 					"user_id": meta.userID,
 					"chat_id": meta.chatID,
 				}).WithError(err).Error("failed to ensure user registration")
+			} else if created {
+				router.metrics.Registered(RegistrationUser)
 			}
 		}
 
 		if groupRegistrar != nil && meta.chatID != 0 && normalizedChatType == "group" {
-			if _, err := groupRegistrar.EnsureGroup(ctx, meta.chatID, meta.chatTitle); err != nil {
+			if registerGroup(ctx, logger, groupRegistrar, meta) {
+				router.metrics.Registered(RegistrationGroup)
+			}
+		}
+
+		if groupRegistrar != nil && meta.membership != nil && normalizedChatType == "group" {
+			if err := groupRegistrar.RecordBotMembership(ctx, *meta.membership); err != nil {
 				logger.WithFields(logging.Fields{
-					"event":      "group_registration_failed",
+					"event":      "group_membership_failed",
 					"chat_id":    meta.chatID,
-					"chat_title": meta.chatTitle,
-				}).WithError(err).Error("failed to ensure group registration")
+					"bot_status": meta.membership.Status,
+				}).WithError(err).Error("failed to record bot membership")
+			} else if router.groupJoined != nil && !domain.IsActiveBotStatus(meta.membership.OldStatus) && domain.IsActiveBotStatus(meta.membership.Status) {
+				router.groupJoined(ctx, meta.chatID)
 			}
 		}
 
@@ -375,6 +676,43 @@ func defaultHandler(logger *logrus.Entry, userRegistrar UserRegistrar, groupRegi
 	}
 }
 
+// registerGroup records the group behind an update and reports whether it was
+// new. The migration notice in the old chat must not re-register that chat,
+// since the migration deletes it.
+func registerGroup(ctx context.Context, logger *logrus.Entry, registrar GroupRegistrar, meta updateMeta) bool {
+	if meta.migrateToChatID != 0 {
+		migrateGroup(ctx, logger, registrar, meta.chatID, meta.migrateToChatID, meta.chatTitle)
+		return false
+	}
+
+	created, err := registrar.EnsureGroup(ctx, meta.chatID, meta.chatTitle)
+	if err != nil {
+		logger.WithFields(logging.Fields{
+			"event":      "group_registration_failed",
+			"chat_id":    meta.chatID,
+			"chat_title": meta.chatTitle,
+		}).WithError(err).Error("failed to ensure group registration")
+	}
+
+	// An upgraded group is not new even though its chat ID is.
+	if meta.migrateFromChatID != 0 {
+		migrateGroup(ctx, logger, registrar, meta.migrateFromChatID, meta.chatID, meta.chatTitle)
+		return false
+	}
+
+	return created
+}
+
+func migrateGroup(ctx context.Context, logger *logrus.Entry, registrar GroupRegistrar, fromChatID, toChatID int64, title string) {
+	if _, err := registrar.MigrateGroup(ctx, fromChatID, toChatID, title); err != nil {
+		logger.WithFields(logging.Fields{
+			"event":        "group_migration_failed",
+			"from_chat_id": fromChatID,
+			"to_chat_id":   toChatID,
+		}).WithError(err).Error("failed to migrate group")
+	}
+}
+
 func extractUpdateMeta(update *models.Update) updateMeta {
 	meta := updateMeta{
 		timestamp: updateTimestamp(update),
@@ -382,38 +720,54 @@ func extractUpdateMeta(update *models.Update) updateMeta {
 
 	switch {
 	case update.Message != nil:
-		meta.userID = userID(update.Message.From)
+		meta.profile = userProfile(update.Message.From)
+		meta.userID = meta.profile.UserID
 		meta.chatID = chatID(&update.Message.Chat)
 		meta.text = strings.TrimSpace(update.Message.Text)
 		meta.chatTitle = chatTitle(&update.Message.Chat)
 		meta.chatType = string(update.Message.Chat.Type)
+		meta.replyText = messageText(update.Message.ReplyToMessage)
+		if reply := update.Message.ReplyToMessage; reply != nil {
+			meta.replyUserID = userID(reply.From)
+		}
+		meta.migrateToChatID = update.Message.MigrateToChatID
+		meta.migrateFromChatID = update.Message.MigrateFromChatID
 		meta.updateType = "message"
 	case update.EditedMessage != nil:
-		meta.userID = userID(update.EditedMessage.From)
+		meta.profile = userProfile(update.EditedMessage.From)
+		meta.userID = meta.profile.UserID
 		meta.chatID = chatID(&update.EditedMessage.Chat)
 		meta.text = strings.TrimSpace(update.EditedMessage.Text)
 		meta.chatTitle = chatTitle(&update.EditedMessage.Chat)
 		meta.chatType = string(update.EditedMessage.Chat.Type)
 		meta.updateType = "edited_message"
 	case update.CallbackQuery != nil:
-		meta.userID = userID(&update.CallbackQuery.From)
+		meta.profile = userProfile(&update.CallbackQuery.From)
+		meta.userID = meta.profile.UserID
 		meta.chatID = messageChatID(update.CallbackQuery.Message)
 		meta.text = strings.TrimSpace(update.CallbackQuery.Data)
 		meta.chatTitle = messageChatTitle(update.CallbackQuery.Message)
 		meta.chatType = messageChatType(update.CallbackQuery.Message)
 		meta.updateType = "callback_query"
 	case update.MyChatMember != nil:
-		meta.userID = userID(&update.MyChatMember.From)
+		meta.profile = userProfile(&update.MyChatMember.From)
+		meta.userID = meta.profile.UserID
 		meta.chatID = chatID(&update.MyChatMember.Chat)
 		meta.chatTitle = chatTitle(&update.MyChatMember.Chat)
 		meta.chatType = string(update.MyChatMember.Chat.Type)
+		meta.membership = botMembership(update.MyChatMember, meta.timestamp)
 		meta.updateType = "my_chat_member"
 	case update.ChatMember != nil:
-		meta.userID = userID(&update.ChatMember.From)
+		meta.profile = userProfile(&update.ChatMember.From)
+		meta.userID = meta.profile.UserID
 		meta.chatID = chatID(&update.ChatMember.Chat)
 		meta.chatTitle = chatTitle(&update.ChatMember.Chat)
 		meta.chatType = string(update.ChatMember.Chat.Type)
 		meta.updateType = "chat_member"
+	case update.PreCheckoutQuery != nil:
+		meta.profile = userProfile(update.PreCheckoutQuery.From)
+		meta.userID = meta.profile.UserID
+		meta.updateType = "pre_checkout_query"
 	default:
 		meta.updateType = "unknown"
 	}
@@ -421,6 +775,18 @@ func extractUpdateMeta(update *models.Update) updateMeta {
 	return meta
 }
 
+// messageText returns the trimmed text of msg, falling back to its caption.
+func messageText(msg *models.Message) string {
+	if msg == nil {
+		return ""
+	}
+	if text := strings.TrimSpace(msg.Text); text != "" {
+		return text
+	}
+
+	return strings.TrimSpace(msg.Caption)
+}
+
 func updateTimestamp(update *models.Update) time.Time {
 	switch {
 	case update == nil:
@@ -496,6 +862,49 @@ func userID(user *models.User) int64 {
 	return user.ID
 }
 
+// botMembership converts a my_chat_member update, which always describes the
+// bot itself, into a membership change.
+func botMembership(update *models.ChatMemberUpdated, at time.Time) *domain.BotMembership {
+	change := &domain.BotMembership{
+		ChatID:    update.Chat.ID,
+		Title:     chatTitle(&update.Chat),
+		OldStatus: string(update.OldChatMember.Type),
+		Status:    string(update.NewChatMember.Type),
+		ChangedBy: update.From.ID,
+		ChangedAt: at,
+	}
+
+	if admin := update.NewChatMember.Administrator; admin != nil {
+		change.Rights = &domain.BotRights{
+			CanManageChat:      admin.CanManageChat,
+			CanDeleteMessages:  admin.CanDeleteMessages,
+			CanRestrictMembers: admin.CanRestrictMembers,
+			CanPromoteMembers:  admin.CanPromoteMembers,
+			CanChangeInfo:      admin.CanChangeInfo,
+			CanInviteUsers:     admin.CanInviteUsers,
+			CanPinMessages:     admin.CanPinMessages,
+		}
+	}
+
+	return change
+}
+
+func userProfile(user *models.User) domain.UserProfile {
+	if user == nil {
+		return domain.UserProfile{}
+	}
+
+	return domain.UserProfile{
+		UserID:       user.ID,
+		Username:     user.Username,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		LanguageCode: user.LanguageCode,
+		IsBot:        user.IsBot,
+		IsPremium:    user.IsPremium,
+	}
+}
+
 func chatID(chat *models.Chat) int64 {
 	if chat == nil {
 		return 0
@@ -734,11 +1143,12 @@ func pingMessage(appEnv string, uptime time.Duration, mongoStatus string) string
 }
 
 type statusCounts struct {
-	users  string
-	groups string
+	users    string
+	groups   string
+	departed string
 }
 
-func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDiagnostics) bot.HandlerFunc {
+func statusCommandHandler(logger *logrus.Entry, diag commandDiagnostics) bot.HandlerFunc {
 	if logger == nil {
 		logger = logging.Logger()
 	}
@@ -761,82 +1171,10 @@ func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDi
 			return
 		}
 
-		role := ""
-		authorized := false
-
-		if meta.userID == 0 {
-			logger.WithFields(logging.Fields{
-				"event":     "command_status_denied",
-				"reason":    "missing_user_id",
-				"chat_id":   meta.chatID,
-				"chat_type": normalizeChatType(meta.chatType),
-			}).Warn("status command denied due to missing user_id")
-		} else if diag.userFetcher == nil {
-			logger.WithFields(logging.Fields{
-				"event":     "command_status_user_lookup_missing",
-				"user_id":   meta.userID,
-				"chat_id":   meta.chatID,
-				"chat_type": normalizeChatType(meta.chatType),
-			}).Error("status command missing user fetcher")
-		} else {
-			authCtx, cancel := context.WithTimeout(ctx, statusLookupTimeout)
-			user, err := diag.userFetcher.GetByID(authCtx, meta.userID)
-			cancel()
-
-			if err != nil {
-				logger.WithFields(logging.Fields{
-					"event":     "command_status_user_lookup_failed",
-					"user_id":   meta.userID,
-					"chat_id":   meta.chatID,
-					"chat_type": normalizeChatType(meta.chatType),
-				}).WithError(err).Error("failed to load user for status command")
-			} else {
-				role = strings.TrimSpace(user.Role)
-				if meta.userID == botOwnerID && domain.RolePriority(role) >= domain.RolePriorityOwner {
-					authorized = true
-				}
-			}
-		}
-
-		if !authorized {
-			if b == nil {
-				logger.WithFields(logging.Fields{
-					"event":     "command_status_send_failed",
-					"user_id":   meta.userID,
-					"chat_id":   meta.chatID,
-					"chat_type": normalizeChatType(meta.chatType),
-					"role":      role,
-				}).Error("cannot send permission denied response without telegram client")
-				return
-			}
-
-			if _, err := sendMessage(ctx, b, &bot.SendMessageParams{
-				ChatID: meta.chatID,
-				Text:   "permission denied",
-			}); err != nil {
-				logger.WithFields(logging.Fields{
-					"event":     "command_status_send_failed",
-					"user_id":   meta.userID,
-					"chat_id":   meta.chatID,
-					"chat_type": normalizeChatType(meta.chatType),
-					"role":      role,
-				}).WithError(err).Error("failed to send permission denied response")
-				return
-			}
-
-			logger.WithFields(logging.Fields{
-				"event":     "command_status_denied",
-				"user_id":   meta.userID,
-				"chat_id":   meta.chatID,
-				"chat_type": normalizeChatType(meta.chatType),
-				"role":      role,
-			}).Info("status command denied")
-			return
-		}
-
 		counts := statusCounts{
-			users:  "error",
-			groups: "error",
+			users:    "error",
+			groups:   "error",
+			departed: "error",
 		}
 
 		if diag.statsProvider == nil {
@@ -845,12 +1183,12 @@ func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDi
 				"user_id":   meta.userID,
 				"chat_id":   meta.chatID,
 				"chat_type": normalizeChatType(meta.chatType),
-				"role":      role,
 			}).Error("status command missing stats provider")
 		} else {
 			statsCtx, cancel := context.WithTimeout(ctx, statusCountTimeout)
 			userCount, userErr := diag.statsProvider.CountUsers(statsCtx)
 			groupCount, groupErr := diag.statsProvider.CountGroups(statsCtx)
+			departedCount, departedErr := diag.statsProvider.CountDepartedGroups(statsCtx)
 			cancel()
 
 			if userErr != nil {
@@ -859,7 +1197,6 @@ func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDi
 					"user_id":   meta.userID,
 					"chat_id":   meta.chatID,
 					"chat_type": normalizeChatType(meta.chatType),
-					"role":      role,
 				}).WithError(userErr).Error("failed to count users for /status")
 			} else {
 				counts.users = strconv.FormatInt(userCount, 10)
@@ -871,11 +1208,21 @@ func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDi
 					"user_id":   meta.userID,
 					"chat_id":   meta.chatID,
 					"chat_type": normalizeChatType(meta.chatType),
-					"role":      role,
 				}).WithError(groupErr).Error("failed to count groups for /status")
 			} else {
 				counts.groups = strconv.FormatInt(groupCount, 10)
 			}
+
+			if departedErr != nil {
+				logger.WithFields(logging.Fields{
+					"event":     "command_status_departed_count_error",
+					"user_id":   meta.userID,
+					"chat_id":   meta.chatID,
+					"chat_type": normalizeChatType(meta.chatType),
+				}).WithError(departedErr).Error("failed to count departed groups for /status")
+			} else {
+				counts.departed = strconv.FormatInt(departedCount, 10)
+			}
 		}
 
 		messageText := statusMessage(diag.appEnv, counts)
@@ -886,9 +1233,9 @@ func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDi
 				"user_id":   meta.userID,
 				"chat_id":   meta.chatID,
 				"chat_type": normalizeChatType(meta.chatType),
-				"role":      role,
 				"users":     counts.users,
 				"groups":    counts.groups,
+				"departed":  counts.departed,
 			}).Error("cannot send status response without telegram client")
 			return
 		}
@@ -902,9 +1249,9 @@ func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDi
 				"user_id":   meta.userID,
 				"chat_id":   meta.chatID,
 				"chat_type": normalizeChatType(meta.chatType),
-				"role":      role,
 				"users":     counts.users,
 				"groups":    counts.groups,
+				"departed":  counts.departed,
 			}).WithError(err).Error("failed to send status response")
 			return
 		}
@@ -914,9 +1261,9 @@ func statusCommandHandler(logger *logrus.Entry, botOwnerID int64, diag commandDi
 			"user_id":   meta.userID,
 			"chat_id":   meta.chatID,
 			"chat_type": normalizeChatType(meta.chatType),
-			"role":      role,
 			"users":     counts.users,
 			"groups":    counts.groups,
+			"departed":  counts.departed,
 		}).Info("sent status response")
 	}
 }
@@ -937,10 +1284,16 @@ func statusMessage(appEnv string, counts statusCounts) string {
 		groupCount = "error"
 	}
 
+	departedCount := strings.TrimSpace(counts.departed)
+	if departedCount == "" {
+		departedCount = "error"
+	}
+
 	lines := []string{
 		"bot_status: running",
 		fmt.Sprintf("env: %s", env),
 		fmt.Sprintf("connected_chats: %s", groupCount),
+		fmt.Sprintf("departed_chats: %s", departedCount),
 		fmt.Sprintf("registered_users: %s", userCount),
 	}
 
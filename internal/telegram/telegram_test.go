@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
@@ -18,13 +19,113 @@ import (
 )
 
 type fakeBot struct {
-	startedWith context.Context
+	startedWith         context.Context
+	webhookStartedWith  context.Context
+	setWebhookParams    *bot.SetWebhookParams
+	setWebhookErr       error
+	deleteWebhookCalls  int
+	setCommandsCalls    []*bot.SetMyCommandsParams
+	setCommandsErr      error
+	deleteCommandsCalls []*bot.DeleteMyCommandsParams
+	sendCalls           []*bot.SendMessageParams
+	copyCalls           []*bot.CopyMessageParams
+	editCalls           []*bot.EditMessageTextParams
+	invoiceCalls        []*bot.SendInvoiceParams
+	refundCalls         []*bot.RefundStarPaymentParams
+	starTransactions    []models.StarTransaction
+	sendErr             error
 }
 
 func (f *fakeBot) Start(ctx context.Context) {
 	f.startedWith = ctx
 }
 
+func (f *fakeBot) StartWebhook(ctx context.Context) {
+	f.webhookStartedWith = ctx
+	<-ctx.Done()
+}
+
+func (f *fakeBot) WebhookHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (f *fakeBot) SetWebhook(_ context.Context, params *bot.SetWebhookParams) (bool, error) {
+	f.setWebhookParams = params
+	return f.setWebhookErr == nil, f.setWebhookErr
+}
+
+func (f *fakeBot) SetMyCommands(_ context.Context, params *bot.SetMyCommandsParams) (bool, error) {
+	f.setCommandsCalls = append(f.setCommandsCalls, params)
+	return f.setCommandsErr == nil, f.setCommandsErr
+}
+
+func (f *fakeBot) DeleteMyCommands(_ context.Context, params *bot.DeleteMyCommandsParams) (bool, error) {
+	f.deleteCommandsCalls = append(f.deleteCommandsCalls, params)
+	return true, nil
+}
+
+func (f *fakeBot) SendMessage(_ context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	f.sendCalls = append(f.sendCalls, params)
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	return &models.Message{ID: len(f.sendCalls)}, nil
+}
+
+func (f *fakeBot) SendInvoice(_ context.Context, params *bot.SendInvoiceParams) (*models.Message, error) {
+	f.invoiceCalls = append(f.invoiceCalls, params)
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	return &models.Message{ID: 100 + len(f.invoiceCalls)}, nil
+}
+
+func (f *fakeBot) RefundStarPayment(_ context.Context, params *bot.RefundStarPaymentParams) (bool, error) {
+	f.refundCalls = append(f.refundCalls, params)
+	if f.sendErr != nil {
+		return false, f.sendErr
+	}
+	return true, nil
+}
+
+func (f *fakeBot) GetMyStarBalance(context.Context) (*models.StarAmount, error) {
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	return &models.StarAmount{Amount: 1500}, nil
+}
+
+func (f *fakeBot) GetStarTransactions(_ context.Context, params *bot.GetStarTransactionsParams) (*models.StarTransactions, error) {
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	end := min(params.Offset+params.Limit, len(f.starTransactions))
+	if params.Offset >= end {
+		return &models.StarTransactions{}, nil
+	}
+	return &models.StarTransactions{Transactions: f.starTransactions[params.Offset:end]}, nil
+}
+
+func (f *fakeBot) CopyMessage(_ context.Context, params *bot.CopyMessageParams) (*models.MessageID, error) {
+	f.copyCalls = append(f.copyCalls, params)
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	return &models.MessageID{ID: len(f.copyCalls)}, nil
+}
+
+func (f *fakeBot) EditMessageText(_ context.Context, params *bot.EditMessageTextParams) (*models.Message, error) {
+	f.editCalls = append(f.editCalls, params)
+	return &models.Message{ID: params.MessageID}, nil
+}
+
+func (f *fakeBot) DeleteWebhook(context.Context, *bot.DeleteWebhookParams) (bool, error) {
+	f.deleteWebhookCalls++
+	return true, nil
+}
+
 func TestNewClientCreatesBot(t *testing.T) {
 	origCreateBot := createBot
 	defer func() { createBot = origCreateBot }()
@@ -56,8 +157,11 @@ func TestNewClientCreatesBot(t *testing.T) {
 		t.Fatalf("expected token %q, got %q", cfg.TelegramToken, gotToken)
 	}
 
-	if len(gotOptions) != 3 {
-		t.Fatalf("expected 3 bot options (allowed updates, default handler, error handler), got %d", len(gotOptions))
+	if len(gotOptions) != 4 {
+		t.Fatalf("expected 4 bot options (allowed updates, default handler, synchronous handlers, error handler), got %d", len(gotOptions))
+	}
+	if client.dispatcher == nil {
+		t.Fatalf("expected the update dispatcher to be initialized")
 	}
 }
 
@@ -131,6 +235,29 @@ func TestExtractUpdateMeta(t *testing.T) {
 				timestamp:  time.Unix(1700000000, 0).UTC(),
 			},
 		},
+		{
+			name: "message replying to forwarded caption",
+			update: &models.Update{
+				Message: &models.Message{
+					From:           &models.User{ID: 10},
+					Chat:           models.Chat{ID: -20, Type: models.ChatTypeGroup, Title: "Ops"},
+					Date:           1700000000,
+					Text:           "/order",
+					ReplyToMessage: &models.Message{From: &models.User{ID: 12}, Caption: " order_id: ord_1 "},
+				},
+			},
+			want: updateMeta{
+				userID:      10,
+				chatID:      -20,
+				text:        "/order",
+				updateType:  "message",
+				chatType:    string(models.ChatTypeGroup),
+				chatTitle:   "Ops",
+				replyText:   "order_id: ord_1",
+				replyUserID: 12,
+				timestamp:   time.Unix(1700000000, 0).UTC(),
+			},
+		},
 		{
 			name: "edited message",
 			update: &models.Update{
@@ -293,7 +420,7 @@ func TestDefaultHandlerRegistersUser(t *testing.T) {
 
 	update := &models.Update{
 		Message: &models.Message{
-			From: &models.User{ID: 66},
+			From: &models.User{ID: 66, Username: "ann", FirstName: "Ann", LastName: "Lee", LanguageCode: "de", IsPremium: true},
 			Chat: models.Chat{ID: 166, Type: models.ChatTypePrivate},
 			Text: "ping",
 		},
@@ -304,6 +431,10 @@ func TestDefaultHandlerRegistersUser(t *testing.T) {
 	if len(registrar.calls) != 1 || registrar.calls[0] != 66 {
 		t.Fatalf("expected registrar to be called with user_id=66, got %v", registrar.calls)
 	}
+	want := domain.UserProfile{UserID: 66, Username: "ann", FirstName: "Ann", LastName: "Lee", LanguageCode: "de", IsPremium: true}
+	if registrar.profiles[0] != want {
+		t.Fatalf("expected profile %+v, got %+v", want, registrar.profiles[0])
+	}
 
 	if findEvent(hook.AllEntries(), "telegram_update") == nil {
 		t.Fatalf("expected telegram_update log entry")
@@ -389,6 +520,134 @@ func TestDefaultHandlerRegistersGroup(t *testing.T) {
 	}
 }
 
+func TestDefaultHandlerRecordsBotMembership(t *testing.T) {
+	hookLogger, _ := logtest.NewNullLogger()
+	groupRegistrar := &stubGroupRegistrar{}
+	handler := defaultHandler(logrus.NewEntry(hookLogger), nil, groupRegistrar, 0, commandDiagnostics{})
+
+	update := &models.Update{
+		MyChatMember: &models.ChatMemberUpdated{
+			From:          models.User{ID: 91},
+			Chat:          models.Chat{ID: -700, Type: models.ChatTypeSupergroup, Title: "Ops"},
+			Date:          1700000100,
+			OldChatMember: models.ChatMember{Type: models.ChatMemberTypeMember, Member: &models.ChatMemberMember{}},
+			NewChatMember: models.ChatMember{
+				Type:          models.ChatMemberTypeAdministrator,
+				Administrator: &models.ChatMemberAdministrator{CanDeleteMessages: true, CanInviteUsers: true},
+			},
+		},
+	}
+
+	handler(context.Background(), nil, update)
+
+	if len(groupRegistrar.memberships) != 1 {
+		t.Fatalf("expected one membership change, got %+v", groupRegistrar.memberships)
+	}
+	got := groupRegistrar.memberships[0]
+	want := domain.BotMembership{
+		ChatID:    -700,
+		Title:     "Ops",
+		OldStatus: domain.GroupBotStatusMember,
+		Status:    domain.GroupBotStatusAdministrator,
+		Rights:    &domain.BotRights{CanDeleteMessages: true, CanInviteUsers: true},
+		ChangedBy: 91,
+		ChangedAt: time.Unix(1700000100, 0).UTC(),
+	}
+	if got.Rights == nil || *got.Rights != *want.Rights {
+		t.Fatalf("expected rights %+v, got %+v", want.Rights, got.Rights)
+	}
+	got.Rights, want.Rights = nil, nil
+	if got != want {
+		t.Fatalf("expected membership %+v, got %+v", want, got)
+	}
+
+	// Ordinary group messages do not touch the membership record.
+	handler(context.Background(), nil, &models.Update{Message: &models.Message{
+		From: &models.User{ID: 91},
+		Chat: models.Chat{ID: -700, Type: models.ChatTypeSupergroup},
+		Text: "hi",
+	}})
+	if len(groupRegistrar.memberships) != 1 {
+		t.Fatalf("expected no membership change for a message, got %+v", groupRegistrar.memberships)
+	}
+}
+
+func TestRoutedHandlerPublishesMenusWhenJoiningGroup(t *testing.T) {
+	hookLogger, _ := logtest.NewNullLogger()
+	logger := logrus.NewEntry(hookLogger)
+	router := newMessageRouter(logger, 0, commandDiagnostics{})
+	var joined []int64
+	router.groupJoined = func(_ context.Context, chatID int64) { joined = append(joined, chatID) }
+	handler := routedHandler(logger, nil, &stubGroupRegistrar{}, router)
+
+	membership := func(old, updated models.ChatMember) *models.Update {
+		return &models.Update{MyChatMember: &models.ChatMemberUpdated{
+			From:          models.User{ID: 91},
+			Chat:          models.Chat{ID: -700, Type: models.ChatTypeSupergroup, Title: "Ops"},
+			Date:          1700000100,
+			OldChatMember: old,
+			NewChatMember: updated,
+		}}
+	}
+	left := models.ChatMember{Type: models.ChatMemberTypeLeft, Left: &models.ChatMemberLeft{}}
+	member := models.ChatMember{Type: models.ChatMemberTypeMember, Member: &models.ChatMemberMember{}}
+	admin := models.ChatMember{Type: models.ChatMemberTypeAdministrator, Administrator: &models.ChatMemberAdministrator{}}
+
+	handler(context.Background(), nil, membership(left, member))
+	if len(joined) != 1 || joined[0] != -700 {
+		t.Fatalf("expected menus to be published for the joined group, got %v", joined)
+	}
+
+	// Promotions and removals keep the menus that were already published.
+	handler(context.Background(), nil, membership(member, admin))
+	handler(context.Background(), nil, membership(admin, left))
+	if len(joined) != 1 {
+		t.Fatalf("expected only joins to publish menus, got %v", joined)
+	}
+}
+
+func TestDefaultHandlerMigratesUpgradedGroup(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	groupRegistrar := &stubGroupRegistrar{}
+	handler := defaultHandler(logrus.NewEntry(hookLogger), nil, groupRegistrar, 0, commandDiagnostics{})
+
+	// The old group announces where it moved; it must not be re-registered.
+	handler(context.Background(), nil, &models.Update{Message: &models.Message{
+		From:            &models.User{ID: 92},
+		Chat:            models.Chat{ID: -800, Type: models.ChatTypeGroup, Title: "Ops"},
+		MigrateToChatID: -100800,
+	}})
+	if len(groupRegistrar.calls) != 0 {
+		t.Fatalf("expected the old chat not to be registered, got %+v", groupRegistrar.calls)
+	}
+
+	// The supergroup announces where it came from.
+	handler(context.Background(), nil, &models.Update{Message: &models.Message{
+		From:              &models.User{ID: 92},
+		Chat:              models.Chat{ID: -100800, Type: models.ChatTypeSupergroup, Title: "Ops"},
+		MigrateFromChatID: -800,
+	}})
+	if len(groupRegistrar.calls) != 1 || groupRegistrar.calls[0].chatID != -100800 {
+		t.Fatalf("expected the supergroup to be registered, got %+v", groupRegistrar.calls)
+	}
+
+	want := [][2]int64{{-800, -100800}, {-800, -100800}}
+	if len(groupRegistrar.migrations) != 2 || groupRegistrar.migrations[0] != want[0] || groupRegistrar.migrations[1] != want[1] {
+		t.Fatalf("expected both notices to migrate -800 to -100800, got %v", groupRegistrar.migrations)
+	}
+
+	groupRegistrar.err = errors.New("boom")
+	handler(context.Background(), nil, &models.Update{Message: &models.Message{
+		From:            &models.User{ID: 92},
+		Chat:            models.Chat{ID: -800, Type: models.ChatTypeGroup},
+		MigrateToChatID: -100800,
+	}})
+	entry := findEvent(hook.AllEntries(), "group_migration_failed")
+	if entry == nil || entry.Data["from_chat_id"] != int64(-800) || entry.Data["to_chat_id"] != int64(-100800) {
+		t.Fatalf("expected group_migration_failed log entry, got %+v", entry)
+	}
+}
+
 func TestDefaultHandlerLogsGroupRegistrationErrors(t *testing.T) {
 	hookLogger, hook := logtest.NewNullLogger()
 	groupRegistrar := &stubGroupRegistrar{err: errors.New("boom")}
@@ -515,7 +774,8 @@ func TestDefaultHandlerRoutesPingCommand(t *testing.T) {
 
 func TestDefaultHandlerRoutesStatusCommand(t *testing.T) {
 	hookLogger, hook := logtest.NewNullLogger()
-	handler := defaultHandler(logrus.NewEntry(hookLogger), nil, nil, 55, commandDiagnostics{})
+	fetcher := &stubUserFetcher{user: domain.User{UserID: 55, Role: domain.RoleOwner}}
+	handler := defaultHandler(logrus.NewEntry(hookLogger), nil, nil, 55, commandDiagnostics{userFetcher: fetcher})
 
 	update := &models.Update{
 		Message: &models.Message{
@@ -744,12 +1004,10 @@ func TestStatusCommandRepliesWithCountsForOwner(t *testing.T) {
 		return &models.Message{}, nil
 	}
 
-	fetcher := &stubUserFetcher{user: domain.User{UserID: 500, Role: domain.RoleOwner}}
-	stats := &stubStatsProvider{usersCount: 7, groupsCount: 3}
+	stats := &stubStatsProvider{usersCount: 7, groupsCount: 3, departedCount: 2}
 
-	handler := statusCommandHandler(logrus.NewEntry(hookLogger), 500, commandDiagnostics{
+	handler := statusCommandHandler(logrus.NewEntry(hookLogger), commandDiagnostics{
 		appEnv:        "development",
-		userFetcher:   fetcher,
 		statsProvider: stats,
 	})
 
@@ -778,13 +1036,13 @@ func TestStatusCommandRepliesWithCountsForOwner(t *testing.T) {
 	if !strings.Contains(sentParams.Text, "connected_chats: 3") {
 		t.Fatalf("expected status response to include group count, got %q", sentParams.Text)
 	}
+	if !strings.Contains(sentParams.Text, "departed_chats: 2") {
+		t.Fatalf("expected status response to include departed group count, got %q", sentParams.Text)
+	}
 	if !strings.Contains(sentParams.Text, "registered_users: 7") {
 		t.Fatalf("expected status response to include user count, got %q", sentParams.Text)
 	}
 
-	if len(fetcher.calls) != 1 || fetcher.calls[0] != 500 {
-		t.Fatalf("expected user fetcher to be called once with owner id, got %v", fetcher.calls)
-	}
 	if stats.userCalls != 1 || stats.groupCalls != 1 {
 		t.Fatalf("expected stats provider to be called once for users/groups, got userCalls=%d groupCalls=%d", stats.userCalls, stats.groupCalls)
 	}
@@ -792,12 +1050,9 @@ func TestStatusCommandRepliesWithCountsForOwner(t *testing.T) {
 	if findEvent(hook.AllEntries(), "command_status_sent") == nil {
 		t.Fatalf("expected command_status_sent log entry")
 	}
-	if findEvent(hook.AllEntries(), "command_status_denied") != nil {
-		t.Fatalf("expected no command_status_denied log entry for owner")
-	}
 }
 
-func TestStatusCommandDeniesNonOwner(t *testing.T) {
+func TestDefaultHandlerDeniesStatusForNonOwner(t *testing.T) {
 	hookLogger, hook := logtest.NewNullLogger()
 
 	origSendMessage := sendMessage
@@ -812,7 +1067,7 @@ func TestStatusCommandDeniesNonOwner(t *testing.T) {
 	fetcher := &stubUserFetcher{user: domain.User{UserID: 600, Role: domain.RoleUser}}
 	stats := &stubStatsProvider{usersCount: 9, groupsCount: 4}
 
-	handler := statusCommandHandler(logrus.NewEntry(hookLogger), 500, commandDiagnostics{
+	handler := defaultHandler(logrus.NewEntry(hookLogger), nil, nil, 500, commandDiagnostics{
 		appEnv:        "production",
 		userFetcher:   fetcher,
 		statsProvider: stats,
@@ -835,12 +1090,19 @@ func TestStatusCommandDeniesNonOwner(t *testing.T) {
 		t.Fatalf("expected permission denied message, got %q", sentParams.Text)
 	}
 
+	if len(fetcher.calls) != 1 || fetcher.calls[0] != 600 {
+		t.Fatalf("expected user fetcher to be called once with caller id, got %v", fetcher.calls)
+	}
 	if stats.userCalls != 0 || stats.groupCalls != 0 {
 		t.Fatalf("expected stats provider not to be called on denial, got userCalls=%d groupCalls=%d", stats.userCalls, stats.groupCalls)
 	}
 
-	if findEvent(hook.AllEntries(), "command_status_denied") == nil {
-		t.Fatalf("expected command_status_denied log entry")
+	denied := findEvent(hook.AllEntries(), "command_denied")
+	if denied == nil {
+		t.Fatalf("expected command_denied log entry")
+	}
+	if denied.Data["reason"] != "insufficient_role" || denied.Data["command"] != "status" {
+		t.Fatalf("expected insufficient_role denial for status, got reason=%v command=%v", denied.Data["reason"], denied.Data["command"])
 	}
 	if findEvent(hook.AllEntries(), "command_status_sent") != nil {
 		t.Fatalf("expected no command_status_sent log entry for denied user")
@@ -859,7 +1121,6 @@ func TestStatusCommandHandlesCountErrors(t *testing.T) {
 		return &models.Message{}, nil
 	}
 
-	fetcher := &stubUserFetcher{user: domain.User{UserID: 501, Role: domain.RoleOwner}}
 	stats := &stubStatsProvider{
 		userErr:     errors.New("users down"),
 		groupErr:    errors.New("groups down"),
@@ -867,9 +1128,8 @@ func TestStatusCommandHandlesCountErrors(t *testing.T) {
 		groupsCount: 0,
 	}
 
-	handler := statusCommandHandler(logrus.NewEntry(hookLogger), 501, commandDiagnostics{
+	handler := statusCommandHandler(logrus.NewEntry(hookLogger), commandDiagnostics{
 		appEnv:        "production",
-		userFetcher:   fetcher,
 		statsProvider: stats,
 	})
 
@@ -978,18 +1238,24 @@ func TestDefaultHandlerRoutesGenericMessage(t *testing.T) {
 }
 
 type stubUserRegistrar struct {
-	calls []int64
-	err   error
+	calls    []int64
+	profiles []domain.UserProfile
+	created  bool
+	err      error
 }
 
-func (s *stubUserRegistrar) EnsureUser(_ context.Context, userID int64) (bool, error) {
-	s.calls = append(s.calls, userID)
-	return false, s.err
+func (s *stubUserRegistrar) EnsureUser(_ context.Context, profile domain.UserProfile) (bool, error) {
+	s.calls = append(s.calls, profile.UserID)
+	s.profiles = append(s.profiles, profile)
+	return s.created, s.err
 }
 
 type stubGroupRegistrar struct {
-	calls []groupCall
-	err   error
+	calls       []groupCall
+	memberships []domain.BotMembership
+	migrations  [][2]int64
+	created     bool
+	err         error
 }
 
 type groupCall struct {
@@ -999,7 +1265,17 @@ type groupCall struct {
 
 func (s *stubGroupRegistrar) EnsureGroup(_ context.Context, chatID int64, title string) (bool, error) {
 	s.calls = append(s.calls, groupCall{chatID: chatID, title: title})
-	return false, s.err
+	return s.created, s.err
+}
+
+func (s *stubGroupRegistrar) MigrateGroup(_ context.Context, fromChatID, toChatID int64, title string) (bool, error) {
+	s.migrations = append(s.migrations, [2]int64{fromChatID, toChatID})
+	return true, s.err
+}
+
+func (s *stubGroupRegistrar) RecordBotMembership(_ context.Context, change domain.BotMembership) error {
+	s.memberships = append(s.memberships, change)
+	return s.err
 }
 
 type stubMongoChecker struct {
@@ -1024,12 +1300,13 @@ func (s *stubUserFetcher) GetByID(ctx context.Context, userID int64) (domain.Use
 }
 
 type stubStatsProvider struct {
-	usersCount  int64
-	groupsCount int64
-	userErr     error
-	groupErr    error
-	userCalls   int
-	groupCalls  int
+	usersCount    int64
+	groupsCount   int64
+	departedCount int64
+	userErr       error
+	groupErr      error
+	userCalls     int
+	groupCalls    int
 }
 
 func (s *stubStatsProvider) CountUsers(ctx context.Context) (int64, error) {
@@ -1042,6 +1319,10 @@ func (s *stubStatsProvider) CountGroups(ctx context.Context) (int64, error) {
 	return s.groupsCount, s.groupErr
 }
 
+func (s *stubStatsProvider) CountDepartedGroups(ctx context.Context) (int64, error) {
+	return s.departedCount, s.groupErr
+}
+
 func findEvent(entries []*logrus.Entry, event string) *logrus.Entry {
 	for _, entry := range entries {
 		if entry.Data["event"] == event {
@@ -0,0 +1,198 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/sirupsen/logrus"
+
+	"tg_pay_gateway_bot/internal/config"
+	"tg_pay_gateway_bot/internal/logging"
+)
+
+const (
+	webhookSecretHeader      = "X-Telegram-Bot-Api-Secret-Token"
+	webhookReadHeaderTimeout = 5 * time.Second
+	webhookShutdownTimeout   = 5 * time.Second
+	webhookMaxBodyBytes      = 1 << 20
+)
+
+type webhookSettings struct {
+	enabled    bool
+	url        string
+	listenAddr string
+	path       string
+	secret     string
+}
+
+func newWebhookSettings(cfg config.Config) webhookSettings {
+	if !cfg.UsesWebhook() {
+		return webhookSettings{}
+	}
+
+	settings := webhookSettings{
+		enabled:    true,
+		url:        cfg.WebhookURL,
+		listenAddr: cfg.WebhookListenAddr,
+		path:       cfg.WebhookPath,
+		secret:     cfg.WebhookSecret,
+	}
+
+	if settings.listenAddr == "" {
+		settings.listenAddr = config.DefaultWebhookListenAddr
+	}
+	if settings.path == "" {
+		settings.path = config.DefaultWebhookPath
+	}
+
+	return settings
+}
+
+// UsesWebhook reports whether the client receives updates through the webhook
+// listener instead of long polling.
+func (c *Client) UsesWebhook() bool {
+	return c != nil && c.webhook.enabled
+}
+
+// SetWebhook registers the configured webhook URL and secret token with
+// Telegram so updates are pushed to the listener started by Start.
+func (c *Client) SetWebhook(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if !c.UsesWebhook() {
+		return errors.New("webhook mode is not enabled")
+	}
+
+	ok, err := c.bot.SetWebhook(ctx, &bot.SetWebhookParams{
+		URL:            c.webhook.url,
+		AllowedUpdates: defaultAllowedUpdates,
+		SecretToken:    c.webhook.secret,
+	})
+	if err != nil {
+		return fmt.Errorf("set telegram webhook: %w", err)
+	}
+	if !ok {
+		return errors.New("set telegram webhook: request not acknowledged")
+	}
+
+	c.logger.WithFields(logging.Fields{
+		"event":       "telegram_webhook_set",
+		"webhook_url": c.webhook.url,
+	}).Info("registered telegram webhook")
+
+	return nil
+}
+
+// DeleteWebhook removes the webhook registration from Telegram. Pending
+// updates are kept so the next instance can receive them.
+func (c *Client) DeleteWebhook(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("context is required")
+	}
+	if c == nil || c.bot == nil {
+		return errors.New("telegram client is not initialized")
+	}
+
+	ok, err := c.bot.DeleteWebhook(ctx, &bot.DeleteWebhookParams{})
+	if err != nil {
+		return fmt.Errorf("delete telegram webhook: %w", err)
+	}
+	if !ok {
+		return errors.New("delete telegram webhook: request not acknowledged")
+	}
+
+	c.logger.WithField("event", "telegram_webhook_deleted").Info("deleted telegram webhook")
+
+	return nil
+}
+
+// WebhookHandler returns the HTTP handler that verifies the secret token header
+// and hands updates to the same default handler used by long polling.
+func (c *Client) WebhookHandler() http.Handler {
+	return webhookHandler(c.logger, c.webhook.secret, c.bot.WebhookHandler())
+}
+
+func (c *Client) startWebhook(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle(c.webhook.path, c.WebhookHandler())
+
+	server := &http.Server{
+		Addr:              c.webhook.listenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: webhookReadHeaderTimeout,
+	}
+
+	c.logger.WithFields(logging.Fields{
+		"event":           "telegram_listen",
+		"mode":            config.UpdateModeWebhook,
+		"listen_addr":     c.webhook.listenAddr,
+		"path":            c.webhook.path,
+		"allowed_updates": defaultAllowedUpdates,
+	}).Info("starting telegram webhook listener")
+
+	workerCtx, cancelWorkers := context.WithCancel(ctx)
+	workersDone := make(chan struct{})
+	go func() {
+		c.bot.StartWebhook(workerCtx)
+		close(workersDone)
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.WithFields(logging.Fields{
+				"event":       "telegram_webhook_server_error",
+				"listen_addr": c.webhook.listenAddr,
+			}).WithError(err).Error("telegram webhook listener failed")
+		}
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		c.logger.WithField("event", "telegram_webhook_shutdown_error").WithError(err).Error("failed to stop telegram webhook listener")
+	}
+	cancelShutdown()
+
+	cancelWorkers()
+	<-workersDone
+
+	c.logger.WithField("event", "telegram_stopped").Info("telegram webhook listener stopped")
+}
+
+func webhookHandler(logger *logrus.Entry, secret string, next http.Handler) http.HandlerFunc {
+	if logger == nil {
+		logger = logging.Logger()
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(secret)) != 1 {
+			logger.WithFields(logging.Fields{
+				"event":       "telegram_webhook_unauthorized",
+				"remote_addr": r.RemoteAddr,
+			}).Warn("rejected webhook request with invalid secret token")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, webhookMaxBodyBytes)
+		next.ServeHTTP(w, r)
+	}
+}
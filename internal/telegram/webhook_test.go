@@ -0,0 +1,251 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"tg_pay_gateway_bot/internal/config"
+)
+
+func webhookConfig() config.Config {
+	return config.Config{
+		TelegramToken:     "123:token",
+		UpdateMode:        config.UpdateModeWebhook,
+		WebhookURL:        "https://bot.example.com/telegram/webhook",
+		WebhookListenAddr: "127.0.0.1:0",
+		WebhookPath:       config.DefaultWebhookPath,
+		WebhookSecret:     "hook_secret",
+	}
+}
+
+func TestWebhookDeliversUpdatesToDefaultHandler(t *testing.T) {
+	origCreateBot := createBot
+	defer func() { createBot = origCreateBot }()
+
+	createBot = func(token string, options ...bot.Option) (botRunner, error) {
+		return bot.New(token, append(options, bot.WithSkipGetMe())...)
+	}
+
+	hookLogger, hook := logtest.NewNullLogger()
+	client, err := NewClient(webhookConfig(), logrus.NewEntry(hookLogger))
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	if !client.UsesWebhook() {
+		t.Fatalf("expected client to use webhook mode")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.runDispatcher(ctx)
+	go client.bot.StartWebhook(ctx)
+
+	server := httptest.NewServer(client.WebhookHandler())
+	defer server.Close()
+
+	body := `{"update_id":1,"message":{"message_id":5,"date":1700002000,"from":{"id":31,"is_bot":false,"first_name":"A"},"chat":{"id":131,"type":"private"},"text":"hello webhook"}}`
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	req.Header.Set(webhookSecretHeader, "hook_secret")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post update: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var entry *logrus.Entry
+	for time.Now().Before(deadline) {
+		if entry = findEvent(hook.AllEntries(), "telegram_update"); entry != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if entry == nil {
+		t.Fatalf("expected telegram_update log entry from webhook delivery")
+	}
+	if entry.Data["user_id"] != int64(31) || entry.Data["chat_id"] != int64(131) {
+		t.Fatalf("expected user_id=31 and chat_id=131, got user_id=%v chat_id=%v", entry.Data["user_id"], entry.Data["chat_id"])
+	}
+	if entry.Data["handler"] != "generic_message" {
+		t.Fatalf("expected handler=generic_message, got %v", entry.Data["handler"])
+	}
+}
+
+func TestWebhookHandlerRejectsInvalidSecret(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+
+	called := false
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	})
+
+	server := httptest.NewServer(webhookHandler(logrus.NewEntry(hookLogger), "hook_secret", next))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	req.Header.Set(webhookSecretHeader, "wrong")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post update: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", resp.StatusCode)
+	}
+	if called {
+		t.Fatalf("expected update not to be forwarded with invalid secret")
+	}
+	if findEvent(hook.AllEntries(), "telegram_webhook_unauthorized") == nil {
+		t.Fatalf("expected telegram_webhook_unauthorized log entry")
+	}
+}
+
+func TestWebhookHandlerRejectsNonPost(t *testing.T) {
+	hookLogger, _ := logtest.NewNullLogger()
+
+	server := httptest.NewServer(webhookHandler(logrus.NewEntry(hookLogger), "hook_secret", http.NotFoundHandler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("get webhook: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestClientSetWebhookUsesConfiguredSettings(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	fb := &fakeBot{}
+	client := &Client{
+		bot:     fb,
+		logger:  logrus.NewEntry(hookLogger),
+		webhook: newWebhookSettings(webhookConfig()),
+	}
+
+	if err := client.SetWebhook(context.Background()); err != nil {
+		t.Fatalf("SetWebhook returned error: %v", err)
+	}
+
+	if fb.setWebhookParams == nil {
+		t.Fatalf("expected setWebhook to be called")
+	}
+	if fb.setWebhookParams.URL != "https://bot.example.com/telegram/webhook" {
+		t.Fatalf("expected webhook url to be passed, got %q", fb.setWebhookParams.URL)
+	}
+	if fb.setWebhookParams.SecretToken != "hook_secret" {
+		t.Fatalf("expected secret token to be passed, got %q", fb.setWebhookParams.SecretToken)
+	}
+	if len(fb.setWebhookParams.AllowedUpdates) != len(defaultAllowedUpdates) {
+		t.Fatalf("expected allowed updates %v, got %v", defaultAllowedUpdates, fb.setWebhookParams.AllowedUpdates)
+	}
+
+	entry := findEvent(hook.AllEntries(), "telegram_webhook_set")
+	if entry == nil {
+		t.Fatalf("expected telegram_webhook_set log entry")
+	}
+	if _, ok := entry.Data["secret"]; ok {
+		t.Fatalf("expected webhook secret not to be logged")
+	}
+
+	if err := client.DeleteWebhook(context.Background()); err != nil {
+		t.Fatalf("DeleteWebhook returned error: %v", err)
+	}
+	if fb.deleteWebhookCalls != 1 {
+		t.Fatalf("expected deleteWebhook to be called once, got %d", fb.deleteWebhookCalls)
+	}
+}
+
+func TestClientSetWebhookPropagatesErrors(t *testing.T) {
+	expected := errors.New("boom")
+	client := &Client{
+		bot:     &fakeBot{setWebhookErr: expected},
+		logger:  logrus.NewEntry(logrus.New()),
+		webhook: newWebhookSettings(webhookConfig()),
+	}
+
+	if err := client.SetWebhook(context.Background()); !errors.Is(err, expected) {
+		t.Fatalf("expected error %v, got %v", expected, err)
+	}
+}
+
+func TestClientSetWebhookRequiresWebhookMode(t *testing.T) {
+	client := &Client{
+		bot:    &fakeBot{},
+		logger: logrus.NewEntry(logrus.New()),
+	}
+
+	if err := client.SetWebhook(context.Background()); err == nil {
+		t.Fatalf("expected error when webhook mode is disabled")
+	}
+}
+
+func TestClientStartRunsWebhookListener(t *testing.T) {
+	hookLogger, hook := logtest.NewNullLogger()
+	fb := &fakeBot{}
+	client := &Client{
+		bot:     fb,
+		logger:  logrus.NewEntry(hookLogger),
+		webhook: newWebhookSettings(webhookConfig()),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.Start(ctx)
+		close(done)
+	}()
+
+	waitFor(t, client.Running)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected webhook listener to stop after cancellation")
+	}
+	if client.Running() {
+		t.Fatalf("expected client to report stopped after Start returns")
+	}
+
+	if fb.startedWith != nil {
+		t.Fatalf("expected long polling not to start in webhook mode")
+	}
+	if fb.webhookStartedWith == nil {
+		t.Fatalf("expected webhook workers to start")
+	}
+
+	listen := findEvent(hook.AllEntries(), "telegram_listen")
+	if listen == nil || listen.Data["mode"] != config.UpdateModeWebhook {
+		t.Fatalf("expected telegram_listen log entry with mode=webhook, got %v", listen)
+	}
+	if findEvent(hook.AllEntries(), "telegram_stopped") == nil {
+		t.Fatalf("expected telegram_stopped log entry")
+	}
+}